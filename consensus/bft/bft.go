@@ -0,0 +1,524 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bft
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/op/go-logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/core/peer"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+var logger *logging.Logger // package-level logger
+
+// blockVoteCountHistogram is the number of votes of the committed blocks
+var blockVoteCountHistogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Namespace: "peer",
+	Name:      "block_vote_count",
+	Help:      "Number of validator votes of the blocks committed by the BFT consensus.",
+	Buckets:   prometheus.LinearBuckets(1, 1, 16),
+})
+
+func init() {
+	logger = logging.MustGetLogger("consensus/bft")
+	prometheus.MustRegister(blockVoteCountHistogram)
+}
+
+// stack is the subset of consensus.Stack used by the adapter
+type stack interface {
+	consensus.NetworkStack
+	consensus.SecurityUtils
+	consensus.LegacyExecutor
+	GetBlockchainSize() uint64
+}
+
+// BFTConsensusAdapter is a simplified single-shot BFT consensus plugin. In
+// every round the leader proposes a block of queued transactions with
+// CHAIN_PROPOSE_BLOCK, every validator answers with a signed CHAIN_VOTE_BLOCK,
+// and once 2f+1 validators voted the leader sends CHAIN_COMMIT_BLOCK with the
+// votes, upon which every validator executes and commits the block. There is
+// no view change: a faulty leader stalls its round.
+type BFTConsensusAdapter struct {
+	sync.Mutex
+	stack        stack
+	batchSize    int
+	batchTimeout time.Duration
+	timer        *time.Timer
+	timerArmed   bool
+
+	round     uint64
+	pending   []*pb.Transaction
+	proposal  *pb.Block
+	blockHash []byte
+	voted     bool
+	votes     map[string]*pb.BlockVote
+	committed bool
+	// deferred holds proposals and commits received for later rounds
+	deferred []deferredMessage
+}
+
+type deferredMessage struct {
+	round    uint64
+	proposal *pb.BlockProposal
+	commit   *pb.BlockCommit
+	sender   *pb.PeerID
+}
+
+var pluginInstance consensus.Consenter // singleton service
+
+// GetPlugin returns the BFT consenter, creating it on first use
+func GetPlugin(c consensus.Stack) consensus.Consenter {
+	if pluginInstance == nil {
+		pluginInstance = New(c, viper.GetInt("peer.validator.consensus.bft.batchSize"), viper.GetDuration("peer.validator.consensus.bft.batchTimeout"))
+	}
+	return pluginInstance
+}
+
+// New returns an adapter proposing blocks of up to batchSize transactions,
+// or of the transactions queued batchTimeout after the first one
+func New(s stack, batchSize int, batchTimeout time.Duration) *BFTConsensusAdapter {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	a := &BFTConsensusAdapter{
+		stack:        s,
+		batchSize:    batchSize,
+		batchTimeout: batchTimeout,
+		round:        s.GetBlockchainSize(),
+	}
+	a.timer = time.AfterFunc(batchTimeout, a.batchTimedOut)
+	a.timer.Stop()
+	a.startRound()
+	logger.Infof("BFT consensus starting at round %d, batch size %d, batch timeout %s", a.round, batchSize, batchTimeout)
+	return a
+}
+
+// RecvMsg implements consensus.Consenter
+func (a *BFTConsensusAdapter) RecvMsg(msg *pb.Message, senderHandle *pb.PeerID) error {
+	a.Lock()
+	defer a.Unlock()
+	switch msg.Type {
+	case pb.Message_CHAIN_TRANSACTION:
+		tx := &pb.Transaction{}
+		if err := proto.Unmarshal(msg.Payload, tx); err != nil {
+			return fmt.Errorf("Error unmarshalling transaction: %s", err)
+		}
+		payload, err := proto.Marshal(&pb.TransactionBlock{Transactions: []*pb.Transaction{tx}})
+		if err != nil {
+			return err
+		}
+		a.broadcast(&pb.Message{Type: pb.Message_CONSENSUS, Payload: payload})
+		a.enqueue(tx)
+	case pb.Message_CONSENSUS:
+		txs := &pb.TransactionBlock{}
+		if err := proto.Unmarshal(msg.Payload, txs); err != nil {
+			return fmt.Errorf("Error unmarshalling transactions: %s", err)
+		}
+		for _, tx := range txs.Transactions {
+			a.enqueue(tx)
+		}
+	case pb.Message_CHAIN_PROPOSE_BLOCK:
+		proposal := &pb.BlockProposal{}
+		if err := proto.Unmarshal(msg.Payload, proposal); err != nil {
+			return fmt.Errorf("Error unmarshalling BlockProposal: %s", err)
+		}
+		if proposal.Round > a.round {
+			a.deferred = append(a.deferred, deferredMessage{round: proposal.Round, proposal: proposal, sender: senderHandle})
+			return nil
+		}
+		return a.handleProposal(proposal, senderHandle)
+	case pb.Message_CHAIN_VOTE_BLOCK:
+		vote := &pb.BlockVote{}
+		if err := proto.Unmarshal(msg.Payload, vote); err != nil {
+			return fmt.Errorf("Error unmarshalling BlockVote: %s", err)
+		}
+		return a.handleVote(vote)
+	case pb.Message_CHAIN_COMMIT_BLOCK:
+		commit := &pb.BlockCommit{}
+		if err := proto.Unmarshal(msg.Payload, commit); err != nil {
+			return fmt.Errorf("Error unmarshalling BlockCommit: %s", err)
+		}
+		if commit.Round > a.round {
+			a.deferred = append(a.deferred, deferredMessage{round: commit.Round, commit: commit, sender: senderHandle})
+			return nil
+		}
+		return a.handleCommit(commit, senderHandle)
+	default:
+		logger.Warningf("Ignoring message of type %s", msg.Type)
+	}
+	return nil
+}
+
+// validators returns the handle of this validator and the sorted handles of the whole validating network
+func (a *BFTConsensusAdapter) validators() (*pb.PeerID, []*pb.PeerID, error) {
+	self, network, err := a.stack.GetNetworkHandles()
+	if err != nil {
+		return nil, nil, err
+	}
+	seen := make(map[string]bool)
+	var validators []*pb.PeerID
+	for _, id := range append(network, self) {
+		if !seen[id.Name] {
+			seen[id.Name] = true
+			validators = append(validators, id)
+		}
+	}
+	sort.Sort(byName(validators))
+	return self, validators, nil
+}
+
+type byName []*pb.PeerID
+
+func (s byName) Len() int           { return len(s) }
+func (s byName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+// quorum returns 2f+1 for a network of n validators tolerating f = (n-1)/3 faults
+func quorum(n int) int {
+	return 2*((n-1)/3) + 1
+}
+
+func (a *BFTConsensusAdapter) leader(round uint64) (*pb.PeerID, error) {
+	_, validators, err := a.validators()
+	if err != nil {
+		return nil, err
+	}
+	return validators[round%uint64(len(validators))], nil
+}
+
+func (a *BFTConsensusAdapter) isLeader(round uint64) bool {
+	self, _, err := a.validators()
+	if err != nil {
+		logger.Errorf("Error retrieving validating network: %s", err)
+		return false
+	}
+	leader, err := a.leader(round)
+	return err == nil && leader.Name == self.Name
+}
+
+func (a *BFTConsensusAdapter) enqueue(tx *pb.Transaction) {
+	for _, queued := range a.pending {
+		if queued.Uuid == tx.Uuid {
+			return
+		}
+	}
+	a.pending = append(a.pending, tx)
+	a.maybePropose()
+}
+
+// maybePropose proposes a block if this validator leads the round and a batch is ready
+func (a *BFTConsensusAdapter) maybePropose() {
+	if a.proposal != nil || len(a.pending) == 0 || !a.isLeader(a.round) {
+		return
+	}
+	if len(a.pending) < a.batchSize {
+		if !a.timerArmed {
+			a.timerArmed = true
+			a.timer.Reset(a.batchTimeout)
+		}
+		return
+	}
+	a.propose()
+}
+
+func (a *BFTConsensusAdapter) batchTimedOut() {
+	a.Lock()
+	defer a.Unlock()
+	a.timerArmed = false
+	if a.proposal == nil && len(a.pending) > 0 && a.isLeader(a.round) {
+		a.propose()
+	}
+}
+
+// blockSelector is implemented by the stacks auctioning the inclusion of the
+// transactions of their mempool in blocks by gas price
+type blockSelector interface {
+	SelectForBlock(maxGas uint64) []*pb.Transaction
+}
+
+// selectTransactions returns up to batchSize pending transactions to propose,
+// in the order they were queued. With a peer.tx.blockGasLimit and a stack
+// auctioning its mempool, the pending transactions winning the auction are
+// proposed instead, highest gas price first, unless none of the pending
+// transactions is in the mempool, as when submitted through other peers.
+func (a *BFTConsensusAdapter) selectTransactions() []*pb.Transaction {
+	var transactions []*pb.Transaction
+	selector, ok := a.stack.(blockSelector)
+	if maxGas := uint64(viper.GetInt("peer.tx.blockGasLimit")); ok && maxGas > 0 {
+		pending := make(map[string]*pb.Transaction)
+		for _, tx := range a.pending {
+			pending[tx.Uuid] = tx
+		}
+		for _, tx := range selector.SelectForBlock(maxGas) {
+			if queued, ok := pending[tx.Uuid]; ok && len(transactions) < a.batchSize {
+				transactions = append(transactions, queued)
+			}
+		}
+	}
+	if len(transactions) == 0 {
+		n := len(a.pending)
+		if n > a.batchSize {
+			n = a.batchSize
+		}
+		transactions = append(transactions, a.pending[:n]...)
+	}
+	return transactions
+}
+
+func (a *BFTConsensusAdapter) propose() {
+	a.timer.Stop()
+	a.timerArmed = false
+	block := &pb.Block{Transactions: a.selectTransactions()}
+	n := len(block.Transactions)
+	proposal := &pb.BlockProposal{Round: a.round, Block: block}
+	payload, err := proto.Marshal(proposal)
+	if err != nil {
+		logger.Errorf("Error marshalling BlockProposal: %s", err)
+		return
+	}
+	logger.Debugf("Proposing block of %d transactions for round %d", n, a.round)
+	a.broadcast(&pb.Message{Type: pb.Message_CHAIN_PROPOSE_BLOCK, Payload: payload})
+	self, _, _ := a.validators()
+	if err := a.handleProposal(proposal, self); err != nil {
+		logger.Errorf("Error handling own proposal: %s", err)
+	}
+}
+
+func (a *BFTConsensusAdapter) handleProposal(proposal *pb.BlockProposal, sender *pb.PeerID) error {
+	if proposal.Round != a.round {
+		return fmt.Errorf("Received proposal for round %d during round %d", proposal.Round, a.round)
+	}
+	leader, err := a.leader(proposal.Round)
+	if err != nil {
+		return err
+	}
+	if sender == nil || sender.Name != leader.Name {
+		return fmt.Errorf("Received proposal for round %d from %v, the leader is %s", proposal.Round, sender, leader.Name)
+	}
+	if a.voted || proposal.Block == nil {
+		return nil
+	}
+	blockHash, err := proposal.Block.GetHash()
+	if err != nil {
+		return fmt.Errorf("Error hashing proposed block: %s", err)
+	}
+	a.proposal = proposal.Block
+	a.blockHash = blockHash
+	a.voted = true
+
+	self, _, err := a.validators()
+	if err != nil {
+		return err
+	}
+	sig, err := a.stack.Sign(peer.BlockVoteBytes(proposal.Round, blockHash))
+	if err != nil {
+		return fmt.Errorf("Error signing vote: %s", err)
+	}
+	vote := &pb.BlockVote{Round: proposal.Round, BlockHash: blockHash, VoterSig: sig, Voter: self}
+	payload, err := proto.Marshal(vote)
+	if err != nil {
+		return fmt.Errorf("Error marshalling BlockVote: %s", err)
+	}
+	a.broadcast(&pb.Message{Type: pb.Message_CHAIN_VOTE_BLOCK, Payload: payload})
+	return a.handleVote(vote)
+}
+
+func (a *BFTConsensusAdapter) verifyVote(vote *pb.BlockVote, round uint64, blockHash []byte) error {
+	if vote.Voter == nil {
+		return fmt.Errorf("Vote without voter")
+	}
+	if vote.Round != round || !bytes.Equal(vote.BlockHash, blockHash) {
+		return fmt.Errorf("Vote of %s is not for the block of round %d", vote.Voter.Name, round)
+	}
+	return a.stack.Verify(vote.Voter, vote.VoterSig, peer.BlockVoteBytes(vote.Round, vote.BlockHash))
+}
+
+// handleVote collects votes on the leader, which commits once a quorum voted for its proposal
+func (a *BFTConsensusAdapter) handleVote(vote *pb.BlockVote) error {
+	if vote.Round != a.round || a.committed || !a.isLeader(a.round) || a.proposal == nil {
+		return nil
+	}
+	if err := a.verifyVote(vote, a.round, a.blockHash); err != nil {
+		return fmt.Errorf("Rejecting vote: %s", err)
+	}
+	a.votes[vote.Voter.Name] = vote
+	_, validators, err := a.validators()
+	if err != nil {
+		return err
+	}
+	if len(a.votes) < quorum(len(validators)) {
+		return nil
+	}
+	commit := &pb.BlockCommit{Round: a.round, BlockHash: a.blockHash}
+	for _, v := range a.votes {
+		commit.AggregateSig = append(commit.AggregateSig, v)
+	}
+	payload, err := proto.Marshal(commit)
+	if err != nil {
+		return fmt.Errorf("Error marshalling BlockCommit: %s", err)
+	}
+	a.broadcast(&pb.Message{Type: pb.Message_CHAIN_COMMIT_BLOCK, Payload: payload})
+	self, _, _ := a.validators()
+	return a.handleCommit(commit, self)
+}
+
+func (a *BFTConsensusAdapter) handleCommit(commit *pb.BlockCommit, sender *pb.PeerID) error {
+	if commit.Round != a.round || a.committed {
+		return nil
+	}
+	if a.proposal == nil || !bytes.Equal(commit.BlockHash, a.blockHash) {
+		return fmt.Errorf("Received commit for round %d of a block which was not proposed", commit.Round)
+	}
+	_, validators, err := a.validators()
+	if err != nil {
+		return err
+	}
+	voters := make(map[string]bool)
+	for _, vote := range commit.AggregateSig {
+		if err := a.verifyVote(vote, commit.Round, commit.BlockHash); err != nil {
+			return fmt.Errorf("Rejecting commit for round %d: %s", commit.Round, err)
+		}
+		voters[vote.Voter.Name] = true
+	}
+	if len(voters) < quorum(len(validators)) {
+		return fmt.Errorf("Rejecting commit for round %d with %d votes, %d required", commit.Round, len(voters), quorum(len(validators)))
+	}
+	a.committed = true
+	metadata, err := proto.Marshal(commitVotes(commit))
+	if err != nil {
+		return fmt.Errorf("Error marshalling BlockVotes: %s", err)
+	}
+	if err := a.execute(a.proposal, metadata); err != nil {
+		return err
+	}
+	blockVoteCountHistogram.Observe(float64(len(commit.AggregateSig)))
+	a.removePending(a.proposal.Transactions)
+	a.round++
+	a.startRound()
+	a.replayDeferred()
+	a.maybePropose()
+	return nil
+}
+
+// replayDeferred handles the messages deferred for the current round, keeping those for later rounds
+func (a *BFTConsensusAdapter) replayDeferred() {
+	var current, later []deferredMessage
+	for _, msg := range a.deferred {
+		switch {
+		case msg.round == a.round:
+			current = append(current, msg)
+		case msg.round > a.round:
+			later = append(later, msg)
+		}
+	}
+	a.deferred = later
+	for _, msg := range current {
+		var err error
+		if msg.proposal != nil {
+			err = a.handleProposal(msg.proposal, msg.sender)
+		} else {
+			err = a.handleCommit(msg.commit, msg.sender)
+		}
+		if err != nil {
+			logger.Warningf("Error handling deferred message for round %d: %s", msg.round, err)
+		}
+	}
+}
+
+// commitVotes returns the votes of commit, recorded as the consensus metadata
+// of the committed block for block headers to carry them
+func commitVotes(commit *pb.BlockCommit) *pb.BlockVotes {
+	votes := &pb.BlockVotes{Round: commit.Round, BlockHash: commit.BlockHash}
+	for _, vote := range commit.AggregateSig {
+		votes.Votes = append(votes.Votes, &pb.ValidatorVote{ValidatorID: vote.Voter, Signature: vote.VoterSig})
+	}
+	sort.Sort(byValidatorID(votes.Votes))
+	return votes
+}
+
+type byValidatorID []*pb.ValidatorVote
+
+func (s byValidatorID) Len() int           { return len(s) }
+func (s byValidatorID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byValidatorID) Less(i, j int) bool { return s[i].ValidatorID.Name < s[j].ValidatorID.Name }
+
+func (a *BFTConsensusAdapter) execute(block *pb.Block, metadata []byte) error {
+	tag := a.round
+	if err := a.stack.BeginTxBatch(tag); err != nil {
+		return err
+	}
+	if _, err := a.stack.ExecTxs(tag, block.Transactions); err != nil {
+		a.stack.RollbackTxBatch(tag)
+		return fmt.Errorf("Error executing transactions of round %d: %s", a.round, err)
+	}
+	if _, err := a.stack.CommitTxBatch(tag, metadata); err != nil {
+		a.stack.RollbackTxBatch(tag)
+		return fmt.Errorf("Error committing transactions of round %d: %s", a.round, err)
+	}
+	logger.Infof("Committed block of %d transactions in round %d", len(block.Transactions), a.round)
+	return nil
+}
+
+func (a *BFTConsensusAdapter) removePending(committed []*pb.Transaction) {
+	done := make(map[string]bool)
+	for _, tx := range committed {
+		done[tx.Uuid] = true
+	}
+	var pending []*pb.Transaction
+	for _, tx := range a.pending {
+		if !done[tx.Uuid] {
+			pending = append(pending, tx)
+		}
+	}
+	a.pending = pending
+}
+
+func (a *BFTConsensusAdapter) startRound() {
+	a.proposal = nil
+	a.blockHash = nil
+	a.voted = false
+	a.votes = make(map[string]*pb.BlockVote)
+	a.committed = false
+}
+
+func (a *BFTConsensusAdapter) broadcast(msg *pb.Message) {
+	if err := a.stack.Broadcast(msg, pb.PeerEndpoint_VALIDATOR); err != nil {
+		logger.Errorf("Error broadcasting %s: %s", msg.Type, err)
+	}
+}
+
+// Executed implements consensus.ExecutionConsumer, blocks are executed through the LegacyExecutor
+func (a *BFTConsensusAdapter) Executed(tag interface{}) {}
+
+// Committed implements consensus.ExecutionConsumer
+func (a *BFTConsensusAdapter) Committed(tag interface{}, target *pb.BlockchainInfo) {}
+
+// RolledBack implements consensus.ExecutionConsumer
+func (a *BFTConsensusAdapter) RolledBack(tag interface{}) {}
+
+// StateUpdated implements consensus.ExecutionConsumer
+func (a *BFTConsensusAdapter) StateUpdated(tag interface{}, target *pb.BlockchainInfo) {}
@@ -0,0 +1,324 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bft
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/core/peer"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+type testMessage struct {
+	msg    *pb.Message
+	sender *pb.PeerID
+}
+
+// testNetwork delivers the messages of an in-process cluster, each node
+// handling its messages in order on its own goroutine
+type testNetwork struct {
+	nodes map[string]*testNode
+	ids   []*pb.PeerID
+}
+
+type testNode struct {
+	sync.Mutex
+	network  *testNetwork
+	id       *pb.PeerID
+	inbox    chan testMessage
+	adapter  *BFTConsensusAdapter
+	executed []*pb.Transaction
+	blocks   [][]*pb.Transaction
+	metadata [][]byte
+}
+
+func newTestNetwork(n int, batchSize int, batchTimeout time.Duration) *testNetwork {
+	net := &testNetwork{nodes: make(map[string]*testNode)}
+	for i := 0; i < n; i++ {
+		id := &pb.PeerID{Name: fmt.Sprintf("vp%d", i)}
+		net.ids = append(net.ids, id)
+		net.nodes[id.Name] = &testNode{network: net, id: id, inbox: make(chan testMessage, 100)}
+	}
+	for _, id := range net.ids {
+		node := net.nodes[id.Name]
+		node.adapter = New(node, batchSize, batchTimeout)
+		go node.run()
+	}
+	return net
+}
+
+func (net *testNetwork) stop() {
+	for _, node := range net.nodes {
+		close(node.inbox)
+	}
+}
+
+func (node *testNode) run() {
+	for m := range node.inbox {
+		if err := node.adapter.RecvMsg(m.msg, m.sender); err != nil {
+			logger.Debugf("%s: %s", node.id.Name, err)
+		}
+	}
+}
+
+func (node *testNode) committedBlocks() [][]*pb.Transaction {
+	node.Lock()
+	defer node.Unlock()
+	return append([][]*pb.Transaction(nil), node.blocks...)
+}
+
+func (node *testNode) Broadcast(msg *pb.Message, peerType pb.PeerEndpoint_Type) error {
+	for _, id := range node.network.ids {
+		if id.Name != node.id.Name {
+			node.Unicast(msg, id)
+		}
+	}
+	return nil
+}
+
+func (node *testNode) Unicast(msg *pb.Message, receiverHandle *pb.PeerID) error {
+	node.network.nodes[receiverHandle.Name].inbox <- testMessage{msg: msg, sender: node.id}
+	return nil
+}
+
+func (node *testNode) GetNetworkInfo() (*pb.PeerEndpoint, []*pb.PeerEndpoint, error) {
+	return nil, nil, fmt.Errorf("Not implemented")
+}
+
+func (node *testNode) GetNetworkHandles() (*pb.PeerID, []*pb.PeerID, error) {
+	return node.id, node.network.ids, nil
+}
+
+func testSignature(id *pb.PeerID, msg []byte) []byte {
+	return append([]byte(id.Name+":"), msg...)
+}
+
+func (node *testNode) Sign(msg []byte) ([]byte, error) {
+	return testSignature(node.id, msg), nil
+}
+
+func (node *testNode) Verify(peerID *pb.PeerID, signature []byte, message []byte) error {
+	if !bytes.Equal(signature, testSignature(peerID, message)) {
+		return fmt.Errorf("Invalid signature of %s", peerID.Name)
+	}
+	return nil
+}
+
+func (node *testNode) BeginTxBatch(id interface{}) error {
+	node.Lock()
+	defer node.Unlock()
+	node.executed = nil
+	return nil
+}
+
+func (node *testNode) ExecTxs(id interface{}, txs []*pb.Transaction) ([]byte, error) {
+	node.Lock()
+	defer node.Unlock()
+	node.executed = append(node.executed, txs...)
+	return nil, nil
+}
+
+func (node *testNode) CommitTxBatch(id interface{}, metadata []byte) (*pb.Block, error) {
+	node.Lock()
+	defer node.Unlock()
+	node.blocks = append(node.blocks, node.executed)
+	node.metadata = append(node.metadata, metadata)
+	node.executed = nil
+	return &pb.Block{}, nil
+}
+
+func (node *testNode) RollbackTxBatch(id interface{}) error {
+	node.Lock()
+	defer node.Unlock()
+	node.executed = nil
+	return nil
+}
+
+func (node *testNode) PreviewCommitTxBatch(id interface{}, metadata []byte) ([]byte, error) {
+	return nil, nil
+}
+
+func (node *testNode) GetBlockchainSize() uint64 {
+	node.Lock()
+	defer node.Unlock()
+	return uint64(len(node.blocks))
+}
+
+func submit(t *testing.T, node *testNode, uuid string) {
+	payload, err := proto.Marshal(&pb.Transaction{Uuid: uuid})
+	if err != nil {
+		t.Fatalf("Error marshalling transaction: %s", err)
+	}
+	node.inbox <- testMessage{msg: &pb.Message{Type: pb.Message_CHAIN_TRANSACTION, Payload: payload}, sender: node.id}
+}
+
+func waitForBlocks(t *testing.T, net *testNetwork, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for _, id := range net.ids {
+		for len(net.nodes[id.Name].committedBlocks()) < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s committed %d blocks, expected %d", id.Name, len(net.nodes[id.Name].committedBlocks()), n)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func blockUUIDs(txs []*pb.Transaction) []string {
+	uuids := make([]string, len(txs))
+	for i, tx := range txs {
+		uuids[i] = tx.Uuid
+	}
+	return uuids
+}
+
+func TestQuorum(t *testing.T) {
+	for n, expected := range map[int]int{1: 1, 3: 1, 4: 3, 7: 5} {
+		if q := quorum(n); q != expected {
+			t.Errorf("Expected quorum of %d for %d validators, got %d", expected, n, q)
+		}
+	}
+}
+
+func TestFourPeerClusterCommitsBlocks(t *testing.T) {
+	net := newTestNetwork(4, 2, 50*time.Millisecond)
+	defer net.stop()
+
+	// Round 0 is led by vp0, a full batch is proposed without waiting
+	submit(t, net.nodes["vp2"], "tx1")
+	submit(t, net.nodes["vp3"], "tx2")
+	waitForBlocks(t, net, 1)
+
+	// Round 1 is led by vp1, the single transaction is proposed after the batch timeout
+	submit(t, net.nodes["vp0"], "tx3")
+	waitForBlocks(t, net, 2)
+
+	reference := net.nodes["vp0"].committedBlocks()
+	if len(reference[0]) != 2 || len(reference[1]) != 1 || reference[1][0].Uuid != "tx3" {
+		t.Fatalf("Unexpected blocks committed: %v, %v", blockUUIDs(reference[0]), blockUUIDs(reference[1]))
+	}
+	for _, id := range net.ids {
+		blocks := net.nodes[id.Name].committedBlocks()
+		for i := range reference {
+			if fmt.Sprint(blockUUIDs(blocks[i])) != fmt.Sprint(blockUUIDs(reference[i])) {
+				t.Errorf("%s committed block %d with %v, vp0 with %v", id.Name, i, blockUUIDs(blocks[i]), blockUUIDs(reference[i]))
+			}
+		}
+	}
+}
+
+func TestCommitRequiresQuorum(t *testing.T) {
+	net := newTestNetwork(4, 1, time.Hour)
+	defer net.stop()
+	node := net.nodes["vp3"]
+	a := node.adapter
+
+	block := &pb.Block{Transactions: []*pb.Transaction{{Uuid: "tx1"}}}
+	a.Lock()
+	defer a.Unlock()
+	if err := a.handleProposal(&pb.BlockProposal{Round: 0, Block: block}, &pb.PeerID{Name: "vp1"}); err == nil {
+		t.Error("Expected a proposal from a validator other than the leader to be rejected")
+	}
+	if err := a.handleProposal(&pb.BlockProposal{Round: 0, Block: block}, net.ids[0]); err != nil {
+		t.Fatalf("Error handling proposal: %s", err)
+	}
+
+	var votes []*pb.BlockVote
+	for _, id := range net.ids[:2] {
+		votes = append(votes, &pb.BlockVote{Round: 0, BlockHash: a.blockHash, VoterSig: testSignature(id, peer.BlockVoteBytes(0, a.blockHash)), Voter: id})
+	}
+	if err := a.handleCommit(&pb.BlockCommit{Round: 0, BlockHash: a.blockHash, AggregateSig: votes}, net.ids[0]); err == nil {
+		t.Error("Expected a commit with 2 of 4 votes to be rejected")
+	}
+	forged := &pb.BlockVote{Round: 0, BlockHash: a.blockHash, VoterSig: []byte("forged"), Voter: net.ids[2]}
+	if err := a.handleCommit(&pb.BlockCommit{Round: 0, BlockHash: a.blockHash, AggregateSig: append(votes, forged)}, net.ids[0]); err == nil {
+		t.Error("Expected a commit with a forged vote to be rejected")
+	}
+	if len(node.blocks) != 0 {
+		t.Errorf("Expected nothing to be committed, got %d blocks", len(node.blocks))
+	}
+}
+
+func TestCommittedBlocksCarryVotes(t *testing.T) {
+	net := newTestNetwork(4, 1, time.Hour)
+	defer net.stop()
+	submit(t, net.nodes["vp1"], "tx1")
+	waitForBlocks(t, net, 1)
+
+	for _, id := range net.ids {
+		node := net.nodes[id.Name]
+		node.Lock()
+		metadata := node.metadata[0]
+		node.Unlock()
+		votes := &pb.BlockVotes{}
+		if err := proto.Unmarshal(metadata, votes); err != nil {
+			t.Fatalf("Error unmarshalling the votes committed by %s: %s", id.Name, err)
+		}
+		if votes.Round != 0 || len(votes.Votes) < quorum(len(net.ids)) {
+			t.Fatalf("Expected %s to commit a quorum of votes for round 0, got %d for round %d", id.Name, len(votes.Votes), votes.Round)
+		}
+		for i, vote := range votes.Votes {
+			if i > 0 && votes.Votes[i-1].ValidatorID.Name >= vote.ValidatorID.Name {
+				t.Errorf("Expected the votes committed by %s in validator order, got %s after %s", id.Name, vote.ValidatorID.Name, votes.Votes[i-1].ValidatorID.Name)
+			}
+			if !bytes.Equal(vote.Signature, testSignature(vote.ValidatorID, peer.BlockVoteBytes(0, votes.BlockHash))) {
+				t.Errorf("Invalid signature of %s committed by %s", vote.ValidatorID.Name, id.Name)
+			}
+		}
+	}
+}
+
+// auctionNode is a testNode whose mempool auction selects selected
+type auctionNode struct {
+	*testNode
+	selected []*pb.Transaction
+}
+
+func (node *auctionNode) SelectForBlock(maxGas uint64) []*pb.Transaction {
+	return node.selected
+}
+
+func TestProposalFollowsGasAuction(t *testing.T) {
+	net := newTestNetwork(1, 2, time.Hour)
+	defer net.stop()
+	a := net.nodes["vp0"].adapter
+	a.Lock()
+	defer a.Unlock()
+	a.pending = []*pb.Transaction{{Uuid: "tx1"}, {Uuid: "tx2"}, {Uuid: "tx3"}}
+	node := &auctionNode{testNode: net.nodes["vp0"], selected: []*pb.Transaction{{Uuid: "tx3"}, {Uuid: "other"}, {Uuid: "tx1"}, {Uuid: "tx2"}}}
+	a.stack = node
+
+	if uuids := blockUUIDs(a.selectTransactions()); fmt.Sprint(uuids) != "[tx1 tx2]" {
+		t.Fatalf("Expected the pending transactions in order without a block gas limit, got %v", uuids)
+	}
+	defer viper.Set("peer.tx.blockGasLimit", 0)
+	viper.Set("peer.tx.blockGasLimit", 100)
+	if uuids := blockUUIDs(a.selectTransactions()); fmt.Sprint(uuids) != "[tx3 tx1]" {
+		t.Fatalf("Expected the pending transactions winning the auction, got %v", uuids)
+	}
+	node.selected = []*pb.Transaction{{Uuid: "other"}}
+	if uuids := blockUUIDs(a.selectTransactions()); fmt.Sprint(uuids) != "[tx1 tx2]" {
+		t.Fatalf("Expected the pending transactions in order when none won the auction, got %v", uuids)
+	}
+}
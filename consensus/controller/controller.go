@@ -23,6 +23,7 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/bft"
 	"github.com/hyperledger/fabric/consensus/noops"
 	"github.com/hyperledger/fabric/consensus/pbft"
 )
@@ -42,6 +43,10 @@ func NewConsenter(stack consensus.Stack) consensus.Consenter {
 		logger.Infof("Creating consensus plugin %s", plugin)
 		return pbft.GetPlugin(stack)
 	}
+	if plugin == "bft" {
+		logger.Infof("Creating consensus plugin %s", plugin)
+		return bft.GetPlugin(stack)
+	}
 	logger.Info("Creating default consensus plugin (noops)")
 	return noops.GetNoops(stack)
 
@@ -80,7 +80,8 @@ func NewConsensusHandler(coord peer.MessageHandlerCoordinator,
 
 // HandleMessage handles the incoming Fabric messages for the Peer
 func (handler *ConsensusHandler) HandleMessage(msg *pb.Message) error {
-	if msg.Type == pb.Message_CONSENSUS {
+	switch msg.Type {
+	case pb.Message_CONSENSUS, pb.Message_CHAIN_PROPOSE_BLOCK, pb.Message_CHAIN_VOTE_BLOCK, pb.Message_CHAIN_COMMIT_BLOCK:
 		senderPE, _ := handler.To()
 		select {
 		case handler.consenterChan <- &util.Message{
@@ -228,6 +228,8 @@ func (h *Helper) CommitTxBatch(id interface{}, metadata []byte) (*pb.Block, erro
 	}
 
 	logger.Debugf("Committed block with %d transactions, intended to include %d", len(block.Transactions), len(h.curBatch))
+	h.coordinator.GetBlockEventBus().Publish(size - 1)
+	h.coordinator.GetBlockAnnouncer().Announce(size-1, block)
 
 	return block, nil
 }
@@ -288,6 +290,12 @@ func (h *Helper) GetBlockchainSize() uint64 {
 	return h.coordinator.GetBlockchainSize()
 }
 
+// SelectForBlock returns the transactions of the mempool of the peer winning
+// the gas price auction of a block of up to maxGas
+func (h *Helper) SelectForBlock(maxGas uint64) []*pb.Transaction {
+	return h.coordinator.SelectForBlock(maxGas)
+}
+
 // GetBlockchainInfo gets the ledger's BlockchainInfo
 func (h *Helper) GetBlockchainInfo() *pb.BlockchainInfo {
 	ledger, _ := ledger.GetLedger()
@@ -17,12 +17,16 @@ limitations under the License.
 package core
 
 import (
+	"crypto/subtle"
 	"os"
 	"runtime"
 
 	"github.com/op/go-logging"
 	"github.com/spf13/viper"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 
 	"google/protobuf"
 
@@ -79,3 +83,46 @@ func (*ServerAdmin) StopServer(context.Context, *google_protobuf.Empty) (*pb.Ser
 	defer os.Exit(0)
 	return status, nil
 }
+
+// AdminSecretMetadataKey is the request metadata key carrying the
+// peer.admin.secret to Admin RPCs that require it
+const AdminSecretMetadataKey = "admin-secret"
+
+// checkAdminSecret returns an error unless the request metadata of ctx
+// carries the configured peer.admin.secret. Without a configured secret the
+// protected RPCs are disabled.
+func checkAdminSecret(ctx context.Context) error {
+	secret := viper.GetString("peer.admin.secret")
+	if secret == "" {
+		return grpc.Errorf(codes.PermissionDenied, "Admin RPC disabled, peer.admin.secret is not set")
+	}
+	md, ok := metadata.FromContext(ctx)
+	if !ok || len(md[AdminSecretMetadataKey]) == 0 {
+		return grpc.Errorf(codes.Unauthenticated, "Missing %s", AdminSecretMetadataKey)
+	}
+	if subtle.ConstantTimeCompare([]byte(md[AdminSecretMetadataKey][0]), []byte(secret)) != 1 {
+		return grpc.Errorf(codes.Unauthenticated, "Invalid %s", AdminSecretMetadataKey)
+	}
+	return nil
+}
+
+// SetLogLevel sets the level of the requested loggers. If none are named the
+// default level is set, which applies to the loggers without a level of their own.
+func (*ServerAdmin) SetLogLevel(ctx context.Context, request *pb.LogLevelRequest) (*pb.LogLevelResponse, error) {
+	if err := checkAdminSecret(ctx); err != nil {
+		return nil, err
+	}
+	level, err := logging.LogLevel(request.Level)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "Invalid log level %s", request.Level)
+	}
+	loggers := request.Loggers
+	if len(loggers) == 0 {
+		loggers = []string{""}
+	}
+	for _, module := range loggers {
+		logging.SetLevel(level, module)
+	}
+	log.Infof("Log level of %v set to %s", request.Loggers, level)
+	return &pb.LogLevelResponse{Level: level.String(), Loggers: request.Loggers}, nil
+}
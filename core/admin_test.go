@@ -16,9 +16,56 @@ limitations under the License.
 
 package core
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/op/go-logging"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
 
 func TestServer_Status(t *testing.T) {
 	t.Skip("TBD")
 	//performHandshake(t, peerClientConn)
 }
+
+func TestServer_SetLogLevel(t *testing.T) {
+	viper.Set("peer.admin.secret", "s3cret")
+	defer viper.Set("peer.admin.secret", "")
+	admin := NewAdminServer()
+	request := &pb.LogLevelRequest{Level: "DEBUG", Loggers: []string{"admintest"}}
+	withSecret := func(secret string) context.Context {
+		return metadata.NewContext(context.Background(), metadata.Pairs(AdminSecretMetadataKey, secret))
+	}
+
+	if _, err := admin.SetLogLevel(context.Background(), request); grpc.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated without a secret, got %v", err)
+	}
+	if _, err := admin.SetLogLevel(withSecret("wrong"), request); grpc.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated with a wrong secret, got %v", err)
+	}
+	if _, err := admin.SetLogLevel(withSecret("s3cret"), &pb.LogLevelRequest{Level: "LOUD"}); grpc.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for an unknown level, got %v", err)
+	}
+
+	logging.SetLevel(logging.INFO, "admintest")
+	if _, err := admin.SetLogLevel(withSecret("s3cret"), request); err != nil {
+		t.Fatalf("Error setting log level: %s", err)
+	}
+	if level := logging.GetLevel("admintest"); level != logging.DEBUG {
+		t.Errorf("Expected logger admintest at DEBUG, got %s", level)
+	}
+}
+
+func TestServer_SetLogLevelDisabled(t *testing.T) {
+	viper.Set("peer.admin.secret", "")
+	ctx := metadata.NewContext(context.Background(), metadata.Pairs(AdminSecretMetadataKey, ""))
+	if _, err := NewAdminServer().SetLogLevel(ctx, &pb.LogLevelRequest{Level: "DEBUG"}); grpc.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied without a configured secret, got %v", err)
+	}
+}
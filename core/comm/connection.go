@@ -11,19 +11,25 @@ import (
 	"github.com/spf13/viper"
 )
 
-const defaultTimeout = time.Second * 3
+// DefaultTimeout is how long a connection is dialed for before giving up
+const DefaultTimeout = time.Second * 3
 
 var commLogger = logging.MustGetLogger("comm")
 
 // NewClientConnectionWithAddress Returns a new grpc.ClientConn to the given address.
 func NewClientConnectionWithAddress(peerAddress string, block bool, tslEnabled bool, creds credentials.TransportAuthenticator) (*grpc.ClientConn, error) {
-	var opts []grpc.DialOption
+	return NewClientConnectionWithAddressAndTimeout(peerAddress, block, tslEnabled, creds, DefaultTimeout)
+}
+
+// NewClientConnectionWithAddressAndTimeout Returns a new grpc.ClientConn to the given address, dialed for at most timeout with the extra options.
+func NewClientConnectionWithAddressAndTimeout(peerAddress string, block bool, tslEnabled bool, creds credentials.TransportAuthenticator, timeout time.Duration, extraOpts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts := append([]grpc.DialOption{}, extraOpts...)
 	if tslEnabled {
 		opts = append(opts, grpc.WithTransportCredentials(creds))
 	} else {
 		opts = append(opts, grpc.WithInsecure())
 	}
-	opts = append(opts, grpc.WithTimeout(defaultTimeout))
+	opts = append(opts, grpc.WithTimeout(timeout))
 	if block {
 		opts = append(opts, grpc.WithBlock())
 	}
@@ -40,15 +46,9 @@ func InitTLSForPeer() credentials.TransportAuthenticator {
 	if viper.GetString("peer.tls.serverhostoverride") != "" {
 		sn = viper.GetString("peer.tls.serverhostoverride")
 	}
-	var creds credentials.TransportAuthenticator
-	if viper.GetString("peer.tls.cert.file") != "" {
-		var err error
-		creds, err = credentials.NewClientTLSFromFile(viper.GetString("peer.tls.cert.file"), sn)
-		if err != nil {
-			grpclog.Fatalf("Failed to create TLS credentials %v", err)
-		}
-	} else {
-		creds = credentials.NewClientTLSFromCert(nil, sn)
+	creds, err := newClientTLS(viper.GetString("peer.tls.cert.file"), sn)
+	if err != nil {
+		grpclog.Fatalf("Failed to create TLS credentials %v", err)
 	}
 	return creds
 }
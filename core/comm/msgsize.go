@@ -0,0 +1,87 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package comm
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Bounds of peer.grpc.maxRecvMsgSizeMiB and peer.grpc.maxSendMsgSizeMiB
+const (
+	minMsgSizeMiB = 1
+	maxMsgSizeMiB = 256
+)
+
+// MessageSizeLimits returns the largest messages, in bytes, the gRPC server
+// receives and sends, peer.grpc.maxRecvMsgSizeMiB and
+// peer.grpc.maxSendMsgSizeMiB. Values outside of 1 to 256 MiB are an error.
+func MessageSizeLimits() (maxRecv, maxSend int, err error) {
+	recvMiB := viper.GetInt("peer.grpc.maxRecvMsgSizeMiB")
+	sendMiB := viper.GetInt("peer.grpc.maxSendMsgSizeMiB")
+	for key, value := range map[string]int{"peer.grpc.maxRecvMsgSizeMiB": recvMiB, "peer.grpc.maxSendMsgSizeMiB": sendMiB} {
+		if value < minMsgSizeMiB || value > maxMsgSizeMiB {
+			return 0, 0, fmt.Errorf("%s is %d, it must be between %d and %d", key, value, minMsgSizeMiB, maxMsgSizeMiB)
+		}
+	}
+	return recvMiB << 20, sendMiB << 20, nil
+}
+
+// MaxMsgSize returns a ServerOption failing with ResourceExhausted the calls
+// receiving messages larger than maxRecv bytes or sending messages larger than
+// maxSend bytes. The vendored gRPC has no MaxRecvMsgSize and MaxSendMsgSize
+// server options, so the limits are applied by the codec of the server. The
+// codec is only given a message once gRPC has read all of it, into a buffer
+// of the length announced by the sender: a message over maxRecv is refused
+// rather than processed, but it is received in full first, so the limit does
+// not bound the memory or bandwidth a sender can use.
+func MaxMsgSize(maxRecv, maxSend int) grpc.ServerOption {
+	return grpc.CustomCodec(sizeLimitCodec{maxRecv: maxRecv, maxSend: maxSend})
+}
+
+// sizeLimitCodec is the protobuf codec of gRPC refusing messages over its limits
+type sizeLimitCodec struct {
+	maxRecv, maxSend int
+}
+
+// Marshal refuses messages over maxSend once marshalled
+func (c sizeLimitCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := proto.Marshal(v.(proto.Message))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > c.maxSend {
+		return nil, grpc.Errorf(codes.ResourceExhausted, "Message of %d bytes is larger than the %d bytes sent at most", len(data), c.maxSend)
+	}
+	return data, nil
+}
+
+// Unmarshal refuses data over maxRecv, checked once the message is received
+func (c sizeLimitCodec) Unmarshal(data []byte, v interface{}) error {
+	if len(data) > c.maxRecv {
+		return grpc.Errorf(codes.ResourceExhausted, "Message of %d bytes is larger than the %d bytes received at most", len(data), c.maxRecv)
+	}
+	return proto.Unmarshal(data, v.(proto.Message))
+}
+
+func (sizeLimitCodec) String() string {
+	return "proto"
+}
@@ -0,0 +1,70 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package comm
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestMessageSizeLimits(t *testing.T) {
+	defer viper.Set("peer.grpc.maxRecvMsgSizeMiB", viper.Get("peer.grpc.maxRecvMsgSizeMiB"))
+	defer viper.Set("peer.grpc.maxSendMsgSizeMiB", viper.Get("peer.grpc.maxSendMsgSizeMiB"))
+	viper.Set("peer.grpc.maxRecvMsgSizeMiB", 16)
+	viper.Set("peer.grpc.maxSendMsgSizeMiB", 256)
+	maxRecv, maxSend, err := MessageSizeLimits()
+	if err != nil {
+		t.Fatalf("Error getting message size limits: %s", err)
+	}
+	if maxRecv != 16<<20 || maxSend != 256<<20 {
+		t.Errorf("Unexpected limits %d and %d", maxRecv, maxSend)
+	}
+	for _, invalid := range []int{0, 257} {
+		viper.Set("peer.grpc.maxSendMsgSizeMiB", invalid)
+		if _, _, err := MessageSizeLimits(); err == nil {
+			t.Errorf("Expected an error for a limit of %d MiB", invalid)
+		}
+	}
+}
+
+func TestSizeLimitCodec(t *testing.T) {
+	codec := sizeLimitCodec{maxRecv: 100, maxSend: 100}
+	small := &pb.Message{Payload: []byte("small")}
+	large := &pb.Message{Payload: bytes.Repeat([]byte{1}, 200)}
+
+	data, err := codec.Marshal(small)
+	if err != nil {
+		t.Fatalf("Error marshalling a small message: %s", err)
+	}
+	received := &pb.Message{}
+	if err := codec.Unmarshal(data, received); err != nil || string(received.Payload) != "small" {
+		t.Fatalf("Expected the small message back, got %v, %v", received, err)
+	}
+	if _, err := codec.Marshal(large); grpc.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected ResourceExhausted sending a large message, got %v", err)
+	}
+	data, _ = sizeLimitCodec{maxRecv: 1000, maxSend: 1000}.Marshal(large)
+	if err := codec.Unmarshal(data, &pb.Message{}); grpc.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected ResourceExhausted receiving a large message, got %v", err)
+	}
+}
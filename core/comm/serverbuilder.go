@@ -0,0 +1,186 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package comm
+
+import (
+	"fmt"
+	"reflect"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// The vendored gRPC predates server interceptors, so the types below mirror
+// those of later gRPC releases and ServerBuilder applies the interceptors by
+// wrapping the handlers of the services registered through it.
+
+// UnaryServerInfo describes the unary call being intercepted
+type UnaryServerInfo struct {
+	Server     interface{}
+	FullMethod string
+}
+
+// UnaryHandler calls the unary method, or the next interceptor of the chain
+type UnaryHandler func(ctx context.Context, req interface{}) (interface{}, error)
+
+// UnaryServerInterceptor intercepts the unary calls of a server, handler
+// being the rest of the chain up to the method called
+type UnaryServerInterceptor func(ctx context.Context, req interface{}, info *UnaryServerInfo, handler UnaryHandler) (interface{}, error)
+
+// StreamServerInfo describes the streaming call being intercepted
+type StreamServerInfo struct {
+	FullMethod     string
+	IsClientStream bool
+	IsServerStream bool
+}
+
+// StreamHandler calls the streaming method, or the next interceptor of the chain
+type StreamHandler func(srv interface{}, stream grpc.ServerStream) error
+
+// StreamServerInterceptor intercepts the streaming calls of a server, which
+// it may wrap stream for, handler being the rest of the chain up to the
+// method called
+type StreamServerInterceptor func(srv interface{}, stream grpc.ServerStream, info *StreamServerInfo, handler StreamHandler) error
+
+// ChainUnaryInterceptor returns the interceptor calling interceptors in
+// order, the first one being the outermost
+func ChainUnaryInterceptor(interceptors ...UnaryServerInterceptor) UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *UnaryServerInfo, handler UnaryHandler) (interface{}, error) {
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], handler
+			handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// ChainStreamInterceptor returns the interceptor calling interceptors in
+// order, the first one being the outermost
+func ChainStreamInterceptor(interceptors ...StreamServerInterceptor) StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *StreamServerInfo, handler StreamHandler) error {
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], handler
+			handler = func(srv interface{}, stream grpc.ServerStream) error {
+				return interceptor(srv, stream, info, next)
+			}
+		}
+		return handler(srv, stream)
+	}
+}
+
+// registeredService is a service registered through a ServerBuilder
+type registeredService struct {
+	desc *grpc.ServiceDesc
+	impl interface{}
+}
+
+// ServerBuilder builds a gRPC server calling the services registered through
+// it through the interceptors added with WithUnaryInterceptor and
+// WithStreamInterceptor, in the order they were added, for auth, metrics or
+// tracing to be added to the server independently of each other.
+type ServerBuilder struct {
+	opts     []grpc.ServerOption
+	unary    []UnaryServerInterceptor
+	stream   []StreamServerInterceptor
+	services []registeredService
+}
+
+// NewServerBuilder returns a builder of a server created with opts
+func NewServerBuilder(opts ...grpc.ServerOption) *ServerBuilder {
+	return &ServerBuilder{opts: opts}
+}
+
+// WithUnaryInterceptor adds interceptor after those added before
+func (b *ServerBuilder) WithUnaryInterceptor(interceptor UnaryServerInterceptor) *ServerBuilder {
+	b.unary = append(b.unary, interceptor)
+	return b
+}
+
+// WithStreamInterceptor adds interceptor after those added before
+func (b *ServerBuilder) WithStreamInterceptor(interceptor StreamServerInterceptor) *ServerBuilder {
+	b.stream = append(b.stream, interceptor)
+	return b
+}
+
+// RegisterService registers impl as the implementation of the service
+// described by desc, e.g. protos.PeerServiceDesc, with the server built.
+// Services registered on the server directly are not intercepted.
+func (b *ServerBuilder) RegisterService(desc *grpc.ServiceDesc, impl interface{}) {
+	b.services = append(b.services, registeredService{desc: desc, impl: impl})
+}
+
+// Build returns the server with the registered services
+func (b *ServerBuilder) Build() *grpc.Server {
+	server := grpc.NewServer(b.opts...)
+	for _, service := range b.services {
+		server.RegisterService(interceptedServiceDesc(service.desc, service.impl, b.unary, b.stream), service.impl)
+	}
+	return server
+}
+
+// interceptedServiceDesc returns a copy of desc whose handlers call the
+// methods of impl through the interceptors
+func interceptedServiceDesc(desc *grpc.ServiceDesc, impl interface{}, unary []UnaryServerInterceptor, stream []StreamServerInterceptor) *grpc.ServiceDesc {
+	intercepted := *desc
+	if len(unary) > 0 {
+		intercepted.Methods = make([]grpc.MethodDesc, len(desc.Methods))
+		for i, method := range desc.Methods {
+			intercepted.Methods[i] = method
+			intercepted.Methods[i].Handler = interceptedMethodHandler(desc.ServiceName, method.MethodName, impl, ChainUnaryInterceptor(unary...))
+		}
+	}
+	if len(stream) > 0 {
+		intercepted.Streams = make([]grpc.StreamDesc, len(desc.Streams))
+		for i, streamDesc := range desc.Streams {
+			intercepted.Streams[i] = streamDesc
+			info := &StreamServerInfo{
+				FullMethod:     fmt.Sprintf("/%s/%s", desc.ServiceName, streamDesc.StreamName),
+				IsClientStream: streamDesc.ClientStreams,
+				IsServerStream: streamDesc.ServerStreams,
+			}
+			handler, interceptor := StreamHandler(streamDesc.Handler), ChainStreamInterceptor(stream...)
+			intercepted.Streams[i].Handler = func(srv interface{}, stream grpc.ServerStream) error {
+				return interceptor(srv, stream, info, handler)
+			}
+		}
+	}
+	return &intercepted
+}
+
+// interceptedMethodHandler returns the handler of the unary method of impl
+// calling it through interceptor. The generated handlers decode the request
+// and call the method at once, so the method is called by reflection on the
+// request decoded beforehand, as in the generated code.
+func interceptedMethodHandler(serviceName, methodName string, impl interface{}, interceptor UnaryServerInterceptor) func(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	info := &UnaryServerInfo{Server: impl, FullMethod: fmt.Sprintf("/%s/%s", serviceName, methodName)}
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+		method := reflect.ValueOf(srv).MethodByName(methodName)
+		req := reflect.New(method.Type().In(1).Elem()).Interface()
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			out := method.Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(req)})
+			if err, _ := out[1].Interface().(error); err != nil {
+				return nil, err
+			}
+			return out[0].Interface(), nil
+		})
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package comm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+type reasonKey struct{}
+
+type testHealthServer struct{}
+
+func (testHealthServer) Check(ctx context.Context, req *pb.HealthCheckRequest) (*pb.HealthCheckResponse, error) {
+	reason, _ := ctx.Value(reasonKey{}).(string)
+	return &pb.HealthCheckResponse{Reason: reason}, nil
+}
+
+type testPeerServer struct{ calls *[]string }
+
+func (s testPeerServer) Chat(stream pb.Peer_ChatServer) error {
+	*s.calls = append(*s.calls, "Chat")
+	return nil
+}
+
+func (s testPeerServer) ProcessTransaction(ctx context.Context, tx *pb.Transaction) (*pb.Response, error) {
+	return nil, errors.New("not implemented")
+}
+
+func recordingUnaryInterceptor(name string, calls *[]string) UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *UnaryServerInfo, handler UnaryHandler) (interface{}, error) {
+		*calls = append(*calls, name+" "+info.FullMethod)
+		return handler(context.WithValue(ctx, reasonKey{}, name), req)
+	}
+}
+
+func TestServerBuilderUnaryInterceptors(t *testing.T) {
+	var calls []string
+	builder := NewServerBuilder().
+		WithUnaryInterceptor(recordingUnaryInterceptor("first", &calls)).
+		WithUnaryInterceptor(recordingUnaryInterceptor("second", &calls))
+	desc := interceptedServiceDesc(pb.HealthServiceDesc, testHealthServer{}, builder.unary, builder.stream)
+	resp, err := desc.Methods[0].Handler(testHealthServer{}, context.Background(), func(req interface{}) error {
+		if _, ok := req.(*pb.HealthCheckRequest); !ok {
+			return fmt.Errorf("Unexpected request %T", req)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error calling the intercepted method: %s", err)
+	}
+	if fmt.Sprint(calls) != "[first /protos.Health/Check second /protos.Health/Check]" {
+		t.Errorf("Expected the interceptors to be called in order, got %v", calls)
+	}
+	// The context of the last interceptor reaches the method
+	if reason := resp.(*pb.HealthCheckResponse).Reason; reason != "second" {
+		t.Errorf("Expected the method to get the context of the interceptors, got %q", reason)
+	}
+	if len(pb.HealthServiceDesc.Methods) != 1 || &pb.HealthServiceDesc.Methods[0] == &desc.Methods[0] {
+		t.Error("Expected the service description to be copied")
+	}
+}
+
+func TestServerBuilderStreamInterceptors(t *testing.T) {
+	var calls []string
+	refuse := errors.New("refused")
+	builder := NewServerBuilder().
+		WithStreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *StreamServerInfo, handler StreamHandler) error {
+			calls = append(calls, info.FullMethod)
+			return handler(srv, stream)
+		}).
+		WithStreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *StreamServerInfo, handler StreamHandler) error {
+			if !info.IsClientStream || !info.IsServerStream {
+				return refuse
+			}
+			return handler(srv, stream)
+		})
+	server := testPeerServer{calls: &calls}
+	desc := interceptedServiceDesc(pb.PeerServiceDesc, server, builder.unary, builder.stream)
+	if err := desc.Streams[0].Handler(server, nil); err != nil {
+		t.Fatalf("Error calling the intercepted stream: %s", err)
+	}
+	if fmt.Sprint(calls) != "[/protos.Peer/Chat Chat]" {
+		t.Errorf("Expected the interceptor to be called before the method, got %v", calls)
+	}
+	// Without unary interceptors the methods are left as they are
+	if _, err := desc.Methods[0].Handler(server, context.Background(), func(interface{}) error { return nil }); err == nil || err.Error() != "not implemented" {
+		t.Errorf("Expected the error of the method, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package comm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/credentials"
+)
+
+// cipherSuites maps the names of the crypto/tls cipher suite constants to
+// their values, the broken RC4 and 3DES suites left out
+var cipherSuites = map[string]uint16{
+	"TLS_RSA_WITH_AES_128_CBC_SHA":            tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_RSA_WITH_AES_256_CBC_SHA":            tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_GCM_SHA256":         tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_RSA_WITH_AES_256_GCM_SHA384":         tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":   tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384": tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+}
+
+// ParseCipherSuites returns the values of the named crypto/tls cipher suites,
+// nil if names is empty. An unknown name, RC4 and 3DES suites among them, is
+// an error.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	suites := make([]uint16, len(names))
+	for i, name := range names {
+		suite, ok := cipherSuites[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown or insecure TLS cipher suite %s", name)
+		}
+		suites[i] = suite
+	}
+	return suites, nil
+}
+
+// getCipherSuites returns the peer.tls.cipherSuites, nil to leave the choice to crypto/tls
+func getCipherSuites() ([]uint16, error) {
+	return ParseCipherSuites(viper.GetStringSlice("peer.tls.cipherSuites"))
+}
+
+// maxTLSVersion returns TLS 1.2 if suites restricts the cipher suites, 0 for
+// the default of crypto/tls otherwise. The cipher suites of TLS 1.3 cannot be
+// configured, so the restriction would not apply to TLS 1.3 connections.
+func maxTLSVersion(suites []uint16) uint16 {
+	if suites == nil {
+		return 0
+	}
+	return tls.VersionTLS12
+}
+
+// NewServerTLSFromFile returns server TLS credentials from the certificate and
+// key files, restricted to the peer.tls.cipherSuites and then to TLS 1.2
+func NewServerTLSFromFile(certFile, keyFile string) (credentials.TransportAuthenticator, error) {
+	suites, err := getCipherSuites()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}, CipherSuites: suites, MaxVersion: maxTLSVersion(suites)}), nil
+}
+
+// newClientTLS returns client TLS credentials trusting the certificates of
+// the certFile, or the system roots if empty, restricted to the
+// peer.tls.cipherSuites and then to TLS 1.2
+func newClientTLS(certFile, serverName string) (credentials.TransportAuthenticator, error) {
+	suites, err := getCipherSuites()
+	if err != nil {
+		return nil, err
+	}
+	var roots *x509.CertPool
+	if certFile != "" {
+		b, err := ioutil.ReadFile(certFile)
+		if err != nil {
+			return nil, err
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("Failed to append certificates from %s", certFile)
+		}
+	}
+	return credentials.NewTLS(&tls.Config{ServerName: serverName, RootCAs: roots, CipherSuites: suites, MaxVersion: maxTLSVersion(suites)}), nil
+}
@@ -0,0 +1,52 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package comm
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestParseCipherSuites(t *testing.T) {
+	suites, err := ParseCipherSuites([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_RSA_WITH_AES_256_CBC_SHA"})
+	if err != nil {
+		t.Fatalf("Error parsing cipher suites: %s", err)
+	}
+	if len(suites) != 2 || suites[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 || suites[1] != tls.TLS_RSA_WITH_AES_256_CBC_SHA {
+		t.Errorf("Unexpected cipher suites %v", suites)
+	}
+	if _, err := ParseCipherSuites([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_NOT_A_SUITE"}); err == nil {
+		t.Error("Expected an error for an unknown cipher suite")
+	}
+	for _, insecure := range []string{"TLS_RSA_WITH_RC4_128_SHA", "TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA"} {
+		if _, err := ParseCipherSuites([]string{insecure}); err == nil {
+			t.Errorf("Expected an error for the insecure cipher suite %s", insecure)
+		}
+	}
+	if suites, err := ParseCipherSuites(nil); err != nil || suites != nil {
+		t.Errorf("Expected no cipher suites when none are configured, got %v, %v", suites, err)
+	}
+}
+
+func TestMaxTLSVersion(t *testing.T) {
+	if version := maxTLSVersion(nil); version != 0 {
+		t.Errorf("Expected no maximum TLS version without cipher suites, got %x", version)
+	}
+	if version := maxTLSVersion([]uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}); version != tls.VersionTLS12 {
+		t.Errorf("Expected configured cipher suites to limit TLS to 1.2, got %x", version)
+	}
+}
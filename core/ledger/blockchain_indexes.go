@@ -17,7 +17,11 @@ limitations under the License.
 package ledger
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"math"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric/core/db"
@@ -30,6 +34,7 @@ var indexLogger = logging.MustGetLogger("indexes")
 var prefixBlockHashKey = byte(1)
 var prefixTxUUIDKey = byte(2)
 var prefixAddressBlockNumCompositeKey = byte(3)
+var prefixAccountTimestampKey = byte(4)
 
 type blockchainIndexer interface {
 	isSynchronous() bool
@@ -95,6 +100,11 @@ func addIndexDataForPersistence(block *protos.Block, blockNumber uint64, blockHa
 		// add TxUUID -> (blockNumber,indexWithinBlock)
 		writeBatch.PutCF(cf, encodeTxUUIDKey(tx.Uuid), encodeBlockNumTxIndex(blockNumber, uint64(txIndex)))
 
+		// add (accountID,timestamp,blockNumber,indexWithinBlock) -> (blockNumber,indexWithinBlock)
+		if accountID := TransactionAccountID(tx); accountID != "" {
+			writeBatch.PutCF(cf, encodeAccountTimestampKey(accountID, txTimestamp(tx), blockNumber, uint64(txIndex)), encodeBlockNumTxIndex(blockNumber, uint64(txIndex)))
+		}
+
 		txExecutingAddress := getTxExecutingAddress(tx)
 		addressToTxIndexesMap[txExecutingAddress] = append(addressToTxIndexesMap[txExecutingAddress], uint64(txIndex))
 
@@ -137,6 +147,64 @@ func fetchTransactionIndexByUUIDFromDB(txUUID string) (uint64, uint64, error) {
 	return decodeBlockNumTxIndex(blockNumTxIndexBytes)
 }
 
+// fetchAccountTransactionIndexesFromDB returns the block numbers and indexes
+// within their blocks of up to maxResults transactions of the account with a
+// timestamp from fromTime to toTime included, in timestamp order, and the
+// number of them in all. The transactions up to the one indexed under key
+// after are skipped if it is set. maxResults 0 returns all of them.
+func fetchAccountTransactionIndexesFromDB(accountID string, fromTime, toTime int64, after []byte, maxResults uint32) ([][2]uint64, uint32, error) {
+	openchainDB := db.GetDBHandle()
+	itr := openchainDB.GetIterator(openchainDB.IndexesCF)
+	defer itr.Close()
+	prefix := encodeAccountPrefix(accountID)
+	start := encodeAccountTimestampKey(accountID, fromTime, 0, 0)
+	if after != nil && string(after) > string(start) {
+		start = after
+	}
+	var indexes [][2]uint64
+	var total uint32
+	for itr.Seek(start); itr.ValidForPrefix(prefix); itr.Next() {
+		key := itr.Key().Data()
+		if after != nil && string(key) == string(after) {
+			continue
+		}
+		if decodeAccountTimestamp(key[len(prefix):]) > toTime {
+			break
+		}
+		total++
+		if maxResults > 0 && uint32(len(indexes)) == maxResults {
+			continue
+		}
+		blockNumber, txIndex, err := decodeBlockNumTxIndex(itr.Value().Data())
+		if err != nil {
+			return nil, 0, err
+		}
+		indexes = append(indexes, [2]uint64{blockNumber, txIndex})
+	}
+	if err := itr.Err(); err != nil {
+		return nil, 0, err
+	}
+	return indexes, total, nil
+}
+
+// TransactionAccountID returns the ID of the account of the transaction, the
+// hex SHA-256 of the certificate it was signed with, empty if unsigned
+func TransactionAccountID(tx *protos.Transaction) string {
+	if len(tx.Cert) == 0 {
+		return ""
+	}
+	hash := sha256.Sum256(tx.Cert)
+	return hex.EncodeToString(hash[:])
+}
+
+// txTimestamp returns the timestamp of the transaction in Unix nanoseconds, 0 if it has none
+func txTimestamp(tx *protos.Transaction) int64 {
+	if tx.Timestamp == nil {
+		return 0
+	}
+	return tx.Timestamp.Seconds*int64(1e9) + int64(tx.Timestamp.Nanos)
+}
+
 func getTxExecutingAddress(tx *protos.Transaction) string {
 	// TODO Fetch address form tx
 	return "address1"
@@ -203,6 +271,33 @@ func encodeAddressBlockNumCompositeKey(address string, blockNumber uint64) []byt
 	return b.Bytes()
 }
 
+// encodeAccountPrefix returns the prefix of the AccountTimestampKeys of the account
+func encodeAccountPrefix(accountID string) []byte {
+	b := proto.NewBuffer([]byte{prefixAccountTimestampKey})
+	b.EncodeRawBytes([]byte(accountID))
+	return b.Bytes()
+}
+
+// encodeAccountTimestampKey returns the key the transaction of the account is
+// indexed under, ordered by timestamp then position on the chain. The
+// timestamp is offset by 2^63 for negative ones to be ordered first.
+func encodeAccountTimestampKey(accountID string, timestamp int64, blockNumber uint64, txIndex uint64) []byte {
+	key := encodeAccountPrefix(accountID)
+	suffix := make([]byte, 24)
+	binary.BigEndian.PutUint64(suffix, uint64(timestamp)^(1<<63))
+	binary.BigEndian.PutUint64(suffix[8:], blockNumber)
+	binary.BigEndian.PutUint64(suffix[16:], txIndex)
+	return append(key, suffix...)
+}
+
+// decodeAccountTimestamp returns the timestamp of an AccountTimestampKey without its prefix
+func decodeAccountTimestamp(suffix []byte) int64 {
+	if len(suffix) < 8 {
+		return math.MaxInt64
+	}
+	return int64(binary.BigEndian.Uint64(suffix) ^ (1 << 63))
+}
+
 func encodeListTxIndexes(listTx []uint64) []byte {
 	b := proto.NewBuffer([]byte{})
 	for i := range listTx {
@@ -19,6 +19,7 @@ package ledger
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"reflect"
 	"sync"
 
@@ -373,6 +374,21 @@ func (ledger *Ledger) GetBlockByNumber(blockNumber uint64) (*protos.Block, error
 	return ledger.blockchain.getBlock(blockNumber)
 }
 
+// GetBlockByHash returns the block hashing to blockHash and its number on the
+// blockchain. An Error of type ErrorTypeBlockNotFound is returned if no block
+// is indexed with blockHash.
+func (ledger *Ledger) GetBlockByHash(blockHash []byte) (*protos.Block, uint64, error) {
+	blockNumber, err := ledger.blockchain.indexer.fetchBlockNumberByBlockHash(blockHash)
+	if err != nil {
+		return nil, 0, err
+	}
+	block, err := ledger.blockchain.getBlock(blockNumber)
+	if err != nil {
+		return nil, 0, err
+	}
+	return block, blockNumber, nil
+}
+
 // GetBlockchainSize returns number of blocks in blockchain
 func (ledger *Ledger) GetBlockchainSize() uint64 {
 	return ledger.blockchain.getSize()
@@ -383,6 +399,74 @@ func (ledger *Ledger) GetTransactionByUUID(txUUID string) (*protos.Transaction,
 	return ledger.blockchain.getTransactionByUUID(txUUID)
 }
 
+// GetTransactionIndexByUUID returns the number of the block containing the
+// transaction and the index of the transaction within that block
+func (ledger *Ledger) GetTransactionIndexByUUID(txUUID string) (blockNumber uint64, txIndex uint64, err error) {
+	return ledger.blockchain.indexer.fetchTransactionIndexByUUID(txUUID)
+}
+
+// GetTransactionHistory returns up to maxResults committed transactions of
+// the account with a timestamp, in Unix nanoseconds, from fromTime to toTime
+// included, oldest first, and the number of them in all. A toTime of 0 sets
+// no upper bound. With cursorTxID set, the transactions up to that one of the
+// account are skipped, for the next page of a previous query. maxResults 0
+// returns all of them. The account of a transaction is the hex SHA-256 of its
+// cert, see TransactionAccountID.
+func (ledger *Ledger) GetTransactionHistory(accountID string, fromTime, toTime int64, cursorTxID string, maxResults uint32) ([]*protos.Transaction, uint32, error) {
+	if toTime == 0 {
+		toTime = math.MaxInt64
+	}
+	var after []byte
+	if cursorTxID != "" {
+		blockNumber, txIndex, err := ledger.blockchain.indexer.fetchTransactionIndexByUUID(cursorTxID)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Error getting cursor transaction %s: %s", cursorTxID, err)
+		}
+		tx, err := ledger.blockchain.getTransaction(blockNumber, txIndex)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Error getting cursor transaction %s: %s", cursorTxID, err)
+		}
+		if TransactionAccountID(tx) != accountID {
+			return nil, 0, fmt.Errorf("Cursor transaction %s is not of account %s", cursorTxID, accountID)
+		}
+		after = encodeAccountTimestampKey(accountID, txTimestamp(tx), blockNumber, txIndex)
+	}
+	indexes, total, err := fetchAccountTransactionIndexesFromDB(accountID, fromTime, toTime, after, maxResults)
+	if err != nil {
+		return nil, 0, err
+	}
+	transactions := make([]*protos.Transaction, 0, len(indexes))
+	for _, index := range indexes {
+		tx, err := ledger.blockchain.getTransaction(index[0], index[1])
+		if err != nil {
+			return nil, 0, err
+		}
+		transactions = append(transactions, tx)
+	}
+	return transactions, total, nil
+}
+
+// GetLastAccountTransaction returns the last committed transaction of the
+// account, the latest one in chain order whatever its timestamp, and the
+// number of committed transactions of the account, nil and 0 if it has none.
+func (ledger *Ledger) GetLastAccountTransaction(accountID string) (*protos.Transaction, uint32, error) {
+	indexes, total, err := fetchAccountTransactionIndexesFromDB(accountID, 0, math.MaxInt64, nil, 0)
+	if err != nil || total == 0 {
+		return nil, 0, err
+	}
+	last := indexes[0]
+	for _, index := range indexes[1:] {
+		if index[0] > last[0] || index[0] == last[0] && index[1] > last[1] {
+			last = index
+		}
+	}
+	tx, err := ledger.blockchain.getTransaction(last[0], last[1])
+	if err != nil {
+		return nil, 0, err
+	}
+	return tx, total, nil
+}
+
 // PutRawBlock puts a raw block on the chain. This function should only be
 // used for synchronization between peers.
 func (ledger *Ledger) PutRawBlock(block *protos.Block, blockNumber uint64) error {
@@ -704,6 +704,105 @@ func TestGetTransactionByUUID(t *testing.T) {
 	ledgerTransaction, err = ledger.GetTransactionByUUID("InvalidUUID")
 	testutil.AssertEquals(t, err, ErrResourceNotFound)
 	testutil.AssertNil(t, ledgerTransaction)
+
+	blockNumber, txIndex, err := ledger.GetTransactionIndexByUUID(uuid)
+	testutil.AssertNoError(t, err, "Error fetching transaction index by UUID.")
+	testutil.AssertEquals(t, blockNumber, uint64(0))
+	testutil.AssertEquals(t, txIndex, uint64(0))
+
+	_, _, err = ledger.GetTransactionIndexByUUID("InvalidUUID")
+	testutil.AssertEquals(t, err, ErrResourceNotFound)
+}
+
+func TestGetTransactionHistory(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	signed := func(cert string, seconds int64) *protos.Transaction {
+		tx, _ := buildTestTx(t)
+		tx.Cert = []byte(cert)
+		tx.Timestamp.Seconds, tx.Timestamp.Nanos = seconds, 0
+		return tx
+	}
+	// Transactions of alice out of timestamp order across blocks, among those of bob and unsigned ones
+	blocks := [][]*protos.Transaction{
+		{signed("alice", 30), signed("bob", 10)},
+		{signed("alice", 10), signed("alice", 20)},
+		{signed("alice", 40)},
+	}
+	unsigned, _ := buildTestTx(t)
+	blocks[2] = append(blocks[2], unsigned)
+	for i, transactions := range blocks {
+		ledger.BeginTxBatch(i)
+		ledger.TxBegin("txUuid" + strconv.Itoa(i))
+		ledger.SetState("chaincode1", "key1", []byte("value"+strconv.Itoa(i)))
+		ledger.TxFinished("txUuid"+strconv.Itoa(i), true)
+		testutil.AssertNoError(t, ledger.CommitTxBatch(i, transactions, nil, []byte("proof")), "Error committing block")
+	}
+	alice := TransactionAccountID(blocks[0][0])
+	second := int64(1e9)
+
+	transactions, total, err := ledger.GetTransactionHistory(alice, 10*second, 30*second, "", 0)
+	testutil.AssertNoError(t, err, "Error getting transaction history")
+	testutil.AssertEquals(t, total, uint32(3))
+	testutil.AssertEquals(t, transactions, []*protos.Transaction{blocks[1][0], blocks[1][1], blocks[0][0]})
+
+	// Paging from the last transaction of the previous page
+	transactions, total, err = ledger.GetTransactionHistory(alice, 0, 0, "", 2)
+	testutil.AssertNoError(t, err, "Error getting transaction history")
+	testutil.AssertEquals(t, total, uint32(4))
+	testutil.AssertEquals(t, transactions, []*protos.Transaction{blocks[1][0], blocks[1][1]})
+	transactions, total, err = ledger.GetTransactionHistory(alice, 0, 0, transactions[1].Uuid, 2)
+	testutil.AssertNoError(t, err, "Error getting transaction history")
+	testutil.AssertEquals(t, total, uint32(2))
+	testutil.AssertEquals(t, transactions, []*protos.Transaction{blocks[0][0], blocks[2][0]})
+
+	_, _, err = ledger.GetTransactionHistory(alice, 0, 0, blocks[0][1].Uuid, 2)
+	testutil.AssertError(t, err, "Expected an error with a cursor of another account")
+	transactions, total, err = ledger.GetTransactionHistory(alice, 50*second, 0, "", 0)
+	testutil.AssertNoError(t, err, "Error getting transaction history")
+	testutil.AssertEquals(t, total, uint32(0))
+	testutil.AssertEquals(t, len(transactions), 0)
+
+	last, total, err := ledger.GetLastAccountTransaction(alice)
+	testutil.AssertNoError(t, err, "Error getting the last transaction")
+	testutil.AssertEquals(t, total, uint32(4))
+	testutil.AssertEquals(t, last, blocks[2][0])
+	last, total, err = ledger.GetLastAccountTransaction(TransactionAccountID(blocks[0][1]))
+	testutil.AssertNoError(t, err, "Error getting the last transaction")
+	testutil.AssertEquals(t, total, uint32(1))
+	testutil.AssertEquals(t, last, blocks[0][1])
+	last, total, err = ledger.GetLastAccountTransaction("carol")
+	testutil.AssertNoError(t, err, "Error getting the last transaction")
+	testutil.AssertEquals(t, total, uint32(0))
+	testutil.AssertNil(t, last)
+}
+
+func TestGetBlockByHash(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+
+	for i := 0; i < 2; i++ {
+		ledger.BeginTxBatch(i)
+		ledger.TxBegin("txUuid1")
+		ledger.SetState("chaincode1", "key1", []byte{byte(i)})
+		ledger.TxFinished("txUuid1", true)
+		transaction, _ := buildTestTx(t)
+		ledger.CommitTxBatch(i, []*protos.Transaction{transaction}, nil, []byte("proof"))
+	}
+
+	block := ledgerTestWrapper.GetBlockByNumber(1)
+	blockHash, err := block.GetHash()
+	testutil.AssertNoError(t, err, "Error hashing block.")
+	ledgerBlock, blockNumber, err := ledger.GetBlockByHash(blockHash)
+	testutil.AssertNoError(t, err, "Error fetching block by hash.")
+	testutil.AssertEquals(t, blockNumber, uint64(1))
+	testutil.AssertEquals(t, ledgerBlock, block)
+
+	_, _, err = ledger.GetBlockByHash([]byte("InvalidHash"))
+	ledgerErr, ok := err.(*Error)
+	if !ok || ledgerErr.Type() != ErrorTypeBlockNotFound {
+		t.Fatalf("Expected an ErrorTypeBlockNotFound error, got %v", err)
+	}
 }
 
 func TestRangeScanIterator(t *testing.T) {
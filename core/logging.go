@@ -39,14 +39,20 @@ var loggingDefaultLevel = logging.INFO
 // module)`.  To debug this routine include logging=debug as the first
 // term of the logging specification.
 func LoggingInit(command string) {
-	// Parse the logging specification in the form
-	//     [<module>[,<module>...]=]<level>[:[<module>[,<module>...]=]<level>...]
-	defaultLevel := loggingDefaultLevel
-	var err error
 	spec := viper.GetString("logging_level")
 	if spec == "" {
 		spec = viper.GetString("logging." + command)
 	}
+	LoggingInitSpec(spec)
+}
+
+// LoggingInitSpec applies the logging specification spec, as LoggingInit does
+// with the one it reads from the configuration.
+func LoggingInitSpec(spec string) {
+	// Parse the logging specification in the form
+	//     [<module>[,<module>...]=]<level>[:[<module>[,<module>...]=]<level>...]
+	defaultLevel := loggingDefaultLevel
+	var err error
 	if spec != "" {
 		fields := strings.Split(spec, ":")
 		for _, field := range fields {
@@ -79,7 +85,7 @@ func LoggingInit(command string) {
 	}
 	// Set the default logging level for all modules
 	logging.SetLevel(defaultLevel, "")
-	loggingLogger.Debugf("Setting default logging level to %s for command '%s'", defaultLevel, command)
+	loggingLogger.Debugf("Setting default logging level to %s", defaultLevel)
 }
 
 // DefaultLoggingLevel returns the fallback value for loggers to use if parsing fails
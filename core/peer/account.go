@@ -0,0 +1,143 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// accountQueryTimeout bounds every FetchAccountState
+const accountQueryTimeout = 5 * time.Second
+
+// AccountLedger holds the balances of the accounts, kept by the chaincode
+// managing them
+type AccountLedger interface {
+	// GetBalance returns the balance of the account and whether it holds one
+	GetBalance(accountID string) (balance uint64, exists bool, err error)
+}
+
+// SetAccountLedger sets the AccountLedger the balances answering
+// CHAIN_QUERY_ACCOUNT messages are read from. nil, the default, answers them
+// with a balance of 0, the accounts then only known by their transactions.
+func (p *PeerImpl) SetAccountLedger(accounts AccountLedger) {
+	p.optionsMutex.Lock()
+	defer p.optionsMutex.Unlock()
+	p.accounts = accounts
+}
+
+// GetAccount returns the state of the account, nil if it has neither a
+// committed transaction nor a balance in the AccountLedger of the peer
+func (p *PeerImpl) GetAccount(accountID string) (*pb.AccountState, error) {
+	if accountID == "" {
+		return nil, fmt.Errorf("No account ID given")
+	}
+	p.ledgerWrapper.RLock()
+	last, nonce, err := p.ledgerWrapper.ledger.GetLastAccountTransaction(accountID)
+	p.ledgerWrapper.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting the transactions of account %s: %s", accountID, err)
+	}
+	p.optionsMutex.RLock()
+	accounts := p.accounts
+	p.optionsMutex.RUnlock()
+	return newAccountState(accountID, last, nonce, accounts)
+}
+
+// newAccountState returns the state of the account whose last of nonce
+// committed transactions is last, with its balance in accounts if set
+func newAccountState(accountID string, last *pb.Transaction, nonce uint32, accounts AccountLedger) (*pb.AccountState, error) {
+	var balance uint64
+	exists := last != nil
+	if accounts != nil {
+		var held bool
+		var err error
+		if balance, held, err = accounts.GetBalance(accountID); err != nil {
+			return nil, fmt.Errorf("Error getting the balance of account %s: %s", accountID, err)
+		}
+		exists = exists || held
+	}
+	if !exists {
+		return nil, nil
+	}
+	state := &pb.AccountState{AccountID: accountID, Balance: balance, Nonce: uint64(nonce)}
+	if last != nil {
+		hash, err := TransactionHash(last)
+		if err != nil {
+			return nil, fmt.Errorf("Error hashing the last transaction of account %s: %s", accountID, err)
+		}
+		state.LastTxHash = hash
+	}
+	return state, nil
+}
+
+// FetchAccountState asks the peer at address for the state of the account,
+// giving up after 5 seconds or once ctx is done. An *AccountNotFoundError is
+// returned if the peer knows of no such account.
+func FetchAccountState(ctx context.Context, address, accountID string) (state *pb.AccountState, err error) {
+	ctx, cancel := context.WithTimeout(ctx, accountQueryTimeout)
+	defer cancel()
+	err = withRequestStreamContext(ctx, address, func(stream ChatStream) error {
+		state, err = fetchAccountStateOverStream(stream, accountID)
+		return err
+	})
+	if _, ok := err.(*AccountNotFoundError); ok {
+		return nil, &AccountNotFoundError{AccountID: accountID, Address: address}
+	} else if err != nil {
+		return nil, fmt.Errorf("Error fetching account %s from %s: %s", accountID, address, err)
+	}
+	return state, nil
+}
+
+func fetchAccountStateOverStream(stream ChatStream, accountID string) (*pb.AccountState, error) {
+	data, err := proto.Marshal(&pb.QueryAccount{AccountID: accountID})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling QueryAccount: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_QUERY_ACCOUNT, Payload: data, Timestamp: util.CreateUtcTimestamp()}
+	if err := stream.Send(request); err != nil {
+		return nil, fmt.Errorf("Error sending %s: %s", request.Type, err)
+	}
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return nil, fmt.Errorf("Error waiting for %s: %s", pb.Message_CHAIN_ACCOUNT_RESPONSE, err)
+		}
+		switch msg.Type {
+		case pb.Message_CHAIN_ACCOUNT_RESPONSE:
+			state := &pb.AccountState{}
+			if err := proto.Unmarshal(msg.Payload, state); err != nil {
+				return nil, fmt.Errorf("Error unmarshalling AccountState: %s", err)
+			}
+			return state, nil
+		case pb.Message_CHAIN_ACCOUNT_NOT_FOUND:
+			return nil, &AccountNotFoundError{AccountID: accountID}
+		case pb.Message_RESPONSE:
+			response := &pb.Response{}
+			if err := proto.Unmarshal(msg.Payload, response); err == nil && response.Status == pb.Response_FAILURE {
+				return nil, fmt.Errorf("Error response to %s: %s", request.Type, response.Msg)
+			}
+		}
+		peerLogger.Debugf("Ignoring %s while waiting for %s", msg.Type, pb.Message_CHAIN_ACCOUNT_RESPONSE)
+	}
+}
@@ -0,0 +1,151 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/looplab/fsm"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+type testAccountLedger map[string]uint64
+
+func (l testAccountLedger) GetBalance(accountID string) (uint64, bool, error) {
+	if accountID == "broken" {
+		return 0, false, fmt.Errorf("Balance of %s unreadable", accountID)
+	}
+	balance, ok := l[accountID]
+	return balance, ok, nil
+}
+
+// accountTestCoordinator answers GetAccount out of accounts
+type accountTestCoordinator struct {
+	handlerTestCoordinator
+	accounts map[string]*pb.AccountState
+}
+
+func (c accountTestCoordinator) GetAccount(accountID string) (*pb.AccountState, error) {
+	if accountID == "broken" {
+		return nil, fmt.Errorf("Account %s unreadable", accountID)
+	}
+	return c.accounts[accountID], nil
+}
+
+func TestNewAccountState(t *testing.T) {
+	last := &pb.Transaction{Uuid: "tx1", Cert: []byte("alice")}
+	state, err := newAccountState("alice", last, 3, nil)
+	hash, _ := TransactionHash(last)
+	if err != nil || state == nil || state.Nonce != 3 || state.Balance != 0 || !bytes.Equal(state.LastTxHash, hash) {
+		t.Fatalf("Expected the nonce and last transaction hash of alice, got %v, %v", state, err)
+	}
+	if state, err := newAccountState("bob", nil, 0, nil); state != nil || err != nil {
+		t.Errorf("Expected no state for an account without transactions, got %v, %v", state, err)
+	}
+
+	accounts := testAccountLedger{"alice": 50, "carol": 0}
+	if state, err := newAccountState("alice", last, 3, accounts); err != nil || state.Balance != 50 || state.Nonce != 3 {
+		t.Errorf("Expected the balance of alice, got %v, %v", state, err)
+	}
+	if state, err := newAccountState("carol", nil, 0, accounts); err != nil || state == nil || state.Balance != 0 || state.LastTxHash != nil {
+		t.Errorf("Expected a zero balance account without transactions to exist, got %v, %v", state, err)
+	}
+	if state, err := newAccountState("bob", nil, 0, accounts); state != nil || err != nil {
+		t.Errorf("Expected no state for an account unknown to the account ledger, got %v, %v", state, err)
+	}
+	if _, err := newAccountState("broken", nil, 0, accounts); err == nil {
+		t.Error("Expected an error for an unreadable balance")
+	}
+}
+
+func queryAccount(t *testing.T, handler *Handler, accountID string) *pb.Message {
+	data, _ := proto.Marshal(&pb.QueryAccount{AccountID: accountID})
+	msg := &pb.Message{Type: pb.Message_CHAIN_QUERY_ACCOUNT, Payload: data, CorrelationID: "5"}
+	e := &fsm.Event{FSM: handler.FSM, Event: msg.Type.String(), Args: []interface{}{msg}}
+	handler.beforeQueryAccount(e)
+	if e.Err != nil {
+		t.Fatalf("Error answering %s: %s", msg.Type, e.Err)
+	}
+	reply := <-handler.ChatStream.(*handshakeStream).sent
+	if reply.CorrelationID != "5" {
+		t.Fatalf("Expected the reply to carry the correlation ID of the query, got %v", reply)
+	}
+	return reply
+}
+
+func TestHandlerAnswersQueryAccount(t *testing.T) {
+	handler := newTestHandlerWithCoordinator(t, accountTestCoordinator{accounts: map[string]*pb.AccountState{
+		"alice": {AccountID: "alice", Balance: 0, Nonce: 2},
+	}})
+
+	reply := queryAccount(t, handler, "alice")
+	state := &pb.AccountState{}
+	if err := proto.Unmarshal(reply.Payload, state); err != nil || reply.Type != pb.Message_CHAIN_ACCOUNT_RESPONSE || state.Nonce != 2 {
+		t.Errorf("Expected the state of alice, got %v, %v", reply, state)
+	}
+	if reply := queryAccount(t, handler, "bob"); reply.Type != pb.Message_CHAIN_ACCOUNT_NOT_FOUND {
+		t.Errorf("Expected %s for an unknown account, got %s", pb.Message_CHAIN_ACCOUNT_NOT_FOUND, reply.Type)
+	}
+	if reply := queryAccount(t, handler, "broken"); reply.Type != pb.Message_RESPONSE {
+		t.Errorf("Expected a failed RESPONSE, got %s", reply.Type)
+	}
+}
+
+func TestFetchAccountStateOverStream(t *testing.T) {
+	stream := &handshakeStream{recv: make(chan *pb.Message, 2), sent: make(chan *pb.Message, 2)}
+	data, _ := proto.Marshal(&pb.AccountState{AccountID: "alice", Balance: 7})
+	stream.recv <- &pb.Message{Type: pb.Message_CHAIN_ACCOUNT_RESPONSE, Payload: data}
+	stream.recv <- &pb.Message{Type: pb.Message_CHAIN_ACCOUNT_NOT_FOUND}
+
+	if state, err := fetchAccountStateOverStream(stream, "alice"); err != nil || state.Balance != 7 {
+		t.Fatalf("Expected the state of alice, got %v, %v", state, err)
+	}
+	if _, err := fetchAccountStateOverStream(stream, "bob"); err == nil {
+		t.Fatal("Expected an error for an unknown account")
+	} else if _, ok := err.(*AccountNotFoundError); !ok {
+		t.Fatalf("Expected an *AccountNotFoundError, got %v", err)
+	}
+}
+
+func TestFetchAccountStateUnknownAccount(t *testing.T) {
+	address := viper.GetString("peer.address")
+	_, err := FetchAccountState(context.Background(), address, "unknown")
+	if notFound, ok := err.(*AccountNotFoundError); !ok || notFound.Address != address || notFound.AccountID != "unknown" {
+		t.Fatalf("Expected an *AccountNotFoundError from %s, got %v", address, err)
+	}
+}
+
+func TestFetchAccountStateCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if _, err := FetchAccountState(ctx, viper.GetString("peer.address"), "unknown"); err == nil {
+		t.Fatal("Expected an error with a cancelled context")
+	} else if _, ok := err.(*AccountNotFoundError); ok {
+		t.Fatalf("Expected the query to be cancelled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > accountQueryTimeout {
+		t.Errorf("Expected the cancelled query to return at once, took %s", elapsed)
+	}
+}
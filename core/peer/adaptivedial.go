@@ -0,0 +1,151 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+)
+
+// dialSmoothing is the weight of the last dial in the moving average of the
+// dial durations of an address
+const dialSmoothing = 0.2
+
+// AdaptiveDialer dials peers with a timeout learned from the exponentially
+// weighted moving average of the durations of the successful dials of each
+// address, connection and TLS handshake included. An address is dialed with
+// max(minTimeout, average * multiplier), or with initialTimeout until it was
+// once dialed successfully. A failed dial forgets the learned timeout, for the
+// next attempt to be given initialTimeout again.
+type AdaptiveDialer struct {
+	sync.RWMutex
+	minTimeout     time.Duration
+	initialTimeout time.Duration
+	multiplier     float64
+	averages       map[string]time.Duration
+	dial           func(address string, timeout time.Duration) (*grpc.ClientConn, error)
+}
+
+// NewAdaptiveDialer returns a dialer calling dial with timeouts between
+// minTimeout and initialTimeout for unknown addresses. A multiplier below 1
+// defaults to 3.
+func NewAdaptiveDialer(minTimeout, initialTimeout time.Duration, multiplier float64, dial func(address string, timeout time.Duration) (*grpc.ClientConn, error)) *AdaptiveDialer {
+	if multiplier < 1 {
+		multiplier = 3
+	}
+	return &AdaptiveDialer{minTimeout: minTimeout, initialTimeout: initialTimeout, multiplier: multiplier, averages: make(map[string]time.Duration), dial: dial}
+}
+
+var adaptiveDialer struct {
+	sync.Once
+	dialer *AdaptiveDialer
+}
+
+// GetAdaptiveDialer returns the dialer of NewPeerClientConnectionWithAddress,
+// configured by peer.dial.minTimeout and peer.dial.timeoutMultiplier
+func GetAdaptiveDialer() *AdaptiveDialer {
+	adaptiveDialer.Do(func() {
+		adaptiveDialer.dialer = NewAdaptiveDialer(viper.GetDuration("peer.dial.minTimeout"), initialDialTimeout, viper.GetFloat64("peer.dial.timeoutMultiplier"), dialPeer)
+	})
+	return adaptiveDialer.dialer
+}
+
+// Timeout returns the timeout the next dial of address is given
+func (d *AdaptiveDialer) Timeout(address string) time.Duration {
+	d.RLock()
+	average, ok := d.averages[address]
+	d.RUnlock()
+	if !ok {
+		return d.initialTimeout
+	}
+	if timeout := time.Duration(float64(average) * d.multiplier); timeout > d.minTimeout {
+		return timeout
+	}
+	return d.minTimeout
+}
+
+// observe adds a successful dial of address which took elapsed to its
+// average, the first one seeding it
+func (d *AdaptiveDialer) observe(address string, elapsed time.Duration) {
+	d.Lock()
+	defer d.Unlock()
+	average, ok := d.averages[address]
+	if !ok {
+		d.averages[address] = elapsed
+		return
+	}
+	d.averages[address] = time.Duration(dialSmoothing*float64(elapsed) + (1-dialSmoothing)*float64(average))
+}
+
+// ResetTimeout forgets the timeout learned for address
+func (d *AdaptiveDialer) ResetTimeout(address string) {
+	d.Lock()
+	defer d.Unlock()
+	delete(d.averages, address)
+}
+
+// Timeouts returns the timeouts learned, by address
+func (d *AdaptiveDialer) Timeouts() map[string]time.Duration {
+	d.RLock()
+	addresses := make([]string, 0, len(d.averages))
+	for address := range d.averages {
+		addresses = append(addresses, address)
+	}
+	d.RUnlock()
+	timeouts := make(map[string]time.Duration, len(addresses))
+	for _, address := range addresses {
+		timeouts[address] = d.Timeout(address)
+	}
+	return timeouts
+}
+
+// Dial connects to address within its current timeout
+func (d *AdaptiveDialer) Dial(address string) (*grpc.ClientConn, error) {
+	timeout := d.Timeout(address)
+	start := time.Now()
+	conn, err := d.dial(address, timeout)
+	if err != nil {
+		peerLogger.Debugf("Dialing %s failed within %s, forgetting its learned timeout: %s", address, timeout, err)
+		d.ResetTimeout(address)
+		return nil, err
+	}
+	d.observe(address, time.Since(start))
+	return conn, nil
+}
+
+// DialTimeoutsHandler returns an http.Handler serving the learned timeouts as
+// JSON, by address
+func (d *AdaptiveDialer) DialTimeoutsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeouts := make(map[string]string)
+		for address, timeout := range d.Timeouts() {
+			timeouts[address] = timeout.String()
+		}
+		data, err := json.Marshal(timeouts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+}
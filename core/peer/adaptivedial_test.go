@@ -0,0 +1,102 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func TestAdaptiveDialerTimeouts(t *testing.T) {
+	var timeouts []time.Duration
+	d := NewAdaptiveDialer(100*time.Millisecond, 3*time.Second, 0, func(address string, timeout time.Duration) (*grpc.ClientConn, error) {
+		timeouts = append(timeouts, timeout)
+		return nil, nil
+	})
+	if timeout := d.Timeout("wan:7051"); timeout != 3*time.Second {
+		t.Fatalf("Expected the initial timeout for an unknown address, got %s", timeout)
+	}
+
+	d.observe("wan:7051", time.Second)
+	if timeout := d.Timeout("wan:7051"); timeout != 3*time.Second {
+		t.Errorf("Expected the first dial to seed the average, 3 x 1s, got %s", timeout)
+	}
+	d.observe("wan:7051", 2*time.Second)
+	if timeout := d.Timeout("wan:7051"); timeout != 3600*time.Millisecond {
+		t.Errorf("Expected 3 x (0.2 x 2s + 0.8 x 1s), got %s", timeout)
+	}
+
+	d.observe("local:7051", time.Millisecond)
+	if timeout := d.Timeout("local:7051"); timeout != 100*time.Millisecond {
+		t.Errorf("Expected the minimum timeout for a fast peer, got %s", timeout)
+	}
+	if learned := d.Timeouts(); len(learned) != 2 || learned["local:7051"] != 100*time.Millisecond {
+		t.Errorf("Expected the timeouts of both addresses, got %v", learned)
+	}
+
+	d.ResetTimeout("wan:7051")
+	if timeout := d.Timeout("wan:7051"); timeout != 3*time.Second {
+		t.Errorf("Expected the initial timeout once reset, got %s", timeout)
+	}
+
+	d.Dial("local:7051")
+	if len(timeouts) != 1 || timeouts[0] != 100*time.Millisecond {
+		t.Errorf("Expected the dial to be given the learned timeout, got %v", timeouts)
+	}
+}
+
+func TestAdaptiveDialerFailedDial(t *testing.T) {
+	fail := false
+	d := NewAdaptiveDialer(0, 3*time.Second, 3, func(address string, timeout time.Duration) (*grpc.ClientConn, error) {
+		if fail {
+			return nil, fmt.Errorf("timed out")
+		}
+		return nil, nil
+	})
+	if _, err := d.Dial("peer:7051"); err != nil {
+		t.Fatalf("Error dialing: %s", err)
+	}
+	if timeout := d.Timeout("peer:7051"); timeout >= 3*time.Second {
+		t.Fatalf("Expected a timeout learned from the dial, got %s", timeout)
+	}
+	fail = true
+	if _, err := d.Dial("peer:7051"); err == nil {
+		t.Fatal("Expected the dial error")
+	}
+	if timeout := d.Timeout("peer:7051"); timeout != 3*time.Second {
+		t.Errorf("Expected a failed dial to restore the initial timeout, got %s", timeout)
+	}
+}
+
+func TestDialTimeoutsHandler(t *testing.T) {
+	d := NewAdaptiveDialer(time.Second, 3*time.Second, 3, nil)
+	d.observe("peer:7051", time.Second)
+	w := httptest.NewRecorder()
+	d.DialTimeoutsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/dial-timeouts", nil))
+	timeouts := make(map[string]string)
+	if err := json.Unmarshal(w.Body.Bytes(), &timeouts); err != nil {
+		t.Fatalf("Error unmarshalling %s: %s", w.Body.Bytes(), err)
+	}
+	if timeouts["peer:7051"] != "3s" {
+		t.Errorf("Expected the timeout of peer:7051 to be 3s, got %v", timeouts)
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+var auctionEvictedCounter = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "peer",
+	Name:      "tx_auction_evicted_total",
+	Help:      "Number of transactions evicted from the full mempool for losing the gas price auction of a block.",
+})
+
+var auctionSelectedGasGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "peer",
+	Name:      "tx_selected_gas_total",
+	Help:      "Gas of the transactions selected for the last block, as of the last gas price auction.",
+})
+
+func init() {
+	prometheus.MustRegister(auctionEvictedCounter)
+	prometheus.MustRegister(auctionSelectedGasGauge)
+}
+
+// Auction is the outcome of the gas price auction of the last block: the
+// number of transactions Selected, their Gas and the MinGasPrice of them,
+// the lowest gas price winning a place in the block
+type Auction struct {
+	Selected    int    `json:"selected"`
+	Gas         uint64 `json:"gas"`
+	MinGasPrice uint64 `json:"minGasPrice"`
+}
+
+// selectForBlock removes the committed transactions from the mempool and
+// returns the others, highest gas price first then in the order they were
+// submitted, as long as their gas under schedule fits in maxGas, 0 meaning no
+// limit. The transactions not fitting are passed over for those of lower gas
+// price which still fit. When the mempool is full, the transactions not
+// selected are evicted, for the mempool to accept new ones.
+func (m *mempool) selectForBlock(maxGas uint64, schedule gasSchedule) ([]*pb.Transaction, int) {
+	m.Lock()
+	defer m.Unlock()
+	var candidates []*pendingTransaction
+	for txID, p := range m.pending {
+		if m.committed(txID) {
+			delete(m.pending, txID)
+		} else {
+			candidates = append(candidates, p)
+		}
+	}
+	sort.Sort(byGasPrice(candidates))
+
+	full := len(m.pending) >= maxTrackedTransactions
+	auction := Auction{}
+	var selected []*pb.Transaction
+	evicted := 0
+	for _, p := range candidates {
+		gas := schedule.gas(p.tx)
+		if maxGas > 0 && auction.Gas+gas > maxGas {
+			if full {
+				delete(m.pending, p.tx.Uuid)
+				evicted++
+			}
+			continue
+		}
+		selected = append(selected, p.tx)
+		auction.Gas += gas
+		auction.MinGasPrice = p.gasPrice
+	}
+	auction.Selected = len(selected)
+	m.auction = auction
+	return selected, evicted
+}
+
+// lastAuction returns the outcome of the last selectForBlock
+func (m *mempool) lastAuction() Auction {
+	m.Lock()
+	defer m.Unlock()
+	return m.auction
+}
+
+// SelectForBlock returns the transactions submitted through this peer and not
+// yet committed, highest gas price first, as long as their gas under the
+// schedule of peer.tx.baseGas and peer.tx.gasPerByte fits in maxGas, 0 meaning
+// no limit. When the mempool is full, the transactions losing the auction are
+// evicted from it.
+func (p *PeerImpl) SelectForBlock(maxGas uint64) []*pb.Transaction {
+	selected, evicted := p.mempool.selectForBlock(maxGas, gasScheduleFromConfig())
+	if evicted > 0 {
+		peerLogger.Debugf("Evicted %d transactions losing the gas price auction from the full mempool", evicted)
+		auctionEvictedCounter.Add(float64(evicted))
+	}
+	auctionSelectedGasGauge.Set(float64(p.mempool.lastAuction().Gas))
+	return selected
+}
+
+// MinGasHandler returns an http.Handler serving GET /mempool/mingas as JSON,
+// the Auction of the last block, whose MinGasPrice is the lowest gas price
+// winning a place in it
+func (p *PeerImpl) MinGasHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "GET required", http.StatusMethodNotAllowed)
+			return
+		}
+		data, err := json.Marshal(p.mempool.lastAuction())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+}
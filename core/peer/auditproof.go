@@ -0,0 +1,117 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+func sha256MerkleParent(left, right []byte) []byte {
+	return sha256Sum(append(append([]byte{}, left...), right...))
+}
+
+// blockAuditTree returns the levels of the SHA-256 merkle tree over the hashes of the blocks
+func blockAuditTree(blocks []*pb.Block) ([][][]byte, error) {
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("No blocks to build a merkle tree over")
+	}
+	leaves := make([][]byte, len(blocks))
+	for i, block := range blocks {
+		hash, err := block.GetHash()
+		if err != nil {
+			return nil, err
+		}
+		leaves[i] = sha256Sum(hash)
+	}
+	return merkleTreeWith(leaves, sha256MerkleParent), nil
+}
+
+// BuildMerkleAuditProof returns the sibling hashes proving the block at
+// targetIndex is part of the SHA-256 merkle tree over the hashes of blocks
+func BuildMerkleAuditProof(blocks []*pb.Block, targetIndex uint32) ([][]byte, error) {
+	if int(targetIndex) >= len(blocks) {
+		return nil, fmt.Errorf("Block index %d out of range for %d blocks", targetIndex, len(blocks))
+	}
+	levels, err := blockAuditTree(blocks)
+	if err != nil {
+		return nil, err
+	}
+	return merkleProof(levels, uint64(targetIndex)), nil
+}
+
+// newBlockAuditProof returns the audit proof of the block at targetIndex of the checkpoint over blocks
+func newBlockAuditProof(blocks []*pb.Block, targetIndex uint32) (*pb.BlockAuditProof, error) {
+	if int(targetIndex) >= len(blocks) {
+		return nil, fmt.Errorf("Block index %d out of range for %d blocks", targetIndex, len(blocks))
+	}
+	levels, err := blockAuditTree(blocks)
+	if err != nil {
+		return nil, err
+	}
+	blockHash, err := blocks[targetIndex].GetHash()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.BlockAuditProof{
+		BlockHash:      blockHash,
+		CheckpointRoot: levels[len(levels)-1][0],
+		Proof:          merkleProof(levels, uint64(targetIndex)),
+		Index:          targetIndex,
+	}, nil
+}
+
+// VerifyBlockAuditProof checks that the proof leads from the block hash to the
+// checkpoint root. Callers check the block hash against the block they received
+// and the checkpoint root against the one they trust.
+func VerifyBlockAuditProof(proof *pb.BlockAuditProof) bool {
+	root := merkleRootFromProofWith(sha256Sum(proof.BlockHash), uint64(proof.Index), proof.Proof, sha256MerkleParent)
+	return bytes.Equal(root, proof.CheckpointRoot)
+}
+
+// blockAuditProof returns the audit proof of block blockNumber relative to its
+// peer.blocks.checkpointInterval window, or nil if checkpoints are disabled or
+// the window is not complete yet
+func blockAuditProof(blockchain BlockChainAccessor, blockNumber uint64) (*pb.BlockAuditProof, error) {
+	interval := uint64(viper.GetInt("peer.blocks.checkpointInterval"))
+	if interval == 0 {
+		return nil, nil
+	}
+	start := blockNumber - blockNumber%interval
+	if blockchain.GetBlockchainSize() < start+interval {
+		return nil, nil
+	}
+	blocks := make([]*pb.Block, interval)
+	for i := range blocks {
+		block, err := blockchain.GetBlockByNumber(start + uint64(i))
+		if err != nil {
+			return nil, fmt.Errorf("Error getting block %d: %s", start+uint64(i), err)
+		}
+		blocks[i] = block
+	}
+	return newBlockAuditProof(blocks, uint32(blockNumber-start))
+}
@@ -0,0 +1,77 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestBlockAuditProof(t *testing.T) {
+	var blocks []*pb.Block
+	for i := 0; i < 5; i++ {
+		blocks = append(blocks, &pb.Block{PreviousBlockHash: []byte(fmt.Sprint(i))})
+	}
+	var root []byte
+	for i := range blocks {
+		proof, err := newBlockAuditProof(blocks, uint32(i))
+		if err != nil {
+			t.Fatalf("Error building audit proof of block %d: %s", i, err)
+		}
+		if !VerifyBlockAuditProof(proof) {
+			t.Errorf("Expected the audit proof of block %d to verify", i)
+		}
+		if root != nil && string(root) != string(proof.CheckpointRoot) {
+			t.Errorf("Expected all blocks to share the checkpoint root")
+		}
+		root = proof.CheckpointRoot
+	}
+
+	proof, _ := newBlockAuditProof(blocks, 1)
+	proof.BlockHash, _ = blocks[2].GetHash()
+	if VerifyBlockAuditProof(proof) {
+		t.Error("Expected the proof of block 1 not to verify for block 2")
+	}
+	if _, err := BuildMerkleAuditProof(blocks, 5); err == nil {
+		t.Error("Expected an error for an index out of range")
+	}
+}
+
+func TestBlockAuditProofCheckpointWindow(t *testing.T) {
+	viper.Set("peer.blocks.checkpointInterval", 2)
+	defer viper.Set("peer.blocks.checkpointInterval", 0)
+	bus := NewBlockEventBus()
+	blockchain := &testBlockchain{}
+	for i := 0; i < 3; i++ {
+		blockchain.append(bus, &pb.Block{PreviousBlockHash: []byte(fmt.Sprint(i))})
+	}
+
+	proof, err := blockAuditProof(blockchain, 1)
+	if err != nil || proof == nil {
+		t.Fatalf("Expected an audit proof for block 1 of the complete window, got %v, %v", proof, err)
+	}
+	if proof.Index != 1 || !VerifyBlockAuditProof(proof) {
+		t.Errorf("Expected a valid proof for index 1 of the window, got %v", proof)
+	}
+	if proof, err := blockAuditProof(blockchain, 2); err != nil || proof != nil {
+		t.Errorf("Expected no audit proof for block 2 of an incomplete window, got %v, %v", proof, err)
+	}
+}
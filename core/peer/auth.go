@@ -0,0 +1,171 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// jwtHeader is the only JOSE header of the accepted auth tokens
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// TokenValidator checks the auth token of a DISC_HELLO, returning the ID of
+// the peer it was issued to
+type TokenValidator interface {
+	Validate(token string) (peerID string, err error)
+}
+
+// TokenValidatorAccessor interface enables a Peer to hand out its TokenValidator
+type TokenValidatorAccessor interface {
+	// GetTokenValidator returns nil if the Chat authentication is disabled
+	GetTokenValidator() TokenValidator
+}
+
+// jwtClaims are the claims of an auth token
+type jwtClaims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf,omitempty"`
+}
+
+// JWTTokenValidator accepts the JWTs signed with HMAC-SHA256 under its secret
+// that have not expired, their subject being the peer ID. The vendored
+// libraries have no JWT support, only the HS256 tokens this peer issues are
+// parsed.
+type JWTTokenValidator struct {
+	secret []byte
+	now    func() time.Time
+}
+
+// NewJWTTokenValidator returns a validator of the tokens signed with secret
+func NewJWTTokenValidator(secret []byte) *JWTTokenValidator {
+	return &JWTTokenValidator{secret: secret, now: time.Now}
+}
+
+// newTokenValidatorFromConfig returns the validator of the tokens signed with
+// peer.auth.jwtSecret, nil if empty
+func newTokenValidatorFromConfig() TokenValidator {
+	secret := viper.GetString("peer.auth.jwtSecret")
+	if secret == "" {
+		return nil
+	}
+	return NewJWTTokenValidator([]byte(secret))
+}
+
+// Validate checks the signature and expiry of the token, returning its subject
+func (v *JWTTokenValidator) Validate(token string) (string, error) {
+	if token == "" {
+		return "", errors.New("Missing auth token")
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("Malformed auth token")
+	}
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("Error decoding auth token header: %s", err)
+	}
+	var alg struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(header, &alg); err != nil {
+		return "", fmt.Errorf("Error unmarshalling auth token header: %s", err)
+	}
+	if alg.Alg != "HS256" {
+		return "", fmt.Errorf("Unsupported auth token algorithm %q", alg.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("Error decoding auth token signature: %s", err)
+	}
+	if !hmac.Equal(signature, v.sign(parts[0]+"."+parts[1])) {
+		return "", errors.New("Invalid auth token signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("Error decoding auth token claims: %s", err)
+	}
+	claims := jwtClaims{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("Error unmarshalling auth token claims: %s", err)
+	}
+	now := v.now().Unix()
+	if claims.ExpiresAt == 0 || now >= claims.ExpiresAt {
+		return "", errors.New("Expired auth token")
+	}
+	if claims.NotBefore != 0 && now < claims.NotBefore {
+		return "", errors.New("Auth token not valid yet")
+	}
+	if claims.Subject == "" {
+		return "", errors.New("Auth token without subject")
+	}
+	return claims.Subject, nil
+}
+
+// Issue returns a token for peerID signed with the secret of the validator, expiring at expiresAt
+func (v *JWTTokenValidator) Issue(peerID string, expiresAt time.Time) (string, error) {
+	payload, err := json.Marshal(&jwtClaims{Subject: peerID, ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		return "", fmt.Errorf("Error marshalling auth token claims: %s", err)
+	}
+	signed := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(v.sign(signed)), nil
+}
+
+func (v *JWTTokenValidator) sign(signed string) []byte {
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write([]byte(signed))
+	return mac.Sum(nil)
+}
+
+// newAuthToken returns the token of the DISC_HELLO of peerID, signed with
+// peer.auth.jwtSecret for peer.auth.tokenLifetime, empty if no secret is set
+func newAuthToken(peerID string) (string, error) {
+	secret := viper.GetString("peer.auth.jwtSecret")
+	if secret == "" {
+		return "", nil
+	}
+	return NewJWTTokenValidator([]byte(secret)).Issue(peerID, time.Now().Add(viper.GetDuration("peer.auth.tokenLifetime")))
+}
+
+// authorizeHello checks that the auth token of the DISC_HELLO was issued to the peer sending it
+func authorizeHello(validator TokenValidator, hello *pb.HelloMessage) error {
+	peerID, err := validator.Validate(hello.AuthToken)
+	if err != nil {
+		return err
+	}
+	if hello.PeerEndpoint == nil || hello.PeerEndpoint.ID == nil || hello.PeerEndpoint.ID.Name != peerID {
+		return fmt.Errorf("Auth token issued to %s, not the sender", peerID)
+	}
+	return nil
+}
+
+// GetTokenValidator returns the validator of the auth tokens of DISC_HELLO messages, nil if disabled
+func (p *PeerImpl) GetTokenValidator() TokenValidator {
+	return p.authValidator
+}
@@ -0,0 +1,75 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestJWTTokenValidator(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	validator := NewJWTTokenValidator([]byte("secret"))
+	validator.now = func() time.Time { return now }
+
+	token, err := validator.Issue("vp1", now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Error issuing token: %s", err)
+	}
+	if peerID, err := validator.Validate(token); err != nil || peerID != "vp1" {
+		t.Errorf("Expected the token of vp1 to validate, got %s, %v", peerID, err)
+	}
+
+	other := NewJWTTokenValidator([]byte("other"))
+	other.now = validator.now
+	if _, err := other.Validate(token); err == nil {
+		t.Error("Expected an error validating a token signed with another secret")
+	}
+	expired, _ := validator.Issue("vp1", now)
+	if _, err := validator.Validate(expired); err == nil {
+		t.Error("Expected an error validating an expired token")
+	}
+	parts := strings.Split(token, ".")
+	unsigned := "eyJhbGciOiJub25lIn0." + parts[1] + "."
+	if _, err := validator.Validate(unsigned); err == nil {
+		t.Error("Expected an error validating an unsigned token")
+	}
+	for _, malformed := range []string{"", "a.b", "a.b.c"} {
+		if _, err := validator.Validate(malformed); err == nil {
+			t.Errorf("Expected an error validating %q", malformed)
+		}
+	}
+}
+
+func TestAuthorizeHello(t *testing.T) {
+	validator := NewJWTTokenValidator([]byte("secret"))
+	token, err := validator.Issue("vp1", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Error issuing token: %s", err)
+	}
+	hello := &pb.HelloMessage{PeerEndpoint: &pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp1"}}, AuthToken: token}
+	if err := authorizeHello(validator, hello); err != nil {
+		t.Errorf("Expected the hello of vp1 to be authorized: %s", err)
+	}
+	hello.PeerEndpoint.ID.Name = "vp2"
+	if err := authorizeHello(validator, hello); err == nil {
+		t.Error("Expected the token of vp1 to be refused in the hello of vp2")
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// bannedReason is the DISC_DISCONNECT payload sent to a banned peer
+const bannedReason = "banned"
+
+// BanListAccessor interface enables a Peer to hand out its BanList
+type BanListAccessor interface {
+	GetBanList() *BanList
+}
+
+// BanList is the set of banned peer IDs and IP addresses, persisted to a file
+// on every change. Chats with banned peers are closed.
+type BanList struct {
+	sync.Mutex
+	path   string
+	banned map[string]struct{}
+}
+
+// NewBanList returns a ban list persisted to path, loading the bans saved
+// there. An empty path keeps the bans in memory only.
+func NewBanList(path string) (*BanList, error) {
+	b := &BanList{path: path, banned: make(map[string]struct{})}
+	if path == "" {
+		return b, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return b, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var banned []string
+	if err := json.Unmarshal(data, &banned); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling bans from %s: %s", path, err)
+	}
+	for _, key := range banned {
+		b.banned[key] = struct{}{}
+	}
+	return b, nil
+}
+
+func newBanListFromConfig() *BanList {
+	path := filepath.Join(viper.GetString("peer.fileSystemPath"), viper.GetString("peer.ban.file"))
+	banList, err := NewBanList(path)
+	if err != nil {
+		peerLogger.Warningf("Error loading banned peers: %s", err)
+		banList = &BanList{path: path, banned: make(map[string]struct{})}
+	}
+	return banList
+}
+
+// Ban adds the peer IDs or IP addresses to the ban list
+func (b *BanList) Ban(keys ...string) error {
+	b.Lock()
+	defer b.Unlock()
+	for _, key := range keys {
+		b.banned[key] = struct{}{}
+	}
+	return b.save()
+}
+
+// Lift removes the peer ID or IP address from the ban list
+func (b *BanList) Lift(peerID string) error {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.banned, peerID)
+	return b.save()
+}
+
+// Banned returns true if any of the peer IDs or IP addresses is banned
+func (b *BanList) Banned(keys ...string) bool {
+	b.Lock()
+	defer b.Unlock()
+	for _, key := range keys {
+		if _, ok := b.banned[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the banned peer IDs and IP addresses, sorted
+func (b *BanList) List() []string {
+	b.Lock()
+	defer b.Unlock()
+	return b.list()
+}
+
+func (b *BanList) list() []string {
+	banned := make([]string, 0, len(b.banned))
+	for key := range b.banned {
+		banned = append(banned, key)
+	}
+	sort.Strings(banned)
+	return banned
+}
+
+func (b *BanList) save() error {
+	if b.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(b.list())
+	if err != nil {
+		return fmt.Errorf("Error marshalling bans: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(b.path), 0755); err != nil {
+		return fmt.Errorf("Error creating directory for %s: %s", b.path, err)
+	}
+	return ioutil.WriteFile(b.path, data, 0644)
+}
+
+// banKeys returns the ID of the peer and the IP address of its endpoint, the keys it is banned by
+func banKeys(endpoint *pb.PeerEndpoint) []string {
+	var keys []string
+	if endpoint.ID != nil && endpoint.ID.Name != "" {
+		keys = append(keys, endpoint.ID.Name)
+	}
+	if host, _, err := net.SplitHostPort(endpoint.Address); err == nil && host != "" {
+		keys = append(keys, host)
+	}
+	return keys
+}
+
+// MisbehaviorScorer counts the invalid messages received from each peer
+type MisbehaviorScorer struct {
+	sync.Mutex
+	threshold int
+	scores    map[string]int
+}
+
+// NewMisbehaviorScorer returns a scorer reporting peers sending more than
+// threshold invalid messages, a threshold of 0 never reports
+func NewMisbehaviorScorer(threshold int) *MisbehaviorScorer {
+	return &MisbehaviorScorer{threshold: threshold, scores: make(map[string]int)}
+}
+
+func newMisbehaviorScorerFromConfig() *MisbehaviorScorer {
+	return NewMisbehaviorScorer(viper.GetInt("peer.ban.threshold"))
+}
+
+// Misbehaved records an invalid message from the peer, returning true once
+// its score exceeds the threshold. The score of a reported peer starts over.
+func (m *MisbehaviorScorer) Misbehaved(peerID string) bool {
+	if m.threshold <= 0 {
+		return false
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.scores[peerID]++
+	if m.scores[peerID] <= m.threshold {
+		return false
+	}
+	delete(m.scores, peerID)
+	return true
+}
+
+// GetBanList returns the list of banned peers
+func (p *PeerImpl) GetBanList() *BanList {
+	return p.banList
+}
+
+// reportMisbehavior scores an invalid message received from the peer of the
+// handler. Once it exceeds peer.ban.threshold the peer is banned, sent a
+// DISC_DISCONNECT and a *BannedError is returned for the Chat to be closed.
+func (p *PeerImpl) reportMisbehavior(handler MessageHandler) error {
+	to, err := handler.To()
+	if err != nil || to.ID == nil {
+		// Messages before the DISC_HELLO exchange cannot be attributed to a peer
+		return nil
+	}
+	if !p.misbehavior.Misbehaved(to.ID.Name) {
+		return nil
+	}
+	keys := banKeys(&to)
+	if err := p.banList.Ban(keys...); err != nil {
+		peerLogger.Errorf("Error saving the ban of %s: %s", to.ID.Name, err)
+	}
+	p.sessions.RevokePeer(to.ID.Name)
+	return disconnectBanned(handler.SendMessage, keys)
+}
+
+// disconnectBanned sends DISC_DISCONNECT to a banned peer and returns the *BannedError closing the Chat
+func disconnectBanned(send func(*pb.Message) error, keys []string) error {
+	if err := send(&pb.Message{Type: pb.Message_DISC_DISCONNECT, Payload: []byte(bannedReason)}); err != nil {
+		peerLogger.Debugf("Error sending %s to a banned peer: %s", pb.Message_DISC_DISCONNECT, err)
+	}
+	return &BannedError{Keys: keys}
+}
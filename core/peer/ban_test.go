@@ -0,0 +1,77 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestBanListPersistsBans(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bantest")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bans.json")
+
+	banList, err := NewBanList(path)
+	if err != nil {
+		t.Fatalf("Error creating ban list: %s", err)
+	}
+	keys := banKeys(&pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp1"}, Address: "10.0.0.1:30303"})
+	if len(keys) != 2 || keys[0] != "vp1" || keys[1] != "10.0.0.1" {
+		t.Fatalf("Expected the peer to be banned by ID and IP address, got %v", keys)
+	}
+	if err := banList.Ban(keys...); err != nil {
+		t.Fatalf("Error banning peer: %s", err)
+	}
+
+	reloaded, err := NewBanList(path)
+	if err != nil {
+		t.Fatalf("Error reloading ban list: %s", err)
+	}
+	if !reloaded.Banned("vp1") || !reloaded.Banned("vp2", "10.0.0.1") || reloaded.Banned("vp2") {
+		t.Fatalf("Unexpected bans after reloading: %v", reloaded.List())
+	}
+	if err := reloaded.Lift("vp1"); err != nil {
+		t.Fatalf("Error lifting ban: %s", err)
+	}
+	if reloaded, err = NewBanList(path); err != nil || reloaded.Banned("vp1") {
+		t.Fatalf("Expected the lifted ban to be saved, got %v, %v", reloaded.List(), err)
+	}
+}
+
+func TestMisbehaviorScorer(t *testing.T) {
+	scorer := NewMisbehaviorScorer(2)
+	if scorer.Misbehaved("vp1") || scorer.Misbehaved("vp1") {
+		t.Fatal("Expected the peer not to be reported up to the threshold")
+	}
+	if scorer.Misbehaved("vp2") {
+		t.Fatal("Expected scores to be kept per peer")
+	}
+	if !scorer.Misbehaved("vp1") {
+		t.Fatal("Expected the peer to be reported above the threshold")
+	}
+	if NewMisbehaviorScorer(0).Misbehaved("vp1") {
+		t.Fatal("Expected a threshold of 0 never to report")
+	}
+}
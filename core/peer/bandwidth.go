@@ -0,0 +1,78 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// maxBandwidthTestPayloadSize is the largest DISC_BANDWIDTH_RESULT payload a peer will send
+const maxBandwidthTestPayloadSize = 1 << 20
+
+// newBandwidthResult returns the DISC_BANDWIDTH_RESULT message answering the test
+func newBandwidthResult(test *pb.BandwidthTest) (*pb.Message, error) {
+	if test.PayloadSize > maxBandwidthTestPayloadSize {
+		return nil, fmt.Errorf("Bandwidth test payload size %d exceeds the maximum of %d", test.PayloadSize, maxBandwidthTestPayloadSize)
+	}
+	data, err := proto.Marshal(&pb.BandwidthResult{Payload: make([]byte, test.PayloadSize), SendTimestamp: util.CreateUtcTimestamp()})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling BandwidthResult: %s", err)
+	}
+	return &pb.Message{Type: pb.Message_DISC_BANDWIDTH_RESULT, Payload: data}, nil
+}
+
+// measureBandwidth runs a bandwidth test over the stream and returns the effective bandwidth in bytes per second
+func measureBandwidth(stream ChatStream, sizeBytes uint32) (float64, error) {
+	data, err := proto.Marshal(&pb.BandwidthTest{PayloadSize: sizeBytes})
+	if err != nil {
+		return 0, fmt.Errorf("Error marshalling BandwidthTest: %s", err)
+	}
+	start := time.Now()
+	reply, err := requestOverStream(stream, &pb.Message{Type: pb.Message_DISC_BANDWIDTH_TEST, Payload: data}, pb.Message_DISC_BANDWIDTH_RESULT)
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	result := &pb.BandwidthResult{}
+	if err := proto.Unmarshal(reply.Payload, result); err != nil {
+		return 0, fmt.Errorf("Error unmarshalling BandwidthResult: %s", err)
+	}
+	return float64(len(result.Payload)) / rtt.Seconds(), nil
+}
+
+// MeasureBandwidth measures the effective bandwidth to the peer at address by
+// requesting a sizeBytes DISC_BANDWIDTH_RESULT, and records it in the registry
+// entry of that peer
+func (p *PeerImpl) MeasureBandwidth(address string, sizeBytes uint32) (float64, error) {
+	var bandwidth float64
+	err := withRequestStream(address, func(stream ChatStream) (err error) {
+		bandwidth, err = measureBandwidth(stream, sizeBytes)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("Error measuring bandwidth to %s: %s", address, err)
+	}
+	peerLogger.Debugf("Measured bandwidth to %s: %.0f bytes/s", address, bandwidth)
+	p.registry.UpdateBandwidth(address, bandwidth)
+	return bandwidth, nil
+}
@@ -0,0 +1,49 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestNewBandwidthResultLimit(t *testing.T) {
+	if _, err := newBandwidthResult(&pb.BandwidthTest{PayloadSize: maxBandwidthTestPayloadSize + 1}); err == nil {
+		t.Error("Expected an error for a payload above the maximum size")
+	}
+}
+
+func TestMeasureBandwidth(t *testing.T) {
+	address := viper.GetString("peer.address")
+	p := &PeerImpl{registry: NewPeerRegistry()}
+	endpoint := &pb.PeerEndpoint{ID: &pb.PeerID{Name: "remote"}, Address: address}
+	p.registry.Add(endpoint)
+
+	bandwidth, err := p.MeasureBandwidth(address, 64*1024)
+	if err != nil {
+		t.Fatalf("Error measuring bandwidth: %s", err)
+	}
+	if bandwidth <= 0 {
+		t.Errorf("Expected a positive bandwidth, got %f", bandwidth)
+	}
+	if entry, _ := p.registry.Get(endpoint.ID); entry.BandwidthBytesPerSec != bandwidth {
+		t.Errorf("Expected registry entry to record %f, got %f", bandwidth, entry.BandwidthBytesPerSec)
+	}
+}
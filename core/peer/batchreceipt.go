@@ -0,0 +1,179 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// receiptPollInterval is how often the receipts still missing for a batch are asked for again
+const receiptPollInterval = 500 * time.Millisecond
+
+// BatchReceipt is the outcome of waiting for the receipts of a batch
+type BatchReceipt struct {
+	Receipts []*pb.TransactionReceipt
+	// Missing are the IDs of the transactions left without a receipt
+	Missing []string
+	Elapsed time.Duration
+}
+
+// BatchReceiptAggregator collects the receipts of the transactions of a
+// batch until expectedCount of them arrived or its timeout fired
+type BatchReceiptAggregator struct {
+	sync.Mutex
+	expectedCount int
+	timeout       time.Duration
+	start         time.Time
+	last          time.Time
+	receipts      []*pb.TransactionReceipt
+	received      map[string]bool
+	done          chan struct{}
+}
+
+// NewBatchReceiptAggregator returns an aggregator waiting for expected
+// receipts for at most timeout from now
+func NewBatchReceiptAggregator(expected int, timeout time.Duration) *BatchReceiptAggregator {
+	a := &BatchReceiptAggregator{
+		expectedCount: expected,
+		timeout:       timeout,
+		start:         time.Now(),
+		received:      make(map[string]bool),
+		done:          make(chan struct{}),
+	}
+	if expected <= 0 {
+		close(a.done)
+	}
+	return a
+}
+
+// Add collects the receipt, a transaction already received being ignored,
+// and returns whether all the expected receipts have arrived
+func (a *BatchReceiptAggregator) Add(receipt *pb.TransactionReceipt) bool {
+	a.Lock()
+	defer a.Unlock()
+	if len(a.receipts) >= a.expectedCount {
+		return true
+	}
+	if receipt == nil || a.received[receipt.TxID] {
+		return false
+	}
+	a.received[receipt.TxID] = true
+	a.receipts = append(a.receipts, receipt)
+	a.last = time.Now()
+	if len(a.receipts) < a.expectedCount {
+		return false
+	}
+	close(a.done)
+	return true
+}
+
+// missing returns the ones of txIDs without a receipt yet
+func (a *BatchReceiptAggregator) missing(txIDs []string) []string {
+	a.Lock()
+	defer a.Unlock()
+	var missing []string
+	for _, txID := range txIDs {
+		if !a.received[txID] {
+			missing = append(missing, txID)
+		}
+	}
+	return missing
+}
+
+// Wait blocks until all the expected receipts have arrived or the timeout
+// fired and returns them, the ones of txIDs without a receipt as missing
+func (a *BatchReceiptAggregator) Wait(txIDs []string) *BatchReceipt {
+	timer := time.NewTimer(a.remaining())
+	defer timer.Stop()
+	select {
+	case <-a.done:
+	case <-timer.C:
+	}
+	a.Lock()
+	defer a.Unlock()
+	result := &BatchReceipt{Receipts: append([]*pb.TransactionReceipt(nil), a.receipts...), Elapsed: time.Since(a.start)}
+	if len(a.receipts) >= a.expectedCount && !a.last.IsZero() {
+		result.Elapsed = a.last.Sub(a.start)
+	}
+	for _, txID := range txIDs {
+		if !a.received[txID] {
+			result.Missing = append(result.Missing, txID)
+		}
+	}
+	return result
+}
+
+// remaining returns how long until the timeout of the aggregator fires
+func (a *BatchReceiptAggregator) remaining() time.Duration {
+	return a.timeout - time.Since(a.start)
+}
+
+// batchReceiptTimeout returns how long SendTransactionsToPeer waits for the
+// receipts of a batch, peer.tx.batchReceiptTimeout. 0 does not wait.
+func batchReceiptTimeout() time.Duration {
+	if timeout := viper.GetDuration("peer.tx.batchReceiptTimeout"); timeout > 0 {
+		return timeout
+	}
+	return 0
+}
+
+// collectReceipts asks the peer at address over a single Chat stream, on a
+// connection of pool, for the receipts of txIDs, again every
+// receiptPollInterval for the ones not committed yet, until the aggregator
+// has them all or its timeout fired
+func collectReceipts(pool *PeerConnectionPool, address string, txIDs []string, aggregator *BatchReceiptAggregator) *BatchReceipt {
+	err := withPooledRequestStreamTimeout(pool, address, aggregator.remaining(), func(stream ChatStream) error {
+		for aggregator.remaining() > 0 {
+			for _, txID := range aggregator.missing(txIDs) {
+				data, err := proto.Marshal(&pb.GetTransactionReceipt{TxID: txID})
+				if err != nil {
+					return fmt.Errorf("Error marshalling GetTransactionReceipt: %s", err)
+				}
+				request := &pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS_GET_RECEIPT, Payload: data}
+				reply, err := requestOverStream(stream, request, pb.Message_CHAIN_TRANSACTIONS_RECEIPT)
+				if err != nil {
+					peerLogger.Debugf("No receipt for transaction %s from %s yet: %s", txID, address, err)
+					continue
+				}
+				receipt := &pb.TransactionReceipt{}
+				if err := proto.Unmarshal(reply.Payload, receipt); err != nil {
+					return fmt.Errorf("Error unmarshalling TransactionReceipt: %s", err)
+				}
+				if aggregator.Add(receipt) {
+					return nil
+				}
+			}
+			select {
+			case <-aggregator.done:
+				return nil
+			case <-time.After(receiptPollInterval):
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		peerLogger.Warningf("Error collecting the receipts of %d transactions from %s: %s", len(txIDs), address, err)
+	}
+	return aggregator.Wait(txIDs)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestBatchReceiptAggregator(t *testing.T) {
+	aggregator := NewBatchReceiptAggregator(2, time.Minute)
+	if aggregator.Add(&pb.TransactionReceipt{TxID: "a"}) {
+		t.Fatal("Expected the aggregator to wait for the second receipt")
+	}
+	if aggregator.Add(&pb.TransactionReceipt{TxID: "a"}) {
+		t.Fatal("Expected a receipt received twice to be counted once")
+	}
+	if !aggregator.Add(&pb.TransactionReceipt{TxID: "b"}) {
+		t.Fatal("Expected the aggregator to be complete")
+	}
+	result := aggregator.Wait([]string{"a", "b"})
+	if len(result.Receipts) != 2 || len(result.Missing) != 0 || result.Elapsed >= time.Minute {
+		t.Fatalf("Expected both receipts right away, got %d receipts, missing %v after %s", len(result.Receipts), result.Missing, result.Elapsed)
+	}
+}
+
+func TestBatchReceiptAggregatorTimeout(t *testing.T) {
+	aggregator := NewBatchReceiptAggregator(3, 50*time.Millisecond)
+	aggregator.Add(&pb.TransactionReceipt{TxID: "b"})
+	result := aggregator.Wait([]string{"a", "b", "c"})
+	if len(result.Receipts) != 1 || len(result.Missing) != 2 || result.Missing[0] != "a" || result.Missing[1] != "c" {
+		t.Fatalf("Expected a and c to be missing, got %d receipts, missing %v", len(result.Receipts), result.Missing)
+	}
+	if result.Elapsed < 50*time.Millisecond {
+		t.Fatalf("Expected to wait for the timeout, waited %s", result.Elapsed)
+	}
+}
+
+func TestCollectReceiptsMissing(t *testing.T) {
+	if SecurityEnabled() {
+		t.Skip("Security is enabled")
+	}
+	txIDs := []string{"not-a-transaction", "not-a-transaction-either"}
+	result := collectReceipts(nil, viper.GetString("peer.address"), txIDs, NewBatchReceiptAggregator(len(txIDs), time.Second))
+	if len(result.Receipts) != 0 || len(result.Missing) != 2 {
+		t.Fatalf("Expected the receipts of unknown transactions to be missing, got %d receipts, missing %v", len(result.Receipts), result.Missing)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// SplitSendResult is the outcome of a batch sent to a peer in several parts
+// for being larger than peer.grpc.maxMessageSize
+type SplitSendResult struct {
+	// Parts is the number of CHAIN_TRANSACTIONS the batch was sent as
+	Parts int
+	// Errors are the errors of the parts, in batch order, nil for the parts
+	// the peer accepted
+	Errors []error
+}
+
+// autoSplitLimit returns peer.grpc.maxMessageSize if peer.tx.autoSplit is
+// set, 0 not to split batches otherwise
+func autoSplitLimit() int {
+	if !viper.GetBool("peer.tx.autoSplit") {
+		return 0
+	}
+	return getMaxMessageSize()
+}
+
+// splitTransactionBatch halves the transactions of batch recursively, until
+// every part marshals to at most maxSize bytes or holds a single
+// transaction. Each part keeps the batch settings and the signatures of its
+// transactions. A batch which fits, or whose forwarding chain signs its
+// transactions as a whole, is returned as is.
+func splitTransactionBatch(batch *pb.TransactionBlock, maxSize int) []*pb.TransactionBlock {
+	if maxSize <= 0 || len(batch.Transactions) <= 1 || len(batch.ForwardingChain) > 0 || proto.Size(batch) <= maxSize {
+		return []*pb.TransactionBlock{batch}
+	}
+	half := len(batch.Transactions) / 2
+	first := transactionBatchPart(batch, batch.Transactions[:half])
+	second := transactionBatchPart(batch, batch.Transactions[half:])
+	return append(splitTransactionBatch(first, maxSize), splitTransactionBatch(second, maxSize)...)
+}
+
+// transactionBatchPart returns the part of batch holding transactions
+func transactionBatchPart(batch *pb.TransactionBlock, transactions []*pb.Transaction) *pb.TransactionBlock {
+	txIDs := make(map[string]bool)
+	for _, tx := range transactions {
+		txIDs[tx.Uuid] = true
+	}
+	part := &pb.TransactionBlock{
+		Transactions:  transactions,
+		Hops:          batch.Hops,
+		SchemaVersion: batch.SchemaVersion,
+		GasLimit:      batch.GasLimit,
+		GasPrice:      batch.GasPrice,
+		Priority:      batch.Priority,
+		ExecutionEnv:  batch.ExecutionEnv,
+		ChannelID:     batch.ChannelID,
+	}
+	if len(batch.IdempotencyKey) > 0 {
+		part.IdempotencyKey = partIdempotencyKey(batch.IdempotencyKey, transactions)
+	}
+	for _, signature := range batch.Signatures {
+		if txIDs[signature.TxID] {
+			part.Signatures = append(part.Signatures, signature)
+		}
+	}
+	for _, signature := range batch.AggregateSignatures {
+		if txIDs[signature.TxID] {
+			part.AggregateSignatures = append(part.AggregateSignatures, signature)
+		}
+	}
+	return part
+}
+
+// partIdempotencyKey returns the idempotency key of the part of a batch of
+// key with the transactions, the HMAC-SHA256 of their NUL terminated IDs
+// keyed with key, for each part to be told apart from the others when resent
+func partIdempotencyKey(key []byte, transactions []*pb.Transaction) []byte {
+	mac := hmac.New(sha256.New, key)
+	for _, tx := range transactions {
+		mac.Write([]byte(tx.Uuid))
+		mac.Write([]byte{0})
+	}
+	return mac.Sum(nil)
+}
+
+// sendSplitTransactions sends the parts of the batch one after the other,
+// returning their combined result. The transactions of a part the peer did
+// not accept are failed with the error of the part, and an error is only
+// returned if no part was accepted.
+func sendSplitTransactions(pool *PeerConnectionPool, address string, parts []*pb.TransactionBlock, progress ProgressCallback) (*BatchResult, error) {
+	peerLogger.Infof("Sending the batch to %s as %d CHAIN_TRANSACTIONS", address, len(parts))
+	result := &BatchResult{Split: &SplitSendResult{Parts: len(parts), Errors: make([]error, len(parts))}}
+	accepted := 0
+	for i, part := range parts {
+		partResult, err := sendTransactions(pool, address, part, progress)
+		result.Split.Errors[i] = err
+		if err != nil {
+			peerLogger.Warningf("Part %d of %d of the batch not accepted: %s", i+1, len(parts), err)
+			for _, tx := range part.Transactions {
+				result.Failed = append(result.Failed, &pb.TxFailure{TxID: tx.Uuid, Reason: err.Error()})
+			}
+			continue
+		}
+		accepted++
+		result.Committed = append(result.Committed, partResult.Committed...)
+		result.Failed = append(result.Failed, partResult.Failed...)
+	}
+	if accepted == 0 {
+		return nil, result.Split.Errors[0]
+	}
+	return result, nil
+}
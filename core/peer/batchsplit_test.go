@@ -0,0 +1,79 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestSplitTransactionBatch(t *testing.T) {
+	batch := newTestTransactionBatch(5)
+	for _, tx := range batch.Transactions {
+		tx.Payload = make([]byte, 100)
+	}
+	batch.GasLimit = 1000
+	batch.Signatures = []*pb.IndividualSignature{{TxID: "tx0", SignerID: "a"}, {TxID: "tx4", SignerID: "b"}}
+	parts := splitTransactionBatch(batch, 250)
+
+	var txIDs []string
+	var signatures int
+	for _, part := range parts {
+		if size := proto.Size(part); size > 250 && len(part.Transactions) > 1 {
+			t.Errorf("Expected every part of several transactions to fit, got %d bytes", size)
+		}
+		if part.GasLimit != batch.GasLimit {
+			t.Errorf("Expected the parts to keep the gas limit of the batch, got %d", part.GasLimit)
+		}
+		for _, tx := range part.Transactions {
+			txIDs = append(txIDs, tx.Uuid)
+		}
+		for _, signature := range part.Signatures {
+			if signature.TxID != part.Transactions[0].Uuid && signature.TxID != part.Transactions[len(part.Transactions)-1].Uuid {
+				t.Errorf("Expected the signature of %s in the part of its transaction", signature.TxID)
+			}
+			signatures++
+		}
+	}
+	if len(parts) < 2 || len(txIDs) != 5 || txIDs[0] != "tx0" || txIDs[4] != "tx4" || signatures != 2 {
+		t.Errorf("Expected the batch split in order, got %d parts of %v with %d signatures", len(parts), txIDs, signatures)
+	}
+
+	if parts := splitTransactionBatch(batch, 0); len(parts) != 1 || parts[0] != batch {
+		t.Error("Expected the batch not to be split without a limit")
+	}
+	batch.ForwardingChain = []*pb.ForwardingRecord{{PeerID: "relay1"}}
+	if parts := splitTransactionBatch(batch, 250); len(parts) != 1 || parts[0] != batch {
+		t.Error("Expected a batch with a forwarding chain not to be split")
+	}
+}
+
+func TestAutoSplitLimit(t *testing.T) {
+	defer viper.Set("peer.tx.autoSplit", viper.GetBool("peer.tx.autoSplit"))
+	viper.Set("peer.tx.autoSplit", false)
+	if limit := autoSplitLimit(); limit != 0 {
+		t.Errorf("Expected no split limit unless peer.tx.autoSplit is set, got %d", limit)
+	}
+	viper.Set("peer.tx.autoSplit", true)
+	if limit := autoSplitLimit(); limit != getMaxMessageSize() {
+		t.Errorf("Expected peer.grpc.maxMessageSize as the split limit, got %d", limit)
+	}
+}
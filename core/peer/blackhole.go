@@ -0,0 +1,106 @@
+// +build test
+
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+var (
+	blackhole     *BlackholeMiddleware
+	blackholeOnce sync.Once
+)
+
+func init() {
+	wrapChatStream = func(stream ChatStream) ChatStream {
+		return GetBlackhole().Wrap(stream)
+	}
+}
+
+// GetBlackhole returns the BlackholeMiddleware every Chat of this process is
+// handled through, initially enabled as peer.test.blackhole
+func GetBlackhole() *BlackholeMiddleware {
+	blackholeOnce.Do(func() {
+		blackhole = NewBlackholeMiddleware(viper.GetBool("peer.test.blackhole"))
+	})
+	return blackhole
+}
+
+// BlackholeMiddleware simulates a network partition: while it is enabled the
+// messages sent and received on the streams it wraps are silently dropped, no
+// error being returned. It is only built with -tags test.
+type BlackholeMiddleware struct {
+	enabled int32
+}
+
+// NewBlackholeMiddleware returns a middleware, dropping messages if enabled
+func NewBlackholeMiddleware(enabled bool) *BlackholeMiddleware {
+	b := &BlackholeMiddleware{}
+	b.SetBlackhole(enabled)
+	return b
+}
+
+// SetBlackhole starts or stops dropping the messages of the wrapped streams
+func (b *BlackholeMiddleware) SetBlackhole(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&b.enabled, value)
+}
+
+// Enabled returns true while messages are dropped
+func (b *BlackholeMiddleware) Enabled() bool {
+	return atomic.LoadInt32(&b.enabled) == 1
+}
+
+// Wrap returns the stream with its messages dropped while the black hole is enabled
+func (b *BlackholeMiddleware) Wrap(stream ChatStream) ChatStream {
+	return &blackholeChatStream{ChatStream: stream, blackhole: b}
+}
+
+type blackholeChatStream struct {
+	ChatStream
+	blackhole *BlackholeMiddleware
+}
+
+func (s *blackholeChatStream) Send(msg *pb.Message) error {
+	if s.blackhole.Enabled() {
+		peerLogger.Debugf("Black hole dropping sent %s", msg.Type)
+		return nil
+	}
+	return s.ChatStream.Send(msg)
+}
+
+// Recv returns the next message received while the black hole is disabled.
+// Stream errors are still returned, the stream itself failing.
+func (s *blackholeChatStream) Recv() (*pb.Message, error) {
+	for {
+		msg, err := s.ChatStream.Recv()
+		if err != nil || !s.blackhole.Enabled() {
+			return msg, err
+		}
+		peerLogger.Debugf("Black hole dropping received %s", msg.Type)
+	}
+}
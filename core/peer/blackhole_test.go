@@ -0,0 +1,55 @@
+// +build test
+
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"io"
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestBlackholeDropsMessages(t *testing.T) {
+	inner := &handshakeStream{recv: make(chan *pb.Message, 3), sent: make(chan *pb.Message, 2)}
+	blackhole := NewBlackholeMiddleware(true)
+	stream := blackhole.Wrap(inner)
+
+	if err := stream.Send(&pb.Message{Type: pb.Message_DISC_PING}); err != nil {
+		t.Fatalf("Expected no error from a black holed Send, got: %s", err)
+	}
+	if len(inner.sent) != 0 {
+		t.Fatal("Expected the sent message to be dropped")
+	}
+	inner.recv <- &pb.Message{Type: pb.Message_DISC_PING}
+	inner.recv <- &pb.Message{Type: pb.Message_DISC_PING}
+	close(inner.recv)
+	if msg, err := stream.Recv(); err != io.EOF {
+		t.Fatalf("Expected the received messages to be dropped up to EOF, got %v, %v", msg, err)
+	}
+
+	blackhole.SetBlackhole(false)
+	inner.recv = make(chan *pb.Message, 1)
+	inner.recv <- &pb.Message{Type: pb.Message_DISC_PONG}
+	if msg, err := stream.Recv(); err != nil || msg.Type != pb.Message_DISC_PONG {
+		t.Fatalf("Expected DISC_PONG once the black hole is disabled, got %v, %v", msg, err)
+	}
+	if err := stream.Send(&pb.Message{Type: pb.Message_DISC_PING}); err != nil || len(inner.sent) != 1 {
+		t.Errorf("Expected the message to be sent once the black hole is disabled, got %v", err)
+	}
+}
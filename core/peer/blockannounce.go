@@ -0,0 +1,178 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+var blockSealLatencyHistogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Namespace: "peer",
+	Name:      "block_seal_latency_seconds",
+	Help:      "Time from the first CHAIN_TRANSACTIONS batch received for a block to the block being sealed by this peer.",
+})
+
+func init() {
+	prometheus.MustRegister(blockSealLatencyHistogram)
+}
+
+// BlockAnnouncerAccessor interface enables a Peer to hand out its BlockAnnouncer
+type BlockAnnouncerAccessor interface {
+	GetBlockAnnouncer() *BlockAnnouncer
+}
+
+// BlockAnnouncer pushes a CHAIN_NEW_BLOCK_SEALED to the connected peers for
+// every block this peer seals, and keeps the latest block known to be sealed,
+// by this peer or announced by others
+type BlockAnnouncer struct {
+	// latestKnownHeight is the number of the latest known block plus one, 0
+	// while no block is known
+	latestKnownHeight uint64
+	self              func() (*pb.PeerEndpoint, error)
+	broadcast         func(msg *pb.Message) []error
+
+	// firstArrival holds, by block number, when the first CHAIN_TRANSACTIONS
+	// batch was received while the block was the next one to be sealed
+	firstArrivalMutex sync.Mutex
+	firstArrival      map[uint64]time.Time
+}
+
+// NewBlockAnnouncer returns an announcer sending its announcements through
+// broadcast, as sealed by the peer of the endpoint returned by self
+func NewBlockAnnouncer(self func() (*pb.PeerEndpoint, error), broadcast func(msg *pb.Message) []error) *BlockAnnouncer {
+	return &BlockAnnouncer{self: self, broadcast: broadcast, firstArrival: make(map[uint64]time.Time)}
+}
+
+// newBlockSealed returns the CHAIN_NEW_BLOCK_SEALED announcing block blockNumber
+func newBlockSealed(blockNumber uint64, block *pb.Block, sealerID *pb.PeerID) (*pb.Message, error) {
+	hash, err := block.GetHash()
+	if err != nil {
+		return nil, fmt.Errorf("Error hashing block %d: %s", blockNumber, err)
+	}
+	timestamp := block.Timestamp
+	if timestamp == nil {
+		timestamp = util.CreateUtcTimestamp()
+	}
+	data, err := proto.Marshal(&pb.BlockSealed{
+		BlockNumber:       blockNumber,
+		BlockHash:         hash,
+		SealerID:          sealerID,
+		Timestamp:         timestamp,
+		TotalTransactions: uint32(len(block.Transactions)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling BlockSealed: %s", err)
+	}
+	return &pb.Message{Type: pb.Message_CHAIN_NEW_BLOCK_SEALED, Payload: data, Timestamp: util.CreateUtcTimestamp()}, nil
+}
+
+// Announce records block blockNumber as the latest known and sends its
+// CHAIN_NEW_BLOCK_SEALED to the connected peers. It returns once the message
+// is built, the peers being sent it in the background not to hold up the
+// commit of the next block.
+func (a *BlockAnnouncer) Announce(blockNumber uint64, block *pb.Block) {
+	if latency, ok := a.sealLatency(blockNumber, time.Now()); ok {
+		blockSealLatencyHistogram.Observe(latency.Seconds())
+	}
+	a.observe(blockNumber)
+	self, err := a.self()
+	if err != nil {
+		peerLogger.Errorf("Error announcing block %d: %s", blockNumber, err)
+		return
+	}
+	msg, err := newBlockSealed(blockNumber, block, self.ID)
+	if err != nil {
+		peerLogger.Errorf("Error announcing block %d: %s", blockNumber, err)
+		return
+	}
+	go func() {
+		for _, err := range a.broadcast(msg) {
+			peerLogger.Debugf("Error sending %s of block %d: %s", msg.Type, blockNumber, err)
+		}
+	}()
+}
+
+// TransactionsArrived records now as the arrival of the first transactions
+// of the next block to be sealed, the one after the latest known block, if
+// none arrived for it yet
+func (a *BlockAnnouncer) TransactionsArrived(now time.Time) {
+	next := atomic.LoadUint64(&a.latestKnownHeight)
+	a.firstArrivalMutex.Lock()
+	defer a.firstArrivalMutex.Unlock()
+	if _, ok := a.firstArrival[next]; !ok {
+		a.firstArrival[next] = now
+	}
+}
+
+// sealLatency returns the time from the arrival of the first transactions of
+// block blockNumber to now, false if none were recorded, forgetting the
+// arrivals of the blocks up to blockNumber
+func (a *BlockAnnouncer) sealLatency(blockNumber uint64, now time.Time) (time.Duration, bool) {
+	a.firstArrivalMutex.Lock()
+	defer a.firstArrivalMutex.Unlock()
+	arrival, ok := a.firstArrival[blockNumber]
+	for n := range a.firstArrival {
+		if n <= blockNumber {
+			delete(a.firstArrival, n)
+		}
+	}
+	return now.Sub(arrival), ok
+}
+
+// Received records the block of a CHAIN_NEW_BLOCK_SEALED received from a
+// peer, returning true if it is newer than the latest known one
+func (a *BlockAnnouncer) Received(sealed *pb.BlockSealed) bool {
+	return a.observe(sealed.BlockNumber)
+}
+
+// observe raises the latest known block to blockNumber, returning false if
+// blockNumber was already known
+func (a *BlockAnnouncer) observe(blockNumber uint64) bool {
+	for {
+		known := atomic.LoadUint64(&a.latestKnownHeight)
+		if blockNumber < known {
+			return false
+		}
+		if atomic.CompareAndSwapUint64(&a.latestKnownHeight, known, blockNumber+1) {
+			return true
+		}
+	}
+}
+
+// LatestKnownBlock returns the number of the latest block known to be sealed,
+// false if none is
+func (a *BlockAnnouncer) LatestKnownBlock() (uint64, bool) {
+	height := atomic.LoadUint64(&a.latestKnownHeight)
+	if height == 0 {
+		return 0, false
+	}
+	return height - 1, true
+}
+
+// GetBlockAnnouncer returns the announcer of the blocks sealed by this peer
+func (p *PeerImpl) GetBlockAnnouncer() *BlockAnnouncer {
+	return p.announcer
+}
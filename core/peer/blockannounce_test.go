@@ -0,0 +1,100 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestBlockAnnouncerAnnounce(t *testing.T) {
+	sent := make(chan *pb.Message, 1)
+	self := func() (*pb.PeerEndpoint, error) { return &pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp0"}}, nil }
+	announcer := NewBlockAnnouncer(self, func(msg *pb.Message) []error {
+		sent <- msg
+		return nil
+	})
+	if _, ok := announcer.LatestKnownBlock(); ok {
+		t.Error("Expected no latest known block before any is announced")
+	}
+
+	block := &pb.Block{Transactions: []*pb.Transaction{{Uuid: "tx0"}, {Uuid: "tx1"}}}
+	announcer.Announce(3, block)
+	if latest, ok := announcer.LatestKnownBlock(); !ok || latest != 3 {
+		t.Errorf("Expected latest known block 3, got %d, %t", latest, ok)
+	}
+	select {
+	case msg := <-sent:
+		if msg.Type != pb.Message_CHAIN_NEW_BLOCK_SEALED {
+			t.Fatalf("Expected %s, got %s", pb.Message_CHAIN_NEW_BLOCK_SEALED, msg.Type)
+		}
+		sealed := &pb.BlockSealed{}
+		if err := proto.Unmarshal(msg.Payload, sealed); err != nil {
+			t.Fatalf("Error unmarshalling BlockSealed: %s", err)
+		}
+		hash, _ := block.GetHash()
+		if sealed.BlockNumber != 3 || !bytes.Equal(sealed.BlockHash, hash) || sealed.SealerID.Name != "vp0" || sealed.TotalTransactions != 2 || sealed.Timestamp == nil {
+			t.Errorf("Unexpected announcement %v", sealed)
+		}
+	case <-time.After(50 * time.Millisecond):
+		t.Fatal("Block was not announced within 50ms")
+	}
+}
+
+func TestBlockAnnouncerReceived(t *testing.T) {
+	announcer := NewBlockAnnouncer(nil, nil)
+	if !announcer.Received(&pb.BlockSealed{BlockNumber: 0}) {
+		t.Error("Expected block 0 to be newer than no block")
+	}
+	if !announcer.Received(&pb.BlockSealed{BlockNumber: 5}) {
+		t.Error("Expected block 5 to be newer than block 0")
+	}
+	if announcer.Received(&pb.BlockSealed{BlockNumber: 5}) || announcer.Received(&pb.BlockSealed{BlockNumber: 4}) {
+		t.Error("Expected blocks up to 5 not to be newer than block 5")
+	}
+	if latest, ok := announcer.LatestKnownBlock(); !ok || latest != 5 {
+		t.Errorf("Expected latest known block 5, got %d, %t", latest, ok)
+	}
+}
+
+func TestBlockAnnouncerSealLatency(t *testing.T) {
+	self := func() (*pb.PeerEndpoint, error) { return &pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp0"}}, nil }
+	announcer := NewBlockAnnouncer(self, func(msg *pb.Message) []error { return nil })
+	announcer.Announce(4, &pb.Block{})
+	start := time.Now()
+	announcer.TransactionsArrived(start)
+	announcer.TransactionsArrived(start.Add(time.Second))
+	if latency, ok := announcer.sealLatency(5, start.Add(3*time.Second)); !ok || latency != 3*time.Second {
+		t.Fatalf("Expected block 5 sealed 3s after its first transactions, got %s, %t", latency, ok)
+	}
+	if _, ok := announcer.sealLatency(5, start.Add(4*time.Second)); ok {
+		t.Fatal("Expected the arrival of block 5 to be forgotten once sealed")
+	}
+	announcer.Announce(5, &pb.Block{})
+	announcer.TransactionsArrived(start)
+	if _, ok := announcer.sealLatency(7, start); ok {
+		t.Fatal("Expected no latency for a block no transactions arrived for")
+	}
+	if len(announcer.firstArrival) != 0 {
+		t.Fatalf("Expected the arrivals of earlier blocks to be forgotten, got %v", announcer.firstArrival)
+	}
+}
@@ -0,0 +1,245 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// batchFeature has the blocks served to syncing peers packed in
+// CHAIN_BLOCK_BATCH messages, a block too large for a batch being sent in
+// CHAIN_MESSAGE_FRAGMENT fragments
+const batchFeature = "BATCH"
+
+// maxReassembledBytes bounds the size of a message gathered from fragments
+const maxReassembledBytes = 256 << 20
+
+// messageOverhead is the most bytes a CHAIN_BLOCK_BATCH or a
+// CHAIN_MESSAGE_FRAGMENT adds to the blocks or data it carries
+const messageOverhead = 64
+
+// fieldOverhead is the most bytes the tag and length of a block add to it in a
+// CHAIN_BLOCK_BATCH
+const fieldOverhead = 6
+
+// maxPartialMessages bounds the messages of a Chat being gathered from
+// fragments at once
+const maxPartialMessages = 16
+
+// syncBatchLimits returns the most bytes of blocks and the most blocks of a
+// CHAIN_BLOCK_BATCH, peer.sync.batchMaxBytes and peer.sync.batchMaxCount, 1
+// MiB and 64 blocks by default
+func syncBatchLimits() (maxBytes, maxCount int) {
+	if maxBytes = viper.GetInt("peer.sync.batchMaxBytes"); maxBytes <= 0 {
+		maxBytes = 1 << 20
+	}
+	if maxCount = viper.GetInt("peer.sync.batchMaxCount"); maxCount <= 0 {
+		maxCount = 64
+	}
+	return maxBytes, maxCount
+}
+
+// SyncBlockPacker packs the blocks answering a SYNC_GET_BLOCKS into
+// CHAIN_BLOCK_BATCH messages of up to maxBytes of blocks and maxCount
+// blocks, whichever comes first. A block larger than maxBytes is sent alone,
+// through a FragmentingStream.
+type SyncBlockPacker struct {
+	send          func(*pb.Message) error
+	fragments     *FragmentingStream
+	correlationID uint64
+	maxBytes      int
+	maxCount      int
+	blocks        []*pb.Block
+	size          int
+	first, last   uint64
+}
+
+// NewSyncBlockPacker returns the packer of the blocks of the request of
+// correlationID, sending the batches through send
+func NewSyncBlockPacker(send func(*pb.Message) error, correlationID uint64, maxBytes, maxCount int) *SyncBlockPacker {
+	return &SyncBlockPacker{
+		send:          send,
+		fragments:     NewFragmentingStream(send, maxBytes),
+		correlationID: correlationID,
+		maxBytes:      maxBytes,
+		maxCount:      maxCount,
+	}
+}
+
+// newSyncBlockPacker returns the packer of the limits of
+// peer.sync.batchMaxBytes and peer.sync.batchMaxCount for the blocks served on
+// the Chat, keeping its messages under the size limit negotiated with the
+// remote peer
+func (d *Handler) newSyncBlockPacker(send func(*pb.Message) error, correlationID uint64) *SyncBlockPacker {
+	maxBytes, maxCount := syncBatchLimits()
+	if limit := d.EffectiveMaxMessageSize(); limit > 0 && limit-messageOverhead < maxBytes {
+		maxBytes = limit - messageOverhead
+	}
+	return NewSyncBlockPacker(send, correlationID, maxBytes, maxCount)
+}
+
+// Add packs block blockNumber, first sending the batch it does not fit in.
+// The blocks are sent in the order they are added.
+func (p *SyncBlockPacker) Add(blockNumber uint64, block *pb.Block) error {
+	size := proto.Size(block) + fieldOverhead
+	if len(p.blocks) > 0 && (len(p.blocks) >= p.maxCount || p.size+size > p.maxBytes) {
+		if err := p.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(p.blocks) == 0 {
+		p.first = blockNumber
+	}
+	p.blocks = append(p.blocks, block)
+	p.size += size
+	p.last = blockNumber
+	if size > p.maxBytes {
+		return p.Flush()
+	}
+	return nil
+}
+
+// Flush sends the blocks packed, if any
+func (p *SyncBlockPacker) Flush() error {
+	if len(p.blocks) == 0 {
+		return nil
+	}
+	batch := &pb.BlockBatch{Range: &pb.SyncBlockRange{Start: p.first, End: p.last, CorrelationId: p.correlationID}, Blocks: p.blocks}
+	oversized := p.size > p.maxBytes
+	p.blocks, p.size = nil, 0
+	data, err := proto.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("Error marshalling BlockBatch: %s", err)
+	}
+	msg := &pb.Message{Type: pb.Message_CHAIN_BLOCK_BATCH, Payload: data}
+	if oversized {
+		return p.fragments.Send(msg)
+	}
+	return p.send(msg)
+}
+
+// unpackBlockBatch returns the BlockBatch of a CHAIN_BLOCK_BATCH
+func unpackBlockBatch(msg *pb.Message) (*pb.BlockBatch, error) {
+	if msg.Type != pb.Message_CHAIN_BLOCK_BATCH {
+		return nil, fmt.Errorf("Expected a %s, got %s", pb.Message_CHAIN_BLOCK_BATCH, msg.Type)
+	}
+	batch := &pb.BlockBatch{}
+	if err := proto.Unmarshal(msg.Payload, batch); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling BlockBatch: %s", err)
+	}
+	if batch.Range == nil {
+		return nil, fmt.Errorf("%s without range", pb.Message_CHAIN_BLOCK_BATCH)
+	}
+	return batch, nil
+}
+
+// UnpackBlockBatch returns the blocks of a CHAIN_BLOCK_BATCH, in the order
+// they were sent
+func UnpackBlockBatch(msg *pb.Message) ([]*pb.Block, error) {
+	batch, err := unpackBlockBatch(msg)
+	if err != nil {
+		return nil, err
+	}
+	return batch.Blocks, nil
+}
+
+// lastFragmentID is the fragmentId of the last message sent in fragments
+var lastFragmentID uint64
+
+// FragmentingStream sends the messages larger than maxBytes in
+// CHAIN_MESSAGE_FRAGMENT fragments of up to maxBytes of the marshalled
+// message, the others as they are. A maxBytes of 0 sends every message as it
+// is.
+type FragmentingStream struct {
+	send     func(*pb.Message) error
+	maxBytes int
+}
+
+// NewFragmentingStream returns the stream sending through send
+func NewFragmentingStream(send func(*pb.Message) error, maxBytes int) *FragmentingStream {
+	return &FragmentingStream{send: send, maxBytes: maxBytes}
+}
+
+// Send sends msg, in fragments if larger than maxBytes
+func (s *FragmentingStream) Send(msg *pb.Message) error {
+	if s.maxBytes <= 0 || proto.Size(msg) <= s.maxBytes {
+		return s.send(msg)
+	}
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("Error marshalling %s: %s", msg.Type, err)
+	}
+	id := atomic.AddUint64(&lastFragmentID, 1)
+	for len(data) > 0 {
+		n := len(data)
+		if n > s.maxBytes {
+			n = s.maxBytes
+		}
+		payload, err := proto.Marshal(&pb.MessageFragment{FragmentId: id, Data: data[:n], More: n < len(data)})
+		if err != nil {
+			return fmt.Errorf("Error marshalling MessageFragment: %s", err)
+		}
+		if err := s.send(&pb.Message{Type: pb.Message_CHAIN_MESSAGE_FRAGMENT, Payload: payload}); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// fragmentReassembler gathers the CHAIN_MESSAGE_FRAGMENT fragments received
+// on a Chat into the messages they carry
+type fragmentReassembler struct {
+	sync.Mutex
+	partial map[uint64][]byte
+}
+
+// add appends the fragment to its message, returning the message once its
+// last fragment is added, nil before
+func (r *fragmentReassembler) add(fragment *pb.MessageFragment) (*pb.Message, error) {
+	r.Lock()
+	defer r.Unlock()
+	if r.partial == nil {
+		r.partial = make(map[uint64][]byte)
+	}
+	data, ok := r.partial[fragment.FragmentId]
+	if !ok && len(r.partial) >= maxPartialMessages {
+		return nil, fmt.Errorf("Already gathering %d messages from fragments", len(r.partial))
+	}
+	if len(data)+len(fragment.Data) > maxReassembledBytes {
+		delete(r.partial, fragment.FragmentId)
+		return nil, fmt.Errorf("Message %d of fragments over %d bytes", fragment.FragmentId, maxReassembledBytes)
+	}
+	data = append(data, fragment.Data...)
+	if fragment.More {
+		r.partial[fragment.FragmentId] = data
+		return nil, nil
+	}
+	delete(r.partial, fragment.FragmentId)
+	msg := &pb.Message{}
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling the message of fragments %d: %s", fragment.FragmentId, err)
+	}
+	return msg, nil
+}
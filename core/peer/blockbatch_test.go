@@ -0,0 +1,135 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// testBlock returns a block of a transaction of a payload of size bytes
+func testBlock(size int) *pb.Block {
+	return &pb.Block{Transactions: []*pb.Transaction{{Payload: bytes.Repeat([]byte{1}, size)}}}
+}
+
+// receiveBlockBatches returns the blocks of the CHAIN_BLOCK_BATCH messages
+// sent, gathering those sent in fragments, with the number of messages
+func receiveBlockBatches(t *testing.T, sent []*pb.Message) ([]*pb.BlockBatch, int) {
+	var batches []*pb.BlockBatch
+	var fragments fragmentReassembler
+	for _, msg := range sent {
+		if msg.Type == pb.Message_CHAIN_MESSAGE_FRAGMENT {
+			fragment := &pb.MessageFragment{}
+			if err := proto.Unmarshal(msg.Payload, fragment); err != nil {
+				t.Fatal(err)
+			}
+			reassembled, err := fragments.add(fragment)
+			if err != nil {
+				t.Fatalf("Error gathering fragments: %s", err)
+			}
+			if reassembled == nil {
+				continue
+			}
+			msg = reassembled
+		}
+		batch, err := unpackBlockBatch(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		batches = append(batches, batch)
+	}
+	return batches, len(sent)
+}
+
+func TestSyncBlockPacker(t *testing.T) {
+	var sent []*pb.Message
+	send := func(msg *pb.Message) error {
+		sent = append(sent, msg)
+		return nil
+	}
+	packer := NewSyncBlockPacker(send, 7, 1000, 3)
+	sizes := []int{10, 10, 10, 10, 600, 600, 2500, 10}
+	for i, size := range sizes {
+		if err := packer.Add(uint64(20-i), testBlock(size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := packer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range sent {
+		if len(msg.Payload) > 1000+messageOverhead {
+			t.Errorf("Expected messages of at most %d bytes, got a %s of %d", 1000+messageOverhead, msg.Type, len(msg.Payload))
+		}
+	}
+
+	batches, _ := receiveBlockBatches(t, sent)
+	// 3 blocks by count, 2 blocks by bytes, 1 block by bytes, the large
+	// block alone, then the last one
+	expected := [][2]uint64{{20, 18}, {17, 16}, {15, 15}, {14, 14}, {13, 13}}
+	if len(batches) != len(expected) {
+		t.Fatalf("Expected %d batches, got %d", len(expected), len(batches))
+	}
+	var received []int
+	for i, batch := range batches {
+		if batch.Range.Start != expected[i][0] || batch.Range.End != expected[i][1] || batch.Range.CorrelationId != 7 {
+			t.Errorf("Expected batch %d of blocks %d to %d, got %v", i, expected[i][0], expected[i][1], batch.Range)
+		}
+		for _, block := range batch.Blocks {
+			received = append(received, len(block.Transactions[0].Payload))
+		}
+	}
+	if len(received) != len(sizes) || received[6] != 2500 {
+		t.Fatalf("Expected the blocks in order, got blocks of %v", received)
+	}
+}
+
+func TestUnpackBlockBatch(t *testing.T) {
+	data, _ := proto.Marshal(&pb.BlockBatch{Range: &pb.SyncBlockRange{Start: 1, End: 2}, Blocks: []*pb.Block{testBlock(1), testBlock(2)}})
+	blocks, err := UnpackBlockBatch(&pb.Message{Type: pb.Message_CHAIN_BLOCK_BATCH, Payload: data})
+	if err != nil || len(blocks) != 2 || len(blocks[1].Transactions[0].Payload) != 2 {
+		t.Fatalf("Expected the 2 blocks of the batch, got %v, %v", blocks, err)
+	}
+	if _, err := UnpackBlockBatch(&pb.Message{Type: pb.Message_SYNC_BLOCKS, Payload: data}); err == nil {
+		t.Error("Expected a message other than a CHAIN_BLOCK_BATCH to be refused")
+	}
+}
+
+func TestFragmentReassemblerBounded(t *testing.T) {
+	var fragments fragmentReassembler
+	for id := uint64(0); id < maxPartialMessages; id++ {
+		if _, err := fragments.add(&pb.MessageFragment{FragmentId: id, Data: []byte{1}, More: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := fragments.add(&pb.MessageFragment{FragmentId: maxPartialMessages, Data: []byte{1}, More: true}); err == nil {
+		t.Error("Expected a message past the partial messages gathered at once to be refused")
+	}
+	if _, err := fragments.add(&pb.MessageFragment{FragmentId: 0, Data: make([]byte, maxReassembledBytes), More: true}); err == nil {
+		t.Error("Expected a message over the size bound to be refused")
+	}
+	if _, err := fragments.add(&pb.MessageFragment{FragmentId: 1, Data: []byte{0xff}}); err == nil {
+		t.Error("Expected fragments of an invalid message to be refused")
+	}
+	if len(fragments.partial) != maxPartialMessages-2 {
+		t.Errorf("Expected the refused messages to be forgotten, got %d partial", len(fragments.partial))
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// BlockEventBusAccessor interface enables a Peer to hand out its BlockEventBus
+type BlockEventBusAccessor interface {
+	GetBlockEventBus() *BlockEventBus
+}
+
+// BlockEventBus notifies its subscribers whenever a block is added to the ledger
+type BlockEventBus struct {
+	sync.Mutex
+	subscribers map[chan struct{}]struct{}
+}
+
+// NewBlockEventBus returns a BlockEventBus without subscribers
+func NewBlockEventBus() *BlockEventBus {
+	return &BlockEventBus{subscribers: make(map[chan struct{}]struct{})}
+}
+
+// Subscribe returns a channel receiving a value after blocks were added.
+// Notifications are coalesced, a slow subscriber never blocks Publish.
+func (b *BlockEventBus) Subscribe() chan struct{} {
+	b.Lock()
+	defer b.Unlock()
+	notify := make(chan struct{}, 1)
+	b.subscribers[notify] = struct{}{}
+	return notify
+}
+
+// Unsubscribe stops the notifications sent on the channel returned by Subscribe
+func (b *BlockEventBus) Unsubscribe(notify chan struct{}) {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.subscribers, notify)
+}
+
+// Publish notifies the subscribers that block blockNumber was added
+func (b *BlockEventBus) Publish(blockNumber uint64) {
+	b.Lock()
+	defer b.Unlock()
+	peerLogger.Debugf("Notifying %d subscribers of block %d", len(b.subscribers), blockNumber)
+	for notify := range b.subscribers {
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// blockSubscriptions are the block subscriptions of a Chat, by subscriptionID
+type blockSubscriptions struct {
+	sync.Mutex
+	stop map[string]chan struct{}
+}
+
+func newBlockSubscriptions() *blockSubscriptions {
+	return &blockSubscriptions{stop: make(map[string]chan struct{})}
+}
+
+// streamBlocks sends a CHAIN_BLOCK with every block from fromBlock on until stop is closed
+func streamBlocks(blockchain BlockChainAccessor, bus *BlockEventBus, send func(*pb.Message) error, subscriptionID string, fromBlock uint64, stop chan struct{}) {
+	notify := bus.Subscribe()
+	defer bus.Unsubscribe(notify)
+	next := fromBlock
+	for {
+		for height := blockchain.GetBlockchainSize(); next < height; next++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := sendSubscribedBlock(blockchain, send, subscriptionID, next); err != nil {
+				peerLogger.Errorf("Ending block subscription %s: %s", subscriptionID, err)
+				return
+			}
+		}
+		select {
+		case <-notify:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func sendSubscribedBlock(blockchain BlockChainAccessor, send func(*pb.Message) error, subscriptionID string, blockNumber uint64) error {
+	block, err := blockchain.GetBlockByNumber(blockNumber)
+	if err != nil {
+		return fmt.Errorf("Error getting block %d: %s", blockNumber, err)
+	}
+	auditProof, err := blockAuditProof(blockchain, blockNumber)
+	if err != nil {
+		peerLogger.Errorf("Error building the audit proof of block %d: %s", blockNumber, err)
+	}
+	data, err := proto.Marshal(&pb.SubscribedBlock{SubscriptionID: subscriptionID, BlockNumber: blockNumber, Block: block, AuditProof: auditProof})
+	if err != nil {
+		return fmt.Errorf("Error marshalling SubscribedBlock: %s", err)
+	}
+	return send(&pb.Message{Type: pb.Message_CHAIN_BLOCK, Payload: data})
+}
+
+// subscribe starts streaming blocks for the subscription, replacing a subscription with the same ID
+func (s *blockSubscriptions) subscribe(blockchain BlockChainAccessor, bus *BlockEventBus, send func(*pb.Message) error, subscription *pb.BlockSubscription) {
+	s.Lock()
+	defer s.Unlock()
+	if stop, ok := s.stop[subscription.SubscriptionID]; ok {
+		close(stop)
+	}
+	stop := make(chan struct{})
+	s.stop[subscription.SubscriptionID] = stop
+	go streamBlocks(blockchain, bus, send, subscription.SubscriptionID, subscription.FromBlock, stop)
+}
+
+// unsubscribe stops the subscription, returning false if there is none with that ID
+func (s *blockSubscriptions) unsubscribe(subscriptionID string) bool {
+	s.Lock()
+	defer s.Unlock()
+	stop, ok := s.stop[subscriptionID]
+	if ok {
+		close(stop)
+		delete(s.stop, subscriptionID)
+	}
+	return ok
+}
+
+// unsubscribeAll stops all subscriptions
+func (s *blockSubscriptions) unsubscribeAll() {
+	s.Lock()
+	defer s.Unlock()
+	for subscriptionID, stop := range s.stop {
+		close(stop)
+		delete(s.stop, subscriptionID)
+	}
+}
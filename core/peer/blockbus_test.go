@@ -0,0 +1,138 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// testBlockchain is a BlockChainAccessor over blocks appended by the test
+type testBlockchain struct {
+	sync.Mutex
+	blocks []*pb.Block
+}
+
+func (c *testBlockchain) append(bus *BlockEventBus, block *pb.Block) {
+	c.Lock()
+	c.blocks = append(c.blocks, block)
+	n := uint64(len(c.blocks))
+	c.Unlock()
+	bus.Publish(n - 1)
+}
+
+func (c *testBlockchain) GetBlockByNumber(blockNumber uint64) (*pb.Block, error) {
+	c.Lock()
+	defer c.Unlock()
+	if blockNumber >= uint64(len(c.blocks)) {
+		return nil, fmt.Errorf("No block %d", blockNumber)
+	}
+	return c.blocks[blockNumber], nil
+}
+
+func (c *testBlockchain) GetBlockchainSize() uint64 {
+	c.Lock()
+	defer c.Unlock()
+	return uint64(len(c.blocks))
+}
+
+func (c *testBlockchain) GetCurrentStateHash() ([]byte, error) {
+	return nil, nil
+}
+
+func receiveSubscribedBlock(t *testing.T, sent chan *pb.Message) *pb.SubscribedBlock {
+	select {
+	case msg := <-sent:
+		if msg.Type != pb.Message_CHAIN_BLOCK {
+			t.Fatalf("Expected CHAIN_BLOCK, got %s", msg.Type)
+		}
+		block := &pb.SubscribedBlock{}
+		if err := proto.Unmarshal(msg.Payload, block); err != nil {
+			t.Fatalf("Error unmarshalling SubscribedBlock: %s", err)
+		}
+		return block
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for CHAIN_BLOCK")
+	}
+	return nil
+}
+
+func TestBlockSubscriptions(t *testing.T) {
+	bus := NewBlockEventBus()
+	blockchain := &testBlockchain{}
+	blockchain.append(bus, &pb.Block{PreviousBlockHash: []byte("0")})
+	blockchain.append(bus, &pb.Block{PreviousBlockHash: []byte("1")})
+
+	sent := make(chan *pb.Message, 10)
+	send := func(msg *pb.Message) error {
+		sent <- msg
+		return nil
+	}
+	subscriptions := newBlockSubscriptions()
+	subscriptions.subscribe(blockchain, bus, send, &pb.BlockSubscription{SubscriptionID: "a", FromBlock: 1})
+	if block := receiveSubscribedBlock(t, sent); block.SubscriptionID != "a" || block.BlockNumber != 1 || string(block.Block.PreviousBlockHash) != "1" {
+		t.Fatalf("Unexpected block sent: %v", block)
+	}
+	subscriptions.subscribe(blockchain, bus, send, &pb.BlockSubscription{SubscriptionID: "b", FromBlock: 2})
+
+	blockchain.append(bus, &pb.Block{PreviousBlockHash: []byte("2")})
+	received := make(map[string]uint64)
+	for i := 0; i < 2; i++ {
+		block := receiveSubscribedBlock(t, sent)
+		received[block.SubscriptionID] = block.BlockNumber
+	}
+	if received["a"] != 2 || received["b"] != 2 {
+		t.Fatalf("Expected block 2 for both subscriptions, got %v", received)
+	}
+
+	if !subscriptions.unsubscribe("a") {
+		t.Fatal("Expected subscription a to be cancelled")
+	}
+	if subscriptions.unsubscribe("a") {
+		t.Fatal("Expected no subscription a after cancelling it")
+	}
+	blockchain.append(bus, &pb.Block{PreviousBlockHash: []byte("3")})
+	if block := receiveSubscribedBlock(t, sent); block.SubscriptionID != "b" || block.BlockNumber != 3 {
+		t.Fatalf("Unexpected block sent: %v", block)
+	}
+
+	subscriptions.unsubscribeAll()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		bus.Lock()
+		n := len(bus.subscribers)
+		bus.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected all subscriptions to leave the bus, %d remain", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case msg := <-sent:
+		t.Fatalf("Unexpected message after unsubscribing: %s", msg.Type)
+	default:
+	}
+}
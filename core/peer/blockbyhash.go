@@ -0,0 +1,79 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// FetchBlockByHash asks the peer at address for the block hashing to hash,
+// e.g. a fork block known only by the hash its successor points to, and
+// returns it with its number. A *BlockNotFoundError is returned if the peer
+// has no such block.
+func FetchBlockByHash(address string, hash []byte) (block *pb.Block, blockNumber uint64, err error) {
+	err = withRequestStream(address, func(stream ChatStream) error {
+		block, blockNumber, err = fetchBlockByHashOverStream(stream, hash)
+		return err
+	})
+	if _, ok := err.(*BlockNotFoundError); ok {
+		return nil, 0, &BlockNotFoundError{Hash: hash, Address: address}
+	} else if err != nil {
+		return nil, 0, fmt.Errorf("Error fetching block %x from %s: %s", hash, address, err)
+	}
+	return block, blockNumber, nil
+}
+
+func fetchBlockByHashOverStream(stream ChatStream, hash []byte) (*pb.Block, uint64, error) {
+	data, err := proto.Marshal(&pb.GetBlockByHash{Hash: hash})
+	if err != nil {
+		return nil, 0, fmt.Errorf("Error marshalling GetBlockByHash: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_GET_BLOCK_BY_HASH, Payload: data, Timestamp: util.CreateUtcTimestamp()}
+	if err := stream.Send(request); err != nil {
+		return nil, 0, fmt.Errorf("Error sending %s: %s", request.Type, err)
+	}
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return nil, 0, fmt.Errorf("Error waiting for %s: %s", pb.Message_CHAIN_BLOCK, err)
+		}
+		switch msg.Type {
+		case pb.Message_CHAIN_BLOCK:
+			response := &pb.SubscribedBlock{}
+			if err := proto.Unmarshal(msg.Payload, response); err != nil {
+				return nil, 0, fmt.Errorf("Error unmarshalling SubscribedBlock: %s", err)
+			}
+			// Blocks of a subscription sharing the stream are not the reply
+			if response.SubscriptionID == "" {
+				return response.Block, response.BlockNumber, nil
+			}
+		case pb.Message_CHAIN_BLOCK_NOT_FOUND:
+			return nil, 0, &BlockNotFoundError{Hash: hash}
+		case pb.Message_RESPONSE:
+			response := &pb.Response{}
+			if err := proto.Unmarshal(msg.Payload, response); err == nil && response.Status == pb.Response_FAILURE {
+				return nil, 0, fmt.Errorf("Error response to %s: %s", request.Type, response.Msg)
+			}
+		}
+		peerLogger.Debugf("Ignoring %s while waiting for %s", msg.Type, pb.Message_CHAIN_BLOCK)
+	}
+}
@@ -0,0 +1,59 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestFetchBlockByHashOverStream(t *testing.T) {
+	stream := &handshakeStream{recv: make(chan *pb.Message, 2), sent: make(chan *pb.Message, 1)}
+	subscribed, _ := proto.Marshal(&pb.SubscribedBlock{SubscriptionID: "sub1", BlockNumber: 7, Block: &pb.Block{}})
+	data, _ := proto.Marshal(&pb.SubscribedBlock{BlockNumber: 3, Block: &pb.Block{PreviousBlockHash: []byte("parent")}})
+	stream.recv <- &pb.Message{Type: pb.Message_CHAIN_BLOCK, Payload: subscribed}
+	stream.recv <- &pb.Message{Type: pb.Message_CHAIN_BLOCK, Payload: data}
+	block, blockNumber, err := fetchBlockByHashOverStream(stream, []byte("hash"))
+	if err != nil || blockNumber != 3 || !bytes.Equal(block.PreviousBlockHash, []byte("parent")) {
+		t.Fatalf("Expected block 3, got %d, %v", blockNumber, err)
+	}
+	request := &pb.GetBlockByHash{}
+	if msg := <-stream.sent; msg.Type != pb.Message_CHAIN_GET_BLOCK_BY_HASH || proto.Unmarshal(msg.Payload, request) != nil || !bytes.Equal(request.Hash, []byte("hash")) {
+		t.Errorf("Expected a CHAIN_GET_BLOCK_BY_HASH for the hash, got %s", msg.Type)
+	}
+}
+
+func TestFetchBlockByHashNotFound(t *testing.T) {
+	stream := &handshakeStream{recv: make(chan *pb.Message, 1), sent: make(chan *pb.Message, 2)}
+	stream.recv <- &pb.Message{Type: pb.Message_CHAIN_BLOCK_NOT_FOUND}
+	if _, _, err := fetchBlockByHashOverStream(stream, []byte("hash")); err == nil {
+		t.Fatal("Expected an error for a block not found")
+	} else if _, ok := err.(*BlockNotFoundError); !ok {
+		t.Errorf("Expected a BlockNotFoundError, got %s", err)
+	}
+	data, _ := proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte("internal")})
+	stream.recv <- &pb.Message{Type: pb.Message_RESPONSE, Payload: data}
+	if _, _, err := fetchBlockByHashOverStream(stream, []byte("hash")); err == nil {
+		t.Fatal("Expected an error for a failure response")
+	} else if _, ok := err.(*BlockNotFoundError); ok {
+		t.Errorf("Expected an internal error to be distinct from a block not found, got %s", err)
+	}
+}
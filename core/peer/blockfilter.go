@@ -0,0 +1,103 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// FilterBlock returns a copy of the block with only the transactions whose
+// type name, e.g. CHAINCODE_DEPLOY, is one of types. The copy is partial, its
+// state hash cleared, unless every transaction matched. No types returns the
+// block itself.
+func FilterBlock(block *pb.Block, types []string) *pb.Block {
+	if len(types) == 0 {
+		return block
+	}
+	filtered := *block
+	filtered.Transactions = nil
+	for _, tx := range block.Transactions {
+		for _, txType := range types {
+			if tx.Type.String() == txType {
+				filtered.Transactions = append(filtered.Transactions, tx)
+				break
+			}
+		}
+	}
+	if len(filtered.Transactions) < len(block.Transactions) {
+		filtered.Partial = true
+		filtered.StateHash = nil
+	}
+	return &filtered
+}
+
+// validateTxTypeFilter returns an error if one of the types is not the name of a Transaction_Type
+func validateTxTypeFilter(types []string) error {
+	for _, txType := range types {
+		if _, ok := pb.Transaction_Type_value[txType]; !ok {
+			return fmt.Errorf("Unknown transaction type %q", txType)
+		}
+	}
+	return nil
+}
+
+// sendChainSync answers a CHAIN_SYNC_REQUEST as sendBlockRange does a
+// CHAIN_QUERY_RANGE, the blocks being filtered by the txTypeFilter of the
+// request. Partial blocks are sent without audit proof, as they do not hash to
+// the leaf of their checkpoint.
+func sendChainSync(blockchain BlockChainAccessor, send func(*pb.Message) error, request *pb.ChainSyncRequest, limit uint32) error {
+	return sendBlocksInRange(blockchain, send, request.FromBlock, request.ToBlock, limit, func(blockNumber uint64) error {
+		block, err := blockchain.GetBlockByNumber(blockNumber)
+		if err != nil {
+			return fmt.Errorf("Error getting block %d: %s", blockNumber, err)
+		}
+		filtered := FilterBlock(block, request.TxTypeFilter)
+		if !filtered.Partial {
+			return sendSubscribedBlock(blockchain, send, "", blockNumber)
+		}
+		data, err := proto.Marshal(&pb.SubscribedBlock{BlockNumber: blockNumber, Block: filtered})
+		if err != nil {
+			return fmt.Errorf("Error marshalling SubscribedBlock: %s", err)
+		}
+		return send(&pb.Message{Type: pb.Message_CHAIN_BLOCK, Payload: data})
+	})
+}
+
+// FetchFilteredBlocks asks the peer at address for the blocks from to to
+// included with only the transactions of the types, issuing a
+// CHAIN_SYNC_REQUEST for every page of blocks the peer limits its replies to
+func FetchFilteredBlocks(address string, from, to uint64, types []string) (blocks []*pb.Block, err error) {
+	err = withRequestStream(address, func(stream ChatStream) error {
+		blocks, err = fetchBlockPagesOverStream(stream, from, to, func(next uint64) (*pb.Message, error) {
+			data, err := proto.Marshal(&pb.ChainSyncRequest{FromBlock: next, ToBlock: to, TxTypeFilter: types})
+			if err != nil {
+				return nil, fmt.Errorf("Error marshalling ChainSyncRequest: %s", err)
+			}
+			return &pb.Message{Type: pb.Message_CHAIN_SYNC_REQUEST, Payload: data, Timestamp: util.CreateUtcTimestamp()}, nil
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching blocks %d to %d with transactions of types %v from %s: %s", from, to, types, address, err)
+	}
+	return blocks, nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func mixedBlock() *pb.Block {
+	return &pb.Block{StateHash: []byte("state"), Transactions: []*pb.Transaction{
+		{Uuid: "deploy", Type: pb.Transaction_CHAINCODE_DEPLOY},
+		{Uuid: "invoke1", Type: pb.Transaction_CHAINCODE_INVOKE},
+		{Uuid: "invoke2", Type: pb.Transaction_CHAINCODE_INVOKE},
+	}}
+}
+
+func TestFilterBlock(t *testing.T) {
+	block := mixedBlock()
+	filtered := FilterBlock(block, []string{"CHAINCODE_INVOKE"})
+	if txIDs(filtered.Transactions) != "[invoke1 invoke2]" || !filtered.Partial || filtered.StateHash != nil {
+		t.Fatalf("Expected a partial block with the invocations only, got %v", filtered)
+	}
+	if len(block.Transactions) != 3 || block.Partial || block.StateHash == nil {
+		t.Fatalf("Expected the block to be left as is, got %v", block)
+	}
+	if filtered := FilterBlock(block, []string{"CHAINCODE_INVOKE", "CHAINCODE_DEPLOY"}); filtered.Partial || len(filtered.Transactions) != 3 {
+		t.Fatalf("Expected every transaction to match without the block being partial, got %v", filtered)
+	}
+	if filtered := FilterBlock(block, nil); filtered != block {
+		t.Fatal("Expected no filter to return the block itself")
+	}
+}
+
+func TestValidateTxTypeFilter(t *testing.T) {
+	if err := validateTxTypeFilter([]string{"CHAINCODE_DEPLOY", "CHAINCODE_QUERY"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateTxTypeFilter([]string{"deploy"}); err == nil {
+		t.Fatal("Expected an unknown transaction type to be rejected")
+	}
+}
+
+func TestFetchFilteredBlockPages(t *testing.T) {
+	blockchain := &testBlockchain{}
+	bus := NewBlockEventBus()
+	for i := 0; i < 5; i++ {
+		blockchain.append(bus, mixedBlock())
+	}
+
+	// Serve the CHAIN_SYNC_REQUEST requests 2 blocks at a time
+	stream := &handshakeStream{recv: make(chan *pb.Message, 10), sent: make(chan *pb.Message)}
+	go func() {
+		defer close(stream.recv)
+		for msg := range stream.sent {
+			request := &pb.ChainSyncRequest{}
+			if err := proto.Unmarshal(msg.Payload, request); err != nil {
+				t.Errorf("Error unmarshalling ChainSyncRequest: %s", err)
+				return
+			}
+			send := func(reply *pb.Message) error {
+				stream.recv <- reply
+				return nil
+			}
+			if err := sendChainSync(blockchain, send, request, 2); err != nil {
+				t.Errorf("Error sending filtered blocks: %s", err)
+				return
+			}
+		}
+	}()
+
+	blocks, err := fetchBlockPagesOverStream(stream, 1, 4, func(next uint64) (*pb.Message, error) {
+		data, err := proto.Marshal(&pb.ChainSyncRequest{FromBlock: next, ToBlock: 4, TxTypeFilter: []string{"CHAINCODE_DEPLOY"}})
+		return &pb.Message{Type: pb.Message_CHAIN_SYNC_REQUEST, Payload: data}, err
+	})
+	close(stream.sent)
+	if err != nil {
+		t.Fatalf("Error fetching filtered blocks: %s", err)
+	}
+	if len(blocks) != 4 {
+		t.Fatalf("Expected blocks 1 to 4, got %d blocks", len(blocks))
+	}
+	for i, block := range blocks {
+		if txIDs(block.Transactions) != "[deploy]" || !block.Partial {
+			t.Errorf("Expected block %d to be partial with the deployment only, got %v", i+1, block)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// headerCacheSize is the most block headers kept by FetchBlockFromPeer
+const headerCacheSize = 1000
+
+// BlockHeaderReader interface enables a Peer to answer CHAIN_GET_BLOCK_HEADER
+// and CHAIN_GET_BLOCK_BODY messages
+type BlockHeaderReader interface {
+	GetBlockHeader(blockNumber uint64) (*pb.BlockHeader, error)
+	GetBlockBody(blockNumber uint64) (*pb.BlockBody, error)
+}
+
+// newBlockHeader returns the header of block blockNumber
+func newBlockHeader(blockNumber uint64, block *pb.Block) (*pb.BlockHeader, error) {
+	hash, err := block.GetHash()
+	if err != nil {
+		return nil, fmt.Errorf("Error hashing block %d: %s", blockNumber, err)
+	}
+	header := &pb.BlockHeader{
+		BlockNumber:  blockNumber,
+		Hash:         hash,
+		PreviousHash: block.PreviousBlockHash,
+		StateHash:    block.StateHash,
+		Timestamp:    block.Timestamp,
+		TxCount:      uint32(len(block.Transactions)),
+	}
+	if len(block.Transactions) > 0 {
+		levels, err := transactionsMerkleTree(block.Transactions)
+		if err != nil {
+			return nil, err
+		}
+		header.MerkleRoot = levels[len(levels)-1][0]
+	}
+	if votes := blockVotes(block.ConsensusMetadata); votes != nil {
+		header.ValidatorVotes = votes.Votes
+		header.VoteRound = votes.Round
+		header.VotedHash = votes.BlockHash
+	}
+	return header, nil
+}
+
+// FetchBlockHeaderFromPeer asks the peer at address for the header of block blockNumber
+func FetchBlockHeaderFromPeer(address string, blockNumber uint64) (*pb.BlockHeader, error) {
+	data, err := proto.Marshal(&pb.GetBlockHeader{BlockNumber: blockNumber})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling GetBlockHeader: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_GET_BLOCK_HEADER, Payload: data}
+	reply, err := requestOverChat(address, request, pb.Message_CHAIN_BLOCK_HEADER)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting header of block %d from %s: %s", blockNumber, address, err)
+	}
+	header := &pb.BlockHeader{}
+	if err := proto.Unmarshal(reply.Payload, header); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling BlockHeader: %s", err)
+	}
+	return header, nil
+}
+
+// newBlockBody returns the body of block blockNumber
+func newBlockBody(blockNumber uint64, block *pb.Block) *pb.BlockBody {
+	return &pb.BlockBody{
+		BlockNumber:       blockNumber,
+		Transactions:      block.Transactions,
+		Version:           block.Version,
+		ConsensusMetadata: block.ConsensusMetadata,
+	}
+}
+
+// assembleBlock returns the block of the header and body, an error if it does
+// not hash to the hash of the header
+func assembleBlock(header *pb.BlockHeader, body *pb.BlockBody) (*pb.Block, error) {
+	if header.BlockNumber != body.BlockNumber {
+		return nil, fmt.Errorf("Body of block %d does not match header of block %d", body.BlockNumber, header.BlockNumber)
+	}
+	block := &pb.Block{
+		Version:           body.Version,
+		Timestamp:         header.Timestamp,
+		Transactions:      body.Transactions,
+		StateHash:         header.StateHash,
+		PreviousBlockHash: header.PreviousHash,
+		ConsensusMetadata: body.ConsensusMetadata,
+	}
+	hash, err := block.GetHash()
+	if err != nil {
+		return nil, fmt.Errorf("Error hashing block %d: %s", header.BlockNumber, err)
+	}
+	if !bytes.Equal(hash, header.Hash) {
+		return nil, fmt.Errorf("Block %d hashes to %x instead of %x", header.BlockNumber, hash, header.Hash)
+	}
+	return block, nil
+}
+
+// FetchBlockBodyFromPeer asks the peer at address for the body of block blockNumber
+func FetchBlockBodyFromPeer(address string, blockNumber uint64) (*pb.BlockBody, error) {
+	data, err := proto.Marshal(&pb.GetBlockBody{BlockNumber: blockNumber})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling GetBlockBody: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_GET_BLOCK_BODY, Payload: data}
+	reply, err := requestOverChat(address, request, pb.Message_CHAIN_BLOCK_BODY)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting body of block %d from %s: %s", blockNumber, address, err)
+	}
+	body := &pb.BlockBody{}
+	if err := proto.Unmarshal(reply.Payload, body); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling BlockBody: %s", err)
+	}
+	return body, nil
+}
+
+// headerKey identifies a block header fetched from a peer
+type headerKey struct {
+	address     string
+	blockNumber uint64
+}
+
+// headerCache keeps the last size block headers put, evicting the oldest first
+type headerCache struct {
+	sync.Mutex
+	size    int
+	headers map[headerKey]*pb.BlockHeader
+	order   []headerKey
+}
+
+func newHeaderCache(size int) *headerCache {
+	return &headerCache{size: size, headers: make(map[headerKey]*pb.BlockHeader)}
+}
+
+func (c *headerCache) get(key headerKey) (*pb.BlockHeader, bool) {
+	c.Lock()
+	defer c.Unlock()
+	header, ok := c.headers[key]
+	return header, ok
+}
+
+func (c *headerCache) put(key headerKey, header *pb.BlockHeader) {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.headers[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.headers[key] = header
+	for len(c.order) > c.size {
+		delete(c.headers, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+var fetchedHeaders = newHeaderCache(headerCacheSize)
+
+// FetchBlockFromPeer asks the peer at address for the header of block
+// blockNumber, unless fetched before, then for its body, and returns the block
+// reassembled from both once checked against the hash of the header
+func FetchBlockFromPeer(address string, blockNumber uint64) (*pb.Block, error) {
+	key := headerKey{address: address, blockNumber: blockNumber}
+	header, ok := fetchedHeaders.get(key)
+	if !ok {
+		var err error
+		if header, err = FetchBlockHeaderFromPeer(address, blockNumber); err != nil {
+			return nil, err
+		}
+		fetchedHeaders.put(key, header)
+	}
+	body, err := FetchBlockBodyFromPeer(address, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	return assembleBlock(header, body)
+}
@@ -0,0 +1,94 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestNewBlockHeader(t *testing.T) {
+	transactions := newTestTransactions(3)
+	block := &pb.Block{Transactions: transactions, StateHash: []byte("state"), PreviousBlockHash: []byte("previous")}
+	header, err := newBlockHeader(4, block)
+	if err != nil {
+		t.Fatalf("Error creating block header: %s", err)
+	}
+	hash, err := block.GetHash()
+	if err != nil {
+		t.Fatalf("Error hashing block: %s", err)
+	}
+	if header.BlockNumber != 4 || header.TxCount != 3 || !bytes.Equal(header.Hash, hash) ||
+		!bytes.Equal(header.StateHash, block.StateHash) || !bytes.Equal(header.PreviousHash, block.PreviousBlockHash) {
+		t.Errorf("Unexpected block header: %v", header)
+	}
+
+	receipt, err := newTransactionReceipt(4, 1, transactions, noSignature)
+	if err != nil {
+		t.Fatalf("Error creating receipt: %s", err)
+	}
+	if !bytes.Equal(header.MerkleRoot, receipt.MerkleRoot) {
+		t.Error("Expected the merkle root of the header to match the receipt merkle root")
+	}
+
+	header, err = newBlockHeader(0, &pb.Block{})
+	if err != nil {
+		t.Fatalf("Error creating block header: %s", err)
+	}
+	if header.TxCount != 0 || header.MerkleRoot != nil {
+		t.Errorf("Expected an empty block header without merkle root, got %v", header)
+	}
+}
+
+func TestAssembleBlock(t *testing.T) {
+	block := &pb.Block{Version: 1, Transactions: newTestTransactions(2), StateHash: []byte("state"), PreviousBlockHash: []byte("previous"), ConsensusMetadata: []byte("metadata")}
+	header, err := newBlockHeader(7, block)
+	if err != nil {
+		t.Fatalf("Error creating block header: %s", err)
+	}
+	assembled, err := assembleBlock(header, newBlockBody(7, block))
+	if err != nil {
+		t.Fatalf("Error assembling block: %s", err)
+	}
+	if hash, _ := assembled.GetHash(); !bytes.Equal(hash, header.Hash) || len(assembled.Transactions) != 2 {
+		t.Errorf("Unexpected assembled block: %v", assembled)
+	}
+
+	tampered := newBlockBody(7, block)
+	tampered.Transactions = tampered.Transactions[:1]
+	if _, err := assembleBlock(header, tampered); err == nil {
+		t.Error("Expected an error assembling a block from a body not matching the header")
+	}
+	if _, err := assembleBlock(header, newBlockBody(8, block)); err == nil {
+		t.Error("Expected an error assembling a block from the body of another block")
+	}
+}
+
+func TestHeaderCacheEvictsOldest(t *testing.T) {
+	cache := newHeaderCache(2)
+	for n := uint64(0); n < 3; n++ {
+		cache.put(headerKey{address: "peer", blockNumber: n}, &pb.BlockHeader{BlockNumber: n})
+	}
+	if _, ok := cache.get(headerKey{address: "peer", blockNumber: 0}); ok {
+		t.Error("Expected the oldest header to be evicted")
+	}
+	if header, ok := cache.get(headerKey{address: "peer", blockNumber: 2}); !ok || header.BlockNumber != 2 {
+		t.Errorf("Expected the last header to be cached, got %v", header)
+	}
+}
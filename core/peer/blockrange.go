@@ -0,0 +1,165 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// sendBlockRange answers a CHAIN_QUERY_RANGE with a CHAIN_BLOCK for each of
+// at most limit blocks of the range, then a CHAIN_QUERY_RANGE_DONE. A limit of
+// 0 sends the whole range. Blocks past the end of the chain are not sent.
+func sendBlockRange(blockchain BlockChainAccessor, send func(*pb.Message) error, query *pb.BlockRangeQuery, limit uint32) error {
+	if query.MaxResults > 0 && (limit == 0 || query.MaxResults < limit) {
+		limit = query.MaxResults
+	}
+	return sendBlocksInRange(blockchain, send, query.FromBlock, query.ToBlock, limit, func(blockNumber uint64) error {
+		return sendSubscribedBlock(blockchain, send, "", blockNumber)
+	})
+}
+
+// sendBlocksInRange sends each of at most limit blocks from from to to
+// included with sendBlock, then a CHAIN_QUERY_RANGE_DONE. A limit of 0 sends
+// the whole range. Blocks past the end of the chain are not sent.
+func sendBlocksInRange(blockchain BlockChainAccessor, send func(*pb.Message) error, from, to uint64, limit uint32, sendBlock func(blockNumber uint64) error) error {
+	if height := blockchain.GetBlockchainSize(); height == 0 {
+		return sendBlockRangeDone(send, &pb.BlockRangeDone{})
+	} else if to >= height {
+		to = height - 1
+	}
+	var sent uint32
+	next := from
+	for ; next <= to; next++ {
+		if limit > 0 && sent == limit {
+			return sendBlockRangeDone(send, &pb.BlockRangeDone{HasMore: true, NextBlock: next})
+		}
+		if err := sendBlock(next); err != nil {
+			return err
+		}
+		sent++
+	}
+	return sendBlockRangeDone(send, &pb.BlockRangeDone{NextBlock: next})
+}
+
+func sendBlockRangeDone(send func(*pb.Message) error, done *pb.BlockRangeDone) error {
+	data, err := proto.Marshal(done)
+	if err != nil {
+		return fmt.Errorf("Error marshalling BlockRangeDone: %s", err)
+	}
+	return send(&pb.Message{Type: pb.Message_CHAIN_QUERY_RANGE_DONE, Payload: data})
+}
+
+// FetchBlockRange asks the peer at address for the blocks from to to included,
+// issuing a CHAIN_QUERY_RANGE for every page of blocks the peer limits its
+// replies to. Blocks past the end of the chain of the peer are not returned.
+func FetchBlockRange(address string, from, to uint64) (blocks []*pb.Block, err error) {
+	err = withRequestStream(address, func(stream ChatStream) error {
+		blocks, err = fetchBlockRangeOverStream(stream, from, to)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching blocks %d to %d from %s: %s", from, to, address, err)
+	}
+	return blocks, nil
+}
+
+func fetchBlockRangeOverStream(stream ChatStream, from, to uint64) ([]*pb.Block, error) {
+	return fetchBlockPagesOverStream(stream, from, to, func(next uint64) (*pb.Message, error) {
+		data, err := proto.Marshal(&pb.BlockRangeQuery{FromBlock: next, ToBlock: to})
+		if err != nil {
+			return nil, fmt.Errorf("Error marshalling BlockRangeQuery: %s", err)
+		}
+		return &pb.Message{Type: pb.Message_CHAIN_QUERY_RANGE, Payload: data, Timestamp: util.CreateUtcTimestamp()}, nil
+	})
+}
+
+// fetchBlockPagesOverStream sends the request newRequest returns for the
+// blocks from next to to, next being from then the first block not sent in the
+// previous page, until the peer sends the last page
+func fetchBlockPagesOverStream(stream ChatStream, from, to uint64, newRequest func(next uint64) (*pb.Message, error)) ([]*pb.Block, error) {
+	var blocks []*pb.Block
+	for next := from; next <= to; {
+		request, err := newRequest(next)
+		if err != nil {
+			return nil, err
+		}
+		if err := stream.Send(request); err != nil {
+			return nil, fmt.Errorf("Error sending %s: %s", request.Type, err)
+		}
+		done, page, err := receiveBlockRange(stream)
+		if err != nil {
+			return nil, err
+		}
+		for _, block := range page {
+			blocks = append(blocks, block.Block)
+		}
+		if !done.HasMore {
+			break
+		}
+		if done.NextBlock <= next {
+			return nil, fmt.Errorf("%s did not advance past block %d", pb.Message_CHAIN_QUERY_RANGE_DONE, next)
+		}
+		next = done.NextBlock
+	}
+	return blocks, nil
+}
+
+// receiveBlockRange returns the blocks received until the CHAIN_QUERY_RANGE_DONE
+func receiveBlockRange(stream ChatStream) (*pb.BlockRangeDone, []*pb.SubscribedBlock, error) {
+	var blocks []*pb.SubscribedBlock
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return nil, nil, fmt.Errorf("Error waiting for %s: %s", pb.Message_CHAIN_QUERY_RANGE_DONE, err)
+		}
+		switch msg.Type {
+		case pb.Message_CHAIN_BLOCK:
+			block := &pb.SubscribedBlock{}
+			if err := proto.Unmarshal(msg.Payload, block); err != nil {
+				return nil, nil, fmt.Errorf("Error unmarshalling SubscribedBlock: %s", err)
+			}
+			if block.SubscriptionID != "" {
+				continue
+			}
+			blocks = append(blocks, block)
+			continue
+		case pb.Message_CHAIN_QUERY_RANGE_DONE:
+			done := &pb.BlockRangeDone{}
+			if err := proto.Unmarshal(msg.Payload, done); err != nil {
+				return nil, nil, fmt.Errorf("Error unmarshalling BlockRangeDone: %s", err)
+			}
+			return done, blocks, nil
+		case pb.Message_RESPONSE:
+			response := &pb.Response{}
+			if err := proto.Unmarshal(msg.Payload, response); err == nil && response.Status == pb.Response_FAILURE {
+				return nil, nil, fmt.Errorf("Error response to %s: %s", pb.Message_CHAIN_QUERY_RANGE, response.Msg)
+			}
+		}
+		peerLogger.Debugf("Ignoring %s while waiting for %s", msg.Type, pb.Message_CHAIN_QUERY_RANGE_DONE)
+	}
+}
+
+// blockRangeLimit returns the most blocks sent in reply to a CHAIN_QUERY_RANGE, peer.blocks.maxRangeResults
+func blockRangeLimit() uint32 {
+	return uint32(viper.GetInt("peer.blocks.maxRangeResults"))
+}
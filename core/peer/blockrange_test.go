@@ -0,0 +1,100 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestFetchBlockRangePages(t *testing.T) {
+	blockchain := &testBlockchain{}
+	bus := NewBlockEventBus()
+	for i := 0; i < 10; i++ {
+		blockchain.append(bus, &pb.Block{StateHash: []byte(fmt.Sprintf("state%d", i))})
+	}
+
+	// Serve the CHAIN_QUERY_RANGE requests 3 blocks at a time
+	stream := &handshakeStream{recv: make(chan *pb.Message, 10), sent: make(chan *pb.Message)}
+	queries := 0
+	go func() {
+		defer close(stream.recv)
+		for msg := range stream.sent {
+			query := &pb.BlockRangeQuery{}
+			if err := proto.Unmarshal(msg.Payload, query); err != nil {
+				t.Errorf("Error unmarshalling BlockRangeQuery: %s", err)
+				return
+			}
+			queries++
+			send := func(reply *pb.Message) error {
+				stream.recv <- reply
+				return nil
+			}
+			if err := sendBlockRange(blockchain, send, query, 3); err != nil {
+				t.Errorf("Error sending block range: %s", err)
+				return
+			}
+		}
+	}()
+
+	blocks, err := fetchBlockRangeOverStream(stream, 2, 20)
+	close(stream.sent)
+	if err != nil {
+		t.Fatalf("Error fetching block range: %s", err)
+	}
+	if len(blocks) != 8 {
+		t.Fatalf("Expected blocks 2 to 9, got %d blocks", len(blocks))
+	}
+	for i, block := range blocks {
+		if expected := fmt.Sprintf("state%d", i+2); string(block.StateHash) != expected {
+			t.Errorf("Expected block %d to be %s, got %s", i, expected, block.StateHash)
+		}
+	}
+	if queries != 3 {
+		t.Errorf("Expected the range to take 3 pages, took %d", queries)
+	}
+}
+
+func TestSendBlockRangeMaxResults(t *testing.T) {
+	blockchain := &testBlockchain{}
+	bus := NewBlockEventBus()
+	for i := 0; i < 5; i++ {
+		blockchain.append(bus, &pb.Block{})
+	}
+	var sent []*pb.Message
+	send := func(msg *pb.Message) error {
+		sent = append(sent, msg)
+		return nil
+	}
+	if err := sendBlockRange(blockchain, send, &pb.BlockRangeQuery{FromBlock: 0, ToBlock: 4, MaxResults: 2}, 0); err != nil {
+		t.Fatalf("Error sending block range: %s", err)
+	}
+	if len(sent) != 3 || sent[2].Type != pb.Message_CHAIN_QUERY_RANGE_DONE {
+		t.Fatalf("Expected 2 blocks and a CHAIN_QUERY_RANGE_DONE, got %d messages", len(sent))
+	}
+	done := &pb.BlockRangeDone{}
+	if err := proto.Unmarshal(sent[2].Payload, done); err != nil {
+		t.Fatalf("Error unmarshalling BlockRangeDone: %s", err)
+	}
+	if !done.HasMore || done.NextBlock != 2 {
+		t.Errorf("Expected more blocks from block 2, got %v", done)
+	}
+}
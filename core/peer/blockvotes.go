@@ -0,0 +1,126 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+var voteVerifier struct {
+	sync.RWMutex
+	verify func(vkID, signature, message []byte) error
+}
+
+// setVoteVerifier installs the verification of vote signatures under the
+// publicKey of a validator, that of the security helper of the peer
+func setVoteVerifier(verify func(vkID, signature, message []byte) error) {
+	voteVerifier.Lock()
+	defer voteVerifier.Unlock()
+	voteVerifier.verify = verify
+}
+
+// BlockVoteBytes returns the bytes a validator signs voting for the block
+// proposal of hash blockHash in round
+func BlockVoteBytes(round uint64, blockHash []byte) []byte {
+	data := make([]byte, 8, 8+len(blockHash))
+	binary.BigEndian.PutUint64(data, round)
+	return append(data, blockHash...)
+}
+
+// blockVotes returns the BlockVotes of the consensus metadata of a block, nil
+// if the block was not committed by the BFT consensus
+func blockVotes(metadata []byte) *pb.BlockVotes {
+	if len(metadata) == 0 {
+		return nil
+	}
+	votes := &pb.BlockVotes{}
+	if err := proto.Unmarshal(metadata, votes); err != nil || len(votes.Votes) == 0 {
+		return nil
+	}
+	return votes
+}
+
+// verifyVoteSignature returns an error unless signature is the signature of
+// message under publicKey. With security disabled votes are signed by the
+// message itself, as by the consensus helper.
+func verifyVoteSignature(publicKey, signature, message []byte) error {
+	if !SecurityEnabled() {
+		if !bytes.Equal(signature, message) {
+			return fmt.Errorf("Invalid signature")
+		}
+		return nil
+	}
+	voteVerifier.RLock()
+	verify := voteVerifier.verify
+	voteVerifier.RUnlock()
+	if verify == nil {
+		return fmt.Errorf("No security helper to verify signatures")
+	}
+	return verify(publicKey, signature, message)
+}
+
+// VerifyBlockVotes returns an error unless the validators with a valid vote
+// in the header hold more than quorumThreshold of the voting power of
+// validators. Votes of other peers and invalid votes are ignored, and each
+// validator is counted once.
+func VerifyBlockVotes(header *pb.BlockHeader, validators []*pb.ValidatorInfo, quorumThreshold float32) error {
+	if quorumThreshold <= 0 || quorumThreshold >= 1 {
+		return fmt.Errorf("Quorum threshold %v outside of (0, 1)", quorumThreshold)
+	}
+	byName := make(map[string]*pb.ValidatorInfo)
+	var total uint64
+	for _, validator := range validators {
+		if validator.PeerID == nil {
+			continue
+		}
+		byName[validator.PeerID.Name] = validator
+		total += validator.VotingPower
+	}
+	if total == 0 {
+		return fmt.Errorf("No voting power among the %d validators", len(validators))
+	}
+	message := BlockVoteBytes(header.VoteRound, header.VotedHash)
+	voted := make(map[string]bool)
+	var power uint64
+	for _, vote := range header.ValidatorVotes {
+		if vote.ValidatorID == nil || voted[vote.ValidatorID.Name] {
+			continue
+		}
+		validator, ok := byName[vote.ValidatorID.Name]
+		if !ok {
+			peerLogger.Debugf("Ignoring vote of %s for block %d, not a validator", vote.ValidatorID.Name, header.BlockNumber)
+			continue
+		}
+		if err := verifyVoteSignature(validator.PublicKey, vote.Signature, message); err != nil {
+			peerLogger.Debugf("Ignoring vote of %s for block %d: %s", vote.ValidatorID.Name, header.BlockNumber, err)
+			continue
+		}
+		voted[vote.ValidatorID.Name] = true
+		power += validator.VotingPower
+	}
+	if float64(power) <= float64(quorumThreshold)*float64(total) {
+		return fmt.Errorf("Block %d has %d valid votes holding %d of the voting power %d, more than %v required", header.BlockNumber, len(voted), power, total, quorumThreshold)
+	}
+	return nil
+}
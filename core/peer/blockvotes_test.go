@@ -0,0 +1,90 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// votedHeader returns the header of a block voted for by voters, signing as
+// with security disabled
+func votedHeader(t *testing.T, voters ...string) *pb.BlockHeader {
+	proposalHash := []byte("proposal")
+	votes := &pb.BlockVotes{Round: 3, BlockHash: proposalHash}
+	for _, name := range voters {
+		votes.Votes = append(votes.Votes, &pb.ValidatorVote{ValidatorID: &pb.PeerID{Name: name}, Signature: BlockVoteBytes(3, proposalHash)})
+	}
+	metadata, err := proto.Marshal(votes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &pb.Block{Transactions: []*pb.Transaction{{Uuid: "tx1"}}, ConsensusMetadata: metadata}
+	header, err := newBlockHeader(3, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
+
+func TestBlockHeaderVotes(t *testing.T) {
+	header := votedHeader(t, "vp0", "vp1")
+	if len(header.ValidatorVotes) != 2 || header.VoteRound != 3 || string(header.VotedHash) != "proposal" {
+		t.Fatalf("Expected the header to carry the votes of the consensus metadata, got %v", header)
+	}
+	header, err := newBlockHeader(3, &pb.Block{ConsensusMetadata: []byte{0x08, 0x07}})
+	if err != nil || len(header.ValidatorVotes) != 0 {
+		t.Fatalf("Expected no votes in the header of a block of other consensus metadata, got %v, %v", header, err)
+	}
+}
+
+func TestVerifyBlockVotes(t *testing.T) {
+	validators := []*pb.ValidatorInfo{
+		{PeerID: &pb.PeerID{Name: "vp0"}, VotingPower: 1},
+		{PeerID: &pb.PeerID{Name: "vp1"}, VotingPower: 1},
+		{PeerID: &pb.PeerID{Name: "vp2"}, VotingPower: 1},
+		{PeerID: &pb.PeerID{Name: "vp3"}, VotingPower: 3},
+	}
+	if err := VerifyBlockVotes(votedHeader(t, "vp0", "vp3"), validators, 0.5); err != nil {
+		t.Errorf("Expected votes of 4 of 6 of the voting power to exceed the threshold: %s", err)
+	}
+	if err := VerifyBlockVotes(votedHeader(t, "vp0", "vp1", "vp2"), validators, 0.5); err == nil {
+		t.Error("Expected votes of half of the voting power not to exceed the threshold")
+	}
+	if err := VerifyBlockVotes(votedHeader(t, "vp0", "vp0", "vp0", "vp3"), validators, 0.67); err == nil {
+		t.Error("Expected the repeated votes of a validator to be counted once")
+	}
+	if err := VerifyBlockVotes(votedHeader(t, "vp3", "vp4", "vp5"), validators, 0.5); err == nil {
+		t.Error("Expected the votes of peers other than the validators to be ignored")
+	}
+	header := votedHeader(t, "vp0", "vp3")
+	header.ValidatorVotes[1].Signature = []byte("forged")
+	if err := VerifyBlockVotes(header, validators, 0.5); err == nil {
+		t.Error("Expected a forged vote to be ignored")
+	}
+	header = votedHeader(t, "vp0", "vp3")
+	header.VotedHash = []byte("other")
+	if err := VerifyBlockVotes(header, validators, 0.5); err == nil {
+		t.Error("Expected the votes for another proposal to be refused")
+	}
+	if err := VerifyBlockVotes(votedHeader(t, "vp0"), validators, 1); err == nil {
+		t.Error("Expected a threshold of the whole voting power to be refused")
+	}
+}
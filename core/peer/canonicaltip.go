@@ -0,0 +1,133 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// ChainTip is the last block of the chain a peer considers canonical
+type ChainTip struct {
+	BlockNumber     uint64
+	BlockHash       []byte
+	TotalDifficulty uint64
+}
+
+// canonicalTip returns the last block of the chain. The ledger keeps a single
+// chain, which is then the canonical one, and its blocks carry no proof of
+// work, each counting for a difficulty of 1.
+func canonicalTip(blockchain BlockChainAccessor) (*ChainTip, error) {
+	height := blockchain.GetBlockchainSize()
+	if height == 0 {
+		return nil, fmt.Errorf("No blocks in the chain")
+	}
+	block, err := blockchain.GetBlockByNumber(height - 1)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting block %d: %s", height-1, err)
+	}
+	hash, err := block.GetHash()
+	if err != nil {
+		return nil, fmt.Errorf("Error hashing block %d: %s", height-1, err)
+	}
+	return &ChainTip{BlockNumber: height - 1, BlockHash: hash, TotalDifficulty: height}, nil
+}
+
+// GetCanonicalTip returns the tip of the chain this peer considers canonical
+func (p *PeerImpl) GetCanonicalTip() (*ChainTip, error) {
+	return canonicalTip(p)
+}
+
+// FetchCanonicalTip asks the peer at address for the tip of the chain it considers canonical
+func FetchCanonicalTip(address string) (tip *ChainTip, err error) {
+	err = withRequestStream(address, func(stream ChatStream) error {
+		tip, err = fetchCanonicalTipOverStream(stream)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error getting canonical tip from %s: %s", address, err)
+	}
+	return tip, nil
+}
+
+func fetchCanonicalTipOverStream(stream ChatStream) (*ChainTip, error) {
+	data, err := proto.Marshal(&pb.GetCanonicalTip{})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling GetCanonicalTip: %s", err)
+	}
+	reply, err := requestOverStream(stream, &pb.Message{Type: pb.Message_CHAIN_GET_CANONICAL_TIP, Payload: data}, pb.Message_CHAIN_CANONICAL_TIP)
+	if err != nil {
+		return nil, err
+	}
+	tip := &pb.CanonicalTip{}
+	if err := proto.Unmarshal(reply.Payload, tip); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling CanonicalTip: %s", err)
+	}
+	return &ChainTip{BlockNumber: tip.BlockNumber, BlockHash: tip.BlockHash, TotalDifficulty: tip.TotalDifficulty}, nil
+}
+
+// canonicalSyncOverStream delta syncs the blocks from from to the canonical
+// tip of the remote peer, which must be at block to or past it, then checks
+// the synced blocks chain up to the hash of the tip
+func canonicalSyncOverStream(syncCtx *SyncContext, stream ChatStream, local deltaSyncLedger, from, to uint64, progress SyncProgressFunc) error {
+	tip, err := fetchCanonicalTipOverStream(stream)
+	if err != nil {
+		return err
+	}
+	if tip.BlockNumber < to {
+		return fmt.Errorf("Canonical tip at block %d is before block %d", tip.BlockNumber, to)
+	}
+	if err := deltaSyncOverStream(syncCtx, stream, local, from, tip.BlockNumber, progress); err != nil {
+		return err
+	}
+	return verifyChainToTip(local, from, tip)
+}
+
+// verifyChainToTip returns an error unless block from links through the
+// previous block hashes of the following blocks to the block of the tip
+func verifyChainToTip(local deltaSyncLedger, from uint64, tip *ChainTip) error {
+	block, err := local.GetBlockByNumber(tip.BlockNumber)
+	if err != nil {
+		return fmt.Errorf("Error getting local block %d: %s", tip.BlockNumber, err)
+	}
+	hash, err := block.GetHash()
+	if err != nil {
+		return fmt.Errorf("Error hashing local block %d: %s", tip.BlockNumber, err)
+	}
+	if !bytes.Equal(hash, tip.BlockHash) {
+		return fmt.Errorf("Synced block %d does not have the hash of the canonical tip", tip.BlockNumber)
+	}
+	for n := tip.BlockNumber; n > from; n-- {
+		previous, err := local.GetBlockByNumber(n - 1)
+		if err != nil {
+			return fmt.Errorf("Error getting local block %d: %s", n-1, err)
+		}
+		previousHash, err := previous.GetHash()
+		if err != nil {
+			return fmt.Errorf("Error hashing local block %d: %s", n-1, err)
+		}
+		if !bytes.Equal(block.PreviousBlockHash, previousHash) {
+			return fmt.Errorf("Synced block %d does not chain to block %d", n, n-1)
+		}
+		block = previous
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// linkedTestBlockchain returns a chain of n blocks, each carrying the hash of the previous one
+func linkedTestBlockchain(t *testing.T, n int) *testBlockchain {
+	chain := &testBlockchain{}
+	bus := NewBlockEventBus()
+	var previousHash []byte
+	for i := 0; i < n; i++ {
+		block := &pb.Block{StateHash: []byte(fmt.Sprintf("state%d", i)), PreviousBlockHash: previousHash}
+		chain.append(bus, block)
+		hash, err := block.GetHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		previousHash = hash
+	}
+	return chain
+}
+
+// serveCanonicalSync answers the messages sent on the stream from the remote
+// chain, with tip as its canonical tip
+func serveCanonicalSync(t *testing.T, stream *handshakeStream, remote *testBlockchain, tip *ChainTip) {
+	defer close(stream.recv)
+	send := func(reply *pb.Message) error {
+		stream.recv <- reply
+		return nil
+	}
+	for msg := range stream.sent {
+		switch msg.Type {
+		case pb.Message_CHAIN_GET_CANONICAL_TIP:
+			data, _ := proto.Marshal(&pb.CanonicalTip{BlockNumber: tip.BlockNumber, BlockHash: tip.BlockHash, TotalDifficulty: tip.TotalDifficulty})
+			send(&pb.Message{Type: pb.Message_CHAIN_CANONICAL_TIP, Payload: data})
+		case pb.Message_SYNC_GET_BLOCK_HASHES:
+			request := &pb.BlockHashesRequest{}
+			proto.Unmarshal(msg.Payload, request)
+			hashes, err := blockHashList(remote, request)
+			if err != nil {
+				t.Errorf("Error listing block hashes: %s", err)
+				return
+			}
+			data, _ := proto.Marshal(hashes)
+			send(&pb.Message{Type: pb.Message_SYNC_BLOCK_HASHES, Payload: data})
+		case pb.Message_SYNC_GET_BLOCKS_BY_NUMBER:
+			request := &pb.BlockNumbers{}
+			proto.Unmarshal(msg.Payload, request)
+			if err := sendBlocksByNumber(remote, send, request.BlockNumbers, 0); err != nil {
+				t.Errorf("Error sending blocks: %s", err)
+				return
+			}
+		}
+	}
+}
+
+func canonicalSync(t *testing.T, remote, local *testBlockchain, tip *ChainTip, from, to uint64) error {
+	stream := &handshakeStream{recv: make(chan *pb.Message, 10), sent: make(chan *pb.Message)}
+	go serveCanonicalSync(t, stream, remote, tip)
+	err := canonicalSyncOverStream(NewSyncContext(context.Background()), stream, local, from, to, nil)
+	close(stream.sent)
+	return err
+}
+
+func TestCanonicalTip(t *testing.T) {
+	if _, err := canonicalTip(&testBlockchain{}); err == nil {
+		t.Fatal("Expected an error without blocks")
+	}
+	chain := linkedTestBlockchain(t, 5)
+	tip, err := canonicalTip(chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, _ := chain.GetBlockByNumber(4)
+	hash, _ := last.GetHash()
+	if tip.BlockNumber != 4 || !bytes.Equal(tip.BlockHash, hash) || tip.TotalDifficulty != 5 {
+		t.Fatalf("Expected the tip at block 4 with a total difficulty of 5, got %+v", tip)
+	}
+}
+
+func TestCanonicalSyncToTip(t *testing.T) {
+	remote := linkedTestBlockchain(t, 8)
+	local := linkedTestBlockchain(t, 3)
+	tip, _ := canonicalTip(remote)
+	if err := canonicalSync(t, remote, local, tip, 0, 5); err != nil {
+		t.Fatalf("Error syncing to the canonical tip: %s", err)
+	}
+	if local.GetBlockchainSize() != 8 {
+		t.Fatalf("Expected the local chain to be synced up to the tip, got %d blocks", local.GetBlockchainSize())
+	}
+}
+
+func TestCanonicalSyncTipBehind(t *testing.T) {
+	remote := linkedTestBlockchain(t, 4)
+	tip, _ := canonicalTip(remote)
+	if err := canonicalSync(t, remote, &testBlockchain{}, tip, 0, 5); err == nil {
+		t.Fatal("Expected a canonical tip before the block to sync to to fail the sync")
+	}
+}
+
+func TestCanonicalSyncWrongHash(t *testing.T) {
+	remote := linkedTestBlockchain(t, 6)
+	tip, _ := canonicalTip(remote)
+	tip.BlockHash = []byte("forked")
+	if err := canonicalSync(t, remote, &testBlockchain{}, tip, 0, 5); err == nil {
+		t.Fatal("Expected a chain not culminating in the hash of the tip to fail the sync")
+	}
+}
+
+func TestVerifyChainToTipBrokenLink(t *testing.T) {
+	chain := linkedTestBlockchain(t, 6)
+	chain.blocks[2] = &pb.Block{StateHash: []byte("forked"), PreviousBlockHash: chain.blocks[2].PreviousBlockHash}
+	tip, _ := canonicalTip(chain)
+	if err := verifyChainToTip(chain, 0, tip); err == nil {
+		t.Fatal("Expected a block not chaining to its predecessor to fail the verification")
+	}
+	if err := verifyChainToTip(chain, 3, tip); err != nil {
+		t.Fatalf("Expected the blocks from block 3 to chain up to the tip: %s", err)
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"sort"
+
+	"github.com/spf13/viper"
+)
+
+// peersDiffCapability has discovery send DISC_GET_PEERS_DIFF instead of DISC_GET_PEERS
+const peersDiffCapability = "peersDiff"
+
+// getSupportedCapabilities returns the optional protocol features this peer supports
+func getSupportedCapabilities() []string {
+	return viper.GetStringSlice("peer.capabilities.supported")
+}
+
+// getRequiredCapabilities returns the features this peer requires the peers it chats with to support
+func getRequiredCapabilities() []string {
+	return viper.GetStringSlice("peer.capabilities.required")
+}
+
+// negotiateCapabilities returns the capabilities supported by both peers, and
+// those required by either peer that are not, both sorted
+func negotiateCapabilities(localSupported, localRequired, remoteSupported, remoteRequired []string) (negotiated, missing []string) {
+	remote := make(map[string]bool, len(remoteSupported))
+	for _, c := range remoteSupported {
+		remote[c] = true
+	}
+	both := make(map[string]bool)
+	for _, c := range localSupported {
+		if remote[c] && !both[c] {
+			both[c] = true
+			negotiated = append(negotiated, c)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, c := range append(append([]string{}, localRequired...), remoteRequired...) {
+		if !both[c] && !seen[c] {
+			seen[c] = true
+			missing = append(missing, c)
+		}
+	}
+	sort.Strings(negotiated)
+	sort.Strings(missing)
+	return negotiated, missing
+}
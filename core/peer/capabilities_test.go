@@ -0,0 +1,43 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNegotiateCapabilities(t *testing.T) {
+	negotiated, missing := negotiateCapabilities(
+		[]string{"seqno", "compression", "pow"}, []string{"compression"},
+		[]string{"compression", "seqno"}, []string{"seqno"})
+	if !reflect.DeepEqual(negotiated, []string{"compression", "seqno"}) {
+		t.Errorf("Expected compression and seqno to be negotiated, got %v", negotiated)
+	}
+	if len(missing) != 0 {
+		t.Errorf("Expected no missing capabilities, got %v", missing)
+	}
+}
+
+func TestNegotiateCapabilitiesMissing(t *testing.T) {
+	_, missing := negotiateCapabilities(
+		[]string{"compression"}, []string{"compression", "encryption"},
+		[]string{"compression", "pow"}, []string{"pow", "encryption"})
+	if !reflect.DeepEqual(missing, []string{"encryption", "pow"}) {
+		t.Errorf("Expected encryption and pow to be missing, got %v", missing)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// unknownChannelReason is the reason of the CHAIN_TRANSACTIONS_ERROR
+// answering a batch naming a channel without processor
+const unknownChannelReason = "unknown channel"
+
+// ChannelRouterAccessor interface enables a Peer to hand out the router of
+// the batches of its channels
+type ChannelRouterAccessor interface {
+	GetChannelRouter() *ChannelRouter
+}
+
+// ChannelRouter holds the TransactionBatchProcessor the CHAIN_TRANSACTIONS
+// batches naming a channel are routed to by their channelID. Only the
+// channels of peer.channels can be registered if it lists any.
+type ChannelRouter struct {
+	sync.RWMutex
+	allowed    map[string]bool
+	processors map[string]TransactionBatchProcessor
+}
+
+// NewChannelRouter returns a router without processors accepting the
+// channels, any channel if none
+func NewChannelRouter(channels []string) *ChannelRouter {
+	r := &ChannelRouter{processors: make(map[string]TransactionBatchProcessor)}
+	if len(channels) > 0 {
+		r.allowed = make(map[string]bool)
+		for _, id := range channels {
+			r.allowed[id] = true
+		}
+	}
+	return r
+}
+
+// newChannelRouterFromConfig returns a router accepting the channels of peer.channels
+func newChannelRouterFromConfig() *ChannelRouter {
+	return NewChannelRouter(viper.GetStringSlice("peer.channels"))
+}
+
+// Register has the batches of channel id processed by p, replacing any
+// processor registered for id before. An error is returned if id is not one
+// of the channels of the router.
+func (r *ChannelRouter) Register(id string, p TransactionBatchProcessor) error {
+	if id == "" {
+		return fmt.Errorf("No channel ID given")
+	}
+	r.Lock()
+	defer r.Unlock()
+	if r.allowed != nil && !r.allowed[id] {
+		return fmt.Errorf("Channel %s is not one of peer.channels", id)
+	}
+	r.processors[id] = p
+	return nil
+}
+
+// Deregister drops the processor of channel id, its batches being refused from then on
+func (r *ChannelRouter) Deregister(id string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.processors, id)
+}
+
+// Get returns the processor of channel id, false if none is registered
+func (r *ChannelRouter) Get(id string) (TransactionBatchProcessor, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	p, ok := r.processors[id]
+	return p, ok
+}
+
+// Channels returns the channels with a processor, sorted
+func (r *ChannelRouter) Channels() []string {
+	r.RLock()
+	defer r.RUnlock()
+	ids := make([]string, 0, len(r.processors))
+	for id := range r.processors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// GetChannelRouter returns the router the CHAIN_TRANSACTIONS batches naming a
+// channel are routed through
+func (p *PeerImpl) GetChannelRouter() *ChannelRouter {
+	return p.channels
+}
+
+// RegisterChannel has the CHAIN_TRANSACTIONS batches of channel id processed
+// by processor, whatever their executionEnv
+func (p *PeerImpl) RegisterChannel(id string, processor TransactionBatchProcessor) error {
+	return p.channels.Register(id, processor)
+}
+
+// DeregisterChannel stops the processing of the batches of channel id
+func (p *PeerImpl) DeregisterChannel(id string) {
+	p.channels.Deregister(id)
+}
@@ -0,0 +1,73 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/looplab/fsm"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestChannelRouter(t *testing.T) {
+	router := NewChannelRouter(nil)
+	if _, ok := router.Get("payments"); ok {
+		t.Fatal("Expected no processor in an empty router")
+	}
+	if err := router.Register("", envProcessor("none")); err == nil {
+		t.Error("Expected a channel without ID to be refused")
+	}
+	router.Register("payments", envProcessor("payments"))
+	router.Register("assets", envProcessor("assets"))
+	if ids := fmt.Sprint(router.Channels()); ids != "[assets payments]" {
+		t.Errorf("Expected the registered channels sorted, got %s", ids)
+	}
+	if p, ok := router.Get("payments"); !ok || p != envProcessor("payments") {
+		t.Errorf("Expected the payments processor, got %v", p)
+	}
+	router.Deregister("payments")
+	if _, ok := router.Get("payments"); ok {
+		t.Error("Expected no processor for a deregistered channel")
+	}
+}
+
+func TestChannelRouterAllowed(t *testing.T) {
+	router := NewChannelRouter([]string{"payments"})
+	if err := router.Register("assets", envProcessor("assets")); err == nil {
+		t.Error("Expected a channel outside of peer.channels to be refused")
+	}
+	if err := router.Register("payments", envProcessor("payments")); err != nil {
+		t.Errorf("Error registering a channel of peer.channels: %s", err)
+	}
+}
+
+func TestHandlerRefusesUnknownChannel(t *testing.T) {
+	handler := newTestHandlerWithCoordinator(t, handlerTestCoordinator{channels: NewChannelRouter(nil)})
+	batch := newTestTransactionBatch(1)
+	batch.ChannelID = "payments"
+	data, _ := proto.Marshal(batch)
+	msg := &pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS, Payload: data}
+	handler.beforeTransactions(&fsm.Event{FSM: handler.FSM, Event: msg.Type.String(), Args: []interface{}{msg}})
+	reply := <-handler.ChatStream.(*handshakeStream).sent
+	transactionsError := &pb.TransactionsError{}
+	if err := proto.Unmarshal(reply.Payload, transactionsError); err != nil || reply.Type != pb.Message_CHAIN_TRANSACTIONS_ERROR || transactionsError.Reason != unknownChannelReason {
+		t.Errorf("Expected a CHAIN_TRANSACTIONS_ERROR for the unknown channel, got %v, %v", reply, transactionsError)
+	}
+}
@@ -0,0 +1,258 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+var requestSigner struct {
+	sync.RWMutex
+	pkiID []byte
+	sign  func(msg []byte) ([]byte, error)
+}
+
+// setRequestSigner installs the signature of the DISC_HELLO of request
+// streams when security is enabled, under the PKI ID of the security helper of
+// the peer
+func setRequestSigner(pkiID []byte, sign func(msg []byte) ([]byte, error)) {
+	requestSigner.Lock()
+	defer requestSigner.Unlock()
+	requestSigner.pkiID = pkiID
+	requestSigner.sign = sign
+}
+
+// newRequestHello returns the DISC_HELLO opening a request stream, carrying
+// the authChallenge the receiver is to answer
+func newRequestHello(authChallenge []byte) (*pb.Message, error) {
+	endpoint, err := GetPeerEndpoint()
+	if err != nil {
+		return nil, fmt.Errorf("Error creating hello message: %s", err)
+	}
+	requestSigner.RLock()
+	defer requestSigner.RUnlock()
+	if SecurityEnabled() {
+		if requestSigner.sign == nil {
+			return nil, fmt.Errorf("Error creating hello message: no security helper to sign it with")
+		}
+		withPkiID := *endpoint
+		withPkiID.PkiID = requestSigner.pkiID
+		endpoint = &withPkiID
+	}
+	authToken, err := newAuthToken(endpoint.ID.Name)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating hello message: %s", err)
+	}
+	data, err := proto.Marshal(&pb.HelloMessage{
+		PeerEndpoint:          endpoint,
+		SupportedCapabilities: helloCapabilities(false),
+		MaxMessageBytes:       uint32(getMaxMessageSize()),
+		AuthToken:             authToken,
+		AuthChallenge:         authChallenge,
+		ProtocolVersion:       ProtocolVersion,
+		PreferredCodecs:       getPreferredCodecs(),
+		RequestOnly:           true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling HelloMessage: %s", err)
+	}
+	msg := &pb.Message{Type: pb.Message_DISC_HELLO, Payload: data, Timestamp: util.CreateUtcTimestamp()}
+	if SecurityEnabled() {
+		if msg.Signature, err = requestSigner.sign(msg.Payload); err != nil {
+			return nil, fmt.Errorf("Error signing new HelloMessage: %s", err)
+		}
+	}
+	return msg, nil
+}
+
+// requestHandshake authenticates a request stream with a DISC_HELLO exchange,
+// answering the hello challenge of the remote peer and checking its answer to
+// that of this peer when they authenticate with a shared secret. The remote
+// peer does not register this one, the stream being established for the
+// requests alone.
+func requestHandshake(stream ChatStream) error {
+	secrets := helloAuthSecrets()
+	var challenge []byte
+	if len(secrets) > 0 {
+		var err error
+		if challenge, err = newHelloChallenge(); err != nil {
+			return err
+		}
+	}
+	hello, err := newRequestHello(challenge)
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(hello); err != nil {
+		return fmt.Errorf("Error sending %s: %s", hello.Type, err)
+	}
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return fmt.Errorf("Error waiting for %s: %s", pb.Message_DISC_HELLO, err)
+		}
+		switch msg.Type {
+		case pb.Message_DISC_HELLO:
+			if challenge == nil {
+				return nil
+			}
+			reply := &pb.HelloMessage{}
+			if err := proto.Unmarshal(msg.Payload, reply); err != nil {
+				return fmt.Errorf("Error unmarshalling HelloMessage: %s", err)
+			}
+			auth, err := newHelloAuth(reply.AuthChallenge, secrets[0])
+			if err != nil {
+				return err
+			}
+			if err := stream.Send(auth); err != nil {
+				return fmt.Errorf("Error sending %s: %s", auth.Type, err)
+			}
+			continue
+		case pb.Message_DISC_HELLO_AUTH:
+			if challenge == nil {
+				break
+			}
+			answer := &pb.HelloAuth{}
+			if err := proto.Unmarshal(msg.Payload, answer); err != nil {
+				return fmt.Errorf("Error unmarshalling HelloAuth: %s", err)
+			}
+			return verifyHelloAuth(challenge, answer, secrets)
+		case pb.Message_DISC_UNAUTHORIZED:
+			return &UnauthorizedError{Reason: string(msg.Payload)}
+		case pb.Message_DISC_DISCONNECT:
+			return &DisconnectedError{Reason: string(msg.Payload)}
+		case pb.Message_DISC_VERSION_MISMATCH:
+			mismatch := &pb.CapabilityMismatch{}
+			if err := proto.Unmarshal(msg.Payload, mismatch); err != nil {
+				return fmt.Errorf("Error unmarshalling CapabilityMismatch: %s", err)
+			}
+			return &CapabilityMismatchError{Missing: mismatch.MissingCapabilities}
+		}
+		peerLogger.Debugf("Ignoring %s while waiting for %s", msg.Type, pb.Message_DISC_HELLO)
+	}
+}
+
+// withRequestStream opens a Chat stream to the peer at address and calls f
+// with it once it is established by requestHandshake. The stream is cancelled
+// after peer.chat.requestTimeout.
+func withRequestStream(address string, f func(stream ChatStream) error) error {
+	return withRequestStreamTimeout(address, viper.GetDuration("peer.chat.requestTimeout"), f)
+}
+
+// withRequestStreamTimeout is withRequestStream with the stream closed after timeout
+func withRequestStreamTimeout(address string, timeout time.Duration, f func(stream ChatStream) error) error {
+	return withPooledRequestStreamTimeout(nil, address, timeout, f)
+}
+
+// withPooledRequestStreamTimeout is withRequestStreamTimeout over a connection of pool
+func withPooledRequestStreamTimeout(pool *PeerConnectionPool, address string, timeout time.Duration, f func(stream ChatStream) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return withPooledRequestStreamContext(ctx, pool, address, f)
+}
+
+// withRequestStreamContext is withRequestStream with the stream closed once ctx is done
+func withRequestStreamContext(ctx context.Context, address string, f func(stream ChatStream) error) error {
+	return withPooledRequestStreamContext(ctx, nil, address, f)
+}
+
+// withPooledRequestStreamContext is withRequestStreamContext over a connection of pool
+func withPooledRequestStreamContext(ctx context.Context, pool *PeerConnectionPool, address string, f func(stream ChatStream) error) error {
+	return withChatStream(ctx, pool, address, func(stream ChatStream) error {
+		if err := requestHandshake(stream); err != nil {
+			return fmt.Errorf("Error authenticating chat with peer address %s: %s", address, err)
+		}
+		return f(stream)
+	})
+}
+
+// withChatStream opens a Chat stream to the peer at address over a
+// connection of pool and calls f with it, before any DISC_HELLO exchange
+func withChatStream(ctx context.Context, pool *PeerConnectionPool, address string, f func(stream ChatStream) error) error {
+	conn, err := pool.Get(address)
+	if err != nil {
+		return fmt.Errorf("Error creating connection to peer address %s: %s", address, err)
+	}
+	defer pool.Release(address, conn)
+	chat, err := pb.NewPeerClient(conn).Chat(ctx)
+	if err != nil {
+		return fmt.Errorf("Error establishing chat with peer address %s: %s", address, err)
+	}
+	defer chat.CloseSend()
+	return f(NewCodecNegotiator(NewCompressionNegotiator(chat)))
+}
+
+// requestOverChat sends request to the peer at address over a new Chat stream and waits for a message of type replyType
+func requestOverChat(address string, request *pb.Message, replyType pb.Message_Type) (reply *pb.Message, err error) {
+	err = withRequestStream(address, func(stream ChatStream) error {
+		reply, err = requestOverStream(stream, request, replyType)
+		return err
+	})
+	return reply, err
+}
+
+// requestOverStream sends request on the stream and returns the first received
+// message of type replyType. A failed RESPONSE received instead is returned as
+// an error, a CHAIN_QUERY_UNSUPPORTED as a *QueryUnsupportedError.
+func requestOverStream(stream ChatStream, request *pb.Message, replyType pb.Message_Type) (*pb.Message, error) {
+	if request.Timestamp == nil {
+		request.Timestamp = util.CreateUtcTimestamp()
+	}
+	if err := stream.Send(request); err != nil {
+		return nil, fmt.Errorf("Error sending %s: %s", request.Type, err)
+	}
+	return receiveReply(stream, request.Type, replyType)
+}
+
+// receiveReply returns the next message of type replyType received on the
+// stream, for requests of requestType answered by several messages. A failed
+// RESPONSE received instead is returned as an error, a CHAIN_QUERY_UNSUPPORTED
+// as a *QueryUnsupportedError.
+func receiveReply(stream ChatStream, requestType, replyType pb.Message_Type) (*pb.Message, error) {
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return nil, fmt.Errorf("Error waiting for %s: %s", replyType, err)
+		}
+		if msg.Type == replyType {
+			return msg, nil
+		}
+		if msg.Type == pb.Message_CHAIN_QUERY_UNSUPPORTED {
+			unsupported := &pb.QueryUnsupported{}
+			if err := proto.Unmarshal(msg.Payload, unsupported); err != nil {
+				return nil, fmt.Errorf("Error unmarshalling QueryUnsupported: %s", err)
+			}
+			return nil, &QueryUnsupportedError{Type: requestType, Reason: unsupported.Reason}
+		}
+		if msg.Type == pb.Message_RESPONSE {
+			response := &pb.Response{}
+			if err := proto.Unmarshal(msg.Payload, response); err == nil && response.Status == pb.Response_FAILURE {
+				return nil, fmt.Errorf("Error response to %s: %s", requestType, response.Msg)
+			}
+		}
+		peerLogger.Debugf("Ignoring %s while waiting for %s", msg.Type, replyType)
+	}
+}
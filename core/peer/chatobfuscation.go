@@ -0,0 +1,302 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// obfuscatedTypesCapability has the peers of a Chat send every message after
+// the DISC_HELLO exchange as an OPAQUE one, the message and its type sealed
+// in the payload. It is only advertised by peers with an encryption key.
+const obfuscatedTypesCapability = "obfuscatedTypes"
+
+// opaquePaddingBlock is the multiple the sealed messages are padded to, for
+// their length not to tell which message they hold
+const opaquePaddingBlock = 256
+
+// obfuscationKeyLabel separates the keys derived for obfuscated Chat streams
+// from any other use of the encryption keys of the peers
+const obfuscationKeyLabel = "fabric chat type obfuscation"
+
+// helloCapabilities returns the supported capabilities advertised in a
+// DISC_HELLO, leaving obfuscatedTypes out for a peer without an encryption key
+func helloCapabilities(hasEncryptionKey bool) []string {
+	supported := getSupportedCapabilities()
+	if hasEncryptionKey {
+		return supported
+	}
+	var capabilities []string
+	for _, c := range supported {
+		if c != obfuscatedTypesCapability {
+			capabilities = append(capabilities, c)
+		}
+	}
+	return capabilities
+}
+
+// EncryptedMessageCodec is a MessageCodec sealing whole messages with
+// AES-256-GCM under a key shared by the peers of a Chat. The marshalled
+// message is prefixed with its length and zero padded to a multiple of 256
+// bytes before it is sealed, behind a random nonce.
+type EncryptedMessageCodec struct {
+	aead cipher.AEAD
+}
+
+// NewEncryptedMessageCodec returns a codec sealing messages with the 32 byte key
+func NewEncryptedMessageCodec(key []byte) (*EncryptedMessageCodec, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("Message encryption key of %d bytes, 32 expected", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedMessageCodec{aead: aead}, nil
+}
+
+// Name is the name of the codec, which is negotiated through the
+// obfuscatedTypes capability rather than advertised in preferredCodecs
+func (c *EncryptedMessageCodec) Name() string { return "encrypted" }
+
+// Marshal pads and seals the message
+func (c *EncryptedMessageCodec) Marshal(msg *pb.Message) ([]byte, error) {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	size := 4 + len(data)
+	if rem := size % opaquePaddingBlock; rem != 0 {
+		size += opaquePaddingBlock - rem
+	}
+	plaintext := make([]byte, size)
+	binary.BigEndian.PutUint32(plaintext, uint32(len(data)))
+	copy(plaintext[4:], data)
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+size+c.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("Error generating nonce: %s", err)
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Unmarshal opens and unpads data into msg
+func (c *EncryptedMessageCodec) Unmarshal(data []byte, msg *pb.Message) error {
+	if len(data) < c.aead.NonceSize() {
+		return fmt.Errorf("Sealed message of %d bytes is too short", len(data))
+	}
+	plaintext, err := c.aead.Open(nil, data[:c.aead.NonceSize()], data[c.aead.NonceSize():], nil)
+	if err != nil {
+		return fmt.Errorf("Error opening sealed message: %s", err)
+	}
+	if len(plaintext) < 4 {
+		return fmt.Errorf("Sealed message of %d bytes is too short", len(plaintext))
+	}
+	size := binary.BigEndian.Uint32(plaintext)
+	if uint64(size) > uint64(len(plaintext)-4) {
+		return fmt.Errorf("Sealed message of %d bytes holds no message of %d bytes", len(plaintext), size)
+	}
+	return proto.Unmarshal(plaintext[4:4+size], msg)
+}
+
+// deriveObfuscationKey returns the key the peers of a Chat seal messages
+// with: the SHA-256 of the ECDH secret of the local and remote encryption
+// keys and of both public keys, the same on either side of the stream
+func deriveObfuscationKey(local *ecdsa.PrivateKey, remote *ecdsa.PublicKey) ([]byte, error) {
+	curve := local.Curve
+	if remote.Curve.Params().Name != curve.Params().Name || !curve.IsOnCurve(remote.X, remote.Y) {
+		return nil, fmt.Errorf("Remote encryption key is not on curve %s", curve.Params().Name)
+	}
+	x, _ := curve.ScalarMult(remote.X, remote.Y, local.D.Bytes())
+	if x.Sign() == 0 {
+		return nil, fmt.Errorf("Invalid shared secret")
+	}
+	secret := make([]byte, (curve.Params().BitSize+7)/8)
+	xBytes := x.Bytes()
+	copy(secret[len(secret)-len(xBytes):], xBytes)
+	localDER, err := x509.MarshalPKIXPublicKey(&local.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	remoteDER, err := x509.MarshalPKIXPublicKey(remote)
+	if err != nil {
+		return nil, err
+	}
+	first, second := localDER, remoteDER
+	if bytes.Compare(first, second) > 0 {
+		first, second = second, first
+	}
+	h := sha256.New()
+	for _, part := range [][]byte{[]byte(obfuscationKeyLabel), secret, first, second} {
+		h.Write(part)
+	}
+	return h.Sum(nil), nil
+}
+
+// TypeObfuscatingStream is a ChatStream sending every message after the
+// DISC_HELLO exchange as an OPAQUE message sealed by an
+// EncryptedMessageCodec, for an observer of the stream not to tell from
+// their types or lengths what the peers exchange, such as when a block sync
+// runs. It is only used once the DISC_HELLO sent and the one received both
+// advertise obfuscatedTypes and carry an encryption key, the key of the
+// codec being derived from the local key and the remote one. Messages are
+// sent as they are before that, and DISC_HELLO always is. Received messages
+// are opened if OPAQUE and passed on as they are otherwise, those sent before
+// the remote peer saw both DISC_HELLO arriving in the clear.
+type TypeObfuscatingStream struct {
+	ChatStream
+	sync.RWMutex
+	key                   *ecdsa.PrivateKey
+	local, remote         *pb.HelloMessage
+	localSeen, remoteSeen bool
+	codec                 *EncryptedMessageCodec
+}
+
+// NewTypeObfuscatingStream returns the stream wrapped in a
+// TypeObfuscatingStream sealing messages under a key derived from key, the
+// encryption key of this peer, nil if it has none
+func NewTypeObfuscatingStream(stream ChatStream, key *ecdsa.PrivateKey) *TypeObfuscatingStream {
+	return &TypeObfuscatingStream{ChatStream: stream, key: key}
+}
+
+// Obfuscating returns whether the messages sent are sealed as OPAQUE ones
+func (s *TypeObfuscatingStream) Obfuscating() bool {
+	return s.getCodec() != nil
+}
+
+func (s *TypeObfuscatingStream) getCodec() *EncryptedMessageCodec {
+	s.RLock()
+	defer s.RUnlock()
+	return s.codec
+}
+
+// Send seals and sends the message
+func (s *TypeObfuscatingStream) Send(msg *pb.Message) error {
+	if msg.Type == pb.Message_DISC_HELLO {
+		s.observeHello(msg, true)
+		return s.ChatStream.Send(msg)
+	}
+	codec := s.getCodec()
+	if codec == nil {
+		return s.ChatStream.Send(msg)
+	}
+	payload, err := codec.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("Error sealing %s: %s", msg.Type, err)
+	}
+	return s.ChatStream.Send(&pb.Message{Type: pb.Message_OPAQUE, Payload: payload})
+}
+
+// Recv receives and opens a message
+func (s *TypeObfuscatingStream) Recv() (*pb.Message, error) {
+	msg, err := s.ChatStream.Recv()
+	if err != nil {
+		return msg, err
+	}
+	switch msg.Type {
+	case pb.Message_OPAQUE:
+		codec := s.getCodec()
+		if codec == nil {
+			return nil, fmt.Errorf("Received %s before %s was negotiated", msg.Type, obfuscatedTypesCapability)
+		}
+		opened := &pb.Message{}
+		if err := codec.Unmarshal(msg.Payload, opened); err != nil {
+			return nil, err
+		}
+		return opened, nil
+	case pb.Message_DISC_HELLO:
+		s.observeHello(msg, false)
+	}
+	return msg, nil
+}
+
+// observeHello records a DISC_HELLO, deriving the key of the codec once both
+// the local and the remote one are seen and allow it
+func (s *TypeObfuscatingStream) observeHello(msg *pb.Message, sent bool) {
+	hello := &pb.HelloMessage{}
+	if err := proto.Unmarshal(msg.Payload, hello); err != nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	if sent {
+		s.local, s.localSeen = hello, true
+	} else {
+		s.remote, s.remoteSeen = hello, true
+	}
+	if !s.localSeen || !s.remoteSeen || s.codec != nil {
+		return
+	}
+	codec, err := s.negotiate()
+	if err != nil {
+		peerLogger.Warningf("Not obfuscating Chat message types: %s", err)
+		return
+	}
+	if codec != nil {
+		s.codec = codec
+		peerLogger.Debug("Obfuscating Chat message types")
+	}
+}
+
+// negotiate returns the codec of the DISC_HELLO exchange, nil if either
+// peer does not advertise obfuscatedTypes
+func (s *TypeObfuscatingStream) negotiate() (*EncryptedMessageCodec, error) {
+	negotiated, _ := negotiateCapabilities(s.local.SupportedCapabilities, nil, s.remote.SupportedCapabilities, nil)
+	shared := false
+	for _, c := range negotiated {
+		shared = shared || c == obfuscatedTypesCapability
+	}
+	if !shared || len(s.local.EncryptionKey) == 0 || len(s.remote.EncryptionKey) == 0 {
+		return nil, nil
+	}
+	if s.key == nil {
+		return nil, fmt.Errorf("No encryption key matching the one advertised")
+	}
+	localDER, err := x509.MarshalPKIXPublicKey(&s.key.PublicKey)
+	if err != nil || !bytes.Equal(localDER, s.local.EncryptionKey) {
+		return nil, fmt.Errorf("No encryption key matching the one advertised")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(s.remote.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding remote encryption key: %s", err)
+	}
+	remote, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("Remote encryption key is not an ECDSA public key")
+	}
+	key, err := deriveObfuscationKey(s.key, remote)
+	if err != nil {
+		return nil, err
+	}
+	return NewEncryptedMessageCodec(key)
+}
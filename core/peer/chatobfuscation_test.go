@@ -0,0 +1,200 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/core/crypto/primitives"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func newObfuscationTestKey(t *testing.T) *ecdsa.PrivateKey {
+	primitives.SetSecurityLevel("SHA3", 256)
+	key, err := primitives.NewECDSAKey()
+	if err != nil {
+		t.Fatalf("Error generating key: %s", err)
+	}
+	return key
+}
+
+// newObfuscationHello returns a DISC_HELLO advertising capabilities and the
+// public key of key, if any
+func newObfuscationHello(t *testing.T, key *ecdsa.PrivateKey, capabilities ...string) *pb.Message {
+	hello := &pb.HelloMessage{SupportedCapabilities: capabilities}
+	if key != nil {
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			t.Fatalf("Error encoding key: %s", err)
+		}
+		hello.EncryptionKey = der
+	}
+	data, err := proto.Marshal(hello)
+	if err != nil {
+		t.Fatalf("Error marshalling HelloMessage: %s", err)
+	}
+	return &pb.Message{Type: pb.Message_DISC_HELLO, Payload: data}
+}
+
+func TestEncryptedMessageCodec(t *testing.T) {
+	codec, err := NewEncryptedMessageCodec(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("Error creating codec: %s", err)
+	}
+	overhead := codec.aead.NonceSize() + codec.aead.Overhead()
+	for _, size := range []int{1, 10, 251, 252, 600} {
+		msg := &pb.Message{Type: pb.Message_SYNC_GET_BLOCKS, Payload: bytes.Repeat([]byte{7}, size), CorrelationID: "3"}
+		sealed, err := codec.Marshal(msg)
+		if err != nil {
+			t.Fatalf("Error sealing a payload of %d bytes: %s", size, err)
+		}
+		if (len(sealed)-overhead)%opaquePaddingBlock != 0 {
+			t.Errorf("Expected a payload of %d bytes to be padded to a multiple of %d, got %d bytes sealed", size, opaquePaddingBlock, len(sealed)-overhead)
+		}
+		opened := &pb.Message{}
+		if err := codec.Unmarshal(sealed, opened); err != nil || !proto.Equal(opened, msg) {
+			t.Errorf("Expected the sealed message back, got %v, %v", opened, err)
+		}
+	}
+
+	sealed, _ := codec.Marshal(&pb.Message{Type: pb.Message_SYNC_GET_BLOCKS})
+	sealed[len(sealed)-1] ^= 1
+	if err := codec.Unmarshal(sealed, &pb.Message{}); err == nil {
+		t.Error("Expected a tampered message not to open")
+	}
+	other, _ := NewEncryptedMessageCodec(bytes.Repeat([]byte{2}, 32))
+	sealed, _ = codec.Marshal(&pb.Message{Type: pb.Message_SYNC_GET_BLOCKS})
+	if err := other.Unmarshal(sealed, &pb.Message{}); err == nil {
+		t.Error("Expected a message sealed under another key not to open")
+	}
+	if _, err := NewEncryptedMessageCodec([]byte("short")); err == nil {
+		t.Error("Expected an error for a key of the wrong size")
+	}
+}
+
+func TestDeriveObfuscationKey(t *testing.T) {
+	a, b, c := newObfuscationTestKey(t), newObfuscationTestKey(t), newObfuscationTestKey(t)
+	ab, err := deriveObfuscationKey(a, &b.PublicKey)
+	if err != nil {
+		t.Fatalf("Error deriving key: %s", err)
+	}
+	ba, err := deriveObfuscationKey(b, &a.PublicKey)
+	if err != nil {
+		t.Fatalf("Error deriving key: %s", err)
+	}
+	if !bytes.Equal(ab, ba) || len(ab) != 32 {
+		t.Fatalf("Expected both peers to derive the same 32 byte key, got %x and %x", ab, ba)
+	}
+	if ac, _ := deriveObfuscationKey(a, &c.PublicKey); bytes.Equal(ab, ac) {
+		t.Error("Expected another remote key to derive another key")
+	}
+}
+
+// obfuscatedPipe returns the two ends of a Chat stream wrapped in
+// TypeObfuscatingStreams and the raw initiator end, once they exchanged the
+// DISC_HELLO given
+func obfuscatedPipe(t *testing.T, initiatorKey, receiverKey *ecdsa.PrivateKey, initiatorHello, receiverHello *pb.Message) (initiator, receiver *TypeObfuscatingStream, raw *handshakeStream) {
+	raw, rawReceiver := newStreamPipe()
+	initiator, receiver = NewTypeObfuscatingStream(raw, initiatorKey), NewTypeObfuscatingStream(rawReceiver, receiverKey)
+	if err := initiator.Send(initiatorHello); err != nil {
+		t.Fatalf("Error sending DISC_HELLO: %s", err)
+	}
+	recvType(t, receiver, pb.Message_DISC_HELLO)
+	if err := receiver.Send(receiverHello); err != nil {
+		t.Fatalf("Error sending DISC_HELLO: %s", err)
+	}
+	recvType(t, initiator, pb.Message_DISC_HELLO)
+	return initiator, receiver, raw
+}
+
+func TestTypeObfuscatingStream(t *testing.T) {
+	a, b := newObfuscationTestKey(t), newObfuscationTestKey(t)
+	initiator, receiver, raw := obfuscatedPipe(t, a, b,
+		newObfuscationHello(t, a, obfuscatedTypesCapability), newObfuscationHello(t, b, "peersDiff", obfuscatedTypesCapability))
+	if !initiator.Obfuscating() || !receiver.Obfuscating() {
+		t.Fatalf("Expected both ends to obfuscate once %s is negotiated", obfuscatedTypesCapability)
+	}
+
+	msg := &pb.Message{Type: pb.Message_SYNC_GET_BLOCKS, Payload: []byte("range"), CorrelationID: "9"}
+	if err := initiator.Send(msg); err != nil {
+		t.Fatalf("Error sending %s: %s", msg.Type, err)
+	}
+	// Peek at the message on the wire before the receiver opens it
+	onWire := <-raw.sent
+	if onWire.Type != pb.Message_OPAQUE || onWire.CorrelationID != "" || len(onWire.Payload) < opaquePaddingBlock {
+		t.Fatalf("Expected an OPAQUE message hiding the type and correlation ID, got %v", onWire)
+	}
+	raw.sent <- onWire
+	if received := recvType(t, receiver, pb.Message_SYNC_GET_BLOCKS); !proto.Equal(received, msg) {
+		t.Errorf("Expected the message sent, got %v", received)
+	}
+
+	reply := &pb.Message{Type: pb.Message_SYNC_BLOCKS, Payload: []byte("blocks")}
+	if err := receiver.Send(reply); err != nil {
+		t.Fatalf("Error sending %s: %s", reply.Type, err)
+	}
+	if received := recvType(t, initiator, pb.Message_SYNC_BLOCKS); !proto.Equal(received, reply) {
+		t.Errorf("Expected the reply sent, got %v", received)
+	}
+}
+
+func TestTypeObfuscatingStreamNotNegotiated(t *testing.T) {
+	a, b := newObfuscationTestKey(t), newObfuscationTestKey(t)
+	for name, hellos := range map[string][2]*pb.Message{
+		"capability not shared": {newObfuscationHello(t, a, obfuscatedTypesCapability), newObfuscationHello(t, b, "peersDiff")},
+		"no remote key":         {newObfuscationHello(t, a, obfuscatedTypesCapability), newObfuscationHello(t, nil, obfuscatedTypesCapability)},
+		"key not advertised":    {newObfuscationHello(t, b, obfuscatedTypesCapability), newObfuscationHello(t, b, obfuscatedTypesCapability)},
+	} {
+		initiator, receiver, raw := obfuscatedPipe(t, a, b, hellos[0], hellos[1])
+		if initiator.Obfuscating() {
+			t.Errorf("%s: expected the initiator not to obfuscate", name)
+		}
+		if err := initiator.Send(&pb.Message{Type: pb.Message_SYNC_GET_BLOCKS}); err != nil {
+			t.Fatalf("%s: error sending: %s", name, err)
+		}
+		onWire := <-raw.sent
+		if onWire.Type != pb.Message_SYNC_GET_BLOCKS {
+			t.Errorf("%s: expected the message to be sent as it is, got %s", name, onWire.Type)
+		}
+		raw.sent <- onWire
+		recvType(t, receiver, pb.Message_SYNC_GET_BLOCKS)
+	}
+
+	// An OPAQUE message cannot be opened before the negotiation
+	stream := NewTypeObfuscatingStream(&handshakeStream{recv: make(chan *pb.Message, 1)}, a)
+	stream.ChatStream.(*handshakeStream).recv <- &pb.Message{Type: pb.Message_OPAQUE}
+	if _, err := stream.Recv(); err == nil {
+		t.Error("Expected an error receiving OPAQUE before the DISC_HELLO exchange")
+	}
+}
+
+func TestHelloCapabilities(t *testing.T) {
+	defer viper.Set("peer.capabilities.supported", viper.GetStringSlice("peer.capabilities.supported"))
+	viper.Set("peer.capabilities.supported", []string{"peersDiff", obfuscatedTypesCapability})
+	if capabilities := helloCapabilities(true); len(capabilities) != 2 {
+		t.Errorf("Expected %s to be advertised with an encryption key, got %v", obfuscatedTypesCapability, capabilities)
+	}
+	if capabilities := helloCapabilities(false); len(capabilities) != 1 || capabilities[0] != "peersDiff" {
+		t.Errorf("Expected %s to be left out without an encryption key, got %v", obfuscatedTypesCapability, capabilities)
+	}
+}
@@ -0,0 +1,449 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// resumptionAckInterval is how many messages of a session are received
+// without sending any before a DISC_ACK acknowledges them
+const resumptionAckInterval = 32
+
+// maxResumptionLog is the most unacknowledged messages a session keeps to
+// send again, a session sending more no longer being resumable
+const maxResumptionLog = 4096
+
+// chatSession is a Chat session that can be resumed on a new stream, the
+// messages it sent being kept until the remote peer acknowledges them
+type chatSession struct {
+	sync.Mutex
+	owner      *ResumableStream
+	sent       uint64        // Sequence number of the last message sent
+	received   uint64        // Sequence number of the last message received
+	unacked    []*pb.Message // Messages sent not acknowledged yet, in order
+	sinceAck   int           // Messages received since the last acknowledgement sent
+	overflow   bool          // More than maxResumptionLog messages unacknowledged
+	releasedAt time.Time     // When its last stream ended, zero while one is open
+}
+
+// ack drops the messages acknowledged by ackSequence
+func (s *chatSession) ack(ackSequence uint64) {
+	n := 0
+	for n < len(s.unacked) && s.unacked[n].Sequence <= ackSequence {
+		n++
+	}
+	s.unacked = s.unacked[n:]
+}
+
+// ChatSessionStore holds the sessions of the Chat streams of a peer for
+// them to be resumed on a new stream by the peer they are with, with the
+// session token it was issued, within window of the end of their stream.
+// Sessions do not survive restarts, as session tokens do not either. A nil
+// store, or a window of 0, keeps none.
+type ChatSessionStore struct {
+	sync.Mutex
+	window   time.Duration
+	sessions map[string]*chatSession
+}
+
+// NewChatSessionStore returns a store keeping the sessions for window once their stream ended
+func NewChatSessionStore(window time.Duration) *ChatSessionStore {
+	return &ChatSessionStore{window: window, sessions: make(map[string]*chatSession)}
+}
+
+// newChatSessionStoreFromConfig returns a store keeping the sessions for peer.chat.resumptionWindow
+func newChatSessionStoreFromConfig() *ChatSessionStore {
+	return NewChatSessionStore(viper.GetDuration("peer.chat.resumptionWindow"))
+}
+
+// expire drops the sessions whose stream ended more than window ago
+func (c *ChatSessionStore) expire(now time.Time) {
+	for key, s := range c.sessions {
+		s.Lock()
+		expired := !s.releasedAt.IsZero() && now.Sub(s.releasedAt) > c.window
+		s.Unlock()
+		if expired {
+			delete(c.sessions, key)
+		}
+	}
+}
+
+// open starts the session of key owned by owner, nil if sessions are not kept
+func (c *ChatSessionStore) open(key string, owner *ResumableStream) *chatSession {
+	if c == nil || c.window <= 0 {
+		return nil
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.expire(time.Now())
+	s := &chatSession{owner: owner}
+	c.sessions[key] = s
+	return s
+}
+
+// resumable returns the session of key if it can be resumed, nil otherwise
+func (c *ChatSessionStore) resumable(key string) *chatSession {
+	if c == nil || c.window <= 0 {
+		return nil
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.expire(time.Now())
+	s, ok := c.sessions[key]
+	if !ok {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.overflow {
+		return nil
+	}
+	return s
+}
+
+// resume moves the session of oldKey to key, owned by owner from then on,
+// the stream owning it before failing to send. It returns nil if the session
+// cannot be resumed.
+func (c *ChatSessionStore) resume(oldKey, key string, owner *ResumableStream) *chatSession {
+	s := c.resumable(oldKey)
+	if s == nil {
+		return nil
+	}
+	c.Lock()
+	defer c.Unlock()
+	delete(c.sessions, oldKey)
+	c.sessions[key] = s
+	s.Lock()
+	defer s.Unlock()
+	s.owner = owner
+	s.releasedAt = time.Time{}
+	return s
+}
+
+// drop forgets the session of key
+func (c *ChatSessionStore) drop(key string) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	delete(c.sessions, key)
+}
+
+// release records that the stream of owner owning the session of key ended
+func (c *ChatSessionStore) release(key string, owner *ResumableStream) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	if s, ok := c.sessions[key]; ok {
+		s.Lock()
+		if s.owner == owner {
+			s.releasedAt = time.Now()
+		}
+		s.Unlock()
+	}
+}
+
+// ResumableStream numbers the messages of a Chat once the receiver issued the
+// initiator a session token, for the session to be resumed on a new stream if
+// this one drops. The initiator presents the token in the DISC_HELLO of the
+// next Chat. If the receiver verifies it within peer.chat.resumptionWindow,
+// both DISC_HELLO are marked resumed and carry the sequence number of the
+// last message the peer received, each peer then sending again the messages
+// of the session the other did not receive. Messages received twice are
+// dropped, for none to be processed twice.
+type ResumableStream struct {
+	ChatStream
+	sendLock  sync.Mutex // Held while numbering and sending a message, for them to go out in order
+	lock      sync.Mutex // Guards the fields below
+	sessions  *ChatSessionStore
+	tokens    *SessionTokenStore
+	initiated bool
+	key       string
+	session   *chatSession
+	presented string // Token with a session presented in the DISC_HELLO sent
+	resuming  string // Token with a session presented in the DISC_HELLO received
+	remoteAck uint64 // ackSequence of the DISC_HELLO received
+}
+
+// NewResumableStream returns the stream wrapped in a ResumableStream keeping
+// its session in sessions, the session tokens presented by the remote peer
+// being verified with tokens
+func NewResumableStream(stream ChatStream, sessions *ChatSessionStore, tokens *SessionTokenStore, initiated bool) *ResumableStream {
+	return &ResumableStream{ChatStream: stream, sessions: sessions, tokens: tokens, initiated: initiated}
+}
+
+// sessionKey returns the key of the session of token in the store, the
+// initiator and the receiver of a Chat keeping theirs apart
+func (r *ResumableStream) sessionKey(token string) string {
+	if r.initiated {
+		return "initiated." + token
+	}
+	return "accepted." + token
+}
+
+func (r *ResumableStream) current() *chatSession {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.session
+}
+
+// bind has the stream send and receive the messages of session s of token
+func (r *ResumableStream) bind(token string, s *chatSession) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.key = r.sessionKey(token)
+	r.session = s
+}
+
+// Close records that the stream ended, its session being resumable for
+// peer.chat.resumptionWindow
+func (r *ResumableStream) Close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.session != nil {
+		r.sessions.release(r.key, r)
+	}
+}
+
+// Send numbers the message and keeps it until acknowledged if the stream has a session
+func (r *ResumableStream) Send(msg *pb.Message) error {
+	r.sendLock.Lock()
+	defer r.sendLock.Unlock()
+	switch msg.Type {
+	case pb.Message_DISC_HELLO:
+		return r.sendHello(msg)
+	case pb.Message_DISC_HELLO_AUTH:
+		if token := helloAuthSessionToken(msg); token != "" && !r.initiated {
+			r.bind(token, r.sessions.open(r.sessionKey(token), r))
+		}
+		return r.ChatStream.Send(msg)
+	}
+	s := r.current()
+	if s == nil {
+		return r.ChatStream.Send(msg)
+	}
+	s.Lock()
+	if s.owner != r {
+		s.Unlock()
+		return fmt.Errorf("Chat session resumed on another stream")
+	}
+	sequenced := *msg
+	s.sent++
+	sequenced.Sequence = s.sent
+	sequenced.AckSequence = s.received
+	s.sinceAck = 0
+	if !s.overflow {
+		if len(s.unacked) < maxResumptionLog {
+			s.unacked = append(s.unacked, &sequenced)
+		} else {
+			peerLogger.Warningf("More than %d messages of the Chat session unacknowledged, it will not be resumed", maxResumptionLog)
+			s.overflow = true
+			s.unacked = nil
+		}
+	}
+	s.Unlock()
+	return r.ChatStream.Send(&sequenced)
+}
+
+// sendHello sends the DISC_HELLO, resuming the session of the token the
+// initiator presents, or the receiver verified, if kept
+func (r *ResumableStream) sendHello(msg *pb.Message) error {
+	hello := &pb.HelloMessage{}
+	if err := proto.Unmarshal(msg.Payload, hello); err != nil || hello.SessionToken == "" {
+		return r.ChatStream.Send(msg)
+	}
+	if r.initiated {
+		s := r.sessions.resumable(r.sessionKey(hello.SessionToken))
+		if s == nil {
+			return r.ChatStream.Send(msg)
+		}
+		r.lock.Lock()
+		r.presented = hello.SessionToken
+		r.lock.Unlock()
+		resuming := *msg
+		resuming.Resumed = true
+		s.Lock()
+		resuming.AckSequence = s.received
+		s.Unlock()
+		return r.ChatStream.Send(&resuming)
+	}
+	r.lock.Lock()
+	presented, remoteAck := r.resuming, r.remoteAck
+	r.lock.Unlock()
+	if presented != "" {
+		if s := r.sessions.resume(r.sessionKey(presented), r.sessionKey(hello.SessionToken), r); s != nil {
+			r.bind(hello.SessionToken, s)
+			resumed := *msg
+			resumed.Resumed = true
+			s.Lock()
+			resumed.AckSequence = s.received
+			s.Unlock()
+			if err := r.ChatStream.Send(&resumed); err != nil {
+				return err
+			}
+			return r.replay(s, remoteAck)
+		}
+	}
+	r.bind(hello.SessionToken, r.sessions.open(r.sessionKey(hello.SessionToken), r))
+	return r.ChatStream.Send(msg)
+}
+
+// replay sends again the messages of session s the remote peer did not
+// receive, those after ackSequence
+func (r *ResumableStream) replay(s *chatSession, ackSequence uint64) error {
+	s.Lock()
+	s.ack(ackSequence)
+	unacked := append([]*pb.Message(nil), s.unacked...)
+	received := s.received
+	s.Unlock()
+	peerLogger.Debugf("Resuming the Chat session, sending %d messages again", len(unacked))
+	for _, msg := range unacked {
+		again := *msg
+		again.AckSequence = received
+		if err := r.ChatStream.Send(&again); err != nil {
+			return fmt.Errorf("Error sending %s %d again: %s", again.Type, again.Sequence, err)
+		}
+	}
+	return nil
+}
+
+// Recv receives the next message, dropping those of the session received
+// before and the DISC_ACK
+func (r *ResumableStream) Recv() (*pb.Message, error) {
+	for {
+		msg, err := r.ChatStream.Recv()
+		if err != nil {
+			return msg, err
+		}
+		switch msg.Type {
+		case pb.Message_DISC_HELLO:
+			if err := r.recvHello(msg); err != nil {
+				return nil, err
+			}
+			return msg, nil
+		case pb.Message_DISC_HELLO_AUTH:
+			if token := helloAuthSessionToken(msg); token != "" && r.initiated {
+				r.bind(token, r.sessions.open(r.sessionKey(token), r))
+			}
+			return msg, nil
+		}
+		s := r.current()
+		if s == nil {
+			if msg.Type == pb.Message_DISC_ACK {
+				continue
+			}
+			return msg, nil
+		}
+		s.Lock()
+		if msg.AckSequence > 0 {
+			s.ack(msg.AckSequence)
+		}
+		if msg.Type == pb.Message_DISC_ACK {
+			s.Unlock()
+			continue
+		}
+		if msg.Sequence == 0 {
+			s.Unlock()
+			return msg, nil
+		}
+		if msg.Sequence <= s.received {
+			s.Unlock()
+			peerLogger.Debugf("Dropping %s %d of the Chat session received before", msg.Type, msg.Sequence)
+			continue
+		}
+		s.received = msg.Sequence
+		s.sinceAck++
+		ack := s.sinceAck >= resumptionAckInterval
+		if ack {
+			s.sinceAck = 0
+		}
+		received := s.received
+		s.Unlock()
+		if ack {
+			if err := r.sendAck(received); err != nil {
+				peerLogger.Debugf("Error sending %s: %s", pb.Message_DISC_ACK, err)
+			}
+		}
+		return msg, nil
+	}
+}
+
+func (r *ResumableStream) sendAck(received uint64) error {
+	r.sendLock.Lock()
+	defer r.sendLock.Unlock()
+	return r.ChatStream.Send(&pb.Message{Type: pb.Message_DISC_ACK, AckSequence: received})
+}
+
+// recvHello records the session the initiator presents the token of, for the
+// receiver to resume it if the token is valid, or resumes the session the
+// initiator presented the token of if the receiver resumed it
+func (r *ResumableStream) recvHello(msg *pb.Message) error {
+	hello := &pb.HelloMessage{}
+	if err := proto.Unmarshal(msg.Payload, hello); err != nil || hello.SessionToken == "" {
+		return nil
+	}
+	if !r.initiated {
+		if !msg.Resumed || hello.PeerEndpoint == nil || hello.PeerEndpoint.ID == nil {
+			return nil
+		}
+		if err := r.tokens.Verify(hello.SessionToken, hello.PeerEndpoint.ID.Name); err != nil {
+			return nil
+		}
+		if r.sessions.resumable(r.sessionKey(hello.SessionToken)) != nil {
+			r.lock.Lock()
+			r.resuming, r.remoteAck = hello.SessionToken, msg.AckSequence
+			r.lock.Unlock()
+		}
+		return nil
+	}
+	r.lock.Lock()
+	presented := r.presented
+	r.lock.Unlock()
+	r.sendLock.Lock()
+	defer r.sendLock.Unlock()
+	if presented != "" && msg.Resumed {
+		if s := r.sessions.resume(r.sessionKey(presented), r.sessionKey(hello.SessionToken), r); s != nil {
+			r.bind(hello.SessionToken, s)
+			return r.replay(s, msg.AckSequence)
+		}
+	}
+	if presented != "" {
+		r.sessions.drop(r.sessionKey(presented))
+	}
+	r.bind(hello.SessionToken, r.sessions.open(r.sessionKey(hello.SessionToken), r))
+	return nil
+}
+
+// helloAuthSessionToken returns the session token issued in the DISC_HELLO_AUTH, "" if none
+func helloAuthSessionToken(msg *pb.Message) string {
+	auth := &pb.HelloAuth{}
+	if err := proto.Unmarshal(msg.Payload, auth); err != nil {
+		return ""
+	}
+	return auth.SessionToken
+}
@@ -0,0 +1,215 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// newStreamPipe returns the two ends of a Chat stream, the messages sent on
+// one being received on the other
+func newStreamPipe() (initiator, receiver *handshakeStream) {
+	toReceiver := make(chan *pb.Message, 100)
+	toInitiator := make(chan *pb.Message, 100)
+	return &handshakeStream{recv: toInitiator, sent: toReceiver}, &handshakeStream{recv: toReceiver, sent: toInitiator}
+}
+
+// drop discards the messages in flight towards the end of stream
+func drop(stream *handshakeStream) {
+	for len(stream.recv) > 0 {
+		<-stream.recv
+	}
+}
+
+func newTestHello(t *testing.T, token string) *pb.Message {
+	data, err := proto.Marshal(&pb.HelloMessage{PeerEndpoint: &pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp1"}}, SessionToken: token})
+	if err != nil {
+		t.Fatalf("Error marshalling HelloMessage: %s", err)
+	}
+	return &pb.Message{Type: pb.Message_DISC_HELLO, Payload: data}
+}
+
+func recvType(t *testing.T, stream ChatStream, msgType pb.Message_Type) *pb.Message {
+	msg, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Error receiving %s: %s", msgType, err)
+	}
+	if msg.Type != msgType {
+		t.Fatalf("Expected %s, got %s", msgType, msg.Type)
+	}
+	return msg
+}
+
+// helloExchange opens a Chat between the stream ends, the initiator
+// presenting the token presented, the receiver issuing it a new one
+func helloExchange(t *testing.T, initiator, receiver ChatStream, tokens *SessionTokenStore, presented string) (sent, received *pb.Message) {
+	if err := initiator.Send(newTestHello(t, presented)); err != nil {
+		t.Fatalf("Error sending DISC_HELLO: %s", err)
+	}
+	sent = recvType(t, receiver, pb.Message_DISC_HELLO)
+	if err := receiver.Send(newTestHello(t, tokens.Issue("vp1"))); err != nil {
+		t.Fatalf("Error sending DISC_HELLO: %s", err)
+	}
+	received = recvType(t, initiator, pb.Message_DISC_HELLO)
+	return sent, received
+}
+
+func sessionToken(t *testing.T, msg *pb.Message) string {
+	hello := &pb.HelloMessage{}
+	if err := proto.Unmarshal(msg.Payload, hello); err != nil {
+		t.Fatalf("Error unmarshalling HelloMessage: %s", err)
+	}
+	return hello.SessionToken
+}
+
+func TestResumableStreamResumes(t *testing.T) {
+	tokens, _ := NewSessionTokenStore(time.Hour)
+	initiatorSessions := NewChatSessionStore(time.Minute)
+	receiverSessions := NewChatSessionStore(time.Minute)
+
+	c1, s1 := newStreamPipe()
+	initiator := NewResumableStream(c1, initiatorSessions, nil, true)
+	receiver := NewResumableStream(s1, receiverSessions, tokens, false)
+	_, hello := helloExchange(t, initiator, receiver, tokens, "")
+	token := sessionToken(t, hello)
+	for _, id := range []string{"a", "b", "c"} {
+		initiator.Send(&pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS, CorrelationID: id})
+	}
+	recvType(t, receiver, pb.Message_CHAIN_TRANSACTIONS)
+	recvType(t, receiver, pb.Message_CHAIN_TRANSACTIONS)
+	// The third message is lost with the stream, and so is the second reply
+	drop(s1)
+	receiver.Send(&pb.Message{Type: pb.Message_RESPONSE, CorrelationID: "a"})
+	recvType(t, initiator, pb.Message_RESPONSE)
+	receiver.Send(&pb.Message{Type: pb.Message_RESPONSE, CorrelationID: "b"})
+	drop(c1)
+	initiator.Close()
+	receiver.Close()
+
+	c2, s2 := newStreamPipe()
+	initiator = NewResumableStream(c2, initiatorSessions, nil, true)
+	receiver = NewResumableStream(s2, receiverSessions, tokens, false)
+	sent, received := helloExchange(t, initiator, receiver, tokens, token)
+	if !sent.Resumed || sent.AckSequence != 1 {
+		t.Errorf("Expected the initiator to resume having received 1 message, got %v, %d", sent.Resumed, sent.AckSequence)
+	}
+	if !received.Resumed || received.AckSequence != 2 {
+		t.Errorf("Expected the receiver to resume having received 2 messages, got %v, %d", received.Resumed, received.AckSequence)
+	}
+	if reply := recvType(t, initiator, pb.Message_RESPONSE); reply.CorrelationID != "b" || reply.Sequence != 2 {
+		t.Errorf("Expected the lost reply sent again, got %v", reply)
+	}
+	if msg := recvType(t, receiver, pb.Message_CHAIN_TRANSACTIONS); msg.CorrelationID != "c" || msg.Sequence != 3 {
+		t.Errorf("Expected the lost message sent again, got %v", msg)
+	}
+	if len(c2.recv) != 0 || len(s2.recv) != 0 {
+		t.Error("Expected only the lost messages to be sent again")
+	}
+
+	// The session goes on where it was
+	initiator.Send(&pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS, CorrelationID: "d"})
+	if msg := recvType(t, receiver, pb.Message_CHAIN_TRANSACTIONS); msg.Sequence != 4 {
+		t.Errorf("Expected the next message to be 4, got %d", msg.Sequence)
+	}
+}
+
+func TestResumableStreamDropsDuplicates(t *testing.T) {
+	tokens, _ := NewSessionTokenStore(time.Hour)
+	c, s := newStreamPipe()
+	initiator := NewResumableStream(c, NewChatSessionStore(time.Minute), nil, true)
+	receiver := NewResumableStream(s, NewChatSessionStore(time.Minute), tokens, false)
+	helloExchange(t, initiator, receiver, tokens, "")
+	initiator.Send(&pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS, CorrelationID: "a"})
+	first := recvType(t, receiver, pb.Message_CHAIN_TRANSACTIONS)
+	s.recv <- first
+	initiator.Send(&pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS, CorrelationID: "b"})
+	if msg := recvType(t, receiver, pb.Message_CHAIN_TRANSACTIONS); msg.CorrelationID != "b" {
+		t.Errorf("Expected the message received twice to be dropped, got %s", msg.CorrelationID)
+	}
+}
+
+func TestResumableStreamAcks(t *testing.T) {
+	tokens, _ := NewSessionTokenStore(time.Hour)
+	c, s := newStreamPipe()
+	sessions := NewChatSessionStore(time.Minute)
+	initiator := NewResumableStream(c, sessions, nil, true)
+	receiver := NewResumableStream(s, NewChatSessionStore(time.Minute), tokens, false)
+	helloExchange(t, initiator, receiver, tokens, "")
+	for i := 0; i < resumptionAckInterval; i++ {
+		initiator.Send(&pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS})
+		recvType(t, receiver, pb.Message_CHAIN_TRANSACTIONS)
+	}
+	if ack := <-c.recv; ack.Type != pb.Message_DISC_ACK || ack.AckSequence != resumptionAckInterval {
+		t.Fatalf("Expected a DISC_ACK of message %d, got %v", resumptionAckInterval, ack)
+	}
+	// The DISC_ACK is handled by the stream, not returned
+	c.recv <- &pb.Message{Type: pb.Message_DISC_ACK, AckSequence: resumptionAckInterval}
+	c.recv <- &pb.Message{Type: pb.Message_RESPONSE}
+	recvType(t, initiator, pb.Message_RESPONSE)
+	if unacked := len(initiator.current().unacked); unacked != 0 {
+		t.Errorf("Expected the acknowledged messages to be dropped, %d left", unacked)
+	}
+}
+
+func TestResumableStreamNotResumed(t *testing.T) {
+	tokens, _ := NewSessionTokenStore(time.Hour)
+	initiatorSessions := NewChatSessionStore(time.Minute)
+	c1, s1 := newStreamPipe()
+	initiator := NewResumableStream(c1, initiatorSessions, nil, true)
+	receiver := NewResumableStream(s1, NewChatSessionStore(0), tokens, false)
+	_, hello := helloExchange(t, initiator, receiver, tokens, "")
+	initiator.Send(&pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS})
+	drop(s1)
+	initiator.Close()
+
+	// A receiver keeping no session starts the Chat afresh
+	c2, s2 := newStreamPipe()
+	initiator = NewResumableStream(c2, initiatorSessions, nil, true)
+	receiver = NewResumableStream(s2, NewChatSessionStore(0), tokens, false)
+	sent, received := helloExchange(t, initiator, receiver, tokens, sessionToken(t, hello))
+	if !sent.Resumed || received.Resumed {
+		t.Errorf("Expected the initiator to ask for resumption and the receiver to refuse, got %v and %v", sent.Resumed, received.Resumed)
+	}
+	if len(s2.recv) != 0 {
+		t.Error("Expected no message sent again without resumption")
+	}
+	if s := initiator.current(); s == nil || s.sent != 0 || len(s.unacked) != 0 {
+		t.Error("Expected the session not resumed to be replaced by a new one")
+	}
+}
+
+func TestChatSessionStoreWindow(t *testing.T) {
+	sessions := NewChatSessionStore(50 * time.Millisecond)
+	owner := &ResumableStream{}
+	sessions.open("key", owner)
+	sessions.release("key", owner)
+	if sessions.resumable("key") == nil {
+		t.Fatal("Expected the session to be resumable within the window")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if sessions.resumable("key") != nil {
+		t.Error("Expected the session to expire after the window")
+	}
+	if NewChatSessionStore(0).open("key", owner) != nil {
+		t.Error("Expected no session kept without a window")
+	}
+}
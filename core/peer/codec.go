@@ -0,0 +1,212 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// protoCodecName is the codec messages are sent with when no other is
+// negotiated, the Chat stream carrying them as they are
+const protoCodecName = "proto"
+
+// MessageCodec encodes the messages sent on a Chat once negotiated from the
+// preferredCodecs of the DISC_HELLO exchange
+type MessageCodec interface {
+	// Name is the name the codec is advertised with
+	Name() string
+	Marshal(msg *pb.Message) ([]byte, error)
+	Unmarshal(data []byte, msg *pb.Message) error
+}
+
+type protoCodec struct{}
+
+func (protoCodec) Name() string { return protoCodecName }
+
+func (protoCodec) Marshal(msg *pb.Message) ([]byte, error) { return proto.Marshal(msg) }
+
+func (protoCodec) Unmarshal(data []byte, msg *pb.Message) error { return proto.Unmarshal(data, msg) }
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(msg *pb.Message) ([]byte, error) {
+	data, err := (&jsonpb.Marshaler{}).MarshalToString(msg)
+	return []byte(data), err
+}
+
+func (jsonCodec) Unmarshal(data []byte, msg *pb.Message) error {
+	return jsonpb.UnmarshalString(string(data), msg)
+}
+
+// defaultCodecPreference is the codec preference of peers not setting
+// peer.chat.preferredCodecs
+var defaultCodecPreference = []string{"proto", "msgpack", "json"}
+
+// messageCodecs are the codecs this peer can encode and decode with. No
+// msgpack library is vendored, msgpack is only negotiated once a codec is
+// registered for it.
+var messageCodecs = map[string]MessageCodec{
+	protoCodecName: protoCodec{},
+	"json":         jsonCodec{},
+}
+
+// getPreferredCodecs returns the codecs of peer.chat.preferredCodecs, or of
+// the default preference if unset, this peer has a codec for
+func getPreferredCodecs() []string {
+	preference := viper.GetStringSlice("peer.chat.preferredCodecs")
+	if len(preference) == 0 {
+		preference = defaultCodecPreference
+	}
+	var codecs []string
+	for _, name := range preference {
+		if _, ok := messageCodecs[name]; ok {
+			codecs = append(codecs, name)
+		}
+	}
+	return codecs
+}
+
+// negotiateCodec returns the codec of the first of the local preferences also
+// preferred by the remote peer, proto if they share none
+func negotiateCodec(local, remote []string) MessageCodec {
+	remoteCodecs := make(map[string]bool)
+	for _, name := range remote {
+		remoteCodecs[name] = true
+	}
+	for _, name := range local {
+		if codec, ok := messageCodecs[name]; ok && remoteCodecs[name] {
+			return codec
+		}
+	}
+	return protoCodec{}
+}
+
+// encodeMessage returns msg encoded with codec as the payload of a message of
+// the same type and correlationID naming the codec. Messages are returned as
+// they are with the proto codec, or if already encoded.
+func encodeMessage(codec MessageCodec, msg *pb.Message) (*pb.Message, error) {
+	if codec == nil || codec.Name() == protoCodecName || msg.Codec != "" {
+		return msg, nil
+	}
+	data, err := codec.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("Error encoding %s with %s: %s", msg.Type, codec.Name(), err)
+	}
+	return &pb.Message{Type: msg.Type, CorrelationID: msg.CorrelationID, Payload: data, Codec: codec.Name()}, nil
+}
+
+// decodeMessage returns the message encoded in msg with the codec it names,
+// msg itself if it names none
+func decodeMessage(msg *pb.Message) (*pb.Message, error) {
+	if msg.Codec == "" {
+		return msg, nil
+	}
+	codec, ok := messageCodecs[msg.Codec]
+	if !ok {
+		return nil, fmt.Errorf("Received %s encoded with unsupported codec %s", msg.Type, msg.Codec)
+	}
+	decoded := &pb.Message{}
+	if err := codec.Unmarshal(msg.Payload, decoded); err != nil {
+		return nil, fmt.Errorf("Error decoding %s with %s: %s", msg.Type, msg.Codec, err)
+	}
+	return decoded, nil
+}
+
+// CodecNegotiator is a ChatStream encoding the messages it sends with the
+// codec negotiated from the preferredCodecs of the DISC_HELLO sent and of the
+// one received. Messages are sent as they are until both are seen, and
+// encoded ones name their codec, so that received messages are decoded
+// whatever the state of the negotiation. DISC_HELLO is never encoded.
+type CodecNegotiator struct {
+	ChatStream
+	sync.RWMutex
+	local, remote         []string
+	localSeen, remoteSeen bool
+	codec                 MessageCodec
+}
+
+// NewCodecNegotiator returns the stream wrapped in a CodecNegotiator
+func NewCodecNegotiator(stream ChatStream) *CodecNegotiator {
+	return &CodecNegotiator{ChatStream: stream, codec: protoCodec{}}
+}
+
+// Codec returns the codec the messages sent are encoded with
+func (n *CodecNegotiator) Codec() MessageCodec {
+	n.RLock()
+	defer n.RUnlock()
+	return n.codec
+}
+
+// Send encodes and sends the message
+func (n *CodecNegotiator) Send(msg *pb.Message) error {
+	if msg.Type == pb.Message_DISC_HELLO {
+		n.observeHello(msg, true)
+		return n.ChatStream.Send(msg)
+	}
+	encoded, err := encodeMessage(n.Codec(), msg)
+	if err != nil {
+		return err
+	}
+	return n.ChatStream.Send(encoded)
+}
+
+// Recv receives and decodes a message
+func (n *CodecNegotiator) Recv() (*pb.Message, error) {
+	msg, err := n.ChatStream.Recv()
+	if err != nil {
+		return msg, err
+	}
+	if msg, err = decodeMessage(msg); err != nil {
+		return nil, err
+	}
+	if msg.Type == pb.Message_DISC_HELLO {
+		n.observeHello(msg, false)
+	}
+	return msg, nil
+}
+
+// observeHello records the preferredCodecs of a DISC_HELLO, renegotiating
+// the codec once both the local and the remote one are seen
+func (n *CodecNegotiator) observeHello(msg *pb.Message, sent bool) {
+	hello := &pb.HelloMessage{}
+	if err := proto.Unmarshal(msg.Payload, hello); err != nil {
+		return
+	}
+	n.Lock()
+	defer n.Unlock()
+	if sent {
+		n.local, n.localSeen = hello.PreferredCodecs, true
+	} else {
+		n.remote, n.remoteSeen = hello.PreferredCodecs, true
+	}
+	if !n.localSeen || !n.remoteSeen {
+		return
+	}
+	if codec := negotiateCodec(n.local, n.remote); codec.Name() != n.codec.Name() {
+		n.codec = codec
+		peerLogger.Debugf("Encoding Chat messages with %s", codec.Name())
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func newCodecsHello(t *testing.T, codecs ...string) *pb.Message {
+	data, err := proto.Marshal(&pb.HelloMessage{PreferredCodecs: codecs})
+	if err != nil {
+		t.Fatalf("Error marshalling HelloMessage: %s", err)
+	}
+	return &pb.Message{Type: pb.Message_DISC_HELLO, Payload: data}
+}
+
+func TestNegotiateCodec(t *testing.T) {
+	if codec := negotiateCodec([]string{"msgpack", "json", "proto"}, []string{"proto", "msgpack", "json"}); codec.Name() != "json" {
+		t.Errorf("Expected json without a msgpack codec, got %s", codec.Name())
+	}
+	if codec := negotiateCodec([]string{"json"}, []string{"msgpack"}); codec.Name() != protoCodecName {
+		t.Errorf("Expected the fallback to proto, got %s", codec.Name())
+	}
+	if codec := negotiateCodec([]string{"json", "proto"}, nil); codec.Name() != protoCodecName {
+		t.Errorf("Expected proto with a peer advertising no codecs, got %s", codec.Name())
+	}
+}
+
+func TestGetPreferredCodecs(t *testing.T) {
+	defer viper.Set("peer.chat.preferredCodecs", defaultCodecPreference)
+	viper.Set("peer.chat.preferredCodecs", []string{})
+	if codecs := getPreferredCodecs(); len(codecs) != 2 || codecs[0] != "proto" || codecs[1] != "json" {
+		t.Errorf("Expected the default preference without msgpack, got %v", codecs)
+	}
+	viper.Set("peer.chat.preferredCodecs", []string{"json", "unknown", "proto"})
+	if codecs := getPreferredCodecs(); len(codecs) != 2 || codecs[0] != "json" || codecs[1] != "proto" {
+		t.Errorf("Expected the configured preference, got %v", codecs)
+	}
+}
+
+func TestCodecNegotiatorRoundTrip(t *testing.T) {
+	inner := &handshakeStream{recv: make(chan *pb.Message, 2), sent: make(chan *pb.Message, 3)}
+	sender := NewCodecNegotiator(inner)
+	sender.Send(newCodecsHello(t, "json", "proto"))
+	<-inner.sent
+	inner.recv <- newCodecsHello(t, "proto", "json")
+	if _, err := sender.Recv(); err != nil {
+		t.Fatalf("Error receiving DISC_HELLO: %s", err)
+	}
+	if codec := sender.Codec(); codec.Name() != "json" {
+		t.Fatalf("Expected the local preference for json, got %s", codec.Name())
+	}
+	msg := &pb.Message{Type: pb.Message_CHAIN_TRANSACTION, Payload: []byte("transaction"), CorrelationID: "id", Timestamp: util.CreateUtcTimestamp()}
+	if err := sender.Send(msg); err != nil {
+		t.Fatalf("Error sending: %s", err)
+	}
+	encoded := <-inner.sent
+	if encoded.Codec != "json" || encoded.Type != msg.Type || encoded.CorrelationID != "id" {
+		t.Fatalf("Expected the message encoded with json, got %v", encoded)
+	}
+	inner.recv <- encoded
+	decoded, err := sender.Recv()
+	if err != nil {
+		t.Fatalf("Error receiving: %s", err)
+	}
+	if decoded.Codec != "" || decoded.Type != msg.Type || !bytes.Equal(decoded.Payload, msg.Payload) || decoded.Timestamp.Seconds != msg.Timestamp.Seconds {
+		t.Errorf("Expected the message sent, got %v", decoded)
+	}
+	if _, err := decodeMessage(&pb.Message{Type: pb.Message_CHAIN_TRANSACTION, Codec: "msgpack"}); err == nil {
+		t.Error("Expected a message of an unsupported codec not to be decoded")
+	}
+}
+
+func TestCorrelatedMessengerCodec(t *testing.T) {
+	stream := &handshakeStream{recv: make(chan *pb.Message, 1), sent: make(chan *pb.Message, 1)}
+	defer close(stream.recv)
+	m := NewCorrelatedMessenger(stream, nil)
+	m.SetCodec(jsonCodec{})
+	go func() {
+		request, err := decodeMessage(<-stream.sent)
+		if err != nil || request.Codec != "" || string(request.Payload) != "root" {
+			t.Errorf("Expected a request encoded with json, got %v, %v", request, err)
+		}
+		reply, _ := encodeMessage(jsonCodec{}, &pb.Message{Type: pb.Message_CHAIN_STATE_ROOT, Payload: request.Payload, CorrelationID: request.CorrelationID})
+		stream.recv <- reply
+	}()
+	reply, err := m.Request(context.Background(), &pb.Message{Type: pb.Message_CHAIN_GET_STATE_ROOT, Payload: []byte("root")})
+	if err != nil {
+		t.Fatalf("Error requesting: %s", err)
+	}
+	if reply.Type != pb.Message_CHAIN_STATE_ROOT || string(reply.Payload) != "root" {
+		t.Errorf("Expected the decoded reply, got %v", reply)
+	}
+}
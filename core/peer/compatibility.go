@@ -0,0 +1,84 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// ProtocolVersion is the version of the protocol spoken by this peer,
+// advertised in the DISC_HELLO
+const ProtocolVersion = "2"
+
+// legacyProtocolVersion is the version of the peers whose DISC_HELLO has no
+// protocolVersion
+const legacyProtocolVersion = "1"
+
+// fragmentFeature has query responses too large for a message split into
+// fragments flagged with more
+const fragmentFeature = "FRAG"
+
+// compatibilityMatrixJSON lists by local then remote protocol version the
+// features peers of these versions both use
+const compatibilityMatrixJSON = `{
+	"1": {"1": [], "2": []},
+	"2": {"1": [], "2": ["FRAG", "NONCE", "BATCH"]}
+}`
+
+// defaultCompatibilityMatrix is the compatibility matrix of this peer
+var defaultCompatibilityMatrix = mustNewCompatibilityMatrix(compatibilityMatrixJSON)
+
+// CompatibilityMatrix maps the protocol versions of two peers to the features
+// they both use
+type CompatibilityMatrix struct {
+	features map[string]map[string][]string
+}
+
+// NewCompatibilityMatrix returns the matrix of the JSON document, an object of
+// local versions to objects of remote versions to arrays of features
+func NewCompatibilityMatrix(document []byte) (*CompatibilityMatrix, error) {
+	features := make(map[string]map[string][]string)
+	if err := json.Unmarshal(document, &features); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling compatibility matrix: %s", err)
+	}
+	return &CompatibilityMatrix{features: features}, nil
+}
+
+func mustNewCompatibilityMatrix(document string) *CompatibilityMatrix {
+	m, err := NewCompatibilityMatrix([]byte(document))
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Lookup returns the features supported by a peer of version local chatting
+// with one of version remote, none if the matrix does not list the versions
+func (m *CompatibilityMatrix) Lookup(local, remote string) []string {
+	return m.features[local][remote]
+}
+
+// remoteProtocolVersion returns the protocol version the DISC_HELLO advertises
+func remoteProtocolVersion(hello *pb.HelloMessage) string {
+	if hello.ProtocolVersion == "" {
+		return legacyProtocolVersion
+	}
+	return hello.ProtocolVersion
+}
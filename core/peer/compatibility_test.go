@@ -0,0 +1,49 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestCompatibilityMatrixLookup(t *testing.T) {
+	if features := defaultCompatibilityMatrix.Lookup(ProtocolVersion, ProtocolVersion); len(features) != 3 || features[0] != fragmentFeature || features[1] != nonceFeature || features[2] != batchFeature {
+		t.Errorf("Expected peers of the current version to use %s, %s and %s, got %v", fragmentFeature, nonceFeature, batchFeature, features)
+	}
+	if features := defaultCompatibilityMatrix.Lookup(ProtocolVersion, remoteProtocolVersion(&pb.HelloMessage{})); features == nil || len(features) != 0 {
+		t.Errorf("Expected version 1 peers to be known and use no features, got %v", features)
+	}
+	if features := defaultCompatibilityMatrix.Lookup(ProtocolVersion, "9"); features != nil {
+		t.Errorf("Expected no features for an unknown version, got %v", features)
+	}
+	if _, err := NewCompatibilityMatrix([]byte(`{"2": ["FRAG"]}`)); err == nil {
+		t.Error("Expected an error for a matrix without remote versions")
+	}
+}
+
+func TestHandlerQueryFragmentSize(t *testing.T) {
+	d := &Handler{features: defaultCompatibilityMatrix.Lookup(ProtocolVersion, legacyProtocolVersion)}
+	if d.HasFeature(fragmentFeature) || d.queryFragmentSize() != 0 {
+		t.Errorf("Expected version 1 peers to get query responses in one message, got fragments of %d bytes", d.queryFragmentSize())
+	}
+	d.features = defaultCompatibilityMatrix.Lookup(ProtocolVersion, "2")
+	if !d.HasFeature(fragmentFeature) || d.queryFragmentSize() != queryFragmentSize() {
+		t.Errorf("Expected version 2 peers to get fragments of %d bytes, got %d", queryFragmentSize(), d.queryFragmentSize())
+	}
+}
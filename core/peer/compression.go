@@ -0,0 +1,193 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// compressionCapabilityPrefix prefixes the algorithms advertised in the
+// supported capabilities of a DISC_HELLO, as in compression.zlib
+const compressionCapabilityPrefix = "compression."
+
+// compressionCodec compresses and decompresses the payloads of an algorithm
+type compressionCodec struct {
+	compress   func([]byte) ([]byte, error)
+	decompress func([]byte) ([]byte, error)
+}
+
+// compressionPreference lists the algorithms in the order they are tried
+var compressionPreference = []string{"zstd", "zlib"}
+
+// compressionCodecs are the algorithms this peer can compress with. No zstd
+// library is vendored, zstd is only negotiated once a codec is registered for
+// it, zlib being used until then.
+var compressionCodecs = map[string]compressionCodec{
+	"zlib": {compress: zlibCompress, decompress: zlibDecompress},
+}
+
+func zlibCompress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func zlibDecompress(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// compressionAlgorithms returns the algorithms advertised in capabilities
+func compressionAlgorithms(capabilities []string) map[string]bool {
+	algorithms := make(map[string]bool)
+	for _, c := range capabilities {
+		if strings.HasPrefix(c, compressionCapabilityPrefix) {
+			algorithms[strings.TrimPrefix(c, compressionCapabilityPrefix)] = true
+		}
+	}
+	return algorithms
+}
+
+// negotiateCompression returns the first algorithm of compressionPreference
+// advertised by both peers that this peer has a codec for, empty if none
+func negotiateCompression(local, remote []string) string {
+	localAlgorithms, remoteAlgorithms := compressionAlgorithms(local), compressionAlgorithms(remote)
+	for _, algorithm := range compressionPreference {
+		if _, ok := compressionCodecs[algorithm]; ok && localAlgorithms[algorithm] && remoteAlgorithms[algorithm] {
+			return algorithm
+		}
+	}
+	return ""
+}
+
+// CompressionNegotiator is a ChatStream compressing the payloads it sends
+// with the algorithm negotiated from the capabilities of the DISC_HELLO sent
+// and of the one received. Messages are sent uncompressed until both are
+// seen, and compressed ones carry their algorithm, so that received messages
+// are decompressed whatever the state of the negotiation. Payloads which do
+// not shrink are sent as they are.
+type CompressionNegotiator struct {
+	ChatStream
+	sync.RWMutex
+	local, remote         []string
+	localSeen, remoteSeen bool
+	algorithm             string
+}
+
+// NewCompressionNegotiator returns the stream wrapped in a CompressionNegotiator
+func NewCompressionNegotiator(stream ChatStream) *CompressionNegotiator {
+	return &CompressionNegotiator{ChatStream: stream}
+}
+
+// CompressionAlgorithm returns the algorithm the payloads sent are compressed
+// with, empty if none was negotiated
+func (n *CompressionNegotiator) CompressionAlgorithm() string {
+	n.RLock()
+	defer n.RUnlock()
+	return n.algorithm
+}
+
+// Send compresses and sends the message
+func (n *CompressionNegotiator) Send(msg *pb.Message) error {
+	if msg.Type == pb.Message_DISC_HELLO {
+		n.observeHello(msg, true)
+		return n.ChatStream.Send(msg)
+	}
+	algorithm := n.CompressionAlgorithm()
+	if algorithm == "" || msg.Compression != "" || len(msg.Payload) == 0 {
+		return n.ChatStream.Send(msg)
+	}
+	payload, err := compressionCodecs[algorithm].compress(msg.Payload)
+	if err != nil {
+		return fmt.Errorf("Error compressing %s with %s: %s", msg.Type, algorithm, err)
+	}
+	if len(payload) >= len(msg.Payload) {
+		return n.ChatStream.Send(msg)
+	}
+	compressed := *msg
+	compressed.Payload = payload
+	compressed.Compression = algorithm
+	return n.ChatStream.Send(&compressed)
+}
+
+// Recv receives and decompresses a message
+func (n *CompressionNegotiator) Recv() (*pb.Message, error) {
+	msg, err := n.ChatStream.Recv()
+	if err != nil {
+		return msg, err
+	}
+	if msg.Compression != "" {
+		codec, ok := compressionCodecs[msg.Compression]
+		if !ok {
+			return nil, fmt.Errorf("Received %s compressed with unsupported algorithm %s", msg.Type, msg.Compression)
+		}
+		if msg.Payload, err = codec.decompress(msg.Payload); err != nil {
+			return nil, fmt.Errorf("Error decompressing %s with %s: %s", msg.Type, msg.Compression, err)
+		}
+		msg.Compression = ""
+	}
+	if msg.Type == pb.Message_DISC_HELLO {
+		n.observeHello(msg, false)
+	}
+	return msg, nil
+}
+
+// observeHello records the capabilities of a DISC_HELLO, renegotiating the
+// algorithm once both the local and the remote one are seen
+func (n *CompressionNegotiator) observeHello(msg *pb.Message, sent bool) {
+	hello := &pb.HelloMessage{}
+	if err := proto.Unmarshal(msg.Payload, hello); err != nil {
+		return
+	}
+	n.Lock()
+	defer n.Unlock()
+	if sent {
+		n.local, n.localSeen = hello.SupportedCapabilities, true
+	} else {
+		n.remote, n.remoteSeen = hello.SupportedCapabilities, true
+	}
+	if !n.localSeen || !n.remoteSeen {
+		return
+	}
+	if algorithm := negotiateCompression(n.local, n.remote); algorithm != n.algorithm {
+		n.algorithm = algorithm
+		if algorithm == "" {
+			peerLogger.Debug("No compression algorithm shared with the remote peer, sending payloads uncompressed")
+		} else {
+			peerLogger.Debugf("Compressing Chat payloads with %s", algorithm)
+		}
+	}
+}
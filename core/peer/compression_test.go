@@ -0,0 +1,120 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func newCapabilitiesHello(t *testing.T, capabilities ...string) *pb.Message {
+	data, err := proto.Marshal(&pb.HelloMessage{SupportedCapabilities: capabilities})
+	if err != nil {
+		t.Fatalf("Error marshalling HelloMessage: %s", err)
+	}
+	return &pb.Message{Type: pb.Message_DISC_HELLO, Payload: data}
+}
+
+func TestNegotiateCompression(t *testing.T) {
+	if algorithm := negotiateCompression([]string{"compression.zstd", "compression.zlib"}, []string{"compression.zstd", "compression.zlib"}); algorithm != "zlib" {
+		t.Errorf("Expected zlib without a zstd codec, got %q", algorithm)
+	}
+	if algorithm := negotiateCompression([]string{"compression.zlib", peersDiffCapability}, []string{peersDiffCapability}); algorithm != "" {
+		t.Errorf("Expected no compression when the remote peer supports none, got %q", algorithm)
+	}
+	compressionCodecs["zstd"] = compressionCodecs["zlib"]
+	defer delete(compressionCodecs, "zstd")
+	if algorithm := negotiateCompression([]string{"compression.zlib", "compression.zstd"}, []string{"compression.zstd", "compression.zlib"}); algorithm != "zstd" {
+		t.Errorf("Expected zstd to be preferred, got %q", algorithm)
+	}
+	if algorithm := negotiateCompression([]string{"compression.zlib", "compression.zstd"}, []string{"compression.zlib"}); algorithm != "zlib" {
+		t.Errorf("Expected the fallback to zlib, got %q", algorithm)
+	}
+}
+
+func TestCompressionNegotiatorRoundTrip(t *testing.T) {
+	inner := &handshakeStream{recv: make(chan *pb.Message, 1), sent: make(chan *pb.Message, 3)}
+	sender := NewCompressionNegotiator(inner)
+	payload := bytes.Repeat([]byte("transaction"), 100)
+	if err := sender.Send(&pb.Message{Type: pb.Message_CHAIN_TRANSACTION, Payload: payload}); err != nil {
+		t.Fatalf("Error sending: %s", err)
+	}
+	if msg := <-inner.sent; msg.Compression != "" {
+		t.Errorf("Expected no compression before the DISC_HELLO exchange, got %s", msg.Compression)
+	}
+
+	sender.Send(newCapabilitiesHello(t, "compression.zlib"))
+	<-inner.sent
+	inner.recv <- newCapabilitiesHello(t, "compression.zlib")
+	if _, err := sender.Recv(); err != nil {
+		t.Fatalf("Error receiving DISC_HELLO: %s", err)
+	}
+	if algorithm := sender.CompressionAlgorithm(); algorithm != "zlib" {
+		t.Fatalf("Expected zlib to be negotiated, got %q", algorithm)
+	}
+	msg := &pb.Message{Type: pb.Message_CHAIN_TRANSACTION, Payload: payload}
+	if err := sender.Send(msg); err != nil {
+		t.Fatalf("Error sending: %s", err)
+	}
+	if msg.Compression != "" || !bytes.Equal(msg.Payload, payload) {
+		t.Error("Expected the message sent to be left as it was")
+	}
+	compressed := <-inner.sent
+	if compressed.Compression != "zlib" || len(compressed.Payload) >= len(payload) {
+		t.Fatalf("Expected a zlib compressed payload shorter than %d bytes, got %q of %d bytes", len(payload), compressed.Compression, len(compressed.Payload))
+	}
+
+	// The receiving side decompresses whatever the state of its negotiation
+	receiverInner := &handshakeStream{recv: make(chan *pb.Message, 1)}
+	receiver := NewCompressionNegotiator(receiverInner)
+	receiverInner.recv <- compressed
+	received, err := receiver.Recv()
+	if err != nil {
+		t.Fatalf("Error receiving: %s", err)
+	}
+	if received.Compression != "" || !bytes.Equal(received.Payload, payload) {
+		t.Errorf("Expected the original payload, got %q of %d bytes", received.Compression, len(received.Payload))
+	}
+}
+
+func TestCompressionNegotiatorNoSharedAlgorithm(t *testing.T) {
+	inner := &handshakeStream{recv: make(chan *pb.Message, 1), sent: make(chan *pb.Message, 2)}
+	stream := NewCompressionNegotiator(inner)
+	stream.Send(newCapabilitiesHello(t, "compression.zlib"))
+	<-inner.sent
+	inner.recv <- newCapabilitiesHello(t, "compression.zstd")
+	stream.Recv()
+	if algorithm := stream.CompressionAlgorithm(); algorithm != "" {
+		t.Fatalf("Expected no compression, got %q", algorithm)
+	}
+	stream.Send(&pb.Message{Type: pb.Message_CHAIN_TRANSACTION, Payload: bytes.Repeat([]byte("a"), 100)})
+	if msg := <-inner.sent; msg.Compression != "" {
+		t.Errorf("Expected an uncompressed payload, got %s", msg.Compression)
+	}
+}
+
+func TestCompressionNegotiatorUnsupportedAlgorithm(t *testing.T) {
+	inner := &handshakeStream{recv: make(chan *pb.Message, 1)}
+	inner.recv <- &pb.Message{Type: pb.Message_CHAIN_TRANSACTION, Payload: []byte("data"), Compression: "zstd"}
+	if _, err := NewCompressionNegotiator(inner).Recv(); err == nil {
+		t.Error("Expected an error receiving a payload compressed with an unsupported algorithm")
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/hyperledger/fabric/core/crypto/primitives/ecies"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// ConfidentialTransactionProcessor interface enables a Peer to answer CHAIN_TRANSACTIONS_ENCRYPTED messages
+type ConfidentialTransactionProcessor interface {
+	ProcessConfidentialTransaction(encrypted *pb.EncryptedTransaction) *pb.Response
+}
+
+// encryptTransaction encrypts tx so that only the holder of the private key matching recipientKey can read it
+func encryptTransaction(recipientKey *ecdsa.PublicKey, tx *pb.Transaction) (*pb.EncryptedTransaction, error) {
+	der, err := x509.MarshalPKIXPublicKey(recipientKey)
+	if err != nil {
+		return nil, fmt.Errorf("Error encoding recipient public key: %s", err)
+	}
+	spi := ecies.NewSPI()
+	publicKey, err := spi.NewPublicKey(nil, recipientKey)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating recipient public key: %s", err)
+	}
+	cipher, err := spi.NewAsymmetricCipherFromPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating cipher: %s", err)
+	}
+	data, err := proto.Marshal(tx)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling transaction %s: %s", tx.Uuid, err)
+	}
+	encrypted, err := cipher.Process(data)
+	if err != nil {
+		return nil, fmt.Errorf("Error encrypting transaction %s: %s", tx.Uuid, err)
+	}
+	return &pb.EncryptedTransaction{RecipientPubKey: der, EncryptedPayload: encrypted}, nil
+}
+
+// decryptTransaction decrypts a transaction encrypted for the public key of key
+func decryptTransaction(key *ecdsa.PrivateKey, encrypted *pb.EncryptedTransaction) (*pb.Transaction, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("Error encoding public key: %s", err)
+	}
+	if !bytes.Equal(der, encrypted.RecipientPubKey) {
+		return nil, fmt.Errorf("Transaction is encrypted for another recipient")
+	}
+	spi := ecies.NewSPI()
+	privateKey, err := spi.NewPrivateKey(nil, key)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating private key: %s", err)
+	}
+	cipher, err := spi.NewAsymmetricCipherFromPrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating cipher: %s", err)
+	}
+	data, err := cipher.Process(encrypted.EncryptedPayload)
+	if err != nil {
+		return nil, fmt.Errorf("Error decrypting transaction: %s", err)
+	}
+	tx := &pb.Transaction{}
+	if err := proto.Unmarshal(data, tx); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling transaction: %s", err)
+	}
+	return tx, nil
+}
+
+// SendConfidentialTransactionToPeer encrypts tx for recipientKey, the
+// encryption key the peer at address sent in its DISC_HELLO, and sends it to
+// that peer to be processed
+func SendConfidentialTransactionToPeer(address string, recipientKey *ecdsa.PublicKey, tx *pb.Transaction) error {
+	encrypted, err := encryptTransaction(recipientKey, tx)
+	if err != nil {
+		return err
+	}
+	data, err := proto.Marshal(encrypted)
+	if err != nil {
+		return fmt.Errorf("Error marshalling EncryptedTransaction: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS_ENCRYPTED, Payload: data}
+	if _, err := requestOverChat(address, request, pb.Message_RESPONSE); err != nil {
+		return fmt.Errorf("Error sending confidential transaction %s to %s: %s", tx.Uuid, address, err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/crypto/primitives"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestConfidentialTransactionRoundTrip(t *testing.T) {
+	primitives.SetSecurityLevel("SHA3", 256)
+	key, err := primitives.NewECDSAKey()
+	if err != nil {
+		t.Fatalf("Error generating key: %s", err)
+	}
+	other, err := primitives.NewECDSAKey()
+	if err != nil {
+		t.Fatalf("Error generating key: %s", err)
+	}
+	tx := &pb.Transaction{Uuid: "tx1", Payload: []byte("confidential")}
+	encrypted, err := encryptTransaction(&key.PublicKey, tx)
+	if err != nil {
+		t.Fatalf("Error encrypting transaction: %s", err)
+	}
+	if bytes.Contains(encrypted.EncryptedPayload, tx.Payload) {
+		t.Error("Expected the transaction payload not to appear in the encrypted payload")
+	}
+	decrypted, err := decryptTransaction(key, encrypted)
+	if err != nil {
+		t.Fatalf("Error decrypting transaction: %s", err)
+	}
+	if decrypted.Uuid != tx.Uuid || !bytes.Equal(decrypted.Payload, tx.Payload) {
+		t.Errorf("Expected %v, got %v", tx, decrypted)
+	}
+	if _, err := decryptTransaction(other, encrypted); err == nil {
+		t.Error("Expected a transaction encrypted for another recipient to be rejected")
+	}
+}
@@ -0,0 +1,263 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+var conflictDetectionHistogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Namespace: "peer",
+	Name:      "tx_conflict_detection_seconds",
+	Help:      "Time spent detecting the conflicts of the transactions of a CHAIN_TRANSACTIONS batch with the pending transactions.",
+})
+
+var conflictPendingGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "peer",
+	Name:      "tx_conflict_pending",
+	Help:      "Number of transactions tracked for conflicts, as of the last CHAIN_TRANSACTIONS batch.",
+})
+
+func init() {
+	prometheus.MustRegister(conflictDetectionHistogram)
+	prometheus.MustRegister(conflictPendingGauge)
+}
+
+// ConflictPolicy is what is done with the transactions of a batch conflicting
+// with pending transactions
+type ConflictPolicy string
+
+const (
+	// ConflictReorder processes conflicting transactions after the other transactions of their batch
+	ConflictReorder ConflictPolicy = "reorder"
+	// ConflictReject reports conflicting transactions as violations without processing them
+	ConflictReject ConflictPolicy = "reject"
+	// ConflictQueue processes conflicting transactions once those they conflict with are no longer pending
+	ConflictQueue ConflictPolicy = "queue"
+)
+
+// conflictQueuePollInterval is how often queued transactions check whether
+// the transactions they conflict with are still pending
+const conflictQueuePollInterval = 100 * time.Millisecond
+
+// TransactionConflict is a transaction writing state read or written by the
+// pending transactions Predecessors
+type TransactionConflict struct {
+	Tx           *pb.Transaction
+	Predecessors []string
+}
+
+// stateAccess is the read and write sets of a pending transaction
+type stateAccess struct {
+	reads  map[string]bool
+	writes map[string]bool
+	since  time.Time
+}
+
+// ConflictDetector tracks the read and write sets of the transactions
+// processed by this peer until they are committed, or for window at most, for
+// the transactions writing state they read or write to be detected
+type ConflictDetector struct {
+	sync.Mutex
+	Policy    ConflictPolicy
+	window    time.Duration
+	committed func(txID string) bool
+	pending   map[string]*stateAccess
+	now       func() time.Time
+}
+
+// NewConflictDetector returns a detector applying policy to the conflicts
+// with the transactions processed less than window ago and not yet committed
+func NewConflictDetector(policy ConflictPolicy, window time.Duration, committed func(txID string) bool) (*ConflictDetector, error) {
+	switch policy {
+	case ConflictReorder, ConflictReject, ConflictQueue:
+	default:
+		return nil, fmt.Errorf("Invalid conflict policy %q, expected %s, %s or %s", policy, ConflictReorder, ConflictReject, ConflictQueue)
+	}
+	return &ConflictDetector{Policy: policy, window: window, committed: committed, pending: make(map[string]*stateAccess), now: time.Now}, nil
+}
+
+// newConflictDetectorFromConfig returns a detector applying
+// peer.tx.conflictPolicy, reorder if empty, over peer.tx.conflictWindow, or
+// nil if no window is configured
+func newConflictDetectorFromConfig(committed func(txID string) bool) (*ConflictDetector, error) {
+	window := viper.GetDuration("peer.tx.conflictWindow")
+	if window <= 0 {
+		return nil, nil
+	}
+	policy := ConflictPolicy(viper.GetString("peer.tx.conflictPolicy"))
+	if policy == "" {
+		policy = ConflictReorder
+	}
+	return NewConflictDetector(policy, window, committed)
+}
+
+// stateKeys returns the keys of the state of the chaincode of tx
+func stateKeys(tx *pb.Transaction, keys []string) map[string]bool {
+	chaincodeKeys := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		chaincodeKeys[string(tx.ChaincodeID)+"\x00"+key] = true
+	}
+	return chaincodeKeys
+}
+
+// prune forgets the committed and expired transactions, the lock being held
+func (c *ConflictDetector) prune() {
+	for txID, access := range c.pending {
+		if c.now().Sub(access.since) > c.window || c.committed(txID) {
+			delete(c.pending, txID)
+		}
+	}
+}
+
+// predecessors returns the sorted IDs of the pending transactions reading or
+// writing state written by tx, the lock being held
+func (c *ConflictDetector) predecessors(tx *pb.Transaction, writes map[string]bool) []string {
+	var predecessors []string
+	for txID, access := range c.pending {
+		if txID == tx.Uuid {
+			continue
+		}
+		for key := range writes {
+			if access.reads[key] || access.writes[key] {
+				predecessors = append(predecessors, txID)
+				break
+			}
+		}
+	}
+	sort.Strings(predecessors)
+	return predecessors
+}
+
+// Partition splits the transactions into those free of conflicts and those
+// writing state read or written by pending transactions, earlier transactions
+// of the same batch included. Transactions declaring no read or write set
+// never conflict. The transactions returned are tracked as pending, the
+// conflicting ones but under ConflictReject. A nil ConflictDetector finds no
+// conflicts.
+func (c *ConflictDetector) Partition(transactions []*pb.Transaction) (ready []*pb.Transaction, conflicts []TransactionConflict) {
+	if c == nil {
+		return transactions, nil
+	}
+	start := time.Now()
+	c.Lock()
+	defer c.Unlock()
+	c.prune()
+	for _, tx := range transactions {
+		if len(tx.ReadSet) == 0 && len(tx.WriteSet) == 0 {
+			ready = append(ready, tx)
+			continue
+		}
+		access := &stateAccess{reads: stateKeys(tx, tx.ReadSet), writes: stateKeys(tx, tx.WriteSet), since: c.now()}
+		predecessors := c.predecessors(tx, access.writes)
+		if len(predecessors) == 0 {
+			ready = append(ready, tx)
+		} else {
+			conflicts = append(conflicts, TransactionConflict{Tx: tx, Predecessors: predecessors})
+			if c.Policy == ConflictReject {
+				continue
+			}
+		}
+		c.pending[tx.Uuid] = access
+	}
+	conflictPendingGauge.Set(float64(len(c.pending)))
+	conflictDetectionHistogram.Observe(time.Since(start).Seconds())
+	return ready, conflicts
+}
+
+// PendingCount returns the number of transactions tracked for conflicts
+func (c *ConflictDetector) PendingCount() int {
+	if c == nil {
+		return 0
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.prune()
+	return len(c.pending)
+}
+
+// anyPending returns true if one of the transactions is still pending
+func (c *ConflictDetector) anyPending(txIDs []string) bool {
+	c.Lock()
+	defer c.Unlock()
+	c.prune()
+	for _, txID := range txIDs {
+		if _, ok := c.pending[txID]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// waitForPredecessors returns once none of the predecessors is pending
+func (c *ConflictDetector) waitForPredecessors(predecessors []string) {
+	for c.anyPending(predecessors) {
+		time.Sleep(conflictQueuePollInterval)
+	}
+}
+
+// resolveConflicts returns the transactions of valid to process now under the
+// policy of the conflict detector, and the violations of those rejected.
+// Queued transactions are submitted in the background, once the transactions
+// they conflict with are no longer pending.
+func (p *PeerImpl) resolveConflicts(batch *pb.TransactionBlock, valid []*pb.Transaction, immediate bool) ([]*pb.Transaction, []*pb.ValidationViolation) {
+	ready, conflicts := p.conflicts.Partition(valid)
+	if len(conflicts) == 0 {
+		return ready, nil
+	}
+	var violations []*pb.ValidationViolation
+	for _, conflict := range conflicts {
+		peerLogger.Debugf("Transaction %s conflicts with pending transactions %v", conflict.Tx.Uuid, conflict.Predecessors)
+		switch p.conflicts.Policy {
+		case ConflictReorder:
+			ready = append(ready, conflict.Tx)
+		case ConflictReject:
+			violations = append(violations, &pb.ValidationViolation{
+				TxIndex: uint32(transactionIndex(batch.Transactions, conflict.Tx)),
+				TxID:    conflict.Tx.Uuid,
+				Field:   "writeSet",
+				Reason:  fmt.Sprintf("Conflicts with pending transactions %v", conflict.Predecessors),
+			})
+		case ConflictQueue:
+			go func(conflict TransactionConflict) {
+				p.conflicts.waitForPredecessors(conflict.Predecessors)
+				if _, err := p.submitTransactions(batch, []*pb.Transaction{conflict.Tx}, nil, immediate); err != nil {
+					peerLogger.Errorf("Error submitting queued transaction %s: %s", conflict.Tx.Uuid, err)
+				}
+			}(conflict)
+		}
+	}
+	return ready, violations
+}
+
+// transactionIndex returns the index of tx among the transactions, -1 if it is not one of them
+func transactionIndex(transactions []*pb.Transaction, tx *pb.Transaction) int {
+	for i, t := range transactions {
+		if t == tx {
+			return i
+		}
+	}
+	return -1
+}
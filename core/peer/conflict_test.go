@@ -0,0 +1,122 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// testCommitted is the committed func of a ConflictDetector over a set of transaction IDs
+type testCommitted struct {
+	sync.Mutex
+	txIDs map[string]bool
+}
+
+func (c *testCommitted) commit(txID string) {
+	c.Lock()
+	defer c.Unlock()
+	c.txIDs[txID] = true
+}
+
+func (c *testCommitted) committed(txID string) bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.txIDs[txID]
+}
+
+func conflictingBatch() []*pb.Transaction {
+	return []*pb.Transaction{
+		{Uuid: "reader", ChaincodeID: []byte("cc"), ReadSet: []string{"a"}},
+		{Uuid: "other", ChaincodeID: []byte("other"), WriteSet: []string{"a"}},
+		{Uuid: "plain", ChaincodeID: []byte("cc")},
+		{Uuid: "writer", ChaincodeID: []byte("cc"), WriteSet: []string{"a", "b"}},
+	}
+}
+
+func TestConflictDetectorPartition(t *testing.T) {
+	committed := &testCommitted{txIDs: make(map[string]bool)}
+	c, err := NewConflictDetector(ConflictReorder, time.Minute, committed.committed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ready, conflicts := c.Partition(conflictingBatch())
+	if len(ready) != 3 || len(conflicts) != 1 || conflicts[0].Tx.Uuid != "writer" || len(conflicts[0].Predecessors) != 1 || conflicts[0].Predecessors[0] != "reader" {
+		t.Fatalf("Expected the writer to conflict with the reader of its chaincode only, got %d ready and %v", len(ready), conflicts)
+	}
+	if count := c.PendingCount(); count != 3 {
+		t.Fatalf("Expected the transactions with read or write sets to be pending, got %d", count)
+	}
+	_, conflicts = c.Partition([]*pb.Transaction{{Uuid: "next", ChaincodeID: []byte("cc"), WriteSet: []string{"b"}}})
+	if len(conflicts) != 1 || len(conflicts[0].Predecessors) != 1 || conflicts[0].Predecessors[0] != "writer" {
+		t.Fatalf("Expected a conflict with the pending writer, got %v", conflicts)
+	}
+	committed.commit("writer")
+	committed.commit("next")
+	if _, conflicts = c.Partition([]*pb.Transaction{{Uuid: "last", ChaincodeID: []byte("cc"), WriteSet: []string{"b"}}}); len(conflicts) != 0 {
+		t.Fatalf("Expected no conflict with committed transactions, got %v", conflicts)
+	}
+	c.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if count := c.PendingCount(); count != 0 {
+		t.Fatalf("Expected the transactions older than the window to expire, got %d pending", count)
+	}
+	if _, err := NewConflictDetector("drop", time.Minute, committed.committed); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+}
+
+func TestConflictPolicies(t *testing.T) {
+	committed := &testCommitted{txIDs: make(map[string]bool)}
+	batch := &pb.TransactionBlock{Transactions: conflictingBatch()}
+	p := &PeerImpl{}
+	p.conflicts, _ = NewConflictDetector(ConflictReorder, time.Minute, committed.committed)
+	if ready, violations := p.resolveConflicts(batch, batch.Transactions, false); len(ready) != 4 || ready[3].Uuid != "writer" || violations != nil {
+		t.Fatalf("Expected the conflicting transaction to be processed last, got %v, %v", ready, violations)
+	}
+	p.conflicts, _ = NewConflictDetector(ConflictReject, time.Minute, committed.committed)
+	ready, violations := p.resolveConflicts(batch, batch.Transactions, false)
+	if len(ready) != 3 || len(violations) != 1 || violations[0].TxIndex != 3 || violations[0].Field != "writeSet" {
+		t.Fatalf("Expected the conflicting transaction to be rejected, got %v, %v", ready, violations)
+	}
+	if p.conflicts.PendingCount() != 2 {
+		t.Errorf("Expected the rejected transaction not to be pending, got %d", p.conflicts.PendingCount())
+	}
+
+	p.conflicts, _ = NewConflictDetector(ConflictQueue, time.Minute, committed.committed)
+	if ready, violations := p.resolveConflicts(&pb.TransactionBlock{Transactions: batch.Transactions[:1]}, batch.Transactions[:1], false); len(ready) != 1 || violations != nil {
+		t.Fatalf("Expected the reader to be processed, got %v, %v", ready, violations)
+	}
+	done := make(chan struct{})
+	go func() {
+		p.conflicts.waitForPredecessors([]string{"reader"})
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Expected the queued transaction to wait for the pending reader")
+	case <-time.After(2 * conflictQueuePollInterval):
+	}
+	committed.commit("reader")
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the queued transaction to be released once the reader is committed")
+	}
+}
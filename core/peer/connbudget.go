@@ -0,0 +1,85 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// ConnectionBudget caps the Chat connections this peer dials, across the
+// gossip dials and the reconnections of the touch service. A token is
+// acquired before dialing and released once the Chat is over.
+type ConnectionBudget struct {
+	sync.Mutex
+	max   int
+	inUse int
+}
+
+// NewConnectionBudget returns a budget of max concurrent outbound
+// connections, 0 not capping them
+func NewConnectionBudget(max int) *ConnectionBudget {
+	return &ConnectionBudget{max: max}
+}
+
+// newConnectionBudgetFromConfig returns a budget of peer.chat.maxOutbound connections
+func newConnectionBudgetFromConfig() *ConnectionBudget {
+	return NewConnectionBudget(viper.GetInt("peer.chat.maxOutbound"))
+}
+
+// TryAcquire takes a token, returning false if the budget is exhausted
+func (b *ConnectionBudget) TryAcquire() bool {
+	b.Lock()
+	defer b.Unlock()
+	if b.max > 0 && b.inUse >= b.max {
+		return false
+	}
+	b.inUse++
+	return true
+}
+
+// Release returns a token taken by TryAcquire
+func (b *ConnectionBudget) Release() {
+	b.Lock()
+	defer b.Unlock()
+	if b.inUse > 0 {
+		b.inUse--
+	}
+}
+
+// Available returns the number of connections that may still be dialed, -1 if not capped
+func (b *ConnectionBudget) Available() int {
+	b.Lock()
+	defer b.Unlock()
+	if b.max <= 0 {
+		return -1
+	}
+	return b.max - b.inUse
+}
+
+// InUse returns the number of outbound connections holding a token
+func (b *ConnectionBudget) InUse() int {
+	b.Lock()
+	defer b.Unlock()
+	return b.inUse
+}
+
+// GetConnectionBudget returns the budget of the Chat connections this peer dials
+func (p *PeerImpl) GetConnectionBudget() *ConnectionBudget {
+	return p.connBudget
+}
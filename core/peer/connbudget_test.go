@@ -0,0 +1,70 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+)
+
+func TestConnectionBudget(t *testing.T) {
+	budget := NewConnectionBudget(2)
+	if budget.Available() != 2 || budget.InUse() != 0 {
+		t.Fatalf("Expected 2 connections available and none in use, got %d and %d", budget.Available(), budget.InUse())
+	}
+	if !budget.TryAcquire() || !budget.TryAcquire() {
+		t.Fatal("Expected the budget to allow 2 connections")
+	}
+	if budget.TryAcquire() {
+		t.Fatal("Expected the exhausted budget to refuse a connection")
+	}
+	if budget.Available() != 0 || budget.InUse() != 2 {
+		t.Fatalf("Expected no connection available and 2 in use, got %d and %d", budget.Available(), budget.InUse())
+	}
+	budget.Release()
+	if !budget.TryAcquire() {
+		t.Fatal("Expected a released token to be acquired again")
+	}
+	budget.Release()
+	budget.Release()
+	budget.Release()
+	if budget.InUse() != 0 {
+		t.Fatalf("Expected releasing more than acquired to stop at 0, got %d", budget.InUse())
+	}
+}
+
+func TestConnectionBudgetUnlimited(t *testing.T) {
+	budget := NewConnectionBudget(0)
+	for i := 0; i < 100; i++ {
+		if !budget.TryAcquire() {
+			t.Fatalf("Expected an uncapped budget to allow connection %d", i)
+		}
+	}
+	if budget.Available() != -1 || budget.InUse() != 100 {
+		t.Fatalf("Expected an uncapped budget with 100 in use, got %d available and %d in use", budget.Available(), budget.InUse())
+	}
+}
+
+func TestChatWithPeerOverBudget(t *testing.T) {
+	p := &PeerImpl{connBudget: NewConnectionBudget(1)}
+	p.connBudget.TryAcquire()
+	if err := p.chatWithPeer("localhost:1"); err == nil {
+		t.Fatal("Expected the dial to be skipped with the budget exhausted")
+	}
+	if p.connBudget.InUse() != 1 {
+		t.Fatalf("Expected the skipped dial not to hold a token, got %d in use", p.connBudget.InUse())
+	}
+}
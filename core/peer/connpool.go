@@ -0,0 +1,355 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+var errConnectionPoolClosed = errors.New("Peer connection pool closed")
+
+// defaultMaxIdleConnsPerPeer is the idle connections kept per peer if
+// peer.chat.maxIdleConnsPerPeer is not set
+const defaultMaxIdleConnsPerPeer = 2
+
+// PoolConfig configures a PeerConnectionPool
+type PoolConfig struct {
+	// MaxIdlePerPeer is the most idle connections kept per peer, 2 if not set
+	MaxIdlePerPeer int
+	// IdleTimeout is how long a connection is kept idle before it is closed,
+	// 0 keeping idle connections until they are used or the pool is closed
+	IdleTimeout time.Duration
+	// CleanupInterval is how often the idle connections are checked against
+	// IdleTimeout, IdleTimeout if not set
+	CleanupInterval time.Duration
+}
+
+// idleConn is a connection kept idle in a PeerConnectionPool since its release
+type idleConn struct {
+	conn  *grpc.ClientConn
+	since time.Time
+}
+
+// PeerConnectionPool keeps the idle gRPC connections to peers, for requests
+// to a peer to reuse a connection rather than dial one each time. Connections
+// are dialed with NewPeerClientConnectionWithAddress, so with its TLS
+// settings, adaptive dial timeout and reconnect rate limit. A nil pool dials
+// a connection for every Get and closes it on Release.
+type PeerConnectionPool struct {
+	sync.RWMutex
+	dial        func(address string) (*grpc.ClientConn, error)
+	idle        map[string][]idleConn
+	maxIdle     int
+	idleTimeout time.Duration
+	closed      bool
+	stop        chan struct{}
+}
+
+// NewPeerConnectionPool returns a pool without any connection configured by
+// peer.chat.maxIdleConnsPerPeer, peer.chat.idleConnTimeout and
+// peer.chat.idleConnCleanupInterval
+func NewPeerConnectionPool() *PeerConnectionPool {
+	return NewPeerConnectionPoolWithConfig(PoolConfig{
+		MaxIdlePerPeer:  viper.GetInt("peer.chat.maxIdleConnsPerPeer"),
+		IdleTimeout:     viper.GetDuration("peer.chat.idleConnTimeout"),
+		CleanupInterval: viper.GetDuration("peer.chat.idleConnCleanupInterval"),
+	})
+}
+
+// NewPeerConnectionPoolWithConfig returns a pool without any connection
+// configured by config. With an IdleTimeout, the idle connections are closed
+// in the background once idle for longer, until the pool is closed.
+func NewPeerConnectionPoolWithConfig(config PoolConfig) *PeerConnectionPool {
+	if config.MaxIdlePerPeer <= 0 {
+		config.MaxIdlePerPeer = defaultMaxIdleConnsPerPeer
+	}
+	pool := &PeerConnectionPool{
+		dial:        NewPeerClientConnectionWithAddress,
+		idle:        make(map[string][]idleConn),
+		maxIdle:     config.MaxIdlePerPeer,
+		idleTimeout: config.IdleTimeout,
+		stop:        make(chan struct{}),
+	}
+	if config.IdleTimeout > 0 {
+		interval := config.CleanupInterval
+		if interval <= 0 {
+			interval = config.IdleTimeout
+		}
+		go pool.cleanupIdle(interval)
+	}
+	return pool
+}
+
+// cleanupIdle closes the connections idle for longer than the idle timeout
+// of the pool every interval, until the pool is closed
+func (p *PeerConnectionPool) cleanupIdle(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			p.evictIdle(now)
+		}
+	}
+}
+
+// evictIdle closes the connections idle since before now less the idle
+// timeout of the pool, returning how many were. Connections borrowed by Get
+// are not idle until released, so requests in flight never lose theirs.
+func (p *PeerConnectionPool) evictIdle(now time.Time) int {
+	cutoff := now.Add(-p.idleTimeout)
+	// Most scans find nothing to evict, without holding up Get and Release
+	p.RLock()
+	expired := false
+	for _, conns := range p.idle {
+		for _, idle := range conns {
+			expired = expired || idle.since.Before(cutoff)
+		}
+	}
+	p.RUnlock()
+	if !expired {
+		return 0
+	}
+	type eviction struct {
+		address string
+		idleConn
+	}
+	var evicted []eviction
+	p.Lock()
+	for address, conns := range p.idle {
+		kept := conns[:0]
+		for _, idle := range conns {
+			if idle.since.Before(cutoff) {
+				evicted = append(evicted, eviction{address, idle})
+			} else {
+				kept = append(kept, idle)
+			}
+		}
+		if len(kept) == 0 {
+			delete(p.idle, address)
+		} else {
+			p.idle[address] = kept
+		}
+	}
+	p.Unlock()
+	for _, e := range evicted {
+		peerLogger.Debugf("Closing connection to %s idle for %s", e.address, now.Sub(e.since))
+		e.conn.Close()
+	}
+	return len(evicted)
+}
+
+var defaultConnectionPool struct {
+	sync.Once
+	pool *PeerConnectionPool
+}
+
+// DefaultPeerConnectionPool returns the pool of SendTransactionsToPeer
+func DefaultPeerConnectionPool() *PeerConnectionPool {
+	defaultConnectionPool.Do(func() {
+		defaultConnectionPool.pool = NewPeerConnectionPool()
+	})
+	return defaultConnectionPool.pool
+}
+
+// connUsable returns whether conn may carry new requests, those shut down or
+// whose transport failed, such as when the remote peer closed it, being
+// dialed again
+func connUsable(conn *grpc.ClientConn) bool {
+	switch conn.State() {
+	case grpc.Shutdown, grpc.TransientFailure:
+		return false
+	}
+	return true
+}
+
+// Get returns an idle connection to the peer at address, dialing one if
+// there is none. The connection is to be given back with Release.
+func (p *PeerConnectionPool) Get(address string) (*grpc.ClientConn, error) {
+	if p == nil {
+		return NewPeerClientConnectionWithAddress(address)
+	}
+	p.Lock()
+	if p.closed {
+		p.Unlock()
+		return nil, errConnectionPoolClosed
+	}
+	var stale []*grpc.ClientConn
+	var conn *grpc.ClientConn
+	idle := p.idle[address]
+	for len(idle) > 0 && conn == nil {
+		candidate := idle[len(idle)-1].conn
+		idle = idle[:len(idle)-1]
+		if connUsable(candidate) {
+			conn = candidate
+		} else {
+			stale = append(stale, candidate)
+		}
+	}
+	if len(idle) == 0 {
+		delete(p.idle, address)
+	} else {
+		p.idle[address] = idle
+	}
+	p.Unlock()
+	for _, c := range stale {
+		peerLogger.Debugf("Dropping connection to %s in state %s", address, c.State())
+		c.Close()
+	}
+	if conn != nil {
+		return conn, nil
+	}
+	return p.dial(address)
+}
+
+// Release gives back a connection returned by Get for address, kept for the
+// next Get unless it is no longer usable, the peer already has the most idle
+// connections kept or the pool is closed
+func (p *PeerConnectionPool) Release(address string, conn *grpc.ClientConn) {
+	if conn == nil {
+		return
+	}
+	if p != nil {
+		p.Lock()
+		if !p.closed && connUsable(conn) && len(p.idle[address]) < p.maxIdle {
+			p.idle[address] = append(p.idle[address], idleConn{conn: conn, since: time.Now()})
+			p.Unlock()
+			return
+		}
+		p.Unlock()
+	}
+	conn.Close()
+}
+
+// PoolWarmup dials connectionsPerAddress connections to each of addresses in
+// parallel and keeps them idle in the pool, for the first requests to these
+// peers not to wait for a dial. No more connections than the idle ones kept
+// per peer are dialed. A warning is logged for every address none could be
+// dialed to, the others still being warmed. It returns once every dial is
+// done, or with the error of ctx if it is done first, the dials still
+// running then filling the pool as they complete.
+func (p *PeerConnectionPool) PoolWarmup(ctx context.Context, addresses []string, connectionsPerAddress int) error {
+	if p == nil {
+		return nil
+	}
+	p.Lock()
+	closed, maxIdle := p.closed, p.maxIdle
+	p.Unlock()
+	if closed {
+		return errConnectionPoolClosed
+	}
+	if connectionsPerAddress > maxIdle {
+		connectionsPerAddress = maxIdle
+	}
+	var wg sync.WaitGroup
+	for _, address := range addresses {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+			p.warmAddress(address, connectionsPerAddress)
+		}(address)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("Connection pool warm-up interrupted: %s", ctx.Err())
+	}
+}
+
+// warmAddress dials n connections to the peer at address in parallel and
+// releases them to the pool
+func (p *PeerConnectionPool) warmAddress(address string, n int) {
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			conn, err := p.dial(address)
+			if err == nil {
+				p.Release(address, conn)
+			}
+			errs <- err
+		}()
+	}
+	var warmed int
+	var lastErr error
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			lastErr = err
+		} else {
+			warmed++
+		}
+	}
+	if warmed == 0 && lastErr != nil {
+		peerLogger.Warningf("Unable to warm the connection pool for %s: %s", address, lastErr)
+		return
+	}
+	peerLogger.Debugf("Warmed %d of %d connections to %s", warmed, n, address)
+}
+
+// warmConnectionPoolFromConfig warms DefaultPeerConnectionPool with
+// peer.chat.warmupConnsPerPeer connections to each of addresses within
+// peer.chat.warmupTimeout, if set
+func warmConnectionPoolFromConfig(addresses []string) {
+	n := viper.GetInt("peer.chat.warmupConnsPerPeer")
+	if n <= 0 || len(addresses) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("peer.chat.warmupTimeout"))
+	defer cancel()
+	if err := DefaultPeerConnectionPool().PoolWarmup(ctx, addresses, n); err != nil {
+		peerLogger.Warningf("%s", err)
+	}
+}
+
+// Close closes the idle connections of the pool, and those released from now
+// on. It returns the first error closing a connection.
+func (p *PeerConnectionPool) Close() error {
+	if p == nil {
+		return nil
+	}
+	p.Lock()
+	idle := p.idle
+	p.idle = make(map[string][]idleConn)
+	if !p.closed {
+		close(p.stop)
+	}
+	p.closed = true
+	p.Unlock()
+	var err error
+	for _, conns := range idle {
+		for _, idle := range conns {
+			if closeErr := idle.conn.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	}
+	return err
+}
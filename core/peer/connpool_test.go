@@ -0,0 +1,306 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/comm"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// newTestGRPCServer starts a gRPC server without any service on a local
+// port, returning its address and the function stopping it
+func newTestGRPCServer(t *testing.T) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %s", err)
+	}
+	server := grpc.NewServer()
+	go server.Serve(listener)
+	return listener.Addr().String(), server.Stop
+}
+
+// newCountingConnectionPool returns a pool dialing without TLS, counting its
+// dials in dials
+func newCountingConnectionPool(dials *int) *PeerConnectionPool {
+	pool := NewPeerConnectionPool()
+	pool.dial = func(address string) (*grpc.ClientConn, error) {
+		*dials++
+		return comm.NewClientConnectionWithAddress(address, true, false, nil)
+	}
+	return pool
+}
+
+func TestPeerConnectionPoolReuse(t *testing.T) {
+	var dials int
+	pool := newCountingConnectionPool(&dials)
+	defer pool.Close()
+	address, stop := newTestGRPCServer(t)
+	defer stop()
+	first, err := pool.Get(address)
+	if err != nil {
+		t.Fatalf("Error dialing %s: %s", address, err)
+	}
+	pool.Release(address, first)
+	second, err := pool.Get(address)
+	if err != nil {
+		t.Fatalf("Error getting a connection to %s: %s", address, err)
+	}
+	if second != first || dials != 1 {
+		t.Fatalf("Expected the released connection to be reused, got %d dials", dials)
+	}
+	// A connection in use is not handed out twice
+	third, err := pool.Get(address)
+	if err != nil {
+		t.Fatalf("Error dialing %s: %s", address, err)
+	}
+	if third == second || dials != 2 {
+		t.Fatalf("Expected a connection in use to be dialed again, got %d dials", dials)
+	}
+	pool.Release(address, second)
+	pool.Release(address, third)
+}
+
+func TestPeerConnectionPoolRedialsShutdown(t *testing.T) {
+	var dials int
+	pool := newCountingConnectionPool(&dials)
+	defer pool.Close()
+	address, stop := newTestGRPCServer(t)
+	defer stop()
+	conn, err := pool.Get(address)
+	if err != nil {
+		t.Fatalf("Error dialing %s: %s", address, err)
+	}
+	pool.Release(address, conn)
+	// Shut down while idle, as when the remote peer closes it
+	conn.Close()
+	redialed, err := pool.Get(address)
+	if err != nil {
+		t.Fatalf("Error dialing %s: %s", address, err)
+	}
+	if redialed == conn || dials != 2 || !connUsable(redialed) {
+		t.Fatalf("Expected the shut down connection to be dialed again, got %d dials", dials)
+	}
+	// A connection shut down while in use is not kept
+	redialed.Close()
+	pool.Release(address, redialed)
+	if len(pool.idle[address]) != 0 {
+		t.Fatalf("Expected the shut down connection to be dropped, got %d idle", len(pool.idle[address]))
+	}
+}
+
+func TestPeerConnectionPoolClose(t *testing.T) {
+	var dials int
+	pool := newCountingConnectionPool(&dials)
+	address, stop := newTestGRPCServer(t)
+	defer stop()
+	idle, err := pool.Get(address)
+	if err != nil {
+		t.Fatalf("Error dialing %s: %s", address, err)
+	}
+	inUse, err := pool.Get(address)
+	if err != nil {
+		t.Fatalf("Error dialing %s: %s", address, err)
+	}
+	pool.Release(address, idle)
+	if err := pool.Close(); err != nil {
+		t.Fatalf("Error closing the pool: %s", err)
+	}
+	if idle.State() != grpc.Shutdown {
+		t.Errorf("Expected the idle connection to be closed, got %s", idle.State())
+	}
+	pool.Release(address, inUse)
+	if inUse.State() != grpc.Shutdown {
+		t.Errorf("Expected the connection released after closing to be closed, got %s", inUse.State())
+	}
+	if _, err := pool.Get(address); err != errConnectionPoolClosed {
+		t.Errorf("Expected the closed pool to refuse connections, got %v", err)
+	}
+}
+
+func TestPeerConnectionPoolMaxIdle(t *testing.T) {
+	var dials int
+	pool := newCountingConnectionPool(&dials)
+	defer pool.Close()
+	pool.maxIdle = 1
+	address, stop := newTestGRPCServer(t)
+	defer stop()
+	first, err := pool.Get(address)
+	if err != nil {
+		t.Fatalf("Error dialing %s: %s", address, err)
+	}
+	second, err := pool.Get(address)
+	if err != nil {
+		t.Fatalf("Error dialing %s: %s", address, err)
+	}
+	pool.Release(address, first)
+	pool.Release(address, second)
+	if len(pool.idle[address]) != 1 || pool.idle[address][0].conn != first {
+		t.Fatalf("Expected a single idle connection to be kept, got %d", len(pool.idle[address]))
+	}
+	if second.State() != grpc.Shutdown {
+		t.Errorf("Expected the connection released past the idle limit to be closed, got %s", second.State())
+	}
+}
+
+func TestNilPeerConnectionPoolClose(t *testing.T) {
+	var pool *PeerConnectionPool
+	if err := pool.Close(); err != nil {
+		t.Errorf("Expected closing a nil pool to do nothing, got %s", err)
+	}
+}
+
+func TestPeerConnectionPoolWarmup(t *testing.T) {
+	var mutex sync.Mutex
+	dials := make(map[string]int)
+	pool := NewPeerConnectionPool()
+	defer pool.Close()
+	pool.dial = func(address string) (*grpc.ClientConn, error) {
+		mutex.Lock()
+		dials[address]++
+		mutex.Unlock()
+		if address == "unreachable" {
+			return nil, fmt.Errorf("Connection refused")
+		}
+		return comm.NewClientConnectionWithAddress(address, true, false, nil)
+	}
+	first, stopFirst := newTestGRPCServer(t)
+	defer stopFirst()
+	second, stopSecond := newTestGRPCServer(t)
+	defer stopSecond()
+
+	// Three connections asked for, the two idle kept per peer dialed
+	if err := pool.PoolWarmup(context.Background(), []string{first, "unreachable", second}, 3); err != nil {
+		t.Fatalf("Expected the unreachable address not to fail the warm-up, got %s", err)
+	}
+	for _, address := range []string{first, second} {
+		if dials[address] != 2 || len(pool.idle[address]) != 2 {
+			t.Errorf("Expected 2 idle connections to %s, got %d dials and %d idle", address, dials[address], len(pool.idle[address]))
+		}
+	}
+	if len(pool.idle["unreachable"]) != 0 {
+		t.Errorf("Expected no idle connection to the unreachable address, got %d", len(pool.idle["unreachable"]))
+	}
+	conn, err := pool.Get(first)
+	if err != nil || dials[first] != 2 {
+		t.Fatalf("Expected a warmed connection without dialing, got %d dials, %v", dials[first], err)
+	}
+	pool.Release(first, conn)
+}
+
+func TestPeerConnectionPoolWarmupInterrupted(t *testing.T) {
+	pool := NewPeerConnectionPool()
+	defer pool.Close()
+	address, stop := newTestGRPCServer(t)
+	defer stop()
+	unblock := make(chan struct{})
+	pool.dial = func(address string) (*grpc.ClientConn, error) {
+		<-unblock
+		return comm.NewClientConnectionWithAddress(address, true, false, nil)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := pool.PoolWarmup(ctx, []string{address}, 1); err == nil {
+		t.Fatal("Expected the warm-up to stop once its context is done")
+	}
+	// The dial still running fills the pool once done
+	close(unblock)
+	for i := 0; i < 100; i++ {
+		pool.Lock()
+		idle := len(pool.idle[address])
+		pool.Unlock()
+		if idle == 1 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Expected the dial completed after the warm-up stopped to be kept idle")
+}
+
+func TestPeerConnectionPoolEvictsIdle(t *testing.T) {
+	var dials int
+	pool := newCountingConnectionPool(&dials)
+	defer pool.Close()
+	pool.idleTimeout = time.Minute
+	address, stop := newTestGRPCServer(t)
+	defer stop()
+	stale, err := pool.Get(address)
+	if err != nil {
+		t.Fatalf("Error dialing %s: %s", address, err)
+	}
+	fresh, err := pool.Get(address)
+	if err != nil {
+		t.Fatalf("Error dialing %s: %s", address, err)
+	}
+	borrowed, err := pool.Get(address)
+	if err != nil {
+		t.Fatalf("Error dialing %s: %s", address, err)
+	}
+	pool.Release(address, stale)
+	pool.Release(address, fresh)
+	pool.idle[address][0].since = time.Now().Add(-2 * time.Minute)
+
+	if evicted := pool.evictIdle(time.Now()); evicted != 1 {
+		t.Fatalf("Expected the connection idle for 2 minutes to be evicted, got %d evicted", evicted)
+	}
+	if stale.State() != grpc.Shutdown {
+		t.Errorf("Expected the evicted connection to be closed, got %s", stale.State())
+	}
+	if len(pool.idle[address]) != 1 || pool.idle[address][0].conn != fresh {
+		t.Errorf("Expected the recently released connection to be kept, got %d idle", len(pool.idle[address]))
+	}
+	// A borrowed connection is not idle, however long ago it was dialed
+	if !connUsable(borrowed) {
+		t.Errorf("Expected the borrowed connection to be left open, got %s", borrowed.State())
+	}
+	pool.Release(address, borrowed)
+	if evicted := pool.evictIdle(time.Now()); evicted != 0 {
+		t.Errorf("Expected nothing idle long enough to be evicted, got %d evicted", evicted)
+	}
+}
+
+func TestPeerConnectionPoolIdleCleanup(t *testing.T) {
+	pool := NewPeerConnectionPoolWithConfig(PoolConfig{IdleTimeout: 20 * time.Millisecond, CleanupInterval: 10 * time.Millisecond})
+	pool.dial = func(address string) (*grpc.ClientConn, error) {
+		return comm.NewClientConnectionWithAddress(address, true, false, nil)
+	}
+	address, stop := newTestGRPCServer(t)
+	defer stop()
+	conn, err := pool.Get(address)
+	if err != nil {
+		t.Fatalf("Error dialing %s: %s", address, err)
+	}
+	pool.Release(address, conn)
+	for i := 0; i < 100 && conn.State() != grpc.Shutdown; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if conn.State() != grpc.Shutdown {
+		t.Fatalf("Expected the idle connection to be closed by the cleanup, got %s", conn.State())
+	}
+	if err := pool.Close(); err != nil {
+		t.Fatalf("Error closing the pool: %s", err)
+	}
+	if err := pool.Close(); err != nil {
+		t.Errorf("Expected closing the pool twice to do nothing, got %s", err)
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// IDMismatch is a transaction of a batch whose ID is not the hash of its content
+type IDMismatch struct {
+	TxIndex    int
+	ClaimedID  string
+	ComputedID string
+}
+
+// ContentAddressedID returns the hex encoded SHA-256 of the transaction
+// marshalled without its uuid, which would otherwise have to hash to itself,
+// and without its signature, for the ID to be set before the transaction is
+// signed
+func ContentAddressedID(tx *pb.Transaction) (string, error) {
+	content := *tx
+	content.Uuid = ""
+	content.Signature = nil
+	data, err := proto.Marshal(&content)
+	if err != nil {
+		return "", fmt.Errorf("Error marshalling transaction %s: %s", tx.Uuid, err)
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// VerifyTransactionIDs returns the transactions of the batch whose uuid is
+// not their content-addressed ID, those which cannot be marshalled having an
+// empty computed ID
+func VerifyTransactionIDs(batch *pb.TransactionBlock) []IDMismatch {
+	var mismatches []IDMismatch
+	for i, tx := range batch.Transactions {
+		computed, err := ContentAddressedID(tx)
+		if err != nil || computed != tx.Uuid {
+			mismatches = append(mismatches, IDMismatch{TxIndex: i, ClaimedID: tx.Uuid, ComputedID: computed})
+		}
+	}
+	return mismatches
+}
+
+// PopulateTransactionIDs sets the uuid of every transaction of the batch to
+// its content-addressed ID, for peers with peer.tx.enforceContentAddressedIDs
+// to accept it. Transactions are to be signed afterwards.
+func PopulateTransactionIDs(batch *pb.TransactionBlock) error {
+	for _, tx := range batch.Transactions {
+		id, err := ContentAddressedID(tx)
+		if err != nil {
+			return err
+		}
+		tx.Uuid = id
+	}
+	return nil
+}
+
+// idMismatchError returns the CHAIN_TRANSACTIONS_VALIDATION_ERROR rejecting a
+// batch with the mismatching IDs
+func idMismatchError(mismatches []IDMismatch) *pb.TransactionsValidationError {
+	validationError := &pb.TransactionsValidationError{Rejected: true}
+	for _, mismatch := range mismatches {
+		validationError.Violations = append(validationError.Violations, &pb.ValidationViolation{
+			TxIndex: uint32(mismatch.TxIndex),
+			TxID:    mismatch.ClaimedID,
+			Field:   "uuid",
+			Reason:  fmt.Sprintf("Not the content-addressed ID %s", mismatch.ComputedID),
+		})
+	}
+	return validationError
+}
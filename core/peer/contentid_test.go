@@ -0,0 +1,62 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestPopulateTransactionIDs(t *testing.T) {
+	batch := &pb.TransactionBlock{Transactions: []*pb.Transaction{
+		{Type: pb.Transaction_CHAINCODE_INVOKE, Payload: []byte("a")},
+		{Type: pb.Transaction_CHAINCODE_INVOKE, Payload: []byte("b")},
+	}}
+	if mismatches := VerifyTransactionIDs(batch); len(mismatches) != 2 {
+		t.Fatalf("Expected transactions without IDs to mismatch, got %v", mismatches)
+	}
+	if err := PopulateTransactionIDs(batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.Transactions[0].Uuid) != 64 || batch.Transactions[0].Uuid == batch.Transactions[1].Uuid {
+		t.Fatalf("Expected distinct SHA-256 IDs, got %s and %s", batch.Transactions[0].Uuid, batch.Transactions[1].Uuid)
+	}
+	// Signing after the IDs are set keeps them valid
+	batch.Transactions[0].Signature = []byte("signature")
+	if mismatches := VerifyTransactionIDs(batch); len(mismatches) != 0 {
+		t.Fatalf("Expected the populated IDs to verify, got %v", mismatches)
+	}
+}
+
+func TestVerifyTransactionIDsTampered(t *testing.T) {
+	batch := &pb.TransactionBlock{Transactions: []*pb.Transaction{
+		{Type: pb.Transaction_CHAINCODE_INVOKE, Payload: []byte("a")},
+		{Type: pb.Transaction_CHAINCODE_INVOKE, Payload: []byte("b")},
+	}}
+	PopulateTransactionIDs(batch)
+	claimed := batch.Transactions[1].Uuid
+	batch.Transactions[1].Payload = []byte("tampered")
+	mismatches := VerifyTransactionIDs(batch)
+	if len(mismatches) != 1 || mismatches[0].TxIndex != 1 || mismatches[0].ClaimedID != claimed || mismatches[0].ComputedID == claimed {
+		t.Fatalf("Expected the tampered transaction to mismatch, got %v", mismatches)
+	}
+	validationError := idMismatchError(mismatches)
+	if !validationError.Rejected || len(validationError.Violations) != 1 || validationError.Violations[0].TxID != claimed {
+		t.Fatalf("Expected the batch to be rejected over the tampered transaction, got %v", validationError)
+	}
+}
@@ -0,0 +1,193 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// contractStateLedger is the ledger the state of the contracts is read from
+type contractStateLedger interface {
+	GetState(chaincodeID string, key string, committed bool) ([]byte, error)
+	GetStateDelta(blockNumber uint64) (*statemgmt.StateDelta, error)
+	GetBlockchainSize() uint64
+}
+
+// contractStateAt returns the committed value of key in the state of the
+// chaincode as of block atBlock, 0 meaning the latest block, and the block it
+// is the value as of. Earlier values are those before the state deltas of the
+// blocks after atBlock, the query failing if one of them is no longer kept.
+func contractStateAt(l contractStateLedger, chaincodeID, key string, atBlock uint64) ([]byte, bool, uint64, error) {
+	var latest uint64
+	if height := l.GetBlockchainSize(); height > 0 {
+		latest = height - 1
+	}
+	if atBlock == 0 {
+		atBlock = latest
+	} else if atBlock > latest {
+		return nil, false, 0, fmt.Errorf("Block %d is past the latest block %d", atBlock, latest)
+	}
+	value, err := l.GetState(chaincodeID, key, true)
+	if err != nil {
+		return nil, false, 0, fmt.Errorf("Error getting key %s of chaincode %s: %s", key, chaincodeID, err)
+	}
+	for n := latest; n > atBlock; n-- {
+		delta, err := l.GetStateDelta(n)
+		if err != nil {
+			return nil, false, 0, fmt.Errorf("Error getting state delta of block %d: %s", n, err)
+		}
+		if delta == nil {
+			return nil, false, 0, fmt.Errorf("State delta of block %d is no longer available to go back to block %d", n, atBlock)
+		}
+		if updated := delta.Get(chaincodeID, key); updated != nil {
+			value = updated.GetPreviousValue()
+		}
+	}
+	return value, value != nil, atBlock, nil
+}
+
+// GetContractState returns the value of key in the state of the contract, the
+// chaincode contractAddress, as of block atBlock, 0 meaning the latest block,
+// whether it has one and the block it is the value as of
+func (p *PeerImpl) GetContractState(contractAddress, key string, atBlock uint64) ([]byte, bool, uint64, error) {
+	p.ledgerWrapper.RLock()
+	defer p.ledgerWrapper.RUnlock()
+	return contractStateAt(p.ledgerWrapper.ledger, contractAddress, key, atBlock)
+}
+
+// contractStateFragments splits value into responses of at most maxBytes of
+// it each. A maxBytes of 0 sends a single response.
+func contractStateFragments(value []byte, exists bool, atBlock uint64, maxBytes int) []*pb.ContractStateResponse {
+	fragments := []*pb.ContractStateResponse{{Exists: exists, AtBlock: atBlock}}
+	for maxBytes > 0 && len(value) > maxBytes {
+		fragment := fragments[len(fragments)-1]
+		fragment.Value, fragment.More = value[:maxBytes], true
+		value = value[maxBytes:]
+		fragments = append(fragments, &pb.ContractStateResponse{Exists: exists, AtBlock: atBlock})
+	}
+	fragments[len(fragments)-1].Value = value
+	return fragments
+}
+
+// FetchContractState asks the peer at peerAddress for the latest value of key
+// in the state of the contract contractAddress, and whether it has one
+func FetchContractState(peerAddress, contractAddress, key string) ([]byte, bool, error) {
+	value, exists, _, err := FetchContractStateAtBlock(peerAddress, contractAddress, key, 0)
+	return value, exists, err
+}
+
+// FetchContractStateAtBlock is FetchContractState for the value as of block
+// atBlock, 0 meaning the latest block, also returning the block the value is
+// as of. The fragments of the CHAIN_CONTRACT_STATE_RESPONSE are gathered.
+func FetchContractStateAtBlock(peerAddress, contractAddress, key string, atBlock uint64) (value []byte, exists bool, stateBlock uint64, err error) {
+	err = withRequestStream(peerAddress, func(stream ChatStream) error {
+		value, exists, stateBlock, err = fetchContractStateOverStream(stream, contractAddress, key, atBlock)
+		return err
+	})
+	if err != nil {
+		return nil, false, 0, fmt.Errorf("Error fetching key %s of contract %s from %s: %s", key, contractAddress, peerAddress, err)
+	}
+	return value, exists, stateBlock, nil
+}
+
+func fetchContractStateOverStream(stream ChatStream, contractAddress, key string, atBlock uint64) ([]byte, bool, uint64, error) {
+	data, err := proto.Marshal(&pb.QueryContractState{ContractAddress: contractAddress, Key: key, AtBlock: atBlock})
+	if err != nil {
+		return nil, false, 0, fmt.Errorf("Error marshalling QueryContractState: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_QUERY_CONTRACT_STATE, Payload: data}
+	reply, err := requestOverStream(stream, request, pb.Message_CHAIN_CONTRACT_STATE_RESPONSE)
+	var value []byte
+	for err == nil {
+		fragment := &pb.ContractStateResponse{}
+		if err := proto.Unmarshal(reply.Payload, fragment); err != nil {
+			return nil, false, 0, fmt.Errorf("Error unmarshalling ContractStateResponse: %s", err)
+		}
+		value = append(value, fragment.Value...)
+		if !fragment.More {
+			return value, fragment.Exists, fragment.AtBlock, nil
+		}
+		reply, err = receiveReply(stream, request.Type, pb.Message_CHAIN_CONTRACT_STATE_RESPONSE)
+	}
+	return nil, false, 0, err
+}
+
+// ContractState is the value of a key of a contract served on the
+// /contract/{address}/state/{key} endpoint, the value being base64 encoded
+type ContractState struct {
+	Value   []byte `json:"value"`
+	Exists  bool   `json:"exists"`
+	AtBlock uint64 `json:"atBlock"`
+}
+
+// ContractStateHandler returns an http.Handler serving GET
+// /contract/{address}/state/{key}?block=N&peer=<address> as JSON, the value
+// of key of the contract as of block N, the latest one without block, read
+// from the peer at the peer address or from this peer without peer
+func (p *PeerImpl) ContractStateHandler() http.Handler {
+	return contractStateHandler(p.GetContractState, FetchContractStateAtBlock)
+}
+
+func contractStateHandler(local func(contractAddress, key string, atBlock uint64) ([]byte, bool, uint64, error),
+	remote func(peerAddress, contractAddress, key string, atBlock uint64) ([]byte, bool, uint64, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "GET required", http.StatusMethodNotAllowed)
+			return
+		}
+		path := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/contract/"), "/state/", 2)
+		if len(path) != 2 || path[0] == "" || path[1] == "" {
+			http.Error(w, "Expected /contract/{address}/state/{key}", http.StatusNotFound)
+			return
+		}
+		var atBlock uint64
+		if block := r.URL.Query().Get("block"); block != "" {
+			var err error
+			if atBlock, err = strconv.ParseUint(block, 10, 64); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid block parameter: %s", err), http.StatusBadRequest)
+				return
+			}
+		}
+		state := &ContractState{}
+		var err error
+		if peerAddress := r.URL.Query().Get("peer"); peerAddress != "" {
+			if state.Value, state.Exists, state.AtBlock, err = remote(peerAddress, path[0], path[1], atBlock); err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+		} else if state.Value, state.Exists, state.AtBlock, err = local(path[0], path[1], atBlock); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data, err := json.Marshal(state)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+}
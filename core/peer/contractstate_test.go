@@ -0,0 +1,148 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// testContractLedger is a contractStateLedger of height blocks whose state
+// deltas past the history are unavailable
+type testContractLedger struct {
+	state  map[string][]byte
+	deltas map[uint64]*statemgmt.StateDelta
+	height uint64
+}
+
+func (l *testContractLedger) GetState(chaincodeID string, key string, committed bool) ([]byte, error) {
+	return l.state[chaincodeID+"/"+key], nil
+}
+
+func (l *testContractLedger) GetStateDelta(blockNumber uint64) (*statemgmt.StateDelta, error) {
+	return l.deltas[blockNumber], nil
+}
+
+func (l *testContractLedger) GetBlockchainSize() uint64 {
+	return l.height
+}
+
+func TestContractStateAt(t *testing.T) {
+	// Block 2 sets the key to v1, block 3 to v2 and block 4 deletes it
+	deltas := map[uint64]*statemgmt.StateDelta{}
+	for n := uint64(2); n <= 4; n++ {
+		deltas[n] = statemgmt.NewStateDelta()
+	}
+	deltas[2].Set("cc", "key", []byte("v1"), nil)
+	deltas[3].Set("cc", "key", []byte("v2"), []byte("v1"))
+	deltas[4].Delete("cc", "key", []byte("v2"))
+	deltas[3].Set("cc", "other", []byte("o"), nil)
+	l := &testContractLedger{state: map[string][]byte{"cc/other": []byte("o")}, deltas: deltas, height: 5}
+
+	for atBlock, expected := range map[uint64]string{0: "", 4: "", 3: "v2", 2: "v1"} {
+		value, exists, stateBlock, err := contractStateAt(l, "cc", "key", atBlock)
+		if err != nil || string(value) != expected || exists != (expected != "") {
+			t.Errorf("Expected %q at block %d, got %q, %t, %v", expected, atBlock, value, exists, err)
+		}
+		if atBlock != 0 && stateBlock != atBlock || atBlock == 0 && stateBlock != 4 {
+			t.Errorf("Expected the value as of block %d, got block %d", atBlock, stateBlock)
+		}
+	}
+	if value, exists, _, _ := contractStateAt(l, "cc", "other", 3); !exists || string(value) != "o" {
+		t.Errorf("Expected the value set in block 3 to exist as of block 3, got %q, %t", value, exists)
+	}
+	if _, exists, _, err := contractStateAt(l, "cc", "key", 1); err != nil || exists {
+		t.Errorf("Expected no value before block 2, got %t, %v", exists, err)
+	}
+	delete(deltas, 2)
+	if _, _, _, err := contractStateAt(l, "cc", "key", 1); err == nil {
+		t.Error("Expected an error going back past the available state deltas")
+	}
+	if _, _, _, err := contractStateAt(l, "cc", "key", 5); err == nil {
+		t.Error("Expected an error for a block past the latest one")
+	}
+}
+
+func TestFetchContractStateFragments(t *testing.T) {
+	fragments := contractStateFragments([]byte("0123456789"), true, 7, 4)
+	if len(fragments) != 3 || !fragments[0].More || !fragments[1].More || fragments[2].More {
+		t.Fatalf("Expected 3 fragments of at most 4 bytes, got %v", fragments)
+	}
+	stream := &handshakeStream{recv: make(chan *pb.Message, 3), sent: make(chan *pb.Message, 1)}
+	for _, fragment := range fragments {
+		data, _ := proto.Marshal(fragment)
+		stream.recv <- &pb.Message{Type: pb.Message_CHAIN_CONTRACT_STATE_RESPONSE, Payload: data}
+	}
+	value, exists, atBlock, err := fetchContractStateOverStream(stream, "cc", "key", 7)
+	if err != nil || string(value) != "0123456789" || !exists || atBlock != 7 {
+		t.Fatalf("Expected the gathered value as of block 7, got %q, %t, %d, %v", value, exists, atBlock, err)
+	}
+	request := &pb.QueryContractState{}
+	if msg := <-stream.sent; msg.Type != pb.Message_CHAIN_QUERY_CONTRACT_STATE || proto.Unmarshal(msg.Payload, request) != nil || request.ContractAddress != "cc" || request.AtBlock != 7 {
+		t.Errorf("Expected a CHAIN_QUERY_CONTRACT_STATE for cc at block 7, got %s", msg.Type)
+	}
+	if fragments := contractStateFragments(nil, false, 7, 4); len(fragments) != 1 || fragments[0].Exists {
+		t.Errorf("Expected a single fragment for no value, got %v", fragments)
+	}
+}
+
+func TestContractStateHandler(t *testing.T) {
+	local := func(contractAddress, key string, atBlock uint64) ([]byte, bool, uint64, error) {
+		return []byte(fmt.Sprintf("local %s %s %d", contractAddress, key, atBlock)), true, 3, nil
+	}
+	remote := func(peerAddress, contractAddress, key string, atBlock uint64) ([]byte, bool, uint64, error) {
+		if peerAddress == "down:7051" {
+			return nil, false, 0, errors.New("unreachable")
+		}
+		return []byte(fmt.Sprintf("%s %s %s %d", peerAddress, contractAddress, key, atBlock)), true, 3, nil
+	}
+	handler := contractStateHandler(local, remote)
+	for url, expected := range map[string]string{
+		"/contract/cc/state/a/b":               "local cc a/b 0",
+		"/contract/cc/state/k?block=2":         "local cc k 2",
+		"/contract/cc/state/k?peer=vp1:7051":   "vp1:7051 cc k 0",
+		"/contract/cc/state/k?block=1&peer=p2": "p2 cc k 1",
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		state := &ContractState{}
+		if err := json.Unmarshal(w.Body.Bytes(), state); err != nil || string(state.Value) != expected || !state.Exists || state.AtBlock != 3 {
+			t.Errorf("Expected %q for %s, got %d %s", expected, url, w.Code, w.Body)
+		}
+	}
+	for url, code := range map[string]int{
+		"/contract/cc":                        http.StatusNotFound,
+		"/contract/cc/state/":                 http.StatusNotFound,
+		"/contract/cc/state/k?block=x":        http.StatusBadRequest,
+		"/contract/cc/state/k?peer=down:7051": http.StatusBadGateway,
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != code {
+			t.Errorf("Expected %d for %s, got %d", code, url, w.Code)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// CorrelatedMessenger multiplexes request/reply exchanges over a single Chat
+// stream. Each request is stamped with a new correlationID and the reply
+// carrying the same correlationID is returned to the caller waiting for it.
+// Received messages without a pending correlationID are passed to the
+// unsolicited function. Requests are encoded with the codec set with
+// SetCodec, received messages being decoded with the codec they name.
+type CorrelatedMessenger struct {
+	stream      ChatStream
+	unsolicited func(msg *pb.Message)
+	sendMutex   sync.Mutex
+	mutex       sync.Mutex
+	pending     map[string]chan *pb.Message
+	done        chan struct{}
+	err         error
+	codec       MessageCodec
+}
+
+// NewCorrelatedMessenger starts receiving on the stream, which from then on
+// must only be received from by the messenger. unsolicited may be nil to
+// discard messages which are not replies.
+func NewCorrelatedMessenger(stream ChatStream, unsolicited func(msg *pb.Message)) *CorrelatedMessenger {
+	m := &CorrelatedMessenger{
+		stream:      stream,
+		unsolicited: unsolicited,
+		pending:     make(map[string]chan *pb.Message),
+		done:        make(chan struct{}),
+	}
+	go m.receive()
+	return m
+}
+
+// SetCodec sets the codec the following requests are encoded with, such as
+// the Codec of the ChatSession the stream was negotiated on
+func (m *CorrelatedMessenger) SetCodec(codec MessageCodec) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.codec = codec
+}
+
+func (m *CorrelatedMessenger) receive() {
+	for {
+		msg, err := m.stream.Recv()
+		if err == nil {
+			msg, err = decodeMessage(msg)
+		}
+		if err != nil {
+			m.mutex.Lock()
+			m.err = err
+			m.mutex.Unlock()
+			close(m.done)
+			return
+		}
+		m.mutex.Lock()
+		replyChan, ok := m.pending[msg.CorrelationID]
+		if ok {
+			delete(m.pending, msg.CorrelationID)
+		}
+		m.mutex.Unlock()
+		if ok {
+			replyChan <- msg
+		} else if m.unsolicited != nil {
+			m.unsolicited(msg)
+		} else {
+			peerLogger.Debugf("Discarding %s without pending request", msg.Type)
+		}
+	}
+}
+
+// Request sends msg with a new correlationID and returns the reply to it. A
+// failed RESPONSE received in reply is returned as an error.
+func (m *CorrelatedMessenger) Request(ctx context.Context, msg *pb.Message) (*pb.Message, error) {
+	msg.CorrelationID = util.GenerateUUID()
+	if msg.Timestamp == nil {
+		msg.Timestamp = util.CreateUtcTimestamp()
+	}
+	replyChan := make(chan *pb.Message, 1)
+	m.mutex.Lock()
+	if m.err != nil {
+		err := m.err
+		m.mutex.Unlock()
+		return nil, fmt.Errorf("Error sending %s, stream failed: %s", msg.Type, err)
+	}
+	m.pending[msg.CorrelationID] = replyChan
+	codec := m.codec
+	m.mutex.Unlock()
+	cancel := func() {
+		m.mutex.Lock()
+		delete(m.pending, msg.CorrelationID)
+		m.mutex.Unlock()
+	}
+
+	encoded, err := encodeMessage(codec, msg)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	m.sendMutex.Lock()
+	err = m.stream.Send(encoded)
+	m.sendMutex.Unlock()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("Error sending %s: %s", msg.Type, err)
+	}
+	select {
+	case reply := <-replyChan:
+		if reply.Type == pb.Message_RESPONSE {
+			response := &pb.Response{}
+			if err := proto.Unmarshal(reply.Payload, response); err == nil && response.Status == pb.Response_FAILURE {
+				return nil, fmt.Errorf("Error response to %s: %s", msg.Type, response.Msg)
+			}
+		}
+		return reply, nil
+	case <-ctx.Done():
+		cancel()
+		return nil, fmt.Errorf("Error waiting for reply to %s: %s", msg.Type, ctx.Err())
+	case <-m.done:
+		cancel()
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		return nil, fmt.Errorf("Error waiting for reply to %s: %s", msg.Type, m.err)
+	}
+}
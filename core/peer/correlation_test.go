@@ -0,0 +1,73 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestCorrelatedMessengerMatchesOutOfOrderReplies(t *testing.T) {
+	stream := &handshakeStream{recv: make(chan *pb.Message, 3), sent: make(chan *pb.Message, 2)}
+	defer close(stream.recv)
+	unsolicited := make(chan *pb.Message, 1)
+	m := NewCorrelatedMessenger(stream, func(msg *pb.Message) { unsolicited <- msg })
+
+	go func() {
+		first, second := <-stream.sent, <-stream.sent
+		stream.recv <- &pb.Message{Type: pb.Message_SYNC_BLOCK_ADDED}
+		stream.recv <- &pb.Message{Type: pb.Message_CHAIN_STATE_ROOT, Payload: second.Payload, CorrelationID: second.CorrelationID}
+		stream.recv <- &pb.Message{Type: pb.Message_CHAIN_STATE_ROOT, Payload: first.Payload, CorrelationID: first.CorrelationID}
+	}()
+
+	var wg sync.WaitGroup
+	for _, payload := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(payload string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			reply, err := m.Request(ctx, &pb.Message{Type: pb.Message_CHAIN_GET_STATE_ROOT, Payload: []byte(payload)})
+			if err != nil {
+				t.Errorf("Error requesting %s: %s", payload, err)
+			} else if string(reply.Payload) != payload {
+				t.Errorf("Expected the reply to request %s, got the reply to %s", payload, reply.Payload)
+			}
+		}(payload)
+	}
+	wg.Wait()
+	if msg := <-unsolicited; msg.Type != pb.Message_SYNC_BLOCK_ADDED {
+		t.Errorf("Expected %s to be unsolicited, got %s", pb.Message_SYNC_BLOCK_ADDED, msg.Type)
+	}
+}
+
+func TestCorrelatedMessengerStreamFailure(t *testing.T) {
+	stream := &handshakeStream{recv: make(chan *pb.Message), sent: make(chan *pb.Message, 1)}
+	m := NewCorrelatedMessenger(stream, nil)
+	go func() {
+		<-stream.sent
+		close(stream.recv)
+	}()
+	if _, err := m.Request(context.Background(), &pb.Message{Type: pb.Message_CHAIN_GET_STATE_ROOT}); err == nil {
+		t.Error("Expected an error once the stream failed")
+	}
+}
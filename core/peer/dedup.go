@@ -0,0 +1,249 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// dedupPruneInterval is how often a DeduplicationStore prunes the entries older than its window
+const dedupPruneInterval = time.Hour
+
+// dedupEntry is a line of the file of a DeduplicationStore
+type dedupEntry struct {
+	TxID   string `json:"txid"`
+	SeenAt int64  `json:"seenAt"`
+}
+
+// DeduplicationStore remembers the IDs of the transactions seen by the peer
+// and when they were seen, for duplicates to be detected across restarts.
+// Entries are appended to a file, which is rewritten without the pruned ones.
+type DeduplicationStore struct {
+	sync.Mutex
+	path    string
+	file    *os.File
+	entries map[string]time.Time
+	stop    chan struct{}
+}
+
+// NewDeduplicationStore returns a store persisted to path, loading the entries
+// saved there. An empty path keeps the entries in memory only.
+func NewDeduplicationStore(path string) (*DeduplicationStore, error) {
+	s := &DeduplicationStore{path: path, entries: make(map[string]time.Time), stop: make(chan struct{})}
+	if path == "" {
+		return s, nil
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// newDeduplicationStoreFromConfig opens the store at peer.dedup.file under
+// peer.fileSystemPath, prunes the entries older than peer.dedup.windowDuration
+// and schedules the pruning every hour
+func newDeduplicationStoreFromConfig() (*DeduplicationStore, error) {
+	window := viper.GetDuration("peer.dedup.windowDuration")
+	if window <= 0 {
+		return nil, nil
+	}
+	store, err := NewDeduplicationStore(filepath.Join(viper.GetString("peer.fileSystemPath"), viper.GetString("peer.dedup.file")))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := store.Prune(time.Now().Add(-window)); err != nil {
+		peerLogger.Warningf("Error pruning seen transactions: %s", err)
+	}
+	store.StartPruning(window, dedupPruneInterval)
+	return store, nil
+}
+
+func (s *DeduplicationStore) load() error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := dedupEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A line cut short by a crash while it was appended
+			peerLogger.Warningf("Ignoring invalid seen transaction entry in %s: %s", s.path, err)
+			continue
+		}
+		s.entries[entry.TxID] = time.Unix(0, entry.SeenAt)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Error reading seen transactions from %s: %s", s.path, err)
+	}
+	return nil
+}
+
+func (s *DeduplicationStore) open() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("Error creating directory for %s: %s", s.path, err)
+	}
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("Error opening %s: %s", s.path, err)
+	}
+	s.file = file
+	return nil
+}
+
+// Record remembers that the transaction was seen at seenAt
+func (s *DeduplicationStore) Record(txID string, seenAt time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.entries[txID]; ok {
+		return nil
+	}
+	s.entries[txID] = seenAt
+	if s.file == nil {
+		return nil
+	}
+	data, err := json.Marshal(&dedupEntry{TxID: txID, SeenAt: seenAt.UnixNano()})
+	if err != nil {
+		return fmt.Errorf("Error marshalling seen transaction %s: %s", txID, err)
+	}
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+// Contains returns true if the transaction was seen and not pruned since
+func (s *DeduplicationStore) Contains(txID string) bool {
+	s.Lock()
+	defer s.Unlock()
+	_, ok := s.entries[txID]
+	return ok
+}
+
+// TxIDs returns the IDs of the seen transactions
+func (s *DeduplicationStore) TxIDs() []string {
+	s.Lock()
+	defer s.Unlock()
+	txIDs := make([]string, 0, len(s.entries))
+	for txID := range s.entries {
+		txIDs = append(txIDs, txID)
+	}
+	return txIDs
+}
+
+// Prune forgets the transactions seen before the given time, returning how many were removed
+func (s *DeduplicationStore) Prune(before time.Time) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	pruned := 0
+	for txID, seenAt := range s.entries {
+		if seenAt.Before(before) {
+			delete(s.entries, txID)
+			pruned++
+		}
+	}
+	if pruned == 0 || s.file == nil {
+		return pruned, nil
+	}
+	return pruned, s.rewrite()
+}
+
+// rewrite replaces the file with the remaining entries
+func (s *DeduplicationStore) rewrite() error {
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("Error creating %s: %s", tmpPath, err)
+	}
+	writer := bufio.NewWriter(tmp)
+	for txID, seenAt := range s.entries {
+		data, err := json.Marshal(&dedupEntry{TxID: txID, SeenAt: seenAt.UnixNano()})
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("Error marshalling seen transaction %s: %s", txID, err)
+		}
+		writer.Write(append(data, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Error writing %s: %s", tmpPath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("Error writing %s: %s", tmpPath, err)
+	}
+	s.file.Close()
+	s.file = nil
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		os.Remove(tmpPath)
+		// Keep appending to the original file, or to memory only if it cannot be reopened
+		if openErr := s.open(); openErr != nil {
+			peerLogger.Errorf("Error reopening seen transactions, keeping them in memory only: %s", openErr)
+		}
+		return fmt.Errorf("Error replacing %s: %s", s.path, err)
+	}
+	return s.open()
+}
+
+// StartPruning prunes the entries older than window every interval until Close is called
+func (s *DeduplicationStore) StartPruning(window, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				pruned, err := s.Prune(time.Now().Add(-window))
+				if err != nil {
+					peerLogger.Errorf("Error pruning seen transactions: %s", err)
+				} else if pruned > 0 {
+					peerLogger.Debugf("Pruned %d seen transactions older than %s", pruned, window)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the pruning and closes the file of the store
+func (s *DeduplicationStore) Close() error {
+	s.Lock()
+	defer s.Unlock()
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
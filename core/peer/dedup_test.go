@@ -0,0 +1,130 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestDeduplicationStorePersistsAndPrunes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deduptest")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dedup.log")
+
+	store, err := NewDeduplicationStore(path)
+	if err != nil {
+		t.Fatalf("Error creating deduplication store: %s", err)
+	}
+	now := time.Now()
+	if err := store.Record("old", now.Add(-48*time.Hour)); err != nil {
+		t.Fatalf("Error recording transaction: %s", err)
+	}
+	if err := store.Record("new", now); err != nil {
+		t.Fatalf("Error recording transaction: %s", err)
+	}
+	store.Close()
+
+	reloaded, err := NewDeduplicationStore(path)
+	if err != nil {
+		t.Fatalf("Error reloading deduplication store: %s", err)
+	}
+	if !reloaded.Contains("old") || !reloaded.Contains("new") {
+		t.Fatalf("Expected both transactions after reloading, got %v", reloaded.TxIDs())
+	}
+	pruned, err := reloaded.Prune(now.Add(-24 * time.Hour))
+	if err != nil || pruned != 1 {
+		t.Fatalf("Expected 1 transaction to be pruned, pruned %d: %v", pruned, err)
+	}
+	if err := reloaded.Record("newer", now); err != nil {
+		t.Fatalf("Error recording transaction after pruning: %s", err)
+	}
+	reloaded.Close()
+
+	if reloaded, err = NewDeduplicationStore(path); err != nil {
+		t.Fatalf("Error reloading deduplication store: %s", err)
+	}
+	defer reloaded.Close()
+	if reloaded.Contains("old") || !reloaded.Contains("new") || !reloaded.Contains("newer") {
+		t.Fatalf("Expected the pruning to be saved, got %v", reloaded.TxIDs())
+	}
+}
+
+func TestDeduplicationStoreRecordsAfterFailedRewrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deduptest")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dedup.log")
+
+	store, err := NewDeduplicationStore(path)
+	if err != nil {
+		t.Fatalf("Error creating deduplication store: %s", err)
+	}
+	defer store.Close()
+	now := time.Now()
+	if err := store.Record("old", now.Add(-48*time.Hour)); err != nil {
+		t.Fatalf("Error recording transaction: %s", err)
+	}
+	// A non empty directory in place of the file fails the rename of the rewrite
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Error removing %s: %s", path, err)
+	}
+	if err := os.MkdirAll(filepath.Join(path, "blocker"), 0755); err != nil {
+		t.Fatalf("Error creating directory at %s: %s", path, err)
+	}
+	if _, err := store.Prune(now.Add(-24 * time.Hour)); err == nil {
+		t.Fatal("Expected the rewrite to fail")
+	}
+	if err := store.Record("new", now); err != nil {
+		t.Fatalf("Expected transactions to be recorded after a failed rewrite, got %s", err)
+	}
+	if store.Contains("old") || !store.Contains("new") {
+		t.Fatalf("Expected the pruning and the new transaction to be kept, got %v", store.TxIDs())
+	}
+}
+
+func TestGossipSeenFilterSeededFromStore(t *testing.T) {
+	store, _ := NewDeduplicationStore("")
+	store.Record("tx1", time.Now())
+	stack := newMockGossipStack(3)
+	delivered := 0
+	g := NewGossipTransactionPropagator(stack, 10, 4, func(*pb.Transaction) { delivered++ })
+	g.SetDeduplicationStore(store)
+
+	if err := g.HandleGossip(&pb.GossipTransaction{Transaction: &pb.Transaction{Uuid: "tx1"}, Ttl: 2}, &pb.PeerID{Name: "vp0"}); err != nil {
+		t.Fatalf("Error handling gossip: %s", err)
+	}
+	if delivered != 0 || len(stack.sent) != 0 {
+		t.Fatal("Expected a transaction seen before the restart to be ignored")
+	}
+	if err := g.HandleGossip(&pb.GossipTransaction{Transaction: &pb.Transaction{Uuid: "tx2"}, Ttl: 2}, &pb.PeerID{Name: "vp0"}); err != nil {
+		t.Fatalf("Error handling gossip: %s", err)
+	}
+	if delivered != 1 || !store.Contains("tx2") {
+		t.Fatal("Expected a new transaction to be delivered and recorded")
+	}
+}
@@ -0,0 +1,228 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// deltaSyncLedger is the ledger a delta sync compares the remote blocks with and stores them to
+type deltaSyncLedger interface {
+	GetBlockByNumber(blockNumber uint64) (*pb.Block, error)
+	GetBlockchainSize() uint64
+	PutRawBlock(block *pb.Block, blockNumber uint64) error
+}
+
+// blockHashList returns the hashes of the blocks of the request, those past the end of the chain left out
+func blockHashList(blockchain BlockChainAccessor, request *pb.BlockHashesRequest) (*pb.BlockHashList, error) {
+	hashes := &pb.BlockHashList{FromBlock: request.FromBlock}
+	height := blockchain.GetBlockchainSize()
+	for n := request.FromBlock; n <= request.ToBlock && n < height; n++ {
+		block, err := blockchain.GetBlockByNumber(n)
+		if err != nil {
+			return nil, fmt.Errorf("Error getting block %d: %s", n, err)
+		}
+		hash, err := block.GetHash()
+		if err != nil {
+			return nil, fmt.Errorf("Error hashing block %d: %s", n, err)
+		}
+		hashes.Hashes = append(hashes.Hashes, hash)
+	}
+	return hashes, nil
+}
+
+// sendBlocksByNumber answers a SYNC_GET_BLOCKS_BY_NUMBER with a CHAIN_BLOCK for
+// each of at most limit of the blocks, then a CHAIN_QUERY_RANGE_DONE. A limit
+// of 0 sends them all. Blocks past the end of the chain are not sent.
+func sendBlocksByNumber(blockchain BlockChainAccessor, send func(*pb.Message) error, blockNumbers []uint64, limit uint32) error {
+	height := blockchain.GetBlockchainSize()
+	var sent uint32
+	for _, n := range blockNumbers {
+		if n >= height {
+			continue
+		}
+		if limit > 0 && sent == limit {
+			return sendBlockRangeDone(send, &pb.BlockRangeDone{HasMore: true, NextBlock: n})
+		}
+		if err := sendSubscribedBlock(blockchain, send, "", n); err != nil {
+			return err
+		}
+		sent++
+	}
+	return sendBlockRangeDone(send, &pb.BlockRangeDone{})
+}
+
+// SyncProgressFunc is told after each block a ledger sync writes how many of
+// the total blocks it fetches were written
+type SyncProgressFunc func(current, total uint64)
+
+// DeltaSyncLedgerFromPeer brings the blocks from to to included of the local
+// ledger in line with those of the peer at address, only fetching the blocks
+// whose hashes differ from the local ones or that are missing locally
+func DeltaSyncLedgerFromPeer(ctx context.Context, address string, from, to uint64) error {
+	local, err := ledger.GetLedger()
+	if err != nil {
+		return fmt.Errorf("Error getting the ledger: %s", err)
+	}
+	err = withRequestStream(address, func(stream ChatStream) error {
+		return deltaSyncOverStream(NewSyncContext(ctx), stream, local, from, to, nil)
+	})
+	if err != nil {
+		return fmt.Errorf("Error delta syncing blocks %d to %d from %s: %s", from, to, address, err)
+	}
+	return nil
+}
+
+// SyncLedgerFromPeer delta syncs the blocks from from to the canonical tip of
+// one of the registered peers whose chain had block to as of their
+// DISC_HELLO, the highest first, trying the next one when a sync fails. The
+// tip is fetched first, the sync failing unless it is at block to or past it
+// and the synced blocks chain up to its hash. progress, if not nil, is called
+// after each block written. The sync can be paused, resumed and cancelled
+// through syncCtx, a nil one being never paused; its streams last as long as
+// syncCtx rather than peer.chat.requestTimeout so that a pause does not time
+// them out.
+func (p *PeerImpl) SyncLedgerFromPeer(syncCtx *SyncContext, from, to uint64, progress SyncProgressFunc) error {
+	if syncCtx == nil {
+		syncCtx = NewSyncContext(context.Background())
+	}
+	local, err := ledger.GetLedger()
+	if err != nil {
+		return fmt.Errorf("Error getting the ledger: %s", err)
+	}
+	return syncLedgerFromPeers(p.registry.PeersWithMinHeight(to+1), from, to, func(address string) error {
+		err := withRequestStreamContext(syncCtx.context(), address, func(stream ChatStream) error {
+			return canonicalSyncOverStream(syncCtx, stream, local, from, to, progress)
+		})
+		if err != nil {
+			return fmt.Errorf("Error syncing blocks from %d to the canonical tip of %s: %s", from, address, err)
+		}
+		return nil
+	})
+}
+
+func syncLedgerFromPeers(eligible []*pb.PeerEndpoint, from, to uint64, sync func(address string) error) error {
+	if len(eligible) == 0 {
+		peerLogger.Warningf("No registered peer has block %d to sync blocks %d to %d from", to, from, to)
+		return fmt.Errorf("No peer eligible to sync blocks %d to %d from", from, to)
+	}
+	var err error
+	for _, endpoint := range eligible {
+		if err = sync(endpoint.Address); err == nil {
+			return nil
+		}
+		peerLogger.Warningf("%s", err)
+	}
+	return err
+}
+
+func deltaSyncOverStream(syncCtx *SyncContext, stream ChatStream, local deltaSyncLedger, from, to uint64, progress SyncProgressFunc) error {
+	data, err := proto.Marshal(&pb.BlockHashesRequest{FromBlock: from, ToBlock: to})
+	if err != nil {
+		return fmt.Errorf("Error marshalling BlockHashesRequest: %s", err)
+	}
+	reply, err := requestOverStream(stream, &pb.Message{Type: pb.Message_SYNC_GET_BLOCK_HASHES, Payload: data}, pb.Message_SYNC_BLOCK_HASHES)
+	if err != nil {
+		return err
+	}
+	remote := &pb.BlockHashList{}
+	if err := proto.Unmarshal(reply.Payload, remote); err != nil {
+		return fmt.Errorf("Error unmarshalling BlockHashList: %s", err)
+	}
+	divergent, err := divergentBlocks(local, remote)
+	if err != nil {
+		return err
+	}
+	peerLogger.Debugf("Delta sync of blocks %d to %d fetching %d of %d blocks", from, to, len(divergent), len(remote.Hashes))
+	total := uint64(len(divergent))
+	var written uint64
+	for len(divergent) > 0 {
+		if err := syncCtx.context().Err(); err != nil {
+			return err
+		}
+		data, err := proto.Marshal(&pb.BlockNumbers{BlockNumbers: divergent})
+		if err != nil {
+			return fmt.Errorf("Error marshalling BlockNumbers: %s", err)
+		}
+		request := &pb.Message{Type: pb.Message_SYNC_GET_BLOCKS_BY_NUMBER, Payload: data, Timestamp: util.CreateUtcTimestamp()}
+		if err := stream.Send(request); err != nil {
+			return fmt.Errorf("Error sending %s: %s", request.Type, err)
+		}
+		done, blocks, err := receiveBlockRange(stream)
+		if err != nil {
+			return err
+		}
+		for _, block := range blocks {
+			if err := local.PutRawBlock(block.Block, block.BlockNumber); err != nil {
+				return fmt.Errorf("Error storing block %d: %s", block.BlockNumber, err)
+			}
+			written++
+			if progress != nil {
+				progress(written, total)
+			}
+			if err := holdSyncOverStream(syncCtx, stream); err != nil {
+				return err
+			}
+		}
+		if !done.HasMore {
+			return nil
+		}
+		remaining := divergent
+		for len(remaining) > 0 && remaining[0] < done.NextBlock {
+			remaining = remaining[1:]
+		}
+		if len(remaining) == len(divergent) {
+			return fmt.Errorf("%s did not advance past block %d", pb.Message_CHAIN_QUERY_RANGE_DONE, divergent[0])
+		}
+		divergent = remaining
+	}
+	return nil
+}
+
+// divergentBlocks returns the numbers of the remote blocks which are missing
+// from the local ledger or whose local hash differs, in ascending order
+func divergentBlocks(local deltaSyncLedger, remote *pb.BlockHashList) ([]uint64, error) {
+	height := local.GetBlockchainSize()
+	var divergent []uint64
+	for i, remoteHash := range remote.Hashes {
+		n := remote.FromBlock + uint64(i)
+		if n >= height {
+			divergent = append(divergent, n)
+			continue
+		}
+		block, err := local.GetBlockByNumber(n)
+		if err != nil {
+			return nil, fmt.Errorf("Error getting local block %d: %s", n, err)
+		}
+		hash, err := block.GetHash()
+		if err != nil {
+			return nil, fmt.Errorf("Error hashing local block %d: %s", n, err)
+		}
+		if !bytes.Equal(hash, remoteHash) {
+			divergent = append(divergent, n)
+		}
+	}
+	return divergent, nil
+}
@@ -0,0 +1,236 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func (c *testBlockchain) PutRawBlock(block *pb.Block, blockNumber uint64) error {
+	c.Lock()
+	defer c.Unlock()
+	for uint64(len(c.blocks)) <= blockNumber {
+		c.blocks = append(c.blocks, nil)
+	}
+	c.blocks[blockNumber] = block
+	return nil
+}
+
+func TestDeltaSyncFetchesDivergentBlocks(t *testing.T) {
+	remote := &testBlockchain{}
+	local := &testBlockchain{}
+	bus := NewBlockEventBus()
+	for i := 0; i < 10; i++ {
+		block := &pb.Block{StateHash: []byte(fmt.Sprintf("state%d", i))}
+		remote.append(bus, block)
+		if i == 3 {
+			local.append(bus, &pb.Block{StateHash: []byte("forked")})
+		} else if i < 6 {
+			local.append(bus, block)
+		}
+	}
+
+	// Serve the requests 2 blocks at a time
+	stream := &handshakeStream{recv: make(chan *pb.Message, 10), sent: make(chan *pb.Message)}
+	var requested []uint64
+	go func() {
+		defer close(stream.recv)
+		send := func(reply *pb.Message) error {
+			stream.recv <- reply
+			return nil
+		}
+		for msg := range stream.sent {
+			switch msg.Type {
+			case pb.Message_SYNC_GET_BLOCK_HASHES:
+				request := &pb.BlockHashesRequest{}
+				proto.Unmarshal(msg.Payload, request)
+				hashes, err := blockHashList(remote, request)
+				if err != nil {
+					t.Errorf("Error listing block hashes: %s", err)
+					return
+				}
+				data, _ := proto.Marshal(hashes)
+				send(&pb.Message{Type: pb.Message_SYNC_BLOCK_HASHES, Payload: data})
+			case pb.Message_SYNC_GET_BLOCKS_BY_NUMBER:
+				request := &pb.BlockNumbers{}
+				proto.Unmarshal(msg.Payload, request)
+				requested = append(requested, request.BlockNumbers...)
+				if err := sendBlocksByNumber(remote, send, request.BlockNumbers, 2); err != nil {
+					t.Errorf("Error sending blocks: %s", err)
+					return
+				}
+			}
+		}
+	}()
+
+	err := deltaSyncOverStream(NewSyncContext(context.Background()), stream, local, 0, 20, nil)
+	close(stream.sent)
+	if err != nil {
+		t.Fatalf("Error delta syncing: %s", err)
+	}
+	// The pages of 2 blocks request [3 6 7 8 9], then [7 8 9], then [9]
+	if expected := []uint64{3, 6, 7, 8, 9, 7, 8, 9, 9}; !reflect.DeepEqual(requested, expected) {
+		t.Errorf("Expected the requested blocks to be %v, got %v", expected, requested)
+	}
+	if local.GetBlockchainSize() != 10 {
+		t.Fatalf("Expected 10 local blocks, got %d", local.GetBlockchainSize())
+	}
+	for i := uint64(0); i < 10; i++ {
+		localBlock, _ := local.GetBlockByNumber(i)
+		remoteBlock, _ := remote.GetBlockByNumber(i)
+		if !proto.Equal(localBlock, remoteBlock) {
+			t.Errorf("Expected local block %d to match the remote one", i)
+		}
+	}
+}
+
+// serveDeltaSync answers the delta sync requests sent on the stream from
+// remote, calling onPause with each CHAIN_SYNC_PAUSE before it is answered
+func serveDeltaSync(t *testing.T, stream *handshakeStream, remote *testBlockchain, onPause func()) (resumes chan struct{}) {
+	resumes = make(chan struct{}, 10)
+	go func() {
+		defer close(stream.recv)
+		send := func(reply *pb.Message) error {
+			stream.recv <- reply
+			return nil
+		}
+		for msg := range stream.sent {
+			switch msg.Type {
+			case pb.Message_SYNC_GET_BLOCK_HASHES:
+				request := &pb.BlockHashesRequest{}
+				proto.Unmarshal(msg.Payload, request)
+				hashes, _ := blockHashList(remote, request)
+				data, _ := proto.Marshal(hashes)
+				send(&pb.Message{Type: pb.Message_SYNC_BLOCK_HASHES, Payload: data})
+			case pb.Message_SYNC_GET_BLOCKS_BY_NUMBER:
+				request := &pb.BlockNumbers{}
+				proto.Unmarshal(msg.Payload, request)
+				if err := sendBlocksByNumber(remote, send, request.BlockNumbers, 0); err != nil {
+					t.Errorf("Error sending blocks: %s", err)
+					return
+				}
+			case pb.Message_CHAIN_SYNC_PAUSE:
+				onPause()
+				data, _ := proto.Marshal(newSyncPaused(time.Now().Add(time.Minute)))
+				send(&pb.Message{Type: pb.Message_CHAIN_SYNC_PAUSED, Payload: data})
+			case pb.Message_CHAIN_SYNC_RESUME:
+				resumes <- struct{}{}
+			}
+		}
+	}()
+	return resumes
+}
+
+func TestDeltaSyncProgressAndPause(t *testing.T) {
+	remote := &testBlockchain{}
+	local := &testBlockchain{}
+	bus := NewBlockEventBus()
+	for i := 0; i < 4; i++ {
+		remote.append(bus, &pb.Block{StateHash: []byte(fmt.Sprintf("state%d", i))})
+	}
+
+	syncCtx := NewSyncContext(context.Background())
+	stream := &handshakeStream{recv: make(chan *pb.Message, 10), sent: make(chan *pb.Message)}
+	var heightAtPause uint64
+	resumes := serveDeltaSync(t, stream, remote, func() {
+		heightAtPause = local.GetBlockchainSize()
+		syncCtx.Resume()
+	})
+
+	var progress [][2]uint64
+	err := deltaSyncOverStream(syncCtx, stream, local, 0, 3, func(current, total uint64) {
+		progress = append(progress, [2]uint64{current, total})
+		if current == 1 {
+			syncCtx.Pause()
+		}
+	})
+	close(stream.sent)
+	for range stream.recv {
+	}
+	if err != nil {
+		t.Fatalf("Error delta syncing: %s", err)
+	}
+	if expected := [][2]uint64{{1, 4}, {2, 4}, {3, 4}, {4, 4}}; !reflect.DeepEqual(progress, expected) {
+		t.Errorf("Expected the progress to be %v, got %v", expected, progress)
+	}
+	if heightAtPause != 1 {
+		t.Errorf("Expected the sync to pause after the first block, got %d blocks written", heightAtPause)
+	}
+	if len(resumes) != 1 {
+		t.Errorf("Expected 1 %s, got %d", pb.Message_CHAIN_SYNC_RESUME, len(resumes))
+	}
+	if local.GetBlockchainSize() != 4 {
+		t.Errorf("Expected 4 local blocks, got %d", local.GetBlockchainSize())
+	}
+}
+
+func TestDeltaSyncCancelledWhilePaused(t *testing.T) {
+	remote := &testBlockchain{}
+	local := &testBlockchain{}
+	bus := NewBlockEventBus()
+	for i := 0; i < 4; i++ {
+		remote.append(bus, &pb.Block{StateHash: []byte(fmt.Sprintf("state%d", i))})
+	}
+
+	syncCtx := NewSyncContext(context.Background())
+	syncCtx.Pause()
+	stream := &handshakeStream{recv: make(chan *pb.Message, 10), sent: make(chan *pb.Message)}
+	resumes := serveDeltaSync(t, stream, remote, syncCtx.Cancel)
+
+	err := deltaSyncOverStream(syncCtx, stream, local, 0, 3, nil)
+	close(stream.sent)
+	for range stream.recv {
+	}
+	if err != context.Canceled {
+		t.Fatalf("Expected the sync to be cancelled, got %v", err)
+	}
+	if local.GetBlockchainSize() != 1 {
+		t.Errorf("Expected the sync to stop after the first block, got %d blocks", local.GetBlockchainSize())
+	}
+	if len(resumes) != 0 {
+		t.Errorf("Expected no %s once cancelled, got %d", pb.Message_CHAIN_SYNC_RESUME, len(resumes))
+	}
+}
+
+func TestSyncLedgerFromPeers(t *testing.T) {
+	if err := syncLedgerFromPeers(nil, 0, 9, func(string) error { return nil }); err == nil {
+		t.Error("Expected an error without an eligible peer")
+	}
+	eligible := []*pb.PeerEndpoint{{Address: "vp1:30303"}, {Address: "vp2:30303"}, {Address: "vp3:30303"}}
+	var tried []string
+	err := syncLedgerFromPeers(eligible, 0, 9, func(address string) error {
+		tried = append(tried, address)
+		if address == "vp1:30303" {
+			return fmt.Errorf("unreachable")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected the sync from vp2 to succeed, got %s", err)
+	}
+	if fmt.Sprint(tried) != "[vp1:30303 vp2:30303]" {
+		t.Errorf("Expected vp1 then vp2 to be tried, got %v", tried)
+	}
+}
@@ -0,0 +1,67 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
+)
+
+// GetPeersRateLimiter interface enables a Peer to throttle the DISC_GET_PEERS requests it serves
+type GetPeersRateLimiter interface {
+	// ReserveGetPeers returns 0 if a DISC_GET_PEERS request may be served now,
+	// otherwise the time the requester should wait before retrying
+	ReserveGetPeers() time.Duration
+}
+
+// getPeersLimiter is a token bucket limiting the rate at which DISC_GET_PEERS requests are served.
+// A nil getPeersLimiter does not limit.
+type getPeersLimiter struct {
+	limiter *rate.Limiter
+}
+
+// newGetPeersLimiter returns a limiter allowing maxRequestsPerSecond requests, or nil if
+// maxRequestsPerSecond is not positive
+func newGetPeersLimiter(maxRequestsPerSecond float64) *getPeersLimiter {
+	if maxRequestsPerSecond <= 0 {
+		return nil
+	}
+	burst := int(maxRequestsPerSecond)
+	if burst < 1 {
+		burst = 1
+	}
+	return &getPeersLimiter{limiter: rate.NewLimiter(rate.Limit(maxRequestsPerSecond), burst)}
+}
+
+func newGetPeersLimiterFromConfig() *getPeersLimiter {
+	return newGetPeersLimiter(viper.GetFloat64("peer.discovery.maxRequestsPerSecond"))
+}
+
+func (l *getPeersLimiter) reserve() time.Duration {
+	if l == nil {
+		return 0
+	}
+	r := l.limiter.Reserve()
+	delay := r.Delay()
+	if delay > 0 {
+		// The request is rejected rather than delayed, so give the token back
+		r.Cancel()
+	}
+	return delay
+}
@@ -0,0 +1,87 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/looplab/fsm"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// rateLimitedCoordinator is a handlerTestCoordinator whose peer list requests
+// are all rate limited for a second
+type rateLimitedCoordinator struct {
+	handlerTestCoordinator
+}
+
+func (rateLimitedCoordinator) ReserveGetPeers() time.Duration {
+	return time.Second
+}
+
+func TestGetPeersLimiterUnlimited(t *testing.T) {
+	l := newGetPeersLimiter(0)
+	if l != nil {
+		t.Fatal("Expected no limiter when maxRequestsPerSecond is 0")
+	}
+	for i := 0; i < 1000; i++ {
+		if delay := l.reserve(); delay != 0 {
+			t.Fatalf("Expected unlimited limiter to never delay, got %s", delay)
+		}
+	}
+}
+
+func TestGetPeersLimiterRejectsOverLimit(t *testing.T) {
+	l := newGetPeersLimiter(2)
+	for i := 0; i < 2; i++ {
+		if delay := l.reserve(); delay != 0 {
+			t.Fatalf("Expected request %d within burst to be allowed, got delay %s", i, delay)
+		}
+	}
+	delay := l.reserve()
+	if delay <= 0 || delay > time.Second {
+		t.Fatalf("Expected a retry delay of at most 1s, got %s", delay)
+	}
+	// Rejected requests must not consume tokens, so the delay does not grow
+	if next := l.reserve(); next > delay {
+		t.Errorf("Expected rejected requests not to push the retry delay out, got %s after %s", next, delay)
+	}
+}
+
+func TestHandlerRateLimitsPeerListRequests(t *testing.T) {
+	handler := newTestHandlerWithCoordinator(t, rateLimitedCoordinator{})
+	for msgType, before := range map[pb.Message_Type]func(*fsm.Event){
+		pb.Message_DISC_GET_PEERS:        handler.beforeGetPeers,
+		pb.Message_DISC_GET_PEERS_DIFF:   handler.beforeGetPeersDiff,
+		pb.Message_DISC_QUORUM_GET_PEERS: handler.beforeQuorumGetPeers,
+	} {
+		msg := &pb.Message{Type: msgType, CorrelationID: "7"}
+		e := &fsm.Event{FSM: handler.FSM, Event: msgType.String(), Args: []interface{}{msg}}
+		before(e)
+		if e.Err != nil {
+			t.Errorf("Expected the rate limited %s to be answered, got %s", msgType, e.Err)
+		}
+		reply := <-handler.ChatStream.(*handshakeStream).sent
+		retryAfter := &pb.GetPeersRetryAfter{}
+		if err := proto.Unmarshal(reply.Payload, retryAfter); err != nil || reply.Type != pb.Message_DISC_GET_PEERS_RETRY_AFTER || retryAfter.RetryAfterMs != 1000 || reply.CorrelationID != "7" {
+			t.Errorf("Expected a correlated DISC_GET_PEERS_RETRY_AFTER of 1000ms to %s, got %v, %v", msgType, reply, retryAfter)
+		}
+	}
+}
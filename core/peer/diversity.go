@@ -0,0 +1,177 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// addressSubnet returns the /16 subnet of the IPv4 address, the /32 of an
+// IPv6 one, and the host itself if it is a name
+func addressSubnet(address string) string {
+	return addressSubnetOfSize(address, 16, 32)
+}
+
+// addressSubnetOfSize returns the subnet of ipv4Bits of the IPv4 address, of
+// ipv6Bits of an IPv6 one, and the host itself if it is a name
+func addressSubnetOfSize(address string, ipv4Bits, ipv6Bits int) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%s/%d", ip4.Mask(net.CIDRMask(ipv4Bits, 32)), ipv4Bits)
+	}
+	return fmt.Sprintf("%s/%d", ip.Mask(net.CIDRMask(ipv6Bits, 128)), ipv6Bits)
+}
+
+// subnets returns the distinct subnets of the addresses
+func subnets(addresses []string) map[string]struct{} {
+	distinct := make(map[string]struct{})
+	for _, address := range addresses {
+		distinct[addressSubnet(address)] = struct{}{}
+	}
+	return distinct
+}
+
+// diversityScore returns the number of distinct subnets of the addresses
+// over the number of addresses, 1 when no two share a subnet and 0 without
+// addresses
+func diversityScore(addresses []string) float64 {
+	if len(addresses) == 0 {
+		return 0
+	}
+	return float64(len(subnets(addresses))) / float64(len(addresses))
+}
+
+// diversityCandidates returns the bootstrap addresses to connect to for the
+// connected addresses to span minSubnets subnets, one per subnet not spanned
+// yet, as many as are missing
+func diversityCandidates(connected, bootstrap []string, minSubnets int) []string {
+	spanned := subnets(connected)
+	var candidates []string
+	for _, address := range bootstrap {
+		if len(spanned) >= minSubnets {
+			break
+		}
+		subnet := addressSubnet(address)
+		if _, ok := spanned[subnet]; ok {
+			continue
+		}
+		spanned[subnet] = struct{}{}
+		candidates = append(candidates, address)
+	}
+	return candidates
+}
+
+// DiverseSample returns up to maxResults of the peers, at most maxPerSubnet
+// of them in each /24 subnet, /48 for IPv6. The subnets are taken in turn, one
+// peer of each at a time in the order they first appear, for a sample cut
+// short by maxResults to still span as many subnets as it can. A limit of 0 is
+// no limit.
+func DiverseSample(peers []*pb.PeerEndpoint, maxResults, maxPerSubnet int) []*pb.PeerEndpoint {
+	var order []string
+	groups := make(map[string][]*pb.PeerEndpoint)
+	for _, peer := range peers {
+		subnet := addressSubnetOfSize(peer.Address, 24, 48)
+		if _, ok := groups[subnet]; !ok {
+			order = append(order, subnet)
+		}
+		groups[subnet] = append(groups[subnet], peer)
+	}
+	sample := []*pb.PeerEndpoint{}
+	for round := 0; maxPerSubnet <= 0 || round < maxPerSubnet; round++ {
+		added := false
+		for _, subnet := range order {
+			if round >= len(groups[subnet]) {
+				continue
+			}
+			if maxResults > 0 && len(sample) == maxResults {
+				return sample
+			}
+			sample = append(sample, groups[subnet][round])
+			added = true
+		}
+		if !added {
+			break
+		}
+	}
+	return sample
+}
+
+// bootstrapPeers returns the addresses of peer.discovery.bootstrapPeers
+func bootstrapPeers() []string {
+	var addresses []string
+	for _, address := range strings.Split(viper.GetString("peer.discovery.bootstrapPeers"), ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// DiversityScore returns the number of distinct subnets of the connected
+// peers over the number of connected peers
+func (p *PeerImpl) DiversityScore() float64 {
+	var addresses []string
+	for _, entry := range p.registry.Entries() {
+		addresses = append(addresses, entry.Endpoint.Address)
+	}
+	return diversityScore(addresses)
+}
+
+// GetDiversePeers asks the peer at address for up to maxResults of its peers,
+// at most maxPerSubnet of them in each /24 subnet
+func GetDiversePeers(address string, maxResults, maxPerSubnet uint32) ([]*pb.PeerEndpoint, error) {
+	data, err := proto.Marshal(&pb.GetPeersDiverse{MaxResults: maxResults, MaxPerSubnet: maxPerSubnet})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling GetPeersDiverse: %s", err)
+	}
+	peers, err := requestPeerList(address, &pb.Message{Type: pb.Message_DISC_GET_PEERS_DIVERSE, Payload: data}, viper.GetDuration("peer.chat.requestTimeout"))
+	if err != nil {
+		return nil, fmt.Errorf("Error getting diverse peer list from %s: %s", address, err)
+	}
+	return peers, nil
+}
+
+// ensureSubnetDiversity connects to bootstrap peers of new subnets when the
+// connected peers span fewer than peer.discovery.minSubnetDiversity subnets,
+// for an attacker to need addresses in that many subnets to eclipse this peer
+func (p *PeerImpl) ensureSubnetDiversity(connected []string) {
+	spanned := len(subnets(connected))
+	peerLogger.Debugf("Connected to %d peers in %d subnets, diversity score %.2f", len(connected), spanned, diversityScore(connected))
+	minSubnets := viper.GetInt("peer.discovery.minSubnetDiversity")
+	if spanned >= minSubnets {
+		return
+	}
+	candidates := diversityCandidates(connected, bootstrapPeers(), minSubnets)
+	peerLogger.Warningf("Connected peers span %d subnets, under the %d required, connecting to bootstrap peers %v", spanned, minSubnets, candidates)
+	if len(candidates) > 0 {
+		p.chatWithSomePeers(candidates)
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestAddressSubnet(t *testing.T) {
+	for address, expected := range map[string]string{
+		"10.1.2.3:30303":         "10.1.0.0/16",
+		"10.1.200.7:30303":       "10.1.0.0/16",
+		"10.2.2.3":               "10.2.0.0/16",
+		"[2001:db8::1]:30303":    "2001:db8::/32",
+		"vp0.example.com:30303":  "vp0.example.com",
+		"[2001:db8:ff::2]:30303": "2001:db8::/32",
+	} {
+		if subnet := addressSubnet(address); subnet != expected {
+			t.Errorf("Expected %s to be in %s, got %s", address, expected, subnet)
+		}
+	}
+}
+
+func TestDiversityScore(t *testing.T) {
+	if score := diversityScore(nil); score != 0 {
+		t.Errorf("Expected a score of 0 without peers, got %f", score)
+	}
+	if score := diversityScore([]string{"10.1.0.1:30303", "10.1.0.2:30303", "10.2.0.1:30303", "10.3.0.1:30303"}); score != 0.75 {
+		t.Errorf("Expected 3 subnets over 4 peers, got %f", score)
+	}
+}
+
+func TestDiversityCandidates(t *testing.T) {
+	connected := []string{"10.1.0.1:30303", "10.1.0.2:30303"}
+	bootstrap := []string{"10.1.9.9:30303", "10.2.0.1:30303", "10.2.0.2:30303", "10.3.0.1:30303", "10.4.0.1:30303"}
+	if candidates := diversityCandidates(connected, bootstrap, 3); fmt.Sprint(candidates) != "[10.2.0.1:30303 10.3.0.1:30303]" {
+		t.Errorf("Expected one bootstrap peer of each of 2 new subnets, got %v", candidates)
+	}
+	if candidates := diversityCandidates(connected, bootstrap, 1); len(candidates) != 0 {
+		t.Errorf("Expected no bootstrap peer when diverse enough, got %v", candidates)
+	}
+	if candidates := diversityCandidates(connected, bootstrap, 10); len(candidates) != 3 {
+		t.Errorf("Expected every new subnet of the bootstrap peers, got %v", candidates)
+	}
+}
+
+func TestDiverseSample(t *testing.T) {
+	var peers []*pb.PeerEndpoint
+	for i := 0; i < 100; i++ {
+		peers = append(peers, &pb.PeerEndpoint{Address: fmt.Sprintf("10.0.0.%d:30303", i)})
+	}
+	peers = append(peers,
+		&pb.PeerEndpoint{Address: "10.0.1.1:30303"},
+		&pb.PeerEndpoint{Address: "10.0.1.2:30303"},
+		&pb.PeerEndpoint{Address: "192.168.5.5:30303"})
+	addresses := func(sample []*pb.PeerEndpoint) []string {
+		var addresses []string
+		for _, peer := range sample {
+			addresses = append(addresses, peer.Address)
+		}
+		return addresses
+	}
+
+	sample := DiverseSample(peers, 0, 2)
+	if fmt.Sprint(addresses(sample)) != "[10.0.0.0:30303 10.0.1.1:30303 192.168.5.5:30303 10.0.0.1:30303 10.0.1.2:30303]" {
+		t.Fatalf("Expected 2 peers of each /24 subnet at most, one subnet at a time, got %v", addresses(sample))
+	}
+	if sample := DiverseSample(peers, 3, 2); fmt.Sprint(addresses(sample)) != "[10.0.0.0:30303 10.0.1.1:30303 192.168.5.5:30303]" {
+		t.Fatalf("Expected a sample cut short to span every subnet, got %v", addresses(sample))
+	}
+	if sample := DiverseSample(peers, 0, 0); len(sample) != len(peers) {
+		t.Fatalf("Expected every peer without limits, got %d", len(sample))
+	}
+	if sample := DiverseSample(nil, 5, 1); len(sample) != 0 {
+		t.Fatalf("Expected an empty sample of no peers, got %v", addresses(sample))
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// SpendRecord is the transaction TxID of block BlockNumber spending an output
+type SpendRecord struct {
+	TxID        string
+	BlockNumber uint64
+}
+
+// UTXOIndex records which transaction outputs were spent, and by what
+type UTXOIndex interface {
+	// IsSpent returns the spending of the output, false if it is unspent
+	IsSpent(output pb.TxOutPoint) (*SpendRecord, bool)
+}
+
+// InMemoryUTXOIndex is a UTXOIndex of the spendings it is told of
+type InMemoryUTXOIndex struct {
+	sync.RWMutex
+	spent map[pb.TxOutPoint]SpendRecord
+}
+
+// NewInMemoryUTXOIndex returns an index with no output spent
+func NewInMemoryUTXOIndex() *InMemoryUTXOIndex {
+	return &InMemoryUTXOIndex{spent: make(map[pb.TxOutPoint]SpendRecord)}
+}
+
+// MarkSpent records the output as spent by record, keeping the first
+// spending if it already was. It returns false in that case.
+func (i *InMemoryUTXOIndex) MarkSpent(output pb.TxOutPoint, record SpendRecord) bool {
+	i.Lock()
+	defer i.Unlock()
+	if _, ok := i.spent[output]; ok {
+		return false
+	}
+	i.spent[output] = record
+	return true
+}
+
+// IsSpent implements UTXOIndex
+func (i *InMemoryUTXOIndex) IsSpent(output pb.TxOutPoint) (*SpendRecord, bool) {
+	i.RLock()
+	defer i.RUnlock()
+	record, ok := i.spent[output]
+	if !ok {
+		return nil, false
+	}
+	return &record, true
+}
+
+// SetUTXOIndex sets the UTXOIndex answering CHAIN_QUERY_DOUBLE_SPEND
+// messages. nil, the default, fails them, the ledger not tracking outputs
+// itself.
+func (p *PeerImpl) SetUTXOIndex(index UTXOIndex) {
+	p.optionsMutex.Lock()
+	defer p.optionsMutex.Unlock()
+	p.utxoIndex = index
+}
+
+// FindDoubleSpend returns the spending of the output, nil if it is unspent.
+// It only reads the UTXOIndex, so followers can answer it as validators do.
+func (p *PeerImpl) FindDoubleSpend(input *pb.TxOutPoint) (*SpendRecord, error) {
+	if input == nil {
+		return nil, fmt.Errorf("No transaction output given")
+	}
+	p.optionsMutex.RLock()
+	index := p.utxoIndex
+	p.optionsMutex.RUnlock()
+	if index == nil {
+		return nil, fmt.Errorf("No UTXO index set on this peer")
+	}
+	record, spent := index.IsSpent(*input)
+	if !spent {
+		return nil, nil
+	}
+	return record, nil
+}
+
+// newDoubleSpendResponse returns the CHAIN_DOUBLE_SPEND_RESPONSE payload of the spending, nil if unspent
+func newDoubleSpendResponse(record *SpendRecord) *pb.DoubleSpendResponse {
+	if record == nil {
+		return &pb.DoubleSpendResponse{}
+	}
+	return &pb.DoubleSpendResponse{Found: true, SpendingTxID: record.TxID, BlockNumber: record.BlockNumber}
+}
+
+// FetchDoubleSpend asks the peer at address whether the output was already
+// spent, returning its spending, nil if unspent
+func FetchDoubleSpend(address string, input *pb.TxOutPoint) (*SpendRecord, error) {
+	data, err := proto.Marshal(&pb.QueryDoubleSpend{TxInput: input})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling QueryDoubleSpend: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_QUERY_DOUBLE_SPEND, Payload: data}
+	reply, err := requestOverChat(address, request, pb.Message_CHAIN_DOUBLE_SPEND_RESPONSE)
+	if err != nil {
+		return nil, fmt.Errorf("Error querying spending of output %d of %s from %s: %s", input.Index, input.TxID, address, err)
+	}
+	response := &pb.DoubleSpendResponse{}
+	if err := proto.Unmarshal(reply.Payload, response); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling DoubleSpendResponse: %s", err)
+	}
+	if !response.Found {
+		return nil, nil
+	}
+	return &SpendRecord{TxID: response.SpendingTxID, BlockNumber: response.BlockNumber}, nil
+}
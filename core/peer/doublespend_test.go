@@ -0,0 +1,79 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestInMemoryUTXOIndex(t *testing.T) {
+	index := NewInMemoryUTXOIndex()
+	output := pb.TxOutPoint{TxID: "tx1", Index: 1}
+	if _, spent := index.IsSpent(output); spent {
+		t.Fatal("Expected the output to be unspent")
+	}
+	if !index.MarkSpent(output, SpendRecord{TxID: "tx2", BlockNumber: 7}) {
+		t.Fatal("Expected the first spending to be recorded")
+	}
+	if index.MarkSpent(output, SpendRecord{TxID: "tx3", BlockNumber: 8}) {
+		t.Fatal("Expected a second spending not to replace the first")
+	}
+	record, spent := index.IsSpent(output)
+	if !spent || record.TxID != "tx2" || record.BlockNumber != 7 {
+		t.Fatalf("Expected the output to be spent by tx2 of block 7, got %+v", record)
+	}
+	if _, spent := index.IsSpent(pb.TxOutPoint{TxID: "tx1", Index: 0}); spent {
+		t.Fatal("Expected another output of the transaction to be unspent")
+	}
+}
+
+func TestFindDoubleSpend(t *testing.T) {
+	p := &PeerImpl{}
+	input := &pb.TxOutPoint{TxID: "tx1", Index: 0}
+	if _, err := p.FindDoubleSpend(input); err == nil {
+		t.Fatal("Expected an error without a UTXO index")
+	}
+	index := NewInMemoryUTXOIndex()
+	p.SetUTXOIndex(index)
+	if _, err := p.FindDoubleSpend(nil); err == nil {
+		t.Fatal("Expected an error without an output")
+	}
+	record, err := p.FindDoubleSpend(input)
+	if err != nil || record != nil {
+		t.Fatalf("Expected the output to be unspent, got %+v, %v", record, err)
+	}
+	if response := newDoubleSpendResponse(record); response.Found {
+		t.Fatalf("Expected an unspent response, got %+v", response)
+	}
+	index.MarkSpent(*input, SpendRecord{TxID: "tx2", BlockNumber: 3})
+	if record, err = p.FindDoubleSpend(input); err != nil || record == nil || record.TxID != "tx2" {
+		t.Fatalf("Expected the output to be spent by tx2, got %+v, %v", record, err)
+	}
+	if response := newDoubleSpendResponse(record); !response.Found || response.SpendingTxID != "tx2" || response.BlockNumber != 3 {
+		t.Fatalf("Expected a response with the spending, got %+v", response)
+	}
+}
+
+func TestFetchDoubleSpendWithoutIndex(t *testing.T) {
+	if _, err := FetchDoubleSpend(viper.GetString("peer.address"), &pb.TxOutPoint{TxID: "tx1"}); err == nil {
+		t.Error("Expected an error response when the peer has no UTXO index")
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// drainingReason is the DISC_DISCONNECT payload sent to the Chat streams
+// still active when a drain ends
+const drainingReason = "draining"
+
+// drainPollInterval is how often a drain checks whether the Chat streams ended
+const drainPollInterval = 100 * time.Millisecond
+
+// errDraining is returned to the Chat invocations received while draining
+var errDraining = grpc.Errorf(codes.Unavailable, "peer is draining")
+
+// chatDrainer refuses new Chat streams once draining, and tracks the
+// handlers of the active ones for them to be disconnected when a drain ends
+type chatDrainer struct {
+	sync.Mutex
+	draining bool
+	handlers map[MessageHandler]bool
+}
+
+func newChatDrainer() *chatDrainer {
+	return &chatDrainer{handlers: make(map[MessageHandler]bool)}
+}
+
+// track records the handler of a new Chat stream, returning false if the
+// peer is draining and the stream must be refused
+func (d *chatDrainer) track(handler MessageHandler) bool {
+	d.Lock()
+	defer d.Unlock()
+	if d.draining {
+		return false
+	}
+	d.handlers[handler] = true
+	return true
+}
+
+// untrack forgets the handler of an ended Chat stream
+func (d *chatDrainer) untrack(handler MessageHandler) {
+	d.Lock()
+	defer d.Unlock()
+	delete(d.handlers, handler)
+}
+
+func (d *chatDrainer) startDraining() {
+	d.Lock()
+	defer d.Unlock()
+	d.draining = true
+}
+
+func (d *chatDrainer) isDraining() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.draining
+}
+
+// disconnect sends DISC_DISCONNECT to the handlers of the active Chat
+// streams, returning how many there were
+func (d *chatDrainer) disconnect() int {
+	d.Lock()
+	handlers := make([]MessageHandler, 0, len(d.handlers))
+	for handler := range d.handlers {
+		handlers = append(handlers, handler)
+	}
+	d.Unlock()
+	for _, handler := range handlers {
+		msg := &pb.Message{Type: pb.Message_DISC_DISCONNECT, Payload: []byte(drainingReason), Timestamp: util.CreateUtcTimestamp()}
+		if err := handler.SendMessage(msg); err != nil {
+			peerLogger.Debugf("Error sending %s to a drained peer: %s", pb.Message_DISC_DISCONNECT, err)
+		}
+	}
+	return len(handlers)
+}
+
+// Drain prepares the peer for a rolling upgrade: new Chat invocations are
+// refused with codes.Unavailable, no new Chat is dialed, and /healthz
+// answers 503 for load balancers to stop routing to the peer. It then waits
+// for the active Chat streams to end, or ctx to be done, the streams still
+// active being sent DISC_DISCONNECT and an error being returned. The peer
+// keeps draining after Drain returns.
+func (p *PeerImpl) Drain(ctx context.Context) error {
+	p.drainer.startDraining()
+	peerLogger.Infof("Draining, waiting for %d active Chat streams to end", p.watermarks.ActiveChatStreams())
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		if p.watermarks.ActiveChatStreams() == 0 {
+			peerLogger.Info("Drained, no Chat streams left")
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			n := p.drainer.disconnect()
+			peerLogger.Warningf("Disconnected the %d Chat streams still active when the drain ended: %s", n, ctx.Err())
+			return fmt.Errorf("%d Chat streams still active when the drain ended: %s", n, ctx.Err())
+		}
+	}
+}
+
+// IsDraining returns true once Drain was called
+func (p *PeerImpl) IsDraining() bool {
+	return p.drainer.isDraining()
+}
+
+// HealthzHandler returns an http.Handler answering GET /healthz with 200,
+// or 503 once the peer is draining
+func (p *PeerImpl) HealthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p.IsDraining() {
+			http.Error(w, drainingReason, http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+}
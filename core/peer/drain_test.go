@@ -0,0 +1,99 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// recordingHandler is a MessageHandler recording the messages sent to it
+type recordingHandler struct {
+	MessageHandler
+	sent []*pb.Message
+}
+
+func (h *recordingHandler) SendMessage(msg *pb.Message) error {
+	h.sent = append(h.sent, msg)
+	return nil
+}
+
+func TestChatDrainerRefusesStreams(t *testing.T) {
+	drainer := newChatDrainer()
+	handler := &recordingHandler{}
+	if !drainer.track(handler) {
+		t.Fatal("Expected a stream to be accepted before draining")
+	}
+	drainer.startDraining()
+	if drainer.track(&recordingHandler{}) {
+		t.Fatal("Expected a stream to be refused while draining")
+	}
+	if n := drainer.disconnect(); n != 1 || len(handler.sent) != 1 || handler.sent[0].Type != pb.Message_DISC_DISCONNECT || string(handler.sent[0].Payload) != drainingReason {
+		t.Fatalf("Expected the tracked stream to be disconnected, got %d and %v", n, handler.sent)
+	}
+	drainer.untrack(handler)
+	if n := drainer.disconnect(); n != 0 {
+		t.Fatalf("Expected no stream left to disconnect, got %d", n)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	p := &PeerImpl{drainer: newChatDrainer(), watermarks: NewWatermarkMonitor(0, 0)}
+	handler := &recordingHandler{}
+	p.watermarks.StreamOpened()
+	p.drainer.track(handler)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*drainPollInterval)
+	defer cancel()
+	if err := p.Drain(ctx); err == nil {
+		t.Fatal("Expected the drain to end with a stream still active")
+	}
+	if !p.IsDraining() || len(handler.sent) != 1 || handler.sent[0].Type != pb.Message_DISC_DISCONNECT {
+		t.Fatalf("Expected the remaining stream to be disconnected, got %v", handler.sent)
+	}
+
+	go func() {
+		time.Sleep(drainPollInterval)
+		p.drainer.untrack(handler)
+		p.watermarks.StreamClosed()
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.Drain(ctx); err != nil {
+		t.Fatalf("Expected the drain to end with the last stream: %s", err)
+	}
+	if len(handler.sent) != 1 {
+		t.Fatalf("Expected no more DISC_DISCONNECT once the streams ended, got %d", len(handler.sent))
+	}
+}
+
+func TestHealthzHandler(t *testing.T) {
+	p := &PeerImpl{drainer: newChatDrainer()}
+	for _, expected := range []int{http.StatusOK, http.StatusServiceUnavailable} {
+		recorder := httptest.NewRecorder()
+		p.HealthzHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/healthz", nil))
+		if recorder.Code != expected {
+			t.Errorf("Expected /healthz to answer %d, got %d", expected, recorder.Code)
+		}
+		p.drainer.startDraining()
+	}
+}
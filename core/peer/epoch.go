@@ -0,0 +1,171 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// epochValidators is the validator set of the epochs from FromEpoch on, up to
+// the next set of the schedule
+type epochValidators struct {
+	FromEpoch  uint64 `json:"fromEpoch"`
+	Validators []struct {
+		PeerID      string `json:"peerID"`
+		VotingPower uint64 `json:"votingPower"`
+		PublicKey   []byte `json:"publicKey"`
+	} `json:"validators"`
+}
+
+// EpochSchedule splits the chain into epochs of the same number of blocks,
+// each validated by the validator set of the schedule it falls under
+type EpochSchedule struct {
+	length uint64
+	sets   []*epochValidators
+}
+
+// NewEpochSchedule returns a schedule of epochs of length blocks validated by
+// the sets of the JSON document, an array of objects with a fromEpoch and
+// validators, each validator having a peerID, a votingPower and a base64
+// publicKey. A nil document lists no validator sets.
+func NewEpochSchedule(length uint64, document []byte) (*EpochSchedule, error) {
+	if length == 0 {
+		return nil, fmt.Errorf("Epochs of 0 blocks")
+	}
+	s := &EpochSchedule{length: length}
+	if document != nil {
+		if err := json.Unmarshal(document, &s.sets); err != nil {
+			return nil, fmt.Errorf("Error unmarshalling validator sets: %s", err)
+		}
+	}
+	sort.Sort(byFromEpoch(s.sets))
+	return s, nil
+}
+
+// newEpochScheduleFromConfig returns the schedule of epochs of
+// peer.epochs.length blocks validated by the sets of
+// peer.epochs.validatorsFile, or nil if no length is configured
+func newEpochScheduleFromConfig() (*EpochSchedule, error) {
+	length := uint64(viper.GetInt("peer.epochs.length"))
+	if length == 0 {
+		return nil, nil
+	}
+	var document []byte
+	if path := viper.GetString("peer.epochs.validatorsFile"); path != "" {
+		var err error
+		if document, err = ioutil.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("Error reading validator sets %s: %s", path, err)
+		}
+	}
+	return NewEpochSchedule(length, document)
+}
+
+type byFromEpoch []*epochValidators
+
+func (s byFromEpoch) Len() int           { return len(s) }
+func (s byFromEpoch) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byFromEpoch) Less(i, j int) bool { return s[i].FromEpoch < s[j].FromEpoch }
+
+// Epoch returns epoch n of a chain of height blocks. The validators of the
+// current epoch not covered by the schedule are those of known. Epochs not
+// started yet and past epochs not covered are errors.
+func (s *EpochSchedule) Epoch(n, height uint64, known func() []*pb.ValidatorInfo) (*pb.EpochResponse, error) {
+	if s == nil {
+		return nil, fmt.Errorf("Epochs are not configured, see peer.epochs.length")
+	}
+	if n > (math.MaxUint64-s.length+1)/s.length || n*s.length >= height {
+		return nil, fmt.Errorf("Epoch %d has not started, the chain is %d blocks high", n, height)
+	}
+	epoch := &pb.EpochResponse{EpochNumber: n, StartBlock: n * s.length, EndBlock: n*s.length + s.length - 1}
+	var set *epochValidators
+	for _, candidate := range s.sets {
+		if candidate.FromEpoch <= n {
+			set = candidate
+		}
+	}
+	switch {
+	case set != nil:
+		for _, v := range set.Validators {
+			epoch.Validators = append(epoch.Validators, &pb.ValidatorInfo{PeerID: &pb.PeerID{Name: v.PeerID}, VotingPower: v.VotingPower, PublicKey: v.PublicKey})
+		}
+	case (height-1)/s.length == n:
+		epoch.Validators = known()
+	default:
+		return nil, fmt.Errorf("No validator set known for epoch %d", n)
+	}
+	return epoch, nil
+}
+
+// knownValidators returns this peer if it is a validator and the validating
+// peers of the registry, with a voting power of 1 each, sorted by ID
+func (p *PeerImpl) knownValidators() []*pb.ValidatorInfo {
+	var validators []*pb.ValidatorInfo
+	if p.isValidator {
+		if endpoint, err := p.GetPeerEndpoint(); err == nil {
+			validators = append(validators, &pb.ValidatorInfo{PeerID: endpoint.ID, VotingPower: 1, PublicKey: endpoint.PkiID})
+		}
+	}
+	for _, entry := range p.registry.Entries() {
+		if entry.Endpoint.Type == pb.PeerEndpoint_VALIDATOR {
+			validators = append(validators, &pb.ValidatorInfo{PeerID: entry.Endpoint.ID, VotingPower: 1, PublicKey: entry.Endpoint.PkiID})
+		}
+	}
+	sort.Sort(byValidatorID(validators))
+	return validators
+}
+
+type byValidatorID []*pb.ValidatorInfo
+
+func (s byValidatorID) Len() int           { return len(s) }
+func (s byValidatorID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byValidatorID) Less(i, j int) bool { return s[i].PeerID.Name < s[j].PeerID.Name }
+
+// GetEpoch returns epoch n of the chain of this peer and its validators
+func (p *PeerImpl) GetEpoch(n uint64) (*pb.EpochResponse, error) {
+	p.ledgerWrapper.RLock()
+	height := p.ledgerWrapper.ledger.GetBlockchainSize()
+	p.ledgerWrapper.RUnlock()
+	return p.epochs.Epoch(n, height, p.knownValidators)
+}
+
+// FetchEpochValidators asks the peer at address for the validators of epoch,
+// for a new peer to know which validators to connect to
+func FetchEpochValidators(address string, epoch uint64) ([]*pb.ValidatorInfo, error) {
+	data, err := proto.Marshal(&pb.QueryEpoch{EpochNumber: epoch})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling QueryEpoch: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_QUERY_EPOCH, Payload: data}
+	reply, err := requestOverChat(address, request, pb.Message_CHAIN_EPOCH_RESPONSE)
+	if err != nil {
+		return nil, fmt.Errorf("Error querying epoch %d of %s: %s", epoch, address, err)
+	}
+	response := &pb.EpochResponse{}
+	if err := proto.Unmarshal(reply.Payload, response); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling EpochResponse: %s", err)
+	}
+	return response.Validators, nil
+}
@@ -0,0 +1,67 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// knownValidator is the only validator known to the peer
+func knownValidator() []*pb.ValidatorInfo {
+	return []*pb.ValidatorInfo{{PeerID: &pb.PeerID{Name: "known"}, VotingPower: 1}}
+}
+
+func TestEpochSchedule(t *testing.T) {
+	schedule, err := NewEpochSchedule(10, []byte(`[
+		{"fromEpoch": 2, "validators": [{"peerID": "vp2", "votingPower": 3, "publicKey": "a2V5"}]},
+		{"fromEpoch": 0, "validators": [{"peerID": "vp0", "votingPower": 1}, {"peerID": "vp1", "votingPower": 1}]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	epoch, err := schedule.Epoch(1, 45, knownValidator)
+	if err != nil || epoch.StartBlock != 10 || epoch.EndBlock != 19 || len(epoch.Validators) != 2 || epoch.Validators[1].PeerID.Name != "vp1" {
+		t.Fatalf("Expected epoch 1 to cover blocks 10 to 19 validated by vp0 and vp1, got %v, %v", epoch, err)
+	}
+	if epoch, err = schedule.Epoch(4, 45, knownValidator); err != nil || len(epoch.Validators) != 1 || epoch.Validators[0].VotingPower != 3 || string(epoch.Validators[0].PublicKey) != "key" {
+		t.Fatalf("Expected the set from epoch 2 on to validate epoch 4, got %v, %v", epoch, err)
+	}
+	if _, err = schedule.Epoch(5, 45, knownValidator); err == nil {
+		t.Error("Expected an error for an epoch not started yet")
+	}
+	if _, err = (*EpochSchedule)(nil).Epoch(0, 45, knownValidator); err == nil {
+		t.Error("Expected an error without epochs configured")
+	}
+}
+
+func TestEpochScheduleKnownValidators(t *testing.T) {
+	schedule, err := NewEpochSchedule(10, []byte(`[{"fromEpoch": 3, "validators": []}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epoch, err := schedule.Epoch(2, 25, knownValidator); err != nil || len(epoch.Validators) != 1 || epoch.Validators[0].PeerID.Name != "known" {
+		t.Fatalf("Expected the current epoch to be validated by the known validators, got %v, %v", epoch, err)
+	}
+	if _, err := schedule.Epoch(1, 25, knownValidator); err == nil {
+		t.Error("Expected an error for a past epoch not covered by the schedule")
+	}
+	if _, err := NewEpochSchedule(0, nil); err == nil {
+		t.Error("Expected an error for epochs of 0 blocks")
+	}
+}
@@ -18,6 +18,8 @@ package peer
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	pb "github.com/hyperledger/fabric/protos"
 )
@@ -28,7 +30,7 @@ type DuplicateHandlerError struct {
 }
 
 func (d *DuplicateHandlerError) Error() string {
-	return fmt.Sprintf("Duplicate Handler error: %s", d.To)
+	return fmt.Sprintf("Duplicate Handler error: %v", d.To)
 }
 
 func newDuplicateHandlerError(msgHandler MessageHandler) error {
@@ -38,3 +40,209 @@ func newDuplicateHandlerError(msgHandler MessageHandler) error {
 	}
 	return &DuplicateHandlerError{To: to}
 }
+
+// CapabilityMismatchError returned if a capability required by this peer or the
+// remote peer is not supported by both. The Chat stream is then closed.
+type CapabilityMismatchError struct {
+	Missing []string
+}
+
+func (c *CapabilityMismatchError) Error() string {
+	return fmt.Sprintf("Capability mismatch, missing: %s", strings.Join(c.Missing, ", "))
+}
+
+// RegistryFullError returned if the remote peer refused the DISC_HELLO
+// exchange as its registry is full, or this peer refused the remote one for
+// that reason. The Chat stream is then closed.
+type RegistryFullError struct {
+	RetryAfter time.Duration
+}
+
+func (r *RegistryFullError) Error() string {
+	return fmt.Sprintf("Peer registry full, retry after %s", r.RetryAfter)
+}
+
+// DisconnectedError returned if the remote peer sent a DISC_DISCONNECT, for
+// instance as it evicted this peer for one of a higher priority. The Chat
+// stream is then closed.
+type DisconnectedError struct {
+	Reason string
+}
+
+func (d *DisconnectedError) Error() string {
+	return fmt.Sprintf("Disconnected by the remote peer: %s", d.Reason)
+}
+
+// BannedError returned if the remote peer is banned, by its ID or IP address.
+// The Chat stream is then closed.
+type BannedError struct {
+	Keys []string
+}
+
+func (b *BannedError) Error() string {
+	return fmt.Sprintf("Peer banned: %s", strings.Join(b.Keys, ", "))
+}
+
+// UnauthorizedError returned if the remote peer refused the auth token of the
+// DISC_HELLO of this peer, or this peer refused the remote one. The Chat
+// stream is then closed.
+type UnauthorizedError struct {
+	Reason string
+}
+
+func (u *UnauthorizedError) Error() string {
+	return fmt.Sprintf("Peer unauthorized: %s", u.Reason)
+}
+
+// HandshakeFailedError returned if the DISC_HELLO exchange of a Chat session
+// failed. Redial is set if the stream itself failed, a new connection is then
+// needed before trying again.
+type HandshakeFailedError struct {
+	Attempts int
+	Err      error
+	Redial   bool
+}
+
+func (h *HandshakeFailedError) Error() string {
+	return fmt.Sprintf("Handshake failed after %d attempt(s): %s", h.Attempts, h.Err)
+}
+
+// TypeAlreadyRegisteredError returned if a function is registered with a
+// MessageRouter for a message type that already has one.
+type TypeAlreadyRegisteredError struct {
+	Type         pb.Message_Type
+	RegisteredBy string
+}
+
+func (t *TypeAlreadyRegisteredError) Error() string {
+	return fmt.Sprintf("Message type %s already registered by %q", t.Type, t.RegisteredBy)
+}
+
+// MessageTooLargeError returned if a message exceeds the size limit of the
+// chat session it was received on.
+type MessageTooLargeError struct {
+	Type  pb.Message_Type
+	Size  int
+	Limit int
+}
+
+func (m *MessageTooLargeError) Error() string {
+	return fmt.Sprintf("%s message of %d bytes exceeds the limit of %d bytes", m.Type, m.Size, m.Limit)
+}
+
+// TransactionNotFoundError returned if the peer at Address has no committed
+// transaction TxID.
+type TransactionNotFoundError struct {
+	TxID    string
+	Address string
+}
+
+func (t *TransactionNotFoundError) Error() string {
+	return fmt.Sprintf("Transaction %s not found at %s", t.TxID, t.Address)
+}
+
+// AccountNotFoundError returned if the peer at Address knows of no account
+// AccountID, neither by its transactions nor by its balance.
+type AccountNotFoundError struct {
+	AccountID string
+	Address   string
+}
+
+func (a *AccountNotFoundError) Error() string {
+	return fmt.Sprintf("Account %s not found at %s", a.AccountID, a.Address)
+}
+
+// BlockNotFoundError returned if the peer at Address has no block hashing to
+// Hash.
+type BlockNotFoundError struct {
+	Hash    []byte
+	Address string
+}
+
+func (b *BlockNotFoundError) Error() string {
+	return fmt.Sprintf("Block %x not found at %s", b.Hash, b.Address)
+}
+
+// SyncRangeCorruptError returned if the blocks FromBlock to ToBlock synced
+// from the peer at Address are not those whose root it answered a
+// CHAIN_SYNC_VERIFY_REQUEST with.
+type SyncRangeCorruptError struct {
+	FromBlock uint64
+	ToBlock   uint64
+	Address   string
+}
+
+func (s *SyncRangeCorruptError) Error() string {
+	return fmt.Sprintf("Blocks %d to %d synced from %s are corrupt", s.FromBlock, s.ToBlock, s.Address)
+}
+
+// UncleRejectedError returned if the peer at Address rejected a reported
+// uncle block for Reason.
+type UncleRejectedError struct {
+	Reason  string
+	Address string
+}
+
+func (u *UncleRejectedError) Error() string {
+	return fmt.Sprintf("Uncle rejected by %s: %s", u.Address, u.Reason)
+}
+
+// QueryUnsupportedError returned if the peer at Address answered a query of
+// Type with a CHAIN_QUERY_UNSUPPORTED for Reason.
+type QueryUnsupportedError struct {
+	Type    pb.Message_Type
+	Reason  string
+	Address string
+}
+
+func (q *QueryUnsupportedError) Error() string {
+	return fmt.Sprintf("%s not supported by %s: %s", q.Type, q.Address, q.Reason)
+}
+
+// SchemaVersionError returned if a peer dropped a CHAIN_TRANSACTIONS batch as
+// it only supports the schema versions SupportedMin to SupportedMax.
+type SchemaVersionError struct {
+	Version      uint32
+	SupportedMin uint32
+	SupportedMax uint32
+}
+
+func (s *SchemaVersionError) Error() string {
+	return fmt.Sprintf("Transaction schema version %d not supported, supported versions are %d to %d", s.Version, s.SupportedMin, s.SupportedMax)
+}
+
+// TransactionsNotAcknowledgedError returned if the peer at Address sent no
+// reply to a CHAIN_TRANSACTIONS batch for Timeout, the batch then possibly
+// dropped before being processed.
+type TransactionsNotAcknowledgedError struct {
+	Timeout time.Duration
+	Address string
+}
+
+func (t *TransactionsNotAcknowledgedError) Error() string {
+	return fmt.Sprintf("No reply to the transactions sent to %s within %s", t.Address, t.Timeout)
+}
+
+// ConfigError returned if the configuration Field of the peer connections
+// holds an invalid Value.
+type ConfigError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (c *ConfigError) Error() string {
+	return fmt.Sprintf("Invalid %s %q: %s", c.Field, c.Value, c.Reason)
+}
+
+// ConfigErrors returned with a ConfigError per invalid field of the
+// configuration of the peer connections.
+type ConfigErrors []*ConfigError
+
+func (c ConfigErrors) Error() string {
+	messages := make([]string, len(c))
+	for i, err := range c {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
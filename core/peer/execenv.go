@@ -0,0 +1,87 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"sort"
+	"sync"
+)
+
+// nativeExecutionEnv is the execution environment of the batches processed by
+// the chaincode of the peer itself, the one of the batches without executionEnv
+const nativeExecutionEnv = "native"
+
+// unsupportedExecutionEnvReason is the reason of the CHAIN_TRANSACTIONS_ERROR
+// answering a batch targeting an execution environment without processor
+const unsupportedExecutionEnvReason = "unsupported execution environment"
+
+// ProcessorRegistryAccessor interface enables a Peer to hand out the registry
+// of the processors of its execution environments
+type ProcessorRegistryAccessor interface {
+	GetProcessorRegistry() *ProcessorRegistry
+}
+
+// ProcessorRegistry holds the TransactionBatchProcessor the CHAIN_TRANSACTIONS
+// batches are routed to by their executionEnv, e.g. evm or wasm
+type ProcessorRegistry struct {
+	sync.RWMutex
+	processors map[string]TransactionBatchProcessor
+}
+
+// NewProcessorRegistry returns a registry without processors
+func NewProcessorRegistry() *ProcessorRegistry {
+	return &ProcessorRegistry{processors: make(map[string]TransactionBatchProcessor)}
+}
+
+// Register has the batches of execution environment env processed by p,
+// replacing any processor registered for env before
+func (r *ProcessorRegistry) Register(env string, p TransactionBatchProcessor) {
+	r.Lock()
+	defer r.Unlock()
+	r.processors[env] = p
+}
+
+// Get returns the processor of execution environment env, the native one if
+// env is empty, and false if none is registered
+func (r *ProcessorRegistry) Get(env string) (TransactionBatchProcessor, bool) {
+	if env == "" {
+		env = nativeExecutionEnv
+	}
+	r.RLock()
+	defer r.RUnlock()
+	p, ok := r.processors[env]
+	return p, ok
+}
+
+// Supported returns the execution environments with a processor, sorted, as
+// advertised in the executionEnvs of the DISC_HELLO of the peer
+func (r *ProcessorRegistry) Supported() []string {
+	r.RLock()
+	defer r.RUnlock()
+	envs := make([]string, 0, len(r.processors))
+	for env := range r.processors {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+	return envs
+}
+
+// GetProcessorRegistry returns the registry the CHAIN_TRANSACTIONS batches are
+// routed through by their executionEnv
+func (p *PeerImpl) GetProcessorRegistry() *ProcessorRegistry {
+	return p.processors
+}
@@ -0,0 +1,56 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+type envProcessor string
+
+func (p envProcessor) ProcessTransactionBatch(batch *pb.TransactionBlock, progress BatchProgressReporter) (*pb.TransactionsValidationError, *BatchResult, error) {
+	return nil, nil, fmt.Errorf("processed by %s", p)
+}
+
+func (p envProcessor) ProcessImmediate(batch *pb.TransactionBlock) (*pb.TransactionsValidationError, *BatchResult, error) {
+	return p.ProcessTransactionBatch(batch, nil)
+}
+
+func TestProcessorRegistry(t *testing.T) {
+	registry := NewProcessorRegistry()
+	if _, ok := registry.Get(""); ok {
+		t.Fatal("Expected no processor in an empty registry")
+	}
+	registry.Register("wasm", envProcessor("wasm"))
+	registry.Register(nativeExecutionEnv, envProcessor("native"))
+	registry.Register("evm", envProcessor("evm"))
+	if envs := fmt.Sprint(registry.Supported()); envs != "[evm native wasm]" {
+		t.Errorf("Expected the registered environments sorted, got %s", envs)
+	}
+	if p, ok := registry.Get(""); !ok || p != envProcessor("native") {
+		t.Errorf("Expected batches without executionEnv to be processed natively, got %v", p)
+	}
+	if p, ok := registry.Get("evm"); !ok || p != envProcessor("evm") {
+		t.Errorf("Expected the evm processor, got %v", p)
+	}
+	if _, ok := registry.Get("jvm"); ok {
+		t.Error("Expected no processor for an unregistered environment")
+	}
+}
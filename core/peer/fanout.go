@@ -0,0 +1,84 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// registryFull returns true if the registry holds peer.discovery.maxRegisteredPeers
+// peers and id is not one of them
+func registryFull(registry *PeerRegistry, id *pb.PeerID) bool {
+	max := viper.GetInt("peer.discovery.maxRegisteredPeers")
+	if max <= 0 {
+		return false
+	}
+	if _, known := registry.Get(id); known {
+		return false
+	}
+	return registry.Len() >= max
+}
+
+// registryFullRetryAfter returns the retry hint sent in DISC_REGISTRY_FULL.
+// Registry entries do not expire, they are removed as their Chat ends, so the
+// hint is the touch period: how often peers check for dropped connections
+// and reconnect.
+func registryFullRetryAfter() uint32 {
+	seconds := uint32((currentReloadableConfig().TouchPeriod + time.Second - 1) / time.Second)
+	if seconds == 0 {
+		seconds = 1
+	}
+	return seconds
+}
+
+// peerBackoff keeps the addresses of the peers which asked not to be
+// contacted again before a given time
+type peerBackoff struct {
+	sync.Mutex
+	until map[string]time.Time
+}
+
+func newPeerBackoff() *peerBackoff {
+	return &peerBackoff{until: make(map[string]time.Time)}
+}
+
+// set records that the peer at address is not to be contacted for d
+func (b *peerBackoff) set(address string, d time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+	b.until[address] = time.Now().Add(d)
+}
+
+// active returns true if the peer at address is not to be contacted yet
+func (b *peerBackoff) active(address string) bool {
+	b.Lock()
+	defer b.Unlock()
+	until, ok := b.until[address]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(b.until, address)
+		return false
+	}
+	return true
+}
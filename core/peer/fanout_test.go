@@ -0,0 +1,61 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestRegistryFull(t *testing.T) {
+	defer viper.Set("peer.discovery.maxRegisteredPeers", viper.GetInt("peer.discovery.maxRegisteredPeers"))
+	registry := NewPeerRegistry()
+	registry.Add(&pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp1"}})
+	registry.Add(&pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp2"}})
+
+	viper.Set("peer.discovery.maxRegisteredPeers", 0)
+	if registryFull(registry, &pb.PeerID{Name: "vp3"}) {
+		t.Error("Expected no limit when maxRegisteredPeers is 0")
+	}
+	viper.Set("peer.discovery.maxRegisteredPeers", 2)
+	if !registryFull(registry, &pb.PeerID{Name: "vp3"}) {
+		t.Error("Expected the registry to be full for an unknown peer")
+	}
+	if registryFull(registry, &pb.PeerID{Name: "vp1"}) {
+		t.Error("Expected a known peer to be accepted when the registry is full")
+	}
+	viper.Set("peer.discovery.maxRegisteredPeers", 3)
+	if registryFull(registry, &pb.PeerID{Name: "vp3"}) {
+		t.Error("Expected the registry not to be full")
+	}
+}
+
+func TestPeerBackoff(t *testing.T) {
+	backoff := newPeerBackoff()
+	backoff.set("10.0.0.1:30303", time.Hour)
+	backoff.set("10.0.0.2:30303", -time.Second)
+	if !backoff.active("10.0.0.1:30303") {
+		t.Error("Expected the backoff of 10.0.0.1:30303 to be active")
+	}
+	if backoff.active("10.0.0.2:30303") || backoff.active("10.0.0.3:30303") {
+		t.Error("Expected no backoff for expired and unknown addresses")
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// newForkChoice returns the fork choice of a peer whose canonical chain ends
+// at tip. The ledger keeps a single chain, its tip being the only one known.
+func newForkChoice(tip *ChainTip) *pb.ForkChoice {
+	return &pb.ForkChoice{Tips: []*pb.ChainTip{{Hash: tip.BlockHash, Height: tip.BlockNumber + 1, TotalWork: tip.TotalDifficulty}}}
+}
+
+// FetchForkChoice asks the peer at address for the chain tips it knows of, the one it considers canonical first
+func FetchForkChoice(ctx context.Context, address string) (tips []*pb.ChainTip, err error) {
+	ctx, cancel := context.WithTimeout(ctx, viper.GetDuration("peer.chat.requestTimeout"))
+	defer cancel()
+	err = withRequestStreamContext(ctx, address, func(stream ChatStream) error {
+		data, err := proto.Marshal(&pb.QueryForkChoice{})
+		if err != nil {
+			return fmt.Errorf("Error marshalling QueryForkChoice: %s", err)
+		}
+		reply, err := requestOverStream(stream, &pb.Message{Type: pb.Message_CHAIN_QUERY_FORK_CHOICE, Payload: data}, pb.Message_CHAIN_FORK_CHOICE)
+		if err != nil {
+			return err
+		}
+		choice := &pb.ForkChoice{}
+		if err := proto.Unmarshal(reply.Payload, choice); err != nil {
+			return fmt.Errorf("Error unmarshalling ForkChoice: %s", err)
+		}
+		tips = choice.Tips
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error getting fork choice from %s: %s", address, err)
+	}
+	return tips, nil
+}
+
+// pluralityTip returns the tip preferred, listed first, by the most peers out
+// of their fork choices. Tips preferred by as many peers are broken by the
+// highest total work, then the highest height, then the lowest hash.
+func pluralityTip(choices [][]*pb.ChainTip) (*ChainTip, error) {
+	votes := make(map[string]int)
+	var best *pb.ChainTip
+	for _, tips := range choices {
+		if len(tips) == 0 || tips[0] == nil || tips[0].Height == 0 {
+			continue
+		}
+		tip := tips[0]
+		votes[string(tip.Hash)]++
+		if best == nil || preferTip(tip, votes[string(tip.Hash)], best, votes[string(best.Hash)]) {
+			best = tip
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("No peer reported a chain tip")
+	}
+	return &ChainTip{BlockNumber: best.Height - 1, BlockHash: best.Hash, TotalDifficulty: best.TotalWork}, nil
+}
+
+// preferTip returns whether tip with its votes wins over other with its
+func preferTip(tip *pb.ChainTip, votes int, other *pb.ChainTip, otherVotes int) bool {
+	if votes != otherVotes {
+		return votes > otherVotes
+	}
+	if tip.TotalWork != other.TotalWork {
+		return tip.TotalWork > other.TotalWork
+	}
+	if tip.Height != other.Height {
+		return tip.Height > other.Height
+	}
+	return bytes.Compare(tip.Hash, other.Hash) < 0
+}
+
+// ResolveFork queries the peers at addresses concurrently with
+// CHAIN_QUERY_FORK_CHOICE and returns the chain tip most of them prefer, for
+// a client to pick the majority fork after a network split. Ties are broken
+// by the total work of the chains. Peers failing to answer before ctx is done
+// are left out of the tally.
+func ResolveFork(ctx context.Context, addresses []string) (*ChainTip, error) {
+	choices := make([][]*pb.ChainTip, len(addresses))
+	var wg sync.WaitGroup
+	for i, address := range addresses {
+		wg.Add(1)
+		go func(i int, address string) {
+			defer wg.Done()
+			tips, err := FetchForkChoice(ctx, address)
+			if err != nil {
+				peerLogger.Debugf("Leaving %s out of the fork choice: %s", address, err)
+				return
+			}
+			choices[i] = tips
+		}(i, address)
+	}
+	wg.Wait()
+	return pluralityTip(choices)
+}
@@ -0,0 +1,59 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestPluralityTip(t *testing.T) {
+	a := &pb.ChainTip{Hash: []byte("a"), Height: 10, TotalWork: 10}
+	b := &pb.ChainTip{Hash: []byte("b"), Height: 9, TotalWork: 9}
+	c := &pb.ChainTip{Hash: []byte("c"), Height: 9, TotalWork: 12}
+	tip, err := pluralityTip([][]*pb.ChainTip{{b}, {a, b}, nil, {b, a}, {a}, {b}})
+	if err != nil || !bytes.Equal(tip.BlockHash, []byte("b")) || tip.BlockNumber != 8 || tip.TotalDifficulty != 9 {
+		t.Fatalf("Expected the tip preferred by most peers, got %+v, %v", tip, err)
+	}
+	tip, err = pluralityTip([][]*pb.ChainTip{{a}, {c}, {b}})
+	if err != nil || !bytes.Equal(tip.BlockHash, []byte("c")) {
+		t.Fatalf("Expected the tie to be broken by the total work, got %+v, %v", tip, err)
+	}
+	if _, err := pluralityTip([][]*pb.ChainTip{nil, {}}); err == nil {
+		t.Fatal("Expected an error without any tip")
+	}
+}
+
+func TestResolveFork(t *testing.T) {
+	address := viper.GetString("peer.address")
+	tips, err := FetchForkChoice(context.Background(), address)
+	if err != nil {
+		t.Fatalf("Error getting fork choice: %s", err)
+	}
+	if len(tips) != 1 || tips[0].Height == 0 {
+		t.Fatalf("Expected the tip of the chain of the peer, got %v", tips)
+	}
+	tip, err := ResolveFork(context.Background(), []string{address, address})
+	if err != nil || !bytes.Equal(tip.BlockHash, tips[0].Hash) || tip.BlockNumber != tips[0].Height-1 {
+		t.Fatalf("Expected the tip of the peer, got %+v, %v", tip, err)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/core/crypto/primitives"
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// brokenForwardingChainReason is the reason of the TransactionsError of a
+// batch whose forwarding chain does not verify
+const brokenForwardingChainReason = "broken forwarding chain"
+
+// forwardedBatchHash returns the hash of what a ForwardingRecord vouches
+// for, the transactions and gas of the batch. The hops are covered by the
+// chain itself, the signatures are verified on their own and the schema
+// version may be lowered on the way to an older peer.
+func forwardedBatchHash(batch *pb.TransactionBlock) ([]byte, error) {
+	data, err := proto.Marshal(&pb.TransactionBlock{Transactions: batch.Transactions, GasLimit: batch.GasLimit, GasPrice: batch.GasPrice, Priority: batch.Priority})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling TransactionBlock: %s", err)
+	}
+	return sha256Sum(data), nil
+}
+
+// forwardingSigningBytes returns the bytes record i of the chain is signed
+// over, the records before it followed by the record without its signature
+func forwardingSigningBytes(chain []*pb.ForwardingRecord, i int) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, record := range chain[:i] {
+		data, err := proto.Marshal(record)
+		if err != nil {
+			return nil, fmt.Errorf("Error marshalling ForwardingRecord: %s", err)
+		}
+		buf.Write(data)
+	}
+	unsigned := *chain[i]
+	unsigned.Signature = nil
+	data, err := proto.Marshal(&unsigned)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling ForwardingRecord: %s", err)
+	}
+	buf.Write(data)
+	return buf.Bytes(), nil
+}
+
+// appendForwardingRecord appends the record of the relay peerID, signed
+// with sign, to the forwarding chain of the batch it forwards
+func appendForwardingRecord(batch *pb.TransactionBlock, peerID string, sign func(msg []byte) ([]byte, error)) error {
+	hash, err := forwardedBatchHash(batch)
+	if err != nil {
+		return err
+	}
+	chain := append(append([]*pb.ForwardingRecord(nil), batch.ForwardingChain...), &pb.ForwardingRecord{PeerID: peerID, BatchHash: hash, Timestamp: util.CreateUtcTimestamp()})
+	data, err := forwardingSigningBytes(chain, len(chain)-1)
+	if err != nil {
+		return err
+	}
+	if chain[len(chain)-1].Signature, err = sign(data); err != nil {
+		return fmt.Errorf("Error signing the forwarding record of %s: %s", peerID, err)
+	}
+	batch.ForwardingChain = chain
+	return nil
+}
+
+// VerifyForwardingChain checks that every relay the batch went through, as
+// listed by its hops, appended a record to its forwarding chain signed with
+// its key of knownKeys, and that the last relay forwarded the batch as it is.
+// A batch without hops was not relayed and has nothing to verify.
+func VerifyForwardingChain(batch *pb.TransactionBlock, knownKeys map[string]*ecdsa.PublicKey) error {
+	chain := batch.ForwardingChain
+	if len(chain) != len(batch.Hops) {
+		return fmt.Errorf("The batch went through %d relays but carries %d forwarding records", len(batch.Hops), len(chain))
+	}
+	for i, record := range chain {
+		if record.PeerID != batch.Hops[i] {
+			return fmt.Errorf("Forwarding record %d is of %s instead of hop %s", i, record.PeerID, batch.Hops[i])
+		}
+		key, ok := knownKeys[record.PeerID]
+		if !ok {
+			return fmt.Errorf("No public key known for relay %s", record.PeerID)
+		}
+		data, err := forwardingSigningBytes(chain, i)
+		if err != nil {
+			return err
+		}
+		if valid, err := primitives.ECDSAVerify(key, data, record.Signature); err != nil || !valid {
+			return fmt.Errorf("Invalid signature of the forwarding record of %s", record.PeerID)
+		}
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+	hash, err := forwardedBatchHash(batch)
+	if err != nil {
+		return err
+	}
+	if last := chain[len(chain)-1]; !bytes.Equal(hash, last.BatchHash) {
+		return fmt.Errorf("The batch differs from the one %s forwarded", last.PeerID)
+	}
+	return nil
+}
+
+// brokenForwardingChainError returns the TransactionsError of a batch whose
+// forwarding chain does not verify, listing all of its transactions
+func brokenForwardingChainError(batch *pb.TransactionBlock) *pb.TransactionsError {
+	transactionsError := &pb.TransactionsError{Reason: brokenForwardingChainReason}
+	for _, tx := range batch.Transactions {
+		transactionsError.TxIDs = append(transactionsError.TxIDs, tx.Uuid)
+	}
+	return transactionsError
+}
+
+// ForwardingChainChecker interface enables a Peer to verify the forwarding
+// chain of the CHAIN_TRANSACTIONS batches it receives
+type ForwardingChainChecker interface {
+	// CheckForwardingChain returns nil if the chain is valid or not checked
+	CheckForwardingChain(batch *pb.TransactionBlock) error
+}
+
+// newForwardingKeysFromConfig returns the keys of the <peerID>.pem files of
+// peer.tx.forwardingProof.publicKeysPath, nil if none are configured
+func newForwardingKeysFromConfig() StaticPublicKeyRegistry {
+	dir := viper.GetString("peer.tx.forwardingProof.publicKeysPath")
+	if dir == "" {
+		return nil
+	}
+	return loadPublicKeyRegistry(dir)
+}
+
+// CheckForwardingChain verifies the forwarding chain of the batch against the
+// relay keys of peer.tx.forwardingProof.publicKeysPath, if any are configured
+func (p *PeerImpl) CheckForwardingChain(batch *pb.TransactionBlock) error {
+	if p.forwardingKeys == nil {
+		return nil
+	}
+	return VerifyForwardingChain(batch, p.forwardingKeys)
+}
@@ -0,0 +1,136 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/crypto/primitives"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// relayThrough forwards the batch through a signing relay of each of ids in
+// turn, returning the batch the last one sent and the keys of the relays
+func relayThrough(t *testing.T, batch *pb.TransactionBlock, ids ...string) (*pb.TransactionBlock, StaticPublicKeyRegistry) {
+	primitives.SetSecurityLevel("SHA3", 256)
+	keys := make(StaticPublicKeyRegistry)
+	for _, id := range ids {
+		key, err := primitives.NewECDSAKey()
+		if err != nil {
+			t.Fatalf("Error generating key: %s", err)
+		}
+		keys[id] = &key.PublicKey
+		relay := NewForwardingProcessor(id, []string{"up:30303"})
+		relay.sign = func(msg []byte) ([]byte, error) { return primitives.ECDSASign(key, msg) }
+		relay.send = func(address string, forwarded *pb.TransactionBlock) error {
+			batch = forwarded
+			return nil
+		}
+		if err := relay.Forward(batch); err != nil {
+			t.Fatalf("Error forwarding through %s: %s", id, err)
+		}
+	}
+	return batch, keys
+}
+
+func newRelayedBatch() *pb.TransactionBlock {
+	return &pb.TransactionBlock{
+		Transactions:        []*pb.Transaction{{Uuid: "tx0", Payload: []byte("payload0")}, {Uuid: "tx1", Payload: []byte("payload1")}},
+		GasLimit:            1000,
+		AggregateSignatures: []*pb.AggregateSignature{{TxID: "tx0", Scheme: ecdsaAggregateScheme}},
+	}
+}
+
+func TestVerifyForwardingChain(t *testing.T) {
+	if err := VerifyForwardingChain(newRelayedBatch(), nil); err != nil {
+		t.Fatalf("Expected a batch which was not relayed to verify, got %s", err)
+	}
+	batch, keys := relayThrough(t, newRelayedBatch(), "relay0", "relay1")
+	if len(batch.ForwardingChain) != 2 || batch.ForwardingChain[0].PeerID != "relay0" || batch.ForwardingChain[1].PeerID != "relay1" {
+		t.Fatalf("Expected the records of relay0 and relay1, got %v", batch.ForwardingChain)
+	}
+	if len(batch.AggregateSignatures) != 1 {
+		t.Errorf("Expected the aggregate signatures to be forwarded, got %d", len(batch.AggregateSignatures))
+	}
+	if err := VerifyForwardingChain(batch, keys); err != nil {
+		t.Fatalf("Expected the forwarding chain to verify, got %s", err)
+	}
+	batch.SchemaVersion = 1
+	if err := VerifyForwardingChain(batch, keys); err != nil {
+		t.Errorf("Expected a lowered schema version not to break the chain, got %s", err)
+	}
+}
+
+func TestVerifyForwardingChainTampering(t *testing.T) {
+	batch, keys := relayThrough(t, newRelayedBatch(), "relay0", "relay1")
+
+	tampered := *batch
+	tampered.Transactions = []*pb.Transaction{batch.Transactions[0], {Uuid: "tx1", Payload: []byte("tampered")}}
+	if err := VerifyForwardingChain(&tampered, keys); err == nil {
+		t.Error("Expected a batch modified after the last relay to be detected")
+	}
+
+	dropped := *batch
+	dropped.ForwardingChain = batch.ForwardingChain[1:]
+	if err := VerifyForwardingChain(&dropped, keys); err == nil {
+		t.Error("Expected a missing forwarding record to be detected")
+	}
+
+	reordered := *batch
+	reordered.Hops = []string{"relay1", "relay0"}
+	if err := VerifyForwardingChain(&reordered, keys); err == nil {
+		t.Error("Expected records not matching the hops to be detected")
+	}
+
+	forged := *batch
+	record := *batch.ForwardingChain[0]
+	record.BatchHash = sha256Sum([]byte("another batch"))
+	forged.ForwardingChain = []*pb.ForwardingRecord{&record, batch.ForwardingChain[1]}
+	if err := VerifyForwardingChain(&forged, keys); err == nil {
+		t.Error("Expected a modified forwarding record to be detected")
+	}
+
+	if err := VerifyForwardingChain(batch, map[string]*ecdsa.PublicKey{"relay0": keys["relay0"]}); err == nil {
+		t.Error("Expected a relay of unknown key to be rejected")
+	}
+}
+
+func TestForwardWithoutSigning(t *testing.T) {
+	relay := NewForwardingProcessor("relay0", []string{"up:30303"})
+	var forwarded *pb.TransactionBlock
+	relay.send = func(address string, batch *pb.TransactionBlock) error {
+		forwarded = batch
+		return nil
+	}
+	if err := relay.Forward(newRelayedBatch()); err != nil {
+		t.Fatalf("Error forwarding: %s", err)
+	}
+	if len(forwarded.ForwardingChain) != 0 {
+		t.Fatalf("Expected no forwarding record without a signing key, got %d", len(forwarded.ForwardingChain))
+	}
+	if err := VerifyForwardingChain(forwarded, StaticPublicKeyRegistry{}); err == nil {
+		t.Error("Expected a relayed batch without forwarding records not to verify")
+	}
+}
+
+func TestBrokenForwardingChainError(t *testing.T) {
+	transactionsError := brokenForwardingChainError(newRelayedBatch())
+	if transactionsError.Reason != brokenForwardingChainReason || len(transactionsError.TxIDs) != 2 || transactionsError.TxIDs[1] != "tx1" {
+		t.Errorf("Expected all transactions to be listed as %s, got %v", brokenForwardingChainReason, transactionsError)
+	}
+}
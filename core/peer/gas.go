@@ -0,0 +1,76 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// insufficientGasReason is the reason of the CHAIN_TRANSACTIONS_ERROR answering a batch failing the gas check
+const insufficientGasReason = "insufficient gas"
+
+// GasPriceOracle provides the lowest gas price of the transactions this peer processes
+type GasPriceOracle interface {
+	MinGasPrice() uint64
+}
+
+// GasPriceOracleAccessor interface enables a Peer to hand out its GasPriceOracle
+type GasPriceOracleAccessor interface {
+	GetGasPriceOracle() GasPriceOracle
+}
+
+// StaticGasPriceOracle is a GasPriceOracle of a fixed price
+type StaticGasPriceOracle uint64
+
+// MinGasPrice returns the price of the oracle
+func (o StaticGasPriceOracle) MinGasPrice() uint64 {
+	return uint64(o)
+}
+
+// ViperGasPriceOracle is a GasPriceOracle of the price configured in peer.tx.minGasPrice
+type ViperGasPriceOracle struct{}
+
+// MinGasPrice returns peer.tx.minGasPrice
+func (ViperGasPriceOracle) MinGasPrice() uint64 {
+	return uint64(viper.GetInt("peer.tx.minGasPrice"))
+}
+
+// getBlockGasLimit returns the most gas of a batch, peer.tx.blockGasLimit, 0 for no limit
+func getBlockGasLimit() uint64 {
+	return uint64(viper.GetInt("peer.tx.blockGasLimit"))
+}
+
+// checkGas returns the TransactionsError answering a batch offering a gas price
+// under the price of the oracle, or a gas limit over blockGasLimit, nil if the
+// batch passes. A blockGasLimit of 0 sets no limit.
+func checkGas(batch *pb.TransactionBlock, oracle GasPriceOracle, blockGasLimit uint64) *pb.TransactionsError {
+	if batch.GasPrice >= oracle.MinGasPrice() && (blockGasLimit == 0 || batch.GasLimit <= blockGasLimit) {
+		return nil
+	}
+	gasError := &pb.TransactionsError{Reason: insufficientGasReason}
+	for _, tx := range batch.Transactions {
+		gasError.TxIDs = append(gasError.TxIDs, tx.Uuid)
+	}
+	return gasError
+}
+
+// GetGasPriceOracle returns the oracle of the lowest gas price of the CHAIN_TRANSACTIONS batches
+func (p *PeerImpl) GetGasPriceOracle() GasPriceOracle {
+	return p.gasOracle
+}
@@ -0,0 +1,42 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestCheckGas(t *testing.T) {
+	transactions := []*pb.Transaction{{Uuid: "tx1"}, {Uuid: "tx2"}}
+	oracle := StaticGasPriceOracle(10)
+
+	if gasError := checkGas(&pb.TransactionBlock{Transactions: transactions, GasPrice: 10, GasLimit: 1000}, oracle, 1000); gasError != nil {
+		t.Errorf("Expected the batch to pass, got %v", gasError)
+	}
+	if gasError := checkGas(&pb.TransactionBlock{Transactions: transactions, GasPrice: 10, GasLimit: 5000}, oracle, 0); gasError != nil {
+		t.Errorf("Expected no block gas limit to pass any gas limit, got %v", gasError)
+	}
+	gasError := checkGas(&pb.TransactionBlock{Transactions: transactions, GasPrice: 9, GasLimit: 1000}, oracle, 1000)
+	if gasError == nil || gasError.Reason != insufficientGasReason || len(gasError.TxIDs) != 2 || gasError.TxIDs[1] != "tx2" {
+		t.Errorf("Expected both transactions to fail for a low gas price, got %v", gasError)
+	}
+	if gasError := checkGas(&pb.TransactionBlock{Transactions: transactions, GasPrice: 10, GasLimit: 1001}, oracle, 1000); gasError == nil {
+		t.Error("Expected the batch to fail for a gas limit over the block gas limit")
+	}
+}
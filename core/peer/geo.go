@@ -0,0 +1,53 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"math"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// earthRadiusKm is the mean radius of the earth used by GeoDistance
+const earthRadiusKm = 6371.0
+
+// GeoDistance returns the great circle distance in kilometers between a and
+// b, computed with the haversine formula
+func GeoDistance(a, b pb.GeoCoordinates) float64 {
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	dLat := toRadians(b.Lat - a.Lat)
+	dLon := toRadians(b.Lon - a.Lon)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(a.Lat))*math.Cos(toRadians(b.Lat))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// getGeoCoordinates returns the location configured under peer.coordinates,
+// nil if none is
+func getGeoCoordinates() *pb.GeoCoordinates {
+	if !viper.IsSet("peer.coordinates.lat") || !viper.IsSet("peer.coordinates.lon") {
+		return nil
+	}
+	return &pb.GeoCoordinates{Lat: viper.GetFloat64("peer.coordinates.lat"), Lon: viper.GetFloat64("peer.coordinates.lon")}
+}
+
+// getRegion returns the region configured as peer.region, e.g. us-east-1, empty if none is
+func getRegion() string {
+	return viper.GetString("peer.region")
+}
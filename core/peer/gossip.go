@@ -0,0 +1,415 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+const (
+	// sameRegionShare is the share of the fanout PreferRegion reserves to peers of the preferred region
+	sameRegionShare = 0.7
+	// bloomFilterBits is the size in bits of each generation of the seen filter
+	bloomFilterBits = 1 << 20
+	// bloomFilterHashes is the number of hash functions applied per key
+	bloomFilterHashes = 4
+	// bloomFilterCapacity is the number of keys a generation holds before it is rotated
+	bloomFilterCapacity = 100000
+)
+
+// bloomFilter is a two generation bloom filter. Once the current generation
+// reaches capacity it becomes the previous generation and a fresh one is
+// started, which bounds the false positive rate without unbounded growth.
+type bloomFilter struct {
+	sync.Mutex
+	current  []uint64
+	previous []uint64
+	count    int
+}
+
+func newBloomFilter() *bloomFilter {
+	return &bloomFilter{current: make([]uint64, bloomFilterBits/64)}
+}
+
+func bloomPositions(key string) [bloomFilterHashes]uint32 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := uint32(sum), uint32(sum>>32)
+	var positions [bloomFilterHashes]uint32
+	for i := range positions {
+		positions[i] = (h1 + uint32(i)*h2) % bloomFilterBits
+	}
+	return positions
+}
+
+func bloomTest(bits []uint64, positions [bloomFilterHashes]uint32) bool {
+	if bits == nil {
+		return false
+	}
+	for _, pos := range positions {
+		if bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Add records the key in the filter
+func (bf *bloomFilter) Add(key string) {
+	bf.Lock()
+	defer bf.Unlock()
+	if bf.count >= bloomFilterCapacity {
+		bf.previous = bf.current
+		bf.current = make([]uint64, bloomFilterBits/64)
+		bf.count = 0
+	}
+	for _, pos := range bloomPositions(key) {
+		bf.current[pos/64] |= 1 << (pos % 64)
+	}
+	bf.count++
+}
+
+// Test returns true if the key may have been added, false if it definitely was not
+func (bf *bloomFilter) Test(key string) bool {
+	bf.Lock()
+	defer bf.Unlock()
+	positions := bloomPositions(key)
+	return bloomTest(bf.current, positions) || bloomTest(bf.previous, positions)
+}
+
+// gossipStack is the subset of the MessageHandlerCoordinator needed to gossip
+type gossipStack interface {
+	GetPeers() (*pb.PeersMessage, error)
+	Unicast(*pb.Message, *pb.PeerID) error
+	GetPeerRegistry() *PeerRegistry
+	GetSLATracker() *SLATracker
+	GetBlockchainSize() uint64
+}
+
+// GossipTransactionPropagator forwards transactions to a random subset of the
+// connected peers, remembering which peers have already seen each transaction.
+type GossipTransactionPropagator struct {
+	stack   gossipStack
+	fanout  int
+	ttl     uint32
+	seen    *bloomFilter
+	deliver func(*pb.Transaction)
+	random  *rand.Rand
+	randMux sync.Mutex
+
+	excludeMux sync.RWMutex
+	exclude    []string // Patterns of the IDs or addresses of the peers not gossiped to
+
+	dedup *DeduplicationStore // Remembers the seen transactions across restarts, may be nil
+
+	regionMux sync.RWMutex
+	region    string // Region whose peers most of the fanout goes to, empty for no preference
+
+	stabilityWeight float64 // Weight of the StabilityScore against the bandwidth in the fanout selection
+}
+
+// NewGossipTransactionPropagator returns a propagator which forwards to
+// fanout peers and stamps locally originated transactions with ttl hops.
+// deliver, if not nil, is invoked once for every new transaction received
+// through gossip.
+func NewGossipTransactionPropagator(stack gossipStack, fanout int, ttl uint32, deliver func(*pb.Transaction)) *GossipTransactionPropagator {
+	return &GossipTransactionPropagator{
+		stack:   stack,
+		fanout:  fanout,
+		ttl:     ttl,
+		seen:    newBloomFilter(),
+		deliver: deliver,
+		random:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		exclude: viper.GetStringSlice("peer.gossip.excludeList"),
+
+		stabilityWeight: viper.GetFloat64("peer.gossip.stabilityWeight"),
+	}
+}
+
+// newGossipTransactionPropagatorFromConfig builds a propagator from the peer.gossip settings,
+// returning nil if gossip is disabled
+func newGossipTransactionPropagatorFromConfig(stack gossipStack, deliver func(*pb.Transaction)) *GossipTransactionPropagator {
+	if !viper.GetBool("peer.gossip.enabled") {
+		return nil
+	}
+	g := NewGossipTransactionPropagator(stack, viper.GetInt("peer.gossip.txFanout"), uint32(viper.GetInt("peer.gossip.txTTL")), deliver)
+	g.PreferRegion(getRegion())
+	dedup, err := newDeduplicationStoreFromConfig()
+	if err != nil {
+		peerLogger.Warningf("Error loading seen transactions, duplicates from before the restart will not be detected: %s", err)
+	} else if dedup != nil {
+		g.SetDeduplicationStore(dedup)
+	}
+	return g
+}
+
+// SetDeduplicationStore makes the propagator record the transactions it sees
+// in the store, and adds those the store already holds to the seen filter
+func (g *GossipTransactionPropagator) SetDeduplicationStore(dedup *DeduplicationStore) {
+	for _, txID := range dedup.TxIDs() {
+		g.seen.Add(txID)
+	}
+	g.dedup = dedup
+}
+
+// PreferRegion biases the selection of the peers transactions are gossiped
+// to toward the region: 70% of the fanout goes to peers of the region and
+// 30% to peers of other regions, either taking up what the other cannot fill.
+// An empty region removes the bias.
+func (g *GossipTransactionPropagator) PreferRegion(region string) {
+	g.regionMux.Lock()
+	defer g.regionMux.Unlock()
+	g.region = region
+}
+
+// dialAddress returns the address the gossip peer at address is dialed at:
+// while Tor is enabled, the onion address it advertised unless it is of the
+// preferred region, which is dialed at address as are the peers without one
+func (g *GossipTransactionPropagator) dialAddress(address string) string {
+	if !torEnabled() {
+		return address
+	}
+	entry, ok := g.stack.GetPeerRegistry().ByAddress(address)
+	if !ok || entry.OnionAddress == "" {
+		return address
+	}
+	g.regionMux.RLock()
+	region := g.region
+	g.regionMux.RUnlock()
+	if region != "" && entry.Region == region {
+		return address
+	}
+	return entry.OnionAddress
+}
+
+// splitByRegion returns the fanout candidates, keeping their order, with
+// the share of the preferred region first
+func (g *GossipTransactionPropagator) splitByRegion(candidates []*pb.PeerEndpoint) []*pb.PeerEndpoint {
+	g.regionMux.RLock()
+	region := g.region
+	g.regionMux.RUnlock()
+	if region == "" || len(candidates) <= g.fanout {
+		return candidates
+	}
+	registry := g.stack.GetPeerRegistry()
+	var same, other []*pb.PeerEndpoint
+	for _, candidate := range candidates {
+		if entry, ok := registry.Get(candidate.ID); ok && entry.Region == region {
+			same = append(same, candidate)
+		} else {
+			other = append(other, candidate)
+		}
+	}
+	sameCount := int(math.Floor(sameRegionShare*float64(g.fanout) + 0.5))
+	if sameCount > len(same) {
+		sameCount = len(same)
+	} else if g.fanout-sameCount > len(other) {
+		sameCount = g.fanout - len(other)
+	}
+	return append(append([]*pb.PeerEndpoint(nil), same[:sameCount]...), other[:g.fanout-sameCount]...)
+}
+
+// markSeen adds the transaction to the seen filter and the deduplication store
+func (g *GossipTransactionPropagator) markSeen(txUUID string) {
+	g.seen.Add(txUUID)
+	if g.dedup == nil {
+		return
+	}
+	if err := g.dedup.Record(txUUID, time.Now()); err != nil {
+		peerLogger.Errorf("Error recording seen transaction %s: %s", txUUID, err)
+	}
+}
+
+// Exclude stops gossiping to the peers whose ID or address matches pattern,
+// which may contain the wildcards of path.Match. The exclusion list is kept
+// in peer.gossip.excludeList.
+func (g *GossipTransactionPropagator) Exclude(pattern string) {
+	g.excludeMux.Lock()
+	defer g.excludeMux.Unlock()
+	for _, rule := range g.exclude {
+		if rule == pattern {
+			return
+		}
+	}
+	g.exclude = append(g.exclude, pattern)
+	viper.Set("peer.gossip.excludeList", append([]string(nil), g.exclude...))
+}
+
+// Include removes pattern from the exclusion list
+func (g *GossipTransactionPropagator) Include(pattern string) {
+	g.excludeMux.Lock()
+	defer g.excludeMux.Unlock()
+	var exclude []string
+	for _, rule := range g.exclude {
+		if rule != pattern {
+			exclude = append(exclude, rule)
+		}
+	}
+	g.exclude = exclude
+	viper.Set("peer.gossip.excludeList", append([]string(nil), g.exclude...))
+}
+
+// excludedBy returns the exclusion rule the endpoint matches, if any
+func (g *GossipTransactionPropagator) excludedBy(endpoint *pb.PeerEndpoint) (string, bool) {
+	g.excludeMux.RLock()
+	defer g.excludeMux.RUnlock()
+	for _, rule := range g.exclude {
+		if matched, _ := path.Match(rule, endpoint.Address); matched {
+			return rule, true
+		}
+		if endpoint.ID != nil {
+			if matched, _ := path.Match(rule, endpoint.ID.Name); matched {
+				return rule, true
+			}
+		}
+	}
+	return "", false
+}
+
+func seenKey(txUUID string, peerID *pb.PeerID) string {
+	return txUUID + "/" + peerID.Name
+}
+
+// Propagate sends a locally originated transaction into the gossip network
+func (g *GossipTransactionPropagator) Propagate(tx *pb.Transaction) error {
+	g.markSeen(tx.Uuid)
+	return g.forward(&pb.GossipTransaction{Transaction: tx, Ttl: g.ttl}, nil)
+}
+
+// HandleGossip processes a gossiped transaction received from sender. New
+// transactions are delivered locally and forwarded as long as hops remain.
+func (g *GossipTransactionPropagator) HandleGossip(gossipTx *pb.GossipTransaction, sender *pb.PeerID) error {
+	tx := gossipTx.Transaction
+	if tx == nil {
+		return fmt.Errorf("Received gossip message without a transaction")
+	}
+	if sender != nil {
+		g.seen.Add(seenKey(tx.Uuid, sender))
+	}
+	if g.seen.Test(tx.Uuid) {
+		peerLogger.Debugf("Ignoring already seen gossiped transaction %s", tx.Uuid)
+		return nil
+	}
+	g.markSeen(tx.Uuid)
+	if g.deliver != nil {
+		g.deliver(tx)
+	}
+	if gossipTx.Ttl == 0 {
+		peerLogger.Debugf("Gossiped transaction %s reached its TTL, not forwarding", tx.Uuid)
+		return nil
+	}
+	return g.forward(&pb.GossipTransaction{Transaction: tx, Ttl: gossipTx.Ttl - 1}, sender)
+}
+
+// selectTargets returns up to fanout connected peers that have not seen the
+// transaction and are not excluded. Peers with a higher measured bandwidth are preferred, ties are
+// broken randomly, and overloaded peers are only selected if there are not
+// enough others. With a peer.gossip.stabilityWeight, stable peers are
+// preferred too. Peers whose chain is not behind the local one come first,
+// then peers of the preferred region get their share of the fanout.
+func (g *GossipTransactionPropagator) selectTargets(txUUID string, sender *pb.PeerID) ([]*pb.PeerID, error) {
+	peersMsg, err := g.stack.GetPeers()
+	if err != nil {
+		return nil, err
+	}
+	var candidates []*pb.PeerEndpoint
+	for _, endpoint := range peersMsg.Peers {
+		if sender != nil && *endpoint.ID == *sender {
+			continue
+		}
+		if g.seen.Test(seenKey(txUUID, endpoint.ID)) {
+			continue
+		}
+		if rule, excluded := g.excludedBy(endpoint); excluded {
+			peerLogger.Debugf("Not gossiping transaction %s to %s, excluded by %s", txUUID, endpoint.ID.Name, rule)
+			continue
+		}
+		candidates = append(candidates, endpoint)
+	}
+	g.randMux.Lock()
+	for i := range candidates {
+		j := i + g.random.Intn(len(candidates)-i)
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	}
+	g.randMux.Unlock()
+	if g.stabilityWeight > 0 {
+		candidates = byStability(g.stack.GetPeerRegistry(), g.stack.GetSLATracker(), g.stabilityWeight, candidates)
+	} else {
+		candidates = ByBandwidth{Registry: g.stack.GetPeerRegistry()}.Sort(pb.PeerID{}, candidates)
+	}
+	candidates = avoidOverloaded(g.stack.GetPeerRegistry(), candidates)
+	candidates = preferSynced(g.stack.GetPeerRegistry(), g.stack.GetBlockchainSize(), candidates)
+	candidates = g.splitByRegion(candidates)
+	if len(candidates) > g.fanout {
+		candidates = candidates[:g.fanout]
+	}
+	targets := make([]*pb.PeerID, len(candidates))
+	for i, candidate := range candidates {
+		targets[i] = candidate.ID
+	}
+	return targets, nil
+}
+
+// preferSynced returns the peers, keeping their order, those whose chain is at
+// least height blocks high as of their DISC_HELLO first
+func preferSynced(registry *PeerRegistry, height uint64, peers []*pb.PeerEndpoint) []*pb.PeerEndpoint {
+	synced := func(endpoint *pb.PeerEndpoint) bool {
+		entry, ok := registry.Get(endpoint.ID)
+		return ok && entry.BlockHeight >= height
+	}
+	sorted := sortPeerEndpoints(peers, func(a, b *pb.PeerEndpoint) bool {
+		return synced(a) && !synced(b)
+	})
+	if len(sorted) > 0 && !synced(sorted[0]) {
+		peerLogger.Debugf("No gossip candidate is at the local block height %d", height)
+	}
+	return sorted
+}
+
+func (g *GossipTransactionPropagator) forward(gossipTx *pb.GossipTransaction, sender *pb.PeerID) error {
+	tx := gossipTx.Transaction
+	targets, err := g.selectTargets(tx.Uuid, sender)
+	if err != nil {
+		return fmt.Errorf("Error selecting gossip targets for transaction %s: %s", tx.Uuid, err)
+	}
+	data, err := proto.Marshal(gossipTx)
+	if err != nil {
+		return fmt.Errorf("Error marshalling gossip transaction %s: %s", tx.Uuid, err)
+	}
+	msg := &pb.Message{Type: pb.Message_CHAIN_TRANSACTION_GOSSIP, Payload: data, Timestamp: util.CreateUtcTimestamp()}
+	for _, target := range targets {
+		g.seen.Add(seenKey(tx.Uuid, target))
+		if err := g.stack.Unicast(msg, target); err != nil {
+			peerLogger.Warningf("Error gossiping transaction %s to %s: %s", tx.Uuid, target.Name, err)
+		}
+	}
+	peerLogger.Debugf("Gossiped transaction %s with ttl %d to %d peers", tx.Uuid, gossipTx.Ttl, len(targets))
+	return nil
+}
@@ -0,0 +1,288 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+type mockGossipStack struct {
+	sync.Mutex
+	peers    []*pb.PeerEndpoint
+	registry *PeerRegistry
+	sla      *SLATracker
+	height   uint64
+	sent     map[string][]*pb.GossipTransaction
+}
+
+func newMockGossipStack(n int) *mockGossipStack {
+	stack := &mockGossipStack{registry: NewPeerRegistry(), sla: NewSLATracker(16), sent: make(map[string][]*pb.GossipTransaction)}
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("vp%d", i)
+		endpoint := &pb.PeerEndpoint{ID: &pb.PeerID{Name: name}, Address: name + ":30303"}
+		stack.peers = append(stack.peers, endpoint)
+		stack.registry.Add(endpoint)
+	}
+	return stack
+}
+
+func (m *mockGossipStack) GetPeerRegistry() *PeerRegistry {
+	return m.registry
+}
+
+func (m *mockGossipStack) GetSLATracker() *SLATracker {
+	return m.sla
+}
+
+func (m *mockGossipStack) GetBlockchainSize() uint64 {
+	return m.height
+}
+
+func (m *mockGossipStack) GetPeers() (*pb.PeersMessage, error) {
+	return &pb.PeersMessage{Peers: m.peers}, nil
+}
+
+func (m *mockGossipStack) Unicast(msg *pb.Message, receiver *pb.PeerID) error {
+	if msg.Type != pb.Message_CHAIN_TRANSACTION_GOSSIP {
+		return fmt.Errorf("Unexpected message type %s", msg.Type)
+	}
+	gossipTx := &pb.GossipTransaction{}
+	if err := proto.Unmarshal(msg.Payload, gossipTx); err != nil {
+		return err
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.sent[receiver.Name] = append(m.sent[receiver.Name], gossipTx)
+	return nil
+}
+
+func TestBloomFilter(t *testing.T) {
+	bf := newBloomFilter()
+	for i := 0; i < 1000; i++ {
+		bf.Add(fmt.Sprintf("tx%d", i))
+	}
+	for i := 0; i < 1000; i++ {
+		if !bf.Test(fmt.Sprintf("tx%d", i)) {
+			t.Fatalf("Expected tx%d to be reported as seen", i)
+		}
+	}
+	falsePositives := 0
+	for i := 1000; i < 2000; i++ {
+		if bf.Test(fmt.Sprintf("tx%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 10 {
+		t.Errorf("Too many false positives: %d", falsePositives)
+	}
+}
+
+func TestBloomFilterRotation(t *testing.T) {
+	bf := newBloomFilter()
+	bf.Add("first")
+	for i := 0; i < bloomFilterCapacity; i++ {
+		bf.Add(fmt.Sprintf("tx%d", i))
+	}
+	if !bf.Test("first") {
+		t.Error("Expected key to survive into the previous generation")
+	}
+	for i := 0; i < bloomFilterCapacity; i++ {
+		bf.Add(fmt.Sprintf("other%d", i))
+	}
+	if bf.previous == nil || bf.count > bloomFilterCapacity {
+		t.Error("Expected filter generations to rotate at capacity")
+	}
+}
+
+func TestGossipPropagateFanout(t *testing.T) {
+	stack := newMockGossipStack(10)
+	g := NewGossipTransactionPropagator(stack, 3, 4, nil)
+	if err := g.Propagate(&pb.Transaction{Uuid: "tx1"}); err != nil {
+		t.Fatalf("Error propagating transaction: %s", err)
+	}
+	if len(stack.sent) != 3 {
+		t.Fatalf("Expected transaction to be sent to 3 peers, sent to %d", len(stack.sent))
+	}
+	for name, msgs := range stack.sent {
+		if len(msgs) != 1 || msgs[0].Ttl != 4 || msgs[0].Transaction.Uuid != "tx1" {
+			t.Errorf("Unexpected gossip sent to %s: %v", name, msgs)
+		}
+	}
+}
+
+func TestGossipSkipsSenderAndSeenPeers(t *testing.T) {
+	stack := newMockGossipStack(3)
+	delivered := 0
+	g := NewGossipTransactionPropagator(stack, 10, 4, func(*pb.Transaction) { delivered++ })
+	g.seen.Add(seenKey("tx1", &pb.PeerID{Name: "vp1"}))
+
+	err := g.HandleGossip(&pb.GossipTransaction{Transaction: &pb.Transaction{Uuid: "tx1"}, Ttl: 2}, &pb.PeerID{Name: "vp0"})
+	if err != nil {
+		t.Fatalf("Error handling gossip: %s", err)
+	}
+	if delivered != 1 {
+		t.Errorf("Expected transaction to be delivered once, delivered %d times", delivered)
+	}
+	if len(stack.sent) != 1 || len(stack.sent["vp2"]) != 1 {
+		t.Fatalf("Expected transaction to be forwarded to vp2 only, sent: %v", stack.sent)
+	}
+	if stack.sent["vp2"][0].Ttl != 1 {
+		t.Errorf("Expected ttl to be decremented to 1, got %d", stack.sent["vp2"][0].Ttl)
+	}
+
+	// A duplicate must neither be delivered nor forwarded again
+	err = g.HandleGossip(&pb.GossipTransaction{Transaction: &pb.Transaction{Uuid: "tx1"}, Ttl: 2}, &pb.PeerID{Name: "vp2"})
+	if err != nil {
+		t.Fatalf("Error handling gossip: %s", err)
+	}
+	if delivered != 1 || len(stack.sent["vp2"]) != 1 {
+		t.Error("Expected duplicate transaction to be ignored")
+	}
+}
+
+func TestGossipStopsAtZeroTTL(t *testing.T) {
+	stack := newMockGossipStack(5)
+	g := NewGossipTransactionPropagator(stack, 3, 4, nil)
+	err := g.HandleGossip(&pb.GossipTransaction{Transaction: &pb.Transaction{Uuid: "tx1"}, Ttl: 0}, &pb.PeerID{Name: "vp0"})
+	if err != nil {
+		t.Fatalf("Error handling gossip: %s", err)
+	}
+	if len(stack.sent) != 0 {
+		t.Errorf("Expected no forwarding at ttl 0, sent: %v", stack.sent)
+	}
+}
+
+func TestGossipPrefersHighBandwidthPeers(t *testing.T) {
+	stack := newMockGossipStack(6)
+	stack.registry.UpdateBandwidth("vp4:30303", 2e6)
+	stack.registry.UpdateBandwidth("vp1:30303", 1e6)
+	g := NewGossipTransactionPropagator(stack, 2, 4, nil)
+	if err := g.Propagate(&pb.Transaction{Uuid: "tx1"}); err != nil {
+		t.Fatalf("Error propagating transaction: %s", err)
+	}
+	if len(stack.sent) != 2 || len(stack.sent["vp4"]) != 1 || len(stack.sent["vp1"]) != 1 {
+		t.Errorf("Expected transaction to be sent to the measured peers vp4 and vp1, sent: %v", stack.sent)
+	}
+}
+
+func TestGossipExclusionList(t *testing.T) {
+	defer viper.Set("peer.gossip.excludeList", []string{})
+	stack := newMockGossipStack(4)
+	g := NewGossipTransactionPropagator(stack, 4, 0, nil)
+	g.Exclude("vp1")
+	g.Exclude("vp[23]:*")
+	if excluded := viper.GetStringSlice("peer.gossip.excludeList"); len(excluded) != 2 {
+		t.Fatalf("Expected the exclusion list in the configuration, got %v", excluded)
+	}
+	if err := g.Propagate(&pb.Transaction{Uuid: "tx1"}); err != nil {
+		t.Fatalf("Error propagating transaction: %s", err)
+	}
+	if len(stack.sent) != 1 || len(stack.sent["vp0"]) != 1 {
+		t.Fatalf("Expected only vp0 to receive the transaction, got %v", stack.sent)
+	}
+
+	g.Include("vp1")
+	if err := g.Propagate(&pb.Transaction{Uuid: "tx2"}); err != nil {
+		t.Fatalf("Error propagating transaction: %s", err)
+	}
+	if len(stack.sent["vp1"]) != 1 || len(stack.sent["vp2"]) != 0 {
+		t.Fatalf("Expected vp1 to receive the transaction once included, got %v", stack.sent)
+	}
+}
+
+func TestGossipPrefersRegion(t *testing.T) {
+	stack := newMockGossipStack(10)
+	for i, endpoint := range stack.peers {
+		region := "eu-west-2"
+		if i < 5 {
+			region = "us-east-1"
+		}
+		stack.registry.SetRegion(endpoint.ID, region)
+	}
+	if byRegion := stack.registry.ByRegion(); len(byRegion["us-east-1"]) != 5 || len(byRegion["eu-west-2"]) != 5 {
+		t.Fatalf("Expected 5 peers in each region, got %v", byRegion)
+	}
+	g := NewGossipTransactionPropagator(stack, 3, 0, nil)
+	g.PreferRegion("us-east-1")
+	targets, err := g.selectTargets("tx1", nil)
+	if err != nil {
+		t.Fatalf("Error selecting targets: %s", err)
+	}
+	same := 0
+	for _, target := range targets {
+		if entry, _ := stack.registry.Get(target); entry.Region == "us-east-1" {
+			same++
+		}
+	}
+	if len(targets) != 3 || same != 2 {
+		t.Fatalf("Expected 2 of 3 targets in the preferred region, got %d of %d", same, len(targets))
+	}
+
+	// Peers of other regions make up for a region without enough peers
+	g.PreferRegion("ap-south-1")
+	if targets, err = g.selectTargets("tx2", nil); err != nil || len(targets) != 3 {
+		t.Fatalf("Expected 3 targets outside the preferred region, got %v, %v", targets, err)
+	}
+}
+
+func TestGossipPrefersStablePeers(t *testing.T) {
+	stack := newMockGossipStack(4)
+	for i, endpoint := range stack.peers {
+		stack.sla.record(endpoint.Address, SLASample{Timestamp: time.Now().Add(-time.Hour), Up: true})
+		// vp0 just restarted, vp3 has been up the longest
+		stack.registry.SetUptime(endpoint.ID, time.Duration(i)*time.Hour+time.Second)
+	}
+	stack.registry.UpdateBandwidth("vp0:30303", 1e6)
+	for _, weight := range []float64{0.8, 1} {
+		g := NewGossipTransactionPropagator(stack, 2, 0, nil)
+		g.stabilityWeight = weight
+		targets, err := g.selectTargets(fmt.Sprintf("tx%v", weight), nil)
+		if err != nil {
+			t.Fatalf("Error selecting targets: %s", err)
+		}
+		if len(targets) != 2 || targets[0].Name != "vp3" || targets[1].Name != "vp2" {
+			t.Fatalf("Expected the most stable peers vp3 and vp2 with weight %v, got %v", weight, targets)
+		}
+	}
+	g := NewGossipTransactionPropagator(stack, 1, 0, nil)
+	if targets, _ := g.selectTargets("tx", nil); len(targets) != 1 || targets[0].Name != "vp0" {
+		t.Fatalf("Expected the fastest peer vp0 without a stability weight, got %v", targets)
+	}
+}
+
+func TestGossipPrefersSyncedPeers(t *testing.T) {
+	stack := newMockGossipStack(6)
+	stack.height = 10
+	stack.registry.SetBlockHeight(&pb.PeerID{Name: "vp2"}, 10)
+	stack.registry.SetBlockHeight(&pb.PeerID{Name: "vp5"}, 12)
+	stack.registry.SetBlockHeight(&pb.PeerID{Name: "vp0"}, 9)
+	g := NewGossipTransactionPropagator(stack, 2, 4, nil)
+	if err := g.Propagate(&pb.Transaction{Uuid: "tx1"}); err != nil {
+		t.Fatalf("Error propagating transaction: %s", err)
+	}
+	if len(stack.sent) != 2 || len(stack.sent["vp2"]) != 1 || len(stack.sent["vp5"]) != 1 {
+		t.Errorf("Expected transaction to be sent to the synced peers vp2 and vp5, sent: %v", stack.sent)
+	}
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package peer
 
 import (
+	"bytes"
+	"crypto/ecdsa"
 	"fmt"
 	"sync"
 	"time"
@@ -25,6 +27,8 @@ import (
 	"github.com/looplab/fsm"
 	"github.com/spf13/viper"
 
+	"github.com/hyperledger/fabric/core/crypto/primitives"
+	"github.com/hyperledger/fabric/core/ledger"
 	"github.com/hyperledger/fabric/core/ledger/statemgmt"
 	pb "github.com/hyperledger/fabric/protos"
 )
@@ -43,6 +47,102 @@ type Handler struct {
 	snapshotRequestHandler        *syncStateSnapshotRequestHandler
 	syncStateDeltasRequestHandler *syncStateDeltasHandler
 	syncBlocksRequestHandler      *syncBlocksRequestHandler
+	discoveryMutex                sync.Mutex
+	nextDiscovery                 time.Time                      // Do not send DISC_GET_PEERS before this time
+	peersViewID                   uint64                         // The registry view of the last DISC_PEERS_DIFF received
+	remotePeers                   map[pb.PeerID]*pb.PeerEndpoint // The peers listed by the DISC_PEERS_DIFF received
+	helloSentAt                   time.Time                      // When the initial DISC_HELLO of an initiated stream was sent
+	capabilities                  []string                       // The capabilities negotiated in the DISC_HELLO exchange
+	features                      []string                       // The features of the protocol versions exchanged in the DISC_HELLO
+	blockSubscriptions            *blockSubscriptions
+	maxMessageSize                int                 // The message size limit negotiated in the DISC_HELLO exchange
+	syncPause                     *syncPauseGate      // Holds the syncs served while the remote peer paused them
+	syncSession                   *SyncSession        // Pauses the syncs served by the remote peer
+	helloChallenge                []byte              // The authChallenge of the DISC_HELLO sent, nil without shared secret authentication
+	remoteChallenge               []byte              // The authChallenge of the DISC_HELLO received, answered once the remote peer answered ours
+	helloAuthenticated            bool                // Whether the remote peer answered helloChallenge
+	helloAuthorized               bool                // Whether the auth token of the DISC_HELLO received was validated, or its session resumed
+	pendingHello                  *pb.HelloMessage    // The DISC_HELLO received, registered once the remote peer answered helloChallenge
+	requestOnly                   bool                // Whether the remote peer opened the Chat for requests alone, authenticated but not registered
+	fragments                     fragmentReassembler // Gathers the CHAIN_MESSAGE_FRAGMENT received
+	priority                      uint32              // The connection priority of the remote peer, unknownPriority until registered
+}
+
+// peerHandlerEvents returns the transitions of the FSM of a Handler, its
+// events named after the message types it handles
+func peerHandlerEvents() fsm.Events {
+	return fsm.Events{
+		{Name: pb.Message_DISC_HELLO.String(), Src: []string{"created"}, Dst: "established"},
+		{Name: pb.Message_DISC_VERSION_MISMATCH.String(), Src: []string{"created"}, Dst: "created"},
+		{Name: pb.Message_DISC_GET_TOPOLOGY.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_DISC_REGISTRY_FULL.String(), Src: []string{"created"}, Dst: "created"},
+		{Name: pb.Message_DISC_UNAUTHORIZED.String(), Src: []string{"created"}, Dst: "created"},
+		{Name: pb.Message_DISC_UNAUTHORIZED.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_DISC_HELLO_AUTH.String(), Src: []string{"created"}, Dst: "created"},
+		{Name: pb.Message_DISC_HELLO_AUTH.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_DISC_GET_PEERS.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_DISC_GET_PEERS_DIFF.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_DISC_PEERS_DIFF.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_DISC_PEERS.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_DISC_GET_PEERS_RETRY_AFTER.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_DISC_QUORUM_GET_PEERS.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_DISC_GET_PEERS_DIVERSE.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_DISC_PEER_METADATA.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_DISC_DISCONNECT.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_SYNC_BLOCK_ADDED.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_NEW_BLOCK_SEALED.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_SYNC_GET_BLOCKS.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_SYNC_CHECKPOINT.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_SYNC_CHECKPOINT_MISMATCH.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_SYNC_GET_BLOCK_HASHES.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_SYNC_VERIFY_REQUEST.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_SYNC_GET_BLOCKS_BY_NUMBER.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_SYNC_BLOCKS.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_BLOCK_BATCH.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_MESSAGE_FRAGMENT.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_SYNC_STATE_GET_SNAPSHOT.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_SYNC_STATE_SNAPSHOT.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_SYNC_STATE_GET_DELTAS.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_SYNC_STATE_DELTAS.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_SYNC_PAUSE.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_SYNC_PAUSED.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_SYNC_RESUME.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_TRANSACTION_GOSSIP.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_TRANSACTIONS_QUERY_STATUS.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_DISC_BANDWIDTH_TEST.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_TRANSACTIONS_GET_RECEIPT.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_VALIDATE_BLOCK.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_QUERY_TX.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_GET_BLOCK_BY_HASH.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_QUERY_RECENT_TX.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_QUERY_TX_HISTORY.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_QUERY_STATE_DIFF.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_QUERY_CONTRACT_STATE.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_QUERY_EPOCH.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_QUERY_DOUBLE_SPEND.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_VALIDATE_POW.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_ESTIMATE_TX_COST.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_GET_CANONICAL_TIP.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_QUERY_FORK_CHOICE.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_QUERY_MEMPOOL.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_ROLLBACK_REQUEST.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_REPORT_UNCLE.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_QUERY_STAKING_INFO.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_QUERY_ACCOUNT.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_SYNC_REQUEST.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_GET_BLOCK_HEADER.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_GET_BLOCK_BODY.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_GET_BLOCK_PROOF.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_QUERY_RANGE.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_GET_STATE_ROOT.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_SUBSCRIBE_BLOCKS.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_UNSUBSCRIBE_BLOCKS.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_TRANSACTIONS.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_DISC_PING.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_DISC_PONG.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_TRANSACTIONS_PROOF_REQUEST.String(), Src: []string{"established"}, Dst: "established"},
+		{Name: pb.Message_CHAIN_TRANSACTIONS_ENCRYPTED.String(), Src: []string{"established"}, Dst: "established"},
+	}
 }
 
 // NewPeerHandler returns a new Peer handler
@@ -53,48 +153,109 @@ func NewPeerHandler(coord MessageHandlerCoordinator, stream ChatStream, initiate
 		ChatStream:      stream,
 		initiatedStream: initiatedStream,
 		Coordinator:     coord,
+		maxMessageSize:  getMaxMessageSize(),
+		priority:        unknownPriority,
 	}
 	d.doneChan = make(chan struct{})
 
 	d.snapshotRequestHandler = newSyncStateSnapshotRequestHandler()
 	d.syncStateDeltasRequestHandler = newSyncStateDeltasHandler()
 	d.syncBlocksRequestHandler = newSyncBlocksRequestHandler()
+	d.blockSubscriptions = newBlockSubscriptions()
+	d.syncPause = newSyncPauseGateFromConfig()
+	d.syncSession = newSyncSession(d.SendMessage)
 	d.FSM = fsm.NewFSM(
 		"created",
-		fsm.Events{
-			{Name: pb.Message_DISC_HELLO.String(), Src: []string{"created"}, Dst: "established"},
-			{Name: pb.Message_DISC_GET_PEERS.String(), Src: []string{"established"}, Dst: "established"},
-			{Name: pb.Message_DISC_PEERS.String(), Src: []string{"established"}, Dst: "established"},
-			{Name: pb.Message_SYNC_BLOCK_ADDED.String(), Src: []string{"established"}, Dst: "established"},
-			{Name: pb.Message_SYNC_GET_BLOCKS.String(), Src: []string{"established"}, Dst: "established"},
-			{Name: pb.Message_SYNC_BLOCKS.String(), Src: []string{"established"}, Dst: "established"},
-			{Name: pb.Message_SYNC_STATE_GET_SNAPSHOT.String(), Src: []string{"established"}, Dst: "established"},
-			{Name: pb.Message_SYNC_STATE_SNAPSHOT.String(), Src: []string{"established"}, Dst: "established"},
-			{Name: pb.Message_SYNC_STATE_GET_DELTAS.String(), Src: []string{"established"}, Dst: "established"},
-			{Name: pb.Message_SYNC_STATE_DELTAS.String(), Src: []string{"established"}, Dst: "established"},
-		},
+		peerHandlerEvents(),
 		fsm.Callbacks{
-			"enter_state":                                           func(e *fsm.Event) { d.enterState(e) },
-			"before_" + pb.Message_DISC_HELLO.String():              func(e *fsm.Event) { d.beforeHello(e) },
-			"before_" + pb.Message_DISC_GET_PEERS.String():          func(e *fsm.Event) { d.beforeGetPeers(e) },
-			"before_" + pb.Message_DISC_PEERS.String():              func(e *fsm.Event) { d.beforePeers(e) },
-			"before_" + pb.Message_SYNC_BLOCK_ADDED.String():        func(e *fsm.Event) { d.beforeBlockAdded(e) },
-			"before_" + pb.Message_SYNC_GET_BLOCKS.String():         func(e *fsm.Event) { d.beforeSyncGetBlocks(e) },
-			"before_" + pb.Message_SYNC_BLOCKS.String():             func(e *fsm.Event) { d.beforeSyncBlocks(e) },
-			"before_" + pb.Message_SYNC_STATE_GET_SNAPSHOT.String(): func(e *fsm.Event) { d.beforeSyncStateGetSnapshot(e) },
-			"before_" + pb.Message_SYNC_STATE_SNAPSHOT.String():     func(e *fsm.Event) { d.beforeSyncStateSnapshot(e) },
-			"before_" + pb.Message_SYNC_STATE_GET_DELTAS.String():   func(e *fsm.Event) { d.beforeSyncStateGetDeltas(e) },
-			"before_" + pb.Message_SYNC_STATE_DELTAS.String():       func(e *fsm.Event) { d.beforeSyncStateDeltas(e) },
+			"enter_state": func(e *fsm.Event) { d.enterState(e) },
+			"before_" + pb.Message_DISC_HELLO.String():                       func(e *fsm.Event) { d.beforeHello(e) },
+			"before_" + pb.Message_DISC_VERSION_MISMATCH.String():            func(e *fsm.Event) { d.beforeVersionMismatch(e) },
+			"before_" + pb.Message_DISC_REGISTRY_FULL.String():               func(e *fsm.Event) { d.beforeRegistryFull(e) },
+			"before_" + pb.Message_DISC_UNAUTHORIZED.String():                func(e *fsm.Event) { d.beforeUnauthorized(e) },
+			"before_" + pb.Message_DISC_HELLO_AUTH.String():                  func(e *fsm.Event) { d.beforeHelloAuth(e) },
+			"before_" + pb.Message_DISC_GET_PEERS.String():                   func(e *fsm.Event) { d.beforeGetPeers(e) },
+			"before_" + pb.Message_DISC_PEERS.String():                       func(e *fsm.Event) { d.beforePeers(e) },
+			"before_" + pb.Message_DISC_GET_PEERS_DIFF.String():              func(e *fsm.Event) { d.beforeGetPeersDiff(e) },
+			"before_" + pb.Message_DISC_PEERS_DIFF.String():                  func(e *fsm.Event) { d.beforePeersDiff(e) },
+			"before_" + pb.Message_DISC_GET_PEERS_RETRY_AFTER.String():       func(e *fsm.Event) { d.beforeGetPeersRetryAfter(e) },
+			"before_" + pb.Message_DISC_QUORUM_GET_PEERS.String():            func(e *fsm.Event) { d.beforeQuorumGetPeers(e) },
+			"before_" + pb.Message_DISC_GET_PEERS_DIVERSE.String():           func(e *fsm.Event) { d.beforeGetPeersDiverse(e) },
+			"before_" + pb.Message_DISC_GET_TOPOLOGY.String():                func(e *fsm.Event) { d.beforeGetTopology(e) },
+			"before_" + pb.Message_DISC_PEER_METADATA.String():               func(e *fsm.Event) { d.beforePeerMetadata(e) },
+			"before_" + pb.Message_DISC_DISCONNECT.String():                  func(e *fsm.Event) { d.beforeDisconnect(e) },
+			"before_" + pb.Message_SYNC_BLOCK_ADDED.String():                 func(e *fsm.Event) { d.beforeBlockAdded(e) },
+			"before_" + pb.Message_CHAIN_NEW_BLOCK_SEALED.String():           func(e *fsm.Event) { d.beforeNewBlockSealed(e) },
+			"before_" + pb.Message_SYNC_GET_BLOCKS.String():                  func(e *fsm.Event) { d.beforeSyncGetBlocks(e) },
+			"before_" + pb.Message_SYNC_BLOCKS.String():                      func(e *fsm.Event) { d.beforeSyncBlocks(e) },
+			"before_" + pb.Message_CHAIN_BLOCK_BATCH.String():                func(e *fsm.Event) { d.beforeBlockBatch(e) },
+			"before_" + pb.Message_CHAIN_MESSAGE_FRAGMENT.String():           func(e *fsm.Event) { d.beforeMessageFragment(e) },
+			"before_" + pb.Message_SYNC_CHECKPOINT.String():                  func(e *fsm.Event) { d.beforeSyncCheckpoint(e) },
+			"before_" + pb.Message_SYNC_CHECKPOINT_MISMATCH.String():         func(e *fsm.Event) { d.beforeSyncCheckpointMismatch(e) },
+			"before_" + pb.Message_SYNC_GET_BLOCK_HASHES.String():            func(e *fsm.Event) { d.beforeGetBlockHashes(e) },
+			"before_" + pb.Message_CHAIN_SYNC_VERIFY_REQUEST.String():        func(e *fsm.Event) { d.beforeSyncVerifyRequest(e) },
+			"before_" + pb.Message_SYNC_GET_BLOCKS_BY_NUMBER.String():        func(e *fsm.Event) { d.beforeGetBlocksByNumber(e) },
+			"before_" + pb.Message_SYNC_STATE_GET_SNAPSHOT.String():          func(e *fsm.Event) { d.beforeSyncStateGetSnapshot(e) },
+			"before_" + pb.Message_SYNC_STATE_SNAPSHOT.String():              func(e *fsm.Event) { d.beforeSyncStateSnapshot(e) },
+			"before_" + pb.Message_SYNC_STATE_GET_DELTAS.String():            func(e *fsm.Event) { d.beforeSyncStateGetDeltas(e) },
+			"before_" + pb.Message_SYNC_STATE_DELTAS.String():                func(e *fsm.Event) { d.beforeSyncStateDeltas(e) },
+			"before_" + pb.Message_CHAIN_SYNC_PAUSE.String():                 func(e *fsm.Event) { d.beforeSyncPause(e) },
+			"before_" + pb.Message_CHAIN_SYNC_PAUSED.String():                func(e *fsm.Event) { d.beforeSyncPaused(e) },
+			"before_" + pb.Message_CHAIN_SYNC_RESUME.String():                func(e *fsm.Event) { d.beforeSyncResume(e) },
+			"before_" + pb.Message_CHAIN_TRANSACTION_GOSSIP.String():         func(e *fsm.Event) { d.beforeTransactionGossip(e) },
+			"before_" + pb.Message_CHAIN_TRANSACTIONS_QUERY_STATUS.String():  func(e *fsm.Event) { d.beforeTransactionsQueryStatus(e) },
+			"before_" + pb.Message_DISC_BANDWIDTH_TEST.String():              func(e *fsm.Event) { d.beforeBandwidthTest(e) },
+			"before_" + pb.Message_CHAIN_TRANSACTIONS_GET_RECEIPT.String():   func(e *fsm.Event) { d.beforeGetReceipt(e) },
+			"before_" + pb.Message_CHAIN_VALIDATE_BLOCK.String():             func(e *fsm.Event) { d.beforeValidateBlock(e) },
+			"before_" + pb.Message_CHAIN_QUERY_TX.String():                   func(e *fsm.Event) { d.beforeQueryTransaction(e) },
+			"before_" + pb.Message_CHAIN_GET_BLOCK_BY_HASH.String():          func(e *fsm.Event) { d.beforeGetBlockByHash(e) },
+			"before_" + pb.Message_CHAIN_QUERY_RECENT_TX.String():            func(e *fsm.Event) { d.beforeQueryRecentTransactions(e) },
+			"before_" + pb.Message_CHAIN_QUERY_TX_HISTORY.String():           func(e *fsm.Event) { d.beforeQueryTransactionHistory(e) },
+			"before_" + pb.Message_CHAIN_QUERY_STATE_DIFF.String():           func(e *fsm.Event) { d.beforeQueryStateDiff(e) },
+			"before_" + pb.Message_CHAIN_QUERY_CONTRACT_STATE.String():       func(e *fsm.Event) { d.beforeQueryContractState(e) },
+			"before_" + pb.Message_CHAIN_QUERY_EPOCH.String():                func(e *fsm.Event) { d.beforeQueryEpoch(e) },
+			"before_" + pb.Message_CHAIN_QUERY_DOUBLE_SPEND.String():         func(e *fsm.Event) { d.beforeQueryDoubleSpend(e) },
+			"before_" + pb.Message_CHAIN_VALIDATE_POW.String():               func(e *fsm.Event) { d.beforeValidatePoW(e) },
+			"before_" + pb.Message_CHAIN_ESTIMATE_TX_COST.String():           func(e *fsm.Event) { d.beforeEstimateTxCost(e) },
+			"before_" + pb.Message_CHAIN_GET_CANONICAL_TIP.String():          func(e *fsm.Event) { d.beforeGetCanonicalTip(e) },
+			"before_" + pb.Message_CHAIN_QUERY_FORK_CHOICE.String():          func(e *fsm.Event) { d.beforeQueryForkChoice(e) },
+			"before_" + pb.Message_CHAIN_QUERY_MEMPOOL.String():              func(e *fsm.Event) { d.beforeQueryMempool(e) },
+			"before_" + pb.Message_CHAIN_ROLLBACK_REQUEST.String():           func(e *fsm.Event) { d.beforeRollbackRequest(e) },
+			"before_" + pb.Message_CHAIN_REPORT_UNCLE.String():               func(e *fsm.Event) { d.beforeReportUncle(e) },
+			"before_" + pb.Message_CHAIN_QUERY_STAKING_INFO.String():         func(e *fsm.Event) { d.beforeQueryStakingInfo(e) },
+			"before_" + pb.Message_CHAIN_QUERY_ACCOUNT.String():              func(e *fsm.Event) { d.beforeQueryAccount(e) },
+			"before_" + pb.Message_CHAIN_SYNC_REQUEST.String():               func(e *fsm.Event) { d.beforeChainSyncRequest(e) },
+			"before_" + pb.Message_CHAIN_GET_BLOCK_HEADER.String():           func(e *fsm.Event) { d.beforeGetBlockHeader(e) },
+			"before_" + pb.Message_CHAIN_GET_BLOCK_BODY.String():             func(e *fsm.Event) { d.beforeGetBlockBody(e) },
+			"before_" + pb.Message_CHAIN_GET_BLOCK_PROOF.String():            func(e *fsm.Event) { d.beforeGetBlockProof(e) },
+			"before_" + pb.Message_CHAIN_QUERY_RANGE.String():                func(e *fsm.Event) { d.beforeQueryRange(e) },
+			"before_" + pb.Message_CHAIN_GET_STATE_ROOT.String():             func(e *fsm.Event) { d.beforeGetStateRoot(e) },
+			"before_" + pb.Message_CHAIN_SUBSCRIBE_BLOCKS.String():           func(e *fsm.Event) { d.beforeSubscribeBlocks(e) },
+			"before_" + pb.Message_CHAIN_UNSUBSCRIBE_BLOCKS.String():         func(e *fsm.Event) { d.beforeUnsubscribeBlocks(e) },
+			"before_" + pb.Message_CHAIN_TRANSACTIONS.String():               func(e *fsm.Event) { d.beforeTransactions(e) },
+			"before_" + pb.Message_DISC_PING.String():                        func(e *fsm.Event) { d.beforePing(e) },
+			"before_" + pb.Message_DISC_PONG.String():                        func(e *fsm.Event) { d.beforePong(e) },
+			"before_" + pb.Message_CHAIN_TRANSACTIONS_PROOF_REQUEST.String(): func(e *fsm.Event) { d.beforeTransactionProofRequest(e) },
+			"before_" + pb.Message_CHAIN_TRANSACTIONS_ENCRYPTED.String():     func(e *fsm.Event) { d.beforeEncryptedTransaction(e) },
 		},
 	)
 
+	if len(helloAuthSecrets()) > 0 {
+		challenge, err := newHelloChallenge()
+		if err != nil {
+			return nil, err
+		}
+		d.helloChallenge = challenge
+	}
+
 	// If the stream was initiated from this Peer, send an Initial HELLO message
 	if d.initiatedStream {
 		// Send intiial Hello
-		helloMessage, err := d.Coordinator.NewOpenchainDiscoveryHello()
+		helloMessage, err := d.Coordinator.NewOpenchainDiscoveryHelloWithChallenge(d.helloChallenge)
 		if err != nil {
 			return nil, fmt.Errorf("Error getting new HelloMessage: %s", err)
 		}
+		d.helloSentAt = time.Now()
 		if err := d.SendMessage(helloMessage); err != nil {
 			return nil, fmt.Errorf("Error creating new Peer Handler, error returned sending %s: %s", pb.Message_DISC_HELLO, err)
 		}
@@ -109,6 +270,7 @@ func (d *Handler) enterState(e *fsm.Event) {
 
 func (d *Handler) deregister() error {
 	var err error
+	d.syncPause.stop()
 	if d.registered {
 		err = d.Coordinator.DeregisterHandler(d)
 		//doneChan is created and waiting for registered handlers only
@@ -126,8 +288,52 @@ func (d *Handler) To() (pb.PeerEndpoint, error) {
 	return *(d.ToPeerEndpoint), nil
 }
 
+// RemotePriority returns the connection priority the remote peer advertised
+// in its DISC_HELLO, unknownPriority until it is registered
+func (d *Handler) RemotePriority() uint32 {
+	return d.priority
+}
+
+// HasFeature returns true if the protocol versions exchanged in the DISC_HELLO
+// both support feature
+func (d *Handler) HasFeature(feature string) bool {
+	for _, f := range d.features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// queryFragmentSize returns the most bytes sent in a fragment of a query
+// response, 0 sending a single response to peers that do not use fragments
+func (d *Handler) queryFragmentSize() int {
+	if !d.HasFeature(fragmentFeature) {
+		return 0
+	}
+	return queryFragmentSize()
+}
+
+// HasCapability returns true if capability was negotiated with the remote
+// peer in the DISC_HELLO exchange
+func (d *Handler) HasCapability(capability string) bool {
+	for _, c := range d.capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveMaxMessageSize returns the largest message both peers of the chat
+// accept, as negotiated in the DISC_HELLO exchange, 0 for no limit
+func (d *Handler) EffectiveMaxMessageSize() int {
+	return d.maxMessageSize
+}
+
 // Stop stops this handler, which will trigger the Deregister from the MessageHandlerCoordinator.
 func (d *Handler) Stop() error {
+	d.blockSubscriptions.unsubscribeAll()
 	// Deregister the handler
 	err := d.deregister()
 	if err != nil {
@@ -153,7 +359,39 @@ func (d *Handler) beforeHello(e *fsm.Event) {
 	}
 	// Store the PeerEndpoint
 	d.ToPeerEndpoint = helloMessage.PeerEndpoint
+	// Peers behind a NAT are registered at the external address they learned over STUN
+	if helloMessage.ExternalAddress != "" && helloMessage.PeerEndpoint != nil {
+		endpoint := *helloMessage.PeerEndpoint
+		endpoint.Address = helloMessage.ExternalAddress
+		d.ToPeerEndpoint = &endpoint
+	}
 	peerLogger.Debugf("Received %s from endpoint=%s", e.Event, helloMessage)
+	d.requestOnly = helloMessage.RequestOnly && !d.initiatedStream
+	resumed := d.resumeSession(helloMessage)
+	if d.initiatedStream && helloMessage.SessionToken != "" {
+		// Presented when dialing the peer again
+		d.Coordinator.GetSessionTokenStore().Hold(d.ToPeerEndpoint.Address, helloMessage.SessionToken)
+	}
+
+	if validator := d.Coordinator.GetTokenValidator(); validator != nil && !resumed {
+		if err := authorizeHello(validator, helloMessage); err != nil {
+			e.Cancel(d.refuseHello(err))
+			return
+		}
+	}
+	d.helloAuthorized = true
+	if resumed {
+		// Authenticated by the session token, neither peer answers a challenge
+		d.helloChallenge = nil
+		d.helloAuthenticated = true
+	}
+	if d.helloChallenge != nil {
+		if len(helloMessage.AuthChallenge) != helloChallengeSize {
+			e.Cancel(d.refuseHello(fmt.Errorf("Missing hello challenge, peers authenticate with a shared secret")))
+			return
+		}
+		d.remoteChallenge = helloMessage.AuthChallenge
+	}
 
 	// If security enabled, need to verify the signature on the hello message
 	if SecurityEnabled() {
@@ -164,11 +402,53 @@ func (d *Handler) beforeHello(e *fsm.Event) {
 		peerLogger.Debugf("Verified signature for %s", e.Event)
 	}
 
+	if keys := banKeys(helloMessage.PeerEndpoint); d.Coordinator.GetBanList().Banned(keys...) {
+		d.revokeSession()
+		e.Cancel(disconnectBanned(d.SendMessage, keys))
+		return
+	}
+
+	negotiated, missing := negotiateCapabilities(getSupportedCapabilities(), getRequiredCapabilities(),
+		helloMessage.SupportedCapabilities, helloMessage.RequiredCapabilities)
+	if len(missing) > 0 {
+		if data, err := proto.Marshal(&pb.CapabilityMismatch{MissingCapabilities: missing}); err == nil {
+			if err := d.SendMessage(&pb.Message{Type: pb.Message_DISC_VERSION_MISMATCH, Payload: data}); err != nil {
+				peerLogger.Errorf("Error sending %s: %s", pb.Message_DISC_VERSION_MISMATCH, err)
+			}
+		}
+		e.Cancel(&CapabilityMismatchError{Missing: missing})
+		return
+	}
+	d.capabilities = negotiated
+	remoteVersion := remoteProtocolVersion(helloMessage)
+	d.features = defaultCompatibilityMatrix.Lookup(ProtocolVersion, remoteVersion)
+	if d.features == nil {
+		peerLogger.Warningf("Unknown protocol version %s of %s, using no optional features", remoteVersion, helloMessage.PeerEndpoint.Address)
+	}
+	d.maxMessageSize = negotiateMaxMessageSize(getMaxMessageSize(), int(helloMessage.MaxMessageBytes))
+
+	if d.initiatedStream == false && !d.requestOnly && registryFull(d.Coordinator.GetPeerRegistry(), helloMessage.PeerEndpoint.ID) &&
+		!(priorityEvictionEnabled() && evictForPriority(d.Coordinator.GetPeerRegistry(), helloMessage.Priority, d.Coordinator.Unicast)) {
+		retryAfter := registryFullRetryAfter()
+		if data, err := proto.Marshal(&pb.RegistryFull{RetryAfterSeconds: retryAfter}); err == nil {
+			if err := d.SendMessage(&pb.Message{Type: pb.Message_DISC_REGISTRY_FULL, Payload: data}); err != nil {
+				peerLogger.Errorf("Error sending %s: %s", pb.Message_DISC_REGISTRY_FULL, err)
+			}
+		}
+		e.Cancel(&RegistryFullError{RetryAfter: time.Duration(retryAfter) * time.Second})
+		return
+	}
+
 	if d.initiatedStream == false {
 		// Did NOT intitiate the stream, need to send back HELLO
 		peerLogger.Debugf("Received %s, sending back %s", e.Event, pb.Message_DISC_HELLO.String())
-		// Send back out PeerID information in a Hello
-		helloMessage, err := d.Coordinator.NewOpenchainDiscoveryHello()
+		// Send back out PeerID information in a Hello, with a session token
+		// unless the initiator is yet to answer the challenge
+		var sessionToken string
+		if d.helloChallenge == nil {
+			sessionToken = d.issueSessionToken()
+		}
+		helloMessage, err := d.Coordinator.NewOpenchainDiscoveryHelloWithSession(d.helloChallenge, sessionToken)
 		if err != nil {
 			e.Cancel(fmt.Errorf("Error getting new HelloMessage: %s", err))
 			return
@@ -178,222 +458,1926 @@ func (d *Handler) beforeHello(e *fsm.Event) {
 			return
 		}
 	}
-	// Register
-	err = d.Coordinator.RegisterHandler(d)
-	if err != nil {
-		e.Cancel(fmt.Errorf("Error registering Handler: %s", err))
-	} else {
-		// Registered successfully
-		d.registered = true
-		otherPeer := d.ToPeerEndpoint.Address
-		if !d.Coordinator.GetDiscHelper().FindNode(otherPeer) {
-			if ok := d.Coordinator.GetDiscHelper().AddNode(otherPeer); !ok {
-				peerLogger.Warningf("Unable to add peer %v to discovery list", otherPeer)
-			}
-			err = d.Coordinator.StoreDiscoveryList()
-			if err != nil {
-				peerLogger.Error(err)
+	if d.helloChallenge != nil && !d.helloAuthenticated {
+		// The initiator answers first, the other peer only answering a peer
+		// that proved it holds the secret, not to answer challenges relayed
+		// from a third peer
+		if d.initiatedStream {
+			if err := d.answerRemoteChallenge(); err != nil {
+				e.Cancel(err)
+				return
 			}
 		}
-		go d.start()
-	}
-}
-
-func (d *Handler) beforeGetPeers(e *fsm.Event) {
-	peersMessage, err := d.Coordinator.GetPeers()
-	if err != nil {
-		e.Cancel(fmt.Errorf("Error Getting Peers: %s", err))
-		return
-	}
-	data, err := proto.Marshal(peersMessage)
-	if err != nil {
-		e.Cancel(fmt.Errorf("Error Marshalling PeersMessage: %s", err))
+		peerLogger.Debugf("Received %s, registering %s once it answers the hello challenge", e.Event, d.ToPeerEndpoint.Address)
+		d.pendingHello = helloMessage
 		return
 	}
-	peerLogger.Debugf("Sending back %s", pb.Message_DISC_PEERS.String())
-	if err := d.SendMessage(&pb.Message{Type: pb.Message_DISC_PEERS, Payload: data}); err != nil {
+	if err := d.registerHello(helloMessage); err != nil {
 		e.Cancel(err)
 	}
 }
 
-func (d *Handler) beforePeers(e *fsm.Event) {
-	peerLogger.Debugf("Received %s, grabbing peers message", e.Event)
-	// Parse out the PeerEndpoint information
-	if _, ok := e.Args[0].(*pb.Message); !ok {
-		e.Cancel(fmt.Errorf("Received unexpected message type"))
-		return
+// refuseHello sends a DISC_UNAUTHORIZED for the reason, returning the error closing the Chat
+func (d *Handler) refuseHello(reason error) error {
+	if err := d.SendMessage(&pb.Message{Type: pb.Message_DISC_UNAUTHORIZED, Payload: []byte(reason.Error())}); err != nil {
+		peerLogger.Errorf("Error sending %s: %s", pb.Message_DISC_UNAUTHORIZED, err)
 	}
-	msg := e.Args[0].(*pb.Message)
+	return &UnauthorizedError{Reason: reason.Error()}
+}
 
-	peersMessage := &pb.PeersMessage{}
-	err := proto.Unmarshal(msg.Payload, peersMessage)
+// answerRemoteChallenge sends the DISC_HELLO_AUTH answering the authChallenge
+// of the DISC_HELLO received. The receiver of the Chat, answering once the
+// initiator answered, issues it a session token.
+func (d *Handler) answerRemoteChallenge() error {
+	var sessionToken string
+	if !d.initiatedStream {
+		sessionToken = d.issueSessionToken()
+	}
+	auth, err := newHelloAuthWithSession(d.remoteChallenge, helloAuthSecrets()[0], sessionToken)
 	if err != nil {
-		e.Cancel(fmt.Errorf("Error unmarshalling PeersMessage: %s", err))
-		return
+		return err
 	}
-
-	peerLogger.Debugf("Received PeersMessage with Peers: %s", peersMessage)
-	d.Coordinator.PeersDiscovered(peersMessage)
-
-	// // Can be used to demonstrate Broadcast function
-	// if viper.GetString("peer.id") == "jdoe" {
-	// 	d.Coordinator.Broadcast(&pb.Message{Type: pb.Message_UNDEFINED})
-	// }
-
+	if err := d.SendMessage(auth); err != nil {
+		return fmt.Errorf("Error sending %s: %s", pb.Message_DISC_HELLO_AUTH, err)
+	}
+	return nil
 }
 
-func (d *Handler) beforeBlockAdded(e *fsm.Event) {
-	peerLogger.Debugf("Received message: %s", e.Event)
+// beforeHelloAuth checks the answer of the remote peer to the hello challenge,
+// closing the Chat if it is wrong, and registers the peer if its DISC_HELLO
+// was received
+func (d *Handler) beforeHelloAuth(e *fsm.Event) {
 	msg, ok := e.Args[0].(*pb.Message)
 	if !ok {
 		e.Cancel(fmt.Errorf("Received unexpected message type"))
 		return
 	}
-	// Add the block and any delta state to the ledger
-	_ = msg
-}
-
-func (d *Handler) when(stateToCheck string) bool {
-	return d.FSM.Is(stateToCheck)
+	if d.helloChallenge == nil || d.helloAuthenticated {
+		peerLogger.Debugf("Ignoring unexpected %s", e.Event)
+		return
+	}
+	answer := &pb.HelloAuth{}
+	if err := proto.Unmarshal(msg.Payload, answer); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling HelloAuth: %s", err))
+		return
+	}
+	if err := verifyHelloAuth(d.helloChallenge, answer, helloAuthSecrets()); err != nil {
+		peerLogger.Warningf("Refusing Chat, %s", err)
+		e.Cancel(d.refuseHello(err))
+		return
+	}
+	d.helloAuthenticated = true
+	if d.initiatedStream && answer.SessionToken != "" {
+		d.Coordinator.GetSessionTokenStore().Hold(d.ToPeerEndpoint.Address, answer.SessionToken)
+	}
+	if !d.initiatedStream {
+		if err := d.answerRemoteChallenge(); err != nil {
+			e.Cancel(err)
+			return
+		}
+	}
+	if d.pendingHello != nil {
+		helloMessage := d.pendingHello
+		d.pendingHello = nil
+		if err := d.registerHello(helloMessage); err != nil {
+			e.Cancel(err)
+		}
+	}
 }
 
-// HandleMessage handles the Openchain messages for the Peer.
-func (d *Handler) HandleMessage(msg *pb.Message) error {
-	peerLogger.Debugf("Handling Message of type: %s ", msg.Type)
-	if d.FSM.Cannot(msg.Type.String()) {
-		return fmt.Errorf("Peer FSM cannot handle message (%s) with payload size (%d) while in state: %s", msg.Type.String(), len(msg.Payload), d.FSM.Current())
+// registerHello registers the peer of the DISC_HELLO, with the attributes it
+// advertised, unless it opened the Chat for requests alone
+func (d *Handler) registerHello(helloMessage *pb.HelloMessage) error {
+	if d.requestOnly {
+		peerLogger.Debugf("Serving the requests of %s without registering it", d.ToPeerEndpoint.Address)
+		return nil
 	}
-	err := d.FSM.Event(msg.Type.String(), msg)
-	if err != nil {
-		if _, ok := err.(*fsm.NoTransitionError); !ok {
-			// Only allow NoTransitionError's, all others are considered true error.
-			return fmt.Errorf("Peer FSM failed while handling message (%s): current state: %s, error: %s", msg.Type.String(), d.FSM.Current(), err)
-			//t.Error("expected only 'NoTransitionError'")
+	if err := d.Coordinator.RegisterHandler(d); err != nil {
+		return fmt.Errorf("Error registering Handler: %s", err)
+	}
+	// Registered successfully
+	d.registered = true
+	d.priority = helloMessage.Priority
+	if d.initiatedStream {
+		// The HELLO exchange of an initiated stream is a round trip
+		d.Coordinator.GetPeerRegistry().UpdateRTT(d.ToPeerEndpoint.ID, time.Since(d.helloSentAt))
+	}
+	d.Coordinator.GetPeerRegistry().SetCoordinates(d.ToPeerEndpoint.ID, helloMessage.GeoCoordinates)
+	d.Coordinator.GetPeerRegistry().SetLoadScore(d.ToPeerEndpoint.ID, helloMessage.LoadScore)
+	d.Coordinator.GetPeerRegistry().SetRegion(d.ToPeerEndpoint.ID, helloMessage.Region)
+	d.Coordinator.GetPeerRegistry().SetOnionAddress(d.ToPeerEndpoint.ID, helloMessage.OnionAddress)
+	d.Coordinator.GetPeerRegistry().SetRole(d.ToPeerEndpoint.ID, helloMessage.Role)
+	d.Coordinator.GetPeerRegistry().SetPriority(d.ToPeerEndpoint.ID, helloMessage.Priority)
+	d.Coordinator.GetPeerRegistry().SetUptime(d.ToPeerEndpoint.ID, time.Duration(helloMessage.UptimeSeconds)*time.Second)
+	if helloMessage.BlockchainInfo != nil {
+		d.Coordinator.GetPeerRegistry().SetBlockHeight(d.ToPeerEndpoint.ID, helloMessage.BlockchainInfo.Height)
+	}
+	if len(helloMessage.EncryptionKey) > 0 {
+		if key, err := primitives.DERToPublicKey(helloMessage.EncryptionKey); err != nil {
+			peerLogger.Warningf("Error decoding encryption key of %s: %s", d.ToPeerEndpoint.Address, err)
+		} else if key, ok := key.(*ecdsa.PublicKey); ok {
+			d.Coordinator.GetPeerRegistry().SetEncryptionKey(d.ToPeerEndpoint.ID, key)
+		} else {
+			peerLogger.Warningf("Encryption key of %s is not an ECDSA public key", d.ToPeerEndpoint.Address)
+		}
+	}
+	if err := d.sendPeerMetadata(); err != nil {
+		peerLogger.Warningf("Error sending %s to %s: %s", pb.Message_DISC_PEER_METADATA, d.ToPeerEndpoint.Address, err)
+	}
+	otherPeer := d.ToPeerEndpoint.Address
+	if !d.Coordinator.GetDiscHelper().FindNode(otherPeer) {
+		if ok := d.Coordinator.GetDiscHelper().AddNode(otherPeer); !ok {
+			peerLogger.Warningf("Unable to add peer %v to discovery list", otherPeer)
+		}
+		if err := d.Coordinator.StoreDiscoveryList(); err != nil {
+			peerLogger.Error(err)
 		}
 	}
+	go d.start()
 	return nil
 }
 
-// SendMessage sends a message to the remote PEER through the stream
-func (d *Handler) SendMessage(msg *pb.Message) error {
-	//make sure Sends are serialized. Also make sure everyone uses SendMessage
-	//instead of calling Send directly on the grpc stream
-	d.chatMutex.Lock()
-	defer d.chatMutex.Unlock()
-	peerLogger.Debugf("Sending message to stream of type: %s ", msg.Type)
-	err := d.ChatStream.Send(msg)
+// sendPeerMetadata sends the attributes configured under peer.metadata and
+// the role of this peer, if any
+func (d *Handler) sendPeerMetadata() error {
+	metadata := newPeerMetadata()
+	if len(metadata.Attributes) == 0 && metadata.Role == "" {
+		return nil
+	}
+	msg, err := newPeerMetadataMessage(metadata)
 	if err != nil {
-		return fmt.Errorf("Error Sending message through ChatStream: %s", err)
+		return err
 	}
-	return nil
+	return d.SendMessage(msg)
 }
 
-// start starts the Peer server function
-func (d *Handler) start() error {
-	discPeriod := viper.GetDuration("peer.discovery.period")
-	tickChan := time.NewTicker(discPeriod).C
-	peerLogger.Debug("Starting Peer discovery service")
-	for {
-		select {
-		case <-tickChan:
-			if err := d.SendMessage(&pb.Message{Type: pb.Message_DISC_GET_PEERS}); err != nil {
-				peerLogger.Errorf("Error sending %s during handler discovery tick: %s", pb.Message_DISC_GET_PEERS, err)
-			}
-		case <-d.doneChan:
-			peerLogger.Debug("Stopping discovery service")
-			return nil
-		}
+func (d *Handler) beforePeerMetadata(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	metadata := &pb.PeerMetadata{}
+	if err := proto.Unmarshal(msg.Payload, metadata); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling PeerMetadata: %s", err))
+		return
 	}
+	peerLogger.Debugf("Received %s from %s: %v, role %q", e.Event, d.ToPeerEndpoint.Address, metadata.Attributes, metadata.Role)
+	d.Coordinator.GetPeerRegistry().SetAttributes(d.ToPeerEndpoint.ID, metadata.Attributes)
+	d.Coordinator.GetPeerRegistry().SetRole(d.ToPeerEndpoint.ID, metadata.Role)
 }
 
-// RequestBlocks get the blocks from the other PeerEndpoint based upon supplied SyncBlockRange, will provide them through the returned channel.
-// this will also stop writing any received blocks to channels created from Prior calls to RequestBlocks(..)
-func (d *Handler) RequestBlocks(syncBlockRange *pb.SyncBlockRange) (<-chan *pb.SyncBlocks, error) {
-	d.syncBlocksRequestHandler.Lock()
-	defer d.syncBlocksRequestHandler.Unlock()
-
-	d.syncBlocksRequestHandler.reset()
-	syncBlockRange.CorrelationId = d.syncBlocksRequestHandler.correlationID
+func (d *Handler) beforeDisconnect(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	d.revokeSession()
+	e.Cancel(&DisconnectedError{Reason: string(msg.Payload)})
+}
 
-	// Marshal the SyncBlockRange as the payload
-	syncBlockRangeBytes, err := proto.Marshal(syncBlockRange)
-	if err != nil {
-		return nil, fmt.Errorf("Error marshaling syncBlockRange during GetBlocks: %s", err)
+func (d *Handler) beforeVersionMismatch(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
 	}
-	peerLogger.Debugf("Sending %s with Range %s", pb.Message_SYNC_GET_BLOCKS.String(), syncBlockRange)
-	if err := d.SendMessage(&pb.Message{Type: pb.Message_SYNC_GET_BLOCKS, Payload: syncBlockRangeBytes}); err != nil {
-		return nil, fmt.Errorf("Error sending %s during GetBlocks: %s", pb.Message_SYNC_GET_BLOCKS, err)
+	mismatch := &pb.CapabilityMismatch{}
+	if err := proto.Unmarshal(msg.Payload, mismatch); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling CapabilityMismatch: %s", err))
+		return
 	}
-	return d.syncBlocksRequestHandler.channel, nil
+	e.Cancel(&CapabilityMismatchError{Missing: mismatch.MissingCapabilities})
 }
 
-func (d *Handler) beforeSyncGetBlocks(e *fsm.Event) {
-	peerLogger.Debugf("Received message: %s", e.Event)
+func (d *Handler) beforeRegistryFull(e *fsm.Event) {
 	msg, ok := e.Args[0].(*pb.Message)
 	if !ok {
 		e.Cancel(fmt.Errorf("Received unexpected message type"))
 		return
 	}
-	// Start a separate go FUNC to send the blocks per the SyncBlockRange payload
-	syncBlockRange := &pb.SyncBlockRange{}
-	err := proto.Unmarshal(msg.Payload, syncBlockRange)
-	if err != nil {
-		e.Cancel(fmt.Errorf("Error unmarshalling SyncBlockRange in GetBlocks: %s", err))
+	registryFull := &pb.RegistryFull{}
+	if err := proto.Unmarshal(msg.Payload, registryFull); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling RegistryFull: %s", err))
 		return
 	}
+	retryAfter := time.Duration(registryFull.RetryAfterSeconds) * time.Second
+	peerLogger.Warningf("Received %s, remote peer asked for a retry after %s", e.Event, retryAfter)
+	e.Cancel(&RegistryFullError{RetryAfter: retryAfter})
+}
 
-	go d.sendBlocks(syncBlockRange)
+func (d *Handler) beforeUnauthorized(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	peerLogger.Warningf("Received %s, remote peer refused the auth token: %s", e.Event, msg.Payload)
+	e.Cancel(&UnauthorizedError{Reason: string(msg.Payload)})
 }
 
-func (d *Handler) beforeSyncBlocks(e *fsm.Event) {
-	peerLogger.Debugf("Received message: %s", e.Event)
+func (d *Handler) beforeGetPeers(e *fsm.Event) {
 	msg, ok := e.Args[0].(*pb.Message)
 	if !ok {
 		e.Cancel(fmt.Errorf("Received unexpected message type"))
 		return
 	}
-	// Forward the received SyncBlocks to the channel
-	syncBlocks := &pb.SyncBlocks{}
-	err := proto.Unmarshal(msg.Payload, syncBlocks)
+	// Peers predating the GetPeers payload send none, which unmarshals to the defaults
+	request := &pb.GetPeers{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling GetPeers: %s", err))
+		return
+	}
+	if !d.reserveGetPeers(e, msg) {
+		return
+	}
+	peersMessage, err := d.Coordinator.GetPeers()
 	if err != nil {
-		e.Cancel(fmt.Errorf("Error unmarshalling SyncBlocks in beforeSyncBlocks: %s", err))
+		e.Cancel(fmt.Errorf("Error Getting Peers: %s", err))
 		return
 	}
-
-	peerLogger.Debugf("Sending block onto channel for start = %d and end = %d", syncBlocks.Range.Start, syncBlocks.Range.End)
-
-	// Send the message onto the channel, allow for the fact that channel may be closed on send attempt.
-	defer func() {
-		if x := recover(); x != nil {
-			peerLogger.Errorf("Error sending syncBlocks to channel: %v", x)
+	if sorter := d.Coordinator.GetPeerSorter(); sorter != nil {
+		local, err := d.Coordinator.GetPeerEndpoint()
+		if err != nil {
+			e.Cancel(fmt.Errorf("Error Getting Peer Endpoint: %s", err))
+			return
 		}
-	}()
-
-	d.syncBlocksRequestHandler.Lock()
-	defer d.syncBlocksRequestHandler.Unlock()
-	// Use non-blocking send, will WARN if missed message.
-	if d.syncBlocksRequestHandler.shouldHandle(syncBlocks.Range.CorrelationId) {
-		select {
-		case d.syncBlocksRequestHandler.channel <- syncBlocks:
-		default:
-			peerLogger.Warningf("Did NOT send SyncBlocks message to channel for range: %d - %d", syncBlocks.Range.Start, syncBlocks.Range.End)
-			d.syncBlocksRequestHandler.reset()
+		reference := *local.ID
+		if _, ok := sorter.(ByGeoDistance); ok && d.ToPeerEndpoint != nil {
+			reference = *d.ToPeerEndpoint.ID
 		}
-	} else {
-		//Ignore the message, does not match the current correlationId
-		peerLogger.Warningf("Ignoring SyncBlocks message with correlationId = %d, blocks %d to %d, as current correlationId = %d", syncBlocks.Range.CorrelationId, syncBlocks.Range.Start, syncBlocks.Range.End, d.syncBlocksRequestHandler.correlationID)
+		peersMessage.Peers = sorter.Sort(reference, peersMessage.Peers)
+	}
+	if request.IncludeSelf {
+		local, err := d.Coordinator.GetPeerEndpoint()
+		if err != nil {
+			e.Cancel(fmt.Errorf("Error Getting Peer Endpoint: %s", err))
+			return
+		}
+		peersMessage.Peers = append([]*pb.PeerEndpoint{local}, peersMessage.Peers...)
+	}
+	if maxPeers := viper.GetInt("peer.discovery.maxPeers"); maxPeers > 0 && len(peersMessage.Peers) > maxPeers {
+		peersMessage.Peers = peersMessage.Peers[:maxPeers]
+	}
+	peersMessage.Nonce = request.Nonce
+	data, err := proto.Marshal(peersMessage)
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error Marshalling PeersMessage: %s", err))
+		return
+	}
+	peerLogger.Debugf("Sending back %s", pb.Message_DISC_PEERS.String())
+	if err := d.reply(msg, &pb.Message{Type: pb.Message_DISC_PEERS, Payload: data}); err != nil {
+		e.Cancel(err)
 	}
 }
 
-// sendBlocks sends the blocks based upon the supplied SyncBlockRange over the stream.
-func (d *Handler) sendBlocks(syncBlockRange *pb.SyncBlockRange) {
-	peerLogger.Debugf("Sending blocks %d-%d", syncBlockRange.Start, syncBlockRange.End)
-	var blockNums []uint64
-	if syncBlockRange.Start > syncBlockRange.End {
-		// Send in reverse order
-		// note that i is a uint so decrementing i below 0 results in an underflow (i becomes uint.MaxValue). Always stop after i == 0
-		for i := syncBlockRange.Start; i >= syncBlockRange.End && i <= syncBlockRange.Start; i-- {
-			blockNums = append(blockNums, i)
+// peersReceived starts chats with the unknown peers of peersMessage, the peers
+// the remote peer has a Chat with, and records them as its neighbors
+func (d *Handler) peersReceived(peersMessage *pb.PeersMessage) {
+	d.Coordinator.PeersDiscovered(peersMessage)
+	var neighbors []*pb.PeerID
+	for _, peer := range peersMessage.Peers {
+		if peer.ID != nil && *peer.ID != *d.ToPeerEndpoint.ID {
+			neighbors = append(neighbors, peer.ID)
+		}
+	}
+	d.Coordinator.GetPeerRegistry().SetNeighbors(d.ToPeerEndpoint.ID, neighbors)
+}
+
+func (d *Handler) beforeGetPeersDiff(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.GetPeersDiff{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling GetPeersDiff: %s", err))
+		return
+	}
+	if !d.reserveGetPeers(e, msg) {
+		return
+	}
+	diff := d.Coordinator.GetPeerRegistry().Diff(request.SinceViewID)
+	peerLogger.Debugf("Sending back %s of view %d since view %d, full=%t", pb.Message_DISC_PEERS_DIFF, diff.ViewID, request.SinceViewID, diff.Full)
+	data, err := proto.Marshal(diff)
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error Marshalling PeersDiff: %s", err))
+		return
+	}
+	if err := d.reply(msg, &pb.Message{Type: pb.Message_DISC_PEERS_DIFF, Payload: data}); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforePeersDiff(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	diff := &pb.PeersDiff{}
+	if err := proto.Unmarshal(msg.Payload, diff); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling PeersDiff: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s of view %d with %d added and %d removed peers, full=%t", e.Event, diff.ViewID, len(diff.Added), len(diff.Removed), diff.Full)
+	d.discoveryMutex.Lock()
+	d.remotePeers = applyPeersDiff(d.remotePeers, diff)
+	d.peersViewID = diff.ViewID
+	peersMessage := &pb.PeersMessage{}
+	for _, peer := range d.remotePeers {
+		peersMessage.Peers = append(peersMessage.Peers, peer)
+	}
+	d.discoveryMutex.Unlock()
+	d.peersReceived(peersMessage)
+}
+
+// applyPeersDiff returns the peers known after the diff, the added peers
+// replacing known ones if the diff is full, and known ones of the same pkiID
+func applyPeersDiff(known map[pb.PeerID]*pb.PeerEndpoint, diff *pb.PeersDiff) map[pb.PeerID]*pb.PeerEndpoint {
+	if known == nil || diff.Full {
+		known = make(map[pb.PeerID]*pb.PeerEndpoint)
+	}
+	for _, id := range diff.Removed {
+		delete(known, *id)
+	}
+	for _, peer := range diff.Added {
+		if peer.ID == nil {
+			continue
+		}
+		// A peer of the same pkiID listed under another ID is the same peer
+		if fingerprint := PeerFingerprint(peer.PkiID); fingerprint != nil {
+			for id, other := range known {
+				if id != *peer.ID && bytes.Equal(PeerFingerprint(other.PkiID), fingerprint) {
+					delete(known, id)
+				}
+			}
+		}
+		known[*peer.ID] = peer
+	}
+	return known
+}
+
+func (d *Handler) beforeGetPeersRetryAfter(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	retryAfter := &pb.GetPeersRetryAfter{}
+	if err := proto.Unmarshal(msg.Payload, retryAfter); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling GetPeersRetryAfter: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s, not sending %s for %dms", e.Event, pb.Message_DISC_GET_PEERS, retryAfter.RetryAfterMs)
+	d.discoveryMutex.Lock()
+	d.nextDiscovery = time.Now().Add(time.Duration(retryAfter.RetryAfterMs) * time.Millisecond)
+	d.discoveryMutex.Unlock()
+}
+
+// beforeQuorumGetPeers answers with the merge of the peer list of this peer
+// with those of up to quorumSize of its peers, capped by
+// peer.discovery.maxQuorumSize. The peers are queried in the background so as
+// not to hold up the stream.
+func (d *Handler) beforeQuorumGetPeers(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.QuorumGetPeers{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling QuorumGetPeers: %s", err))
+		return
+	}
+	if !d.reserveGetPeers(e, msg) {
+		return
+	}
+	quorumSize := request.QuorumSize
+	if maxQuorumSize := uint32(viper.GetInt("peer.discovery.maxQuorumSize")); quorumSize > maxQuorumSize {
+		quorumSize = maxQuorumSize
+	}
+	var exclude *pb.PeerID
+	if d.ToPeerEndpoint != nil {
+		exclude = d.ToPeerEndpoint.ID
+	}
+	registry := d.Coordinator.GetPeerRegistry()
+	sendPeers := func(peers []*pb.PeerEndpoint) error {
+		if maxPeers := viper.GetInt("peer.discovery.maxPeers"); maxPeers > 0 && len(peers) > maxPeers {
+			peers = peers[:maxPeers]
+		}
+		data, err := proto.Marshal(&pb.PeersMessage{Peers: peers})
+		if err != nil {
+			return fmt.Errorf("Error Marshalling PeersMessage: %s", err)
+		}
+		return d.reply(msg, &pb.Message{Type: pb.Message_DISC_PEERS, Payload: data})
+	}
+	if quorumSize == 0 {
+		if err := sendPeers(registryPeerList(registry, time.Now())); err != nil {
+			e.Cancel(err)
+		}
+		return
+	}
+	go func() {
+		peers := quorumPeerList(registry, quorumSize, exclude)
+		peerLogger.Debugf("Sending back %s of %d peers merged from a quorum of %d", pb.Message_DISC_PEERS, len(peers), quorumSize)
+		if err := sendPeers(peers); err != nil {
+			peerLogger.Errorf("Error sending %s: %s", pb.Message_DISC_PEERS, err)
+		}
+	}()
+}
+
+// reserveGetPeers returns false, having replied with a
+// DISC_GET_PEERS_RETRY_AFTER, if peer list requests are being rate limited
+func (d *Handler) reserveGetPeers(e *fsm.Event, msg *pb.Message) bool {
+	delay := d.Coordinator.ReserveGetPeers()
+	if delay <= 0 {
+		return true
+	}
+	retryAfterMs := uint32((delay + time.Millisecond - 1) / time.Millisecond)
+	data, err := proto.Marshal(&pb.GetPeersRetryAfter{RetryAfterMs: retryAfterMs})
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error Marshalling GetPeersRetryAfter: %s", err))
+		return false
+	}
+	peerLogger.Debugf("Rate limiting %s, sending back %s of %dms", e.Event, pb.Message_DISC_GET_PEERS_RETRY_AFTER, retryAfterMs)
+	if err := d.reply(msg, &pb.Message{Type: pb.Message_DISC_GET_PEERS_RETRY_AFTER, Payload: data}); err != nil {
+		e.Cancel(err)
+	}
+	return false
+}
+
+// beforeGetPeersDiverse answers a DISC_GET_PEERS_DIVERSE with a sample of the
+// registry spanning as many /24 subnets as it can, for a client not to learn
+// only of peers an attacker controlling a single subnet registered
+func (d *Handler) beforeGetPeersDiverse(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.GetPeersDiverse{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling GetPeersDiverse: %s", err))
+		return
+	}
+	if !d.reserveGetPeers(e, msg) {
+		return
+	}
+	maxResults := int(request.MaxResults)
+	if maxPeers := viper.GetInt("peer.discovery.maxPeers"); maxPeers > 0 && (maxResults == 0 || maxResults > maxPeers) {
+		maxResults = maxPeers
+	}
+	peers := DiverseSample(registryPeerList(d.Coordinator.GetPeerRegistry(), time.Now()), maxResults, int(request.MaxPerSubnet))
+	data, err := proto.Marshal(&pb.PeersMessage{Peers: peers})
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error Marshalling PeersMessage: %s", err))
+		return
+	}
+	peerLogger.Debugf("Sending back %s of %d peers, at most %d per subnet", pb.Message_DISC_PEERS, len(peers), request.MaxPerSubnet)
+	if err := d.reply(msg, &pb.Message{Type: pb.Message_DISC_PEERS, Payload: data}); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeGetTopology(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	topology, err := d.Coordinator.GetTopology()
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error getting topology: %s", err))
+		return
+	}
+	data, err := proto.Marshal(topology)
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error marshalling Topology: %s", err))
+		return
+	}
+	if err := d.reply(msg, &pb.Message{Type: pb.Message_DISC_TOPOLOGY_RESPONSE, Payload: data}); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforePeers(e *fsm.Event) {
+	peerLogger.Debugf("Received %s, grabbing peers message", e.Event)
+	// Parse out the PeerEndpoint information
+	if _, ok := e.Args[0].(*pb.Message); !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	msg := e.Args[0].(*pb.Message)
+
+	peersMessage := &pb.PeersMessage{}
+	err := proto.Unmarshal(msg.Payload, peersMessage)
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling PeersMessage: %s", err))
+		return
+	}
+
+	peerLogger.Debugf("Received PeersMessage with Peers: %s", peersMessage)
+	if d.HasFeature(nonceFeature) && !d.Coordinator.GetNoncePool().Verify(peersMessage.Nonce) {
+		peerLogger.Warningf("Dropping %s from %s without the nonce of a pending %s, possibly replayed", e.Event, d.ToPeerEndpoint.Address, pb.Message_DISC_GET_PEERS)
+		return
+	}
+	d.peersReceived(peersMessage)
+
+	// // Can be used to demonstrate Broadcast function
+	// if viper.GetString("peer.id") == "jdoe" {
+	// 	d.Coordinator.Broadcast(&pb.Message{Type: pb.Message_UNDEFINED})
+	// }
+
+}
+
+func (d *Handler) beforeBlockAdded(e *fsm.Event) {
+	peerLogger.Debugf("Received message: %s", e.Event)
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	// Add the block and any delta state to the ledger
+	_ = msg
+}
+
+func (d *Handler) beforeNewBlockSealed(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	sealed := &pb.BlockSealed{}
+	if err := proto.Unmarshal(msg.Payload, sealed); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling BlockSealed: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s of block %d with %d transactions", e.Event, sealed.BlockNumber, sealed.TotalTransactions)
+	if d.Coordinator.GetBlockAnnouncer().Received(sealed) {
+		peerLogger.Debugf("Latest known block is now %d", sealed.BlockNumber)
+	}
+	// The sender sealed the block, its chain is at least that high
+	if d.ToPeerEndpoint != nil && sealed.SealerID != nil && *sealed.SealerID == *d.ToPeerEndpoint.ID {
+		d.Coordinator.GetPeerRegistry().SetBlockHeight(d.ToPeerEndpoint.ID, sealed.BlockNumber+1)
+	}
+}
+
+func (d *Handler) beforeTransactionGossip(e *fsm.Event) {
+	peerLogger.Debugf("Received message: %s", e.Event)
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	gossiper := d.Coordinator.GetGossipPropagator()
+	if gossiper == nil {
+		peerLogger.Debugf("Transaction gossip is disabled, ignoring %s", e.Event)
+		return
+	}
+	gossipTx := &pb.GossipTransaction{}
+	if err := proto.Unmarshal(msg.Payload, gossipTx); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling GossipTransaction: %s", err))
+		return
+	}
+	var sender *pb.PeerID
+	if d.ToPeerEndpoint != nil {
+		sender = d.ToPeerEndpoint.ID
+	}
+	if err := gossiper.HandleGossip(gossipTx, sender); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeTransactionsQueryStatus(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	query := &pb.TransactionsQueryStatus{}
+	if err := proto.Unmarshal(msg.Payload, query); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling TransactionsQueryStatus: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for %d transactions", e.Event, len(query.TxIDs))
+	data, err := proto.Marshal(getTransactionStatuses(d.Coordinator.GetTransactionStateStore(), query.TxIDs))
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error marshalling TransactionsStatusResponse: %s", err))
+		return
+	}
+	if err := d.reply(msg, &pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS_STATUS_RESPONSE, Payload: data}); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeBandwidthTest(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	test := &pb.BandwidthTest{}
+	if err := proto.Unmarshal(msg.Payload, test); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling BandwidthTest: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for %d bytes", e.Event, test.PayloadSize)
+	result, err := newBandwidthResult(test)
+	if err != nil {
+		e.Cancel(err)
+		return
+	}
+	if err := d.reply(msg, result); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeGetReceipt(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.GetTransactionReceipt{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling GetTransactionReceipt: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for transaction %s", e.Event, request.TxID)
+	reply := &pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS_RECEIPT}
+	receipt, err := d.Coordinator.GetTransactionReceipt(request.TxID)
+	if err == nil {
+		reply.Payload, err = proto.Marshal(receipt)
+	}
+	if err != nil {
+		peerLogger.Debugf("Unable to issue receipt for transaction %s: %s", request.TxID, err)
+		reply.Type = pb.Message_RESPONSE
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
+		}
+	}
+	if err := d.reply(msg, reply); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeQueryTransaction(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.QueryTransaction{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling QueryTransaction: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for transaction %s", e.Event, request.TxID)
+	reply := &pb.Message{Type: pb.Message_CHAIN_TX_RESPONSE}
+	tx, blockNumber, txIndex, err := d.Coordinator.GetTransaction(request.TxID)
+	switch {
+	case err == ledger.ErrResourceNotFound:
+		reply.Type = pb.Message_CHAIN_TX_NOT_FOUND
+		reply.Payload = msg.Payload
+	case err != nil:
+		peerLogger.Debugf("Unable to get transaction %s: %s", request.TxID, err)
+		reply.Type = pb.Message_RESPONSE
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
+		}
+	default:
+		if reply.Payload, err = proto.Marshal(&pb.TransactionResponse{Tx: tx, BlockNumber: blockNumber, TxIndex: txIndex}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling TransactionResponse: %s", err))
+			return
+		}
+	}
+	if err := d.reply(msg, reply); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeGetBlockByHash(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.GetBlockByHash{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling GetBlockByHash: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for block %x", e.Event, request.Hash)
+	reply := &pb.Message{Type: pb.Message_CHAIN_BLOCK}
+	block, blockNumber, err := d.Coordinator.GetBlockByHash(request.Hash)
+	ledgerErr, _ := err.(*ledger.Error)
+	switch {
+	case ledgerErr != nil && ledgerErr.Type() == ledger.ErrorTypeBlockNotFound:
+		reply.Type = pb.Message_CHAIN_BLOCK_NOT_FOUND
+		reply.Payload = msg.Payload
+	case err != nil:
+		peerLogger.Debugf("Unable to get block %x: %s", request.Hash, err)
+		reply.Type = pb.Message_RESPONSE
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
+		}
+	default:
+		if reply.Payload, err = proto.Marshal(&pb.SubscribedBlock{BlockNumber: blockNumber, Block: block}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling SubscribedBlock: %s", err))
+			return
+		}
+	}
+	if err := d.reply(msg, reply); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeQueryRecentTransactions(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.QueryRecentTransactions{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling QueryRecentTransactions: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for %d transactions of account %s", e.Event, request.MaxCount, request.AccountID)
+	reply := &pb.Message{Type: pb.Message_CHAIN_RECENT_TX_RESPONSE}
+	transactions, next, err := d.Coordinator.GetRecentTransactions(request.AccountID, recentTransactionsPageSize(request.MaxCount), request.Before)
+	if err == nil {
+		reply.Payload, err = proto.Marshal(&pb.RecentTransactionsResponse{Transactions: transactions, Next: next})
+	}
+	if err != nil {
+		peerLogger.Debugf("Unable to get recent transactions of account %s: %s", request.AccountID, err)
+		reply.Type = pb.Message_RESPONSE
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
+		}
+	}
+	if err := d.reply(msg, reply); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeQueryTransactionHistory(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.QueryTransactionHistory{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling QueryTransactionHistory: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for %d transactions of account %s from %d to %d", e.Event, request.MaxResults, request.AccountID, request.FromTime, request.ToTime)
+	reply := &pb.Message{Type: pb.Message_CHAIN_TX_HISTORY_RESPONSE}
+	transactions, total, err := d.Coordinator.GetTransactionHistory(request.AccountID, request.FromTime, request.ToTime, recentTransactionsPageSize(request.MaxResults), request.CursorTxID)
+	if err == nil {
+		reply.Payload, err = proto.Marshal(newTransactionHistoryResponse(transactions, total))
+	}
+	if err != nil {
+		peerLogger.Debugf("Unable to get transaction history of account %s: %s", request.AccountID, err)
+		reply.Type = pb.Message_RESPONSE
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
+		}
+	}
+	if err := d.reply(msg, reply); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeQueryStateDiff(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.QueryStateDiff{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling QueryStateDiff: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for block %d", e.Event, request.BlockNumber)
+	changes, err := d.Coordinator.GetStateDiff(request.BlockNumber)
+	if err != nil {
+		peerLogger.Debugf("Unable to get state diff of block %d: %s", request.BlockNumber, err)
+		reply := &pb.Message{Type: pb.Message_RESPONSE}
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
+		}
+		if err := d.reply(msg, reply); err != nil {
+			e.Cancel(err)
+		}
+		return
+	}
+	for _, fragment := range stateDiffFragments(request.BlockNumber, changes, d.queryFragmentSize()) {
+		reply := &pb.Message{Type: pb.Message_CHAIN_STATE_DIFF_RESPONSE}
+		if reply.Payload, err = proto.Marshal(fragment); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling StateDiffResponse: %s", err))
+			return
+		}
+		if err := d.reply(msg, reply); err != nil {
+			e.Cancel(err)
+			return
+		}
+	}
+}
+
+func (d *Handler) beforeQueryContractState(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.QueryContractState{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling QueryContractState: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for key %s of contract %s at block %d", e.Event, request.Key, request.ContractAddress, request.AtBlock)
+	value, exists, atBlock, err := d.Coordinator.GetContractState(request.ContractAddress, request.Key, request.AtBlock)
+	if err != nil {
+		peerLogger.Debugf("Unable to get key %s of contract %s: %s", request.Key, request.ContractAddress, err)
+		reply := &pb.Message{Type: pb.Message_RESPONSE}
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
+		}
+		if err := d.reply(msg, reply); err != nil {
+			e.Cancel(err)
+		}
+		return
+	}
+	for _, fragment := range contractStateFragments(value, exists, atBlock, d.queryFragmentSize()) {
+		reply := &pb.Message{Type: pb.Message_CHAIN_CONTRACT_STATE_RESPONSE}
+		if reply.Payload, err = proto.Marshal(fragment); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling ContractStateResponse: %s", err))
+			return
+		}
+		if err := d.reply(msg, reply); err != nil {
+			e.Cancel(err)
+			return
+		}
+	}
+}
+
+func (d *Handler) beforeQueryEpoch(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.QueryEpoch{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling QueryEpoch: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for epoch %d", e.Event, request.EpochNumber)
+	reply := &pb.Message{Type: pb.Message_CHAIN_EPOCH_RESPONSE}
+	epoch, err := d.Coordinator.GetEpoch(request.EpochNumber)
+	if err != nil {
+		peerLogger.Debugf("Unable to get epoch %d: %s", request.EpochNumber, err)
+		reply.Type = pb.Message_RESPONSE
+		reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())})
+	} else {
+		reply.Payload, err = proto.Marshal(epoch)
+	}
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error marshalling %s: %s", reply.Type, err))
+		return
+	}
+	if err := d.reply(msg, reply); err != nil {
+		e.Cancel(err)
+	}
+}
+
+// beforeQueryStakingInfo answers a CHAIN_QUERY_STAKING_INFO, only routed here
+// when peer.consensus.type is pos
+func (d *Handler) beforeQueryStakingInfo(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.QueryStakingInfo{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling QueryStakingInfo: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for validator %s", e.Event, request.ValidatorAddress)
+	reply := &pb.Message{Type: pb.Message_CHAIN_STAKING_INFO_RESPONSE}
+	info, err := d.Coordinator.GetStakingInfo(request.ValidatorAddress)
+	if err != nil {
+		peerLogger.Debugf("Unable to get the stake of validator %s: %s", request.ValidatorAddress, err)
+		reply.Type = pb.Message_RESPONSE
+		reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())})
+	} else {
+		reply.Payload, err = proto.Marshal(info)
+	}
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error marshalling %s: %s", reply.Type, err))
+		return
+	}
+	if err := d.reply(msg, reply); err != nil {
+		e.Cancel(err)
+	}
+}
+
+// beforeQueryAccount answers a CHAIN_QUERY_ACCOUNT with the state of the
+// account, a CHAIN_ACCOUNT_NOT_FOUND rather than a zeroed state if there is
+// no such account
+func (d *Handler) beforeQueryAccount(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.QueryAccount{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling QueryAccount: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for account %s", e.Event, request.AccountID)
+	reply := &pb.Message{Type: pb.Message_CHAIN_ACCOUNT_RESPONSE}
+	state, err := d.Coordinator.GetAccount(request.AccountID)
+	switch {
+	case err != nil:
+		peerLogger.Debugf("Unable to get account %s: %s", request.AccountID, err)
+		reply.Type = pb.Message_RESPONSE
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
+		}
+	case state == nil:
+		reply.Type = pb.Message_CHAIN_ACCOUNT_NOT_FOUND
+		reply.Payload = msg.Payload
+	default:
+		if reply.Payload, err = proto.Marshal(state); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling AccountState: %s", err))
+			return
+		}
+	}
+	if err := d.reply(msg, reply); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeQueryDoubleSpend(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.QueryDoubleSpend{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling QueryDoubleSpend: %s", err))
+		return
+	}
+	record, err := d.Coordinator.FindDoubleSpend(request.TxInput)
+	if err != nil {
+		peerLogger.Debugf("Unable to look up the spending of an output: %s", err)
+		reply := &pb.Message{Type: pb.Message_RESPONSE}
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
+		}
+		if err := d.reply(msg, reply); err != nil {
+			e.Cancel(err)
+		}
+		return
+	}
+	reply := &pb.Message{Type: pb.Message_CHAIN_DOUBLE_SPEND_RESPONSE}
+	if reply.Payload, err = proto.Marshal(newDoubleSpendResponse(record)); err != nil {
+		e.Cancel(fmt.Errorf("Error marshalling DoubleSpendResponse: %s", err))
+		return
+	}
+	if err := d.reply(msg, reply); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeValidateBlock(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.ValidateBlock{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling ValidateBlock: %s", err))
+		return
+	}
+	if request.Block == nil {
+		e.Cancel(fmt.Errorf("Received %s without a block", e.Event))
+		return
+	}
+	// Verifying may take long, do not hold up the chat meanwhile. Waiting for
+	// a slot does, for a stream sending more blocks than the peer validates
+	// at once to be slowed down rather than pile up verifications.
+	slots := blockValidationSlots()
+	slots <- struct{}{}
+	go func() {
+		result := validateBlock(slotVerifier{d.Coordinator, slots}, request.Block, validateBlockTimeout())
+		data, err := proto.Marshal(result)
+		if err != nil {
+			peerLogger.Errorf("Error marshalling ValidationResult: %s", err)
+			return
+		}
+		if err := d.reply(msg, &pb.Message{Type: pb.Message_CHAIN_VALIDATE_BLOCK_RESULT, Payload: data}); err != nil {
+			peerLogger.Errorf("Error sending %s: %s", pb.Message_CHAIN_VALIDATE_BLOCK_RESULT, err)
+		}
+	}()
+}
+
+func (d *Handler) beforeValidatePoW(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.ValidatePoW{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling ValidatePoW: %s", err))
+		return
+	}
+	valid, difficulty, hash, err := d.Coordinator.GetPoWValidator().Validate(request.Header)
+	if err != nil {
+		peerLogger.Debugf("Unable to validate proof of work: %s", err)
+		reply := &pb.Message{Type: pb.Message_RESPONSE}
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
+		}
+		if err := d.reply(msg, reply); err != nil {
+			e.Cancel(err)
+		}
+		return
+	}
+	data, err := proto.Marshal(&pb.PoWResult{Valid: valid, Difficulty: difficulty, Hash: hash})
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error marshalling PoWResult: %s", err))
+		return
+	}
+	if err := d.reply(msg, &pb.Message{Type: pb.Message_CHAIN_VALIDATE_POW_RESULT, Payload: data}); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeEstimateTxCost(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.EstimateTxCost{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling EstimateTxCost: %s", err))
+		return
+	}
+	estimate, err := d.Coordinator.EstimateCost(request.Tx)
+	if err != nil {
+		peerLogger.Debugf("Unable to estimate transaction cost: %s", err)
+		reply := &pb.Message{Type: pb.Message_RESPONSE}
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
+		}
+		if err := d.reply(msg, reply); err != nil {
+			e.Cancel(err)
+		}
+		return
+	}
+	data, err := proto.Marshal(&pb.TxCostEstimate{GasEstimate: estimate.Gas, FeeEstimate: estimate.Fee, Confidence: estimate.Confidence})
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error marshalling TxCostEstimate: %s", err))
+		return
+	}
+	if err := d.reply(msg, &pb.Message{Type: pb.Message_CHAIN_TX_COST_ESTIMATE, Payload: data}); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeGetCanonicalTip(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	tip, err := d.Coordinator.GetCanonicalTip()
+	if err != nil {
+		peerLogger.Debugf("Unable to get canonical tip: %s", err)
+		reply := &pb.Message{Type: pb.Message_RESPONSE}
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
+		}
+		if err := d.reply(msg, reply); err != nil {
+			e.Cancel(err)
+		}
+		return
+	}
+	data, err := proto.Marshal(&pb.CanonicalTip{BlockNumber: tip.BlockNumber, BlockHash: tip.BlockHash, TotalDifficulty: tip.TotalDifficulty})
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error marshalling CanonicalTip: %s", err))
+		return
+	}
+	if err := d.reply(msg, &pb.Message{Type: pb.Message_CHAIN_CANONICAL_TIP, Payload: data}); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeQueryForkChoice(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	tip, err := d.Coordinator.GetCanonicalTip()
+	if err != nil {
+		peerLogger.Debugf("Unable to get fork choice: %s", err)
+		reply := &pb.Message{Type: pb.Message_RESPONSE}
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
+		}
+		if err := d.reply(msg, reply); err != nil {
+			e.Cancel(err)
+		}
+		return
+	}
+	data, err := proto.Marshal(newForkChoice(tip))
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error marshalling ForkChoice: %s", err))
+		return
+	}
+	if err := d.reply(msg, &pb.Message{Type: pb.Message_CHAIN_FORK_CHOICE, Payload: data}); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeQueryMempool(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.QueryMempool{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling QueryMempool: %s", err))
+		return
+	}
+	pending, dropped, err := d.Coordinator.GetMempool(request.MaxResults, request.MinGasPrice)
+	if err != nil {
+		peerLogger.Debugf("Unable to query the mempool: %s", err)
+		reply := &pb.Message{Type: pb.Message_RESPONSE}
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
+		}
+		if err := d.reply(msg, reply); err != nil {
+			e.Cancel(err)
+		}
+		return
+	}
+	data, err := proto.Marshal(&pb.MempoolResponse{Pending: pending, Dropped: dropped})
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error marshalling MempoolResponse: %s", err))
+		return
+	}
+	if err := d.reply(msg, &pb.Message{Type: pb.Message_CHAIN_MEMPOOL_RESPONSE, Payload: data}); err != nil {
+		e.Cancel(err)
+	}
+}
+
+// beforeRollbackRequest reverts the transactions of a CHAIN_ROLLBACK_REQUEST
+// signed with peer.admin.secret if peer.tx.allowRollback is set. Every
+// attempt is logged at warning level, whatever its outcome.
+func (d *Handler) beforeRollbackRequest(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.RollbackRequest{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling RollbackRequest: %s", err))
+		return
+	}
+	peerLogger.Warningf("Received %s of transactions %v: %s", e.Event, request.TxIDs, request.Reason)
+	err := verifyRollbackRequest(request, viper.GetString("peer.admin.secret"))
+	if err == nil && !viper.GetBool("peer.tx.allowRollback") {
+		err = fmt.Errorf("Rollbacks are disabled, peer.tx.allowRollback is not set")
+	}
+	if err != nil {
+		peerLogger.Warningf("Refusing rollback of transactions %v: %s", request.TxIDs, err)
+		reply := &pb.Message{Type: pb.Message_RESPONSE}
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
+		}
+		if err := d.reply(msg, reply); err != nil {
+			e.Cancel(err)
+		}
+		return
+	}
+	rolledBack, failed := d.Coordinator.Rollback(request.TxIDs)
+	peerLogger.Warningf("Rolled back transactions %v, failed to roll back %v", rolledBack, failed)
+	data, err := proto.Marshal(&pb.RollbackResponse{RolledBack: rolledBack, Failed: failed})
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error marshalling RollbackResponse: %s", err))
+		return
+	}
+	if err := d.reply(msg, &pb.Message{Type: pb.Message_CHAIN_ROLLBACK_RESPONSE, Payload: data}); err != nil {
+		e.Cancel(err)
+	}
+}
+
+// beforeReportUncle validates the uncle of a CHAIN_REPORT_UNCLE against the
+// ledger and accepts it for inclusion, answering with a CHAIN_UNCLE_ACCEPTED
+// or a CHAIN_UNCLE_REJECTED giving the reason
+func (d *Handler) beforeReportUncle(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.ReportUncle{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling ReportUncle: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for block %d", e.Event, request.IncludedInBlock)
+	_, err := validateUncle(d.Coordinator, request.Uncle, request.IncludedInBlock, uncleMaxDepth())
+	if err == nil {
+		err = d.Coordinator.AddUncle(request.Uncle, request.IncludedInBlock)
+	}
+	reply := &pb.Message{Type: pb.Message_CHAIN_UNCLE_ACCEPTED}
+	if err != nil {
+		peerLogger.Debugf("Rejecting uncle for block %d: %s", request.IncludedInBlock, err)
+		reply.Type = pb.Message_CHAIN_UNCLE_REJECTED
+		if reply.Payload, err = proto.Marshal(&pb.UncleRejected{Reason: err.Error()}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling UncleRejected: %s", err))
+			return
+		}
+	} else if reply.Payload, err = proto.Marshal(&pb.UncleAccepted{}); err != nil {
+		e.Cancel(fmt.Errorf("Error marshalling UncleAccepted: %s", err))
+		return
+	}
+	if err := d.reply(msg, reply); err != nil {
+		e.Cancel(err)
+	}
+}
+
+// reply sends msg in reply to request, with the correlationID of the request
+func (d *Handler) reply(request, msg *pb.Message) error {
+	msg.CorrelationID = request.CorrelationID
+	return d.SendMessage(msg)
+}
+
+// replyWith sends payload as a msgType message in reply to request,
+// cancelling e if it cannot be marshalled or sent
+func (d *Handler) replyWith(e *fsm.Event, request *pb.Message, msgType pb.Message_Type, payload proto.Message) {
+	data, err := proto.Marshal(payload)
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error marshalling reply to %s: %s", e.Event, err))
+		return
+	}
+	if err := d.reply(request, &pb.Message{Type: msgType, Payload: data}); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) when(stateToCheck string) bool {
+	return d.FSM.Is(stateToCheck)
+}
+
+// HandleMessage handles the Openchain messages for the Peer.
+func (d *Handler) HandleMessage(msg *pb.Message) error {
+	peerLogger.Debugf("Handling Message of type: %s ", msg.Type)
+	if d.ToPeerEndpoint != nil {
+		// The peer is alive for as long as it keeps sending
+		d.Coordinator.GetPeerRegistry().Touch(d.ToPeerEndpoint.ID)
+	}
+	if d.FSM.Cannot(msg.Type.String()) {
+		return fmt.Errorf("Peer FSM cannot handle message (%s) with payload size (%d) while in state: %s", msg.Type.String(), len(msg.Payload), d.FSM.Current())
+	}
+	if d.helloChallenge != nil && !d.helloAuthenticated && !handshakeMessage(msg.Type) {
+		return fmt.Errorf("Peer FSM cannot handle message (%s) before the remote peer answered the hello challenge", msg.Type.String())
+	}
+	if !d.helloAuthorized && !handshakeMessage(msg.Type) && d.Coordinator.GetTokenValidator() != nil {
+		return fmt.Errorf("Peer FSM cannot handle message (%s) before the auth token of the remote peer was validated", msg.Type.String())
+	}
+	err := d.FSM.Event(msg.Type.String(), msg)
+	if canceled, ok := err.(*fsm.CanceledError); ok {
+		switch canceled.Err.(type) {
+		case *CapabilityMismatchError, *RegistryFullError, *BannedError, *UnauthorizedError:
+			// Returned as is for the Chat to be closed
+			return canceled.Err
+		}
+	}
+	if err != nil {
+		if _, ok := err.(*fsm.NoTransitionError); !ok {
+			// Only allow NoTransitionError's, all others are considered true error.
+			return fmt.Errorf("Peer FSM failed while handling message (%s): current state: %s, error: %s", msg.Type.String(), d.FSM.Current(), err)
+			//t.Error("expected only 'NoTransitionError'")
+		}
+	}
+	return nil
+}
+
+// handshakeMessage returns whether messages of type t may be received from a
+// peer not authenticated yet, by the auth token of its DISC_HELLO or its
+// answer to the hello challenge
+func handshakeMessage(t pb.Message_Type) bool {
+	switch t {
+	case pb.Message_DISC_HELLO, pb.Message_DISC_HELLO_AUTH, pb.Message_DISC_UNAUTHORIZED, pb.Message_DISC_VERSION_MISMATCH, pb.Message_DISC_REGISTRY_FULL, pb.Message_DISC_DISCONNECT:
+		return true
+	}
+	return false
+}
+
+// SendMessage sends a message to the remote PEER through the stream
+func (d *Handler) SendMessage(msg *pb.Message) error {
+	//make sure Sends are serialized. Also make sure everyone uses SendMessage
+	//instead of calling Send directly on the grpc stream
+	d.chatMutex.Lock()
+	defer d.chatMutex.Unlock()
+	peerLogger.Debugf("Sending message to stream of type: %s ", msg.Type)
+	err := d.ChatStream.Send(msg)
+	if err != nil {
+		return fmt.Errorf("Error Sending message through ChatStream: %s", err)
+	}
+	return nil
+}
+
+// start starts the Peer server function
+func (d *Handler) start() error {
+	discPeriod := viper.GetDuration("peer.discovery.period")
+	tickChan := time.NewTicker(discPeriod).C
+	peerLogger.Debug("Starting Peer discovery service")
+	for {
+		select {
+		case <-tickChan:
+			d.discoveryMutex.Lock()
+			next := d.nextDiscovery
+			sinceViewID := d.peersViewID
+			d.discoveryMutex.Unlock()
+			if time.Now().Before(next) {
+				peerLogger.Debugf("Skipping %s during handler discovery tick, retry after %s", pb.Message_DISC_GET_PEERS, next)
+				continue
+			}
+			request := &pb.Message{Type: pb.Message_DISC_GET_PEERS}
+			if d.HasCapability(peersDiffCapability) {
+				data, err := proto.Marshal(&pb.GetPeersDiff{SinceViewID: sinceViewID})
+				if err != nil {
+					peerLogger.Errorf("Error marshalling GetPeersDiff: %s", err)
+					continue
+				}
+				request = &pb.Message{Type: pb.Message_DISC_GET_PEERS_DIFF, Payload: data}
+			} else if d.HasFeature(nonceFeature) {
+				nonce, err := d.Coordinator.GetNoncePool().Get()
+				if err != nil {
+					peerLogger.Errorf("Error getting the nonce of %s: %s", request.Type, err)
+					continue
+				}
+				if request.Payload, err = proto.Marshal(&pb.GetPeers{Nonce: nonce}); err != nil {
+					peerLogger.Errorf("Error marshalling GetPeers: %s", err)
+					continue
+				}
+			}
+			if err := d.SendMessage(request); err != nil {
+				peerLogger.Errorf("Error sending %s during handler discovery tick: %s", request.Type, err)
+			}
+		case <-d.doneChan:
+			peerLogger.Debug("Stopping discovery service")
+			return nil
+		}
+	}
+}
+
+// RequestBlocks get the blocks from the other PeerEndpoint based upon supplied SyncBlockRange, will provide them through the returned channel.
+// this will also stop writing any received blocks to channels created from Prior calls to RequestBlocks(..)
+func (d *Handler) RequestBlocks(syncBlockRange *pb.SyncBlockRange) (<-chan *pb.SyncBlocks, error) {
+	d.syncBlocksRequestHandler.Lock()
+	defer d.syncBlocksRequestHandler.Unlock()
+
+	d.syncBlocksRequestHandler.reset()
+	syncBlockRange.CorrelationId = d.syncBlocksRequestHandler.correlationID
+	if syncBlockRange.BandwidthPolicy == pb.SyncBandwidthPolicy_NORMAL {
+		syncBlockRange.BandwidthPolicy = requestedSyncBandwidthPolicy()
+	}
+
+	// Marshal the SyncBlockRange as the payload
+	syncBlockRangeBytes, err := proto.Marshal(syncBlockRange)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshaling syncBlockRange during GetBlocks: %s", err)
+	}
+	peerLogger.Debugf("Sending %s with Range %s", pb.Message_SYNC_GET_BLOCKS.String(), syncBlockRange)
+	if err := d.SendMessage(&pb.Message{Type: pb.Message_SYNC_GET_BLOCKS, Payload: syncBlockRangeBytes}); err != nil {
+		return nil, fmt.Errorf("Error sending %s during GetBlocks: %s", pb.Message_SYNC_GET_BLOCKS, err)
+	}
+	return d.syncBlocksRequestHandler.channel, nil
+}
+
+func (d *Handler) beforeSyncGetBlocks(e *fsm.Event) {
+	peerLogger.Debugf("Received message: %s", e.Event)
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	// Start a separate go FUNC to send the blocks per the SyncBlockRange payload
+	syncBlockRange := &pb.SyncBlockRange{}
+	err := proto.Unmarshal(msg.Payload, syncBlockRange)
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling SyncBlockRange in GetBlocks: %s", err))
+		return
+	}
+
+	go d.sendBlocks(syncBlockRange)
+}
+
+// RequestBlocksFromCheckpoint gets the blocks after the checkpoint from the
+// other PeerEndpoint, provided through the returned channel. If the other
+// PeerEndpoint does not have the checkpoint block, the blocks are requested
+// from block 0 instead.
+func (d *Handler) RequestBlocksFromCheckpoint(checkpoint *pb.SyncCheckpoint) (<-chan *pb.SyncBlocks, error) {
+	d.syncBlocksRequestHandler.Lock()
+	defer d.syncBlocksRequestHandler.Unlock()
+
+	d.syncBlocksRequestHandler.reset()
+	checkpoint.CorrelationId = d.syncBlocksRequestHandler.correlationID
+
+	checkpointBytes, err := proto.Marshal(checkpoint)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshaling SyncCheckpoint: %s", err)
+	}
+	peerLogger.Debugf("Sending %s at block %d up to block %d", pb.Message_SYNC_CHECKPOINT, checkpoint.BlockNumber, checkpoint.End)
+	if err := d.SendMessage(&pb.Message{Type: pb.Message_SYNC_CHECKPOINT, Payload: checkpointBytes}); err != nil {
+		return nil, fmt.Errorf("Error sending %s: %s", pb.Message_SYNC_CHECKPOINT, err)
+	}
+	return d.syncBlocksRequestHandler.channel, nil
+}
+
+func (d *Handler) beforeSyncCheckpoint(e *fsm.Event) {
+	peerLogger.Debugf("Received message: %s", e.Event)
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	checkpoint := &pb.SyncCheckpoint{}
+	if err := proto.Unmarshal(msg.Payload, checkpoint); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling SyncCheckpoint: %s", err))
+		return
+	}
+	if !d.Coordinator.VerifyCheckpoint(checkpoint.BlockNumber, checkpoint.CheckpointHash) {
+		peerLogger.Debugf("Checkpoint at block %d does not match, sending %s", checkpoint.BlockNumber, pb.Message_SYNC_CHECKPOINT_MISMATCH)
+		if err := d.SendMessage(&pb.Message{Type: pb.Message_SYNC_CHECKPOINT_MISMATCH, Payload: msg.Payload}); err != nil {
+			e.Cancel(err)
+		}
+		return
+	}
+	go d.sendBlocks(&pb.SyncBlockRange{CorrelationId: checkpoint.CorrelationId, Start: checkpoint.BlockNumber + 1, End: checkpoint.End})
+}
+
+func (d *Handler) beforeSyncCheckpointMismatch(e *fsm.Event) {
+	peerLogger.Debugf("Received message: %s", e.Event)
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	checkpoint := &pb.SyncCheckpoint{}
+	if err := proto.Unmarshal(msg.Payload, checkpoint); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling SyncCheckpoint: %s", err))
+		return
+	}
+	d.syncBlocksRequestHandler.Lock()
+	defer d.syncBlocksRequestHandler.Unlock()
+	if !d.syncBlocksRequestHandler.shouldHandle(checkpoint.CorrelationId) {
+		peerLogger.Warningf("Ignoring %s with correlationId = %d, as current correlationId = %d", e.Event, checkpoint.CorrelationId, d.syncBlocksRequestHandler.correlationID)
+		return
+	}
+	// Fall back to syncing from block 0, the blocks arriving on the same channel
+	peerLogger.Warningf("Checkpoint at block %d rejected by %s, syncing from block 0", checkpoint.BlockNumber, d.ToPeerEndpoint)
+	syncBlockRangeBytes, err := proto.Marshal(&pb.SyncBlockRange{CorrelationId: checkpoint.CorrelationId, Start: 0, End: checkpoint.End})
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error marshaling SyncBlockRange: %s", err))
+		return
+	}
+	if err := d.SendMessage(&pb.Message{Type: pb.Message_SYNC_GET_BLOCKS, Payload: syncBlockRangeBytes}); err != nil {
+		e.Cancel(fmt.Errorf("Error sending %s: %s", pb.Message_SYNC_GET_BLOCKS, err))
+	}
+}
+
+func (d *Handler) beforeSyncBlocks(e *fsm.Event) {
+	peerLogger.Debugf("Received message: %s", e.Event)
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	// Forward the received SyncBlocks to the channel
+	syncBlocks := &pb.SyncBlocks{}
+	err := proto.Unmarshal(msg.Payload, syncBlocks)
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling SyncBlocks in beforeSyncBlocks: %s", err))
+		return
+	}
+
+	d.forwardSyncBlocks(syncBlocks)
+}
+
+// forwardSyncBlocks puts the blocks received onto the channel of the current
+// RequestBlocks, unless they answer another request
+func (d *Handler) forwardSyncBlocks(syncBlocks *pb.SyncBlocks) {
+	peerLogger.Debugf("Sending block onto channel for start = %d and end = %d", syncBlocks.Range.Start, syncBlocks.Range.End)
+
+	// Send the message onto the channel, allow for the fact that channel may be closed on send attempt.
+	defer func() {
+		if x := recover(); x != nil {
+			peerLogger.Errorf("Error sending syncBlocks to channel: %v", x)
+		}
+	}()
+
+	d.syncBlocksRequestHandler.Lock()
+	defer d.syncBlocksRequestHandler.Unlock()
+	// Use non-blocking send, will WARN if missed message.
+	if d.syncBlocksRequestHandler.shouldHandle(syncBlocks.Range.CorrelationId) {
+		select {
+		case d.syncBlocksRequestHandler.channel <- syncBlocks:
+		default:
+			peerLogger.Warningf("Did NOT send SyncBlocks message to channel for range: %d - %d", syncBlocks.Range.Start, syncBlocks.Range.End)
+			d.syncBlocksRequestHandler.reset()
+		}
+	} else {
+		//Ignore the message, does not match the current correlationId
+		peerLogger.Warningf("Ignoring SyncBlocks message with correlationId = %d, blocks %d to %d, as current correlationId = %d", syncBlocks.Range.CorrelationId, syncBlocks.Range.Start, syncBlocks.Range.End, d.syncBlocksRequestHandler.correlationID)
+	}
+}
+
+func (d *Handler) beforeBlockBatch(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	batch, err := unpackBlockBatch(msg)
+	if err != nil {
+		e.Cancel(err)
+		return
+	}
+	d.forwardSyncBlocks(&pb.SyncBlocks{Range: batch.Range, Blocks: batch.Blocks})
+}
+
+func (d *Handler) beforeMessageFragment(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	fragment := &pb.MessageFragment{}
+	if err := proto.Unmarshal(msg.Payload, fragment); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling MessageFragment: %s", err))
+		return
+	}
+	reassembled, err := d.fragments.add(fragment)
+	if err != nil {
+		e.Cancel(err)
+		return
+	}
+	if reassembled == nil {
+		return
+	}
+	// Only the blocks of syncs are sent in fragments
+	batch, err := unpackBlockBatch(reassembled)
+	if err != nil {
+		e.Cancel(fmt.Errorf("Unexpected message in fragments: %s", err))
+		return
+	}
+	d.forwardSyncBlocks(&pb.SyncBlocks{Range: batch.Range, Blocks: batch.Blocks})
+}
+
+// sendBlocks sends the blocks based upon the supplied SyncBlockRange over the stream.
+func (d *Handler) sendBlocks(syncBlockRange *pb.SyncBlockRange) {
+	peerLogger.Debugf("Sending blocks %d-%d", syncBlockRange.Start, syncBlockRange.End)
+	sender := newThrottledSender(fmt.Sprintf("blocks %d-%d", syncBlockRange.Start, syncBlockRange.End), d.SendMessage, syncBlockRange.BandwidthPolicy)
+	sender.pauseWith(d.syncPause)
+	sender.shareWith(d.Coordinator.GetBandwidthFairQueue())
+	defer sender.Close()
+	var blockNums []uint64
+	if syncBlockRange.Start > syncBlockRange.End {
+		// Send in reverse order
+		// note that i is a uint so decrementing i below 0 results in an underflow (i becomes uint.MaxValue). Always stop after i == 0
+		for i := syncBlockRange.Start; i >= syncBlockRange.End && i <= syncBlockRange.Start; i-- {
+			blockNums = append(blockNums, i)
+		}
+	} else {
+		//
+		for i := syncBlockRange.Start; i <= syncBlockRange.End; i++ {
+			peerLogger.Debugf("Appending to blockNums: %d", i)
+			blockNums = append(blockNums, i)
+		}
+	}
+	var packer *SyncBlockPacker
+	if d.HasFeature(batchFeature) {
+		packer = d.newSyncBlockPacker(sender.Send, syncBlockRange.CorrelationId)
+		defer func() {
+			if err := packer.Flush(); err != nil {
+				peerLogger.Errorf("Error sending blocks %d-%d: %s", syncBlockRange.Start, syncBlockRange.End, err)
+			}
+		}()
+	}
+	for _, currBlockNum := range blockNums {
+		// Get the Block from
+		block, err := d.Coordinator.GetBlockByNumber(currBlockNum)
+		if err != nil {
+			peerLogger.Errorf("Error sending blockNum %d: %s", currBlockNum, err)
+			break
+		}
+		if packer != nil {
+			if err := packer.Add(currBlockNum, block); err != nil {
+				peerLogger.Errorf("Error sending blockNum %d: %s", currBlockNum, err)
+				break
+			}
+			continue
+		}
+		// Encode a SyncBlocks into the payload
+		syncBlocks := &pb.SyncBlocks{Range: &pb.SyncBlockRange{Start: currBlockNum, End: currBlockNum, CorrelationId: syncBlockRange.CorrelationId}, Blocks: []*pb.Block{block}}
+		syncBlocksBytes, err := proto.Marshal(syncBlocks)
+		if err != nil {
+			peerLogger.Errorf("Error marshalling syncBlocks for BlockNum = %d: %s", currBlockNum, err)
+			break
+		}
+		if err := sender.Send(&pb.Message{Type: pb.Message_SYNC_BLOCKS, Payload: syncBlocksBytes}); err != nil {
+			peerLogger.Errorf("Error sending blockNum %d: %s", currBlockNum, err)
+			break
+		}
+	}
+}
+
+func (d *Handler) beforeSyncPause(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	abortAt := d.syncPause.pause(time.Now())
+	peerLogger.Debugf("Pausing the syncs served on this Chat until %s", abortAt)
+	data, err := proto.Marshal(newSyncPaused(abortAt))
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error marshalling SyncPaused: %s", err))
+		return
+	}
+	if err := d.reply(msg, &pb.Message{Type: pb.Message_CHAIN_SYNC_PAUSED, Payload: data}); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeSyncPaused(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	paused := &pb.SyncPaused{}
+	if err := proto.Unmarshal(msg.Payload, paused); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling SyncPaused: %s", err))
+		return
+	}
+	d.syncSession.confirmed(syncPausedAbortAt(paused))
+}
+
+func (d *Handler) beforeSyncResume(e *fsm.Event) {
+	peerLogger.Debug("Resuming the syncs served on this Chat")
+	d.syncPause.resume()
+}
+
+// ----------------------------------------------------------------------------
+//
+//  State sync Snapshot functionality
+//
+//
+// ----------------------------------------------------------------------------
+
+// RequestStateSnapshot request the state snapshot deltas from the other PeerEndpoint, will provide them through the returned channel.
+// this will also stop writing any received syncStateSnapshot(s) to channels created from Prior calls to RequestStateSnapshot()
+func (d *Handler) RequestStateSnapshot() (<-chan *pb.SyncStateSnapshot, error) {
+	d.snapshotRequestHandler.Lock()
+	defer d.snapshotRequestHandler.Unlock()
+	// Reset the handler
+	d.snapshotRequestHandler.reset()
+
+	// Create the syncStateSnapshotRequest
+	syncStateSnapshotRequest := d.snapshotRequestHandler.createRequest()
+	syncStateSnapshotRequestBytes, err := proto.Marshal(syncStateSnapshotRequest)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshaling syncStateSnapshotRequest during GetStateSnapshot: %s", err)
+	}
+	peerLogger.Debugf("Sending %s with syncStateSnapshotRequest = %s", pb.Message_SYNC_STATE_GET_SNAPSHOT.String(), syncStateSnapshotRequest)
+	if err := d.SendMessage(&pb.Message{Type: pb.Message_SYNC_STATE_GET_SNAPSHOT, Payload: syncStateSnapshotRequestBytes}); err != nil {
+		return nil, fmt.Errorf("Error sending %s during GetStateSnapshot: %s", pb.Message_SYNC_STATE_GET_SNAPSHOT, err)
+	}
+
+	return d.snapshotRequestHandler.channel, nil
+}
+
+// beforeSyncStateGetSnapshot triggers the sending of State Snapshot deltas to remote Peer.
+func (d *Handler) beforeSyncStateGetSnapshot(e *fsm.Event) {
+	peerLogger.Debugf("Received message: %s", e.Event)
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	// Unmarshall the sync State snapshot request
+	syncStateSnapshotRequest := &pb.SyncStateSnapshotRequest{}
+	err := proto.Unmarshal(msg.Payload, syncStateSnapshotRequest)
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling SyncStateSnapshotRequest in beforeSyncStateGetSnapshot: %s", err))
+		return
+	}
+
+	// Start a separate go FUNC to send the State snapshot
+	go d.sendStateSnapshot(syncStateSnapshotRequest)
+}
+
+// beforeSyncStateSnapshot will write the State Snapshot deltas to the respective channel.
+func (d *Handler) beforeSyncStateSnapshot(e *fsm.Event) {
+	peerLogger.Debugf("Received message: %s", e.Event)
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	// Forward the received syncStateSnapshot to the channel
+	syncStateSnapshot := &pb.SyncStateSnapshot{}
+	err := proto.Unmarshal(msg.Payload, syncStateSnapshot)
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling syncStateSnapshot in beforeSyncStateSnapshot: %s", err))
+		return
+	}
+
+	// Send the message onto the channel, allow for the fact that channel may be closed on send attempt.
+	defer func() {
+		if x := recover(); x != nil {
+			peerLogger.Errorf("Error sending syncStateSnapshot to channel: %v", x)
+		}
+	}()
+	// Use non-blocking send, will WARN and close channel if missed message.
+	d.snapshotRequestHandler.Lock()
+	defer d.snapshotRequestHandler.Unlock()
+	// Make sure the correlationID matches
+	if d.snapshotRequestHandler.shouldHandle(syncStateSnapshot.Request.CorrelationId) {
+		select {
+		case d.snapshotRequestHandler.channel <- syncStateSnapshot:
+		default:
+			// Was not able to write to the channel, in which case the Snapshot stream is incomplete, and must be discarded, closing the channel
+			// without sending the terminating message which would have had an empty byte slice.
+			peerLogger.Warningf("Did NOT send SyncStateSnapshot message to channel for correlationId = %d, sequence = %d, closing channel as the message has been discarded", syncStateSnapshot.Request.CorrelationId, syncStateSnapshot.Sequence)
+			d.snapshotRequestHandler.reset()
+		}
+	} else {
+		//Ignore the message, does not match the current correlationId
+		peerLogger.Warningf("Ignoring SyncStateSnapshot message with correlationId = %d, sequence = %d, as current correlationId = %d", syncStateSnapshot.Request.CorrelationId, syncStateSnapshot.Sequence, d.snapshotRequestHandler.correlationID)
+	}
+}
+
+// sendBlocks sends the blocks based upon the supplied SyncBlockRange over the stream.
+func (d *Handler) sendStateSnapshot(syncStateSnapshotRequest *pb.SyncStateSnapshotRequest) {
+	peerLogger.Debugf("Sending state snapshot with correlationId = %d", syncStateSnapshotRequest.CorrelationId)
+
+	snapshot, err := d.Coordinator.GetStateSnapshot()
+	if err != nil {
+		peerLogger.Errorf("Error getting snapshot: %s", err)
+		return
+	}
+	defer snapshot.Release()
+	sender := newThrottledSender(fmt.Sprintf("snapshot %d", syncStateSnapshotRequest.CorrelationId), d.SendMessage, syncStateSnapshotRequest.BandwidthPolicy)
+	sender.pauseWith(d.syncPause)
+	sender.shareWith(d.Coordinator.GetBandwidthFairQueue())
+	defer sender.Close()
+
+	// Iterate over the state deltas and send to requestor
+	currBlockNumber := snapshot.GetBlockNumber()
+	var sequence uint64
+	// Loop through and send the Deltas
+	for i := 0; snapshot.Next(); i++ {
+		delta := statemgmt.NewStateDelta()
+		k, v := snapshot.GetRawKeyValue()
+		cID, kID := statemgmt.DecodeCompositeKey(k)
+		delta.Set(cID, kID, v, nil)
+
+		deltaAsBytes := delta.Marshal()
+		// Encode a SyncStateSnapsot into the payload
+		sequence = uint64(i)
+		syncStateSnapshot := &pb.SyncStateSnapshot{Delta: deltaAsBytes, Sequence: sequence, BlockNumber: currBlockNumber, Request: syncStateSnapshotRequest}
+
+		syncStateSnapshotBytes, err := proto.Marshal(syncStateSnapshot)
+		if err != nil {
+			peerLogger.Errorf("Error marshalling syncStateSnapsot for BlockNum = %d: %s", currBlockNumber, err)
+			break
+		}
+		if err := sender.Send(&pb.Message{Type: pb.Message_SYNC_STATE_SNAPSHOT, Payload: syncStateSnapshotBytes}); err != nil {
+			peerLogger.Errorf("Error sending syncStateSnapsot for BlockNum = %d: %s", currBlockNumber, err)
+			break
+		}
+	}
+
+	// Now send the terminating message
+	syncStateSnapshot := &pb.SyncStateSnapshot{Delta: []byte{}, Sequence: sequence + 1, BlockNumber: currBlockNumber, Request: syncStateSnapshotRequest}
+	syncStateSnapshotBytes, err := proto.Marshal(syncStateSnapshot)
+	if err != nil {
+		peerLogger.Errorf("Error marshalling terminating syncStateSnapsot message for correlationId = %d, BlockNum = %d: %s", syncStateSnapshotRequest.CorrelationId, currBlockNumber, err)
+		return
+	}
+	if err := sender.Send(&pb.Message{Type: pb.Message_SYNC_STATE_SNAPSHOT, Payload: syncStateSnapshotBytes}); err != nil {
+		peerLogger.Errorf("Error sending terminating syncStateSnapsot for correlationId = %d, BlockNum = %d: %s", syncStateSnapshotRequest.CorrelationId, currBlockNumber, err)
+		return
+	}
+
+}
+
+// ----------------------------------------------------------------------------
+//
+//  State sync Deltas functionality
+//
+//
+// ----------------------------------------------------------------------------
+
+// RequestStateDeltas get the state snapshot deltas from the other PeerEndpoint, will provide them through the returned channel.
+// this will also stop writing any received syncStateSnapshot(s) to channels created from Prior calls to GetStateSnapshot()
+func (d *Handler) RequestStateDeltas(syncBlockRange *pb.SyncBlockRange) (<-chan *pb.SyncStateDeltas, error) {
+	d.syncStateDeltasRequestHandler.Lock()
+	defer d.syncStateDeltasRequestHandler.Unlock()
+	// Reset the handler
+	d.syncStateDeltasRequestHandler.reset()
+	syncBlockRange.CorrelationId = d.syncStateDeltasRequestHandler.correlationID
+	if syncBlockRange.BandwidthPolicy == pb.SyncBandwidthPolicy_NORMAL {
+		syncBlockRange.BandwidthPolicy = requestedSyncBandwidthPolicy()
+	}
+
+	// Create the syncStateSnapshotRequest
+	syncStateDeltasRequest := d.syncStateDeltasRequestHandler.createRequest(syncBlockRange)
+	syncStateDeltasRequestBytes, err := proto.Marshal(syncStateDeltasRequest)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshaling syncStateDeltasRequest during RequestStateDeltas: %s", err)
+	}
+	peerLogger.Debugf("Sending %s with syncStateDeltasRequest = %s", pb.Message_SYNC_STATE_GET_DELTAS.String(), syncStateDeltasRequest)
+	if err := d.SendMessage(&pb.Message{Type: pb.Message_SYNC_STATE_GET_DELTAS, Payload: syncStateDeltasRequestBytes}); err != nil {
+		return nil, fmt.Errorf("Error sending %s during RequestStateDeltas: %s", pb.Message_SYNC_STATE_GET_DELTAS, err)
+	}
+
+	return d.syncStateDeltasRequestHandler.channel, nil
+}
+
+// beforeSyncStateGetDeltas triggers the sending of Get SyncStateDeltas to remote Peer.
+func (d *Handler) beforeSyncStateGetDeltas(e *fsm.Event) {
+	peerLogger.Debugf("Received message: %s", e.Event)
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	// Unmarshall the sync State deltas request
+	syncStateDeltasRequest := &pb.SyncStateDeltasRequest{}
+	err := proto.Unmarshal(msg.Payload, syncStateDeltasRequest)
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling SyncStateDeltasRequest in beforeSyncStateGetDeltas: %s", err))
+		return
+	}
+
+	// Start a separate go FUNC to send the State Deltas
+	go d.sendStateDeltas(syncStateDeltasRequest)
+}
+
+// sendBlocks sends the blocks based upon the supplied SyncBlockRange over the stream.
+func (d *Handler) sendStateDeltas(syncStateDeltasRequest *pb.SyncStateDeltasRequest) {
+	peerLogger.Debugf("Sending state deltas for block range %d-%d", syncStateDeltasRequest.Range.Start, syncStateDeltasRequest.Range.End)
+	var blockNums []uint64
+	syncBlockRange := syncStateDeltasRequest.Range
+	sender := newThrottledSender(fmt.Sprintf("state deltas %d-%d", syncBlockRange.Start, syncBlockRange.End), d.SendMessage, syncBlockRange.BandwidthPolicy)
+	sender.pauseWith(d.syncPause)
+	sender.shareWith(d.Coordinator.GetBandwidthFairQueue())
+	defer sender.Close()
+	if syncBlockRange.Start > syncBlockRange.End {
+		// Send in reverse order
+		for i := syncBlockRange.Start; i >= syncBlockRange.End; i-- {
+			blockNums = append(blockNums, i)
 		}
 	} else {
 		//
@@ -403,297 +2387,551 @@ func (d *Handler) sendBlocks(syncBlockRange *pb.SyncBlockRange) {
 		}
 	}
 	for _, currBlockNum := range blockNums {
-		// Get the Block from
-		block, err := d.Coordinator.GetBlockByNumber(currBlockNum)
+		// Get the state deltas for Block from coordinator
+		stateDelta, err := d.Coordinator.GetStateDelta(currBlockNum)
 		if err != nil {
-			peerLogger.Errorf("Error sending blockNum %d: %s", currBlockNum, err)
+			peerLogger.Errorf("Error sending stateDelta for blockNum %d: %s", currBlockNum, err)
 			break
 		}
-		// Encode a SyncBlocks into the payload
-		syncBlocks := &pb.SyncBlocks{Range: &pb.SyncBlockRange{Start: currBlockNum, End: currBlockNum, CorrelationId: syncBlockRange.CorrelationId}, Blocks: []*pb.Block{block}}
-		syncBlocksBytes, err := proto.Marshal(syncBlocks)
+		if stateDelta == nil {
+			peerLogger.Warningf("Requested to send a stateDelta for blockNum %d which has been discarded", currBlockNum)
+			break
+		}
+		// Encode a SyncStateDeltas into the payload
+		stateDeltaBytes := stateDelta.Marshal()
+		syncStateDeltas := &pb.SyncStateDeltas{Range: &pb.SyncBlockRange{Start: currBlockNum, End: currBlockNum, CorrelationId: syncBlockRange.CorrelationId}, Deltas: [][]byte{stateDeltaBytes}}
+		syncStateDeltasBytes, err := proto.Marshal(syncStateDeltas)
 		if err != nil {
-			peerLogger.Errorf("Error marshalling syncBlocks for BlockNum = %d: %s", currBlockNum, err)
+			peerLogger.Errorf("Error marshalling syncStateDeltas for BlockNum = %d: %s", currBlockNum, err)
 			break
 		}
-		if err := d.SendMessage(&pb.Message{Type: pb.Message_SYNC_BLOCKS, Payload: syncBlocksBytes}); err != nil {
-			peerLogger.Errorf("Error sending blockNum %d: %s", currBlockNum, err)
+		if err := sender.Send(&pb.Message{Type: pb.Message_SYNC_STATE_DELTAS, Payload: syncStateDeltasBytes}); err != nil {
+			peerLogger.Errorf("Error sending stateDeltas for blockNum %d: %s", currBlockNum, err)
 			break
 		}
 	}
 }
 
-// ----------------------------------------------------------------------------
-//
-//  State sync Snapshot functionality
-//
-//
-// ----------------------------------------------------------------------------
+func (d *Handler) beforeSyncStateDeltas(e *fsm.Event) {
+	peerLogger.Debugf("Received message: %s", e.Event)
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	// Forward the received SyncStateDeltas to the channel
+	syncStateDeltas := &pb.SyncStateDeltas{}
+	err := proto.Unmarshal(msg.Payload, syncStateDeltas)
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling SyncStateDeltas in beforeSyncStateDeltas: %s", err))
+		return
+	}
+	peerLogger.Debugf("Sending state delta onto channel for start = %d and end = %d", syncStateDeltas.Range.Start, syncStateDeltas.Range.End)
 
-// RequestStateSnapshot request the state snapshot deltas from the other PeerEndpoint, will provide them through the returned channel.
-// this will also stop writing any received syncStateSnapshot(s) to channels created from Prior calls to RequestStateSnapshot()
-func (d *Handler) RequestStateSnapshot() (<-chan *pb.SyncStateSnapshot, error) {
-	d.snapshotRequestHandler.Lock()
-	defer d.snapshotRequestHandler.Unlock()
-	// Reset the handler
-	d.snapshotRequestHandler.reset()
+	// Send the message onto the channel, allow for the fact that channel may be closed on send attempt.
+	defer func() {
+		if x := recover(); x != nil {
+			peerLogger.Errorf("Error sending syncStateDeltas to channel: %v", x)
+		}
+	}()
 
-	// Create the syncStateSnapshotRequest
-	syncStateSnapshotRequest := d.snapshotRequestHandler.createRequest()
-	syncStateSnapshotRequestBytes, err := proto.Marshal(syncStateSnapshotRequest)
+	// Use non-blocking send, will WARN and close channel if missed message.
+	d.syncStateDeltasRequestHandler.Lock()
+	defer d.syncStateDeltasRequestHandler.Unlock()
+	if d.syncStateDeltasRequestHandler.shouldHandle(syncStateDeltas.Range.CorrelationId) {
+		select {
+		case d.syncStateDeltasRequestHandler.channel <- syncStateDeltas:
+		default:
+			// Was not able to write to the channel, in which case the SyncStateDeltasRequest stream is incomplete, and must be discarded, closing the channel
+			peerLogger.Warningf("Did NOT send SyncStateDeltas message to channel for block range %d-%d, closing channel as the message has been discarded", syncStateDeltas.Range.Start, syncStateDeltas.Range.End)
+			d.syncStateDeltasRequestHandler.reset()
+		}
+	} else {
+		//Ignore the message, does not match the current correlationId
+		peerLogger.Warningf("Ignoring SyncStateDeltas message with correlationId = %d, blocks %d to %d, as current correlationId = %d", syncStateDeltas.Range.CorrelationId, syncStateDeltas.Range.Start, syncStateDeltas.Range.End, d.syncStateDeltasRequestHandler.correlationID)
+	}
+
+}
+
+func (d *Handler) beforeGetBlockHeader(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.GetBlockHeader{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling GetBlockHeader: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for block %d", e.Event, request.BlockNumber)
+	reply := &pb.Message{Type: pb.Message_CHAIN_BLOCK_HEADER}
+	header, err := d.Coordinator.GetBlockHeader(request.BlockNumber)
+	if err == nil {
+		reply.Payload, err = proto.Marshal(header)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("Error marshaling syncStateSnapshotRequest during GetStateSnapshot: %s", err)
+		peerLogger.Debugf("Unable to get header of block %d: %s", request.BlockNumber, err)
+		reply.Type = pb.Message_RESPONSE
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
+		}
 	}
-	peerLogger.Debugf("Sending %s with syncStateSnapshotRequest = %s", pb.Message_SYNC_STATE_GET_SNAPSHOT.String(), syncStateSnapshotRequest)
-	if err := d.SendMessage(&pb.Message{Type: pb.Message_SYNC_STATE_GET_SNAPSHOT, Payload: syncStateSnapshotRequestBytes}); err != nil {
-		return nil, fmt.Errorf("Error sending %s during GetStateSnapshot: %s", pb.Message_SYNC_STATE_GET_SNAPSHOT, err)
+	if err := d.reply(msg, reply); err != nil {
+		e.Cancel(err)
 	}
+}
 
-	return d.snapshotRequestHandler.channel, nil
+func (d *Handler) beforeGetBlockBody(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.GetBlockBody{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling GetBlockBody: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for block %d", e.Event, request.BlockNumber)
+	reply := &pb.Message{Type: pb.Message_CHAIN_BLOCK_BODY}
+	body, err := d.Coordinator.GetBlockBody(request.BlockNumber)
+	if err == nil {
+		reply.Payload, err = proto.Marshal(body)
+	}
+	if err != nil {
+		peerLogger.Debugf("Unable to get body of block %d: %s", request.BlockNumber, err)
+		reply.Type = pb.Message_RESPONSE
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
+		}
+	}
+	if err := d.reply(msg, reply); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeGetBlockProof(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.GetBlockProof{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling GetBlockProof: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for block %d to be anchored into %s", e.Event, request.BlockNumber, request.ExternalChainID)
+	reply := &pb.Message{Type: pb.Message_CHAIN_BLOCK_PROOF}
+	proof, err := d.Coordinator.GetSPVProof(request.BlockNumber, request.ExternalChainID)
+	if err == nil {
+		reply.Payload, err = proto.Marshal(&pb.BlockProof{BlockNumber: request.BlockNumber, Proof: proof})
+	}
+	if err != nil {
+		peerLogger.Debugf("Unable to get proof of block %d: %s", request.BlockNumber, err)
+		reply.Type = pb.Message_RESPONSE
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
+		}
+	}
+	if err := d.reply(msg, reply); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeQueryRange(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	query := &pb.BlockRangeQuery{}
+	if err := proto.Unmarshal(msg.Payload, query); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling BlockRangeQuery: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for blocks %d to %d", e.Event, query.FromBlock, query.ToBlock)
+	send := func(reply *pb.Message) error { return d.reply(msg, reply) }
+	if err := sendBlockRange(d.Coordinator, send, query, blockRangeLimit()); err != nil {
+		e.Cancel(err)
+	}
+}
+
+// beforeChainSyncRequest answers a CHAIN_SYNC_REQUEST with the blocks of the
+// range filtered by the transaction types of the request
+func (d *Handler) beforeChainSyncRequest(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.ChainSyncRequest{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling ChainSyncRequest: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for blocks %d to %d with transactions of types %v", e.Event, request.FromBlock, request.ToBlock, request.TxTypeFilter)
+	if err := validateTxTypeFilter(request.TxTypeFilter); err != nil {
+		reply := &pb.Message{Type: pb.Message_RESPONSE}
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
+		}
+		if err := d.reply(msg, reply); err != nil {
+			e.Cancel(err)
+		}
+		return
+	}
+	send := func(reply *pb.Message) error { return d.reply(msg, reply) }
+	if err := sendChainSync(d.Coordinator, send, request, blockRangeLimit()); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeGetBlockHashes(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.BlockHashesRequest{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling BlockHashesRequest: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for blocks %d to %d", e.Event, request.FromBlock, request.ToBlock)
+	hashes, err := blockHashList(d.Coordinator, request)
+	if err != nil {
+		e.Cancel(err)
+		return
+	}
+	data, err := proto.Marshal(hashes)
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error marshalling BlockHashList: %s", err))
+		return
+	}
+	if err := d.reply(msg, &pb.Message{Type: pb.Message_SYNC_BLOCK_HASHES, Payload: data}); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeSyncVerifyRequest(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.SyncVerifyRequest{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling SyncVerifyRequest: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for blocks %d to %d", e.Event, request.FromBlock, request.ToBlock)
+	response, err := syncRangeRoot(d.Coordinator, request.FromBlock, request.ToBlock)
+	if err != nil {
+		e.Cancel(err)
+		return
+	}
+	data, err := proto.Marshal(response)
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error marshalling SyncVerifyResponse: %s", err))
+		return
+	}
+	if err := d.reply(msg, &pb.Message{Type: pb.Message_CHAIN_SYNC_VERIFY_RESPONSE, Payload: data}); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeGetBlocksByNumber(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.BlockNumbers{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling BlockNumbers: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s for %d blocks", e.Event, len(request.BlockNumbers))
+	send := func(reply *pb.Message) error { return d.reply(msg, reply) }
+	if err := sendBlocksByNumber(d.Coordinator, send, request.BlockNumbers, blockRangeLimit()); err != nil {
+		e.Cancel(err)
+	}
 }
 
-// beforeSyncStateGetSnapshot triggers the sending of State Snapshot deltas to remote Peer.
-func (d *Handler) beforeSyncStateGetSnapshot(e *fsm.Event) {
-	peerLogger.Debugf("Received message: %s", e.Event)
+func (d *Handler) beforeGetStateRoot(e *fsm.Event) {
 	msg, ok := e.Args[0].(*pb.Message)
 	if !ok {
 		e.Cancel(fmt.Errorf("Received unexpected message type"))
 		return
 	}
-	// Unmarshall the sync State snapshot request
-	syncStateSnapshotRequest := &pb.SyncStateSnapshotRequest{}
-	err := proto.Unmarshal(msg.Payload, syncStateSnapshotRequest)
-	if err != nil {
-		e.Cancel(fmt.Errorf("Error unmarshalling SyncStateSnapshotRequest in beforeSyncStateGetSnapshot: %s", err))
+	request := &pb.GetStateRoot{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling GetStateRoot: %s", err))
 		return
 	}
-
-	// Start a separate go FUNC to send the State snapshot
-	go d.sendStateSnapshot(syncStateSnapshotRequest)
+	peerLogger.Debugf("Received %s for block %d", e.Event, request.BlockNumber)
+	reply := &pb.Message{Type: pb.Message_CHAIN_STATE_ROOT}
+	root, err := d.Coordinator.GetStateRoot(request.BlockNumber)
+	if err == nil {
+		reply.Payload, err = proto.Marshal(&pb.StateRoot{BlockNumber: request.BlockNumber, Root: root})
+	}
+	if err != nil {
+		peerLogger.Debugf("Unable to get state root of block %d: %s", request.BlockNumber, err)
+		reply.Type = pb.Message_RESPONSE
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
+		}
+	}
+	if err := d.reply(msg, reply); err != nil {
+		e.Cancel(err)
+	}
 }
 
-// beforeSyncStateSnapshot will write the State Snapshot deltas to the respective channel.
-func (d *Handler) beforeSyncStateSnapshot(e *fsm.Event) {
-	peerLogger.Debugf("Received message: %s", e.Event)
+func (d *Handler) beforeTransactionProofRequest(e *fsm.Event) {
 	msg, ok := e.Args[0].(*pb.Message)
 	if !ok {
 		e.Cancel(fmt.Errorf("Received unexpected message type"))
 		return
 	}
-	// Forward the received syncStateSnapshot to the channel
-	syncStateSnapshot := &pb.SyncStateSnapshot{}
-	err := proto.Unmarshal(msg.Payload, syncStateSnapshot)
-	if err != nil {
-		e.Cancel(fmt.Errorf("Error unmarshalling syncStateSnapshot in beforeSyncStateSnapshot: %s", err))
+	request := &pb.TransactionProofRequest{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling TransactionProofRequest: %s", err))
 		return
 	}
-
-	// Send the message onto the channel, allow for the fact that channel may be closed on send attempt.
-	defer func() {
-		if x := recover(); x != nil {
-			peerLogger.Errorf("Error sending syncStateSnapshot to channel: %v", x)
-		}
-	}()
-	// Use non-blocking send, will WARN and close channel if missed message.
-	d.snapshotRequestHandler.Lock()
-	defer d.snapshotRequestHandler.Unlock()
-	// Make sure the correlationID matches
-	if d.snapshotRequestHandler.shouldHandle(syncStateSnapshot.Request.CorrelationId) {
-		select {
-		case d.snapshotRequestHandler.channel <- syncStateSnapshot:
-		default:
-			// Was not able to write to the channel, in which case the Snapshot stream is incomplete, and must be discarded, closing the channel
-			// without sending the terminating message which would have had an empty byte slice.
-			peerLogger.Warningf("Did NOT send SyncStateSnapshot message to channel for correlationId = %d, sequence = %d, closing channel as the message has been discarded", syncStateSnapshot.Request.CorrelationId, syncStateSnapshot.Sequence)
-			d.snapshotRequestHandler.reset()
+	peerLogger.Debugf("Received %s for transaction %s in block %d", e.Event, request.TxID, request.BlockNumber)
+	reply := &pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS_PROOF_RESPONSE}
+	proof, err := d.Coordinator.GetTransactionProof(request.TxID, request.BlockNumber)
+	if err == nil {
+		reply.Payload, err = proto.Marshal(proof)
+	}
+	if err != nil {
+		peerLogger.Debugf("Unable to prove inclusion of transaction %s: %s", request.TxID, err)
+		reply.Type = pb.Message_RESPONSE
+		if reply.Payload, err = proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}); err != nil {
+			e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
+			return
 		}
-	} else {
-		//Ignore the message, does not match the current correlationId
-		peerLogger.Warningf("Ignoring SyncStateSnapshot message with correlationId = %d, sequence = %d, as current correlationId = %d", syncStateSnapshot.Request.CorrelationId, syncStateSnapshot.Sequence, d.snapshotRequestHandler.correlationID)
+	}
+	if err := d.reply(msg, reply); err != nil {
+		e.Cancel(err)
 	}
 }
 
-// sendBlocks sends the blocks based upon the supplied SyncBlockRange over the stream.
-func (d *Handler) sendStateSnapshot(syncStateSnapshotRequest *pb.SyncStateSnapshotRequest) {
-	peerLogger.Debugf("Sending state snapshot with correlationId = %d", syncStateSnapshotRequest.CorrelationId)
-
-	snapshot, err := d.Coordinator.GetStateSnapshot()
-	if err != nil {
-		peerLogger.Errorf("Error getting snapshot: %s", err)
+func (d *Handler) beforeEncryptedTransaction(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
 		return
 	}
-	defer snapshot.Release()
-
-	// Iterate over the state deltas and send to requestor
-	currBlockNumber := snapshot.GetBlockNumber()
-	var sequence uint64
-	// Loop through and send the Deltas
-	for i := 0; snapshot.Next(); i++ {
-		delta := statemgmt.NewStateDelta()
-		k, v := snapshot.GetRawKeyValue()
-		cID, kID := statemgmt.DecodeCompositeKey(k)
-		delta.Set(cID, kID, v, nil)
-
-		deltaAsBytes := delta.Marshal()
-		// Encode a SyncStateSnapsot into the payload
-		sequence = uint64(i)
-		syncStateSnapshot := &pb.SyncStateSnapshot{Delta: deltaAsBytes, Sequence: sequence, BlockNumber: currBlockNumber, Request: syncStateSnapshotRequest}
-
-		syncStateSnapshotBytes, err := proto.Marshal(syncStateSnapshot)
-		if err != nil {
-			peerLogger.Errorf("Error marshalling syncStateSnapsot for BlockNum = %d: %s", currBlockNumber, err)
-			break
-		}
-		if err := d.SendMessage(&pb.Message{Type: pb.Message_SYNC_STATE_SNAPSHOT, Payload: syncStateSnapshotBytes}); err != nil {
-			peerLogger.Errorf("Error sending syncStateSnapsot for BlockNum = %d: %s", currBlockNumber, err)
-			break
-		}
+	encrypted := &pb.EncryptedTransaction{}
+	if err := proto.Unmarshal(msg.Payload, encrypted); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling EncryptedTransaction: %s", err))
+		return
 	}
-
-	// Now send the terminating message
-	syncStateSnapshot := &pb.SyncStateSnapshot{Delta: []byte{}, Sequence: sequence + 1, BlockNumber: currBlockNumber, Request: syncStateSnapshotRequest}
-	syncStateSnapshotBytes, err := proto.Marshal(syncStateSnapshot)
+	peerLogger.Debugf("Received %s", e.Event)
+	data, err := proto.Marshal(d.Coordinator.ProcessConfidentialTransaction(encrypted))
 	if err != nil {
-		peerLogger.Errorf("Error marshalling terminating syncStateSnapsot message for correlationId = %d, BlockNum = %d: %s", syncStateSnapshotRequest.CorrelationId, currBlockNumber, err)
+		e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
 		return
 	}
-	if err := d.SendMessage(&pb.Message{Type: pb.Message_SYNC_STATE_SNAPSHOT, Payload: syncStateSnapshotBytes}); err != nil {
-		peerLogger.Errorf("Error sending terminating syncStateSnapsot for correlationId = %d, BlockNum = %d: %s", syncStateSnapshotRequest.CorrelationId, currBlockNumber, err)
-		return
+	if err := d.reply(msg, &pb.Message{Type: pb.Message_RESPONSE, Payload: data}); err != nil {
+		e.Cancel(err)
 	}
-
 }
 
-// ----------------------------------------------------------------------------
-//
-//  State sync Deltas functionality
-//
-//
-// ----------------------------------------------------------------------------
-
-// RequestStateDeltas get the state snapshot deltas from the other PeerEndpoint, will provide them through the returned channel.
-// this will also stop writing any received syncStateSnapshot(s) to channels created from Prior calls to GetStateSnapshot()
-func (d *Handler) RequestStateDeltas(syncBlockRange *pb.SyncBlockRange) (<-chan *pb.SyncStateDeltas, error) {
-	d.syncStateDeltasRequestHandler.Lock()
-	defer d.syncStateDeltasRequestHandler.Unlock()
-	// Reset the handler
-	d.syncStateDeltasRequestHandler.reset()
-	syncBlockRange.CorrelationId = d.syncStateDeltasRequestHandler.correlationID
-
-	// Create the syncStateSnapshotRequest
-	syncStateDeltasRequest := d.syncStateDeltasRequestHandler.createRequest(syncBlockRange)
-	syncStateDeltasRequestBytes, err := proto.Marshal(syncStateDeltasRequest)
-	if err != nil {
-		return nil, fmt.Errorf("Error marshaling syncStateDeltasRequest during RequestStateDeltas: %s", err)
+func (d *Handler) beforeSubscribeBlocks(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
 	}
-	peerLogger.Debugf("Sending %s with syncStateDeltasRequest = %s", pb.Message_SYNC_STATE_GET_DELTAS.String(), syncStateDeltasRequest)
-	if err := d.SendMessage(&pb.Message{Type: pb.Message_SYNC_STATE_GET_DELTAS, Payload: syncStateDeltasRequestBytes}); err != nil {
-		return nil, fmt.Errorf("Error sending %s during RequestStateDeltas: %s", pb.Message_SYNC_STATE_GET_DELTAS, err)
+	subscription := &pb.BlockSubscription{}
+	if err := proto.Unmarshal(msg.Payload, subscription); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling BlockSubscription: %s", err))
+		return
 	}
-
-	return d.syncStateDeltasRequestHandler.channel, nil
+	peerLogger.Debugf("Received %s %s from block %d", e.Event, subscription.SubscriptionID, subscription.FromBlock)
+	d.blockSubscriptions.subscribe(d.Coordinator, d.Coordinator.GetBlockEventBus(), d.SendMessage, subscription)
 }
 
-// beforeSyncStateGetDeltas triggers the sending of Get SyncStateDeltas to remote Peer.
-func (d *Handler) beforeSyncStateGetDeltas(e *fsm.Event) {
-	peerLogger.Debugf("Received message: %s", e.Event)
+func (d *Handler) beforeUnsubscribeBlocks(e *fsm.Event) {
 	msg, ok := e.Args[0].(*pb.Message)
 	if !ok {
 		e.Cancel(fmt.Errorf("Received unexpected message type"))
 		return
 	}
-	// Unmarshall the sync State deltas request
-	syncStateDeltasRequest := &pb.SyncStateDeltasRequest{}
-	err := proto.Unmarshal(msg.Payload, syncStateDeltasRequest)
+	subscription := &pb.BlockSubscription{}
+	if err := proto.Unmarshal(msg.Payload, subscription); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling BlockSubscription: %s", err))
+		return
+	}
+	peerLogger.Debugf("Received %s %s", e.Event, subscription.SubscriptionID)
+	if d.blockSubscriptions.unsubscribe(subscription.SubscriptionID) {
+		return
+	}
+	data, err := proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte(fmt.Sprintf("No block subscription %s", subscription.SubscriptionID))})
 	if err != nil {
-		e.Cancel(fmt.Errorf("Error unmarshalling SyncStateDeltasRequest in beforeSyncStateGetDeltas: %s", err))
+		e.Cancel(fmt.Errorf("Error marshalling Response: %s", err))
 		return
 	}
-
-	// Start a separate go FUNC to send the State Deltas
-	go d.sendStateDeltas(syncStateDeltasRequest)
+	if err := d.reply(msg, &pb.Message{Type: pb.Message_RESPONSE, Payload: data}); err != nil {
+		e.Cancel(err)
+	}
 }
 
-// sendBlocks sends the blocks based upon the supplied SyncBlockRange over the stream.
-func (d *Handler) sendStateDeltas(syncStateDeltasRequest *pb.SyncStateDeltasRequest) {
-	peerLogger.Debugf("Sending state deltas for block range %d-%d", syncStateDeltasRequest.Range.Start, syncStateDeltasRequest.Range.End)
-	var blockNums []uint64
-	syncBlockRange := syncStateDeltasRequest.Range
-	if syncBlockRange.Start > syncBlockRange.End {
-		// Send in reverse order
-		for i := syncBlockRange.Start; i >= syncBlockRange.End; i-- {
-			blockNums = append(blockNums, i)
+func (d *Handler) beforeTransactions(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	if err := ValidateTransactionsMessage(msg, d.EffectiveMaxMessageSize()); err != nil {
+		peerLogger.Warningf("Dropping %s: %s", e.Event, err)
+		d.replyWith(e, msg, pb.Message_RESPONSE, &pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())})
+		return
+	}
+	batch := &pb.TransactionBlock{}
+	if err := proto.Unmarshal(msg.Payload, batch); err != nil {
+		err = fmt.Errorf("Error unmarshalling TransactionBlock: %s", err)
+		peerLogger.Warningf("Dropping %s: %s", e.Event, err)
+		d.replyWith(e, msg, pb.Message_RESPONSE, &pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())})
+		return
+	}
+	peerLogger.Debugf("Received %s with %d transactions", e.Event, len(batch.Transactions))
+	if len(batch.IdempotencyKey) > 0 {
+		if reply := d.Coordinator.GetIdempotencyCache().Lookup(batch.IdempotencyKey); reply != nil {
+			peerLogger.Debugf("Answering %s resent with idempotency key %x as the first time with %s", e.Event, batch.IdempotencyKey, reply.Type)
+			if err := d.reply(msg, reply); err != nil {
+				e.Cancel(err)
+			}
+			return
 		}
-	} else {
-		//
-		for i := syncBlockRange.Start; i <= syncBlockRange.End; i++ {
-			peerLogger.Debugf("Appending to blockNums: %d", i)
-			blockNums = append(blockNums, i)
+	}
+	if versionError := checkSchemaVersion(batch.SchemaVersion); versionError != nil {
+		peerLogger.Warningf("Dropping %s of schema version %d, supported versions are %d to %d", e.Event, batch.SchemaVersion, versionError.SupportedMin, versionError.SupportedMax)
+		d.replyWith(e, msg, pb.Message_CHAIN_TRANSACTIONS_VERSION_ERROR, versionError)
+		return
+	}
+	if viper.GetBool("peer.tx.enforceContentAddressedIDs") {
+		if mismatches := VerifyTransactionIDs(batch); len(mismatches) > 0 {
+			peerLogger.Warningf("Dropping %s with %d transactions whose ID is not the hash of their content", e.Event, len(mismatches))
+			d.replyWith(e, msg, pb.Message_CHAIN_TRANSACTIONS_VALIDATION_ERROR, idMismatchError(mismatches))
+			return
 		}
 	}
-	for _, currBlockNum := range blockNums {
-		// Get the state deltas for Block from coordinator
-		stateDelta, err := d.Coordinator.GetStateDelta(currBlockNum)
-		if err != nil {
-			peerLogger.Errorf("Error sending stateDelta for blockNum %d: %s", currBlockNum, err)
-			break
+	if viper.GetBool("peer.tx.zkProofEnabled") {
+		if validationError := verifyZKProofs(batch, d.Coordinator.GetZKProofVerifier()); validationError != nil {
+			peerLogger.Warningf("Dropping %s with %d transactions failing their zero-knowledge proof", e.Event, len(validationError.Violations))
+			d.replyWith(e, msg, pb.Message_CHAIN_TRANSACTIONS_VALIDATION_ERROR, validationError)
+			return
 		}
-		if stateDelta == nil {
-			peerLogger.Warningf("Requested to send a stateDelta for blockNum %d which has been discarded", currBlockNum)
-			break
+	}
+	var processor TransactionBatchProcessor
+	if batch.ChannelID != "" {
+		if processor, ok = d.Coordinator.GetChannelRouter().Get(batch.ChannelID); !ok {
+			peerLogger.Warningf("Dropping %s for channel %s, known channels are %v", e.Event, batch.ChannelID, d.Coordinator.GetChannelRouter().Channels())
+			d.replyWith(e, msg, pb.Message_CHAIN_TRANSACTIONS_ERROR, &pb.TransactionsError{Reason: unknownChannelReason})
+			return
 		}
-		// Encode a SyncStateDeltas into the payload
-		stateDeltaBytes := stateDelta.Marshal()
-		syncStateDeltas := &pb.SyncStateDeltas{Range: &pb.SyncBlockRange{Start: currBlockNum, End: currBlockNum, CorrelationId: syncBlockRange.CorrelationId}, Deltas: [][]byte{stateDeltaBytes}}
-		syncStateDeltasBytes, err := proto.Marshal(syncStateDeltas)
+	} else if processor, ok = d.Coordinator.GetProcessorRegistry().Get(batch.ExecutionEnv); !ok {
+		peerLogger.Warningf("Dropping %s for execution environment %s, supported environments are %v", e.Event, batch.ExecutionEnv, d.Coordinator.GetProcessorRegistry().Supported())
+		d.replyWith(e, msg, pb.Message_CHAIN_TRANSACTIONS_ERROR, &pb.TransactionsError{Reason: unsupportedExecutionEnvReason})
+		return
+	}
+	if gasError := checkGas(batch, d.Coordinator.GetGasPriceOracle(), getBlockGasLimit()); gasError != nil {
+		peerLogger.Warningf("Dropping %s of gas price %d and gas limit %d: %s", e.Event, batch.GasPrice, batch.GasLimit, gasError.Reason)
+		d.replyWith(e, msg, pb.Message_CHAIN_TRANSACTIONS_ERROR, gasError)
+		return
+	}
+	if err := d.Coordinator.CheckForwardingChain(batch); err != nil {
+		peerLogger.Warningf("Dropping %s relayed through %v: %s", e.Event, batch.Hops, err)
+		d.replyWith(e, msg, pb.Message_CHAIN_TRANSACTIONS_ERROR, brokenForwardingChainError(batch))
+		return
+	}
+	if signatureError := d.Coordinator.GetSignatureAggregator().Aggregate(batch); signatureError != nil {
+		peerLogger.Warningf("Dropping %s: %s of %v", e.Event, signatureError.Reason, signatureError.TxIDs)
+		d.replyWith(e, msg, pb.Message_CHAIN_TRANSACTIONS_ERROR, signatureError)
+		return
+	}
+	d.Coordinator.GetBlockAnnouncer().TransactionsArrived(time.Now())
+	var validationError *pb.TransactionsValidationError
+	var result *BatchResult
+	var err error
+	if isFastPath(batch) {
+		// Processed here in the Chat goroutine, ahead of any queued batch
+		peerLogger.Debugf("Processing %s of priority %d on the fast path", e.Event, batch.Priority)
+		fastPathCounter.Inc()
+		validationError, result, err = processor.ProcessImmediate(batch)
+	} else {
+		validationError, result, err = processor.ProcessTransactionBatch(batch, d.reportBatchProgress(msg))
+	}
+	if err != nil {
+		d.replyWith(e, msg, pb.Message_RESPONSE, &pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())})
+		return
+	}
+	var replyType pb.Message_Type
+	var reply proto.Message
+	if ack := newPartialAck(result, validationError); ack != nil {
+		peerLogger.Warningf("Committed %d transactions of %s, %d failed", len(ack.Committed), e.Event, len(ack.Failed))
+		replyType, reply = pb.Message_CHAIN_TRANSACTIONS_PARTIAL_ACK, ack
+	} else if validationError != nil {
+		replyType, reply = pb.Message_CHAIN_TRANSACTIONS_VALIDATION_ERROR, validationError
+	} else {
+		replyType, reply = pb.Message_RESPONSE, &pb.Response{Status: pb.Response_SUCCESS}
+	}
+	if len(batch.IdempotencyKey) > 0 {
+		if err := d.Coordinator.GetIdempotencyCache().Record(batch.IdempotencyKey, replyType, reply); err != nil {
+			peerLogger.Warningf("Error recording the reply to %s: %s", e.Event, err)
+		}
+	}
+	d.replyWith(e, msg, replyType, reply)
+}
+
+// reportBatchProgress returns the reporter sending the progress of the batch
+// of msg as CHAIN_TRANSACTIONS_PROGRESS
+func (d *Handler) reportBatchProgress(msg *pb.Message) BatchProgressReporter {
+	return func(processed, total int, currentTxID string) {
+		data, err := proto.Marshal(&pb.TransactionsProgress{Processed: uint32(processed), Total: uint32(total), CurrentTxID: currentTxID})
 		if err != nil {
-			peerLogger.Errorf("Error marshalling syncStateDeltas for BlockNum = %d: %s", currBlockNum, err)
-			break
+			peerLogger.Errorf("Error marshalling TransactionsProgress: %s", err)
+			return
 		}
-		if err := d.SendMessage(&pb.Message{Type: pb.Message_SYNC_STATE_DELTAS, Payload: syncStateDeltasBytes}); err != nil {
-			peerLogger.Errorf("Error sending stateDeltas for blockNum %d: %s", currBlockNum, err)
-			break
+		if err := d.reply(msg, &pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS_PROGRESS, Payload: data}); err != nil {
+			peerLogger.Debugf("Error sending %s: %s", pb.Message_CHAIN_TRANSACTIONS_PROGRESS, err)
 		}
 	}
 }
 
-func (d *Handler) beforeSyncStateDeltas(e *fsm.Event) {
-	peerLogger.Debugf("Received message: %s", e.Event)
+func (d *Handler) beforePing(e *fsm.Event) {
 	msg, ok := e.Args[0].(*pb.Message)
 	if !ok {
 		e.Cancel(fmt.Errorf("Received unexpected message type"))
 		return
 	}
-	// Forward the received SyncStateDeltas to the channel
-	syncStateDeltas := &pb.SyncStateDeltas{}
-	err := proto.Unmarshal(msg.Payload, syncStateDeltas)
-	if err != nil {
-		e.Cancel(fmt.Errorf("Error unmarshalling SyncStateDeltas in beforeSyncStateDeltas: %s", err))
-		return
+	if err := d.reply(msg, &pb.Message{Type: pb.Message_DISC_PONG, Payload: msg.Payload}); err != nil {
+		e.Cancel(err)
 	}
-	peerLogger.Debugf("Sending state delta onto channel for start = %d and end = %d", syncStateDeltas.Range.Start, syncStateDeltas.Range.End)
-
-	// Send the message onto the channel, allow for the fact that channel may be closed on send attempt.
-	defer func() {
-		if x := recover(); x != nil {
-			peerLogger.Errorf("Error sending syncStateDeltas to channel: %v", x)
-		}
-	}()
+}
 
-	// Use non-blocking send, will WARN and close channel if missed message.
-	d.syncStateDeltasRequestHandler.Lock()
-	defer d.syncStateDeltasRequestHandler.Unlock()
-	if d.syncStateDeltasRequestHandler.shouldHandle(syncStateDeltas.Range.CorrelationId) {
-		select {
-		case d.syncStateDeltasRequestHandler.channel <- syncStateDeltas:
-		default:
-			// Was not able to write to the channel, in which case the SyncStateDeltasRequest stream is incomplete, and must be discarded, closing the channel
-			peerLogger.Warningf("Did NOT send SyncStateDeltas message to channel for block range %d-%d, closing channel as the message has been discarded", syncStateDeltas.Range.Start, syncStateDeltas.Range.End)
-			d.syncStateDeltasRequestHandler.reset()
-		}
-	} else {
-		//Ignore the message, does not match the current correlationId
-		peerLogger.Warningf("Ignoring SyncStateDeltas message with correlationId = %d, blocks %d to %d, as current correlationId = %d", syncStateDeltas.Range.CorrelationId, syncStateDeltas.Range.Start, syncStateDeltas.Range.End, d.syncStateDeltasRequestHandler.correlationID)
+func (d *Handler) beforePong(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.Message)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
 	}
-
+	rtt, err := pongRTT(msg.Payload)
+	if err != nil {
+		e.Cancel(err)
+		return
+	}
+	peerLogger.Debugf("Received %s from %s after %s", e.Event, d.ToPeerEndpoint.Address, rtt)
+	d.Coordinator.GetPeerRegistry().UpdateRTT(d.ToPeerEndpoint.ID, rtt)
+	d.Coordinator.GetLatencyTracker().Record(d.ToPeerEndpoint.Address, rtt)
 }
@@ -82,7 +82,7 @@ func (srh *syncStateSnapshotRequestHandler) reset() {
 }
 
 func (srh *syncStateSnapshotRequestHandler) createRequest() *pb.SyncStateSnapshotRequest {
-	return &pb.SyncStateSnapshotRequest{CorrelationId: srh.correlationID}
+	return &pb.SyncStateSnapshotRequest{CorrelationId: srh.correlationID, BandwidthPolicy: requestedSyncBandwidthPolicy()}
 }
 
 func newSyncStateSnapshotRequestHandler() *syncStateSnapshotRequestHandler {
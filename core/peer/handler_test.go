@@ -0,0 +1,141 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/looplab/fsm"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// handlerTestCoordinator is the MessageHandlerCoordinator of handlers tested
+// without a peer, any call to it but GetTokenValidator, GetIdempotencyCache
+// and GetChannelRouter panicking
+type handlerTestCoordinator struct {
+	MessageHandlerCoordinator
+	validator   TokenValidator
+	idempotency *IdempotencyCache
+	channels    *ChannelRouter
+}
+
+func (c handlerTestCoordinator) GetTokenValidator() TokenValidator {
+	return c.validator
+}
+
+func (c handlerTestCoordinator) GetIdempotencyCache() *IdempotencyCache {
+	return c.idempotency
+}
+
+func (c handlerTestCoordinator) GetChannelRouter() *ChannelRouter {
+	return c.channels
+}
+
+func newTestHandler(t *testing.T) *Handler {
+	return newTestHandlerWithCoordinator(t, handlerTestCoordinator{})
+}
+
+func newTestHandlerWithCoordinator(t *testing.T, coord MessageHandlerCoordinator) *Handler {
+	handler, err := NewPeerHandler(coord, &handshakeStream{recv: make(chan *pb.Message), sent: make(chan *pb.Message, 1)}, false, nil)
+	if err != nil {
+		t.Fatalf("Error creating handler: %s", err)
+	}
+	return handler.(*Handler)
+}
+
+func TestHandlerRefusesBeforeHello(t *testing.T) {
+	for _, msgType := range []pb.Message_Type{
+		pb.Message_CHAIN_TRANSACTIONS,
+		pb.Message_CHAIN_TRANSACTIONS_ENCRYPTED,
+		pb.Message_CHAIN_SUBSCRIBE_BLOCKS,
+		pb.Message_CHAIN_UNSUBSCRIBE_BLOCKS,
+		pb.Message_CHAIN_ROLLBACK_REQUEST,
+		pb.Message_CHAIN_QUERY_CONTRACT_STATE,
+		pb.Message_CHAIN_REPORT_UNCLE,
+		pb.Message_CHAIN_TRANSACTIONS_QUERY_STATUS,
+		pb.Message_CHAIN_TRANSACTIONS_GET_RECEIPT,
+		pb.Message_DISC_BANDWIDTH_TEST,
+		pb.Message_CHAIN_QUERY_TX,
+		pb.Message_CHAIN_QUERY_TX_HISTORY,
+		pb.Message_CHAIN_QUERY_MEMPOOL,
+		pb.Message_CHAIN_QUERY_ACCOUNT,
+		pb.Message_CHAIN_GET_BLOCK_HEADER,
+		pb.Message_CHAIN_TRANSACTIONS_PROOF_REQUEST,
+		pb.Message_CHAIN_VALIDATE_BLOCK,
+		pb.Message_DISC_QUORUM_GET_PEERS,
+		pb.Message_SYNC_GET_BLOCK_HASHES,
+		pb.Message_SYNC_GET_BLOCKS_BY_NUMBER,
+		pb.Message_CHAIN_SYNC_REQUEST,
+		pb.Message_CHAIN_SYNC_VERIFY_REQUEST,
+		pb.Message_DISC_GET_TOPOLOGY,
+		pb.Message_DISC_GET_PEERS_DIVERSE,
+	} {
+		handler := newTestHandler(t)
+		if err := handler.HandleMessage(&pb.Message{Type: msgType}); err == nil {
+			t.Errorf("Expected %s to be refused before the DISC_HELLO exchange", msgType)
+		}
+		if state := handler.FSM.Current(); state != "created" {
+			t.Errorf("Expected the handler to stay created after %s, got %s", msgType, state)
+		}
+	}
+}
+
+func TestHandlerRefusesBeforeAuthToken(t *testing.T) {
+	handler := newTestHandlerWithCoordinator(t, handlerTestCoordinator{validator: NewJWTTokenValidator([]byte("secret"))})
+	for _, msgType := range []pb.Message_Type{
+		pb.Message_CHAIN_QUERY_TX,
+		pb.Message_CHAIN_GET_BLOCK_BY_HASH,
+		pb.Message_DISC_GET_TOPOLOGY,
+	} {
+		if err := handler.HandleMessage(&pb.Message{Type: msgType}); err == nil {
+			t.Errorf("Expected %s to be refused before the auth token of the DISC_HELLO is validated", msgType)
+		}
+	}
+}
+
+func TestHandlerRefusesBeforeHelloChallenge(t *testing.T) {
+	defer viper.Set("peer.auth.sharedSecret", []string{})
+	viper.Set("peer.auth.sharedSecret", []string{"secret"})
+	handler := newTestHandler(t)
+	for _, msgType := range []pb.Message_Type{
+		pb.Message_CHAIN_QUERY_TX,
+		pb.Message_CHAIN_GET_BLOCK_BY_HASH,
+		pb.Message_DISC_GET_TOPOLOGY,
+	} {
+		if err := handler.HandleMessage(&pb.Message{Type: msgType}); err == nil {
+			t.Errorf("Expected %s to be refused before the hello challenge is answered", msgType)
+		}
+	}
+}
+
+func TestHandlerRepliesToMalformedTransactions(t *testing.T) {
+	handler := newTestHandler(t)
+	msg := &pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS, Payload: []byte{0xff}, CorrelationID: "7"}
+	e := &fsm.Event{FSM: handler.FSM, Event: msg.Type.String(), Args: []interface{}{msg}}
+	handler.beforeTransactions(e)
+	if e.Err != nil {
+		t.Errorf("Expected the malformed CHAIN_TRANSACTIONS to be answered, got %s", e.Err)
+	}
+	reply := <-handler.ChatStream.(*handshakeStream).sent
+	response := &pb.Response{}
+	if err := proto.Unmarshal(reply.Payload, response); err != nil || reply.Type != pb.Message_RESPONSE || response.Status != pb.Response_FAILURE || reply.CorrelationID != "7" {
+		t.Errorf("Expected a RESPONSE FAILURE to the malformed batch, got %v, %v", reply, response)
+	}
+}
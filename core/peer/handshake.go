@@ -0,0 +1,137 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// HandshakePolicy controls how often, and how far apart, a DISC_HELLO which
+// gets no DISC_HELLO reply within Timeout is resent on the same stream
+type HandshakePolicy struct {
+	MaxAttempts int
+	RetryDelay  time.Duration
+	Jitter      time.Duration
+	Timeout     time.Duration
+}
+
+// newHandshakePolicyFromConfig returns the policy defined by the peer.chat.handshakeRetry settings
+func newHandshakePolicyFromConfig() HandshakePolicy {
+	return HandshakePolicy{
+		MaxAttempts: viper.GetInt("peer.chat.handshakeRetry.maxAttempts"),
+		RetryDelay:  viper.GetDuration("peer.chat.handshakeRetry.retryDelay"),
+		Jitter:      viper.GetDuration("peer.chat.handshakeRetry.jitter"),
+		Timeout:     viper.GetDuration("peer.chat.handshakeTimeout"),
+	}
+}
+
+// delay returns the time to wait before the next attempt
+func (p HandshakePolicy) delay() time.Duration {
+	if p.Jitter <= 0 {
+		return p.RetryDelay
+	}
+	return p.RetryDelay + time.Duration(rand.Int63n(int64(p.Jitter)))
+}
+
+var errHandshakeNoReply = errors.New("No DISC_HELLO received in reply")
+
+type receivedMessage struct {
+	msg *pb.Message
+	err error
+}
+
+// handshake sends hello and waits for the DISC_HELLO reply, receiving from
+// received. An attempt left unanswered is retried as the policy allows. A
+// failure to send or receive ends the handshake with an error requiring a
+// re-dial, as does a DISC_DISCONNECT, DISC_VERSION_MISMATCH,
+// DISC_UNAUTHORIZED or failed RESPONSE from the remote peer, which is not
+// retried.
+func handshake(send func(msg *pb.Message) error, received <-chan receivedMessage, hello *pb.Message, policy HandshakePolicy) (*pb.Message, error) {
+	attempts := policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			delay := policy.delay()
+			peerLogger.Debugf("No reply to %s, retrying in %s (attempt %d of %d)", hello.Type, delay, attempt, attempts)
+			time.Sleep(delay)
+		}
+		if err = send(hello); err != nil {
+			return nil, &HandshakeFailedError{Attempts: attempt, Err: fmt.Errorf("Error sending %s: %s", hello.Type, err), Redial: true}
+		}
+		var reply *pb.Message
+		reply, err = awaitHello(received, policy.Timeout)
+		if err == nil {
+			return reply, nil
+		}
+		if err != errHandshakeNoReply {
+			_, redial := err.(transportError)
+			return nil, &HandshakeFailedError{Attempts: attempt, Err: err, Redial: redial}
+		}
+	}
+	return nil, &HandshakeFailedError{Attempts: attempts, Err: err}
+}
+
+// transportError marks a failure of the stream itself
+type transportError struct {
+	error
+}
+
+// awaitHello returns the first DISC_HELLO received within timeout, a timeout of 0 waits indefinitely
+func awaitHello(received <-chan receivedMessage, timeout time.Duration) (*pb.Message, error) {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for {
+		select {
+		case r, ok := <-received:
+			if !ok {
+				return nil, transportError{errors.New("Chat stream closed")}
+			}
+			if r.err != nil {
+				return nil, transportError{fmt.Errorf("Error waiting for %s: %s", pb.Message_DISC_HELLO, r.err)}
+			}
+			switch r.msg.Type {
+			case pb.Message_DISC_HELLO:
+				return r.msg, nil
+			case pb.Message_DISC_DISCONNECT, pb.Message_DISC_VERSION_MISMATCH, pb.Message_DISC_UNAUTHORIZED:
+				return nil, fmt.Errorf("Remote peer replied with %s: %s", r.msg.Type, r.msg.Payload)
+			case pb.Message_RESPONSE:
+				response := &pb.Response{}
+				if err := proto.Unmarshal(r.msg.Payload, response); err == nil && response.Status == pb.Response_FAILURE {
+					return nil, fmt.Errorf("Error response to %s: %s", pb.Message_DISC_HELLO, response.Msg)
+				}
+			}
+			peerLogger.Debugf("Ignoring %s while waiting for %s", r.msg.Type, pb.Message_DISC_HELLO)
+		case <-expired:
+			return nil, errHandshakeNoReply
+		}
+	}
+}
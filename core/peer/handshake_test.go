@@ -0,0 +1,92 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+var testHandshakePolicy = HandshakePolicy{MaxAttempts: 3, RetryDelay: time.Millisecond, Jitter: time.Millisecond, Timeout: 20 * time.Millisecond}
+
+func TestHandshakeRetriesOnSameStream(t *testing.T) {
+	received := make(chan receivedMessage, 1)
+	sent := 0
+	send := func(msg *pb.Message) error {
+		sent++
+		if sent == 2 {
+			received <- receivedMessage{msg: &pb.Message{Type: pb.Message_DISC_HELLO}}
+		}
+		return nil
+	}
+	reply, err := handshake(send, received, &pb.Message{Type: pb.Message_DISC_HELLO}, testHandshakePolicy)
+	if err != nil {
+		t.Fatalf("Expected the second attempt to succeed: %s", err)
+	}
+	if reply.Type != pb.Message_DISC_HELLO || sent != 2 {
+		t.Errorf("Expected a %s reply after 2 attempts, got %s after %d", pb.Message_DISC_HELLO, reply.Type, sent)
+	}
+}
+
+func TestHandshakeFailsAfterMaxAttempts(t *testing.T) {
+	sent := 0
+	send := func(msg *pb.Message) error {
+		sent++
+		return nil
+	}
+	_, err := handshake(send, make(chan receivedMessage), &pb.Message{Type: pb.Message_DISC_HELLO}, testHandshakePolicy)
+	failed, ok := err.(*HandshakeFailedError)
+	if !ok {
+		t.Fatalf("Expected a HandshakeFailedError, got %v", err)
+	}
+	if sent != 3 || failed.Attempts != 3 || failed.Redial {
+		t.Errorf("Expected 3 attempts without re-dial, got %d sent and %+v", sent, failed)
+	}
+}
+
+func TestHandshakeDoesNotRetryErrors(t *testing.T) {
+	disconnect := receivedMessage{msg: &pb.Message{Type: pb.Message_DISC_DISCONNECT}}
+	closed := receivedMessage{err: errors.New("transport is closing")}
+	for _, test := range []struct {
+		reply  receivedMessage
+		redial bool
+	}{{disconnect, false}, {closed, true}} {
+		received := make(chan receivedMessage, 1)
+		received <- test.reply
+		sent := 0
+		send := func(msg *pb.Message) error {
+			sent++
+			return nil
+		}
+		_, err := handshake(send, received, &pb.Message{Type: pb.Message_DISC_HELLO}, testHandshakePolicy)
+		failed, ok := err.(*HandshakeFailedError)
+		if !ok {
+			t.Fatalf("Expected a HandshakeFailedError, got %v", err)
+		}
+		if sent != 1 || failed.Redial != test.redial {
+			t.Errorf("Expected a single attempt with re-dial %t, got %d sent and %+v", test.redial, sent, failed)
+		}
+	}
+
+	_, err := handshake(func(*pb.Message) error { return errors.New("transport is closing") }, nil, &pb.Message{Type: pb.Message_DISC_HELLO}, testHandshakePolicy)
+	if failed, ok := err.(*HandshakeFailedError); !ok || !failed.Redial {
+		t.Errorf("Expected a send error to require a re-dial, got %v", err)
+	}
+}
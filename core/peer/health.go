@@ -0,0 +1,124 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// HealthStatus is the health of a peer as probed by ProbePeerHealth
+type HealthStatus int
+
+const (
+	// Unhealthy peers are not dialed for gossip
+	Unhealthy HealthStatus = iota
+	// Degraded peers serve, but are overloaded or cannot report their health
+	Degraded
+	// Healthy peers serve normally
+	Healthy
+)
+
+func (s HealthStatus) String() string {
+	switch s {
+	case Healthy:
+		return "Healthy"
+	case Degraded:
+		return "Degraded"
+	default:
+		return "Unhealthy"
+	}
+}
+
+// HealthCheckServer answers the Health service of a peer
+type HealthCheckServer struct {
+	peer *PeerImpl
+}
+
+// NewHealthCheckServer returns the Health service of the peer
+func NewHealthCheckServer(peer *PeerImpl) *HealthCheckServer {
+	return &HealthCheckServer{peer: peer}
+}
+
+// Check implements the Health service, a draining peer being UNHEALTHY
+func (s *HealthCheckServer) Check(ctx context.Context, req *pb.HealthCheckRequest) (*pb.HealthCheckResponse, error) {
+	if s.peer.IsDraining() {
+		return &pb.HealthCheckResponse{Status: pb.HealthCheckResponse_UNHEALTHY, Reason: drainingReason}, nil
+	}
+	return peerHealth(s.peer, s.peer.loadProbe.Score(), viper.GetFloat64("peer.load.avoidThreshold")), nil
+}
+
+// peerHealth returns UNHEALTHY if the last block of the chain cannot be read,
+// DEGRADED if the load score reaches the avoidThreshold other peers avoid
+// overloaded peers at, 0 never avoiding them, and HEALTHY otherwise
+func peerHealth(blockchain BlockChainAccessor, loadScore float32, avoidThreshold float64) *pb.HealthCheckResponse {
+	if height := blockchain.GetBlockchainSize(); height > 0 {
+		if _, err := blockchain.GetBlockByNumber(height - 1); err != nil {
+			return &pb.HealthCheckResponse{Status: pb.HealthCheckResponse_UNHEALTHY, Reason: fmt.Sprintf("Error reading block %d: %s", height-1, err)}
+		}
+	}
+	if avoidThreshold > 0 && float64(loadScore) >= avoidThreshold {
+		return &pb.HealthCheckResponse{Status: pb.HealthCheckResponse_DEGRADED, Reason: fmt.Sprintf("Load score %.2f", loadScore)}
+	}
+	return &pb.HealthCheckResponse{Status: pb.HealthCheckResponse_HEALTHY}
+}
+
+// ProbePeerHealth asks the Health service of the peer at address how it is.
+// A peer which cannot be reached or reports UNHEALTHY is Unhealthy, the error
+// telling why. A peer predating the Health service is Degraded.
+func ProbePeerHealth(ctx context.Context, address string) (HealthStatus, error) {
+	conn, err := NewPeerClientConnectionWithAddress(address)
+	if err != nil {
+		return Unhealthy, fmt.Errorf("Error connecting to %s: %s", address, err)
+	}
+	defer conn.Close()
+	response, err := pb.NewHealthClient(conn).Check(ctx, &pb.HealthCheckRequest{})
+	if grpc.Code(err) == codes.Unimplemented {
+		return Degraded, nil
+	}
+	if err != nil {
+		return Unhealthy, fmt.Errorf("Error checking health of %s: %s", address, err)
+	}
+	switch response.Status {
+	case pb.HealthCheckResponse_HEALTHY:
+		return Healthy, nil
+	case pb.HealthCheckResponse_DEGRADED:
+		return Degraded, nil
+	}
+	return Unhealthy, fmt.Errorf("%s reported %s: %s", address, response.Status, response.Reason)
+}
+
+// probeBeforeGossip returns false, logging why, if the peer at address is
+// Unhealthy, for it not to be dialed and added to the registry. It waits up
+// to peer.health.probeTimeout for the probe.
+func probeBeforeGossip(address string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("peer.health.probeTimeout"))
+	defer cancel()
+	status, err := ProbePeerHealth(ctx, address)
+	if status == Unhealthy {
+		peerLogger.Warningf("Not dialing unhealthy peer %s: %s", address, err)
+		return false
+	}
+	peerLogger.Debugf("Peer %s is %s", address, status)
+	return true
+}
@@ -0,0 +1,77 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// truncatedBlockchain claims a block more than it holds
+type truncatedBlockchain struct {
+	*testBlockchain
+}
+
+func (c truncatedBlockchain) GetBlockchainSize() uint64 {
+	return c.testBlockchain.GetBlockchainSize() + 1
+}
+
+func TestPeerHealth(t *testing.T) {
+	blockchain := &testBlockchain{blocks: []*pb.Block{{}}}
+	for _, test := range []struct {
+		blockchain BlockChainAccessor
+		loadScore  float32
+		threshold  float64
+		expected   pb.HealthCheckResponse_Status
+	}{
+		{blockchain, 0.5, 0.8, pb.HealthCheckResponse_HEALTHY},
+		{&testBlockchain{}, 0.5, 0.8, pb.HealthCheckResponse_HEALTHY},
+		{blockchain, 0.9, 0.8, pb.HealthCheckResponse_DEGRADED},
+		{blockchain, 1, 0, pb.HealthCheckResponse_HEALTHY},
+		{truncatedBlockchain{blockchain}, 0, 0.8, pb.HealthCheckResponse_UNHEALTHY},
+	} {
+		response := peerHealth(test.blockchain, test.loadScore, test.threshold)
+		if response.Status != test.expected {
+			t.Errorf("Expected %s with load %.2f against %.2f, got %s", test.expected, test.loadScore, test.threshold, response.Status)
+		}
+		if response.Status != pb.HealthCheckResponse_HEALTHY && response.Reason == "" {
+			t.Errorf("Expected a reason for %s", response.Status)
+		}
+	}
+}
+
+func TestHealthStatusString(t *testing.T) {
+	for status, expected := range map[HealthStatus]string{Healthy: "Healthy", Degraded: "Degraded", Unhealthy: "Unhealthy"} {
+		if status.String() != expected {
+			t.Errorf("Expected %s, got %s", expected, status)
+		}
+	}
+}
+
+func TestProbePeerHealth(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	status, err := ProbePeerHealth(ctx, viper.GetString("peer.address"))
+	if err != nil || status == Unhealthy {
+		t.Fatalf("Expected the running peer to serve, got %s: %v", status, err)
+	}
+}
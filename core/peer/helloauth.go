@@ -0,0 +1,95 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// helloChallengeSize is the size of the authChallenge of a DISC_HELLO
+const helloChallengeSize = 16
+
+// helloAuthSecrets returns the shared secrets of peer.auth.sharedSecret, the
+// first answering challenges and any of them verifying the answers, for the
+// secret to be rotated one peer at a time. None are returned, disabling the
+// challenge, when peer.auth.mode is tls or jwt.
+func helloAuthSecrets() [][]byte {
+	switch viper.GetString("peer.auth.mode") {
+	case "tls", "jwt":
+		return nil
+	}
+	var secrets [][]byte
+	for _, secret := range viper.GetStringSlice("peer.auth.sharedSecret") {
+		if secret != "" {
+			secrets = append(secrets, []byte(secret))
+		}
+	}
+	return secrets
+}
+
+// newHelloChallenge returns a random authChallenge for a DISC_HELLO
+func newHelloChallenge() ([]byte, error) {
+	challenge := make([]byte, helloChallengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, fmt.Errorf("Error generating hello challenge: %s", err)
+	}
+	return challenge, nil
+}
+
+func helloChallengeHMAC(challenge, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(challenge)
+	return mac.Sum(nil)
+}
+
+// newHelloAuth returns the DISC_HELLO_AUTH answering the challenge with secret
+func newHelloAuth(challenge, secret []byte) (*pb.Message, error) {
+	return newHelloAuthWithSession(challenge, secret, "")
+}
+
+// newHelloAuthWithSession returns the DISC_HELLO_AUTH answering the challenge
+// with secret and issuing sessionToken
+func newHelloAuthWithSession(challenge, secret []byte, sessionToken string) (*pb.Message, error) {
+	if len(challenge) != helloChallengeSize {
+		return nil, fmt.Errorf("Hello challenge of %d bytes instead of %d", len(challenge), helloChallengeSize)
+	}
+	data, err := proto.Marshal(&pb.HelloAuth{Hmac: helloChallengeHMAC(challenge, secret), SessionToken: sessionToken})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling HelloAuth: %s", err)
+	}
+	return &pb.Message{Type: pb.Message_DISC_HELLO_AUTH, Payload: data}, nil
+}
+
+// verifyHelloAuth returns an error unless the answer is the HMAC of the
+// challenge under one of the secrets, compared in constant time
+func verifyHelloAuth(challenge []byte, answer *pb.HelloAuth, secrets [][]byte) error {
+	for _, secret := range secrets {
+		if hmac.Equal(answer.Hmac, helloChallengeHMAC(challenge, secret)) {
+			return nil
+		}
+	}
+	return errors.New("Invalid hello challenge answer")
+}
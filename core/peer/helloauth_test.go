@@ -0,0 +1,80 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func answerChallenge(t *testing.T, challenge []byte, secret string) *pb.HelloAuth {
+	msg, err := newHelloAuth(challenge, []byte(secret))
+	if err != nil {
+		t.Fatalf("Error answering the challenge: %s", err)
+	}
+	if msg.Type != pb.Message_DISC_HELLO_AUTH {
+		t.Fatalf("Expected a %s, got %s", pb.Message_DISC_HELLO_AUTH, msg.Type)
+	}
+	answer := &pb.HelloAuth{}
+	if err := proto.Unmarshal(msg.Payload, answer); err != nil {
+		t.Fatalf("Error unmarshalling HelloAuth: %s", err)
+	}
+	return answer
+}
+
+func TestHelloChallengeRotation(t *testing.T) {
+	challenge, err := newHelloChallenge()
+	if err != nil || len(challenge) != helloChallengeSize {
+		t.Fatalf("Expected a challenge of %d bytes, got %d, %v", helloChallengeSize, len(challenge), err)
+	}
+	secrets := [][]byte{[]byte("new"), []byte("old")}
+	if err := verifyHelloAuth(challenge, answerChallenge(t, challenge, "new"), secrets); err != nil {
+		t.Errorf("Expected the answer under the current secret to verify: %s", err)
+	}
+	if err := verifyHelloAuth(challenge, answerChallenge(t, challenge, "old"), secrets); err != nil {
+		t.Errorf("Expected the answer of a peer not rotated yet to verify: %s", err)
+	}
+	if err := verifyHelloAuth(challenge, answerChallenge(t, challenge, "other"), secrets); err == nil {
+		t.Error("Expected the answer under another secret to be refused")
+	}
+	other, _ := newHelloChallenge()
+	if err := verifyHelloAuth(other, answerChallenge(t, challenge, "new"), secrets); err == nil {
+		t.Error("Expected the answer to another challenge to be refused")
+	}
+	if _, err := newHelloAuth([]byte("short"), []byte("new")); err == nil {
+		t.Error("Expected a challenge of the wrong size not to be answered")
+	}
+}
+
+func TestHelloAuthSecrets(t *testing.T) {
+	defer viper.Set("peer.auth.mode", "")
+	defer viper.Set("peer.auth.sharedSecret", []string{})
+	viper.Set("peer.auth.sharedSecret", []string{"new", "", "old"})
+	if secrets := helloAuthSecrets(); len(secrets) != 2 || string(secrets[0]) != "new" || string(secrets[1]) != "old" {
+		t.Fatalf("Expected the configured secrets in order, got %q", secrets)
+	}
+	for _, mode := range []string{"tls", "jwt"} {
+		viper.Set("peer.auth.mode", mode)
+		if secrets := helloAuthSecrets(); secrets != nil {
+			t.Errorf("Expected the challenge to be disabled in mode %s, got %q", mode, secrets)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// defaultIdempotencyExpiry is how long the replies are kept without a configured peer.tx.idempotency.expiry
+const defaultIdempotencyExpiry = 24 * time.Hour
+
+// defaultIdempotencyMaxKeys is how many replies are kept without a configured peer.tx.idempotency.maxKeys
+const defaultIdempotencyMaxKeys = 100000
+
+// idempotencyKeyPrefix prefixes the keys of the replies in the persistCF
+const idempotencyKeyPrefix = "idempotency."
+
+// idempotencyStore persists the replies of an IdempotencyCache, keyed by the
+// hex idempotency key
+type idempotencyStore interface {
+	Put(key string, value []byte) error
+	Delete(key string) error
+	Entries() (map[string][]byte, error)
+}
+
+// persistCFIdempotencyStore keeps the replies in the persistCF of the database
+type persistCFIdempotencyStore struct{}
+
+func (persistCFIdempotencyStore) Put(key string, value []byte) error {
+	openchainDB := db.GetDBHandle()
+	return openchainDB.Put(openchainDB.PersistCF, []byte(idempotencyKeyPrefix+key), value)
+}
+
+func (persistCFIdempotencyStore) Delete(key string) error {
+	openchainDB := db.GetDBHandle()
+	return openchainDB.Delete(openchainDB.PersistCF, []byte(idempotencyKeyPrefix+key))
+}
+
+func (persistCFIdempotencyStore) Entries() (map[string][]byte, error) {
+	openchainDB := db.GetDBHandle()
+	prefix := []byte(idempotencyKeyPrefix)
+	entries := make(map[string][]byte)
+	it := openchainDB.GetIterator(openchainDB.PersistCF)
+	defer it.Close()
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		key := string(it.Key().Data())[len(idempotencyKeyPrefix):]
+		// copy data from the slice!
+		entries[key] = append([]byte(nil), it.Value().Data()...)
+	}
+	return entries, nil
+}
+
+// IdempotencyCache keeps the replies to the CHAIN_TRANSACTIONS batches
+// carrying an idempotency key for expiry, up to maxKeys of them, evicting the
+// oldest first. The replies are persisted, a batch resent after a restart of
+// the peer being answered as well. Each reply is kept as the Message sent,
+// its timestamp being when it was recorded.
+type IdempotencyCache struct {
+	sync.Mutex
+	expiry  time.Duration
+	maxKeys int
+	store   idempotencyStore
+	loaded  bool
+	replies map[string]*pb.Message
+	order   []string
+}
+
+// NewIdempotencyCache returns a cache keeping up to maxKeys replies for
+// expiry in store, none being persisted with a nil store. A non positive
+// expiry or maxKeys stands for the default one.
+func NewIdempotencyCache(expiry time.Duration, maxKeys int, store idempotencyStore) *IdempotencyCache {
+	if expiry <= 0 {
+		expiry = defaultIdempotencyExpiry
+	}
+	if maxKeys <= 0 {
+		maxKeys = defaultIdempotencyMaxKeys
+	}
+	return &IdempotencyCache{expiry: expiry, maxKeys: maxKeys, store: store, replies: make(map[string]*pb.Message)}
+}
+
+// newIdempotencyCacheFromConfig returns a cache persisted in the database
+// keeping peer.tx.idempotency.maxKeys replies for peer.tx.idempotency.expiry
+func newIdempotencyCacheFromConfig() *IdempotencyCache {
+	return NewIdempotencyCache(viper.GetDuration("peer.tx.idempotency.expiry"), viper.GetInt("peer.tx.idempotency.maxKeys"), persistCFIdempotencyStore{})
+}
+
+// Lookup returns the reply recorded for key, nil if none or expired
+func (c *IdempotencyCache) Lookup(key []byte) *pb.Message {
+	if c == nil {
+		return nil
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.load()
+	c.expire(time.Now())
+	if reply, ok := c.replies[hex.EncodeToString(key)]; ok {
+		return &pb.Message{Type: reply.Type, Payload: reply.Payload}
+	}
+	return nil
+}
+
+// Record keeps the reply of type replyType sent to the batch of key
+func (c *IdempotencyCache) Record(key []byte, replyType pb.Message_Type, reply proto.Message) error {
+	if c == nil {
+		return nil
+	}
+	data, err := proto.Marshal(reply)
+	if err != nil {
+		return fmt.Errorf("Error marshalling reply: %s", err)
+	}
+	recorded := &pb.Message{Type: replyType, Payload: data, Timestamp: util.CreateUtcTimestamp()}
+	c.Lock()
+	defer c.Unlock()
+	c.load()
+	id := hex.EncodeToString(key)
+	if c.store != nil {
+		value, err := proto.Marshal(recorded)
+		if err != nil {
+			return fmt.Errorf("Error marshalling recorded reply: %s", err)
+		}
+		if err := c.store.Put(id, value); err != nil {
+			return fmt.Errorf("Error storing the reply of idempotency key %s: %s", id, err)
+		}
+	}
+	c.add(id, recorded)
+	for len(c.order) > c.maxKeys {
+		c.remove(c.order[0])
+	}
+	return nil
+}
+
+func (c *IdempotencyCache) add(id string, reply *pb.Message) {
+	if _, ok := c.replies[id]; ok {
+		c.removeOrder(id)
+	}
+	c.replies[id] = reply
+	c.order = append(c.order, id)
+}
+
+func (c *IdempotencyCache) removeOrder(id string) {
+	for i, ordered := range c.order {
+		if ordered == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			return
+		}
+	}
+}
+
+// remove forgets the oldest reply id, also from the store
+func (c *IdempotencyCache) remove(id string) {
+	delete(c.replies, id)
+	c.removeOrder(id)
+	if c.store != nil {
+		if err := c.store.Delete(id); err != nil {
+			peerLogger.Warningf("Error deleting the reply of idempotency key %s: %s", id, err)
+		}
+	}
+}
+
+// expire forgets the replies recorded for longer than expiry
+func (c *IdempotencyCache) expire(now time.Time) {
+	for len(c.order) > 0 {
+		recorded := c.replies[c.order[0]].Timestamp
+		if now.Sub(time.Unix(recorded.Seconds, int64(recorded.Nanos))) < c.expiry {
+			return
+		}
+		c.remove(c.order[0])
+	}
+}
+
+// load reads the persisted replies the first time the cache is used, oldest first
+func (c *IdempotencyCache) load() {
+	if c.loaded || c.store == nil {
+		return
+	}
+	c.loaded = true
+	entries, err := c.store.Entries()
+	if err != nil {
+		peerLogger.Warningf("Error loading the replies of the idempotency keys: %s", err)
+		return
+	}
+	var replies []*pb.Message
+	ids := make(map[*pb.Message]string)
+	for id, value := range entries {
+		reply := &pb.Message{}
+		if err := proto.Unmarshal(value, reply); err != nil || reply.Timestamp == nil {
+			peerLogger.Warningf("Dropping the malformed reply of idempotency key %s", id)
+			c.store.Delete(id)
+			continue
+		}
+		replies = append(replies, reply)
+		ids[reply] = id
+	}
+	sort.Sort(messagesByTimestamp(replies))
+	for _, reply := range replies {
+		c.add(ids[reply], reply)
+	}
+}
+
+// messagesByTimestamp sorts messages oldest first
+type messagesByTimestamp []*pb.Message
+
+func (m messagesByTimestamp) Len() int      { return len(m) }
+func (m messagesByTimestamp) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+func (m messagesByTimestamp) Less(i, j int) bool {
+	if m[i].Timestamp.Seconds != m[j].Timestamp.Seconds {
+		return m[i].Timestamp.Seconds < m[j].Timestamp.Seconds
+	}
+	return m[i].Timestamp.Nanos < m[j].Timestamp.Nanos
+}
+
+// IdempotencyCacheAccessor interface enables a Peer to hand out its IdempotencyCache
+type IdempotencyCacheAccessor interface {
+	GetIdempotencyCache() *IdempotencyCache
+}
+
+// GetIdempotencyCache returns the cache of the replies to the CHAIN_TRANSACTIONS batches carrying an idempotency key
+func (p *PeerImpl) GetIdempotencyCache() *IdempotencyCache {
+	return p.idempotency
+}
+
+// newIdempotencyKey returns the HMAC-SHA256 of the batch, keyed with
+// peer.id for the same batch sent by different peers not to be taken for a
+// resent one
+func newIdempotencyKey(batch *pb.TransactionBlock) ([]byte, error) {
+	data, err := proto.Marshal(batch)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling TransactionBlock: %s", err)
+	}
+	mac := hmac.New(sha256.New, []byte(viper.GetString("peer.id")))
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+// SendIdempotentTransaction sends the batch to the peer at address with the
+// idempotency key key, the HMAC-SHA256 of the batch if nil, for the batch to
+// be processed once however many times it is resent, as after a timeout. The
+// batch is sent as by SendTransactionsToPeer, an error being returned if the
+// peer refused it.
+func SendIdempotentTransaction(address string, key []byte, batch *pb.TransactionBlock) error {
+	keyed := *batch
+	if key == nil {
+		keyed.IdempotencyKey = nil
+		var err error
+		if key, err = newIdempotencyKey(&keyed); err != nil {
+			return err
+		}
+	}
+	keyed.IdempotencyKey = key
+	_, err := SendTransactionsToPeer(address, &keyed, nil)
+	return err
+}
@@ -0,0 +1,181 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/looplab/fsm"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// memoryIdempotencyStore is an idempotencyStore kept in memory
+type memoryIdempotencyStore map[string][]byte
+
+func (s memoryIdempotencyStore) Put(key string, value []byte) error {
+	s[key] = value
+	return nil
+}
+
+func (s memoryIdempotencyStore) Delete(key string) error {
+	delete(s, key)
+	return nil
+}
+
+func (s memoryIdempotencyStore) Entries() (map[string][]byte, error) {
+	entries := make(map[string][]byte)
+	for key, value := range s {
+		entries[key] = value
+	}
+	return entries, nil
+}
+
+func TestIdempotencyCacheRecord(t *testing.T) {
+	c := NewIdempotencyCache(time.Hour, 10, nil)
+	if reply := c.Lookup([]byte("key")); reply != nil {
+		t.Fatalf("Expected no reply before any is recorded, got %v", reply)
+	}
+	if err := c.Record([]byte("key"), pb.Message_RESPONSE, &pb.Response{Status: pb.Response_SUCCESS}); err != nil {
+		t.Fatalf("Error recording reply: %s", err)
+	}
+	reply := c.Lookup([]byte("key"))
+	if reply == nil || reply.Type != pb.Message_RESPONSE {
+		t.Fatalf("Expected the recorded RESPONSE, got %v", reply)
+	}
+	response := &pb.Response{}
+	if err := proto.Unmarshal(reply.Payload, response); err != nil || response.Status != pb.Response_SUCCESS {
+		t.Errorf("Expected a successful response, got %v", response)
+	}
+	if reply.Timestamp != nil {
+		t.Error("Expected the reply without the time it was recorded")
+	}
+	if reply := c.Lookup([]byte("other")); reply != nil {
+		t.Errorf("Expected no reply for another key, got %v", reply)
+	}
+}
+
+func TestIdempotencyCacheExpiry(t *testing.T) {
+	store := memoryIdempotencyStore{}
+	c := NewIdempotencyCache(50*time.Millisecond, 10, store)
+	c.Record([]byte("key"), pb.Message_RESPONSE, &pb.Response{Status: pb.Response_SUCCESS})
+	time.Sleep(100 * time.Millisecond)
+	if reply := c.Lookup([]byte("key")); reply != nil {
+		t.Errorf("Expected the reply to expire, got %v", reply)
+	}
+	if len(store) != 0 {
+		t.Errorf("Expected the expired reply to be deleted from the store, got %d", len(store))
+	}
+}
+
+func TestIdempotencyCacheMaxKeys(t *testing.T) {
+	store := memoryIdempotencyStore{}
+	c := NewIdempotencyCache(time.Hour, 2, store)
+	for _, key := range []string{"a", "b", "c"} {
+		c.Record([]byte(key), pb.Message_RESPONSE, &pb.Response{Status: pb.Response_SUCCESS})
+	}
+	if reply := c.Lookup([]byte("a")); reply != nil {
+		t.Error("Expected the oldest reply to be evicted")
+	}
+	if c.Lookup([]byte("b")) == nil || c.Lookup([]byte("c")) == nil {
+		t.Error("Expected the 2 newest replies to be kept")
+	}
+	if len(store) != 2 {
+		t.Errorf("Expected 2 stored replies, got %d", len(store))
+	}
+}
+
+func TestIdempotencyCacheLoad(t *testing.T) {
+	store := memoryIdempotencyStore{}
+	first := NewIdempotencyCache(time.Hour, 10, store)
+	first.Record([]byte("a"), pb.Message_RESPONSE, &pb.Response{Status: pb.Response_SUCCESS})
+	first.Record([]byte("b"), pb.Message_CHAIN_TRANSACTIONS_PARTIAL_ACK, &pb.TransactionsPartialAck{Committed: []string{"tx1"}})
+	store["malformed"] = []byte{0xff}
+
+	// A restarted peer reads the replies back
+	restarted := NewIdempotencyCache(time.Hour, 1, store)
+	if reply := restarted.Lookup([]byte("b")); reply == nil || reply.Type != pb.Message_CHAIN_TRANSACTIONS_PARTIAL_ACK {
+		t.Errorf("Expected the persisted PARTIAL_ACK, got %v", reply)
+	}
+	restarted.Record([]byte("c"), pb.Message_RESPONSE, &pb.Response{Status: pb.Response_SUCCESS})
+	if _, ok := store["malformed"]; ok {
+		t.Error("Expected the malformed reply to be dropped")
+	}
+	if len(store) != 1 {
+		t.Errorf("Expected the older loaded replies to be evicted first, got %d stored", len(store))
+	}
+}
+
+func TestNewIdempotencyKey(t *testing.T) {
+	defer viper.Set("peer.id", viper.GetString("peer.id"))
+	batch := newTestTransactionBatch(2)
+	viper.Set("peer.id", "vp0")
+	key, err := newIdempotencyKey(batch)
+	if err != nil {
+		t.Fatalf("Error computing idempotency key: %s", err)
+	}
+	again, _ := newIdempotencyKey(batch)
+	if !bytes.Equal(key, again) || len(key) != 32 {
+		t.Errorf("Expected the same 32 bytes key for the same batch, got %x and %x", key, again)
+	}
+	viper.Set("peer.id", "vp1")
+	if other, _ := newIdempotencyKey(batch); bytes.Equal(key, other) {
+		t.Error("Expected another peer to key the same batch differently")
+	}
+}
+
+func TestPartIdempotencyKey(t *testing.T) {
+	batch := newTestTransactionBatch(4)
+	batch.IdempotencyKey = []byte("key")
+	first := transactionBatchPart(batch, batch.Transactions[:2])
+	second := transactionBatchPart(batch, batch.Transactions[2:])
+	if len(first.IdempotencyKey) == 0 || bytes.Equal(first.IdempotencyKey, second.IdempotencyKey) || bytes.Equal(first.IdempotencyKey, batch.IdempotencyKey) {
+		t.Errorf("Expected each part its own idempotency key, got %x and %x", first.IdempotencyKey, second.IdempotencyKey)
+	}
+	if again := transactionBatchPart(batch, batch.Transactions[:2]); !bytes.Equal(first.IdempotencyKey, again.IdempotencyKey) {
+		t.Error("Expected a part resent to keep its idempotency key")
+	}
+	if part := transactionBatchPart(newTestTransactionBatch(2), nil); part.IdempotencyKey != nil {
+		t.Error("Expected no idempotency key for the parts of a batch without one")
+	}
+}
+
+func TestHandlerAnswersResentTransactions(t *testing.T) {
+	cache := NewIdempotencyCache(time.Hour, 10, nil)
+	cache.Record([]byte("key"), pb.Message_CHAIN_TRANSACTIONS_PARTIAL_ACK, &pb.TransactionsPartialAck{Committed: []string{"tx1"}})
+	handler := newTestHandlerWithCoordinator(t, handlerTestCoordinator{idempotency: cache})
+	batch := newTestTransactionBatch(2)
+	batch.IdempotencyKey = []byte("key")
+	data, _ := proto.Marshal(batch)
+	msg := &pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS, Payload: data, CorrelationID: "7"}
+	e := &fsm.Event{FSM: handler.FSM, Event: msg.Type.String(), Args: []interface{}{msg}}
+
+	// Any processing would panic, the test coordinator having no processor registry
+	handler.beforeTransactions(e)
+	if e.Err != nil {
+		t.Fatalf("Expected the resent batch to be answered, got %s", e.Err)
+	}
+	reply := <-handler.ChatStream.(*handshakeStream).sent
+	ack := &pb.TransactionsPartialAck{}
+	if err := proto.Unmarshal(reply.Payload, ack); err != nil || reply.Type != pb.Message_CHAIN_TRANSACTIONS_PARTIAL_ACK || reply.CorrelationID != "7" || len(ack.Committed) != 1 {
+		t.Errorf("Expected the recorded PARTIAL_ACK, got %v, %v", reply, ack)
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+
+	"github.com/hyperledger/fabric/events/producer"
+)
+
+var corruptBlocksCounter = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "peer",
+	Name:      "corrupt_blocks_total",
+	Help:      "Number of stored blocks found corrupted by the block integrity checker.",
+})
+
+func init() {
+	prometheus.MustRegister(corruptBlocksCounter)
+}
+
+// BlockIntegrityChecker verifies the stored blocks against the hash chain:
+// every block must hash to the previousBlockHash of the block following it,
+// which covers its transactions. The last block has no successor to be
+// verified against until the next one is committed.
+type BlockIntegrityChecker struct {
+	blockchain    BlockChainAccessor
+	maxCPUPercent int
+	report        func(blockNumber uint64, expectedHash, actualHash []byte)
+	stop          chan struct{}
+}
+
+// NewBlockIntegrityChecker returns a checker of the blocks of blockchain
+// pausing between blocks to use at most maxCPUPercent of a CPU, 0 or 100 and
+// above not pausing
+func NewBlockIntegrityChecker(blockchain BlockChainAccessor, maxCPUPercent int) *BlockIntegrityChecker {
+	return &BlockIntegrityChecker{blockchain: blockchain, maxCPUPercent: maxCPUPercent, report: reportBlockCorruption, stop: make(chan struct{})}
+}
+
+func newBlockIntegrityCheckerFromConfig(blockchain BlockChainAccessor) *BlockIntegrityChecker {
+	return NewBlockIntegrityChecker(blockchain, viper.GetInt("peer.integrity.maxCPUPercent"))
+}
+
+// reportBlockCorruption logs the corrupted block, counts it and sends a BlockCorruptionEvent
+func reportBlockCorruption(blockNumber uint64, expectedHash, actualHash []byte) {
+	peerLogger.Errorf("Block %d is corrupted, it hashes to %x instead of %x", blockNumber, actualHash, expectedHash)
+	corruptBlocksCounter.Inc()
+	if err := producer.Send(producer.CreateBlockCorruptionEvent(blockNumber, expectedHash, actualHash)); err != nil {
+		peerLogger.Errorf("Error sending block corruption event: %s", err)
+	}
+}
+
+// RunOnce checks every stored block, returning the number of corrupted ones
+// found. It stops with the context error if ctx is done first.
+func (c *BlockIntegrityChecker) RunOnce(ctx context.Context) (int, error) {
+	height := c.blockchain.GetBlockchainSize()
+	if height < 2 {
+		return 0, nil
+	}
+	corrupted := 0
+	block, err := c.blockchain.GetBlockByNumber(0)
+	if err != nil {
+		return 0, fmt.Errorf("Error reading block 0: %s", err)
+	}
+	for n := uint64(0); n+1 < height; n++ {
+		select {
+		case <-ctx.Done():
+			return corrupted, ctx.Err()
+		default:
+		}
+		start := time.Now()
+		next, err := c.blockchain.GetBlockByNumber(n + 1)
+		if err != nil {
+			return corrupted, fmt.Errorf("Error reading block %d: %s", n+1, err)
+		}
+		hash, err := block.GetHash()
+		if err != nil {
+			return corrupted, fmt.Errorf("Error hashing block %d: %s", n, err)
+		}
+		if !bytes.Equal(hash, next.PreviousBlockHash) {
+			corrupted++
+			c.report(n, next.PreviousBlockHash, hash)
+		}
+		block = next
+		if err := c.pause(ctx, time.Since(start)); err != nil {
+			return corrupted, err
+		}
+	}
+	return corrupted, nil
+}
+
+// pause waits long enough after checking a block in busy time for the checks
+// to stay under maxCPUPercent
+func (c *BlockIntegrityChecker) pause(ctx context.Context, busy time.Duration) error {
+	if c.maxCPUPercent <= 0 || c.maxCPUPercent >= 100 {
+		return nil
+	}
+	select {
+	case <-time.After(busy * time.Duration(100-c.maxCPUPercent) / time.Duration(c.maxCPUPercent)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Start checks the blocks every interval until Stop is called
+func (c *BlockIntegrityChecker) Start(interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-c.stop
+		cancel()
+	}()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				corrupted, err := c.RunOnce(ctx)
+				if err != nil && err != context.Canceled {
+					peerLogger.Errorf("Error checking block integrity: %s", err)
+				} else if err == nil {
+					peerLogger.Infof("Block integrity check found %d corrupted blocks", corrupted)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic checks, interrupting a running one
+func (c *BlockIntegrityChecker) Stop() {
+	close(c.stop)
+}
+
+// GetBlockIntegrityChecker returns the checker of the stored blocks, for on-demand scans
+func (p *PeerImpl) GetBlockIntegrityChecker() *BlockIntegrityChecker {
+	return p.integrity
+}
@@ -0,0 +1,70 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestBlockIntegrityChecker(t *testing.T) {
+	blockchain := &testBlockchain{}
+	bus := NewBlockEventBus()
+	var previousHash []byte
+	for i := 0; i < 5; i++ {
+		block := &pb.Block{Transactions: []*pb.Transaction{{Uuid: fmt.Sprintf("tx%d", i)}}, PreviousBlockHash: previousHash}
+		hash, err := block.GetHash()
+		if err != nil {
+			t.Fatalf("Error hashing block %d: %s", i, err)
+		}
+		blockchain.append(bus, block)
+		previousHash = hash
+	}
+
+	type corruption struct {
+		blockNumber          uint64
+		expected, actual []byte
+	}
+	var reported []corruption
+	checker := NewBlockIntegrityChecker(blockchain, 50)
+	checker.report = func(blockNumber uint64, expectedHash, actualHash []byte) {
+		reported = append(reported, corruption{blockNumber, expectedHash, actualHash})
+	}
+	if corrupted, err := checker.RunOnce(context.Background()); err != nil || corrupted != 0 {
+		t.Fatalf("Expected intact blocks, got %d corrupted: %v", corrupted, err)
+	}
+
+	blockchain.blocks[2].Transactions[0].Uuid = "tampered"
+	corrupted, err := checker.RunOnce(context.Background())
+	if err != nil || corrupted != 1 {
+		t.Fatalf("Expected 1 corrupted block, got %d: %v", corrupted, err)
+	}
+	if len(reported) != 1 || reported[0].blockNumber != 2 || !bytes.Equal(reported[0].expected, blockchain.blocks[3].PreviousBlockHash) {
+		t.Fatalf("Expected the corruption of block 2 to be reported, got %v", reported)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := checker.RunOnce(ctx); err != context.Canceled {
+		t.Fatalf("Expected a cancelled check to stop, got %v", err)
+	}
+}
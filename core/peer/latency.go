@@ -0,0 +1,242 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+var rttSummary = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+	Namespace: "peer",
+	Name:      "rtt_seconds",
+	Help:      "Round-trip times of DISC_PING messages, by peer address.",
+}, []string{"address"})
+
+func init() {
+	prometheus.MustRegister(rttSummary)
+}
+
+// LatencyTrackerAccessor interface enables a Peer to hand out its LatencyTracker
+type LatencyTrackerAccessor interface {
+	GetLatencyTracker() *LatencyTracker
+}
+
+// LatencyStats summarizes the round-trip times recorded for a peer
+type LatencyStats struct {
+	Count int           `json:"count"`
+	Min   time.Duration `json:"min"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+// latencySeries is a fixed size ring buffer of round-trip times
+type latencySeries struct {
+	samples []time.Duration
+	next    int
+	size    int
+}
+
+func (s *latencySeries) add(rtt time.Duration) {
+	s.samples[s.next] = rtt
+	s.next = (s.next + 1) % len(s.samples)
+	if s.size < len(s.samples) {
+		s.size++
+	}
+}
+
+func (s *latencySeries) sorted() []time.Duration {
+	sorted := append([]time.Duration(nil), s.samples[:s.size]...)
+	sort.Sort(durations(sorted))
+	return sorted
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+// percentile returns the nearest-rank p-th percentile of the sorted samples
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	} else if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// LatencyTracker keeps the last round-trip times measured to each peer address
+type LatencyTracker struct {
+	sync.Mutex
+	maxSamples int
+	series     map[string]*latencySeries
+}
+
+// NewLatencyTracker returns a tracker keeping at most maxSamples round-trip times per peer
+func NewLatencyTracker(maxSamples int) *LatencyTracker {
+	return &LatencyTracker{maxSamples: maxSamples, series: make(map[string]*latencySeries)}
+}
+
+func newLatencyTrackerFromConfig() *LatencyTracker {
+	return NewLatencyTracker(viper.GetInt("peer.discovery.latencySamples"))
+}
+
+// Record adds a round-trip time measured to the peer at address
+func (t *LatencyTracker) Record(address string, rtt time.Duration) {
+	rttSummary.WithLabelValues(address).Observe(rtt.Seconds())
+	if t.maxSamples <= 0 {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	series, ok := t.series[address]
+	if !ok {
+		series = &latencySeries{samples: make([]time.Duration, t.maxSamples)}
+		t.series[address] = series
+	}
+	series.add(rtt)
+}
+
+// Percentile returns the p-th percentile, p between 0 and 100, of the
+// round-trip times recorded for the peer at address, 0 if there are none
+func (t *LatencyTracker) Percentile(address string, p float64) time.Duration {
+	t.Lock()
+	defer t.Unlock()
+	series, ok := t.series[address]
+	if !ok {
+		return 0
+	}
+	return percentile(series.sorted(), p)
+}
+
+// Snapshot returns the statistics of the round-trip times of every peer
+func (t *LatencyTracker) Snapshot() map[string]LatencyStats {
+	t.Lock()
+	defer t.Unlock()
+	snapshot := make(map[string]LatencyStats, len(t.series))
+	for address, series := range t.series {
+		sorted := series.sorted()
+		snapshot[address] = LatencyStats{
+			Count: len(sorted),
+			Min:   sorted[0],
+			P50:   percentile(sorted, 50),
+			P90:   percentile(sorted, 90),
+			P99:   percentile(sorted, 99),
+			Max:   sorted[len(sorted)-1],
+		}
+	}
+	return snapshot
+}
+
+// newPing returns a DISC_PING sent now
+func newPing() (*pb.Message, error) {
+	data, err := proto.Marshal(&pb.Ping{SentAt: time.Now().UnixNano()})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling Ping: %s", err)
+	}
+	return &pb.Message{Type: pb.Message_DISC_PING, Payload: data}, nil
+}
+
+// pongRTT returns the round-trip time of the DISC_PING echoed by the DISC_PONG payload
+func pongRTT(payload []byte) (time.Duration, error) {
+	ping := &pb.Ping{}
+	if err := proto.Unmarshal(payload, ping); err != nil {
+		return 0, fmt.Errorf("Error unmarshalling Ping: %s", err)
+	}
+	return time.Since(time.Unix(0, ping.SentAt)), nil
+}
+
+// HeartbeatDialer periodically sends a DISC_PING to the connected peers, whose
+// DISC_PONG replies feed the LatencyTracker
+type HeartbeatDialer struct {
+	broadcast func(msg *pb.Message) []error
+	stop      chan struct{}
+}
+
+// NewHeartbeatDialer returns a dialer sending its pings through broadcast
+func NewHeartbeatDialer(broadcast func(msg *pb.Message) []error) *HeartbeatDialer {
+	return &HeartbeatDialer{broadcast: broadcast, stop: make(chan struct{})}
+}
+
+// Start pings the peers every interval until Stop is called
+func (h *HeartbeatDialer) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				h.ping()
+			case <-h.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the pings
+func (h *HeartbeatDialer) Stop() {
+	close(h.stop)
+}
+
+func (h *HeartbeatDialer) ping() {
+	msg, err := newPing()
+	if err != nil {
+		peerLogger.Errorf("Error creating DISC_PING: %s", err)
+		return
+	}
+	for _, err := range h.broadcast(msg) {
+		peerLogger.Debugf("Error sending DISC_PING: %s", err)
+	}
+}
+
+// GetLatencyTracker returns the tracker of the round-trip times measured to the peers
+func (p *PeerImpl) GetLatencyTracker() *LatencyTracker {
+	return p.latencyTracker
+}
+
+// LatencyHandler returns an http.Handler serving the LatencyTracker snapshot as JSON
+func (p *PeerImpl) LatencyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.Marshal(p.latencyTracker.Snapshot())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+}
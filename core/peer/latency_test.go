@@ -0,0 +1,82 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestLatencyTracker(t *testing.T) {
+	tracker := NewLatencyTracker(10)
+	for i := 1; i <= 20; i++ {
+		tracker.Record("a", time.Duration(i)*time.Millisecond)
+	}
+	tracker.Record("b", 7*time.Millisecond)
+
+	// Only the last 10 samples of a, 11ms to 20ms, are kept
+	if p := tracker.Percentile("a", 50); p != 15*time.Millisecond {
+		t.Errorf("Expected a median of 15ms, got %s", p)
+	}
+	if p := tracker.Percentile("a", 99); p != 20*time.Millisecond {
+		t.Errorf("Expected a 99th percentile of 20ms, got %s", p)
+	}
+	if p := tracker.Percentile("c", 50); p != 0 {
+		t.Errorf("Expected 0 for a peer without samples, got %s", p)
+	}
+
+	snapshot := tracker.Snapshot()
+	if stats := snapshot["a"]; stats.Count != 10 || stats.Min != 11*time.Millisecond || stats.Max != 20*time.Millisecond || stats.P90 != 19*time.Millisecond {
+		t.Errorf("Unexpected statistics for a: %+v", stats)
+	}
+	if stats := snapshot["b"]; stats.Count != 1 || stats.P50 != 7*time.Millisecond {
+		t.Errorf("Unexpected statistics for b: %+v", stats)
+	}
+}
+
+func TestHeartbeatDialerPing(t *testing.T) {
+	pings := make(chan *pb.Message, 1)
+	dialer := NewHeartbeatDialer(func(msg *pb.Message) []error {
+		select {
+		case pings <- msg:
+		default:
+		}
+		return nil
+	})
+	dialer.Start(10 * time.Millisecond)
+	defer dialer.Stop()
+
+	var ping *pb.Message
+	select {
+	case ping = <-pings:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for DISC_PING")
+	}
+	if ping.Type != pb.Message_DISC_PING {
+		t.Fatalf("Expected DISC_PING, got %s", ping.Type)
+	}
+	time.Sleep(5 * time.Millisecond)
+	rtt, err := pongRTT(ping.Payload)
+	if err != nil {
+		t.Fatalf("Error measuring the round trip: %s", err)
+	}
+	if rtt < 5*time.Millisecond || rtt > 5*time.Second {
+		t.Errorf("Unexpected round-trip time %s", rtt)
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// goroutineCapacity is the number of goroutines considered to saturate the
+// peer when the CPU usage cannot be read from /proc/stat
+const goroutineCapacity = 10000
+
+// SystemLoadProbe samples the load of the system the peer runs on, as the
+// share of CPU time spent busy between two samples of /proc/stat. Where
+// /proc/stat is not available the number of goroutines is used instead.
+type SystemLoadProbe struct {
+	sync.Mutex
+	score     float32
+	prevBusy  uint64
+	prevTotal uint64
+	readStat  func() ([]byte, error)
+	stop      chan struct{}
+}
+
+// NewSystemLoadProbe returns a probe with a load of 0 until sampled
+func NewSystemLoadProbe() *SystemLoadProbe {
+	return &SystemLoadProbe{readStat: func() ([]byte, error) { return ioutil.ReadFile("/proc/stat") }}
+}
+
+// newSystemLoadProbeFromConfig returns a probe sampling every
+// peer.load.sampleInterval, nil if the interval is 0
+func newSystemLoadProbeFromConfig() *SystemLoadProbe {
+	interval := viper.GetDuration("peer.load.sampleInterval")
+	if interval <= 0 {
+		return nil
+	}
+	probe := NewSystemLoadProbe()
+	probe.Start(interval)
+	return probe
+}
+
+// Start samples the load every interval until Stop is called
+func (s *SystemLoadProbe) Start(interval time.Duration) {
+	s.stop = make(chan struct{})
+	s.sample()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.sample()
+			}
+		}
+	}()
+}
+
+// Stop stops sampling the load
+func (s *SystemLoadProbe) Stop() {
+	close(s.stop)
+}
+
+// Score returns the last sampled load, from 0 (idle) to 1 (saturated). A nil probe reports 0.
+func (s *SystemLoadProbe) Score() float32 {
+	if s == nil {
+		return 0
+	}
+	s.Lock()
+	defer s.Unlock()
+	return s.score
+}
+
+func (s *SystemLoadProbe) sample() {
+	s.Lock()
+	defer s.Unlock()
+	data, err := s.readStat()
+	if err == nil {
+		var busy, total uint64
+		if busy, total, err = parseProcStat(data); err == nil {
+			if total > s.prevTotal && s.prevTotal > 0 {
+				s.score = float32(busy-s.prevBusy) / float32(total-s.prevTotal)
+			}
+			s.prevBusy, s.prevTotal = busy, total
+			return
+		}
+	}
+	s.score = float32(runtime.NumGoroutine()) / goroutineCapacity
+	if s.score > 1 {
+		s.score = 1
+	}
+}
+
+// parseProcStat returns the busy and total CPU time of the cpu line of /proc/stat,
+// idle and iowait time not counting as busy
+func parseProcStat(data []byte) (busy, total uint64, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		var idle uint64
+		for i, field := range fields[1:] {
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("Error parsing /proc/stat: %s", err)
+			}
+			total += value
+			if i == 3 || i == 4 {
+				idle += value
+			}
+		}
+		return total - idle, total, nil
+	}
+	return 0, 0, fmt.Errorf("No cpu line in /proc/stat")
+}
+
+// overloaded returns true if the peer advertised a load score of at least peer.load.avoidThreshold
+func overloaded(registry *PeerRegistry, id *pb.PeerID) bool {
+	threshold := viper.GetFloat64("peer.load.avoidThreshold")
+	if threshold <= 0 {
+		return false
+	}
+	entry, ok := registry.Get(id)
+	return ok && float64(entry.LoadScore) >= threshold
+}
+
+// avoidOverloaded moves the overloaded peers after the others, keeping the order otherwise
+func avoidOverloaded(registry *PeerRegistry, peers []*pb.PeerEndpoint) []*pb.PeerEndpoint {
+	return sortPeerEndpoints(peers, func(a, b *pb.PeerEndpoint) bool {
+		return !overloaded(registry, a.ID) && overloaded(registry, b.ID)
+	})
+}
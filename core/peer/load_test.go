@@ -0,0 +1,59 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseProcStat(t *testing.T) {
+	busy, total, err := parseProcStat([]byte("cpu  100 0 50 800 50 0 0 0 0 0\ncpu0 100 0 50 800 50 0 0 0 0 0\n"))
+	if err != nil {
+		t.Fatalf("Error parsing /proc/stat: %s", err)
+	}
+	if busy != 150 || total != 1000 {
+		t.Errorf("Expected 150 busy of 1000, got %d of %d", busy, total)
+	}
+	if _, _, err := parseProcStat([]byte("intr 0\n")); err == nil {
+		t.Error("Expected an error without a cpu line")
+	}
+}
+
+func TestSystemLoadProbe(t *testing.T) {
+	probe := NewSystemLoadProbe()
+	stats := []string{"cpu 100 0 0 900 0\n", "cpu 175 0 0 925 0\n"}
+	probe.readStat = func() ([]byte, error) {
+		stat := stats[0]
+		stats = stats[1:]
+		return []byte(stat), nil
+	}
+	probe.sample()
+	probe.sample()
+	if score := probe.Score(); score != 0.75 {
+		t.Errorf("Expected a load of 0.75, got %f", score)
+	}
+
+	probe.readStat = func() ([]byte, error) { return nil, errors.New("not available") }
+	probe.sample()
+	if score := probe.Score(); score <= 0 || score >= 0.75 {
+		t.Errorf("Expected the goroutine based load to be used, got %f", score)
+	}
+	if score := (*SystemLoadProbe)(nil).Score(); score != 0 {
+		t.Errorf("Expected a nil probe to report 0, got %f", score)
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+var mempoolSizeGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "peer",
+	Name:      "mempool_size",
+	Help:      "Number of transactions submitted through the peer and not yet committed, as of the last CHAIN_QUERY_MEMPOOL.",
+})
+
+func init() {
+	prometheus.MustRegister(mempoolSizeGauge)
+}
+
+// TransactionProcessor interface enables a Peer to answer CHAIN_QUERY_MEMPOOL,
+// CHAIN_ROLLBACK_REQUEST and CHAIN_REPORT_UNCLE messages
+type TransactionProcessor interface {
+	// GetMempool returns up to maxResults pending transactions paying at
+	// least minGasPrice, 0 meaning all of them, and the number of pending
+	// transactions left out
+	GetMempool(maxResults uint32, minGasPrice uint64) ([]*pb.Transaction, uint32, error)
+	// Rollback reverts the committed transactions, returning those rolled
+	// back and those which could not be
+	Rollback(txIDs []string) (rolledBack []string, failed []string)
+	// SelectForBlock returns the pending transactions, highest gas price
+	// first, using up to maxGas in total, 0 meaning no limit
+	SelectForBlock(maxGas uint64) []*pb.Transaction
+	// AddUncle accepts the validated orphan block for inclusion in block
+	// includedIn, returning an error if it cannot be included
+	AddUncle(uncle *pb.Block, includedIn uint64) error
+}
+
+// pendingTransaction is a transaction of the mempool
+type pendingTransaction struct {
+	tx       *pb.Transaction
+	gasPrice uint64
+	seq      uint64
+}
+
+// mempool holds the transactions submitted through this peer until they are
+// found on the blockchain, up to maxTrackedTransactions of them, the oldest
+// being forgotten first
+type mempool struct {
+	sync.Mutex
+	committed func(txID string) bool
+	pending   map[string]*pendingTransaction
+	nextSeq   uint64
+	// auction is the outcome of the last selectForBlock
+	auction Auction
+}
+
+func newMempool(committed func(txID string) bool) *mempool {
+	return &mempool{committed: committed, pending: make(map[string]*pendingTransaction)}
+}
+
+// add puts the submitted transaction in the mempool
+func (m *mempool) add(tx *pb.Transaction) {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.pending[tx.Uuid]; ok {
+		return
+	}
+	if len(m.pending) >= maxTrackedTransactions {
+		var oldest *pendingTransaction
+		for _, p := range m.pending {
+			if oldest == nil || p.seq < oldest.seq {
+				oldest = p
+			}
+		}
+		delete(m.pending, oldest.tx.Uuid)
+	}
+	m.pending[tx.Uuid] = &pendingTransaction{tx: tx, seq: m.nextSeq}
+	m.nextSeq++
+}
+
+// setGasPrice records the gas price of the batch the transaction was submitted in
+func (m *mempool) setGasPrice(txID string, gasPrice uint64) {
+	m.Lock()
+	defer m.Unlock()
+	if p, ok := m.pending[txID]; ok {
+		p.gasPrice = gasPrice
+	}
+}
+
+// list removes the committed transactions from the mempool and returns up to
+// maxResults of the others paying at least minGasPrice, highest gas price
+// first then in the order they were submitted, with the number left out and
+// the size of the mempool
+func (m *mempool) list(maxResults uint32, minGasPrice uint64) ([]*pb.Transaction, uint32, int) {
+	m.Lock()
+	defer m.Unlock()
+	var matching []*pendingTransaction
+	for txID, p := range m.pending {
+		if m.committed(txID) {
+			delete(m.pending, txID)
+		} else if p.gasPrice >= minGasPrice {
+			matching = append(matching, p)
+		}
+	}
+	sort.Sort(byGasPrice(matching))
+	if maxResults > 0 && uint32(len(matching)) > maxResults {
+		matching = matching[:maxResults]
+	}
+	transactions := make([]*pb.Transaction, len(matching))
+	for i, p := range matching {
+		transactions[i] = p.tx
+	}
+	return transactions, uint32(len(m.pending) - len(matching)), len(m.pending)
+}
+
+// byGasPrice sorts pending transactions highest gas price first, then in the order they were submitted
+type byGasPrice []*pendingTransaction
+
+func (s byGasPrice) Len() int      { return len(s) }
+func (s byGasPrice) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byGasPrice) Less(i, j int) bool {
+	if s[i].gasPrice != s[j].gasPrice {
+		return s[i].gasPrice > s[j].gasPrice
+	}
+	return s[i].seq < s[j].seq
+}
+
+// GetMempool returns up to maxResults of the transactions submitted through
+// this peer and not yet committed paying at least minGasPrice, highest gas
+// price first, and the number of pending transactions left out. Transactions
+// submitted on their own rather than in a batch have a gas price of 0.
+func (p *PeerImpl) GetMempool(maxResults uint32, minGasPrice uint64) ([]*pb.Transaction, uint32, error) {
+	transactions, dropped, size := p.mempool.list(maxResults, minGasPrice)
+	mempoolSizeGauge.Set(float64(size))
+	return transactions, dropped, nil
+}
+
+// FetchMempool asks the peer at address for up to maxResults of its pending
+// transactions paying at least minGasPrice, 0 meaning all of them
+func FetchMempool(address string, maxResults uint32, minGasPrice uint64) ([]*pb.Transaction, error) {
+	data, err := proto.Marshal(&pb.QueryMempool{MaxResults: maxResults, MinGasPrice: minGasPrice})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling QueryMempool: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_QUERY_MEMPOOL, Payload: data}
+	reply, err := requestOverChat(address, request, pb.Message_CHAIN_MEMPOOL_RESPONSE)
+	if err != nil {
+		return nil, fmt.Errorf("Error querying the mempool of %s: %s", address, err)
+	}
+	response := &pb.MempoolResponse{}
+	if err := proto.Unmarshal(reply.Payload, response); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling MempoolResponse: %s", err)
+	}
+	return response.Pending, nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestMempoolList(t *testing.T) {
+	committed := map[string]bool{}
+	pool := newMempool(func(txID string) bool { return committed[txID] })
+	for i, gasPrice := range []uint64{5, 10, 1, 10} {
+		txID := fmt.Sprintf("tx%d", i)
+		pool.add(&pb.Transaction{Uuid: txID})
+		pool.setGasPrice(txID, gasPrice)
+	}
+	pool.add(&pb.Transaction{Uuid: "tx0"})
+	committed["tx3"] = true
+
+	transactions, dropped, size := pool.list(0, 0)
+	if size != 3 || dropped != 0 {
+		t.Fatalf("Expected the committed transaction to leave the mempool of 3, got %d with %d dropped", size, dropped)
+	}
+	if txIDs(transactions) != "[tx1 tx0 tx2]" {
+		t.Fatalf("Expected the highest gas price first, got %s", txIDs(transactions))
+	}
+	transactions, dropped, _ = pool.list(1, 2)
+	if txIDs(transactions) != "[tx1]" || dropped != 2 {
+		t.Fatalf("Expected tx1 with 2 left out, got %s with %d", txIDs(transactions), dropped)
+	}
+}
+
+func TestMempoolBounded(t *testing.T) {
+	pool := newMempool(func(string) bool { return false })
+	for i := 0; i <= maxTrackedTransactions; i++ {
+		pool.add(&pb.Transaction{Uuid: fmt.Sprintf("tx%d", i)})
+	}
+	if _, ok := pool.pending["tx0"]; ok || len(pool.pending) != maxTrackedTransactions {
+		t.Fatalf("Expected the oldest transaction to be forgotten, got %d pending", len(pool.pending))
+	}
+}
+
+func TestFetchMempool(t *testing.T) {
+	if _, err := FetchMempool(viper.GetString("peer.address"), 10, 0); err != nil {
+		t.Fatalf("Error fetching the mempool: %s", err)
+	}
+}
+
+func TestMempoolSelectForBlock(t *testing.T) {
+	committed := map[string]bool{}
+	pool := newMempool(func(txID string) bool { return committed[txID] })
+	for i, gasPrice := range []uint64{5, 10, 1, 10, 7} {
+		txID := fmt.Sprintf("tx%d", i)
+		pool.add(&pb.Transaction{Uuid: txID})
+		pool.setGasPrice(txID, gasPrice)
+	}
+	pool.pending["tx1"].tx.Payload = make([]byte, 20)
+	committed["tx3"] = true
+	schedule := gasSchedule{baseGas: 10, gasPerByte: 1}
+	small := schedule.gas(pool.pending["tx0"].tx)
+
+	// tx1 of the highest price is over the gas limit, tx2 over the gas left
+	selected, evicted := pool.selectForBlock(2*small+1, schedule)
+	if txIDs(selected) != "[tx4 tx0]" || evicted != 0 {
+		t.Fatalf("Expected tx4 then tx0 within the gas, got %s with %d evicted", txIDs(selected), evicted)
+	}
+	if auction := pool.lastAuction(); auction.Selected != 2 || auction.Gas != 2*small || auction.MinGasPrice != 5 {
+		t.Fatalf("Expected a minimum winning gas price of 5, got %+v", auction)
+	}
+	if len(pool.pending) != 4 {
+		t.Fatalf("Expected the losing transactions to stay in the mempool, got %d pending", len(pool.pending))
+	}
+	selected, _ = pool.selectForBlock(0, schedule)
+	if txIDs(selected) != "[tx1 tx4 tx0 tx2]" {
+		t.Fatalf("Expected every transaction without a gas limit, got %s", txIDs(selected))
+	}
+}
+
+func TestMempoolAuctionEvictsWhenFull(t *testing.T) {
+	pool := newMempool(func(string) bool { return false })
+	for i := 0; i < maxTrackedTransactions; i++ {
+		pool.add(&pb.Transaction{Uuid: fmt.Sprintf("tx%d", i)})
+	}
+	pool.setGasPrice("tx42", 3)
+	schedule := gasSchedule{baseGas: 1}
+	selected, evicted := pool.selectForBlock(10, schedule)
+	if len(selected) != 10 || selected[0].Uuid != "tx42" || evicted != maxTrackedTransactions-10 {
+		t.Fatalf("Expected 10 transactions selected and the others evicted, got %s with %d evicted", txIDs(selected), evicted)
+	}
+	if len(pool.pending) != 10 {
+		t.Fatalf("Expected the winners to stay in the mempool, got %d pending", len(pool.pending))
+	}
+}
+
+func TestMinGasHandler(t *testing.T) {
+	p := &PeerImpl{mempool: newMempool(func(string) bool { return false })}
+	p.mempool.add(&pb.Transaction{Uuid: "tx0"})
+	p.mempool.setGasPrice("tx0", 4)
+	p.mempool.selectForBlock(0, gasSchedule{baseGas: 2})
+	rec := httptest.NewRecorder()
+	p.MinGasHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/mempool/mingas", nil))
+	auction := Auction{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &auction); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Expected the last auction as JSON, got %d %s", rec.Code, rec.Body.String())
+	}
+	if auction.MinGasPrice != 4 || auction.Selected != 1 || auction.Gas != 2 {
+		t.Fatalf("Unexpected auction %+v", auction)
+	}
+}
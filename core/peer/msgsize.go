@@ -0,0 +1,51 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// getMaxMessageSize returns the largest message this peer accepts, peer.grpc.maxMessageSize, 0 for no limit
+func getMaxMessageSize() int {
+	return viper.GetInt("peer.grpc.maxMessageSize")
+}
+
+// negotiateMaxMessageSize returns the limit of a chat session between peers
+// accepting messages of up to local and remote bytes, a limit of 0 meaning no
+// limit
+func negotiateMaxMessageSize(local, remote int) int {
+	if local <= 0 {
+		return remote
+	}
+	if remote <= 0 || local < remote {
+		return local
+	}
+	return remote
+}
+
+// ValidateTransactionsMessage checks that a CHAIN_TRANSACTIONS message fits
+// the size limit of its chat session, returning a *MessageTooLargeError if it
+// does not. A limit of 0 accepts any size.
+func ValidateTransactionsMessage(msg *pb.Message, maxMessageSize int) error {
+	if size := len(msg.Payload); maxMessageSize > 0 && size > maxMessageSize {
+		return &MessageTooLargeError{Type: msg.Type, Size: size, Limit: maxMessageSize}
+	}
+	return nil
+}
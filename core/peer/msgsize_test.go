@@ -0,0 +1,53 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestNegotiateMaxMessageSize(t *testing.T) {
+	for _, c := range []struct{ local, remote, expected int }{
+		{4 << 20, 1 << 20, 1 << 20},
+		{1 << 20, 4 << 20, 1 << 20},
+		{4 << 20, 0, 4 << 20},
+		{0, 1 << 20, 1 << 20},
+		{0, 0, 0},
+	} {
+		if size := negotiateMaxMessageSize(c.local, c.remote); size != c.expected {
+			t.Errorf("Expected a limit of %d for %d and %d, got %d", c.expected, c.local, c.remote, size)
+		}
+	}
+}
+
+func TestValidateTransactionsMessage(t *testing.T) {
+	msg := &pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS, Payload: make([]byte, 100)}
+	if err := ValidateTransactionsMessage(msg, 100); err != nil {
+		t.Errorf("Expected a message at the limit to be valid, got: %s", err)
+	}
+	if err := ValidateTransactionsMessage(msg, 0); err != nil {
+		t.Errorf("Expected no limit to accept the message, got: %s", err)
+	}
+	err := ValidateTransactionsMessage(msg, 99)
+	if tooLarge, ok := err.(*MessageTooLargeError); !ok {
+		t.Fatalf("Expected a MessageTooLargeError, got: %v", err)
+	} else if tooLarge.Size != 100 || tooLarge.Limit != 99 {
+		t.Errorf("Expected a size of 100 over a limit of 99, got %d over %d", tooLarge.Size, tooLarge.Limit)
+	}
+}
@@ -0,0 +1,202 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"crypto/ecdsa"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/core/crypto/primitives"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// insufficientSignaturesReason is the reason of the CHAIN_TRANSACTIONS_ERROR
+// answering a batch with a transaction missing signatures
+const insufficientSignaturesReason = "insufficient signatures"
+
+// ecdsaAggregateScheme is the scheme of the AggregateSignature keeping the
+// individual ECDSA signatures, no BLS implementation being available
+const ecdsaAggregateScheme = "ecdsa"
+
+// PublicKeyRegistry provides the public keys of the signers of multi-signed transactions
+type PublicKeyRegistry interface {
+	// PublicKey returns the key of the signer, false if unknown
+	PublicKey(signerID string) (*ecdsa.PublicKey, bool)
+}
+
+// StaticPublicKeyRegistry is a PublicKeyRegistry of a fixed set of keys, by signer ID
+type StaticPublicKeyRegistry map[string]*ecdsa.PublicKey
+
+// PublicKey returns the key of the signer
+func (r StaticPublicKeyRegistry) PublicKey(signerID string) (*ecdsa.PublicKey, bool) {
+	key, ok := r[signerID]
+	return key, ok
+}
+
+// newPublicKeyRegistryFromConfig returns the keys of the <signerID>.pem files
+// of peer.tx.multisig.publicKeysPath
+func newPublicKeyRegistryFromConfig() StaticPublicKeyRegistry {
+	dir := viper.GetString("peer.tx.multisig.publicKeysPath")
+	if dir == "" {
+		return make(StaticPublicKeyRegistry)
+	}
+	return loadPublicKeyRegistry(dir)
+}
+
+// loadPublicKeyRegistry returns the keys of the <ID>.pem files of dir, by ID
+func loadPublicKeyRegistry(dir string) StaticPublicKeyRegistry {
+	registry := make(StaticPublicKeyRegistry)
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		peerLogger.Errorf("Error listing the public keys of %s: %s", dir, err)
+		return registry
+	}
+	for _, file := range files {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			peerLogger.Errorf("Error reading public key %s: %s", file, err)
+			continue
+		}
+		key, err := primitives.PEMtoPublicKey(raw, nil)
+		if err != nil {
+			peerLogger.Errorf("Error decoding public key %s: %s", file, err)
+			continue
+		}
+		ecdsaKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			peerLogger.Errorf("Public key %s is not an ECDSA key", file)
+			continue
+		}
+		registry[strings.TrimSuffix(filepath.Base(file), ".pem")] = ecdsaKey
+	}
+	peerLogger.Debugf("Loaded %d public keys from %s", len(registry), dir)
+	return registry
+}
+
+// SignatureAggregatorAccessor interface enables a Peer to hand out its SignatureAggregator
+type SignatureAggregatorAccessor interface {
+	GetSignatureAggregator() *SignatureAggregator
+}
+
+// SignatureAggregator checks the multi-signatures of the transactions of the
+// CHAIN_TRANSACTIONS batches before they are processed
+type SignatureAggregator struct {
+	keys PublicKeyRegistry
+}
+
+// NewSignatureAggregator returns an aggregator verifying signatures against keys
+func NewSignatureAggregator(keys PublicKeyRegistry) *SignatureAggregator {
+	return &SignatureAggregator{keys: keys}
+}
+
+// multisigSigningBytes returns the bytes an IndividualSignature of tx is computed over
+func multisigSigningBytes(tx *pb.Transaction) ([]byte, error) {
+	unsigned := *tx
+	unsigned.Signature = nil
+	return proto.Marshal(&unsigned)
+}
+
+// verifySignature returns true if the signature of tx by signerID is valid
+func (a *SignatureAggregator) verifySignature(tx *pb.Transaction, signerID string, signature []byte) bool {
+	key, ok := a.keys.PublicKey(signerID)
+	if !ok {
+		return false
+	}
+	data, err := multisigSigningBytes(tx)
+	if err != nil {
+		return false
+	}
+	valid, err := primitives.ECDSAVerify(key, data, signature)
+	return err == nil && valid
+}
+
+// Aggregate checks that every transaction of the batch has the valid
+// signatures of at least its RequiredSignatures distinct signers, returning
+// the TransactionsError listing the transactions which do not. When they all
+// do, the signatures of the batch are replaced by an AggregateSignature per
+// transaction of RequiredSignatures of them. The signatures of the
+// AggregateSignature of a batch relayed by a peer which aggregated them
+// already are verified again.
+func (a *SignatureAggregator) Aggregate(batch *pb.TransactionBlock) *pb.TransactionsError {
+	if !requiresSignatures(batch) {
+		return nil
+	}
+	byTx := make(map[string][]*pb.IndividualSignature)
+	for _, signature := range batch.Signatures {
+		byTx[signature.TxID] = append(byTx[signature.TxID], signature)
+	}
+	for _, aggregate := range batch.AggregateSignatures {
+		if aggregate.Scheme != ecdsaAggregateScheme || len(aggregate.SignerIDs) != len(aggregate.Signatures) {
+			continue
+		}
+		for i, signerID := range aggregate.SignerIDs {
+			byTx[aggregate.TxID] = append(byTx[aggregate.TxID], &pb.IndividualSignature{TxID: aggregate.TxID, SignerID: signerID, Signature: aggregate.Signatures[i]})
+		}
+	}
+	var aggregates []*pb.AggregateSignature
+	var insufficient []string
+	for _, tx := range batch.Transactions {
+		if tx.RequiredSignatures == 0 {
+			continue
+		}
+		aggregate := &pb.AggregateSignature{TxID: tx.Uuid, Scheme: ecdsaAggregateScheme}
+		signed := make(map[string]bool)
+		for _, signature := range byTx[tx.Uuid] {
+			if uint32(len(aggregate.SignerIDs)) == tx.RequiredSignatures {
+				break
+			}
+			if signed[signature.SignerID] || !a.verifySignature(tx, signature.SignerID, signature.Signature) {
+				continue
+			}
+			signed[signature.SignerID] = true
+			aggregate.SignerIDs = append(aggregate.SignerIDs, signature.SignerID)
+			aggregate.Signatures = append(aggregate.Signatures, signature.Signature)
+		}
+		if uint32(len(aggregate.SignerIDs)) < tx.RequiredSignatures {
+			peerLogger.Debugf("Transaction %s has %d valid signatures out of the %d required", tx.Uuid, len(aggregate.SignerIDs), tx.RequiredSignatures)
+			insufficient = append(insufficient, tx.Uuid)
+			continue
+		}
+		aggregates = append(aggregates, aggregate)
+	}
+	if len(insufficient) > 0 {
+		return &pb.TransactionsError{Reason: insufficientSignaturesReason, TxIDs: insufficient}
+	}
+	batch.Signatures = nil
+	batch.AggregateSignatures = aggregates
+	return nil
+}
+
+// requiresSignatures returns true if a transaction of the batch requires signatures
+func requiresSignatures(batch *pb.TransactionBlock) bool {
+	for _, tx := range batch.Transactions {
+		if tx.RequiredSignatures > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSignatureAggregator returns the checker of the multi-signatures of the CHAIN_TRANSACTIONS batches
+func (p *PeerImpl) GetSignatureAggregator() *SignatureAggregator {
+	return p.aggregator
+}
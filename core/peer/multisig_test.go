@@ -0,0 +1,106 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/crypto/primitives"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// newMultisigSigners returns count signer keys, signer0 to signer<count-1>,
+// and the registry of their public keys
+func newMultisigSigners(t *testing.T, count int) (map[string]*ecdsa.PrivateKey, StaticPublicKeyRegistry) {
+	primitives.SetSecurityLevel("SHA3", 256)
+	signers := make(map[string]*ecdsa.PrivateKey)
+	keys := make(StaticPublicKeyRegistry)
+	for i := 0; i < count; i++ {
+		key, err := primitives.NewECDSAKey()
+		if err != nil {
+			t.Fatalf("Error generating key: %s", err)
+		}
+		signerID := fmt.Sprintf("signer%d", i)
+		signers[signerID] = key
+		keys[signerID] = &key.PublicKey
+	}
+	return signers, keys
+}
+
+func signMultisig(t *testing.T, tx *pb.Transaction, signerID string, key *ecdsa.PrivateKey) *pb.IndividualSignature {
+	data, err := multisigSigningBytes(tx)
+	if err != nil {
+		t.Fatalf("Error marshalling transaction: %s", err)
+	}
+	signature, err := primitives.ECDSASign(key, data)
+	if err != nil {
+		t.Fatalf("Error signing transaction: %s", err)
+	}
+	return &pb.IndividualSignature{TxID: tx.Uuid, SignerID: signerID, Signature: signature}
+}
+
+func TestSignatureAggregator(t *testing.T) {
+	signers, keys := newMultisigSigners(t, 3)
+	aggregator := NewSignatureAggregator(keys)
+	tx := &pb.Transaction{Uuid: "tx0", RequiredSignatures: 2}
+	plain := &pb.Transaction{Uuid: "tx1"}
+
+	// The same signer twice and a forged signature do not count
+	batch := &pb.TransactionBlock{Transactions: []*pb.Transaction{tx, plain}, Signatures: []*pb.IndividualSignature{
+		signMultisig(t, tx, "signer0", signers["signer0"]),
+		signMultisig(t, tx, "signer0", signers["signer0"]),
+		signMultisig(t, tx, "signer1", signers["signer2"]),
+	}}
+	signatureError := aggregator.Aggregate(batch)
+	if signatureError == nil || signatureError.Reason != insufficientSignaturesReason || fmt.Sprint(signatureError.TxIDs) != "[tx0]" {
+		t.Fatalf("Expected tx0 to have insufficient signatures, got %v", signatureError)
+	}
+
+	batch.Signatures = append(batch.Signatures, signMultisig(t, tx, "signer2", signers["signer2"]), signMultisig(t, tx, "signer1", signers["signer1"]))
+	if err := aggregator.Aggregate(batch); err != nil {
+		t.Fatalf("Expected tx0 to have enough signatures, got %v", err)
+	}
+	if len(batch.Signatures) != 0 || len(batch.AggregateSignatures) != 1 {
+		t.Fatalf("Expected the signatures to be aggregated, got %v and %v", batch.Signatures, batch.AggregateSignatures)
+	}
+	aggregate := batch.AggregateSignatures[0]
+	if aggregate.TxID != "tx0" || aggregate.Scheme != ecdsaAggregateScheme || fmt.Sprint(aggregate.SignerIDs) != "[signer0 signer2]" || len(aggregate.Signatures) != 2 {
+		t.Errorf("Expected the signatures of signer0 and signer2 to be aggregated, got %v", aggregate)
+	}
+
+	// A relaying peer verifies the aggregate again
+	if err := aggregator.Aggregate(batch); err != nil {
+		t.Errorf("Expected the aggregated signatures to verify, got %v", err)
+	}
+	aggregate = batch.AggregateSignatures[0]
+	aggregate.Signatures[1] = aggregate.Signatures[0]
+	if err := aggregator.Aggregate(batch); err == nil {
+		t.Error("Expected a tampered aggregate to be rejected")
+	}
+}
+
+func TestSignatureAggregatorNoneRequired(t *testing.T) {
+	batch := &pb.TransactionBlock{Transactions: []*pb.Transaction{{Uuid: "tx0"}}, Signatures: []*pb.IndividualSignature{{TxID: "tx0", SignerID: "signer0"}}}
+	if err := NewSignatureAggregator(StaticPublicKeyRegistry{}).Aggregate(batch); err != nil {
+		t.Errorf("Expected a batch requiring no signatures to pass, got %v", err)
+	}
+	if len(batch.Signatures) != 1 {
+		t.Error("Expected a batch requiring no signatures to be left as is")
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// nonceFeature has DISC_PEERS replies echo the nonce of the DISC_GET_PEERS
+// they answer
+const nonceFeature = "NONCE"
+
+const (
+	// nonceSize is the size of the nonces of DISC_GET_PEERS requests
+	nonceSize = 16
+
+	// noncePoolSize is the number of nonces a NoncePool generates ahead
+	noncePoolSize = 32
+)
+
+// NoncePoolAccessor interface enables a Peer to hand out the pool of the
+// nonces of its DISC_GET_PEERS requests
+type NoncePoolAccessor interface {
+	GetNoncePool() *NoncePool
+}
+
+// generatedNonce is a nonce and when it was generated or handed out
+type generatedNonce struct {
+	nonce []byte
+	at    time.Time
+}
+
+// NoncePool hands out the random nonces of DISC_GET_PEERS requests,
+// generated ahead in the background to keep crypto/rand off the discovery
+// path, and verifies the nonces echoed in the replies. A nonce verifies once,
+// and only within timeout of being handed out. Nonces generated more than
+// timeout ago are not handed out.
+type NoncePool struct {
+	sync.Mutex
+	timeout time.Duration
+	ready   []generatedNonce
+	issued  map[string]time.Time
+	filling bool
+}
+
+// NewNoncePool returns an empty pool of nonces expiring after timeout
+func NewNoncePool(timeout time.Duration) *NoncePool {
+	return &NoncePool{timeout: timeout, issued: make(map[string]time.Time)}
+}
+
+// newNoncePoolFromConfig returns a pool of nonces expiring after
+// peer.discovery.nonceTimeout, 30s if not set
+func newNoncePoolFromConfig() *NoncePool {
+	timeout := viper.GetDuration("peer.discovery.nonceTimeout")
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return NewNoncePool(timeout)
+}
+
+func newNonce() ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("Error generating nonce: %s", err)
+	}
+	return nonce, nil
+}
+
+// expire forgets the nonces older than the timeout, the lock being held
+func (n *NoncePool) expire(now time.Time) {
+	fresh := n.ready[:0]
+	for _, g := range n.ready {
+		if now.Sub(g.at) <= n.timeout {
+			fresh = append(fresh, g)
+		}
+	}
+	n.ready = fresh
+	for nonce, at := range n.issued {
+		if now.Sub(at) > n.timeout {
+			delete(n.issued, nonce)
+		}
+	}
+}
+
+// Get hands out a nonce, generated ahead if one is ready, and has the pool
+// generate more in the background once it runs low
+func (n *NoncePool) Get() ([]byte, error) {
+	n.Lock()
+	defer n.Unlock()
+	now := time.Now()
+	n.expire(now)
+	var nonce []byte
+	if len(n.ready) > 0 {
+		nonce = n.ready[len(n.ready)-1].nonce
+		n.ready = n.ready[:len(n.ready)-1]
+	} else {
+		var err error
+		if nonce, err = newNonce(); err != nil {
+			return nil, err
+		}
+	}
+	n.issued[string(nonce)] = now
+	if len(n.ready) < noncePoolSize/2 && !n.filling {
+		n.filling = true
+		go n.fill()
+	}
+	return nonce, nil
+}
+
+// fill generates nonces until noncePoolSize are ready
+func (n *NoncePool) fill() {
+	for {
+		nonce, err := newNonce()
+		n.Lock()
+		if err != nil || len(n.ready) >= noncePoolSize {
+			if err != nil {
+				peerLogger.Errorf("Error filling the nonce pool: %s", err)
+			}
+			n.filling = false
+			n.Unlock()
+			return
+		}
+		n.ready = append(n.ready, generatedNonce{nonce: nonce, at: time.Now()})
+		n.Unlock()
+	}
+}
+
+// Verify returns true if nonce was handed out less than the timeout ago and
+// not verified yet, and forgets it
+func (n *NoncePool) Verify(nonce []byte) bool {
+	n.Lock()
+	defer n.Unlock()
+	n.expire(time.Now())
+	if _, ok := n.issued[string(nonce)]; !ok {
+		return false
+	}
+	delete(n.issued, string(nonce))
+	return true
+}
+
+// Outstanding returns the number of nonces handed out and neither verified nor expired
+func (n *NoncePool) Outstanding() int {
+	n.Lock()
+	defer n.Unlock()
+	n.expire(time.Now())
+	return len(n.issued)
+}
+
+// GetNoncePool returns the pool of the nonces of the DISC_GET_PEERS requests of this peer
+func (p *PeerImpl) GetNoncePool() *NoncePool {
+	return p.nonces
+}
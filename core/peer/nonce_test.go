@@ -0,0 +1,75 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNoncePool(t *testing.T) {
+	pool := NewNoncePool(time.Minute)
+	first, err := pool.Get()
+	if err != nil || len(first) != nonceSize {
+		t.Fatalf("Expected a nonce of %d bytes, got %d, %v", nonceSize, len(first), err)
+	}
+	second, _ := pool.Get()
+	if string(first) == string(second) || pool.Outstanding() != 2 {
+		t.Fatalf("Expected 2 distinct outstanding nonces, got %d", pool.Outstanding())
+	}
+	if !pool.Verify(second) || !pool.Verify(first) {
+		t.Fatal("Expected the nonces handed out to verify")
+	}
+	if pool.Verify(first) {
+		t.Error("Expected a replayed nonce not to verify")
+	}
+	if pool.Verify(make([]byte, nonceSize)) || pool.Verify(nil) {
+		t.Error("Expected nonces not handed out not to verify")
+	}
+	// The pool is refilled in the background
+	for i := 0; i < 100; i++ {
+		pool.Lock()
+		ready := len(pool.ready)
+		pool.Unlock()
+		if ready == noncePoolSize {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	pool.Lock()
+	ready := len(pool.ready)
+	pool.Unlock()
+	if ready != noncePoolSize {
+		t.Errorf("Expected %d nonces generated ahead, got %d", noncePoolSize, ready)
+	}
+}
+
+func TestNoncePoolExpiry(t *testing.T) {
+	pool := NewNoncePool(20 * time.Millisecond)
+	nonce, _ := pool.Get()
+	time.Sleep(40 * time.Millisecond)
+	if pool.Verify(nonce) {
+		t.Error("Expected an expired nonce not to verify")
+	}
+	// The nonces generated ahead are not handed out once expired either
+	pool.Lock()
+	defer pool.Unlock()
+	pool.expire(time.Now())
+	if len(pool.ready) != 0 {
+		t.Errorf("Expected the nonces generated more than the timeout ago to be dropped, %d left", len(pool.ready))
+	}
+}
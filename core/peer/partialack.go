@@ -0,0 +1,107 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// BatchResult is the outcome of a CHAIN_TRANSACTIONS batch, some of its
+// transactions possibly committed while others failed
+type BatchResult struct {
+	// Committed are the IDs of the transactions committed, in batch order
+	Committed []string
+	// Failed are the transactions refused or failed, with the reason why
+	Failed []*pb.TxFailure
+	// Receipt is the outcome of waiting for the receipts of the committed
+	// transactions, nil unless they were waited for
+	Receipt *BatchReceipt
+	// Split is the outcome of the parts the batch was sent as, nil unless
+	// it was split
+	Split *SplitSendResult
+}
+
+// newBatchResult returns the result of the batch of which every transaction
+// but the failed ones was committed
+func newBatchResult(batch *pb.TransactionBlock, failed []*pb.TxFailure) *BatchResult {
+	failedIDs := make(map[string]bool)
+	for _, failure := range failed {
+		failedIDs[failure.TxID] = true
+	}
+	result := &BatchResult{Failed: failed}
+	for _, tx := range batch.Transactions {
+		if !failedIDs[tx.Uuid] {
+			result.Committed = append(result.Committed, tx.Uuid)
+		}
+	}
+	return result
+}
+
+// violationFailures returns a failure per transaction with violations, the
+// reason being its first violation
+func violationFailures(violations []*pb.ValidationViolation) []*pb.TxFailure {
+	var failed []*pb.TxFailure
+	seen := make(map[string]bool)
+	for _, violation := range violations {
+		if !seen[violation.TxID] {
+			seen[violation.TxID] = true
+			failed = append(failed, &pb.TxFailure{TxID: violation.TxID, Reason: fmt.Sprintf("%s: %s", violation.Field, violation.Reason)})
+		}
+	}
+	return failed
+}
+
+// processBatchTransactions processes the transactions with process, going on
+// with the following transactions when one fails, and returns which were
+// committed and which failed. progress, if not nil, is called every interval
+// transactions but after the last one.
+func processBatchTransactions(transactions []*pb.Transaction, process func(tx *pb.Transaction) (*pb.Response, error), progress BatchProgressReporter, interval int) *BatchResult {
+	result := &BatchResult{}
+	for i, tx := range transactions {
+		response, err := process(tx)
+		if err == nil && response.Status == pb.Response_FAILURE {
+			err = fmt.Errorf("%s", response.Msg)
+		}
+		if err != nil {
+			peerLogger.Errorf("Error processing transaction %s: %s", tx.Uuid, err)
+			result.Failed = append(result.Failed, &pb.TxFailure{TxID: tx.Uuid, Reason: err.Error()})
+		} else {
+			result.Committed = append(result.Committed, tx.Uuid)
+		}
+		// The reply to the batch follows the last transaction
+		if progress != nil && interval > 0 && (i+1)%interval == 0 && i+1 < len(transactions) {
+			progress(i+1, len(transactions), tx.Uuid)
+		}
+	}
+	return result
+}
+
+// newPartialAck returns the CHAIN_TRANSACTIONS_PARTIAL_ACK reporting the
+// result of a batch, the transactions of validationError failing as well,
+// nil if no transaction processed failed
+func newPartialAck(result *BatchResult, validationError *pb.TransactionsValidationError) *pb.TransactionsPartialAck {
+	if result == nil || len(result.Failed) == 0 {
+		return nil
+	}
+	ack := &pb.TransactionsPartialAck{Committed: result.Committed, Failed: result.Failed}
+	if validationError != nil {
+		ack.Failed = append(violationFailures(validationError.Violations), ack.Failed...)
+	}
+	return ack
+}
@@ -0,0 +1,107 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func newTestTransactionBatch(n int) *pb.TransactionBlock {
+	batch := &pb.TransactionBlock{}
+	for i := 0; i < n; i++ {
+		batch.Transactions = append(batch.Transactions, &pb.Transaction{Uuid: fmt.Sprintf("tx%d", i)})
+	}
+	return batch
+}
+
+// replyToBatch answers the CHAIN_TRANSACTIONS sent on the stream with reply
+func replyToBatch(stream *handshakeStream, replyType pb.Message_Type, reply proto.Message) {
+	<-stream.sent
+	data, _ := proto.Marshal(reply)
+	stream.recv <- &pb.Message{Type: replyType, Payload: data}
+}
+
+func TestBatchPartialCommit(t *testing.T) {
+	batch := newTestTransactionBatch(5)
+	var processed []string
+	result := processBatchTransactions(batch.Transactions, func(tx *pb.Transaction) (*pb.Response, error) {
+		processed = append(processed, tx.Uuid)
+		if tx.Uuid == "tx2" {
+			return &pb.Response{Status: pb.Response_FAILURE, Msg: []byte("out of gas")}, nil
+		}
+		return &pb.Response{Status: pb.Response_SUCCESS}, nil
+	}, nil, 0)
+	if len(processed) != 5 {
+		t.Fatalf("Expected the transactions after the failed one to be processed, processed %v", processed)
+	}
+	committed := []string{"tx0", "tx1", "tx3", "tx4"}
+	if !reflect.DeepEqual(result.Committed, committed) || len(result.Failed) != 1 || result.Failed[0].TxID != "tx2" || result.Failed[0].Reason != "out of gas" {
+		t.Fatalf("Expected tx2 alone to fail, got %v and %v", result.Committed, result.Failed)
+	}
+
+	ack := newPartialAck(result, nil)
+	if ack == nil {
+		t.Fatal("Expected a partial ack of the batch")
+	}
+	stream := &handshakeStream{recv: make(chan *pb.Message, 1), sent: make(chan *pb.Message, 1)}
+	go replyToBatch(stream, pb.Message_CHAIN_TRANSACTIONS_PARTIAL_ACK, ack)
+	received, err := sendTransactionsOverStream(stream, batch, nil, time.Second, 0)
+	if err != nil {
+		t.Fatalf("Error sending the batch: %s", err)
+	}
+	if !reflect.DeepEqual(received.Committed, committed) || len(received.Failed) != 1 || received.Failed[0].TxID != "tx2" {
+		t.Fatalf("Expected the client result to report tx2 failed, got %v and %v", received.Committed, received.Failed)
+	}
+}
+
+func TestNewPartialAck(t *testing.T) {
+	if ack := newPartialAck(&BatchResult{Committed: []string{"tx0"}}, nil); ack != nil {
+		t.Errorf("Expected no partial ack when every transaction was committed, got %v", ack)
+	}
+	if ack := newPartialAck(nil, &pb.TransactionsValidationError{}); ack != nil {
+		t.Errorf("Expected no partial ack without a result, got %v", ack)
+	}
+	validationError := &pb.TransactionsValidationError{Violations: []*pb.ValidationViolation{
+		{TxID: "tx0", Field: "payload", Reason: "required"},
+		{TxID: "tx0", Field: "type", Reason: "invalid"},
+	}}
+	ack := newPartialAck(&BatchResult{Committed: []string{"tx1"}, Failed: []*pb.TxFailure{{TxID: "tx2", Reason: "failed"}}}, validationError)
+	if len(ack.Failed) != 2 || ack.Failed[0].TxID != "tx0" || ack.Failed[0].Reason != "payload: required" || ack.Failed[1].TxID != "tx2" {
+		t.Errorf("Expected the invalid transaction to fail along with the failed one, got %v", ack.Failed)
+	}
+}
+
+func TestSendTransactionsOverStreamResults(t *testing.T) {
+	batch := newTestTransactionBatch(3)
+	stream := &handshakeStream{recv: make(chan *pb.Message, 1), sent: make(chan *pb.Message, 1)}
+	go replyToBatch(stream, pb.Message_RESPONSE, &pb.Response{Status: pb.Response_SUCCESS})
+	if result, err := sendTransactionsOverStream(stream, batch, nil, time.Second, 0); err != nil || len(result.Committed) != 3 || len(result.Failed) != 0 {
+		t.Fatalf("Expected every transaction committed, got %v, %v", result, err)
+	}
+	go replyToBatch(stream, pb.Message_CHAIN_TRANSACTIONS_VALIDATION_ERROR, &pb.TransactionsValidationError{Violations: []*pb.ValidationViolation{{TxID: "tx1", Field: "payload", Reason: "required"}}})
+	result, err := sendTransactionsOverStream(stream, batch, nil, time.Second, 0)
+	if err != nil || !reflect.DeepEqual(result.Committed, []string{"tx0", "tx2"}) || len(result.Failed) != 1 || result.Failed[0].TxID != "tx1" {
+		t.Fatalf("Expected the invalid transaction to fail, got %v, %v", result, err)
+	}
+}
@@ -17,6 +17,9 @@ limitations under the License.
 package peer
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
@@ -28,6 +31,7 @@ import (
 	"golang.org/x/net/context"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/op/go-logging"
@@ -48,6 +52,29 @@ import (
 type Peer interface {
 	GetPeerEndpoint() (*pb.PeerEndpoint, error)
 	NewOpenchainDiscoveryHello() (*pb.Message, error)
+	NewOpenchainDiscoveryHelloWithChallenge(authChallenge []byte) (*pb.Message, error)
+	NewOpenchainDiscoveryHelloWithSession(authChallenge []byte, sessionToken string) (*pb.Message, error)
+}
+
+// LedgerReader interface enables a Peer to answer SYNC_CHECKPOINT, CHAIN_QUERY_TX,
+// CHAIN_GET_BLOCK_PROOF, CHAIN_QUERY_RECENT_TX, CHAIN_QUERY_TX_HISTORY,
+// CHAIN_QUERY_STATE_DIFF, CHAIN_GET_CANONICAL_TIP, CHAIN_QUERY_FORK_CHOICE,
+// CHAIN_GET_BLOCK_BY_HASH, CHAIN_QUERY_CONTRACT_STATE, CHAIN_QUERY_EPOCH and
+// CHAIN_QUERY_ACCOUNT messages
+type LedgerReader interface {
+	VerifyCheckpoint(blockNumber uint64, hash []byte) bool
+	GetTransaction(txID string) (*pb.Transaction, uint64, uint32, error)
+	GetSPVProof(blockNumber uint64, externalChainID string) (*pb.SPVProof, error)
+	GetRecentTransactions(accountID string, maxCount uint32, before *pb.RecentTransactionsCursor) ([]*pb.Transaction, *pb.RecentTransactionsCursor, error)
+	GetTransactionHistory(accountID string, fromTime, toTime int64, maxResults uint32, cursorTxID string) ([]*pb.Transaction, uint32, error)
+	GetStateDiff(blockNumber uint64) ([]*pb.StateChange, error)
+	FindDoubleSpend(input *pb.TxOutPoint) (*SpendRecord, error)
+	GetCanonicalTip() (*ChainTip, error)
+	GetBlockByHash(hash []byte) (*pb.Block, uint64, error)
+	GetContractState(contractAddress, key string, atBlock uint64) (value []byte, exists bool, stateBlock uint64, err error)
+	GetEpoch(n uint64) (*pb.EpochResponse, error)
+	GetStakingInfo(validatorAddress string) (*pb.StakingInfo, error)
+	GetAccount(accountID string) (*pb.AccountState, error)
 }
 
 // BlocksRetriever interface for retrieving blocks .
@@ -121,6 +148,44 @@ type MessageHandlerCoordinator interface {
 	PeersDiscovered(*pb.PeersMessage) error
 	ExecuteTransaction(transaction *pb.Transaction) *pb.Response
 	Discoverer
+	GossipAccessor
+	GetPeersRateLimiter
+	PeerRegistryAccessor
+	PeerSorterAccessor
+	TransactionStateAccessor
+	ReceiptIssuer
+	BlockHeaderReader
+	ConfidentialTransactionProcessor
+	TransactionProofProvider
+	StateRootReader
+	LedgerReader
+	BlockEventBusAccessor
+	TransactionBatchProcessor
+	LatencyTrackerAccessor
+	BanListAccessor
+	TransactionVerifier
+	TopologyReader
+	GasPriceOracleAccessor
+	TokenValidatorAccessor
+	BlockAnnouncerAccessor
+	SignatureAggregatorAccessor
+	ForwardingChainChecker
+	PoWValidatorAccessor
+	ZKProofVerifierAccessor
+	TransactionValidator
+	TransactionProcessor
+	ProcessorRegistryAccessor
+	BandwidthFairQueueAccessor
+	NoncePoolAccessor
+	SessionTokenStoreAccessor
+	IdempotencyCacheAccessor
+	ChannelRouterAccessor
+}
+
+// GossipAccessor interface enables a Peer to hand out its transaction gossip propagator
+type GossipAccessor interface {
+	// GetGossipPropagator returns nil if transaction gossip is disabled
+	GetGossipPropagator() *GossipTransactionPropagator
 }
 
 // ChatStream interface supported by stream between Peers
@@ -129,6 +194,10 @@ type ChatStream interface {
 	Recv() (*pb.Message, error)
 }
 
+// wrapChatStream, if set, wraps every stream a Chat is handled on. It is only
+// set by test builds.
+var wrapChatStream func(ChatStream) ChatStream
+
 // SecurityAccessor interface enables a Peer to hand out the crypto object for Peer
 type SecurityAccessor interface {
 	GetSecHelper() crypto.Peer
@@ -158,12 +227,64 @@ func GetLocalIP() string {
 	return ""
 }
 
+// DialInterceptor rewrites a peer address before it is dialed, for instance
+// to translate internal service names to external addresses
+type DialInterceptor func(address string) string
+
+var dialInterceptor struct {
+	sync.RWMutex
+	rewrite DialInterceptor
+}
+
+// SetDialInterceptor sets the interceptor NewPeerClientConnectionWithAddress
+// rewrites addresses with. nil, the default, dials addresses unchanged. The
+// addresses kept in the registry and discovery list are not rewritten.
+func SetDialInterceptor(interceptor DialInterceptor) {
+	dialInterceptor.Lock()
+	defer dialInterceptor.Unlock()
+	dialInterceptor.rewrite = interceptor
+}
+
+func interceptDial(address string) string {
+	dialInterceptor.RLock()
+	defer dialInterceptor.RUnlock()
+	if dialInterceptor.rewrite == nil {
+		return address
+	}
+	return dialInterceptor.rewrite(address)
+}
+
 // NewPeerClientConnectionWithAddress Returns a new grpc.ClientConn to the configured local PEER.
+// The dial first takes a token from GlobalReconnectLimiter.
 func NewPeerClientConnectionWithAddress(peerAddress string) (*grpc.ClientConn, error) {
+	if err := GlobalReconnectLimiter().Acquire(); err != nil {
+		peerLogger.Warningf("Not dialing %s: %s", peerAddress, err)
+		return nil, err
+	}
+	if rewritten := interceptDial(peerAddress); rewritten != peerAddress {
+		peerLogger.Debugf("Dialing %s for peer address %s", rewritten, peerAddress)
+		peerAddress = rewritten
+	}
+	return GetAdaptiveDialer().Dial(peerAddress)
+}
+
+// initialDialTimeout is the timeout of the first dial of a peer address
+const initialDialTimeout = comm.DefaultTimeout
+
+// dialPeer connects to the peer at address within timeout, through the Tor
+// SOCKS5 proxy at peer.tor.socksAddress for onion addresses if Tor is enabled
+func dialPeer(peerAddress string, timeout time.Duration) (*grpc.ClientConn, error) {
+	var opts []grpc.DialOption
+	if torEnabled() && isOnionAddress(peerAddress) {
+		socksAddress := viper.GetString("peer.tor.socksAddress")
+		opts = append(opts, grpc.WithDialer(func(address string, timeout time.Duration) (net.Conn, error) {
+			return dialSOCKS5(socksAddress, address, timeout)
+		}))
+	}
 	if comm.TLSEnabled() {
-		return comm.NewClientConnectionWithAddress(peerAddress, true, true, comm.InitTLSForPeer())
+		return comm.NewClientConnectionWithAddressAndTimeout(peerAddress, true, true, comm.InitTLSForPeer(), timeout, opts...)
 	}
-	return comm.NewClientConnectionWithAddress(peerAddress, true, false, nil)
+	return comm.NewClientConnectionWithAddressAndTimeout(peerAddress, true, false, nil, timeout, opts...)
 }
 
 type ledgerWrapper struct {
@@ -193,6 +314,55 @@ type PeerImpl struct {
 	reconnectOnce  sync.Once
 	discHelper     discovery.Discovery
 	discPersist    bool
+	gossiper       *GossipTransactionPropagator
+	peersLimiter   *getPeersLimiter
+	tpsLimiter     *TPSLimiter
+	perPeerLimiter *PerPeerRateLimiter
+	watermarks     *WatermarkMonitor
+	registry       *PeerRegistry
+	peerSorter     PeerSorter
+	optionsMutex   sync.RWMutex // Guards the injectable options
+	txTracker      *transactionStateTracker
+	mempool        *mempool
+	uncles         *uncleSet
+	txStateStore   TransactionStateStore
+	slaTracker     *SLATracker
+	router         *MessageRouter
+	encryptionKey  *ecdsa.PrivateKey
+	backoff        *peerBackoff
+	loadProbe      *SystemLoadProbe
+	blockBus       *BlockEventBus
+	txValidator    *SchemaValidator
+	tsValidator    *TimestampValidator
+	conflicts      *ConflictDetector
+	latencyTracker *LatencyTracker
+	relay          *ForwardingProcessor
+	banList        *BanList
+	misbehavior    *MisbehaviorScorer
+	startTime      time.Time
+	integrity      *BlockIntegrityChecker
+	gasOracle      GasPriceOracle
+	authValidator  TokenValidator
+	recorder       *RecorderMiddleware
+	announcer      *BlockAnnouncer
+	syncBandwidth  *BandwidthFairQueue
+	epochs         *EpochSchedule
+	nonces         *NoncePool
+	sessions       *SessionTokenStore
+	chatSessions   *ChatSessionStore
+	idempotency    *IdempotencyCache
+	aggregator     *SignatureAggregator
+	processors     *ProcessorRegistry
+	channels       *ChannelRouter
+	forwardingKeys StaticPublicKeyRegistry
+	utxoIndex      UTXOIndex
+	stakes         StakingLedger
+	accounts       AccountLedger
+	powValidator   PoWValidator
+	zkVerifier     ZKProofVerifier
+	connBudget     *ConnectionBudget
+	drainer        *chatDrainer
+	rollbacker     LedgerRollbacker
 }
 
 // TransactionProccesor responsible for processing of Transactions
@@ -209,8 +379,12 @@ type Engine interface {
 }
 
 // NewPeerWithHandler returns a Peer which uses the supplied handler factory function for creating new handlers on new Chat service invocations.
-func NewPeerWithHandler(secHelperFunc func() crypto.Peer, handlerFact HandlerFactory) (*PeerImpl, error) {
-	peer := new(PeerImpl)
+func NewPeerWithHandler(secHelperFunc func() crypto.Peer, handlerFact HandlerFactory) (peer *PeerImpl, err error) {
+	if err := ValidatePeerConfig(newPeerConnectionConfigFromViper()); err != nil {
+		return nil, err
+	}
+	peer = new(PeerImpl)
+	peer.startTime = time.Now()
 	peerNodes := peer.initDiscovery()
 
 	if handlerFact == nil {
@@ -218,6 +392,57 @@ func NewPeerWithHandler(secHelperFunc func() crypto.Peer, handlerFact HandlerFac
 	}
 	peer.handlerFactory = handlerFact
 	peer.handlerMap = &handlerMap{m: make(map[pb.PeerID]MessageHandler)}
+	peer.router = newDefaultMessageRouter()
+	peer.peersLimiter = newGetPeersLimiterFromConfig()
+	peer.tpsLimiter = newTPSLimiterFromConfig()
+	peer.perPeerLimiter = newPerPeerRateLimiterFromConfig()
+	peer.perPeerLimiter.Start()
+	peer.watermarks = newWatermarkMonitorFromConfig()
+	peer.drainer = newChatDrainer()
+	peer.registry = newPeerRegistryFromConfig()
+	go peer.registry.expireEvery(registryExpiryInterval)
+	peer.backoff = newPeerBackoff()
+	peer.loadProbe = newSystemLoadProbeFromConfig()
+	peer.blockBus = NewBlockEventBus()
+	peer.latencyTracker = newLatencyTrackerFromConfig()
+	peer.banList = newBanListFromConfig()
+	peer.gasOracle = ViperGasPriceOracle{}
+	peer.powValidator = SHA256dPoWValidator{}
+	peer.connBudget = newConnectionBudgetFromConfig()
+	peer.authValidator = newTokenValidatorFromConfig()
+	peer.recorder = newRecorderMiddlewareFromConfig()
+	peer.aggregator = NewSignatureAggregator(newPublicKeyRegistryFromConfig())
+	peer.processors = NewProcessorRegistry()
+	peer.processors.Register(nativeExecutionEnv, peer)
+	peer.channels = newChannelRouterFromConfig()
+	peer.forwardingKeys = newForwardingKeysFromConfig()
+	peer.announcer = NewBlockAnnouncer(peer.GetPeerEndpoint, func(msg *pb.Message) []error { return peer.Broadcast(msg, pb.PeerEndpoint_UNDEFINED) })
+	peer.syncBandwidth = NewBandwidthFairQueue()
+	peer.nonces = newNoncePoolFromConfig()
+	peer.idempotency = newIdempotencyCacheFromConfig()
+	peer.chatSessions = newChatSessionStoreFromConfig()
+	peer.misbehavior = newMisbehaviorScorerFromConfig()
+	if peer.relay, err = newForwardingProcessorFromConfig(); err != nil {
+		return nil, err
+	}
+	if peer.txValidator, err = newSchemaValidatorFromConfig(); err != nil {
+		return nil, err
+	}
+	if peer.tsValidator, err = newTimestampValidatorFromConfig(); err != nil {
+		return nil, err
+	}
+	if peer.epochs, err = newEpochScheduleFromConfig(); err != nil {
+		return nil, err
+	}
+	if peer.sessions, err = newSessionTokenStoreFromConfig(); err != nil {
+		return nil, err
+	}
+	peer.slaTracker = newSLATrackerFromConfig()
+	sorter, err := newPeerSorterFromConfig(peer.registry)
+	if err != nil {
+		return nil, err
+	}
+	peer.peerSorter = sorter
 
 	peer.secHelper = secHelperFunc()
 
@@ -227,23 +452,103 @@ func NewPeerWithHandler(secHelperFunc func() crypto.Peer, handlerFact HandlerFac
 			return nil, fmt.Errorf("Security helper not provided")
 		}
 	}
+	if peer.relay != nil && peer.secHelper != nil {
+		peer.relay.sign = peer.secHelper.Sign
+	}
+	if peer.secHelper != nil {
+		setVoteVerifier(peer.secHelper.Verify)
+		setRequestSigner(peer.secHelper.GetID(), peer.secHelper.Sign)
+	}
 
 	ledgerPtr, err := ledger.GetLedger()
 	if err != nil {
 		return nil, fmt.Errorf("Error constructing NewPeerWithHandler: %s", err)
 	}
 	peer.ledgerWrapper = &ledgerWrapper{ledger: ledgerPtr}
-
+	peer.txTracker = newTransactionStateTracker(peer.isTransactionCommitted)
+	peer.mempool = newMempool(peer.isTransactionCommitted)
+	peer.uncles = newUncleSet(viper.GetInt("peer.uncle.maxPerBlock"))
+	if peer.conflicts, err = newConflictDetectorFromConfig(peer.isTransactionCommitted); err != nil {
+		return nil, err
+	}
+	// Probe the STUN server, if any, before the first DISC_HELLO is sent
+	getExternalAddress()
+	peer.txStateStore = peer.txTracker
+	peer.gossiper = newGossipTransactionPropagatorFromConfig(peer, nil)
+
+	peer.integrity = newBlockIntegrityCheckerFromConfig(peer)
+	if interval := viper.GetDuration("peer.integrity.interval"); interval > 0 {
+		peer.integrity.Start(interval)
+	}
+	if interval := viper.GetDuration("peer.discovery.pingInterval"); interval > 0 {
+		NewHeartbeatDialer(func(msg *pb.Message) []error { return peer.Broadcast(msg, pb.PeerEndpoint_UNDEFINED) }).Start(interval)
+	}
+	go warmConnectionPoolFromConfig(peerNodes)
 	peer.chatWithSomePeers(peerNodes)
 	return peer, nil
 }
 
 // NewPeerWithEngine returns a Peer which uses the supplied handler factory function for creating new handlers on new Chat service invocations.
 func NewPeerWithEngine(secHelperFunc func() crypto.Peer, engFactory EngineFactory) (peer *PeerImpl, err error) {
+	if err := ValidatePeerConfig(newPeerConnectionConfigFromViper()); err != nil {
+		return nil, err
+	}
 	peer = new(PeerImpl)
+	peer.startTime = time.Now()
 	peerNodes := peer.initDiscovery()
 
 	peer.handlerMap = &handlerMap{m: make(map[pb.PeerID]MessageHandler)}
+	peer.router = newDefaultMessageRouter()
+	peer.peersLimiter = newGetPeersLimiterFromConfig()
+	peer.tpsLimiter = newTPSLimiterFromConfig()
+	peer.perPeerLimiter = newPerPeerRateLimiterFromConfig()
+	peer.perPeerLimiter.Start()
+	peer.watermarks = newWatermarkMonitorFromConfig()
+	peer.drainer = newChatDrainer()
+	peer.registry = newPeerRegistryFromConfig()
+	go peer.registry.expireEvery(registryExpiryInterval)
+	peer.backoff = newPeerBackoff()
+	peer.loadProbe = newSystemLoadProbeFromConfig()
+	peer.blockBus = NewBlockEventBus()
+	peer.latencyTracker = newLatencyTrackerFromConfig()
+	peer.banList = newBanListFromConfig()
+	peer.gasOracle = ViperGasPriceOracle{}
+	peer.powValidator = SHA256dPoWValidator{}
+	peer.connBudget = newConnectionBudgetFromConfig()
+	peer.authValidator = newTokenValidatorFromConfig()
+	peer.recorder = newRecorderMiddlewareFromConfig()
+	peer.aggregator = NewSignatureAggregator(newPublicKeyRegistryFromConfig())
+	peer.processors = NewProcessorRegistry()
+	peer.processors.Register(nativeExecutionEnv, peer)
+	peer.channels = newChannelRouterFromConfig()
+	peer.forwardingKeys = newForwardingKeysFromConfig()
+	peer.announcer = NewBlockAnnouncer(peer.GetPeerEndpoint, func(msg *pb.Message) []error { return peer.Broadcast(msg, pb.PeerEndpoint_UNDEFINED) })
+	peer.syncBandwidth = NewBandwidthFairQueue()
+	peer.nonces = newNoncePoolFromConfig()
+	peer.idempotency = newIdempotencyCacheFromConfig()
+	peer.chatSessions = newChatSessionStoreFromConfig()
+	peer.misbehavior = newMisbehaviorScorerFromConfig()
+	if peer.relay, err = newForwardingProcessorFromConfig(); err != nil {
+		return nil, err
+	}
+	if peer.txValidator, err = newSchemaValidatorFromConfig(); err != nil {
+		return nil, err
+	}
+	if peer.tsValidator, err = newTimestampValidatorFromConfig(); err != nil {
+		return nil, err
+	}
+	if peer.epochs, err = newEpochScheduleFromConfig(); err != nil {
+		return nil, err
+	}
+	if peer.sessions, err = newSessionTokenStoreFromConfig(); err != nil {
+		return nil, err
+	}
+	peer.slaTracker = newSLATrackerFromConfig()
+	sorter, err := newPeerSorterFromConfig(peer.registry)
+	if err != nil {
+		return nil, err
+	}
+	peer.peerSorter = sorter
 
 	peer.isValidator = ValidatorEnabled()
 	peer.secHelper = secHelperFunc()
@@ -254,6 +559,13 @@ func NewPeerWithEngine(secHelperFunc func() crypto.Peer, engFactory EngineFactor
 			return nil, fmt.Errorf("Security helper not provided")
 		}
 	}
+	if peer.relay != nil && peer.secHelper != nil {
+		peer.relay.sign = peer.secHelper.Sign
+	}
+	if peer.secHelper != nil {
+		setVoteVerifier(peer.secHelper.Verify)
+		setRequestSigner(peer.secHelper.GetID(), peer.secHelper.Sign)
+	}
 
 	// Initialize the ledger before the engine, as consensus may want to begin interrogating the ledger immediately
 	ledgerPtr, err := ledger.GetLedger()
@@ -261,6 +573,15 @@ func NewPeerWithEngine(secHelperFunc func() crypto.Peer, engFactory EngineFactor
 		return nil, fmt.Errorf("Error constructing NewPeerWithHandler: %s", err)
 	}
 	peer.ledgerWrapper = &ledgerWrapper{ledger: ledgerPtr}
+	peer.txTracker = newTransactionStateTracker(peer.isTransactionCommitted)
+	peer.mempool = newMempool(peer.isTransactionCommitted)
+	peer.uncles = newUncleSet(viper.GetInt("peer.uncle.maxPerBlock"))
+	if peer.conflicts, err = newConflictDetectorFromConfig(peer.isTransactionCommitted); err != nil {
+		return nil, err
+	}
+	// Probe the STUN server, if any, before the first DISC_HELLO is sent
+	getExternalAddress()
+	peer.txStateStore = peer.txTracker
 
 	peer.engine, err = engFactory(peer)
 	if err != nil {
@@ -271,6 +592,20 @@ func NewPeerWithEngine(secHelperFunc func() crypto.Peer, engFactory EngineFactor
 		return nil, errors.New("Cannot supply nil handler factory")
 	}
 
+	var deliver func(*pb.Transaction)
+	if peer.isValidator {
+		deliver = func(tx *pb.Transaction) { peer.sendTransactionsToLocalEngine(tx) }
+	}
+	peer.gossiper = newGossipTransactionPropagatorFromConfig(peer, deliver)
+
+	peer.integrity = newBlockIntegrityCheckerFromConfig(peer)
+	if interval := viper.GetDuration("peer.integrity.interval"); interval > 0 {
+		peer.integrity.Start(interval)
+	}
+	if interval := viper.GetDuration("peer.discovery.pingInterval"); interval > 0 {
+		NewHeartbeatDialer(func(msg *pb.Message) []error { return peer.Broadcast(msg, pb.PeerEndpoint_UNDEFINED) }).Start(interval)
+	}
+	go warmConnectionPoolFromConfig(peerNodes)
 	peer.chatWithSomePeers(peerNodes)
 	return peer, nil
 
@@ -278,12 +613,29 @@ func NewPeerWithEngine(secHelperFunc func() crypto.Peer, engFactory EngineFactor
 
 // Chat implementation of the the Chat bidi streaming RPC function
 func (p *PeerImpl) Chat(stream pb.Peer_ChatServer) error {
+	if p.drainer.isDraining() {
+		return errDraining
+	}
 	return p.handleChat(stream.Context(), stream, false)
 }
 
 // ProcessTransaction implementation of the ProcessTransaction RPC function
 func (p *PeerImpl) ProcessTransaction(ctx context.Context, tx *pb.Transaction) (response *pb.Response, err error) {
 	peerLogger.Debugf("ProcessTransaction processing transaction uuid = %s", tx.Uuid)
+	p.optionsMutex.RLock()
+	limiter := p.tpsLimiter
+	p.optionsMutex.RUnlock()
+	if err := p.perPeerLimiter.Wait(ctx, remoteAddress(ctx)); err != nil {
+		return nil, err
+	}
+	if err := limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return p.processTransaction(tx)
+}
+
+// processTransaction is ProcessTransaction without the peer.tx.maxTPS limiter
+func (p *PeerImpl) processTransaction(tx *pb.Transaction) (response *pb.Response, err error) {
 	// Need to validate the Tx's signature if we are a validator.
 	if p.isValidator {
 		// Verify transaction signature if security is enabled
@@ -300,7 +652,10 @@ func (p *PeerImpl) ProcessTransaction(ctx context.Context, tx *pb.Transaction) (
 	return p.ExecuteTransaction(tx), err
 }
 
-// GetPeers returns the currently registered PeerEndpoints
+// GetPeers returns the currently registered PeerEndpoints, those of the peers
+// whose DISC_HELLO exchange completed. The peer.discovery.rootnode peers are
+// only listed once a Chat with them is established, until then they are only
+// in the discovery list of the touch service.
 func (p *PeerImpl) GetPeers() (*pb.PeersMessage, error) {
 	p.handlerMap.RLock()
 	defer p.handlerMap.RUnlock()
@@ -349,6 +704,11 @@ func (p *PeerImpl) PeersDiscovered(peersMessage *pb.PeersMessage) error {
 		if *getHandlerKeyFromPeerEndpoint(thisPeersEndpoint) == *getHandlerKeyFromPeerEndpoint(peerEndpoint) {
 			// NOOP
 		} else if _, ok := p.handlerMap.m[*getHandlerKeyFromPeerEndpoint(peerEndpoint)]; ok == false {
+			// A peer of a registered pkiID is already chatted with under another ID
+			if entry, registered := p.registry.FindByFingerprint(PeerFingerprint(peerEndpoint.PkiID)); registered {
+				peerLogger.Debugf("Not chatting with %s at %s, registered as %s", peerEndpoint.ID.Name, peerEndpoint.Address, entry.Endpoint.ID.Name)
+				continue
+			}
 			// Start chat with Peer
 			p.chatWithSomePeers([]string{peerEndpoint.Address})
 		}
@@ -381,6 +741,10 @@ func (p *PeerImpl) RegisterHandler(messageHandler MessageHandler) error {
 		return newDuplicateHandlerError(messageHandler)
 	}
 	p.handlerMap.m[*key] = messageHandler
+	if peerEndpoint, err := messageHandler.To(); err == nil {
+		p.registry.Add(&peerEndpoint)
+		p.slaTracker.Record(peerEndpoint.Address, true)
+	}
 	peerLogger.Debugf("registered handler with key: %s", key)
 	return nil
 }
@@ -398,6 +762,10 @@ func (p *PeerImpl) DeregisterHandler(messageHandler MessageHandler) error {
 		return fmt.Errorf("Error deregistering handler, could not find handler with key: %s", key)
 	}
 	delete(p.handlerMap.m, *key)
+	p.registry.Remove(key)
+	if peerEndpoint, err := messageHandler.To(); err == nil {
+		p.slaTracker.Record(peerEndpoint.Address, false)
+	}
 	peerLogger.Debugf("Deregistered handler with key: %s", key)
 	return nil
 }
@@ -439,7 +807,7 @@ func (p *PeerImpl) Broadcast(msg *pb.Message, typ pb.PeerEndpoint_Type) []error
 			err := msgHandler.SendMessage(msg)
 			if err != nil {
 				toPeerEndpoint, _ := msgHandler.To()
-				errorsFromHandlers <- fmt.Errorf("Error broadcasting msg (%s) to PeerEndpoint (%s): %s", msg.Type, toPeerEndpoint, err)
+				errorsFromHandlers <- fmt.Errorf("Error broadcasting msg (%s) to PeerEndpoint (%v): %s", msg.Type, toPeerEndpoint, err)
 			}
 			peerLogger.Debugf("Sending %d bytes to %s took %v", len(msg.Payload), host.Address, time.Since(t1))
 
@@ -478,18 +846,20 @@ func (p *PeerImpl) Unicast(msg *pb.Message, receiverHandle *pb.PeerID) error {
 	err = msgHandler.SendMessage(msg)
 	if err != nil {
 		toPeerEndpoint, _ := msgHandler.To()
-		return fmt.Errorf("Error unicasting msg (%s) to PeerEndpoint (%s): %s", msg.Type, toPeerEndpoint, err)
+		return fmt.Errorf("Error unicasting msg (%s) to PeerEndpoint (%v): %s", msg.Type, toPeerEndpoint, err)
 	}
 	return nil
 }
 
-// SendTransactionsToPeer forwards transactions to the specified peer address.
+// SendTransactionsToPeer forwards transactions to the specified peer address,
+// over a connection of DefaultPeerConnectionPool.
 func (p *PeerImpl) SendTransactionsToPeer(peerAddress string, transaction *pb.Transaction) (response *pb.Response) {
-	conn, err := NewPeerClientConnectionWithAddress(peerAddress)
+	pool := DefaultPeerConnectionPool()
+	conn, err := pool.Get(peerAddress)
 	if err != nil {
 		return &pb.Response{Status: pb.Response_FAILURE, Msg: []byte(fmt.Sprintf("Error creating client to peer address=%s:  %s", peerAddress, err))}
 	}
-	defer conn.Close()
+	defer pool.Release(peerAddress, conn)
 	serverClient := pb.NewPeerClient(conn)
 	peerLogger.Debugf("Sending TX to Peer: %s", peerAddress)
 	response, err = serverClient.ProcessTransaction(context.Background(), transaction)
@@ -499,6 +869,21 @@ func (p *PeerImpl) SendTransactionsToPeer(peerAddress string, transaction *pb.Tr
 	return response
 }
 
+// selectTransactionPeer returns the address of a random known peer, avoiding
+// the connected peers which advertised a load above peer.load.avoidThreshold
+func (p *PeerImpl) selectTransactionPeer() string {
+	registered := make(map[string]*pb.PeerID)
+	for _, entry := range p.registry.Entries() {
+		registered[entry.Endpoint.Address] = entry.Endpoint.ID
+	}
+	for _, address := range p.discHelper.GetAllNodes() { // these will always be returned in random order
+		if id, ok := registered[address]; !ok || !overloaded(p.registry, id) {
+			return address
+		}
+	}
+	return p.discHelper.GetRandomNodes(1)[0]
+}
+
 // sendTransactionsToLocalEngine send the transaction to the local engine (This Peer is a validator)
 func (p *PeerImpl) sendTransactionsToLocalEngine(transaction *pb.Transaction) *pb.Response {
 
@@ -518,12 +903,20 @@ func (p *PeerImpl) sendTransactionsToLocalEngine(transaction *pb.Transaction) *p
 
 func (p *PeerImpl) ensureConnected() {
 	touchPeriod := viper.GetDuration("peer.discovery.touchPeriod")
-	touchMaxNodes := viper.GetInt("peer.discovery.touchMaxNodes")
-	tickChan := time.NewTicker(touchPeriod).C
+	ticker := time.NewTicker(touchPeriod)
 	peerLogger.Debugf("Starting Peer reconnect service (touch service), with period = %s", touchPeriod)
 	for {
 		// Simply loop and check if need to reconnect
-		<-tickChan
+		<-ticker.C
+		// The settings are read on every tick so that a configuration reload applies
+		config := currentReloadableConfig()
+		if period := config.TouchPeriod; period > 0 && period != touchPeriod {
+			peerLogger.Debugf("Touch service period changed from %s to %s", touchPeriod, period)
+			ticker.Stop()
+			touchPeriod = period
+			ticker = time.NewTicker(touchPeriod)
+		}
+		touchMaxNodes := config.TouchMaxNodes
 		peersMsg, err := p.GetPeers()
 		if err != nil {
 			peerLogger.Errorf("Error in touch service: %s", err.Error())
@@ -539,6 +932,7 @@ func (p *PeerImpl) ensureConnected() {
 		} else {
 			peerLogger.Debug("Touch service indicates no dropped connections")
 		}
+		p.ensureSubnetDiversity(getPeerAddresses(peersMsg))
 		peerLogger.Debugf("Connected to: %v", getPeerAddresses(peersMsg))
 		peerLogger.Debugf("Discovery knows about: %v", allNodes)
 	}
@@ -565,13 +959,37 @@ func (p *PeerImpl) chatWithSomePeers(addresses []string) {
 			peerLogger.Errorf("Failed to obtain peer endpoint, %v", err)
 			return
 		}
+		if p.backoff.active(address) {
+			peerLogger.Debugf("Skipping address %v, its registry was full", address)
+			continue
+		}
+		if host, _, err := net.SplitHostPort(address); err == nil && p.banList.Banned(host) {
+			peerLogger.Debugf("Skipping banned address %v", address)
+			continue
+		}
 		go p.chatWithPeer(address)
 	}
 }
 
 func (p *PeerImpl) chatWithPeer(address string) error {
+	if !p.connBudget.TryAcquire() {
+		peerLogger.Warningf("Not dialing peer address %s, the %d outbound connections of peer.chat.maxOutbound are in use", address, p.connBudget.InUse())
+		return fmt.Errorf("Outbound connection budget exhausted")
+	}
+	defer p.connBudget.Release()
+	if p.drainer.isDraining() {
+		peerLogger.Debugf("Not dialing peer address %s while draining", address)
+		return errDraining
+	}
 	peerLogger.Debugf("Initiating Chat with peer address: %s", address)
-	conn, err := NewPeerClientConnectionWithAddress(address)
+	dialAddress := address
+	if p.gossiper != nil {
+		dialAddress = p.gossiper.dialAddress(address)
+		if !probeBeforeGossip(dialAddress) {
+			return fmt.Errorf("Peer %s is unhealthy", address)
+		}
+	}
+	conn, err := NewPeerClientConnectionWithAddress(dialAddress)
 	if err != nil {
 		peerLogger.Errorf("Error creating connection to peer address %s: %s", address, err)
 		return err
@@ -584,8 +1002,11 @@ func (p *PeerImpl) chatWithPeer(address string) error {
 		return err
 	}
 	peerLogger.Debugf("Established Chat with peer address: %s", address)
-	err = p.handleChat(ctx, stream, true)
+	err = p.handleChat(withSessionToken(ctx, p.sessions.Held(address)), stream, true)
 	stream.CloseSend()
+	if registryFull, ok := err.(*RegistryFullError); ok {
+		p.backoff.set(address, registryFull.RetryAfter)
+	}
 	if err != nil {
 		peerLogger.Errorf("Ending Chat with peer address %s due to error: %s", address, err)
 		return err
@@ -597,41 +1018,394 @@ func (p *PeerImpl) chatWithPeer(address string) error {
 func (p *PeerImpl) handleChat(ctx context.Context, stream ChatStream, initiatedStream bool) error {
 	deadline, ok := ctx.Deadline()
 	peerLogger.Debugf("Current context deadline = %s, ok = %v", deadline, ok)
-	handler, err := p.handlerFactory(p, stream, initiatedStream, nil)
+	p.watermarks.StreamOpened()
+	defer p.watermarks.StreamClosed()
+	resumable := NewResumableStream(NewCodecNegotiator(NewCompressionNegotiator(NewTypeObfuscatingStream(stream, p.getEncryptionKey()))), p.chatSessions, p.sessions, initiatedStream)
+	defer resumable.Close()
+	stream = resumable
+	if wrapChatStream != nil {
+		stream = wrapChatStream(stream)
+	}
+	stream, stopRecording := p.recorder.Wrap(stream)
+	defer stopRecording()
+	handler, err := p.handlerFactory(sessionCoordinator(ctx, p), stream, initiatedStream, nil)
 	if err != nil {
 		return fmt.Errorf("Error creating handler during handleChat initiation: %s", err)
 	}
 	defer handler.Stop()
+	if !p.drainer.track(handler) {
+		return errDraining
+	}
+	defer p.drainer.untrack(handler)
+	address := remoteAddress(ctx)
+	recv := stream.Recv
+	if !initiatedStream {
+		recv = func() (*pb.Message, error) {
+			recv = stream.Recv
+			return recvHandshake(stream, viper.GetDuration("peer.chat.handshakeTimeout"))
+		}
+	}
 	for {
-		in, err := stream.Recv()
+		in, err := recv()
 		if err == io.EOF {
 			peerLogger.Debug("Received EOF, ending Chat")
 			return nil
 		}
+		if err == errHandshakeTimeout {
+			return err
+		}
 		if err != nil {
 			e := fmt.Errorf("Error during Chat, stopping handler: %s", err)
 			peerLogger.Error(e.Error())
 			return e
 		}
-		err = handler.HandleMessage(in)
+		if err := p.perPeerLimiter.Wait(ctx, address); err != nil {
+			return err
+		}
+		err = p.router.Dispatch(handler, in)
+		switch err.(type) {
+		case *CapabilityMismatchError, *RegistryFullError, *BannedError, *UnauthorizedError, *DisconnectedError:
+			peerLogger.Warningf("Closing Chat: %s", err)
+			return err
+		}
 		if err != nil {
 			peerLogger.Errorf("Error handling message: %s", err)
-			//return err
+			if err := p.reportMisbehavior(handler); err != nil {
+				peerLogger.Warningf("Closing Chat: %s", err)
+				return err
+			}
 		}
 	}
 }
 
+var errHandshakeTimeout = grpc.Errorf(codes.DeadlineExceeded, "handshake timeout")
+
+// recvHandshake waits up to timeout for the first message of a Chat opened by
+// a remote peer, normally its DISC_HELLO. If none arrives in time the remote
+// peer is sent a DISC_DISCONNECT and errHandshakeTimeout is returned, the
+// pending Recv ends once the stream is closed. A timeout of 0 waits
+// indefinitely.
+func recvHandshake(stream ChatStream, timeout time.Duration) (*pb.Message, error) {
+	if timeout <= 0 {
+		return stream.Recv()
+	}
+	type received struct {
+		msg *pb.Message
+		err error
+	}
+	recvChan := make(chan received, 1)
+	go func() {
+		msg, err := stream.Recv()
+		recvChan <- received{msg, err}
+	}()
+	select {
+	case r := <-recvChan:
+		return r.msg, r.err
+	case <-time.After(timeout):
+		peerLogger.Warningf("No message received within %s of opening Chat, disconnecting", timeout)
+		if err := stream.Send(&pb.Message{Type: pb.Message_DISC_DISCONNECT, Payload: []byte("handshake timeout"), Timestamp: util.CreateUtcTimestamp()}); err != nil {
+			peerLogger.Errorf("Error sending %s: %s", pb.Message_DISC_DISCONNECT, err)
+		}
+		return nil, errHandshakeTimeout
+	}
+}
+
 //ExecuteTransaction executes transactions decides to do execute in dev or prod mode
 func (p *PeerImpl) ExecuteTransaction(transaction *pb.Transaction) (response *pb.Response) {
 	if p.isValidator {
 		response = p.sendTransactionsToLocalEngine(transaction)
+	} else if p.gossiper != nil {
+		if err := p.gossiper.Propagate(transaction); err != nil {
+			response = &pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}
+		} else {
+			response = &pb.Response{Status: pb.Response_SUCCESS, Msg: []byte(transaction.Uuid)}
+		}
 	} else {
-		peerAddresses := p.discHelper.GetRandomNodes(1)
-		response = p.SendTransactionsToPeer(peerAddresses[0], transaction)
+		response = p.SendTransactionsToPeer(p.selectTransactionPeer(), transaction)
+	}
+	p.txTracker.submitted(transaction.Uuid, response.Status == pb.Response_SUCCESS)
+	// Queries are never sealed in a block
+	if response.Status == pb.Response_SUCCESS && transaction.Type != pb.Transaction_CHAINCODE_QUERY {
+		p.mempool.add(transaction)
+	}
+	return response
+}
+
+// GetMessageRouter returns the router dispatching the messages received on
+// Chat streams, on which handlers for further message types may be registered
+func (p *PeerImpl) GetMessageRouter() *MessageRouter {
+	return p.router
+}
+
+// GetPeerRegistry returns the registry of peers this peer has established a Chat with
+func (p *PeerImpl) GetPeerRegistry() *PeerRegistry {
+	return p.registry
+}
+
+// GetSLATracker returns the tracker recording the availability of the peers this peer has established a Chat with
+func (p *PeerImpl) GetSLATracker() *SLATracker {
+	return p.slaTracker
+}
+
+// GetPeerUptime returns the fraction of the window during which the peer at address was reachable
+func (p *PeerImpl) GetPeerUptime(address string, window time.Duration) float64 {
+	return p.slaTracker.Uptime(address, window)
+}
+
+// SaveSLA persists the availability samples to peer.sla.file, to be reloaded on the next start
+func (p *PeerImpl) SaveSLA() error {
+	return p.slaTracker.Save(getSLAFilePath())
+}
+
+// SetPeerSorter sets the PeerSorter applied to DISC_PEERS responses, nil for no ordering
+func (p *PeerImpl) SetPeerSorter(sorter PeerSorter) {
+	p.optionsMutex.Lock()
+	defer p.optionsMutex.Unlock()
+	p.peerSorter = sorter
+}
+
+// GetPeerSorter returns the PeerSorter applied to DISC_PEERS responses, nil if no ordering is applied
+func (p *PeerImpl) GetPeerSorter() PeerSorter {
+	p.optionsMutex.RLock()
+	defer p.optionsMutex.RUnlock()
+	return p.peerSorter
+}
+
+// SetTransactionStateStore replaces the TransactionStateStore answering CHAIN_TRANSACTIONS_QUERY_STATUS messages
+func (p *PeerImpl) SetTransactionStateStore(store TransactionStateStore) {
+	p.optionsMutex.Lock()
+	defer p.optionsMutex.Unlock()
+	p.txStateStore = store
+}
+
+// SetEncryptionKey sets the key confidential transactions sent to this peer are
+// decrypted with, its public key is sent in DISC_HELLO. nil, the default,
+// rejects confidential transactions.
+func (p *PeerImpl) SetEncryptionKey(key *ecdsa.PrivateKey) {
+	p.optionsMutex.Lock()
+	defer p.optionsMutex.Unlock()
+	p.encryptionKey = key
+}
+
+func (p *PeerImpl) getEncryptionKey() *ecdsa.PrivateKey {
+	p.optionsMutex.RLock()
+	defer p.optionsMutex.RUnlock()
+	return p.encryptionKey
+}
+
+// ProcessConfidentialTransaction decrypts the transaction with the encryption
+// key of this peer and processes it as ProcessTransaction does
+func (p *PeerImpl) ProcessConfidentialTransaction(encrypted *pb.EncryptedTransaction) *pb.Response {
+	key := p.getEncryptionKey()
+	if key == nil {
+		return &pb.Response{Status: pb.Response_FAILURE, Msg: []byte("Confidential transactions require an encryption key")}
+	}
+	tx, err := decryptTransaction(key, encrypted)
+	if err != nil {
+		return &pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}
+	}
+	response, err := p.ProcessTransaction(context.Background(), tx)
+	if err != nil {
+		return &pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}
 	}
 	return response
 }
 
+// ProcessTransactionBatch processes the transactions of the batch passing the
+// peer.tx.schemaFile schema and, if peer.tx.rejectOnTimestampSkew is set, the
+// peer.tx.maxClockSkew timestamp check, or forwards them to peer.tx.relayTargets in relay
+// mode. The violations of the other transactions are returned, nil if there
+// are none, with the transactions processed and those failing to, nil in
+// relay mode. An error is returned if the batch could not be forwarded.
+// progress, if not nil, is called every peer.tx.progressInterval processed
+// transactions.
+func (p *PeerImpl) ProcessTransactionBatch(batch *pb.TransactionBlock, progress BatchProgressReporter) (*pb.TransactionsValidationError, *BatchResult, error) {
+	return p.processTransactionBatch(batch, progress, false)
+}
+
+// ProcessImmediate is ProcessTransactionBatch processing the transactions
+// without waiting for the peer.tx.maxTPS limiter, or forwarding them ahead of
+// the batches queued for the relay targets. It returns once the batch is
+// processed or forwarded.
+func (p *PeerImpl) ProcessImmediate(batch *pb.TransactionBlock) (*pb.TransactionsValidationError, *BatchResult, error) {
+	return p.processTransactionBatch(batch, nil, true)
+}
+
+func (p *PeerImpl) processTransactionBatch(batch *pb.TransactionBlock, progress BatchProgressReporter, immediate bool) (*pb.TransactionsValidationError, *BatchResult, error) {
+	p.optionsMutex.RLock()
+	validator := p.txValidator
+	timestamps := p.tsValidator
+	p.optionsMutex.RUnlock()
+	valid, violations := validator.ValidateBatch(batch.Transactions)
+	rejected := validator != nil && validator.RejectAllOnError
+	if skewed := timestamps.ValidateBatch(batch.Transactions); len(skewed) > 0 {
+		violations = append(violations, skewed...)
+		if rejected {
+			valid = nil
+		} else if timestamps.Reject {
+			valid = withoutViolating(valid, batch.Transactions, skewed)
+		}
+	}
+	valid, conflicting := p.resolveConflicts(batch, valid, immediate)
+	violations = append(violations, conflicting...)
+	result, err := p.submitTransactions(batch, valid, progress, immediate)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(violations) == 0 {
+		return nil, result, nil
+	}
+	return &pb.TransactionsValidationError{Violations: violations, Rejected: rejected}, result, nil
+}
+
+// submitTransactions forwards the transactions of the batch to the relay
+// targets if any, otherwise processes them and returns which were processed
+// and which failed to
+func (p *PeerImpl) submitTransactions(batch *pb.TransactionBlock, valid []*pb.Transaction, progress BatchProgressReporter, immediate bool) (*BatchResult, error) {
+	if p.relay != nil {
+		if len(valid) == 0 {
+			return nil, nil
+		}
+		forward := p.relay.Forward
+		if immediate {
+			forward = p.relay.ForwardImmediate
+		}
+		return nil, forward(&pb.TransactionBlock{Transactions: valid, Hops: batch.Hops, GasLimit: batch.GasLimit, GasPrice: batch.GasPrice, Priority: batch.Priority, Signatures: batch.Signatures, AggregateSignatures: batch.AggregateSignatures, ForwardingChain: batch.ForwardingChain})
+	}
+	process := func(tx *pb.Transaction) (*pb.Response, error) {
+		if immediate {
+			return p.processTransaction(tx)
+		}
+		return p.ProcessTransaction(context.Background(), tx)
+	}
+	result := processBatchTransactions(valid, process, progress, viper.GetInt("peer.tx.progressInterval"))
+	for _, txID := range result.Committed {
+		p.mempool.setGasPrice(txID, batch.GasPrice)
+	}
+	return result, nil
+}
+
+// GetTransactionStateStore returns the TransactionStateStore answering CHAIN_TRANSACTIONS_QUERY_STATUS messages
+func (p *PeerImpl) GetTransactionStateStore() TransactionStateStore {
+	p.optionsMutex.RLock()
+	defer p.optionsMutex.RUnlock()
+	return p.txStateStore
+}
+
+// GetTransactionReceipt returns a receipt, signed with the enrollment key of this peer, proving the transaction was committed
+func (p *PeerImpl) GetTransactionReceipt(txID string) (*pb.TransactionReceipt, error) {
+	if p.secHelper == nil {
+		return nil, fmt.Errorf("Transaction receipts require security to be enabled")
+	}
+	p.ledgerWrapper.RLock()
+	defer p.ledgerWrapper.RUnlock()
+	blockNumber, txIndex, err := p.ledgerWrapper.ledger.GetTransactionIndexByUUID(txID)
+	if err != nil {
+		return nil, fmt.Errorf("Error finding transaction %s: %s", txID, err)
+	}
+	block, err := p.ledgerWrapper.ledger.GetBlockByNumber(blockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting block %d: %s", blockNumber, err)
+	}
+	return newTransactionReceipt(blockNumber, txIndex, block.Transactions, p.secHelper.Sign)
+}
+
+// GetTransaction returns the committed transaction txID, the number of its
+// block and its index within the block. ledger.ErrResourceNotFound is returned
+// if there is no such transaction.
+func (p *PeerImpl) GetTransaction(txID string) (*pb.Transaction, uint64, uint32, error) {
+	p.ledgerWrapper.RLock()
+	defer p.ledgerWrapper.RUnlock()
+	blockNumber, txIndex, err := p.ledgerWrapper.ledger.GetTransactionIndexByUUID(txID)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	block, err := p.ledgerWrapper.ledger.GetBlockByNumber(blockNumber)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("Error getting block %d: %s", blockNumber, err)
+	}
+	if txIndex >= uint64(len(block.Transactions)) {
+		return nil, 0, 0, fmt.Errorf("Transaction index %d out of range for block %d", txIndex, blockNumber)
+	}
+	return block.Transactions[txIndex], blockNumber, uint32(txIndex), nil
+}
+
+// GetTransactionProof returns the proof that the transaction is included in the block
+func (p *PeerImpl) GetTransactionProof(txID string, blockNumber uint64) (*pb.MerkleProof, error) {
+	block, err := p.GetBlockByNumber(blockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting block %d: %s", blockNumber, err)
+	}
+	return newTransactionProof(txID, blockNumber, block.Transactions)
+}
+
+// GetStateRoot returns the state hash of the block
+func (p *PeerImpl) GetStateRoot(blockNumber uint64) ([]byte, error) {
+	block, err := p.GetBlockByNumber(blockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting block %d: %s", blockNumber, err)
+	}
+	return block.StateHash, nil
+}
+
+// GetBlockHeader returns the header of the block
+func (p *PeerImpl) GetBlockHeader(blockNumber uint64) (*pb.BlockHeader, error) {
+	block, err := p.GetBlockByNumber(blockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting block %d: %s", blockNumber, err)
+	}
+	return newBlockHeader(blockNumber, block)
+}
+
+// GetBlockBody returns the body of the block
+func (p *PeerImpl) GetBlockBody(blockNumber uint64) (*pb.BlockBody, error) {
+	block, err := p.GetBlockByNumber(blockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting block %d: %s", blockNumber, err)
+	}
+	return newBlockBody(blockNumber, block), nil
+}
+
+func (p *PeerImpl) isTransactionCommitted(txID string) bool {
+	p.ledgerWrapper.RLock()
+	defer p.ledgerWrapper.RUnlock()
+	tx, err := p.ledgerWrapper.ledger.GetTransactionByUUID(txID)
+	return err == nil && tx != nil
+}
+
+// GetGossipPropagator returns the transaction gossip propagator, or nil if gossip is disabled
+func (p *PeerImpl) GetGossipPropagator() *GossipTransactionPropagator {
+	return p.gossiper
+}
+
+// ReserveGetPeers returns how long the requester of a DISC_GET_PEERS should wait before retrying, 0 if it may be served now
+func (p *PeerImpl) ReserveGetPeers() time.Duration {
+	p.optionsMutex.RLock()
+	defer p.optionsMutex.RUnlock()
+	return p.peersLimiter.reserve()
+}
+
+// ApplyConfigChange applies the reloaded DISC_GET_PEERS and transaction rate
+// limits, transaction schema and timestamp check and Chat watermarks. The
+// touch service picks up its settings on its next tick.
+func (p *PeerImpl) ApplyConfigChange(config *ReloadableConfig) {
+	p.optionsMutex.Lock()
+	p.peersLimiter = newGetPeersLimiter(config.MaxGetPeersPerSecond)
+	p.tpsLimiter = NewTPSLimiter(config.MaxTPS, config.BurstSize)
+	if validator, err := newSchemaValidatorFromFile(config.SchemaFile, config.RejectAllOnError); err != nil {
+		peerLogger.Errorf("Keeping the previous transaction schema: %s", err)
+	} else {
+		p.txValidator = validator
+	}
+	if validator, err := newTimestampValidatorFromSource(config.MaxClockSkew, config.ClockSource, config.RejectOnTimestampSkew); err != nil {
+		peerLogger.Errorf("Keeping the previous transaction timestamp check: %s", err)
+	} else {
+		p.tsValidator = validator
+	}
+	p.optionsMutex.Unlock()
+	p.watermarks.SetWatermarks(config.HighWatermark, config.LowWatermark)
+}
+
 // GetPeerEndpoint returns the endpoint for this peer
 func (p *PeerImpl) GetPeerEndpoint() (*pb.PeerEndpoint, error) {
 	ep, err := GetPeerEndpoint()
@@ -654,7 +1428,36 @@ func (p *PeerImpl) newHelloMessage() (*pb.HelloMessage, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Error creating hello message, error getting block chain info: %s", err)
 	}
-	return &pb.HelloMessage{PeerEndpoint: endpoint, BlockchainInfo: blockChainInfo}, nil
+	authToken, err := newAuthToken(endpoint.ID.Name)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating hello message: %s", err)
+	}
+	var encryptionKey []byte
+	if key := p.getEncryptionKey(); key != nil {
+		if encryptionKey, err = x509.MarshalPKIXPublicKey(&key.PublicKey); err != nil {
+			return nil, fmt.Errorf("Error creating hello message, error encoding encryption key: %s", err)
+		}
+	}
+	return &pb.HelloMessage{
+		PeerEndpoint:          endpoint,
+		BlockchainInfo:        blockChainInfo,
+		SupportedCapabilities: helloCapabilities(encryptionKey != nil),
+		RequiredCapabilities:  getRequiredCapabilities(),
+		GeoCoordinates:        getGeoCoordinates(),
+		EncryptionKey:         encryptionKey,
+		LoadScore:             p.loadProbe.Score(),
+		Region:                getRegion(),
+		UptimeSeconds:         uint64(time.Since(p.startTime) / time.Second),
+		MaxMessageBytes:       uint32(getMaxMessageSize()),
+		AuthToken:             authToken,
+		OnionAddress:          getOnionAddress(),
+		Role:                  getRole(),
+		ExternalAddress:       getExternalAddress(),
+		ExecutionEnvs:         p.processors.Supported(),
+		ProtocolVersion:       ProtocolVersion,
+		Priority:              getPriority(),
+		PreferredCodecs:       getPreferredCodecs(),
+	}, nil
 }
 
 // GetBlockByNumber return a block by block number
@@ -664,6 +1467,28 @@ func (p *PeerImpl) GetBlockByNumber(blockNumber uint64) (*pb.Block, error) {
 	return p.ledgerWrapper.ledger.GetBlockByNumber(blockNumber)
 }
 
+// GetBlockByHash returns the block hashing to hash and its number
+func (p *PeerImpl) GetBlockByHash(hash []byte) (*pb.Block, uint64, error) {
+	p.ledgerWrapper.RLock()
+	defer p.ledgerWrapper.RUnlock()
+	return p.ledgerWrapper.ledger.GetBlockByHash(hash)
+}
+
+// VerifyCheckpoint returns true if block blockNumber of the blockchain hashes to hash
+func (p *PeerImpl) VerifyCheckpoint(blockNumber uint64, hash []byte) bool {
+	block, err := p.GetBlockByNumber(blockNumber)
+	if err != nil {
+		peerLogger.Debugf("Unable to verify checkpoint at block %d: %s", blockNumber, err)
+		return false
+	}
+	blockHash, err := block.GetHash()
+	if err != nil {
+		peerLogger.Errorf("Error hashing checkpoint block %d: %s", blockNumber, err)
+		return false
+	}
+	return bytes.Equal(blockHash, hash)
+}
+
 // GetBlockchainSize returns the height/length of the blockchain
 func (p *PeerImpl) GetBlockchainSize() uint64 {
 	p.ledgerWrapper.RLock()
@@ -742,15 +1567,39 @@ func (p *PeerImpl) GetStateDelta(blockNumber uint64) (*statemgmt.StateDelta, err
 func (p *PeerImpl) PutBlock(blockNumber uint64, block *pb.Block) error {
 	p.ledgerWrapper.Lock()
 	defer p.ledgerWrapper.Unlock()
-	return p.ledgerWrapper.ledger.PutRawBlock(block, blockNumber)
+	if err := p.ledgerWrapper.ledger.PutRawBlock(block, blockNumber); err != nil {
+		return err
+	}
+	p.blockBus.Publish(blockNumber)
+	return nil
+}
+
+// GetBlockEventBus returns the bus notified of the blocks added to the ledger
+func (p *PeerImpl) GetBlockEventBus() *BlockEventBus {
+	return p.blockBus
 }
 
 // NewOpenchainDiscoveryHello constructs a new HelloMessage for sending
 func (p *PeerImpl) NewOpenchainDiscoveryHello() (*pb.Message, error) {
+	return p.NewOpenchainDiscoveryHelloWithChallenge(nil)
+}
+
+// NewOpenchainDiscoveryHelloWithChallenge constructs a new HelloMessage for
+// sending, carrying the authChallenge the receiver is to answer
+func (p *PeerImpl) NewOpenchainDiscoveryHelloWithChallenge(authChallenge []byte) (*pb.Message, error) {
+	return p.NewOpenchainDiscoveryHelloWithSession(authChallenge, "")
+}
+
+// NewOpenchainDiscoveryHelloWithSession constructs a new HelloMessage for
+// sending, carrying the authChallenge the receiver is to answer and a session
+// token, presented by the initiator of a Chat or issued by its receiver
+func (p *PeerImpl) NewOpenchainDiscoveryHelloWithSession(authChallenge []byte, sessionToken string) (*pb.Message, error) {
 	helloMessage, err := p.newHelloMessage()
 	if err != nil {
 		return nil, fmt.Errorf("Error getting new HelloMessage: %s", err)
 	}
+	helloMessage.AuthChallenge = authChallenge
+	helloMessage.SessionToken = sessionToken
 	data, err := proto.Marshal(helloMessage)
 	if err != nil {
 		return nil, fmt.Errorf("Error marshalling HelloMessage: %s", err)
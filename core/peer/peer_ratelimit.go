@@ -0,0 +1,166 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/transport"
+)
+
+// PerPeerRateLimiter keeps a token bucket for every remote address, capping
+// the rate of the requests of each so that a high volume peer does not use up
+// the allowance of the others, unlike the peer.tx.maxTPS limiter shared by
+// all. A nil PerPeerRateLimiter does not limit.
+type PerPeerRateLimiter struct {
+	sync.Mutex
+	defaultLimit float64
+	overrides    map[string]float64
+	evictAfter   time.Duration
+	limiters     map[string]*addressLimiter
+}
+
+// addressLimiter is the token bucket of a remote address
+type addressLimiter struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+// NewPerPeerRateLimiter returns a limiter allowing every remote address
+// defaultLimit requests per second, or the limit of the address in overrides,
+// 0 not limiting. The limiter of an address is dropped once unused for
+// evictAfter, 0 keeping it. nil is returned if no limit is positive.
+func NewPerPeerRateLimiter(defaultLimit float64, overrides map[string]float64, evictAfter time.Duration) *PerPeerRateLimiter {
+	limited := defaultLimit > 0
+	normalized := make(map[string]float64, len(overrides))
+	for address, limit := range overrides {
+		normalized[strings.ToLower(address)] = limit
+		limited = limited || limit > 0
+	}
+	if !limited {
+		return nil
+	}
+	return &PerPeerRateLimiter{defaultLimit: defaultLimit, overrides: normalized, evictAfter: evictAfter, limiters: make(map[string]*addressLimiter)}
+}
+
+// newPerPeerRateLimiterFromConfig returns the limiter of
+// peer.perPeerRateLimit.default, overridden for the addresses of
+// peer.perPeerRateLimit.overrides
+func newPerPeerRateLimiterFromConfig() *PerPeerRateLimiter {
+	overrides := make(map[string]float64)
+	for address, value := range viper.GetStringMap("peer.perPeerRateLimit.overrides") {
+		limit, err := cast.ToFloat64E(value)
+		if err != nil {
+			peerLogger.Errorf("Ignoring the rate limit override of %s: %s", address, err)
+			continue
+		}
+		overrides[address] = limit
+	}
+	return NewPerPeerRateLimiter(viper.GetFloat64("peer.perPeerRateLimit.default"), overrides, viper.GetDuration("peer.perPeerRateLimit.evictAfter"))
+}
+
+// limit returns the requests per second allowed to address
+func (l *PerPeerRateLimiter) limit(address string) float64 {
+	if limit, ok := l.overrides[strings.ToLower(address)]; ok {
+		return limit
+	}
+	return l.defaultLimit
+}
+
+// Wait blocks until a request of address may be served, returning the
+// context error if ctx is done first. An empty address is not limited.
+func (l *PerPeerRateLimiter) Wait(ctx context.Context, address string) error {
+	if l == nil || address == "" {
+		return nil
+	}
+	l.Lock()
+	entry, ok := l.limiters[address]
+	if !ok {
+		limit := l.limit(address)
+		if limit <= 0 {
+			l.Unlock()
+			return nil
+		}
+		burst := int(limit)
+		if burst < 1 {
+			burst = 1
+		}
+		entry = &addressLimiter{limiter: rate.NewLimiter(rate.Limit(limit), burst)}
+		l.limiters[address] = entry
+	}
+	entry.lastUsed = time.Now()
+	l.Unlock()
+	return entry.limiter.Wait(ctx)
+}
+
+// EvictIdle drops the limiters unused for evictAfter at now, returning how many
+func (l *PerPeerRateLimiter) EvictIdle(now time.Time) int {
+	if l == nil || l.evictAfter <= 0 {
+		return 0
+	}
+	l.Lock()
+	defer l.Unlock()
+	evicted := 0
+	for address, entry := range l.limiters {
+		if now.Sub(entry.lastUsed) >= l.evictAfter {
+			delete(l.limiters, address)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// Start drops the idle limiters every evictAfter
+func (l *PerPeerRateLimiter) Start() {
+	if l == nil || l.evictAfter <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(l.evictAfter)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			if evicted := l.EvictIdle(now); evicted > 0 {
+				peerLogger.Debugf("Evicted the rate limiters of %d idle peers", evicted)
+			}
+		}
+	}()
+}
+
+// remoteAddress returns the host of the remote end of the gRPC stream of
+// ctx, empty if ctx is not the context of a stream served by this peer
+func remoteAddress(ctx context.Context) string {
+	stream, ok := transport.StreamFromContext(ctx)
+	if !ok || stream.ServerTransport() == nil {
+		return ""
+	}
+	addr := stream.ServerTransport().RemoteAddr()
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,95 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// waitsAtOnce returns true if a request of address is served within 10ms
+func waitsAtOnce(l *PerPeerRateLimiter, address string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	return l.Wait(ctx, address) == nil
+}
+
+func TestPerPeerRateLimiterDisabled(t *testing.T) {
+	if l := NewPerPeerRateLimiter(0, map[string]float64{"10.0.0.1": 0}, 0); l != nil {
+		t.Fatal("Expected no limiter without a positive limit")
+	}
+	var l *PerPeerRateLimiter
+	if !waitsAtOnce(l, "10.0.0.1") {
+		t.Error("Expected a nil limiter not to limit")
+	}
+}
+
+func TestPerPeerRateLimiterSeparateAllowances(t *testing.T) {
+	l := NewPerPeerRateLimiter(1, nil, 0)
+	if !waitsAtOnce(l, "10.0.0.1") {
+		t.Fatal("Expected the first request of 10.0.0.1 to be served at once")
+	}
+	if waitsAtOnce(l, "10.0.0.1") {
+		t.Error("Expected the second request of 10.0.0.1 to wait")
+	}
+	if !waitsAtOnce(l, "10.0.0.2") {
+		t.Error("Expected 10.0.0.2 to keep its own allowance")
+	}
+	if !waitsAtOnce(l, "") {
+		t.Error("Expected requests without an address not to be limited")
+	}
+}
+
+func TestPerPeerRateLimiterOverrides(t *testing.T) {
+	l := NewPerPeerRateLimiter(1, map[string]float64{"Bulk.Example.com": 100, "10.0.0.9": 0}, 0)
+	for i := 0; i < 50; i++ {
+		if !waitsAtOnce(l, "bulk.example.com") {
+			t.Fatalf("Expected request %d of bulk.example.com to be served within its override", i)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if !waitsAtOnce(l, "10.0.0.9") {
+			t.Fatal("Expected 10.0.0.9 to be unlimited")
+		}
+	}
+	if l := NewPerPeerRateLimiter(0, map[string]float64{"10.0.0.1": 1}, 0); l == nil || !waitsAtOnce(l, "10.0.0.2") {
+		t.Error("Expected only the overridden address to be limited")
+	}
+}
+
+func TestPerPeerRateLimiterEvictIdle(t *testing.T) {
+	l := NewPerPeerRateLimiter(1, nil, time.Minute)
+	waitsAtOnce(l, "10.0.0.1")
+	waitsAtOnce(l, "10.0.0.2")
+	if evicted := l.EvictIdle(time.Now()); evicted != 0 {
+		t.Fatalf("Expected no limiter to be idle yet, evicted %d", evicted)
+	}
+	if evicted := l.EvictIdle(time.Now().Add(time.Minute)); evicted != 2 {
+		t.Fatalf("Expected both limiters to be evicted, evicted %d", evicted)
+	}
+	if !waitsAtOnce(l, "10.0.0.1") {
+		t.Error("Expected an evicted address to start with a full allowance")
+	}
+}
+
+func TestRemoteAddressWithoutStream(t *testing.T) {
+	if address := remoteAddress(context.Background()); address != "" {
+		t.Errorf("Expected no address outside of a gRPC stream, got %s", address)
+	}
+}
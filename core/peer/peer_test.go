@@ -23,12 +23,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/spf13/viper"
 
 	"github.com/hyperledger/fabric/core/config"
 	pb "github.com/hyperledger/fabric/protos"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 )
 
 var peerClientConn *grpc.ClientConn
@@ -122,3 +124,118 @@ func TestServer_Chat(t *testing.T) {
 	t.Skip()
 	performChat(t, peerClientConn)
 }
+
+// helloOverStream completes the DISC_HELLO exchange on the stream as the peer of id
+func helloOverStream(t *testing.T, stream ChatStream, id string) {
+	data, err := proto.Marshal(&pb.HelloMessage{PeerEndpoint: &pb.PeerEndpoint{ID: &pb.PeerID{Name: id}, Address: "127.0.0.1:1", Type: pb.PeerEndpoint_NON_VALIDATOR}})
+	if err != nil {
+		t.Fatalf("Error marshalling HelloMessage: %s", err)
+	}
+	if _, err := requestOverStream(stream, &pb.Message{Type: pb.Message_DISC_HELLO, Payload: data}, pb.Message_DISC_HELLO); err != nil {
+		t.Fatalf("Error saying hello as %s: %s", id, err)
+	}
+}
+
+func TestChatGetPeersListsHelloPeers(t *testing.T) {
+	address := viper.GetString("peer.address")
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("peer.chat.requestTimeout"))
+	defer cancel()
+	err := withChatStream(ctx, nil, address, func(joining ChatStream) error {
+		helloOverStream(t, joining, "joiningPeer")
+		return withChatStream(ctx, nil, address, func(asking ChatStream) error {
+			helloOverStream(t, asking, "askingPeer")
+			// The DISC_HELLO reply is sent before the peer registers the
+			// joining peer, so it may take a few requests to be listed
+			deadline := time.Now().Add(time.Second)
+			for {
+				reply, err := requestOverStream(asking, &pb.Message{Type: pb.Message_DISC_GET_PEERS}, pb.Message_DISC_PEERS)
+				if err != nil {
+					return err
+				}
+				peers := &pb.PeersMessage{}
+				if err := proto.Unmarshal(reply.Payload, peers); err != nil {
+					return fmt.Errorf("Error unmarshalling PeersMessage: %s", err)
+				}
+				for _, peer := range peers.Peers {
+					if peer.ID.Name == "joiningPeer" {
+						return nil
+					}
+				}
+				if time.Now().After(deadline) {
+					return fmt.Errorf("Expected the peer of the other stream in %v", peers.Peers)
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// handshakeStream is a ChatStream whose Recv returns the messages sent on recv
+type handshakeStream struct {
+	recv chan *pb.Message
+	sent chan *pb.Message
+}
+
+func (s *handshakeStream) Send(msg *pb.Message) error {
+	s.sent <- msg
+	return nil
+}
+
+func (s *handshakeStream) Recv() (*pb.Message, error) {
+	msg, ok := <-s.recv
+	if !ok {
+		return nil, io.EOF
+	}
+	return msg, nil
+}
+
+func TestRecvHandshakeTimeout(t *testing.T) {
+	stream := &handshakeStream{recv: make(chan *pb.Message), sent: make(chan *pb.Message, 1)}
+	defer close(stream.recv)
+	_, err := recvHandshake(stream, 10*time.Millisecond)
+	if grpc.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("Expected a DeadlineExceeded error, got %v", err)
+	}
+	if msg := <-stream.sent; msg.Type != pb.Message_DISC_DISCONNECT || string(msg.Payload) != "handshake timeout" {
+		t.Errorf("Expected a DISC_DISCONNECT with reason handshake timeout, got %s %q", msg.Type, msg.Payload)
+	}
+}
+
+func TestRecvHandshakeHello(t *testing.T) {
+	stream := &handshakeStream{recv: make(chan *pb.Message, 1), sent: make(chan *pb.Message, 1)}
+	stream.recv <- &pb.Message{Type: pb.Message_DISC_HELLO}
+	msg, err := recvHandshake(stream, time.Second)
+	if err != nil || msg.Type != pb.Message_DISC_HELLO {
+		t.Fatalf("Expected DISC_HELLO, got %v, %v", msg, err)
+	}
+	if len(stream.sent) != 0 {
+		t.Errorf("Expected nothing sent, got %s", <-stream.sent)
+	}
+}
+
+func TestDialInterceptor(t *testing.T) {
+	defer SetDialInterceptor(nil)
+	if address := interceptDial("peer.internal"); address != "peer.internal" {
+		t.Errorf("Expected addresses to be unchanged by default, got %s", address)
+	}
+	var seen []string
+	SetDialInterceptor(func(address string) string {
+		seen = append(seen, address)
+		if address == "peer.internal" {
+			return "127.0.0.1:7051"
+		}
+		return address
+	})
+	if address := interceptDial("peer.internal"); address != "127.0.0.1:7051" {
+		t.Errorf("Expected peer.internal to be rewritten to 127.0.0.1:7051, got %s", address)
+	}
+	if address := interceptDial("10.0.0.1:30303"); address != "10.0.0.1:30303" {
+		t.Errorf("Expected 10.0.0.1:30303 to be unchanged, got %s", address)
+	}
+	if len(seen) != 2 || seen[0] != "peer.internal" {
+		t.Errorf("Expected the interceptor to be called with the raw addresses, got %v", seen)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/core/comm"
+)
+
+// PeerConnectionConfig is the configuration the connections to other peers
+// are dialed with by NewPeerClientConnectionWithAddress
+type PeerConnectionConfig struct {
+	Address        string
+	TLSEnabled     bool
+	CertFile       string
+	DialTimeout    time.Duration
+	MinDialTimeout time.Duration
+}
+
+// newPeerConnectionConfigFromViper returns the configuration of the peer
+// connections, from peer.address, peer.tls and peer.dial
+func newPeerConnectionConfigFromViper() *PeerConnectionConfig {
+	return &PeerConnectionConfig{
+		Address:        viper.GetString("peer.address"),
+		TLSEnabled:     comm.TLSEnabled(),
+		CertFile:       viper.GetString("peer.tls.cert.file"),
+		DialTimeout:    initialDialTimeout,
+		MinDialTimeout: viper.GetDuration("peer.dial.minTimeout"),
+	}
+}
+
+// ValidatePeerConfig checks the configuration of the peer connections before
+// the first dial, returning ConfigErrors with every invalid field if any
+func ValidatePeerConfig(cfg *PeerConnectionConfig) error {
+	var errs ConfigErrors
+	if reason := invalidHostPort(cfg.Address); reason != "" {
+		errs = append(errs, &ConfigError{Field: "peer.address", Value: cfg.Address, Reason: reason})
+	}
+	if cfg.TLSEnabled {
+		if reason := invalidCertFile(cfg.CertFile); reason != "" {
+			errs = append(errs, &ConfigError{Field: "peer.tls.cert.file", Value: cfg.CertFile, Reason: reason})
+		}
+	}
+	if cfg.DialTimeout <= 0 {
+		errs = append(errs, &ConfigError{Field: "dial timeout", Value: cfg.DialTimeout.String(), Reason: "must be positive"})
+	}
+	if cfg.MinDialTimeout < 0 {
+		errs = append(errs, &ConfigError{Field: "peer.dial.minTimeout", Value: cfg.MinDialTimeout.String(), Reason: "must not be negative"})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// invalidHostPort returns why address is not a valid host:port, empty if it is
+func invalidHostPort(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err.Error()
+	}
+	if host == "" {
+		return "missing host"
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "port must be a number from 1 to 65535"
+	}
+	return ""
+}
+
+// invalidCertFile returns why the file is not a PEM encoded certificate, empty if it is
+func invalidCertFile(path string) string {
+	if path == "" {
+		return "required with TLS enabled"
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err.Error()
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return "no PEM data found"
+	}
+	if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+		return err.Error()
+	}
+	return ""
+}
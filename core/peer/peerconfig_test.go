@@ -0,0 +1,97 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func validPeerConnectionConfig() *PeerConnectionConfig {
+	return &PeerConnectionConfig{Address: "0.0.0.0:30303", DialTimeout: time.Second, MinDialTimeout: 200 * time.Millisecond}
+}
+
+func TestValidatePeerConfig(t *testing.T) {
+	if err := ValidatePeerConfig(validPeerConnectionConfig()); err != nil {
+		t.Fatalf("Expected the config to be valid: %s", err)
+	}
+	cfg := validPeerConnectionConfig()
+	cfg.TLSEnabled = true
+	cfg.CertFile = "../chaincode/testdata/server1.pem"
+	if err := ValidatePeerConfig(cfg); err != nil {
+		t.Fatalf("Expected the TLS config to be valid: %s", err)
+	}
+}
+
+func TestValidatePeerConfigAddress(t *testing.T) {
+	for _, address := range []string{"", "localhost", ":30303", "localhost:port", "localhost:0", "localhost:70000"} {
+		cfg := validPeerConnectionConfig()
+		cfg.Address = address
+		err := ValidatePeerConfig(cfg)
+		errs, ok := err.(ConfigErrors)
+		if !ok || len(errs) != 1 || errs[0].Field != "peer.address" || errs[0].Value != address {
+			t.Errorf("Expected a peer.address error for %q, got %v", address, err)
+		}
+	}
+}
+
+func TestValidatePeerConfigCertFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "peerconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	notPEM := filepath.Join(dir, "cert.txt")
+	if err := ioutil.WriteFile(notPEM, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	notCert := filepath.Join(dir, "cert.pem")
+	if err := ioutil.WriteFile(notCert, []byte("-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"", filepath.Join(dir, "missing.pem"), notPEM, notCert} {
+		cfg := validPeerConnectionConfig()
+		cfg.TLSEnabled = true
+		cfg.CertFile = path
+		err := ValidatePeerConfig(cfg)
+		errs, ok := err.(ConfigErrors)
+		if !ok || len(errs) != 1 || errs[0].Field != "peer.tls.cert.file" {
+			t.Errorf("Expected a peer.tls.cert.file error for %q, got %v", path, err)
+		}
+	}
+	cfg := validPeerConnectionConfig()
+	cfg.CertFile = notPEM
+	if err := ValidatePeerConfig(cfg); err != nil {
+		t.Fatalf("Expected the cert file not to be checked with TLS disabled: %s", err)
+	}
+}
+
+func TestValidatePeerConfigErrors(t *testing.T) {
+	cfg := &PeerConnectionConfig{Address: "localhost", MinDialTimeout: -time.Second}
+	errs, ok := ValidatePeerConfig(cfg).(ConfigErrors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("Expected an error per invalid field, got %v", errs)
+	}
+	for i, field := range []string{"peer.address", "dial timeout", "peer.dial.minTimeout"} {
+		if errs[i].Field != field {
+			t.Errorf("Expected error %d to be about %s, got %s", i, field, errs[i].Field)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// PoWValidator verifies the proof of work of block headers, returning whether
+// the header meets its bits, the difficulty it does meet and its hash
+type PoWValidator interface {
+	Validate(header *pb.BlockHeader) (bool, uint32, []byte, error)
+}
+
+// PoWValidatorAccessor interface enables a Peer to hand out its PoWValidator
+type PoWValidatorAccessor interface {
+	GetPoWValidator() PoWValidator
+}
+
+// SHA256dPoWValidator is a PoWValidator hashing the marshalled header with
+// SHA-256 twice, the difficulty being the number of leading zero bits of the
+// hash
+type SHA256dPoWValidator struct{}
+
+// Validate implements PoWValidator
+func (SHA256dPoWValidator) Validate(header *pb.BlockHeader) (bool, uint32, []byte, error) {
+	if header == nil {
+		return false, 0, nil, fmt.Errorf("No block header given")
+	}
+	data, err := proto.Marshal(header)
+	if err != nil {
+		return false, 0, nil, fmt.Errorf("Error marshalling header of block %d: %s", header.BlockNumber, err)
+	}
+	hash := sha256Sum(sha256Sum(data))
+	difficulty := leadingZeroBits(hash)
+	return difficulty >= header.Bits, difficulty, hash, nil
+}
+
+// leadingZeroBits returns the number of zero bits hash starts with
+func leadingZeroBits(hash []byte) uint32 {
+	var zeros uint32
+	for _, b := range hash {
+		if b != 0 {
+			for mask := byte(0x80); b&mask == 0; mask >>= 1 {
+				zeros++
+			}
+			return zeros
+		}
+		zeros += 8
+	}
+	return zeros
+}
+
+// SetPoWValidator sets the PoWValidator answering CHAIN_VALIDATE_POW messages,
+// SHA256dPoWValidator by default
+func (p *PeerImpl) SetPoWValidator(validator PoWValidator) {
+	p.optionsMutex.Lock()
+	defer p.optionsMutex.Unlock()
+	p.powValidator = validator
+}
+
+// GetPoWValidator returns the validator of the proof of work of block headers
+func (p *PeerImpl) GetPoWValidator() PoWValidator {
+	p.optionsMutex.RLock()
+	defer p.optionsMutex.RUnlock()
+	return p.powValidator
+}
+
+// ValidatePoWAtPeer asks the peer at address to verify the proof of work of a proposed block header
+func ValidatePoWAtPeer(address string, header *pb.BlockHeader) (*pb.PoWResult, error) {
+	data, err := proto.Marshal(&pb.ValidatePoW{Header: header})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling ValidatePoW: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_VALIDATE_POW, Payload: data}
+	reply, err := requestOverChat(address, request, pb.Message_CHAIN_VALIDATE_POW_RESULT)
+	if err != nil {
+		return nil, fmt.Errorf("Error validating proof of work at %s: %s", address, err)
+	}
+	result := &pb.PoWResult{}
+	if err := proto.Unmarshal(reply.Payload, result); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling PoWResult: %s", err)
+	}
+	return result, nil
+}
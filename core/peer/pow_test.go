@@ -0,0 +1,89 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestLeadingZeroBits(t *testing.T) {
+	for _, test := range []struct {
+		hash     []byte
+		expected uint32
+	}{
+		{[]byte{0x80}, 0},
+		{[]byte{0x01, 0xff}, 7},
+		{[]byte{0x00, 0x10}, 11},
+		{[]byte{0x00, 0x00}, 16},
+	} {
+		if zeros := leadingZeroBits(test.hash); zeros != test.expected {
+			t.Errorf("Expected %x to have %d leading zero bits, got %d", test.hash, test.expected, zeros)
+		}
+	}
+}
+
+// mineHeader returns the header with the first nonce meeting its bits
+func mineHeader(t *testing.T, header *pb.BlockHeader) *pb.BlockHeader {
+	for header.Nonce = 0; header.Nonce < 1<<20; header.Nonce++ {
+		if valid, _, _, err := (SHA256dPoWValidator{}).Validate(header); err != nil {
+			t.Fatal(err)
+		} else if valid {
+			return header
+		}
+	}
+	t.Fatalf("No nonce found for %d bits", header.Bits)
+	return nil
+}
+
+func TestSHA256dPoWValidator(t *testing.T) {
+	header := mineHeader(t, &pb.BlockHeader{BlockNumber: 1, PreviousHash: []byte("previous"), Bits: 8})
+	valid, difficulty, hash, err := SHA256dPoWValidator{}.Validate(header)
+	if err != nil || !valid || difficulty < 8 {
+		t.Fatalf("Expected the mined header to be valid with at least 8 bits, got %t, %d, %v", valid, difficulty, err)
+	}
+	data, err := proto.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := sha256Sum(sha256Sum(data)); !bytes.Equal(hash, expected) {
+		t.Fatalf("Expected the double SHA-256 hash %x, got %x", expected, hash)
+	}
+	header.Bits = difficulty + 1
+	if valid, _, _, err := (SHA256dPoWValidator{}).Validate(header); err != nil || valid {
+		t.Fatalf("Expected a header short of its bits to be invalid, got %t, %v", valid, err)
+	}
+	if _, _, _, err := (SHA256dPoWValidator{}).Validate(nil); err == nil {
+		t.Fatal("Expected an error without a header")
+	}
+}
+
+func TestValidatePoWAtPeer(t *testing.T) {
+	header := mineHeader(t, &pb.BlockHeader{BlockNumber: 1, Bits: 4})
+	result, err := ValidatePoWAtPeer(viper.GetString("peer.address"), header)
+	if err != nil {
+		t.Fatalf("Error validating proof of work: %s", err)
+	}
+	if !result.Valid || result.Difficulty < 4 || len(result.Hash) == 0 {
+		t.Fatalf("Expected the mined header to be valid, got %+v", result)
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"container/heap"
+	"math"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+var priorityEvictedCounter = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "peer",
+	Name:      "priority_evicted_total",
+	Help:      "Number of peers disconnected from the full registry for a peer of a higher connection priority.",
+})
+
+func init() {
+	prometheus.MustRegister(priorityEvictedCounter)
+}
+
+// unknownPriority is the priority of a remote peer before its DISC_HELLO, the lowest
+const unknownPriority = math.MaxUint32
+
+// evictedReason is the DISC_DISCONNECT payload sent to a peer evicted for one of a higher priority
+const evictedReason = "evicted for a peer of a higher priority"
+
+// getPriority returns the connection priority of this peer advertised in DISC_HELLO, peer.priority
+func getPriority() uint32 {
+	return uint32(viper.GetInt("peer.priority"))
+}
+
+// priorityEvictionEnabled returns whether a peer of a higher priority takes
+// the place of the lowest priority peer of a full registry,
+// peer.discovery.priorityEviction
+func priorityEvictionEnabled() bool {
+	return viper.GetBool("peer.discovery.priorityEviction")
+}
+
+// evictForPriority makes room in the full registry for a peer of priority by
+// sending a DISC_DISCONNECT with send to the registered peer of the lowest
+// priority below it and removing it from the registry. It returns false if
+// every registered peer has at least the priority.
+func evictForPriority(registry *PeerRegistry, priority uint32, send func(*pb.Message, *pb.PeerID) error) bool {
+	victim, ok := registry.LowestPriority(priority)
+	if !ok {
+		return false
+	}
+	peerLogger.Infof("Evicting %s of priority %d for a peer of priority %d", victim.Endpoint.ID, victim.Priority, priority)
+	if err := send(&pb.Message{Type: pb.Message_DISC_DISCONNECT, Payload: []byte(evictedReason)}, victim.Endpoint.ID); err != nil {
+		peerLogger.Debugf("Error sending %s to evicted peer %s: %s", pb.Message_DISC_DISCONNECT, victim.Endpoint.ID, err)
+	}
+	registry.Remove(victim.Endpoint.ID)
+	priorityEvictedCounter.Inc()
+	return true
+}
+
+// prioritizedHandler is a MessageHandler knowing the connection priority of its remote peer
+type prioritizedHandler interface {
+	RemotePriority() uint32
+}
+
+// handlerPriority returns the connection priority of the remote peer of handler, unknownPriority if it does not tell
+func handlerPriority(handler MessageHandler) uint32 {
+	if h, ok := handler.(prioritizedHandler); ok {
+		return h.RemotePriority()
+	}
+	return unknownPriority
+}
+
+// dispatchWaiter is a dispatch waiting for a slot
+type dispatchWaiter struct {
+	priority uint32
+	seq      uint64
+	ready    chan struct{}
+}
+
+type dispatchQueue []*dispatchWaiter
+
+func (q dispatchQueue) Len() int { return len(q) }
+func (q dispatchQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority < q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+func (q dispatchQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *dispatchQueue) Push(x interface{}) { *q = append(*q, x.(*dispatchWaiter)) }
+func (q *dispatchQueue) Pop() interface{} {
+	old := *q
+	w := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return w
+}
+
+// dispatchSlots lets up to size messages be dispatched at once. The
+// dispatches waiting for a slot get it lowest priority value first, in the
+// order they came for the same priority.
+type dispatchSlots struct {
+	sync.Mutex
+	size    int
+	busy    int
+	seq     uint64
+	waiting dispatchQueue
+}
+
+func newDispatchSlots(size int) *dispatchSlots {
+	return &dispatchSlots{size: size}
+}
+
+// acquire waits for a slot for a dispatch of priority
+func (s *dispatchSlots) acquire(priority uint32) {
+	s.Lock()
+	if s.busy < s.size && len(s.waiting) == 0 {
+		s.busy++
+		s.Unlock()
+		return
+	}
+	s.seq++
+	w := &dispatchWaiter{priority: priority, seq: s.seq, ready: make(chan struct{})}
+	heap.Push(&s.waiting, w)
+	s.Unlock()
+	<-w.ready
+}
+
+// release frees the slot of a dispatch, handing it to the first one waiting
+func (s *dispatchSlots) release() {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.waiting) > 0 {
+		close(heap.Pop(&s.waiting).(*dispatchWaiter).ready)
+		return
+	}
+	s.busy--
+}
@@ -0,0 +1,130 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// priorityTestHandler is a MessageHandler of a peer of a given priority
+type priorityTestHandler struct {
+	routerTestHandler
+	priority uint32
+}
+
+func (h *priorityTestHandler) RemotePriority() uint32 {
+	return h.priority
+}
+
+func TestDispatchSlotsPriorityOrder(t *testing.T) {
+	slots := newDispatchSlots(1)
+	slots.acquire(5)
+	order := make(chan uint32, 3)
+	for i, priority := range []uint32{10, 0, 10} {
+		go func(priority uint32) {
+			slots.acquire(priority)
+			order <- priority
+			slots.release()
+		}(priority)
+		// Let each dispatch queue up before the next one
+		for queued := 0; queued <= i; {
+			time.Sleep(time.Millisecond)
+			slots.Lock()
+			queued = len(slots.waiting)
+			slots.Unlock()
+		}
+	}
+	slots.release()
+	for _, expected := range []uint32{0, 10, 10} {
+		if priority := <-order; priority != expected {
+			t.Fatalf("Expected the dispatch of priority %d next, got %d", expected, priority)
+		}
+	}
+	acquired := make(chan struct{})
+	go func() {
+		slots.acquire(5)
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Error("Expected every slot to be released")
+	}
+}
+
+func TestMessageRouterMaxConcurrentDispatch(t *testing.T) {
+	r := newDefaultMessageRouter()
+	r.SetMaxConcurrentDispatch(1)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	r.Handle(pb.Message_DISC_GET_PEERS, func(handler MessageHandler, msg *pb.Message) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+	go r.Dispatch(&priorityTestHandler{priority: 0}, &pb.Message{Type: pb.Message_DISC_GET_PEERS})
+	<-started
+	done := make(chan error)
+	go func() {
+		done <- r.Dispatch(&priorityTestHandler{priority: 0}, &pb.Message{Type: pb.Message_DISC_PEERS})
+	}()
+	select {
+	case <-done:
+		t.Fatal("Expected the second dispatch to wait for the first one")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Error dispatching DISC_PEERS: %s", err)
+	}
+}
+
+func TestEvictForPriority(t *testing.T) {
+	registry := NewPeerRegistry()
+	for _, peer := range []struct {
+		name     string
+		priority uint32
+	}{{"validator", 0}, {"observer1", 10}, {"observer2", 10}, {"client", 5}} {
+		id := &pb.PeerID{Name: peer.name}
+		registry.Add(&pb.PeerEndpoint{ID: id, Address: peer.name + ":30303"})
+		registry.SetPriority(id, peer.priority)
+		time.Sleep(time.Millisecond)
+	}
+	var sent []string
+	send := func(msg *pb.Message, id *pb.PeerID) error {
+		if msg.Type != pb.Message_DISC_DISCONNECT {
+			t.Errorf("Expected a %s, got %s", pb.Message_DISC_DISCONNECT, msg.Type)
+		}
+		sent = append(sent, id.Name)
+		return nil
+	}
+	if !evictForPriority(registry, 0, send) || !evictForPriority(registry, 0, send) {
+		t.Fatal("Expected the observers to be evicted for a validator")
+	}
+	if len(sent) != 2 || sent[0] != "observer2" || sent[1] != "observer1" || registry.Len() != 2 {
+		t.Fatalf("Expected the most recent observer to be evicted first, evicted %v", sent)
+	}
+	if evictForPriority(registry, 5, send) {
+		t.Fatal("Expected no peer of a priority value above 5 left to evict")
+	}
+	if _, ok := registry.Get(&pb.PeerID{Name: "client"}); !ok {
+		t.Error("Expected the client to be kept")
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// TransactionProofProvider interface enables a Peer to answer CHAIN_TRANSACTIONS_PROOF_REQUEST messages
+type TransactionProofProvider interface {
+	GetTransactionProof(txID string, blockNumber uint64) (*pb.MerkleProof, error)
+}
+
+// TransactionHash returns the hash of the transaction as a leaf of the merkle
+// tree of its block, the txHash a MerkleProof is verified for
+func TransactionHash(tx *pb.Transaction) ([]byte, error) {
+	return transactionLeaf(tx)
+}
+
+// newTransactionProof returns the proof that the transaction txID is among the transactions of block blockNumber
+func newTransactionProof(txID string, blockNumber uint64, transactions []*pb.Transaction) (*pb.MerkleProof, error) {
+	index := -1
+	for i, tx := range transactions {
+		if tx.Uuid == txID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("Transaction %s not found in block %d", txID, blockNumber)
+	}
+	levels, err := transactionsMerkleTree(transactions)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.MerkleProof{
+		MerkleProof: merkleProof(levels, uint64(index)),
+		LeafIndex:   uint32(index),
+		Root:        levels[len(levels)-1][0],
+	}, nil
+}
+
+// MerkleProofVerifier checks merkle proofs of inclusion without trusting the peer which issued them
+type MerkleProofVerifier struct{}
+
+// Verify returns true if the proof places txHash at leafIndex of the merkle tree whose root is root
+func (MerkleProofVerifier) Verify(txHash, root []byte, proof [][]byte, leafIndex uint32) bool {
+	return bytes.Equal(merkleRootFromProof(txHash, uint64(leafIndex), proof), root)
+}
+
+// FetchTransactionProof asks the peer at address for the proof that the transaction txID is included in block blockNumber
+func FetchTransactionProof(address, txID string, blockNumber uint64) (*pb.MerkleProof, error) {
+	data, err := proto.Marshal(&pb.TransactionProofRequest{TxID: txID, BlockNumber: blockNumber})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling TransactionProofRequest: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS_PROOF_REQUEST, Payload: data}
+	reply, err := requestOverChat(address, request, pb.Message_CHAIN_TRANSACTIONS_PROOF_RESPONSE)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting proof for transaction %s from %s: %s", txID, address, err)
+	}
+	proof := &pb.MerkleProof{}
+	if err := proto.Unmarshal(reply.Payload, proof); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling MerkleProof: %s", err)
+	}
+	return proof, nil
+}
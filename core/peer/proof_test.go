@@ -0,0 +1,54 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestTransactionProofVerifiesAgainstBlockHeader(t *testing.T) {
+	transactions := newTestTransactions(5)
+	header, err := newBlockHeader(2, &pb.Block{Transactions: transactions})
+	if err != nil {
+		t.Fatalf("Error creating block header: %s", err)
+	}
+	for i, tx := range transactions {
+		proof, err := newTransactionProof(tx.Uuid, 2, transactions)
+		if err != nil {
+			t.Fatalf("Error creating proof: %s", err)
+		}
+		txHash, err := TransactionHash(tx)
+		if err != nil {
+			t.Fatalf("Error hashing transaction: %s", err)
+		}
+		if !(MerkleProofVerifier{}).Verify(txHash, header.MerkleRoot, proof.MerkleProof, proof.LeafIndex) {
+			t.Errorf("Expected the proof of transaction %d to verify against the block header", i)
+		}
+		otherHash, err := TransactionHash(transactions[(i+1)%len(transactions)])
+		if err != nil {
+			t.Fatalf("Error hashing transaction: %s", err)
+		}
+		if (MerkleProofVerifier{}).Verify(otherHash, header.MerkleRoot, proof.MerkleProof, proof.LeafIndex) {
+			t.Errorf("Expected the proof of transaction %d not to verify another transaction", i)
+		}
+	}
+	if _, err := newTransactionProof("missing", 2, transactions); err == nil {
+		t.Error("Expected an error for a transaction not in the block")
+	}
+}
@@ -0,0 +1,269 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// ErrQueueFull is returned when a batch is queued for a peer address whose queue is full
+var ErrQueueFull = errors.New("Message queue full")
+
+var messageQueueDepthGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "peer",
+	Name:      "message_queue_depth",
+	Help:      "Number of CHAIN_TRANSACTIONS batches waiting to be sent, by peer address.",
+}, []string{"address"})
+
+func init() {
+	prometheus.MustRegister(messageQueueDepthGauge)
+}
+
+// OverflowPolicy is what a MessageQueue does with a batch queued for a peer
+// address whose queue is full
+type OverflowPolicy int
+
+const (
+	// ErrorOnFull refuses the batch with ErrQueueFull
+	ErrorOnFull OverflowPolicy = iota
+	// DropOldest drops the batch at the head of the queue to make room, its
+	// done callback is called with ErrQueueFull
+	DropOldest
+	// DropNewest drops the batch, its done callback is called with ErrQueueFull
+	DropNewest
+	// Block waits for room in the queue for up to the block timeout of the
+	// queue, then refuses the batch with ErrQueueFull
+	Block
+)
+
+var overflowPolicyNames = map[OverflowPolicy]string{
+	ErrorOnFull: "error",
+	DropOldest:  "dropOldest",
+	DropNewest:  "dropNewest",
+	Block:       "block",
+}
+
+func (p OverflowPolicy) String() string {
+	if name, ok := overflowPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+}
+
+// ParseOverflowPolicy returns the policy of the given name, as in peer.queue.overflowPolicy
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	for policy, policyName := range overflowPolicyNames {
+		if policyName == name {
+			return policy, nil
+		}
+	}
+	return ErrorOnFull, fmt.Errorf("Unknown overflow policy %q", name)
+}
+
+// MessageQueueOption configures a MessageQueue
+type MessageQueueOption func(*MessageQueue)
+
+// WithOverflowPolicy sets what is done with the batches queued for a full
+// queue, ErrorOnFull by default
+func WithOverflowPolicy(p OverflowPolicy) MessageQueueOption {
+	return func(q *MessageQueue) {
+		q.overflowPolicy = p
+	}
+}
+
+// WithBlockTimeout sets how long the Block overflow policy waits for room in a queue
+func WithBlockTimeout(timeout time.Duration) MessageQueueOption {
+	return func(q *MessageQueue) {
+		q.blockTimeout = timeout
+	}
+}
+
+// queuedBatch is a batch waiting in a MessageQueue, done being called with the result of sending it
+type queuedBatch struct {
+	batch *pb.TransactionBlock
+	done  func(error)
+}
+
+// MessageQueue smoothes bursts of CHAIN_TRANSACTIONS batches sent to the same
+// peers. Each peer address has a bounded FIFO of batches, drained by a single
+// goroutine sending them one at a time.
+type MessageQueue struct {
+	sync.Mutex
+	maxDepth       int
+	overflowPolicy OverflowPolicy
+	blockTimeout   time.Duration
+	send           func(address string, batch *pb.TransactionBlock) error
+	queues         map[string]chan queuedBatch
+	closed         bool
+	// closing is closed by Close for the batches blocked on a full queue to give up
+	closing chan struct{}
+	blocked sync.WaitGroup
+}
+
+// NewMessageQueue returns a queue holding at most maxDepth batches per peer address
+func NewMessageQueue(maxDepth int, options ...MessageQueueOption) *MessageQueue {
+	q := &MessageQueue{maxDepth: maxDepth, send: sendTransactionsToPeer, queues: make(map[string]chan queuedBatch), closing: make(chan struct{})}
+	for _, option := range options {
+		option(q)
+	}
+	return q
+}
+
+// newMessageQueueFromConfig returns a queue of peer.queue.maxDepth batches
+// handling full queues as peer.queue.overflowPolicy, an unknown policy
+// defaulting to error
+func newMessageQueueFromConfig() *MessageQueue {
+	policy, err := ParseOverflowPolicy(viper.GetString("peer.queue.overflowPolicy"))
+	if err != nil {
+		peerLogger.Warningf("%s, defaulting to %s", err, policy)
+	}
+	return NewMessageQueue(viper.GetInt("peer.queue.maxDepth"), WithOverflowPolicy(policy), WithBlockTimeout(viper.GetDuration("peer.queue.blockTimeout")))
+}
+
+// Enqueue queues the batch for the peer at address, done is then called with
+// the result of sending it, if not nil. If maxDepth batches are already
+// waiting for the address, the overflow policy of the queue applies.
+func (q *MessageQueue) Enqueue(address string, batch *pb.TransactionBlock, done func(error)) error {
+	q.Lock()
+	if q.closed {
+		q.Unlock()
+		return errors.New("Message queue is closed")
+	}
+	queue, ok := q.queues[address]
+	if !ok {
+		queue = make(chan queuedBatch, q.maxDepth)
+		q.queues[address] = queue
+		go q.drain(address, queue)
+	}
+	queued := queuedBatch{batch: batch, done: done}
+	select {
+	case queue <- queued:
+		messageQueueDepthGauge.WithLabelValues(address).Set(float64(len(queue)))
+		q.Unlock()
+		return nil
+	default:
+	}
+	switch q.overflowPolicy {
+	case DropOldest:
+		// Only Enqueue fills the queue and the lock is held, the drain goroutine
+		// can only make more room
+		var dropped []queuedBatch
+		for sent := false; !sent; {
+			select {
+			case queue <- queued:
+				sent = true
+			default:
+				select {
+				case oldest := <-queue:
+					dropped = append(dropped, oldest)
+				default:
+				}
+			}
+		}
+		messageQueueDepthGauge.WithLabelValues(address).Set(float64(len(queue)))
+		q.Unlock()
+		for _, oldest := range dropped {
+			peerLogger.Warningf("Dropping the oldest transactions queued for %s to make room", address)
+			if oldest.done != nil {
+				oldest.done(ErrQueueFull)
+			}
+		}
+		return nil
+	case DropNewest:
+		q.Unlock()
+		peerLogger.Warningf("Dropping transactions for %s, %d batches already queued", address, len(queue))
+		if done != nil {
+			done(ErrQueueFull)
+		}
+		return nil
+	case Block:
+		q.blocked.Add(1)
+		q.Unlock()
+		defer q.blocked.Done()
+		timer := time.NewTimer(q.blockTimeout)
+		defer timer.Stop()
+		select {
+		case queue <- queued:
+			messageQueueDepthGauge.WithLabelValues(address).Set(float64(len(queue)))
+			return nil
+		case <-timer.C:
+			peerLogger.Warningf("Dropping transactions for %s, no room in the queue after %s", address, q.blockTimeout)
+			return ErrQueueFull
+		case <-q.closing:
+			return errors.New("Message queue is closed")
+		}
+	default:
+		q.Unlock()
+		peerLogger.Warningf("Dropping transactions for %s, %d batches already queued", address, len(queue))
+		return ErrQueueFull
+	}
+}
+
+// Send queues the batch for the peer at address and waits for it to be sent
+func (q *MessageQueue) Send(address string, batch *pb.TransactionBlock) error {
+	sent := make(chan error, 1)
+	if err := q.Enqueue(address, batch, func(err error) { sent <- err }); err != nil {
+		return err
+	}
+	return <-sent
+}
+
+// Depth returns the number of batches waiting to be sent to the peer at address
+func (q *MessageQueue) Depth(address string) int {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.queues[address])
+}
+
+func (q *MessageQueue) drain(address string, queue chan queuedBatch) {
+	for queued := range queue {
+		messageQueueDepthGauge.WithLabelValues(address).Set(float64(len(queue)))
+		err := q.send(address, queued.batch)
+		if queued.done != nil {
+			queued.done(err)
+		} else if err != nil {
+			peerLogger.Errorf("Error sending queued transactions to %s: %s", address, err)
+		}
+	}
+}
+
+// Close stops accepting batches, those already queued are still sent and
+// those waiting for room in a queue are refused
+func (q *MessageQueue) Close() {
+	q.Lock()
+	if q.closed {
+		q.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.closing)
+	q.Unlock()
+	q.blocked.Wait()
+	q.Lock()
+	defer q.Unlock()
+	for _, queue := range q.queues {
+		close(queue)
+	}
+}
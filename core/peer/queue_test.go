@@ -0,0 +1,176 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestMessageQueueSendsInOrder(t *testing.T) {
+	queue := NewMessageQueue(10)
+	defer queue.Close()
+	sent := make(chan string, 3)
+	queue.send = func(address string, batch *pb.TransactionBlock) error {
+		sent <- batch.Transactions[0].Uuid
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		if err := queue.Enqueue("peer1:30303", &pb.TransactionBlock{Transactions: []*pb.Transaction{{Uuid: fmt.Sprintf("tx%d", i)}}}, nil); err != nil {
+			t.Fatalf("Error queueing batch %d: %s", i, err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if txID := <-sent; txID != fmt.Sprintf("tx%d", i) {
+			t.Errorf("Expected tx%d to be sent, got %s", i, txID)
+		}
+	}
+}
+
+func TestMessageQueueFull(t *testing.T) {
+	queue := NewMessageQueue(1)
+	defer queue.Close()
+	sending := make(chan struct{}, 3)
+	release := make(chan struct{})
+	queue.send = func(address string, batch *pb.TransactionBlock) error {
+		sending <- struct{}{}
+		<-release
+		return nil
+	}
+	batch := &pb.TransactionBlock{}
+	if err := queue.Enqueue("peer1:30303", batch, nil); err != nil {
+		t.Fatalf("Error queueing the first batch: %s", err)
+	}
+	<-sending
+	if err := queue.Enqueue("peer1:30303", batch, nil); err != nil {
+		t.Fatalf("Error queueing the second batch: %s", err)
+	}
+	if depth := queue.Depth("peer1:30303"); depth != 1 {
+		t.Errorf("Expected a depth of 1, got %d", depth)
+	}
+	if err := queue.Enqueue("peer1:30303", batch, nil); err != ErrQueueFull {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+	if err := queue.Enqueue("peer2:30303", batch, nil); err != nil {
+		t.Errorf("Expected the queue of another address not to be full, got %s", err)
+	}
+	close(release)
+}
+
+// fillMessageQueue queues batches tx0 and tx1 for peer1:30303, tx0 being sent
+// until release is closed and tx1 waiting in the queue of depth 1. The IDs of
+// the batches sent are returned on the channel.
+func fillMessageQueue(t *testing.T, queue *MessageQueue, release chan struct{}) <-chan string {
+	sending := make(chan string, 10)
+	queue.send = func(address string, batch *pb.TransactionBlock) error {
+		if len(batch.Transactions) > 0 {
+			sending <- batch.Transactions[0].Uuid
+		}
+		<-release
+		return nil
+	}
+	for i := 0; i < 2; i++ {
+		if err := queue.Enqueue("peer1:30303", &pb.TransactionBlock{Transactions: []*pb.Transaction{{Uuid: fmt.Sprintf("tx%d", i)}}}, nil); err != nil {
+			t.Fatalf("Error queueing batch %d: %s", i, err)
+		}
+		if i == 0 {
+			<-sending
+		}
+	}
+	return sending
+}
+
+func TestMessageQueueDropOldest(t *testing.T) {
+	queue := NewMessageQueue(1, WithOverflowPolicy(DropOldest))
+	defer queue.Close()
+	release := make(chan struct{})
+	sent := fillMessageQueue(t, queue, release)
+	if err := queue.Enqueue("peer1:30303", &pb.TransactionBlock{Transactions: []*pb.Transaction{{Uuid: "tx2"}}}, nil); err != nil {
+		t.Fatalf("Expected the oldest batch to make room, got %s", err)
+	}
+	if depth := queue.Depth("peer1:30303"); depth != 1 {
+		t.Errorf("Expected a depth of 1, got %d", depth)
+	}
+	close(release)
+	if txID := <-sent; txID != "tx2" {
+		t.Errorf("Expected tx1 to be dropped and tx2 sent, got %s", txID)
+	}
+}
+
+func TestMessageQueueDropNewest(t *testing.T) {
+	queue := NewMessageQueue(1, WithOverflowPolicy(DropNewest))
+	defer queue.Close()
+	release := make(chan struct{})
+	fillMessageQueue(t, queue, release)
+	defer close(release)
+	var result error
+	if err := queue.Enqueue("peer1:30303", &pb.TransactionBlock{}, func(err error) { result = err }); err != nil {
+		t.Fatalf("Expected Enqueue to drop the batch without an error, got %s", err)
+	}
+	if result != ErrQueueFull {
+		t.Errorf("Expected the dropped batch to be done with ErrQueueFull, got %v", result)
+	}
+}
+
+func TestMessageQueueBlock(t *testing.T) {
+	queue := NewMessageQueue(1, WithOverflowPolicy(Block), WithBlockTimeout(10*time.Millisecond))
+	defer queue.Close()
+	release := make(chan struct{})
+	fillMessageQueue(t, queue, release)
+	if err := queue.Enqueue("peer1:30303", &pb.TransactionBlock{}, nil); err != ErrQueueFull {
+		t.Errorf("Expected ErrQueueFull after the block timeout, got %v", err)
+	}
+
+	queued := make(chan error)
+	go func() {
+		queued <- queue.Enqueue("peer1:30303", &pb.TransactionBlock{}, nil)
+	}()
+	close(release)
+	if err := <-queued; err != nil {
+		t.Errorf("Expected the batch to be queued once there is room, got %s", err)
+	}
+}
+
+func TestMessageQueueCloseUnblocks(t *testing.T) {
+	queue := NewMessageQueue(1, WithOverflowPolicy(Block), WithBlockTimeout(time.Minute))
+	release := make(chan struct{})
+	defer close(release)
+	fillMessageQueue(t, queue, release)
+	queued := make(chan error)
+	go func() {
+		queued <- queue.Enqueue("peer1:30303", &pb.TransactionBlock{}, nil)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	queue.Close()
+	if err := <-queued; err == nil || err == ErrQueueFull {
+		t.Errorf("Expected the blocked batch to be refused as the queue closed, got %v", err)
+	}
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	for _, policy := range []OverflowPolicy{ErrorOnFull, DropOldest, DropNewest, Block} {
+		if parsed, err := ParseOverflowPolicy(policy.String()); err != nil || parsed != policy {
+			t.Errorf("Expected %s to parse back, got %s, %v", policy, parsed, err)
+		}
+	}
+	if _, err := ParseOverflowPolicy("dropAll"); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// MergePeerLists returns the union of the lists, each endpoint listed once in
+// the order it is first seen. An endpoint listed by several peers takes the
+// longest TTL they keep it for, a TTL of 0 meaning for good, and is dropped
+// if that TTL is below minTTL.
+func MergePeerLists(lists [][]*pb.PeerEndpoint, minTTL time.Duration) []*pb.PeerEndpoint {
+	merged := []*pb.PeerEndpoint{}
+	index := make(map[string]int)
+	for _, list := range lists {
+		for _, endpoint := range list {
+			if endpoint == nil || endpoint.ID == nil {
+				continue
+			}
+			i, ok := index[endpoint.ID.Name]
+			if !ok {
+				index[endpoint.ID.Name] = len(merged)
+				merged = append(merged, endpoint)
+			} else if kept := merged[i]; kept.TtlMs != 0 && (endpoint.TtlMs == 0 || endpoint.TtlMs > kept.TtlMs) {
+				merged[i] = endpoint
+			}
+		}
+	}
+	minTTLMs := uint64(minTTL / time.Millisecond)
+	peers := merged[:0]
+	for _, endpoint := range merged {
+		if endpoint.TtlMs == 0 || endpoint.TtlMs >= minTTLMs {
+			peers = append(peers, endpoint)
+		}
+	}
+	return peers
+}
+
+// registryPeerList returns the endpoints of the registry with the TTL left to
+// them at now, leaving out the expired ones
+func registryPeerList(registry *PeerRegistry, now time.Time) []*pb.PeerEndpoint {
+	peers := []*pb.PeerEndpoint{}
+	for _, entry := range registry.Entries() {
+		endpoint := *entry.Endpoint
+		if remaining, expires := entry.TTLRemaining(now); expires {
+			if remaining <= 0 {
+				continue
+			}
+			endpoint.TtlMs = uint64((remaining + time.Millisecond - 1) / time.Millisecond)
+		}
+		peers = append(peers, &endpoint)
+	}
+	return peers
+}
+
+// quorumAddresses returns the addresses of up to quorumSize peers of the
+// registry picked at random, other than the one of ID exclude
+func quorumAddresses(registry *PeerRegistry, quorumSize uint32, exclude *pb.PeerID) []string {
+	var addresses []string
+	for _, entry := range registry.Entries() {
+		if exclude != nil && entry.Endpoint.ID != nil && entry.Endpoint.ID.Name == exclude.Name {
+			continue
+		}
+		addresses = append(addresses, entry.Endpoint.Address)
+	}
+	for i := range addresses {
+		j := i + rand.Intn(len(addresses)-i)
+		addresses[i], addresses[j] = addresses[j], addresses[i]
+	}
+	if uint32(len(addresses)) > quorumSize {
+		addresses = addresses[:quorumSize]
+	}
+	return addresses
+}
+
+// quorumPeerList merges the peer list of the registry with those of up to
+// quorumSize of its peers, queried in parallel with DISC_QUORUM_GET_PEERS of
+// quorum 0. Peers not answering within peer.discovery.quorumTimeout are left
+// out of the quorum, endpoints kept for less than peer.discovery.quorumMinTTL
+// out of the list.
+func quorumPeerList(registry *PeerRegistry, quorumSize uint32, exclude *pb.PeerID) []*pb.PeerEndpoint {
+	addresses := quorumAddresses(registry, quorumSize, exclude)
+	timeout := viper.GetDuration("peer.discovery.quorumTimeout")
+	lists := make([][]*pb.PeerEndpoint, len(addresses)+1)
+	lists[0] = registryPeerList(registry, time.Now())
+	var wg sync.WaitGroup
+	for i, address := range addresses {
+		wg.Add(1)
+		go func(i int, address string) {
+			defer wg.Done()
+			peers, err := fetchPeerList(address, 0, timeout)
+			if err != nil {
+				peerLogger.Debugf("Leaving %s out of the quorum: %s", address, err)
+				return
+			}
+			lists[i+1] = peers
+		}(i, address)
+	}
+	wg.Wait()
+	return MergePeerLists(lists, viper.GetDuration("peer.discovery.quorumMinTTL"))
+}
+
+// fetchPeerList sends a DISC_QUORUM_GET_PEERS of quorumSize to the peer at
+// address and returns the peers of its DISC_PEERS reply, waiting up to timeout
+func fetchPeerList(address string, quorumSize uint32, timeout time.Duration) ([]*pb.PeerEndpoint, error) {
+	data, err := proto.Marshal(&pb.QuorumGetPeers{QuorumSize: quorumSize})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling QuorumGetPeers: %s", err)
+	}
+	return requestPeerList(address, &pb.Message{Type: pb.Message_DISC_QUORUM_GET_PEERS, Payload: data}, timeout)
+}
+
+// requestPeerList sends the request to the peer at address and returns the
+// peers of its DISC_PEERS reply, waiting up to timeout. A
+// DISC_GET_PEERS_RETRY_AFTER reply is returned as an error.
+func requestPeerList(address string, request *pb.Message, timeout time.Duration) (peers []*pb.PeerEndpoint, err error) {
+	request.Timestamp = util.CreateUtcTimestamp()
+	err = withRequestStreamTimeout(address, timeout, func(stream ChatStream) error {
+		if err := stream.Send(request); err != nil {
+			return fmt.Errorf("Error sending %s: %s", request.Type, err)
+		}
+		var reply *pb.Message
+		for reply == nil {
+			msg, err := stream.Recv()
+			if err != nil {
+				return fmt.Errorf("Error waiting for %s: %s", pb.Message_DISC_PEERS, err)
+			}
+			switch msg.Type {
+			case pb.Message_DISC_PEERS:
+				reply = msg
+			case pb.Message_DISC_GET_PEERS_RETRY_AFTER:
+				retryAfter := &pb.GetPeersRetryAfter{}
+				proto.Unmarshal(msg.Payload, retryAfter)
+				return fmt.Errorf("Rate limited, retry after %dms", retryAfter.RetryAfterMs)
+			}
+		}
+		peersMessage := &pb.PeersMessage{}
+		if err := proto.Unmarshal(reply.Payload, peersMessage); err != nil {
+			return fmt.Errorf("Error unmarshalling PeersMessage: %s", err)
+		}
+		peers = peersMessage.Peers
+		return nil
+	})
+	return peers, err
+}
+
+// QuorumGetPeers asks the peer at address for the merge of its peer list with
+// those of quorumSize of its peers, waiting up to peer.chat.requestTimeout,
+// which should exceed the peer.discovery.quorumTimeout of the queried peer
+func QuorumGetPeers(address string, quorumSize uint32) ([]*pb.PeerEndpoint, error) {
+	peers, err := fetchPeerList(address, quorumSize, viper.GetDuration("peer.chat.requestTimeout"))
+	if err != nil {
+		return nil, fmt.Errorf("Error getting quorum peer list from %s: %s", address, err)
+	}
+	return peers, nil
+}
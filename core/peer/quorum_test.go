@@ -0,0 +1,106 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func quorumEndpoint(name string, ttl time.Duration) *pb.PeerEndpoint {
+	return &pb.PeerEndpoint{ID: &pb.PeerID{Name: name}, Address: name + ":30303", TtlMs: uint64(ttl / time.Millisecond)}
+}
+
+func TestMergePeerLists(t *testing.T) {
+	lists := [][]*pb.PeerEndpoint{
+		{quorumEndpoint("vp1", time.Minute), quorumEndpoint("vp2", time.Second)},
+		{quorumEndpoint("vp2", 2*time.Minute), quorumEndpoint("vp3", time.Second), nil},
+		nil,
+		{quorumEndpoint("vp1", 0), quorumEndpoint("vp2", time.Minute)},
+	}
+	merged := MergePeerLists(lists, 10*time.Second)
+	expected := []struct {
+		name string
+		ttl  time.Duration
+	}{{"vp1", 0}, {"vp2", 2 * time.Minute}}
+	if len(merged) != len(expected) {
+		t.Fatalf("Expected %d peers, got %v", len(expected), merged)
+	}
+	for i, e := range expected {
+		if merged[i].ID.Name != e.name || merged[i].TtlMs != uint64(e.ttl/time.Millisecond) {
+			t.Errorf("Expected peer %d to be %s with a TTL of %s, got %s with %dms", i, e.name, e.ttl, merged[i].ID.Name, merged[i].TtlMs)
+		}
+	}
+	if merged := MergePeerLists(lists, 0); len(merged) != 3 {
+		t.Fatalf("Expected every peer without minimum TTL, got %v", merged)
+	}
+}
+
+func TestRegistryPeerList(t *testing.T) {
+	registry := NewPeerRegistry()
+	registry.Add(quorumEndpoint("vp1", 0))
+	registry.Add(quorumEndpoint("vp2", 0))
+	registry.Add(quorumEndpoint("vp3", 0))
+	registry.SetTTL(&pb.PeerID{Name: "vp2"}, time.Minute)
+	registry.SetTTL(&pb.PeerID{Name: "vp3"}, time.Minute)
+	peers := registryPeerList(registry, time.Now().Add(30*time.Second))
+	ttls := make(map[string]uint64)
+	for _, peer := range peers {
+		ttls[peer.ID.Name] = peer.TtlMs
+	}
+	if ttl, ok := ttls["vp1"]; !ok || ttl != 0 {
+		t.Errorf("Expected vp1 to be listed for good, got %dms", ttl)
+	}
+	if ttl := ttls["vp2"]; ttl == 0 || ttl > 30000 {
+		t.Errorf("Expected vp2 to be listed with about 30s left, got %dms", ttl)
+	}
+	if peers := registryPeerList(registry, time.Now().Add(2*time.Minute)); len(peers) != 1 || peers[0].ID.Name != "vp1" {
+		t.Fatalf("Expected the expired peers to be left out, got %v", peers)
+	}
+	if entry, _ := registry.Get(&pb.PeerID{Name: "vp2"}); entry.Endpoint.TtlMs != 0 {
+		t.Fatal("Expected the registry endpoints to be left unchanged")
+	}
+}
+
+func TestQuorumAddresses(t *testing.T) {
+	registry := NewPeerRegistry()
+	for _, name := range []string{"vp1", "vp2", "vp3"} {
+		registry.Add(quorumEndpoint(name, 0))
+	}
+	if addresses := quorumAddresses(registry, 2, &pb.PeerID{Name: "vp1"}); len(addresses) != 2 {
+		t.Fatalf("Expected 2 peers in the quorum, got %v", addresses)
+	}
+	addresses := quorumAddresses(registry, 5, &pb.PeerID{Name: "vp1"})
+	if len(addresses) != 2 {
+		t.Fatalf("Expected the quorum to be capped by the known peers, got %v", addresses)
+	}
+	for _, address := range addresses {
+		if address == "vp1:30303" {
+			t.Fatalf("Expected the excluded peer to be left out of the quorum, got %v", addresses)
+		}
+	}
+}
+
+func TestQuorumGetPeers(t *testing.T) {
+	if _, err := QuorumGetPeers(viper.GetString("peer.address"), 2); err != nil {
+		t.Fatalf("Error getting quorum peer list: %s", err)
+	}
+}
@@ -0,0 +1,202 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/hyperledger/fabric/core/crypto/primitives"
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// ReceiptIssuer interface enables a Peer to answer CHAIN_TRANSACTIONS_GET_RECEIPT messages
+type ReceiptIssuer interface {
+	GetTransactionReceipt(txID string) (*pb.TransactionReceipt, error)
+}
+
+func merkleParent(left, right []byte) []byte {
+	return util.ComputeCryptoHash(append(append([]byte{}, left...), right...))
+}
+
+// merkleTree returns the levels of the merkle tree over the leaves, leaves
+// first and root last. A node without a sibling is paired with itself.
+func merkleTree(leaves [][]byte) [][][]byte {
+	return merkleTreeWith(leaves, merkleParent)
+}
+
+// merkleTreeWith is merkleTree with parent hashing the children of a node
+func merkleTreeWith(leaves [][]byte, parent func(left, right []byte) []byte) [][][]byte {
+	levels := [][][]byte{leaves}
+	for level := leaves; len(level) > 1; {
+		var parents [][]byte
+		for i := 0; i < len(level); i += 2 {
+			right := level[i]
+			if i+1 < len(level) {
+				right = level[i+1]
+			}
+			parents = append(parents, parent(level[i], right))
+		}
+		levels = append(levels, parents)
+		level = parents
+	}
+	return levels
+}
+
+// merkleProof returns the sibling hashes on the path from the leaf at index to the root
+func merkleProof(levels [][][]byte, index uint64) [][]byte {
+	var proof [][]byte
+	for _, level := range levels[:len(levels)-1] {
+		sibling := index ^ 1
+		if sibling >= uint64(len(level)) {
+			sibling = index
+		}
+		proof = append(proof, level[sibling])
+		index /= 2
+	}
+	return proof
+}
+
+// merkleRootFromProof returns the root reached by applying the proof to the leaf at index
+func merkleRootFromProof(leaf []byte, index uint64, proof [][]byte) []byte {
+	return merkleRootFromProofWith(leaf, index, proof, merkleParent)
+}
+
+// merkleRootFromProofWith is merkleRootFromProof with parent hashing the children of a node
+func merkleRootFromProofWith(leaf []byte, index uint64, proof [][]byte, parent func(left, right []byte) []byte) []byte {
+	hash := leaf
+	for _, sibling := range proof {
+		if index%2 == 0 {
+			hash = parent(hash, sibling)
+		} else {
+			hash = parent(sibling, hash)
+		}
+		index /= 2
+	}
+	return hash
+}
+
+func transactionLeaf(tx *pb.Transaction) ([]byte, error) {
+	data, err := proto.Marshal(tx)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling transaction %s: %s", tx.Uuid, err)
+	}
+	return util.ComputeCryptoHash(data), nil
+}
+
+// transactionsMerkleTree returns the levels of the merkle tree over the transactions
+func transactionsMerkleTree(transactions []*pb.Transaction) ([][][]byte, error) {
+	leaves := make([][]byte, len(transactions))
+	for i, tx := range transactions {
+		leaf, err := transactionLeaf(tx)
+		if err != nil {
+			return nil, err
+		}
+		leaves[i] = leaf
+	}
+	return merkleTree(leaves), nil
+}
+
+// receiptSigningBytes returns the bytes a receipt signature is computed over
+func receiptSigningBytes(receipt *pb.TransactionReceipt) ([]byte, error) {
+	unsigned := *receipt
+	unsigned.Signature = nil
+	return proto.Marshal(&unsigned)
+}
+
+// newTransactionReceipt builds the receipt for the transaction at txIndex
+// among the transactions of block blockNumber and signs it with sign
+func newTransactionReceipt(blockNumber, txIndex uint64, transactions []*pb.Transaction, sign func(msg []byte) ([]byte, error)) (*pb.TransactionReceipt, error) {
+	if txIndex >= uint64(len(transactions)) {
+		return nil, fmt.Errorf("Transaction index %d out of range for block %d", txIndex, blockNumber)
+	}
+	levels, err := transactionsMerkleTree(transactions)
+	if err != nil {
+		return nil, err
+	}
+	receipt := &pb.TransactionReceipt{
+		TxID:        transactions[txIndex].Uuid,
+		BlockNumber: blockNumber,
+		TxIndex:     txIndex,
+		MerkleProof: merkleProof(levels, txIndex),
+		MerkleRoot:  levels[len(levels)-1][0],
+	}
+	data, err := receiptSigningBytes(receipt)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling receipt for transaction %s: %s", receipt.TxID, err)
+	}
+	if receipt.Signature, err = sign(data); err != nil {
+		return nil, fmt.Errorf("Error signing receipt for transaction %s: %s", receipt.TxID, err)
+	}
+	return receipt, nil
+}
+
+// ReceiptVerifier checks the receipts issued by peers for committed transactions
+type ReceiptVerifier struct{}
+
+// Verify checks that the receipt was signed by the holder of the private key matching peerPublicKey
+func (ReceiptVerifier) Verify(receipt *pb.TransactionReceipt, peerPublicKey *ecdsa.PublicKey) error {
+	data, err := receiptSigningBytes(receipt)
+	if err != nil {
+		return fmt.Errorf("Error marshalling receipt for transaction %s: %s", receipt.TxID, err)
+	}
+	ok, err := primitives.ECDSAVerify(peerPublicKey, data, receipt.Signature)
+	if err != nil {
+		return fmt.Errorf("Error verifying receipt signature for transaction %s: %s", receipt.TxID, err)
+	}
+	if !ok {
+		return fmt.Errorf("Invalid receipt signature for transaction %s", receipt.TxID)
+	}
+	return nil
+}
+
+// VerifyInclusion checks that the merkle proof of the receipt places tx under the receipt merkle root
+func (ReceiptVerifier) VerifyInclusion(receipt *pb.TransactionReceipt, tx *pb.Transaction) error {
+	if tx.Uuid != receipt.TxID {
+		return fmt.Errorf("Receipt is for transaction %s, not %s", receipt.TxID, tx.Uuid)
+	}
+	leaf, err := transactionLeaf(tx)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(merkleRootFromProof(leaf, receipt.TxIndex, receipt.MerkleProof), receipt.MerkleRoot) {
+		return fmt.Errorf("Merkle proof of the receipt does not include transaction %s", tx.Uuid)
+	}
+	return nil
+}
+
+// GetReceipt asks the peer at address for the receipt of a committed transaction
+func GetReceipt(address, txID string) (*pb.TransactionReceipt, error) {
+	data, err := proto.Marshal(&pb.GetTransactionReceipt{TxID: txID})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling GetTransactionReceipt: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS_GET_RECEIPT, Payload: data}
+	reply, err := requestOverChat(address, request, pb.Message_CHAIN_TRANSACTIONS_RECEIPT)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting receipt for transaction %s from %s: %s", txID, address, err)
+	}
+	receipt := &pb.TransactionReceipt{}
+	if err := proto.Unmarshal(reply.Payload, receipt); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling TransactionReceipt: %s", err)
+	}
+	return receipt, nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/core/crypto/primitives"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func newTestTransactions(n int) []*pb.Transaction {
+	transactions := make([]*pb.Transaction, n)
+	for i := range transactions {
+		transactions[i] = &pb.Transaction{Uuid: fmt.Sprintf("tx%d", i)}
+	}
+	return transactions
+}
+
+func noSignature([]byte) ([]byte, error) {
+	return nil, nil
+}
+
+func TestReceiptMerkleProof(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 5, 8} {
+		transactions := newTestTransactions(n)
+		for i, tx := range transactions {
+			receipt, err := newTransactionReceipt(7, uint64(i), transactions, noSignature)
+			if err != nil {
+				t.Fatalf("Error creating receipt: %s", err)
+			}
+			if err := (ReceiptVerifier{}).VerifyInclusion(receipt, tx); err != nil {
+				t.Errorf("Expected transaction %d of %d to be included: %s", i, n, err)
+			}
+			if n > 1 {
+				other := transactions[(i+1)%n]
+				receipt.TxID = other.Uuid
+				if err := (ReceiptVerifier{}).VerifyInclusion(receipt, other); err == nil {
+					t.Errorf("Expected the proof of transaction %d of %d not to include another transaction", i, n)
+				}
+			}
+		}
+	}
+	if _, err := newTransactionReceipt(0, 3, newTestTransactions(3), noSignature); err == nil {
+		t.Error("Expected an error for a transaction index out of range")
+	}
+}
+
+func TestReceiptVerifierVerify(t *testing.T) {
+	primitives.SetSecurityLevel("SHA3", 256)
+	key, err := primitives.NewECDSAKey()
+	if err != nil {
+		t.Fatalf("Error generating key: %s", err)
+	}
+	sign := func(msg []byte) ([]byte, error) { return primitives.ECDSASign(key, msg) }
+	receipt, err := newTransactionReceipt(3, 1, newTestTransactions(4), sign)
+	if err != nil {
+		t.Fatalf("Error creating receipt: %s", err)
+	}
+	if err := (ReceiptVerifier{}).Verify(receipt, &key.PublicKey); err != nil {
+		t.Errorf("Expected receipt signature to verify: %s", err)
+	}
+
+	receipt.BlockNumber = 4
+	if err := (ReceiptVerifier{}).Verify(receipt, &key.PublicKey); err == nil {
+		t.Error("Expected a tampered receipt not to verify")
+	}
+}
+
+func TestGetReceiptWithoutSecurity(t *testing.T) {
+	if SecurityEnabled() {
+		t.Skip("Security is enabled")
+	}
+	if _, err := GetReceipt(viper.GetString("peer.address"), "not-a-transaction"); err == nil {
+		t.Error("Expected an error response when the peer cannot issue receipts")
+	}
+}
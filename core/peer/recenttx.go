@@ -0,0 +1,161 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/core/ledger"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// TransactionAccountID returns the ID of the account of the transaction, the
+// hex SHA-256 of the certificate it was signed with, empty if unsigned
+func TransactionAccountID(tx *pb.Transaction) string {
+	return ledger.TransactionAccountID(tx)
+}
+
+// recentTransactions returns up to limit transactions of the account, most
+// recent first, before the cursor or from the end of the chain if nil, and
+// the cursor of the next ones. At most maxScanBlocks blocks are read, 0
+// reading as many as needed. The returned cursor is nil once block 0 is read.
+func recentTransactions(blockchain BlockChainAccessor, accountID string, limit uint32, before *pb.RecentTransactionsCursor, maxScanBlocks int) ([]*pb.Transaction, *pb.RecentTransactionsCursor, error) {
+	height := blockchain.GetBlockchainSize()
+	position := pb.RecentTransactionsCursor{BlockNumber: height}
+	var current []*pb.Transaction
+	if before != nil {
+		if before.BlockNumber > height || (before.BlockNumber == height && before.TxIndex > 0) {
+			return nil, nil, fmt.Errorf("Cursor at block %d is past the end of the chain of %d blocks", before.BlockNumber, height)
+		}
+		position = *before
+		if position.TxIndex > 0 {
+			block, err := blockchain.GetBlockByNumber(position.BlockNumber)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Error getting block %d: %s", position.BlockNumber, err)
+			}
+			current = block.Transactions
+			if int(position.TxIndex) > len(current) {
+				position.TxIndex = uint32(len(current))
+			}
+		}
+	}
+	var transactions []*pb.Transaction
+	for scanned := 0; ; {
+		if position.TxIndex == 0 {
+			if position.BlockNumber == 0 {
+				return transactions, nil, nil
+			}
+			if maxScanBlocks > 0 && scanned == maxScanBlocks {
+				return transactions, &position, nil
+			}
+			block, err := blockchain.GetBlockByNumber(position.BlockNumber - 1)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Error getting block %d: %s", position.BlockNumber-1, err)
+			}
+			scanned++
+			current = block.Transactions
+			position = pb.RecentTransactionsCursor{BlockNumber: position.BlockNumber - 1, TxIndex: uint32(len(current))}
+			continue
+		}
+		position.TxIndex--
+		if tx := current[position.TxIndex]; TransactionAccountID(tx) == accountID {
+			transactions = append(transactions, tx)
+			if uint32(len(transactions)) == limit {
+				if position.BlockNumber == 0 && position.TxIndex == 0 {
+					return transactions, nil, nil
+				}
+				return transactions, &position, nil
+			}
+		}
+	}
+}
+
+// recentTransactionsPageSize returns the most transactions sent in reply to a
+// CHAIN_QUERY_RECENT_TX of maxCount, peer.query.maxPageSize, 0 meaning a page
+func recentTransactionsPageSize(maxCount uint32) uint32 {
+	pageSize := uint32(viper.GetInt("peer.query.maxPageSize"))
+	if maxCount == 0 || (pageSize > 0 && maxCount > pageSize) {
+		return pageSize
+	}
+	return maxCount
+}
+
+// GetRecentTransactions returns up to maxCount committed transactions of the
+// account, most recent first, before the cursor or from the end of the chain
+// if nil, and the cursor of the next ones. At most peer.query.maxScanBlocks
+// blocks are read.
+func (p *PeerImpl) GetRecentTransactions(accountID string, maxCount uint32, before *pb.RecentTransactionsCursor) ([]*pb.Transaction, *pb.RecentTransactionsCursor, error) {
+	if accountID == "" {
+		return nil, nil, fmt.Errorf("No account ID given")
+	}
+	return recentTransactions(p, accountID, maxCount, before, viper.GetInt("peer.query.maxScanBlocks"))
+}
+
+// FetchRecentTransactions asks the peer at address for the last maxCount
+// committed transactions of the account, most recent first, issuing a
+// CHAIN_QUERY_RECENT_TX for every page of transactions the peer limits its
+// replies to
+func FetchRecentTransactions(address, accountID string, maxCount uint32) (transactions []*pb.Transaction, err error) {
+	err = withRequestStream(address, func(stream ChatStream) error {
+		transactions, err = fetchRecentTransactionsOverStream(stream, accountID, maxCount)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching recent transactions of account %s from %s: %s", accountID, address, err)
+	}
+	return transactions, nil
+}
+
+func fetchRecentTransactionsOverStream(stream ChatStream, accountID string, maxCount uint32) ([]*pb.Transaction, error) {
+	var transactions []*pb.Transaction
+	var before *pb.RecentTransactionsCursor
+	for uint32(len(transactions)) < maxCount {
+		data, err := proto.Marshal(&pb.QueryRecentTransactions{AccountID: accountID, MaxCount: maxCount - uint32(len(transactions)), Before: before})
+		if err != nil {
+			return nil, fmt.Errorf("Error marshalling QueryRecentTransactions: %s", err)
+		}
+		request := &pb.Message{Type: pb.Message_CHAIN_QUERY_RECENT_TX, Payload: data}
+		reply, err := requestOverStream(stream, request, pb.Message_CHAIN_RECENT_TX_RESPONSE)
+		if err != nil {
+			return nil, err
+		}
+		page := &pb.RecentTransactionsResponse{}
+		if err := proto.Unmarshal(reply.Payload, page); err != nil {
+			return nil, fmt.Errorf("Error unmarshalling RecentTransactionsResponse: %s", err)
+		}
+		transactions = append(transactions, page.Transactions...)
+		if page.Next == nil {
+			break
+		}
+		if before != nil && !cursorBefore(page.Next, before) {
+			return nil, fmt.Errorf("%s did not advance past block %d", pb.Message_CHAIN_RECENT_TX_RESPONSE, before.BlockNumber)
+		}
+		before = page.Next
+	}
+	if uint32(len(transactions)) > maxCount {
+		transactions = transactions[:maxCount]
+	}
+	return transactions, nil
+}
+
+// cursorBefore returns true if cursor a is before cursor b on the chain
+func cursorBefore(a, b *pb.RecentTransactionsCursor) bool {
+	return a.BlockNumber < b.BlockNumber || (a.BlockNumber == b.BlockNumber && a.TxIndex < b.TxIndex)
+}
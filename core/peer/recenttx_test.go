@@ -0,0 +1,133 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// newRecentTransactionsBlockchain returns 5 blocks of 3 transactions, tx<block>-<index>,
+// signed by alice for even indexes and bob for odd ones
+func newRecentTransactionsBlockchain() *testBlockchain {
+	blockchain := &testBlockchain{}
+	for n := 0; n < 5; n++ {
+		block := &pb.Block{}
+		for i := 0; i < 3; i++ {
+			cert := "alice"
+			if i%2 == 1 {
+				cert = "bob"
+			}
+			block.Transactions = append(block.Transactions, &pb.Transaction{Uuid: fmt.Sprintf("tx%d-%d", n, i), Cert: []byte(cert)})
+		}
+		blockchain.blocks = append(blockchain.blocks, block)
+	}
+	return blockchain
+}
+
+func txIDs(transactions []*pb.Transaction) string {
+	var ids []string
+	for _, tx := range transactions {
+		ids = append(ids, tx.Uuid)
+	}
+	return fmt.Sprint(ids)
+}
+
+func TestRecentTransactions(t *testing.T) {
+	blockchain := newRecentTransactionsBlockchain()
+	alice := TransactionAccountID(&pb.Transaction{Cert: []byte("alice")})
+
+	transactions, next, err := recentTransactions(blockchain, alice, 3, nil, 0)
+	if err != nil {
+		t.Fatalf("Error getting recent transactions: %s", err)
+	}
+	if txIDs(transactions) != "[tx4-2 tx4-0 tx3-2]" {
+		t.Errorf("Expected the last 3 transactions of alice, got %s", txIDs(transactions))
+	}
+	if next == nil || next.BlockNumber != 3 || next.TxIndex != 2 {
+		t.Fatalf("Expected the next page before tx3-2, got %v", next)
+	}
+	transactions, next, _ = recentTransactions(blockchain, alice, 3, next, 0)
+	if txIDs(transactions) != "[tx3-0 tx2-2 tx2-0]" {
+		t.Errorf("Expected the next 3 transactions of alice, got %s", txIDs(transactions))
+	}
+	transactions, next, _ = recentTransactions(blockchain, alice, 10, next, 0)
+	if txIDs(transactions) != "[tx1-2 tx1-0 tx0-2 tx0-0]" || next != nil {
+		t.Errorf("Expected the remaining transactions of alice and no next page, got %s, %v", txIDs(transactions), next)
+	}
+
+	// Reading 2 blocks per query
+	transactions, next, _ = recentTransactions(blockchain, alice, 10, nil, 2)
+	if txIDs(transactions) != "[tx4-2 tx4-0 tx3-2 tx3-0]" || next == nil || next.BlockNumber != 3 || next.TxIndex != 0 {
+		t.Errorf("Expected the transactions of the last 2 blocks and the next page before block 3, got %s, %v", txIDs(transactions), next)
+	}
+
+	if _, _, err := recentTransactions(blockchain, alice, 1, &pb.RecentTransactionsCursor{BlockNumber: 6}, 0); err == nil {
+		t.Error("Expected an error for a cursor past the end of the chain")
+	}
+}
+
+func TestFetchRecentTransactionsPages(t *testing.T) {
+	blockchain := newRecentTransactionsBlockchain()
+	bob := TransactionAccountID(&pb.Transaction{Cert: []byte("bob")})
+
+	// Serve the CHAIN_QUERY_RECENT_TX requests 2 transactions at a time
+	stream := &handshakeStream{recv: make(chan *pb.Message, 10), sent: make(chan *pb.Message)}
+	queries := 0
+	go func() {
+		defer close(stream.recv)
+		for msg := range stream.sent {
+			query := &pb.QueryRecentTransactions{}
+			if err := proto.Unmarshal(msg.Payload, query); err != nil {
+				t.Errorf("Error unmarshalling QueryRecentTransactions: %s", err)
+				return
+			}
+			queries++
+			limit := query.MaxCount
+			if limit > 2 {
+				limit = 2
+			}
+			transactions, next, err := recentTransactions(blockchain, query.AccountID, limit, query.Before, 0)
+			if err != nil {
+				t.Errorf("Error getting recent transactions: %s", err)
+				return
+			}
+			data, _ := proto.Marshal(&pb.RecentTransactionsResponse{Transactions: transactions, Next: next})
+			stream.recv <- &pb.Message{Type: pb.Message_CHAIN_RECENT_TX_RESPONSE, Payload: data}
+		}
+	}()
+
+	transactions, err := fetchRecentTransactionsOverStream(stream, bob, 3)
+	if err != nil {
+		t.Fatalf("Error fetching recent transactions: %s", err)
+	}
+	if txIDs(transactions) != "[tx4-1 tx3-1 tx2-1]" || queries != 2 {
+		t.Errorf("Expected the last 3 transactions of bob in 2 pages, got %s in %d", txIDs(transactions), queries)
+	}
+	transactions, err = fetchRecentTransactionsOverStream(stream, bob, 10)
+	close(stream.sent)
+	if err != nil {
+		t.Fatalf("Error fetching recent transactions: %s", err)
+	}
+	if len(transactions) != 5 {
+		t.Errorf("Expected all 5 transactions of bob, got %s", txIDs(transactions))
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
+)
+
+// ErrReconnectThrottled is returned by NewPeerClientConnectionWithAddress when
+// the rate of new outbound connections does not allow a dial within
+// peer.reconnect.maxWait
+var ErrReconnectThrottled = errors.New("Too many new outbound connections, dial throttled")
+
+// ReconnectRateLimiter is a token bucket limiting the rate at which new
+// outbound connections are dialed. A nil ReconnectRateLimiter does not limit.
+type ReconnectRateLimiter struct {
+	limiter *rate.Limiter
+	maxWait time.Duration
+}
+
+// NewReconnectRateLimiter returns a limiter allowing maxPerSecond dials, each
+// waiting up to maxWait for a token, or nil if maxPerSecond is not positive
+func NewReconnectRateLimiter(maxPerSecond float64, maxWait time.Duration) *ReconnectRateLimiter {
+	if maxPerSecond <= 0 {
+		return nil
+	}
+	burst := int(maxPerSecond)
+	if burst < 1 {
+		burst = 1
+	}
+	return &ReconnectRateLimiter{limiter: rate.NewLimiter(rate.Limit(maxPerSecond), burst), maxWait: maxWait}
+}
+
+var reconnectLimiter struct {
+	sync.Once
+	limiter *ReconnectRateLimiter
+}
+
+// GlobalReconnectLimiter returns the limiter of NewPeerClientConnectionWithAddress,
+// configured by peer.reconnect.maxPerSecond and peer.reconnect.maxWait
+func GlobalReconnectLimiter() *ReconnectRateLimiter {
+	reconnectLimiter.Do(func() {
+		reconnectLimiter.limiter = NewReconnectRateLimiter(viper.GetFloat64("peer.reconnect.maxPerSecond"), viper.GetDuration("peer.reconnect.maxWait"))
+	})
+	return reconnectLimiter.limiter
+}
+
+// Acquire takes a token for a new connection, waiting for one if the bucket
+// is drained. ErrReconnectThrottled is returned, without waiting, if no token
+// is to be had within the maximum wait.
+func (l *ReconnectRateLimiter) Acquire() error {
+	if l == nil {
+		return nil
+	}
+	r := l.limiter.Reserve()
+	delay := r.Delay()
+	if delay > l.maxWait {
+		r.Cancel()
+		return ErrReconnectThrottled
+	}
+	time.Sleep(delay)
+	return nil
+}
@@ -0,0 +1,60 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnectRateLimiterUnlimited(t *testing.T) {
+	limiter := NewReconnectRateLimiter(0, 0)
+	if limiter != nil {
+		t.Fatal("Expected no limiter without a positive rate")
+	}
+	for i := 0; i < 100; i++ {
+		if err := limiter.Acquire(); err != nil {
+			t.Fatalf("Expected a nil limiter not to limit, got %s", err)
+		}
+	}
+}
+
+func TestReconnectRateLimiterThrottled(t *testing.T) {
+	limiter := NewReconnectRateLimiter(2, 0)
+	for i := 0; i < 2; i++ {
+		if err := limiter.Acquire(); err != nil {
+			t.Fatalf("Expected dial %d to be within the burst, got %s", i, err)
+		}
+	}
+	if err := limiter.Acquire(); err != ErrReconnectThrottled {
+		t.Fatalf("Expected %v once drained, got %v", ErrReconnectThrottled, err)
+	}
+}
+
+func TestReconnectRateLimiterWaits(t *testing.T) {
+	limiter := NewReconnectRateLimiter(20, time.Second)
+	for i := 0; i < 20; i++ {
+		limiter.Acquire()
+	}
+	start := time.Now()
+	if err := limiter.Acquire(); err != nil {
+		t.Fatalf("Expected the dial to wait for a token, got %s", err)
+	}
+	if waited := time.Since(start); waited < 25*time.Millisecond {
+		t.Fatalf("Expected the dial to wait about 50ms for a token, waited %s", waited)
+	}
+}
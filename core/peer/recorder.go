@@ -0,0 +1,285 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// recordBufferSize is the number of messages a RecordingStream holds before
+// dropping the ones its file cannot be written fast enough for
+const recordBufferSize = 1024
+
+// adminSecretHeader is the HTTP header carrying peer.admin.secret to the
+// admin endpoints of the metrics server
+const adminSecretHeader = "Admin-Secret"
+
+// recordEntry is a line of a .peerlog file
+type recordEntry struct {
+	Time     time.Time `json:"time"`
+	Sent     bool      `json:"sent"`
+	Type     string    `json:"type"`
+	Message  []byte    `json:"message"`
+	received *pb.Message
+}
+
+// RecorderMiddleware records the Chat streams opened while it is enabled,
+// each to a <timestamp>-<remoteAddr>.peerlog file of its directory
+type RecorderMiddleware struct {
+	enabled int32
+	dir     string
+}
+
+// NewRecorderMiddleware returns a recorder writing to dir, recording from the start if enabled
+func NewRecorderMiddleware(dir string, enabled bool) *RecorderMiddleware {
+	m := &RecorderMiddleware{dir: dir}
+	m.SetEnabled(enabled)
+	return m
+}
+
+// newRecorderMiddlewareFromConfig returns a recorder writing to
+// peer.debug.recordDir under peer.fileSystemPath, enabled by peer.debug.record
+func newRecorderMiddlewareFromConfig() *RecorderMiddleware {
+	return NewRecorderMiddleware(filepath.Join(viper.GetString("peer.fileSystemPath"), viper.GetString("peer.debug.recordDir")), viper.GetBool("peer.debug.record"))
+}
+
+// SetEnabled starts or stops recording the Chat streams opened from now on,
+// streams being recorded keep being so until they are closed. The setting is
+// kept in peer.debug.record.
+func (m *RecorderMiddleware) SetEnabled(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&m.enabled, value)
+	viper.Set("peer.debug.record", enabled)
+}
+
+// Enabled returns true if new Chat streams are recorded
+func (m *RecorderMiddleware) Enabled() bool {
+	return atomic.LoadInt32(&m.enabled) == 1
+}
+
+// Wrap returns the stream wrapped in a RecordingStream if recording is
+// enabled, the stream itself otherwise, and the function to call once the
+// Chat is over
+func (m *RecorderMiddleware) Wrap(stream ChatStream) (ChatStream, func()) {
+	if !m.Enabled() {
+		return stream, func() {}
+	}
+	recording := newRecordingStream(stream, m.dir, time.Now())
+	return recording, recording.Close
+}
+
+// RecordingStream is a ChatStream writing the messages sent and received to
+// a file. The file is written by a goroutine of its own, messages being
+// dropped from the recording rather than blocking the stream when it falls
+// behind. It is named after the address of the remote peer, learned from its
+// DISC_HELLO.
+type RecordingStream struct {
+	ChatStream
+	sync.Mutex
+	entries chan *recordEntry
+	closed  bool
+	dropped int
+	done    chan struct{}
+}
+
+func newRecordingStream(stream ChatStream, dir string, openedAt time.Time) *RecordingStream {
+	s := &RecordingStream{ChatStream: stream, entries: make(chan *recordEntry, recordBufferSize), done: make(chan struct{})}
+	go s.write(dir, openedAt)
+	return s
+}
+
+// Send records and sends the message
+func (s *RecordingStream) Send(msg *pb.Message) error {
+	s.record(msg, true)
+	return s.ChatStream.Send(msg)
+}
+
+// Recv receives and records a message
+func (s *RecordingStream) Recv() (*pb.Message, error) {
+	msg, err := s.ChatStream.Recv()
+	if err == nil {
+		s.record(msg, false)
+	}
+	return msg, err
+}
+
+func (s *RecordingStream) record(msg *pb.Message, sent bool) {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		peerLogger.Debugf("Error marshalling %s to record it: %s", msg.Type, err)
+		return
+	}
+	entry := &recordEntry{Time: time.Now(), Sent: sent, Type: msg.Type.String(), Message: data}
+	if !sent {
+		entry.received = msg
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.entries <- entry:
+	default:
+		s.dropped++
+	}
+}
+
+// Close stops the recording once the messages recorded so far are written
+func (s *RecordingStream) Close() {
+	s.Lock()
+	if s.closed {
+		s.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.entries)
+	dropped := s.dropped
+	s.Unlock()
+	<-s.done
+	if dropped > 0 {
+		peerLogger.Warningf("Dropped %d messages from the recording of a Chat, the file could not be written fast enough", dropped)
+	}
+}
+
+// write holds the entries until the first received message, which names the
+// file, then writes them as JSON lines
+func (s *RecordingStream) write(dir string, openedAt time.Time) {
+	defer close(s.done)
+	var pending []*recordEntry
+	var remoteAddr string
+	for entry := range s.entries {
+		pending = append(pending, entry)
+		if entry.received != nil {
+			remoteAddr = helloAddress(entry.received)
+			break
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+	path := filepath.Join(dir, recordingFileName(openedAt, remoteAddr))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		peerLogger.Errorf("Error creating directory for %s: %s", path, err)
+		s.discard()
+		return
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		peerLogger.Errorf("Error creating %s: %s", path, err)
+		s.discard()
+		return
+	}
+	defer file.Close()
+	peerLogger.Infof("Recording Chat with %s to %s", remoteAddr, path)
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range pending {
+		encoder.Encode(entry)
+	}
+	for entry := range s.entries {
+		encoder.Encode(entry)
+		if len(s.entries) == 0 {
+			writer.Flush()
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		peerLogger.Errorf("Error writing %s: %s", path, err)
+	}
+}
+
+// discard drains the entries of a recording whose file could not be created
+func (s *RecordingStream) discard() {
+	for range s.entries {
+	}
+}
+
+// helloAddress returns the address of the peer which sent msg if it is a DISC_HELLO, unknown otherwise
+func helloAddress(msg *pb.Message) string {
+	if msg.Type == pb.Message_DISC_HELLO {
+		hello := &pb.HelloMessage{}
+		if err := proto.Unmarshal(msg.Payload, hello); err == nil && hello.PeerEndpoint != nil && hello.PeerEndpoint.Address != "" {
+			return hello.PeerEndpoint.Address
+		}
+	}
+	return "unknown"
+}
+
+// recordingFileName returns the name of the .peerlog file of a Chat opened at openedAt with remoteAddr
+func recordingFileName(openedAt time.Time, remoteAddr string) string {
+	return fmt.Sprintf("%s-%s.peerlog", openedAt.UTC().Format("20060102T150405.000000000Z"), strings.Replace(remoteAddr, string(filepath.Separator), "_", -1))
+}
+
+// GetRecorder returns the recorder of the Chat streams
+func (p *PeerImpl) GetRecorder() *RecorderMiddleware {
+	return p.recorder
+}
+
+// RecordHandler returns an http.Handler turning the recording of new Chat
+// streams on or off on POST ?enabled=true or false. The request must carry
+// peer.admin.secret in its Admin-Secret header, the endpoint being disabled
+// without a configured secret.
+func (p *PeerImpl) RecordHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "POST required", http.StatusMethodNotAllowed)
+			return
+		}
+		secret := viper.GetString("peer.admin.secret")
+		if secret == "" {
+			http.Error(w, "Disabled, peer.admin.secret is not set", http.StatusForbidden)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(adminSecretHeader)), []byte(secret)) != 1 {
+			http.Error(w, fmt.Sprintf("Missing or invalid %s", adminSecretHeader), http.StatusUnauthorized)
+			return
+		}
+		enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid enabled parameter: %s", err), http.StatusBadRequest)
+			return
+		}
+		p.recorder.SetEnabled(enabled)
+		peerLogger.Infof("Recording of new Chat streams enabled: %t", enabled)
+		data, err := json.Marshal(map[string]bool{"enabled": enabled})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+}
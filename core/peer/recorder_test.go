@@ -0,0 +1,115 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestRecordingStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recordings")
+	if err != nil {
+		t.Fatalf("Error creating directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	defer viper.Set("peer.debug.record", false)
+
+	stream := &handshakeStream{recv: make(chan *pb.Message, 2), sent: make(chan *pb.Message, 2)}
+	recorder := NewRecorderMiddleware(dir, true)
+	wrapped, stopRecording := recorder.Wrap(stream)
+	hello, _ := proto.Marshal(&pb.HelloMessage{PeerEndpoint: &pb.PeerEndpoint{Address: "10.0.0.2:30303"}})
+	wrapped.Send(&pb.Message{Type: pb.Message_DISC_HELLO})
+	stream.recv <- &pb.Message{Type: pb.Message_DISC_HELLO, Payload: hello}
+	stream.recv <- &pb.Message{Type: pb.Message_DISC_PING}
+	wrapped.Recv()
+	wrapped.Recv()
+	stopRecording()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*-10.0.0.2:30303.peerlog"))
+	if len(files) != 1 {
+		t.Fatalf("Expected a recording named after the remote address, got %v", files)
+	}
+	file, err := os.Open(files[0])
+	if err != nil {
+		t.Fatalf("Error opening the recording: %s", err)
+	}
+	defer file.Close()
+	var recorded []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := &recordEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			t.Fatalf("Error unmarshalling recorded entry: %s", err)
+		}
+		direction := "received "
+		if entry.Sent {
+			direction = "sent "
+		}
+		recorded = append(recorded, direction+entry.Type)
+	}
+	if expected := "sent DISC_HELLO,received DISC_HELLO,received DISC_PING"; strings.Join(recorded, ",") != expected {
+		t.Errorf("Expected the recording %s, got %v", expected, recorded)
+	}
+
+	recorder.SetEnabled(false)
+	if unwrapped, _ := recorder.Wrap(stream); unwrapped != ChatStream(stream) {
+		t.Error("Expected streams not to be wrapped with the recording disabled")
+	}
+}
+
+func TestRecordHandler(t *testing.T) {
+	defer viper.Set("peer.admin.secret", "")
+	defer viper.Set("peer.debug.record", false)
+	p := &PeerImpl{recorder: NewRecorderMiddleware("", false)}
+	post := func(query, secret string) int {
+		request := httptest.NewRequest("POST", "/debug/record?"+query, nil)
+		request.Header.Set(adminSecretHeader, secret)
+		rec := httptest.NewRecorder()
+		p.RecordHandler().ServeHTTP(rec, request)
+		return rec.Code
+	}
+
+	if code := post("enabled=true", ""); code != http.StatusForbidden {
+		t.Errorf("Expected the endpoint to be disabled without a secret, got %d", code)
+	}
+	viper.Set("peer.admin.secret", "s3cret")
+	if code := post("enabled=true", "wrong"); code != http.StatusUnauthorized || p.recorder.Enabled() {
+		t.Errorf("Expected an invalid secret to be refused, got %d", code)
+	}
+	if code := post("enabled=maybe", "s3cret"); code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid parameter to be refused, got %d", code)
+	}
+	if code := post("enabled=true", "s3cret"); code != http.StatusOK || !p.recorder.Enabled() {
+		t.Errorf("Expected the recording to be enabled, got %d", code)
+	}
+	if code := post("enabled=false", "s3cret"); code != http.StatusOK || p.recorder.Enabled() {
+		t.Errorf("Expected the recording to be disabled, got %d", code)
+	}
+}
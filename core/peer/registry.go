@@ -0,0 +1,624 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+var registryRegionGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "peer",
+	Name:      "registry_peers_by_region",
+	Help:      "Number of registered peers, by the region they advertised in DISC_HELLO.",
+}, []string{"region"})
+
+func init() {
+	prometheus.MustRegister(registryRegionGauge)
+}
+
+// PeerRegistryEntry is what this peer knows about a registered peer
+type PeerRegistryEntry struct {
+	Endpoint *pb.PeerEndpoint
+	// AddedAt is the time the peer was added to the registry
+	AddedAt time.Time
+	// LastRTT is the last measured round-trip time to the peer, 0 if never measured
+	LastRTT time.Duration
+	// BandwidthBytesPerSec is the last measured bandwidth to the peer, 0 if never measured
+	BandwidthBytesPerSec float64
+	// Attributes are the attributes the peer sent in its DISC_PEER_METADATA, nil if none
+	Attributes map[string]string
+	// Coordinates is the location the peer sent in its DISC_HELLO, nil if none
+	Coordinates *pb.GeoCoordinates
+	// EncryptionKey is the key the peer sent in its DISC_HELLO to encrypt confidential transactions with, nil if none
+	EncryptionKey *ecdsa.PublicKey
+	// LoadScore is the load the peer sent in its DISC_HELLO, 0 if none
+	LoadScore float32
+	// Region is the region the peer sent in its DISC_HELLO, empty if none
+	Region string
+	// OnionAddress is the Tor hidden service address the peer sent in its DISC_HELLO, empty if none
+	OnionAddress string
+	// Role is the protocol role the peer sent in its DISC_HELLO or last DISC_PEER_METADATA, empty if none
+	Role string
+	// StartedAt is when the peer started, from the uptime it sent in its DISC_HELLO, zero if none
+	StartedAt time.Time
+	// Neighbors are the peers the peer listed in its last DISC_PEERS, nil if none
+	Neighbors []*pb.PeerID
+	// BlockHeight is the height of the chain the peer sent in its DISC_HELLO, 0 if none
+	BlockHeight uint64
+	// Priority is the connection priority the peer sent in its DISC_HELLO, lower values first
+	Priority uint32
+	// TTL is how long the entry is kept without a message from the peer, 0 keeping it for good
+	TTL time.Duration
+	// ExpiresAt is when the entry expires unless touched, zero if TTL is 0
+	ExpiresAt time.Time
+}
+
+// PeerRegistryAccessor interface enables a Peer to hand out its PeerRegistry
+type PeerRegistryAccessor interface {
+	GetPeerRegistry() *PeerRegistry
+}
+
+// defaultChangelogSize is the number of views a PeerRegistry keeps the changes of unless configured
+const defaultChangelogSize = 100
+
+// registryExpiryInterval is how often the expired entries of a PeerRegistry are removed
+const registryExpiryInterval = 5 * time.Second
+
+// registryChange is the change of the registry making view viewID, endpoint
+// added or updated if set, peer id removed otherwise
+type registryChange struct {
+	viewID   uint64
+	id       pb.PeerID
+	endpoint *pb.PeerEndpoint
+}
+
+// fingerprintSize is the size of the fingerprint of the pkiID of a peer
+const fingerprintSize = 8
+
+// PeerFingerprint returns the fingerprint of the pkiID of a peer, the first
+// bytes of its SHA-256, nil without pkiID
+func PeerFingerprint(pkiID []byte) []byte {
+	if len(pkiID) == 0 {
+		return nil
+	}
+	hash := sha256.Sum256(pkiID)
+	return hash[:fingerprintSize]
+}
+
+// registryKey is the key of a registry entry, the fingerprint of the pkiID of
+// the peer or, for peers without pkiID as with security disabled, its ID
+type registryKey struct {
+	fingerprint string
+	id          pb.PeerID
+}
+
+func registryKeyOf(endpoint *pb.PeerEndpoint) registryKey {
+	if fingerprint := PeerFingerprint(endpoint.PkiID); fingerprint != nil {
+		return registryKey{fingerprint: string(fingerprint)}
+	}
+	return registryKey{id: *endpoint.ID}
+}
+
+// PeerRegistry keeps track of the peers this peer has established a Chat with.
+// Every change to the set of registered endpoints makes a new view, the
+// changes of the last views being kept for DISC_GET_PEERS_DIFF requests.
+// Entries are keyed by the fingerprint of the pkiID of the peers, a peer
+// registering again under another ID or address updating its entry.
+type PeerRegistry struct {
+	sync.RWMutex
+	entries       map[registryKey]*PeerRegistryEntry
+	keys          map[pb.PeerID]registryKey
+	viewID        uint64
+	changelog     []registryChange
+	changelogSize int
+	defaultTTL    time.Duration
+}
+
+// NewPeerRegistry returns an empty PeerRegistry
+func NewPeerRegistry() *PeerRegistry {
+	return &PeerRegistry{entries: make(map[registryKey]*PeerRegistryEntry), keys: make(map[pb.PeerID]registryKey), changelogSize: defaultChangelogSize}
+}
+
+// newPeerRegistryFromConfig returns an empty PeerRegistry keeping the changes
+// of the last peer.discovery.diffHistory views, whose entries expire after
+// peer.registry.defaultTTL
+func newPeerRegistryFromConfig() *PeerRegistry {
+	registry := NewPeerRegistry()
+	registry.changelogSize = viper.GetInt("peer.discovery.diffHistory")
+	registry.defaultTTL = viper.GetDuration("peer.registry.defaultTTL")
+	return registry
+}
+
+// Add registers the endpoint, keeping the existing entry if already
+// registered. The entry of a peer of the same pkiID registered under another
+// ID is updated to the endpoint, the other ID being removed from the views,
+// and the entry of another peer registered under the ID is replaced.
+func (r *PeerRegistry) Add(endpoint *pb.PeerEndpoint) {
+	r.Lock()
+	defer r.Unlock()
+	key := registryKeyOf(endpoint)
+	if previous, ok := r.keys[*endpoint.ID]; ok && previous != key {
+		r.remove(previous)
+	}
+	if entry, ok := r.entries[key]; ok {
+		if *entry.Endpoint.ID != *endpoint.ID {
+			peerLogger.Debugf("Registering %s as %s, the same pkiID", entry.Endpoint.ID.Name, endpoint.ID.Name)
+			delete(r.keys, *entry.Endpoint.ID)
+			r.keys[*endpoint.ID] = key
+			r.logChange(registryChange{id: *entry.Endpoint.ID})
+		}
+		if !proto.Equal(entry.Endpoint, endpoint) {
+			r.logChange(registryChange{id: *endpoint.ID, endpoint: endpoint})
+		}
+		entry.Endpoint = endpoint
+		entry.touch(time.Now())
+		return
+	}
+	entry := &PeerRegistryEntry{Endpoint: endpoint, AddedAt: time.Now(), TTL: r.defaultTTL}
+	entry.touch(entry.AddedAt)
+	r.entries[key] = entry
+	r.keys[*endpoint.ID] = key
+	r.logChange(registryChange{id: *endpoint.ID, endpoint: endpoint})
+}
+
+// Remove removes the peer from the registry
+func (r *PeerRegistry) Remove(id *pb.PeerID) {
+	r.Lock()
+	defer r.Unlock()
+	if key, ok := r.keys[*id]; ok {
+		r.remove(key)
+	}
+	r.updateRegionGauge()
+}
+
+// remove removes the entry of key, the registry being locked
+func (r *PeerRegistry) remove(key registryKey) {
+	entry, ok := r.entries[key]
+	if !ok {
+		return
+	}
+	delete(r.entries, key)
+	delete(r.keys, *entry.Endpoint.ID)
+	r.logChange(registryChange{id: *entry.Endpoint.ID})
+}
+
+// entry returns the entry of the peer registered under id, the registry being locked
+func (r *PeerRegistry) entry(id *pb.PeerID) (*PeerRegistryEntry, bool) {
+	key, ok := r.keys[*id]
+	if !ok {
+		return nil, false
+	}
+	entry, ok := r.entries[key]
+	return entry, ok
+}
+
+// logChange makes a new view of the change, dropping the changes of the views
+// past the changelog size
+func (r *PeerRegistry) logChange(change registryChange) {
+	r.viewID++
+	change.viewID = r.viewID
+	r.changelog = append(r.changelog, change)
+	if over := len(r.changelog) - r.changelogSize; over > 0 {
+		r.changelog = r.changelog[over:]
+	}
+}
+
+// ViewID returns the current view of the registry, 0 before any change
+func (r *PeerRegistry) ViewID() uint64 {
+	r.RLock()
+	defer r.RUnlock()
+	return r.viewID
+}
+
+// Diff returns the changes to the registry since view sinceViewID. If the
+// changelog no longer covers them, or sinceViewID is 0 or unknown, the full
+// list of registered endpoints is returned instead, with Full set.
+func (r *PeerRegistry) Diff(sinceViewID uint64) *pb.PeersDiff {
+	r.RLock()
+	defer r.RUnlock()
+	diff := &pb.PeersDiff{ViewID: r.viewID}
+	if sinceViewID == r.viewID && sinceViewID != 0 {
+		return diff
+	}
+	if sinceViewID == 0 || sinceViewID > r.viewID || len(r.changelog) == 0 || r.changelog[0].viewID > sinceViewID+1 {
+		diff.Full = true
+		for _, entry := range r.entries {
+			diff.Added = append(diff.Added, entry.Endpoint)
+		}
+		return diff
+	}
+	// Only the last change of each peer matters
+	last := make(map[pb.PeerID]registryChange)
+	var order []pb.PeerID
+	for _, change := range r.changelog[len(r.changelog)-int(r.viewID-sinceViewID):] {
+		if _, ok := last[change.id]; !ok {
+			order = append(order, change.id)
+		}
+		last[change.id] = change
+	}
+	for _, id := range order {
+		change := last[id]
+		if change.endpoint != nil {
+			diff.Added = append(diff.Added, change.endpoint)
+		} else {
+			removed := change.id
+			diff.Removed = append(diff.Removed, &removed)
+		}
+	}
+	return diff
+}
+
+// Get returns a copy of the entry for the peer
+func (r *PeerRegistry) Get(id *pb.PeerID) (PeerRegistryEntry, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	entry, ok := r.entry(id)
+	if !ok {
+		return PeerRegistryEntry{}, false
+	}
+	return *entry, true
+}
+
+// FindByFingerprint returns a copy of the entry of the peer whose pkiID has
+// the fingerprint fp
+func (r *PeerRegistry) FindByFingerprint(fp []byte) (PeerRegistryEntry, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	if len(fp) == 0 {
+		return PeerRegistryEntry{}, false
+	}
+	entry, ok := r.entries[registryKey{fingerprint: string(fp)}]
+	if !ok {
+		return PeerRegistryEntry{}, false
+	}
+	return *entry, true
+}
+
+// Len returns the number of peers in the registry
+func (r *PeerRegistry) Len() int {
+	r.RLock()
+	defer r.RUnlock()
+	return len(r.entries)
+}
+
+// Entries returns a copy of all the entries in the registry
+func (r *PeerRegistry) Entries() []PeerRegistryEntry {
+	r.RLock()
+	defer r.RUnlock()
+	entries := make([]PeerRegistryEntry, 0, len(r.entries))
+	for _, entry := range r.entries {
+		entries = append(entries, *entry)
+	}
+	return entries
+}
+
+// UpdateBandwidth records a bandwidth measured to the peer at address
+func (r *PeerRegistry) UpdateBandwidth(address string, bytesPerSec float64) {
+	r.Lock()
+	defer r.Unlock()
+	for _, entry := range r.entries {
+		if entry.Endpoint.Address == address {
+			entry.BandwidthBytesPerSec = bytesPerSec
+		}
+	}
+}
+
+// UpdateRTT records a round-trip time measured to the peer
+func (r *PeerRegistry) UpdateRTT(id *pb.PeerID, rtt time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+	if entry, ok := r.entry(id); ok {
+		entry.LastRTT = rtt
+	}
+}
+
+// SetAttributes records the attributes the peer described itself with
+func (r *PeerRegistry) SetAttributes(id *pb.PeerID, attributes map[string]string) {
+	r.Lock()
+	defer r.Unlock()
+	if entry, ok := r.entry(id); ok {
+		entry.Attributes = attributes
+	}
+}
+
+// SetCoordinates records the location of the peer
+func (r *PeerRegistry) SetCoordinates(id *pb.PeerID, coordinates *pb.GeoCoordinates) {
+	r.Lock()
+	defer r.Unlock()
+	if entry, ok := r.entry(id); ok {
+		entry.Coordinates = coordinates
+	}
+}
+
+// SetEncryptionKey records the key confidential transactions for the peer are encrypted with
+func (r *PeerRegistry) SetEncryptionKey(id *pb.PeerID, key *ecdsa.PublicKey) {
+	r.Lock()
+	defer r.Unlock()
+	if entry, ok := r.entry(id); ok {
+		entry.EncryptionKey = key
+	}
+}
+
+// SetLoadScore records the load the peer advertised
+func (r *PeerRegistry) SetLoadScore(id *pb.PeerID, score float32) {
+	r.Lock()
+	defer r.Unlock()
+	if entry, ok := r.entry(id); ok {
+		entry.LoadScore = score
+	}
+}
+
+// SetRegion records the region of the peer
+func (r *PeerRegistry) SetRegion(id *pb.PeerID, region string) {
+	r.Lock()
+	defer r.Unlock()
+	if entry, ok := r.entry(id); ok {
+		entry.Region = region
+		r.updateRegionGauge()
+	}
+}
+
+// SetOnionAddress records the Tor hidden service address the peer advertised
+func (r *PeerRegistry) SetOnionAddress(id *pb.PeerID, address string) {
+	r.Lock()
+	defer r.Unlock()
+	if entry, ok := r.entry(id); ok {
+		entry.OnionAddress = address
+	}
+}
+
+// SetRole records the protocol role the peer advertised, empty for none
+func (r *PeerRegistry) SetRole(id *pb.PeerID, role string) {
+	r.Lock()
+	defer r.Unlock()
+	if entry, ok := r.entry(id); ok {
+		entry.Role = role
+	}
+}
+
+// SetPriority records the connection priority the peer advertised
+func (r *PeerRegistry) SetPriority(id *pb.PeerID, priority uint32) {
+	r.Lock()
+	defer r.Unlock()
+	if entry, ok := r.entry(id); ok {
+		entry.Priority = priority
+	}
+}
+
+// LowestPriority returns the entry of the peer of the highest priority value
+// above priority, the most recently added first among peers of that
+// priority, for a peer of priority to take its place
+func (r *PeerRegistry) LowestPriority(priority uint32) (PeerRegistryEntry, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	var lowest *PeerRegistryEntry
+	for _, entry := range r.entries {
+		if entry.Priority <= priority {
+			continue
+		}
+		if lowest == nil || entry.Priority > lowest.Priority || (entry.Priority == lowest.Priority && entry.AddedAt.After(lowest.AddedAt)) {
+			lowest = entry
+		}
+	}
+	if lowest == nil {
+		return PeerRegistryEntry{}, false
+	}
+	return *lowest, true
+}
+
+// ByRole returns the endpoints of the peers which advertised role
+func (r *PeerRegistry) ByRole(role string) []*pb.PeerEndpoint {
+	r.RLock()
+	defer r.RUnlock()
+	var endpoints []*pb.PeerEndpoint
+	for _, entry := range r.entries {
+		if entry.Role == role {
+			endpoints = append(endpoints, entry.Endpoint)
+		}
+	}
+	return endpoints
+}
+
+// ByAddress returns the entry of the peer at address
+func (r *PeerRegistry) ByAddress(address string) (PeerRegistryEntry, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	for _, entry := range r.entries {
+		if entry.Endpoint.Address == address {
+			return *entry, true
+		}
+	}
+	return PeerRegistryEntry{}, false
+}
+
+// SetUptime records the uptime the peer advertised, 0 for none
+func (r *PeerRegistry) SetUptime(id *pb.PeerID, uptime time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+	if entry, ok := r.entry(id); ok && uptime > 0 {
+		entry.StartedAt = time.Now().Add(-uptime)
+	}
+}
+
+// SetNeighbors records the peers the peer has a Chat with
+func (r *PeerRegistry) SetNeighbors(id *pb.PeerID, neighbors []*pb.PeerID) {
+	r.Lock()
+	defer r.Unlock()
+	if entry, ok := r.entry(id); ok {
+		entry.Neighbors = neighbors
+	}
+}
+
+// SetBlockHeight records the height of the chain of the peer
+func (r *PeerRegistry) SetBlockHeight(id *pb.PeerID, height uint64) {
+	r.Lock()
+	defer r.Unlock()
+	if entry, ok := r.entry(id); ok {
+		entry.BlockHeight = height
+	}
+}
+
+// touch pushes the expiry of the entry back to TTL from now
+func (e *PeerRegistryEntry) touch(now time.Time) {
+	if e.TTL > 0 {
+		e.ExpiresAt = now.Add(e.TTL)
+	} else {
+		e.ExpiresAt = time.Time{}
+	}
+}
+
+// TTLRemaining returns how long the entry is kept from now without a message
+// from the peer, false if it is kept for good
+func (e *PeerRegistryEntry) TTLRemaining(now time.Time) (time.Duration, bool) {
+	if e.ExpiresAt.IsZero() {
+		return 0, false
+	}
+	if remaining := e.ExpiresAt.Sub(now); remaining > 0 {
+		return remaining, true
+	}
+	return 0, true
+}
+
+// Touch resets the TTL of the peer, called whenever a message is received
+// from it. The TTL is peer.registry.defaultTTL unless changed with SetTTL.
+func (r *PeerRegistry) Touch(id *pb.PeerID) {
+	r.Lock()
+	defer r.Unlock()
+	if entry, ok := r.entry(id); ok {
+		entry.touch(time.Now())
+	}
+}
+
+// SetTTL changes the TTL of the peer, the entry then expiring ttl from now
+// unless touched again. A ttl of 0 keeps the entry for good.
+func (r *PeerRegistry) SetTTL(id *pb.PeerID, ttl time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+	if entry, ok := r.entry(id); ok {
+		entry.TTL = ttl
+		entry.touch(time.Now())
+	}
+}
+
+// RemoveExpired removes the peers whose entry expired by now, returning their IDs
+func (r *PeerRegistry) RemoveExpired(now time.Time) []*pb.PeerID {
+	r.Lock()
+	defer r.Unlock()
+	var expired []*pb.PeerID
+	for key, entry := range r.entries {
+		if !entry.ExpiresAt.IsZero() && !now.Before(entry.ExpiresAt) {
+			r.remove(key)
+			expired = append(expired, entry.Endpoint.ID)
+		}
+	}
+	if len(expired) > 0 {
+		r.updateRegionGauge()
+	}
+	return expired
+}
+
+// expireEvery removes the expired entries every interval
+func (r *PeerRegistry) expireEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		for _, id := range r.RemoveExpired(now) {
+			peerLogger.Infof("Removed %s from the registry, no message received within its TTL", id.Name)
+		}
+	}
+}
+
+// PeersWithMinHeight returns the endpoints of the peers whose chain is at
+// least h blocks high, the highest first
+func (r *PeerRegistry) PeersWithMinHeight(h uint64) []*pb.PeerEndpoint {
+	r.RLock()
+	defer r.RUnlock()
+	var entries []PeerRegistryEntry
+	for _, entry := range r.entries {
+		if entry.BlockHeight >= h {
+			entries = append(entries, *entry)
+		}
+	}
+	sort.Sort(entriesByHeight(entries))
+	endpoints := make([]*pb.PeerEndpoint, len(entries))
+	for i, entry := range entries {
+		endpoints[i] = entry.Endpoint
+	}
+	return endpoints
+}
+
+// entriesByHeight sorts registry entries highest chain first, then by peer ID
+type entriesByHeight []PeerRegistryEntry
+
+func (e entriesByHeight) Len() int      { return len(e) }
+func (e entriesByHeight) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e entriesByHeight) Less(i, j int) bool {
+	if e[i].BlockHeight != e[j].BlockHeight {
+		return e[i].BlockHeight > e[j].BlockHeight
+	}
+	return e[i].Endpoint.ID.Name < e[j].Endpoint.ID.Name
+}
+
+// ByRegion returns the endpoints of the peers which advertised a region, by region
+func (r *PeerRegistry) ByRegion() map[string][]*pb.PeerEndpoint {
+	r.RLock()
+	defer r.RUnlock()
+	byRegion := make(map[string][]*pb.PeerEndpoint)
+	for _, entry := range r.entries {
+		if entry.Region != "" {
+			byRegion[entry.Region] = append(byRegion[entry.Region], entry.Endpoint)
+		}
+	}
+	return byRegion
+}
+
+// updateRegionGauge sets the peer_registry_peers_by_region metric, the registry being locked
+func (r *PeerRegistry) updateRegionGauge() {
+	counts := make(map[string]int)
+	for _, entry := range r.entries {
+		if entry.Region != "" {
+			counts[entry.Region]++
+		}
+	}
+	registryRegionGauge.Reset()
+	for region, count := range counts {
+		registryRegionGauge.WithLabelValues(region).Set(float64(count))
+	}
+}
+
+// QueryByAttribute returns the endpoints of the peers whose attribute key has value
+func (r *PeerRegistry) QueryByAttribute(key, value string) []*pb.PeerEndpoint {
+	r.RLock()
+	defer r.RUnlock()
+	var endpoints []*pb.PeerEndpoint
+	for _, entry := range r.entries {
+		if v, ok := entry.Attributes[key]; ok && v == value {
+			endpoints = append(endpoints, entry.Endpoint)
+		}
+	}
+	return endpoints
+}
@@ -0,0 +1,210 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func diffIDs(diff *pb.PeersDiff) string {
+	var added, removed []string
+	for _, peer := range diff.Added {
+		added = append(added, peer.ID.Name)
+	}
+	for _, id := range diff.Removed {
+		removed = append(removed, id.Name)
+	}
+	sort.Strings(added)
+	return fmt.Sprintf("+%v -%v", added, removed)
+}
+
+func TestPeerRegistryDiff(t *testing.T) {
+	registry := NewPeerRegistry()
+	registry.changelogSize = 2
+	for _, name := range []string{"vp1", "vp2"} {
+		registry.Add(&pb.PeerEndpoint{ID: &pb.PeerID{Name: name}, Address: name + ":30303"})
+	}
+	// Adding a registered endpoint again is no change
+	registry.Add(&pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp1"}, Address: "vp1:30303"})
+	if registry.ViewID() != 2 {
+		t.Fatalf("Expected view 2, got %d", registry.ViewID())
+	}
+
+	diff := registry.Diff(1)
+	if diff.Full || diff.ViewID != 2 || diffIDs(diff) != "+[vp2] -[]" {
+		t.Errorf("Unexpected diff since view 1: %v", diff)
+	}
+	registry.Remove(&pb.PeerID{Name: "vp1"})
+	registry.Add(&pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp3"}, Address: "vp3:30303"})
+	diff = registry.Diff(2)
+	if diff.Full || diff.ViewID != 4 || diffIDs(diff) != "+[vp3] -[vp1]" {
+		t.Errorf("Unexpected diff since view 2: %v", diff)
+	}
+	if diff = registry.Diff(4); diff.Full || len(diff.Added) != 0 || len(diff.Removed) != 0 {
+		t.Errorf("Expected an empty diff since the current view, got %v", diff)
+	}
+
+	// The changelog only covers views 3 and 4
+	for _, since := range []uint64{0, 0x7f, 1} {
+		if diff = registry.Diff(since); !diff.Full || diffIDs(diff) != "+[vp2 vp3] -[]" {
+			t.Errorf("Expected the full list since view %d, got %v", since, diff)
+		}
+	}
+}
+
+func TestApplyPeersDiff(t *testing.T) {
+	known := applyPeersDiff(nil, &pb.PeersDiff{Full: true, Added: []*pb.PeerEndpoint{{ID: &pb.PeerID{Name: "vp1"}}, {ID: &pb.PeerID{Name: "vp2"}}}})
+	known = applyPeersDiff(known, &pb.PeersDiff{Added: []*pb.PeerEndpoint{{ID: &pb.PeerID{Name: "vp3"}}}, Removed: []*pb.PeerID{{Name: "vp1"}}})
+	if _, ok := known[pb.PeerID{Name: "vp1"}]; ok || len(known) != 2 {
+		t.Errorf("Expected vp2 and vp3 to be known, got %v", known)
+	}
+	known = applyPeersDiff(known, &pb.PeersDiff{Full: true, Added: []*pb.PeerEndpoint{{ID: &pb.PeerID{Name: "vp4"}}}})
+	if _, ok := known[pb.PeerID{Name: "vp4"}]; !ok || len(known) != 1 {
+		t.Errorf("Expected a full diff to replace the known peers, got %v", known)
+	}
+}
+
+func TestPeersWithMinHeight(t *testing.T) {
+	registry := NewPeerRegistry()
+	for i, height := range []uint64{5, 12, 0, 10} {
+		id := &pb.PeerID{Name: fmt.Sprintf("vp%d", i)}
+		registry.Add(&pb.PeerEndpoint{ID: id})
+		registry.SetBlockHeight(id, height)
+	}
+	var names []string
+	for _, endpoint := range registry.PeersWithMinHeight(10) {
+		names = append(names, endpoint.ID.Name)
+	}
+	if fmt.Sprint(names) != "[vp1 vp3]" {
+		t.Errorf("Expected vp1 then vp3 to be at least 10 blocks high, got %v", names)
+	}
+	if peers := registry.PeersWithMinHeight(13); len(peers) != 0 {
+		t.Errorf("Expected no peer to be 13 blocks high, got %v", peers)
+	}
+	if peers := registry.PeersWithMinHeight(0); len(peers) != 4 {
+		t.Errorf("Expected every peer to be at least 0 blocks high, got %d", len(peers))
+	}
+}
+
+func TestPeerRegistryTTL(t *testing.T) {
+	registry := NewPeerRegistry()
+	registry.defaultTTL = time.Minute
+	vp0, vp1, vp2 := &pb.PeerID{Name: "vp0"}, &pb.PeerID{Name: "vp1"}, &pb.PeerID{Name: "vp2"}
+	for _, id := range []*pb.PeerID{vp0, vp1, vp2} {
+		registry.Add(&pb.PeerEndpoint{ID: id})
+	}
+	registry.SetTTL(vp1, time.Hour)
+	registry.SetTTL(vp2, 0)
+
+	viewID := registry.ViewID()
+	now := time.Now()
+	if expired := registry.RemoveExpired(now); len(expired) != 0 {
+		t.Errorf("Expected no peer to expire yet, got %v", expired)
+	}
+	expired := registry.RemoveExpired(now.Add(2 * time.Minute))
+	if len(expired) != 1 || expired[0].Name != "vp0" {
+		t.Errorf("Expected vp0 to expire after its default TTL, got %v", expired)
+	}
+	if registry.ViewID() != viewID+1 {
+		t.Errorf("Expected the expiry to make a new view")
+	}
+	if expired := registry.RemoveExpired(now.Add(24 * time.Hour)); len(expired) != 1 || expired[0].Name != "vp1" {
+		t.Errorf("Expected vp1 to expire after its TTL and vp2 to be kept for good, got %v", expired)
+	}
+	if _, ok := registry.Get(vp2); !ok {
+		t.Error("Expected vp2 to be kept for good")
+	}
+}
+
+func TestPeerRegistryTouch(t *testing.T) {
+	registry := NewPeerRegistry()
+	registry.defaultTTL = time.Minute
+	id := &pb.PeerID{Name: "vp0"}
+	registry.Add(&pb.PeerEndpoint{ID: id})
+	entry, _ := registry.Get(id)
+	addedExpiry := entry.ExpiresAt
+
+	time.Sleep(10 * time.Millisecond)
+	registry.Touch(id)
+	entry, _ = registry.Get(id)
+	if !entry.ExpiresAt.After(addedExpiry) {
+		t.Errorf("Expected Touch to push the expiry back from %v, got %v", addedExpiry, entry.ExpiresAt)
+	}
+	if remaining, ok := entry.TTLRemaining(time.Now()); !ok || remaining <= 0 || remaining > time.Minute {
+		t.Errorf("Expected up to a minute remaining, got %v, %t", remaining, ok)
+	}
+	if remaining, ok := entry.TTLRemaining(entry.ExpiresAt.Add(time.Second)); !ok || remaining != 0 {
+		t.Errorf("Expected nothing remaining past the expiry, got %v, %t", remaining, ok)
+	}
+	connections := registryConnections(registry, time.Now())
+	if len(connections) != 1 || connections[0].ID != "vp0" || connections[0].TTLRemaining == "" {
+		t.Errorf("Expected vp0 to be served with its remaining TTL, got %v", connections)
+	}
+}
+
+func TestPeerRegistryFingerprint(t *testing.T) {
+	registry := NewPeerRegistry()
+	registry.Add(&pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp1"}, Address: "vp1:30303", PkiID: []byte("identity")})
+	registry.SetRegion(&pb.PeerID{Name: "vp1"}, "eu")
+	registry.Add(&pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp2"}, Address: "vp2:30303"})
+	view := registry.ViewID()
+
+	// The same identity registering under another ID and address updates its entry
+	registry.Add(&pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp1b"}, Address: "10.0.0.1:30303", PkiID: []byte("identity")})
+	if registry.Len() != 2 {
+		t.Fatalf("Expected the identity to be registered once, got %d entries", registry.Len())
+	}
+	entry, ok := registry.FindByFingerprint(PeerFingerprint([]byte("identity")))
+	if !ok || entry.Endpoint.ID.Name != "vp1b" || entry.Endpoint.Address != "10.0.0.1:30303" || entry.Region != "eu" {
+		t.Fatalf("Expected the entry of the identity updated to vp1b, got %v, %t", entry.Endpoint, ok)
+	}
+	if _, ok := registry.Get(&pb.PeerID{Name: "vp1"}); ok {
+		t.Error("Expected the former ID of the identity to be unregistered")
+	}
+	if diff := registry.Diff(view); diffIDs(diff) != "+[vp1b] -[vp1]" {
+		t.Errorf("Expected the former ID to be removed from the views, got %v", diff)
+	}
+	if _, ok := registry.FindByFingerprint(PeerFingerprint([]byte("other"))); ok {
+		t.Error("Expected no entry for an unknown fingerprint")
+	}
+	if _, ok := registry.FindByFingerprint(nil); ok {
+		t.Error("Expected peers without pkiID not to be found by fingerprint")
+	}
+
+	// Another identity registering under a registered ID replaces its entry
+	registry.Add(&pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp2"}, Address: "vp2:30303", PkiID: []byte("vp2")})
+	if entry, ok := registry.Get(&pb.PeerID{Name: "vp2"}); !ok || string(entry.Endpoint.PkiID) != "vp2" || registry.Len() != 2 {
+		t.Errorf("Expected vp2 to be registered under its pkiID, got %v of %d entries", entry.Endpoint, registry.Len())
+	}
+	registry.Remove(&pb.PeerID{Name: "vp1b"})
+	if _, ok := registry.FindByFingerprint(PeerFingerprint([]byte("identity"))); ok || registry.Len() != 1 {
+		t.Errorf("Expected the identity to be removed with its ID, got %d entries", registry.Len())
+	}
+}
+
+func TestApplyPeersDiffFingerprint(t *testing.T) {
+	known := applyPeersDiff(nil, &pb.PeersDiff{Full: true, Added: []*pb.PeerEndpoint{{ID: &pb.PeerID{Name: "vp1"}, PkiID: []byte("identity")}, {ID: &pb.PeerID{Name: "vp2"}}}})
+	known = applyPeersDiff(known, &pb.PeersDiff{Added: []*pb.PeerEndpoint{{ID: &pb.PeerID{Name: "vp1b"}, PkiID: []byte("identity")}, {ID: &pb.PeerID{Name: "vp3"}}}})
+	if _, ok := known[pb.PeerID{Name: "vp1"}]; ok || len(known) != 3 {
+		t.Errorf("Expected vp1b to replace vp1 of the same pkiID, got %v", known)
+	}
+}
@@ -0,0 +1,364 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+
+	"github.com/hyperledger/fabric/core/comm"
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// relayMode is the peer.tx.mode of peers forwarding CHAIN_TRANSACTIONS batches instead of processing them
+const relayMode = "relay"
+
+// ForwardingProcessor forwards CHAIN_TRANSACTIONS batches to upstream peers
+// instead of processing them
+type ForwardingProcessor struct {
+	id      string
+	targets []string
+	send    func(address string, batch *pb.TransactionBlock) error
+	// sendNow sends fast path batches, bypassing any queue of send
+	sendNow func(address string, batch *pb.TransactionBlock) error
+	// sign signs the forwarding records of the relay, none being appended if nil
+	sign func(msg []byte) ([]byte, error)
+}
+
+// NewForwardingProcessor returns a processor of the peer with the given ID forwarding batches to the targets addresses
+func NewForwardingProcessor(id string, targets []string) *ForwardingProcessor {
+	return &ForwardingProcessor{id: id, targets: targets, send: sendTransactionsToPeer, sendNow: sendTransactionsToPeer}
+}
+
+// newForwardingProcessorFromConfig returns a processor forwarding to
+// peer.tx.relayTargets if peer.tx.mode is relay, nil otherwise. Batches to
+// each target go through a MessageQueue of peer.queue.maxDepth.
+func newForwardingProcessorFromConfig() (*ForwardingProcessor, error) {
+	if viper.GetString("peer.tx.mode") != relayMode {
+		return nil, nil
+	}
+	targets := viper.GetStringSlice("peer.tx.relayTargets")
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("peer.tx.mode is %s but no peer.tx.relayTargets are configured", relayMode)
+	}
+	endpoint, err := GetPeerEndpoint()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting the ID of the relay: %s", err)
+	}
+	processor := NewForwardingProcessor(endpoint.ID.Name, targets)
+	processor.send = newMessageQueueFromConfig().Send
+	return processor, nil
+}
+
+// Forward adds the ID of this peer to the hops of the batch, and its signed
+// record to the forwarding chain, and broadcasts it to the targets. A batch
+// this peer already forwarded is rejected.
+func (f *ForwardingProcessor) Forward(batch *pb.TransactionBlock) error {
+	return f.forward(batch, f.send)
+}
+
+// ForwardImmediate is Forward sending the batch to the targets at once,
+// ahead of the batches queued for them
+func (f *ForwardingProcessor) ForwardImmediate(batch *pb.TransactionBlock) error {
+	return f.forward(batch, f.sendNow)
+}
+
+func (f *ForwardingProcessor) forward(batch *pb.TransactionBlock, send func(address string, batch *pb.TransactionBlock) error) error {
+	for _, hop := range batch.Hops {
+		if hop == f.id {
+			return fmt.Errorf("Transactions already forwarded by %s, dropping the batch to break the relay loop", f.id)
+		}
+	}
+	forwarded := &pb.TransactionBlock{
+		Transactions:        batch.Transactions,
+		Hops:                append(append([]string(nil), batch.Hops...), f.id),
+		SchemaVersion:       batch.SchemaVersion,
+		GasLimit:            batch.GasLimit,
+		GasPrice:            batch.GasPrice,
+		Priority:            batch.Priority,
+		Signatures:          batch.Signatures,
+		AggregateSignatures: batch.AggregateSignatures,
+		ForwardingChain:     batch.ForwardingChain,
+	}
+	if f.sign != nil {
+		if err := appendForwardingRecord(forwarded, f.id, f.sign); err != nil {
+			return err
+		}
+	}
+	errs := broadcastTransactions(f.targets, send, forwarded)
+	for _, err := range errs {
+		peerLogger.Errorf("Error forwarding transactions: %s", err)
+	}
+	if len(errs) == len(f.targets) {
+		return fmt.Errorf("Transactions could not be forwarded to any of %v", f.targets)
+	}
+	return nil
+}
+
+// broadcastTransactions sends the batch to every target, returning the errors of the targets that failed
+func broadcastTransactions(targets []string, send func(address string, batch *pb.TransactionBlock) error, batch *pb.TransactionBlock) []error {
+	errs := make(chan error, len(targets))
+	for _, address := range targets {
+		go func(address string) {
+			errs <- send(address, batch)
+		}(address)
+	}
+	var failed []error
+	for range targets {
+		if err := <-errs; err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return failed
+}
+
+// BroadcastTransactions sends the batch as CHAIN_TRANSACTIONS to each of
+// the peers at addresses which advertised targetRole in the registry,
+// returning the errors of the peers that did not accept it. An empty
+// targetRole sends to all of them, the registry then being unused.
+func BroadcastTransactions(addresses []string, batch *pb.TransactionBlock, targetRole string, registry *PeerRegistry) []error {
+	if targetRole != "" {
+		addresses = withRole(registry, addresses, targetRole)
+	}
+	return broadcastTransactions(addresses, sendTransactionsToPeer, batch)
+}
+
+// ProgressCallback is told of the CHAIN_TRANSACTIONS_PROGRESS of a batch sent to a peer
+type ProgressCallback func(processed, total int)
+
+// sendTransactionsToPeer sends the batch to the peer at address as CHAIN_TRANSACTIONS
+func sendTransactionsToPeer(address string, batch *pb.TransactionBlock) error {
+	_, err := sendTransactions(DefaultPeerConnectionPool(), address, batch, nil)
+	return err
+}
+
+// SendTransactionsToPeer sends the batch to the peer at address as
+// CHAIN_TRANSACTIONS and waits for its reply, returning the transactions it
+// committed and those it refused or failed to commit. progress, if not nil,
+// is called for every CHAIN_TRANSACTIONS_PROGRESS received in the meantime. A
+// *TransactionsNotAcknowledgedError is returned if the peer sends nothing for
+// peer.tx.ackTimeout, or has not answered within peer.chat.requestTimeout
+// however much progress it reports, and an error if it refuses the batch. A
+// batch without a schema version is sent as TransactionSchemaVersion, and
+// sent again as the newest version an older peer supports if it refuses it.
+// Once a batch of several transactions is accepted, the receipts of the
+// committed transactions are waited for up to peer.tx.batchReceiptTimeout
+// and set as the Receipt of the result. If peer.tx.autoSplit is set, a batch
+// larger than peer.grpc.maxMessageSize is sent in parts, as described by the
+// Split of the result. The connection to the peer is one of
+// DefaultPeerConnectionPool.
+func SendTransactionsToPeer(address string, batch *pb.TransactionBlock, progress ProgressCallback) (*BatchResult, error) {
+	return SendTransactionsToPeerWithPool(DefaultPeerConnectionPool(), address, batch, progress)
+}
+
+// SendTransactionsToPeerWithPool is SendTransactionsToPeer over a connection
+// of pool, nil dialing a connection for the batch alone
+func SendTransactionsToPeerWithPool(pool *PeerConnectionPool, address string, batch *pb.TransactionBlock, progress ProgressCallback) (*BatchResult, error) {
+	var result *BatchResult
+	var err error
+	if parts := splitTransactionBatch(batch, autoSplitLimit()); len(parts) > 1 {
+		result, err = sendSplitTransactions(pool, address, parts, progress)
+	} else {
+		result, err = sendTransactions(pool, address, batch, progress)
+	}
+	timeout := batchReceiptTimeout()
+	if err != nil || len(batch.Transactions) <= 1 || timeout == 0 {
+		return result, err
+	}
+	result.Receipt = collectReceipts(pool, address, result.Committed, NewBatchReceiptAggregator(len(result.Committed), timeout))
+	for _, failure := range result.Failed {
+		result.Receipt.Missing = append(result.Receipt.Missing, failure.TxID)
+	}
+	return result, nil
+}
+
+// sendTransactions sends the batch as TransactionSchemaVersion if it has no
+// schema version, falling back to an older version the peer supports, and
+// returns the outcome of the batch
+func sendTransactions(pool *PeerConnectionPool, address string, batch *pb.TransactionBlock, progress ProgressCallback) (*BatchResult, error) {
+	if batch.SchemaVersion == 0 {
+		versioned := *batch
+		versioned.SchemaVersion = TransactionSchemaVersion
+		batch = &versioned
+	}
+	result, err := sendTransactionsVersion(pool, address, batch, progress)
+	if versionErr, ok := err.(*SchemaVersionError); ok && versionErr.SupportedMax < batch.SchemaVersion && versionErr.SupportedMin <= versionErr.SupportedMax {
+		peerLogger.Infof("%s, sending the transactions as version %d", versionErr, versionErr.SupportedMax)
+		older := *batch
+		older.SchemaVersion = versionErr.SupportedMax
+		return sendTransactionsVersion(pool, address, &older, progress)
+	}
+	return result, err
+}
+
+// sendTransactionsVersion sends the batch as is, returning a
+// *SchemaVersionError if the peer refuses its schema version, and the
+// outcome of the batch otherwise
+func sendTransactionsVersion(pool *PeerConnectionPool, address string, batch *pb.TransactionBlock, progress ProgressCallback) (result *BatchResult, err error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err = withPooledRequestStreamContext(ctx, pool, address, func(stream ChatStream) error {
+		result, err = sendTransactionsOverStream(stream, batch, progress, transactionsAckTimeout(), viper.GetDuration("peer.chat.requestTimeout"))
+		return err
+	})
+	if ackErr, ok := err.(*TransactionsNotAcknowledgedError); ok {
+		ackErr.Address = address
+		return nil, ackErr
+	} else if _, ok := err.(*SchemaVersionError); ok {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("Error sending transactions to %s: %s", address, err)
+	}
+	return result, nil
+}
+
+// transactionsAckTimeout returns peer.tx.ackTimeout, comm.DefaultTimeout if
+// it is not set
+func transactionsAckTimeout() time.Duration {
+	if timeout := viper.GetDuration("peer.tx.ackTimeout"); timeout > 0 {
+		return timeout
+	}
+	return comm.DefaultTimeout
+}
+
+// sendTransactionsOverStream sends the batch over stream and waits for the
+// reply accepting or refusing it, returning a
+// *TransactionsNotAcknowledgedError if no message is received for timeout.
+// Every message received, CHAIN_TRANSACTIONS_PROGRESS among them, restarts
+// the timeout, for large batches still being processed not to time out, but
+// the reply is not waited for longer than maxWait in all, if positive.
+func sendTransactionsOverStream(stream ChatStream, batch *pb.TransactionBlock, progress ProgressCallback, timeout, maxWait time.Duration) (*BatchResult, error) {
+	data, err := proto.Marshal(batch)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling TransactionBlock: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS, Payload: data, Timestamp: util.CreateUtcTimestamp()}
+	if err := stream.Send(request); err != nil {
+		return nil, fmt.Errorf("Error sending %s: %s", request.Type, err)
+	}
+	type received struct {
+		msg *pb.Message
+		err error
+	}
+	// Received by a single goroutine for Recv to be given up on after a
+	// timeout, the stream being closed by the caller. The goroutine only
+	// receives the next message when asked to, for none to be taken from the
+	// stream once the reply is in.
+	next := make(chan struct{}, 1)
+	recvChan := make(chan received)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-next:
+			case <-done:
+				return
+			}
+			msg, err := stream.Recv()
+			select {
+			case recvChan <- received{msg, err}:
+			case <-done:
+				return
+			}
+		}
+	}()
+	var deadline <-chan time.Time
+	if maxWait > 0 {
+		deadlineTimer := time.NewTimer(maxWait)
+		defer deadlineTimer.Stop()
+		deadline = deadlineTimer.C
+	}
+	idleTimer := time.NewTimer(timeout)
+	defer idleTimer.Stop()
+	for {
+		next <- struct{}{}
+		var msg *pb.Message
+		select {
+		case r := <-recvChan:
+			if r.err != nil {
+				return nil, fmt.Errorf("Error waiting for the reply to %s: %s", request.Type, r.err)
+			}
+			msg = r.msg
+		case <-idleTimer.C:
+			return nil, &TransactionsNotAcknowledgedError{Timeout: timeout}
+		case <-deadline:
+			return nil, &TransactionsNotAcknowledgedError{Timeout: maxWait}
+		}
+		if !idleTimer.Stop() {
+			<-idleTimer.C
+		}
+		idleTimer.Reset(timeout)
+		switch msg.Type {
+		case pb.Message_RESPONSE:
+			response := &pb.Response{}
+			if err := proto.Unmarshal(msg.Payload, response); err != nil {
+				return nil, fmt.Errorf("Error unmarshalling Response: %s", err)
+			}
+			if response.Status == pb.Response_FAILURE {
+				return nil, fmt.Errorf("Transactions refused: %s", response.Msg)
+			}
+			return newBatchResult(batch, nil), nil
+		case pb.Message_CHAIN_TRANSACTIONS_PARTIAL_ACK:
+			ack := &pb.TransactionsPartialAck{}
+			if err := proto.Unmarshal(msg.Payload, ack); err != nil {
+				return nil, fmt.Errorf("Error unmarshalling TransactionsPartialAck: %s", err)
+			}
+			peerLogger.Warningf("%d of %d transactions not committed", len(ack.Failed), len(batch.Transactions))
+			return &BatchResult{Committed: ack.Committed, Failed: ack.Failed}, nil
+		case pb.Message_CHAIN_TRANSACTIONS_VALIDATION_ERROR:
+			validationError := &pb.TransactionsValidationError{}
+			if err := proto.Unmarshal(msg.Payload, validationError); err != nil {
+				return nil, fmt.Errorf("Error unmarshalling TransactionsValidationError: %s", err)
+			}
+			if validationError.Rejected {
+				return nil, fmt.Errorf("Transactions rejected with %d violations", len(validationError.Violations))
+			}
+			failed := violationFailures(validationError.Violations)
+			peerLogger.Warningf("%d invalid transactions refused", len(failed))
+			return newBatchResult(batch, failed), nil
+		case pb.Message_CHAIN_TRANSACTIONS_VERSION_ERROR:
+			versionError := &pb.TransactionsVersionError{}
+			if err := proto.Unmarshal(msg.Payload, versionError); err != nil {
+				return nil, fmt.Errorf("Error unmarshalling TransactionsVersionError: %s", err)
+			}
+			return nil, &SchemaVersionError{Version: batch.SchemaVersion, SupportedMin: versionError.SupportedMin, SupportedMax: versionError.SupportedMax}
+		case pb.Message_CHAIN_TRANSACTIONS_ERROR:
+			transactionsError := &pb.TransactionsError{}
+			if err := proto.Unmarshal(msg.Payload, transactionsError); err != nil {
+				return nil, fmt.Errorf("Error unmarshalling TransactionsError: %s", err)
+			}
+			return nil, fmt.Errorf("%d transactions dropped: %s", len(transactionsError.TxIDs), transactionsError.Reason)
+		case pb.Message_CHAIN_TRANSACTIONS_PROGRESS:
+			if progress == nil {
+				continue
+			}
+			transactionsProgress := &pb.TransactionsProgress{}
+			if err := proto.Unmarshal(msg.Payload, transactionsProgress); err != nil {
+				return nil, fmt.Errorf("Error unmarshalling TransactionsProgress: %s", err)
+			}
+			progress(int(transactionsProgress.Processed), int(transactionsProgress.Total))
+			continue
+		}
+		peerLogger.Debugf("Ignoring %s while waiting for the reply to %s", msg.Type, request.Type)
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/core/comm"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestForwardingProcessor(t *testing.T) {
+	var lock sync.Mutex
+	forwarded := make(map[string]*pb.TransactionBlock)
+	relay := NewForwardingProcessor("relay1", []string{"up1:30303", "up2:30303"})
+	relay.send = func(address string, batch *pb.TransactionBlock) error {
+		lock.Lock()
+		defer lock.Unlock()
+		forwarded[address] = batch
+		if address == "up2:30303" {
+			return fmt.Errorf("unreachable")
+		}
+		return nil
+	}
+
+	batch := &pb.TransactionBlock{Transactions: []*pb.Transaction{{Uuid: "tx1"}}, Hops: []string{"relay0"}, GasLimit: 1000, GasPrice: 10}
+	if err := relay.Forward(batch); err != nil {
+		t.Fatalf("Expected forwarding to succeed with one reachable target, got %s", err)
+	}
+	if len(forwarded) != 2 {
+		t.Fatalf("Expected the batch to be sent to both targets, got %d", len(forwarded))
+	}
+	if hops := forwarded["up1:30303"].Hops; len(hops) != 2 || hops[0] != "relay0" || hops[1] != "relay1" {
+		t.Errorf("Expected the relay to be appended to the hops, got %v", hops)
+	}
+	if sent := forwarded["up1:30303"]; sent.GasLimit != 1000 || sent.GasPrice != 10 {
+		t.Errorf("Expected the gas of the batch to be forwarded, got %d at %d", sent.GasLimit, sent.GasPrice)
+	}
+	if len(batch.Hops) != 1 {
+		t.Errorf("Expected the received batch to be left unchanged, got hops %v", batch.Hops)
+	}
+
+	// The batch comes back through relay1
+	looped := forwarded["up1:30303"]
+	forwarded = make(map[string]*pb.TransactionBlock)
+	if err := relay.Forward(looped); err == nil {
+		t.Error("Expected a batch already forwarded by the relay to be rejected")
+	}
+	if len(forwarded) != 0 {
+		t.Errorf("Expected a looping batch not to be forwarded, got %d", len(forwarded))
+	}
+
+	relay.send = func(address string, batch *pb.TransactionBlock) error {
+		return fmt.Errorf("unreachable")
+	}
+	if err := relay.Forward(batch); err == nil {
+		t.Error("Expected an error when no target accepts the batch")
+	}
+}
+
+func TestForwardImmediate(t *testing.T) {
+	relay := NewForwardingProcessor("relay1", []string{"up1:30303"})
+	relay.send = func(address string, batch *pb.TransactionBlock) error {
+		t.Error("Expected a fast path batch not to go through the queue")
+		return nil
+	}
+	var sent *pb.TransactionBlock
+	relay.sendNow = func(address string, batch *pb.TransactionBlock) error {
+		sent = batch
+		return nil
+	}
+	if err := relay.ForwardImmediate(&pb.TransactionBlock{Transactions: []*pb.Transaction{{Uuid: "tx1"}}, Priority: 9}); err != nil {
+		t.Fatalf("Expected the batch to be forwarded, got %s", err)
+	}
+	if sent == nil || sent.Priority != 9 {
+		t.Errorf("Expected the batch to be sent at once with its priority, got %v", sent)
+	}
+}
+
+func TestSendTransactionsOverStreamAck(t *testing.T) {
+	batch := newTestTransactionBatch(2)
+	stream := &handshakeStream{recv: make(chan *pb.Message, 1), sent: make(chan *pb.Message, 1)}
+	defer close(stream.recv)
+	go replyToBatch(stream, pb.Message_RESPONSE, &pb.Response{Status: pb.Response_SUCCESS})
+	if result, err := sendTransactionsOverStream(stream, batch, nil, time.Second, 0); err != nil || len(result.Committed) != 2 {
+		t.Fatalf("Expected the acknowledged batch to be committed, got %v, %v", result, err)
+	}
+	go replyToBatch(stream, pb.Message_RESPONSE, &pb.Response{Status: pb.Response_FAILURE, Msg: []byte("mempool full")})
+	if result, err := sendTransactionsOverStream(stream, batch, nil, time.Second, 0); err == nil || err.Error() != "Transactions refused: mempool full" {
+		t.Fatalf("Expected the refused batch to fail, got %v, %v", result, err)
+	}
+}
+
+func TestSendTransactionsOverStreamAckTimeout(t *testing.T) {
+	batch := newTestTransactionBatch(2)
+	stream := &handshakeStream{recv: make(chan *pb.Message, 1), sent: make(chan *pb.Message, 1)}
+	defer close(stream.recv)
+	_, err := sendTransactionsOverStream(stream, batch, nil, 20*time.Millisecond, 0)
+	if ackErr, ok := err.(*TransactionsNotAcknowledgedError); !ok || ackErr.Timeout != 20*time.Millisecond {
+		t.Fatalf("Expected a TransactionsNotAcknowledgedError, got %v", err)
+	}
+
+	// Progress received in the meantime restarts the timeout
+	stream = &handshakeStream{recv: make(chan *pb.Message, 1), sent: make(chan *pb.Message, 1)}
+	defer close(stream.recv)
+	go func() {
+		<-stream.sent
+		for i := 1; i <= 3; i++ {
+			time.Sleep(20 * time.Millisecond)
+			data, _ := proto.Marshal(&pb.TransactionsProgress{Processed: uint32(i), Total: 3})
+			stream.recv <- &pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS_PROGRESS, Payload: data}
+		}
+		data, _ := proto.Marshal(&pb.Response{Status: pb.Response_SUCCESS})
+		stream.recv <- &pb.Message{Type: pb.Message_RESPONSE, Payload: data}
+	}()
+	if result, err := sendTransactionsOverStream(stream, batch, nil, 50*time.Millisecond, time.Second); err != nil || len(result.Committed) != 2 {
+		t.Fatalf("Expected the batch reporting progress not to time out, got %v, %v", result, err)
+	}
+
+	// but not past maxWait
+	stream = &handshakeStream{recv: make(chan *pb.Message, 1), sent: make(chan *pb.Message, 1)}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		<-stream.sent
+		defer close(stream.recv)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			data, _ := proto.Marshal(&pb.TransactionsProgress{Processed: 1, Total: 3})
+			select {
+			case stream.recv <- &pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS_PROGRESS, Payload: data}:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	_, err = sendTransactionsOverStream(stream, batch, nil, 50*time.Millisecond, 100*time.Millisecond)
+	if ackErr, ok := err.(*TransactionsNotAcknowledgedError); !ok || ackErr.Timeout != 100*time.Millisecond {
+		t.Fatalf("Expected a TransactionsNotAcknowledgedError after maxWait, got %v", err)
+	}
+}
+
+func TestTransactionsAckTimeout(t *testing.T) {
+	defer viper.Set("peer.tx.ackTimeout", viper.GetDuration("peer.tx.ackTimeout"))
+	viper.Set("peer.tx.ackTimeout", 0)
+	if timeout := transactionsAckTimeout(); timeout != comm.DefaultTimeout {
+		t.Errorf("Expected the ack timeout to default to %s, got %s", comm.DefaultTimeout, timeout)
+	}
+	viper.Set("peer.tx.ackTimeout", "50ms")
+	if timeout := transactionsAckTimeout(); timeout != 50*time.Millisecond {
+		t.Errorf("Expected the configured ack timeout, got %s", timeout)
+	}
+}
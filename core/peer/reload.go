@@ -0,0 +1,236 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ReloadableConfig holds the settings applied again when the configuration
+// file is reloaded. The global viper configuration is read without locking
+// all over the peer, so a reload reads the file into a viper instance of its
+// own and publishes the settings in a new ReloadableConfig instead.
+type ReloadableConfig struct {
+	MaxGetPeersPerSecond  float64       // peer.discovery.maxRequestsPerSecond
+	TouchPeriod           time.Duration // peer.discovery.touchPeriod
+	TouchMaxNodes         int           // peer.discovery.touchMaxNodes
+	MaxTPS                float64       // peer.tx.maxTPS
+	BurstSize             int           // peer.tx.burstSize
+	SchemaFile            string        // peer.tx.schemaFile
+	RejectAllOnError      bool          // peer.tx.rejectAllOnError
+	MaxClockSkew          time.Duration // peer.tx.maxClockSkew
+	ClockSource           string        // peer.tx.clockSource
+	RejectOnTimestampSkew bool          // peer.tx.rejectOnTimestampSkew
+	HighWatermark         int           // peer.chat.highWatermark
+	LowWatermark          int           // peer.chat.lowWatermark
+	LoggingSpec           string        // logging_level, or logging.node if not set
+}
+
+// configReader is the part of viper the reloadable settings are read from
+type configReader interface {
+	GetBool(key string) bool
+	GetDuration(key string) time.Duration
+	GetFloat64(key string) float64
+	GetInt(key string) int
+	GetString(key string) string
+}
+
+// globalConfig reads the global viper configuration
+type globalConfig struct{}
+
+func (globalConfig) GetBool(key string) bool              { return viper.GetBool(key) }
+func (globalConfig) GetDuration(key string) time.Duration { return viper.GetDuration(key) }
+func (globalConfig) GetFloat64(key string) float64        { return viper.GetFloat64(key) }
+func (globalConfig) GetInt(key string) int                { return viper.GetInt(key) }
+func (globalConfig) GetString(key string) string          { return viper.GetString(key) }
+
+// readReloadableConfig reads the reloadable settings from config. logging_level
+// is taken from the global configuration, where the --logging-level flag is
+// bound, so that the flag keeps overriding logging.node across reloads.
+func readReloadableConfig(config configReader) *ReloadableConfig {
+	loggingSpec := viper.GetString("logging_level")
+	if loggingSpec == "" {
+		loggingSpec = config.GetString("logging.node")
+	}
+	return &ReloadableConfig{
+		MaxGetPeersPerSecond:  config.GetFloat64("peer.discovery.maxRequestsPerSecond"),
+		TouchPeriod:           config.GetDuration("peer.discovery.touchPeriod"),
+		TouchMaxNodes:         config.GetInt("peer.discovery.touchMaxNodes"),
+		MaxTPS:                config.GetFloat64("peer.tx.maxTPS"),
+		BurstSize:             config.GetInt("peer.tx.burstSize"),
+		SchemaFile:            config.GetString("peer.tx.schemaFile"),
+		RejectAllOnError:      config.GetBool("peer.tx.rejectAllOnError"),
+		MaxClockSkew:          config.GetDuration("peer.tx.maxClockSkew"),
+		ClockSource:           config.GetString("peer.tx.clockSource"),
+		RejectOnTimestampSkew: config.GetBool("peer.tx.rejectOnTimestampSkew"),
+		HighWatermark:         config.GetInt("peer.chat.highWatermark"),
+		LowWatermark:          config.GetInt("peer.chat.lowWatermark"),
+		LoggingSpec:           loggingSpec,
+	}
+}
+
+var reloadedConfig atomic.Value
+
+// currentReloadableConfig returns the settings of the last reload, those of
+// the global configuration before the first one
+func currentReloadableConfig() *ReloadableConfig {
+	if config, ok := reloadedConfig.Load().(*ReloadableConfig); ok {
+		return config
+	}
+	return readReloadableConfig(globalConfig{})
+}
+
+// ConfigChangeHook is notified once the configuration has been reloaded
+type ConfigChangeHook interface {
+	ApplyConfigChange(config *ReloadableConfig)
+}
+
+// ConfigChangeHookFunc adapts a function to a ConfigChangeHook
+type ConfigChangeHookFunc func(config *ReloadableConfig)
+
+// ApplyConfigChange implements ConfigChangeHook
+func (f ConfigChangeHookFunc) ApplyConfigChange(config *ReloadableConfig) {
+	f(config)
+}
+
+// SignalHandler re-reads the configuration file on SIGHUP and applies it
+// through the registered hooks
+type SignalHandler struct {
+	sync.Mutex
+	hooks    []ConfigChangeHook
+	signals  chan os.Signal
+	snapshot map[string]string
+}
+
+// NewSignalHandler returns a handler applying reloaded configuration through hooks, in order
+func NewSignalHandler(hooks ...ConfigChangeHook) *SignalHandler {
+	snapshot := make(map[string]string)
+	if config, err := readConfigFile(); err == nil {
+		snapshot = configSnapshot(config)
+	}
+	return &SignalHandler{hooks: hooks, signals: make(chan os.Signal, 1), snapshot: snapshot}
+}
+
+// Start listens for SIGHUP until Stop is called
+func (h *SignalHandler) Start() {
+	signal.Notify(h.signals, syscall.SIGHUP)
+	go func() {
+		for range h.signals {
+			if err := h.Reload(); err != nil {
+				peerLogger.Errorf("Error reloading configuration: %s", err)
+			}
+		}
+	}()
+}
+
+// Stop stops listening for SIGHUP
+func (h *SignalHandler) Stop() {
+	signal.Stop(h.signals)
+	close(h.signals)
+}
+
+// Reload re-reads the configuration file, logs the keys whose value changed,
+// publishes the ReloadableConfig read and runs the hooks with it. The global
+// configuration is left as read at startup; settings other than those of
+// ReloadableConfig take effect on restart.
+func (h *SignalHandler) Reload() error {
+	h.Lock()
+	defer h.Unlock()
+	reloaded, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+	snapshot := configSnapshot(reloaded)
+	if changes := configChanges(h.snapshot, snapshot); len(changes) == 0 {
+		peerLogger.Info("Reloaded configuration, no keys changed")
+	} else {
+		peerLogger.Infof("Reloaded configuration, changed keys: %s", strings.Join(changes, ", "))
+	}
+	h.snapshot = snapshot
+	config := readReloadableConfig(reloaded)
+	reloadedConfig.Store(config)
+	for _, hook := range h.hooks {
+		hook.ApplyConfigChange(config)
+	}
+	return nil
+}
+
+// readConfigFile reads the configuration file the peer was started with into
+// a viper instance of its own, with the same environment overrides
+func readConfigFile() (*viper.Viper, error) {
+	config := viper.New()
+	config.SetConfigFile(viper.ConfigFileUsed())
+	config.SetEnvPrefix("core")
+	config.AutomaticEnv()
+	config.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	if err := config.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("Error reading config file: %s", err)
+	}
+	return config, nil
+}
+
+// configSnapshot returns config flattened to dotted keys
+func configSnapshot(config *viper.Viper) map[string]string {
+	snapshot := make(map[string]string)
+	for _, key := range config.AllKeys() {
+		flattenConfig(snapshot, key, config.Get(key))
+	}
+	return snapshot
+}
+
+func flattenConfig(snapshot map[string]string, key string, value interface{}) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for k, v := range value {
+			flattenConfig(snapshot, key+"."+strings.ToLower(k), v)
+		}
+	case map[interface{}]interface{}:
+		for k, v := range value {
+			flattenConfig(snapshot, key+"."+strings.ToLower(fmt.Sprint(k)), v)
+		}
+	default:
+		snapshot[key] = fmt.Sprint(value)
+	}
+}
+
+// configChanges returns the keys whose value differs, sorted. Values are left
+// out, as some of them are secrets.
+func configChanges(before, after map[string]string) []string {
+	var changes []string
+	for key, value := range after {
+		if old, ok := before[key]; !ok || old != value {
+			changes = append(changes, key)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			changes = append(changes, key)
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
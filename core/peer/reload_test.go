@@ -0,0 +1,62 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfigChanges(t *testing.T) {
+	before := make(map[string]string)
+	flattenConfig(before, "peer", map[interface{}]interface{}{
+		"chat":      map[interface{}]interface{}{"highWatermark": 10, "lowWatermark": 5},
+		"discovery": map[interface{}]interface{}{"touchMaxNodes": 100},
+	})
+	after := make(map[string]string)
+	flattenConfig(after, "peer", map[interface{}]interface{}{
+		"chat":   map[interface{}]interface{}{"highWatermark": 20, "lowWatermark": 5},
+		"gossip": map[interface{}]interface{}{"enabled": true},
+	})
+
+	expected := []string{
+		"peer.chat.highwatermark",
+		"peer.discovery.touchmaxnodes",
+		"peer.gossip.enabled",
+	}
+	if changes := configChanges(before, after); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected %q, got %q", expected, changes)
+	}
+}
+
+func TestSignalHandlerReloadRunsHooks(t *testing.T) {
+	var applied []int
+	var reloaded *ReloadableConfig
+	handler := NewSignalHandler(
+		ConfigChangeHookFunc(func(config *ReloadableConfig) { reloaded = config; applied = append(applied, 1) }),
+		ConfigChangeHookFunc(func(*ReloadableConfig) { applied = append(applied, 2) }),
+	)
+	if err := handler.Reload(); err != nil {
+		t.Fatalf("Error reloading configuration: %s", err)
+	}
+	if !reflect.DeepEqual(applied, []int{1, 2}) {
+		t.Errorf("Expected both hooks to run in order, got %v", applied)
+	}
+	if reloaded == nil || reloaded != currentReloadableConfig() {
+		t.Errorf("Expected the hooks to be given the published configuration")
+	}
+}
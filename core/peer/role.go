@@ -0,0 +1,70 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// getRole returns the protocol role of this peer, peer.role, empty if none
+func getRole() string {
+	return viper.GetString("peer.role")
+}
+
+// newPeerMetadata returns the DISC_PEER_METADATA payload describing this
+// peer, the attributes configured under peer.metadata and its role
+func newPeerMetadata() *pb.PeerMetadata {
+	return &pb.PeerMetadata{Attributes: viper.GetStringMapString("peer.metadata"), Role: getRole()}
+}
+
+func newPeerMetadataMessage(metadata *pb.PeerMetadata) (*pb.Message, error) {
+	data, err := proto.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling PeerMetadata: %s", err)
+	}
+	return &pb.Message{Type: pb.Message_DISC_PEER_METADATA, Payload: data, Timestamp: util.CreateUtcTimestamp()}, nil
+}
+
+// withRole returns the addresses of the peers of the registry which advertised role
+func withRole(registry *PeerRegistry, addresses []string, role string) []string {
+	var matching []string
+	for _, address := range addresses {
+		if entry, ok := registry.ByAddress(address); ok && entry.Role == role {
+			matching = append(matching, address)
+		}
+	}
+	return matching
+}
+
+// SetRole changes the protocol role of this peer, kept in peer.role, and
+// sends a DISC_PEER_METADATA with the new role to the connected peers. The
+// errors of the peers it could not be sent to are returned.
+func (p *PeerImpl) SetRole(role string) []error {
+	viper.Set("peer.role", role)
+	msg, err := newPeerMetadataMessage(newPeerMetadata())
+	if err != nil {
+		return []error{err}
+	}
+	peerLogger.Infof("Role changed to %q, sending %s to the connected peers", role, pb.Message_DISC_PEER_METADATA)
+	return p.Broadcast(msg, pb.PeerEndpoint_UNDEFINED)
+}
@@ -0,0 +1,81 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func newRoleRegistry() *PeerRegistry {
+	registry := NewPeerRegistry()
+	for name, role := range map[string]string{"vp1": "validator", "vp2": "orderer", "vp3": "validator", "vp4": ""} {
+		id := &pb.PeerID{Name: name}
+		registry.Add(&pb.PeerEndpoint{ID: id, Address: name + ":30303"})
+		registry.SetRole(id, role)
+	}
+	return registry
+}
+
+func TestRegistryByRole(t *testing.T) {
+	registry := newRoleRegistry()
+	if validators := registry.ByRole("validator"); len(validators) != 2 {
+		t.Fatalf("Expected 2 validators, got %v", validators)
+	}
+	registry.SetRole(&pb.PeerID{Name: "vp1"}, "observer")
+	if observers := registry.ByRole("observer"); len(observers) != 1 || observers[0].ID.Name != "vp1" {
+		t.Fatalf("Expected vp1 to have become an observer, got %v", observers)
+	}
+	if orderers := registry.ByRole("orderer"); len(orderers) != 1 {
+		t.Fatalf("Expected 1 orderer, got %v", orderers)
+	}
+}
+
+func TestWithRole(t *testing.T) {
+	registry := newRoleRegistry()
+	addresses := withRole(registry, []string{"vp1:30303", "vp2:30303", "vp3:30303", "vp5:30303"}, "validator")
+	if fmt.Sprint(addresses) != "[vp1:30303 vp3:30303]" {
+		t.Fatalf("Expected the validators only, got %v", addresses)
+	}
+}
+
+func TestBroadcastTransactionsNoPeerOfRole(t *testing.T) {
+	if errs := BroadcastTransactions([]string{"vp1:30303", "vp3:30303"}, &pb.TransactionBlock{}, "orderer", newRoleRegistry()); len(errs) != 0 {
+		t.Fatalf("Expected nothing to be sent without a peer of the role, got %v", errs)
+	}
+}
+
+func TestPeerMetadataRole(t *testing.T) {
+	defer viper.Set("peer.role", viper.GetString("peer.role"))
+	viper.Set("peer.role", "orderer")
+	msg, err := newPeerMetadataMessage(newPeerMetadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := &pb.PeerMetadata{}
+	if err := proto.Unmarshal(msg.Payload, metadata); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != pb.Message_DISC_PEER_METADATA || metadata.Role != "orderer" {
+		t.Fatalf("Expected a %s with the orderer role, got a %s with %q", pb.Message_DISC_PEER_METADATA, msg.Type, metadata.Role)
+	}
+}
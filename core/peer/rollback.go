@@ -0,0 +1,180 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// rollbackRequestLifetime is how long a signed rollback request is accepted for
+const rollbackRequestLifetime = 5 * time.Minute
+
+// rollbackNonces holds the nonces of the rollback requests accepted, until
+// the requests expire, for each request to be accepted once
+type rollbackNonces struct {
+	sync.Mutex
+	expiry map[string]time.Time
+}
+
+var acceptedRollbackNonces = &rollbackNonces{expiry: make(map[string]time.Time)}
+
+// use records the nonce of a request expiring at expiresAt, returning an
+// error if it was already used
+func (n *rollbackNonces) use(nonce []byte, expiresAt, now time.Time) error {
+	n.Lock()
+	defer n.Unlock()
+	for used, expiry := range n.expiry {
+		if !now.Before(expiry) {
+			delete(n.expiry, used)
+		}
+	}
+	if _, ok := n.expiry[string(nonce)]; ok {
+		return fmt.Errorf("Rollback request already used")
+	}
+	n.expiry[string(nonce)] = expiresAt
+	return nil
+}
+
+// LedgerRollbacker reverts committed transactions, for ledgers supporting it
+type LedgerRollbacker interface {
+	RollbackTransaction(txID string) error
+}
+
+// rollbackSigningBytes returns the bytes the admin signature of a rollback request is computed over
+func rollbackSigningBytes(request *pb.RollbackRequest) ([]byte, error) {
+	unsigned := *request
+	unsigned.AdminSignature = nil
+	return proto.Marshal(&unsigned)
+}
+
+func rollbackSignature(request *pb.RollbackRequest, secret string) ([]byte, error) {
+	data, err := rollbackSigningBytes(request)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling RollbackRequest: %s", err)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+// SignRollbackRequest sets the admin signature of the request, the
+// HMAC-SHA256 of the request keyed with the peer.admin.secret of the peer it
+// is sent to. A request without a nonce is given a random one, and one
+// without an expiry expires after rollbackRequestLifetime.
+func SignRollbackRequest(request *pb.RollbackRequest, secret string) error {
+	if len(request.Nonce) == 0 {
+		request.Nonce = make([]byte, nonceSize)
+		if _, err := rand.Read(request.Nonce); err != nil {
+			return fmt.Errorf("Error generating rollback request nonce: %s", err)
+		}
+	}
+	if request.ExpiresAt == 0 {
+		request.ExpiresAt = time.Now().Add(rollbackRequestLifetime).Unix()
+	}
+	signature, err := rollbackSignature(request, secret)
+	if err != nil {
+		return err
+	}
+	request.AdminSignature = signature
+	return nil
+}
+
+// verifyRollbackRequest returns an error unless the request carries the
+// admin signature of secret, rollbacks being refused without a secret, and
+// was neither accepted before nor expired
+func verifyRollbackRequest(request *pb.RollbackRequest, secret string) error {
+	return verifyRollbackRequestAt(request, secret, acceptedRollbackNonces, time.Now())
+}
+
+func verifyRollbackRequestAt(request *pb.RollbackRequest, secret string, nonces *rollbackNonces, now time.Time) error {
+	if secret == "" {
+		return fmt.Errorf("Rollbacks require peer.admin.secret to be set")
+	}
+	expected, err := rollbackSignature(request, secret)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(request.AdminSignature, expected) {
+		return fmt.Errorf("Invalid admin signature")
+	}
+	if len(request.Nonce) == 0 {
+		return fmt.Errorf("Rollback request without a nonce")
+	}
+	expiresAt := time.Unix(request.ExpiresAt, 0)
+	if !now.Before(expiresAt) {
+		return fmt.Errorf("Rollback request expired at %s", expiresAt)
+	}
+	if expiresAt.After(now.Add(rollbackRequestLifetime)) {
+		return fmt.Errorf("Rollback request expires at %s, more than %s from now", expiresAt, rollbackRequestLifetime)
+	}
+	return nonces.use(request.Nonce, expiresAt, now)
+}
+
+// SetLedgerRollbacker sets the LedgerRollbacker answering CHAIN_ROLLBACK_REQUEST
+// messages. nil, the default, fails every rollback, the ledger not reverting
+// committed transactions itself.
+func (p *PeerImpl) SetLedgerRollbacker(rollbacker LedgerRollbacker) {
+	p.optionsMutex.Lock()
+	defer p.optionsMutex.Unlock()
+	p.rollbacker = rollbacker
+}
+
+// Rollback reverts the committed transactions, returning those rolled back
+// and those which could not be
+func (p *PeerImpl) Rollback(txIDs []string) (rolledBack []string, failed []string) {
+	p.optionsMutex.RLock()
+	rollbacker := p.rollbacker
+	p.optionsMutex.RUnlock()
+	for _, txID := range txIDs {
+		if rollbacker == nil {
+			peerLogger.Warningf("Not rolling back transaction %s, the ledger does not support rollbacks", txID)
+			failed = append(failed, txID)
+		} else if err := rollbacker.RollbackTransaction(txID); err != nil {
+			peerLogger.Warningf("Error rolling back transaction %s: %s", txID, err)
+			failed = append(failed, txID)
+		} else {
+			rolledBack = append(rolledBack, txID)
+		}
+	}
+	return rolledBack, failed
+}
+
+// RequestRollback sends the signed request to the peer at address
+func RequestRollback(address string, request *pb.RollbackRequest) (*pb.RollbackResponse, error) {
+	data, err := proto.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling RollbackRequest: %s", err)
+	}
+	reply, err := requestOverChat(address, &pb.Message{Type: pb.Message_CHAIN_ROLLBACK_REQUEST, Payload: data}, pb.Message_CHAIN_ROLLBACK_RESPONSE)
+	if err != nil {
+		return nil, fmt.Errorf("Error requesting rollback of %v from %s: %s", request.TxIDs, address, err)
+	}
+	response := &pb.RollbackResponse{}
+	if err := proto.Unmarshal(reply.Payload, response); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling RollbackResponse: %s", err)
+	}
+	return response, nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+type testRollbacker map[string]bool
+
+func (r testRollbacker) RollbackTransaction(txID string) error {
+	if !r[txID] {
+		return fmt.Errorf("Transaction %s cannot be rolled back", txID)
+	}
+	return nil
+}
+
+func TestVerifyRollbackRequest(t *testing.T) {
+	request := &pb.RollbackRequest{TxIDs: []string{"tx1", "tx2"}, Reason: "duplicate payment"}
+	if err := SignRollbackRequest(request, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyRollbackRequest(request, "secret"); err != nil {
+		t.Fatalf("Expected the signed request to verify: %s", err)
+	}
+	if err := verifyRollbackRequest(request, ""); err == nil {
+		t.Fatal("Expected rollbacks to be refused without an admin secret")
+	}
+	if err := verifyRollbackRequest(request, "other"); err == nil {
+		t.Fatal("Expected the signature of another secret to be refused")
+	}
+	request.TxIDs = append(request.TxIDs, "tx3")
+	if err := verifyRollbackRequest(request, "secret"); err == nil {
+		t.Fatal("Expected a request modified after signing to be refused")
+	}
+}
+
+func TestVerifyRollbackRequestReplay(t *testing.T) {
+	nonces := &rollbackNonces{expiry: make(map[string]time.Time)}
+	now := time.Now()
+	request := &pb.RollbackRequest{TxIDs: []string{"tx1"}, Reason: "duplicate payment"}
+	if err := SignRollbackRequest(request, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if len(request.Nonce) != nonceSize || request.ExpiresAt <= now.Unix() {
+		t.Fatalf("Expected the request to be signed with a nonce and an expiry, got %v", request)
+	}
+	if err := verifyRollbackRequestAt(request, "secret", nonces, now); err != nil {
+		t.Fatalf("Expected the signed request to verify: %s", err)
+	}
+	if err := verifyRollbackRequestAt(request, "secret", nonces, now); err == nil {
+		t.Fatal("Expected the request to be refused when replayed")
+	}
+	if err := verifyRollbackRequestAt(request, "secret", nonces, time.Unix(request.ExpiresAt, 0)); err == nil {
+		t.Fatal("Expected the request to be refused once expired")
+	}
+
+	unlimited := &pb.RollbackRequest{TxIDs: []string{"tx1"}, ExpiresAt: now.Add(24 * time.Hour).Unix()}
+	SignRollbackRequest(unlimited, "secret")
+	if err := verifyRollbackRequestAt(unlimited, "secret", nonces, now); err == nil {
+		t.Fatal("Expected a request expiring after the rollback request lifetime to be refused")
+	}
+	withoutNonce := &pb.RollbackRequest{TxIDs: []string{"tx1"}, ExpiresAt: now.Add(time.Minute).Unix()}
+	withoutNonce.AdminSignature, _ = rollbackSignature(withoutNonce, "secret")
+	if err := verifyRollbackRequestAt(withoutNonce, "secret", nonces, now); err == nil {
+		t.Fatal("Expected a request without a nonce to be refused")
+	}
+}
+
+func TestRollback(t *testing.T) {
+	p := &PeerImpl{}
+	if rolledBack, failed := p.Rollback([]string{"tx1"}); len(rolledBack) != 0 || len(failed) != 1 {
+		t.Fatalf("Expected the rollback to fail without ledger support, got %v rolled back and %v failed", rolledBack, failed)
+	}
+	p.SetLedgerRollbacker(testRollbacker{"tx1": true, "tx3": true})
+	rolledBack, failed := p.Rollback([]string{"tx1", "tx2", "tx3"})
+	if fmt.Sprint(rolledBack) != "[tx1 tx3]" || fmt.Sprint(failed) != "[tx2]" {
+		t.Fatalf("Expected tx1 and tx3 to be rolled back and tx2 to fail, got %v and %v", rolledBack, failed)
+	}
+}
+
+func TestRequestRollbackDisabled(t *testing.T) {
+	request := &pb.RollbackRequest{TxIDs: []string{"tx1"}, Reason: "test"}
+	if err := SignRollbackRequest(request, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RequestRollback(viper.GetString("peer.address"), request); err == nil {
+		t.Fatal("Expected the rollback to be refused without admin secret or peer.tx.allowRollback")
+	}
+}
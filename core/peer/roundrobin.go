@@ -0,0 +1,300 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// roundRobinReconnectInterval is the delay between reconnection attempts to a failed endpoint
+const roundRobinReconnectInterval = 5 * time.Second
+
+// PeerAddressResolver resolves a peer address (host:port) into the addresses of all the
+// peers serving it
+type PeerAddressResolver interface {
+	Resolve(address string) ([]string, error)
+}
+
+// DNSPeerAddressResolver resolves peer addresses by looking up every IP address of the host
+type DNSPeerAddressResolver struct{}
+
+// Resolve implements PeerAddressResolver
+func (DNSPeerAddressResolver) Resolve(address string) ([]string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing peer address %s: %s", address, err)
+	}
+	ips, err := net.LookupHost(host)
+	if err != nil {
+		return nil, fmt.Errorf("Error resolving peer address %s: %s", address, err)
+	}
+	endpoints := make([]string, len(ips))
+	for i, ip := range ips {
+		endpoints[i] = net.JoinHostPort(ip, port)
+	}
+	return endpoints, nil
+}
+
+// ChatSession is a client side Chat stream to a single peer endpoint
+type ChatSession interface {
+	Send(msg *pb.Message) error
+	Close() error
+	// Codec returns the codec negotiated in the DISC_HELLO exchange, proto
+	// until it completes
+	Codec() MessageCodec
+}
+
+// ChatSessionFactory opens a ChatSession to the supplied endpoint
+type ChatSessionFactory func(endpoint string) (ChatSession, error)
+
+type grpcChatSession struct {
+	sync.Mutex
+	conn     *grpc.ClientConn
+	stream   pb.Peer_ChatClient
+	chat     *CodecNegotiator
+	received chan receivedMessage
+	err      error
+}
+
+// NewChatSession dials the endpoint and opens a Chat stream to it. If hello is
+// not nil it is sent as the first message on the stream, and if
+// peer.chat.handshakeRetry.maxAttempts is set the DISC_HELLO reply is awaited
+// as with NewChatSessionWithHandshake. Messages received on the stream are
+// discarded, a receive error fails the session.
+func NewChatSession(endpoint string, hello *pb.Message) (ChatSession, error) {
+	if policy := newHandshakePolicyFromConfig(); policy.MaxAttempts > 0 {
+		return newChatSession(endpoint, hello, &policy)
+	}
+	return newChatSession(endpoint, hello, nil)
+}
+
+// NewChatSessionWithHandshake is like NewChatSession, but waits for the
+// DISC_HELLO reply to hello, resending it on the same stream as policy allows.
+// A failed handshake closes the session and returns a HandshakeFailedError.
+func NewChatSessionWithHandshake(endpoint string, hello *pb.Message, policy HandshakePolicy) (ChatSession, error) {
+	return newChatSession(endpoint, hello, &policy)
+}
+
+func newChatSession(endpoint string, hello *pb.Message, policy *HandshakePolicy) (ChatSession, error) {
+	conn, err := NewPeerClientConnectionWithAddress(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating connection to peer address %s: %s", endpoint, err)
+	}
+	stream, err := pb.NewPeerClient(conn).Chat(context.Background())
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Error establishing chat with peer address %s: %s", endpoint, err)
+	}
+	s := &grpcChatSession{conn: conn, stream: stream, chat: NewCodecNegotiator(stream), received: make(chan receivedMessage)}
+	go s.receive()
+	if hello != nil {
+		if policy != nil {
+			_, err = handshake(s.chat.Send, s.received, hello, *policy)
+		} else if err = s.chat.Send(hello); err != nil {
+			err = fmt.Errorf("Error sending %s to peer address %s: %s", hello.Type, endpoint, err)
+		}
+		if err != nil {
+			s.Close()
+			go s.drain()
+			return nil, err
+		}
+	}
+	go s.drain()
+	return s, nil
+}
+
+// receive passes the messages received on the stream to s.received, up to the first error
+func (s *grpcChatSession) receive() {
+	defer close(s.received)
+	for {
+		msg, err := s.chat.Recv()
+		s.received <- receivedMessage{msg, err}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *grpcChatSession) drain() {
+	for r := range s.received {
+		if r.err != nil {
+			s.Lock()
+			s.err = r.err
+			s.Unlock()
+			return
+		}
+	}
+}
+
+func (s *grpcChatSession) Send(msg *pb.Message) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	return s.chat.Send(msg)
+}
+
+func (s *grpcChatSession) Codec() MessageCodec {
+	return s.chat.Codec()
+}
+
+func (s *grpcChatSession) Close() error {
+	s.stream.CloseSend()
+	return s.conn.Close()
+}
+
+// RoundRobinPeerClient distributes messages across Chat sessions to every
+// endpoint an address resolves to. Failed sessions are taken out of rotation
+// and reconnected in the background.
+type RoundRobinPeerClient struct {
+	sync.Mutex
+	address           string
+	factory           ChatSessionFactory
+	sessions          map[string]ChatSession
+	endpoints         []string
+	next              int
+	reconnectInterval time.Duration
+	done              chan struct{}
+	closed            bool
+}
+
+// NewRoundRobinPeerClient resolves address using resolver and opens a session
+// to each resulting endpoint using factory. Endpoints which cannot be reached
+// are retried in the background.
+func NewRoundRobinPeerClient(address string, resolver PeerAddressResolver, factory ChatSessionFactory) (*RoundRobinPeerClient, error) {
+	return newRoundRobinPeerClient(address, resolver, factory, roundRobinReconnectInterval)
+}
+
+func newRoundRobinPeerClient(address string, resolver PeerAddressResolver, factory ChatSessionFactory, reconnectInterval time.Duration) (*RoundRobinPeerClient, error) {
+	endpoints, err := resolver.Resolve(address)
+	if err != nil {
+		return nil, err
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("Peer address %s resolved to no endpoints", address)
+	}
+	c := &RoundRobinPeerClient{
+		address:           address,
+		factory:           factory,
+		sessions:          make(map[string]ChatSession),
+		endpoints:         endpoints,
+		reconnectInterval: reconnectInterval,
+		done:              make(chan struct{}),
+	}
+	for _, endpoint := range endpoints {
+		session, err := factory(endpoint)
+		if err != nil {
+			peerLogger.Warningf("Error opening chat session to %s for %s: %s", endpoint, address, err)
+			go c.reconnect(endpoint)
+			continue
+		}
+		c.sessions[endpoint] = session
+	}
+	return c, nil
+}
+
+// Send sends the message on the next active session, failing over to the
+// following sessions if the send fails
+func (c *RoundRobinPeerClient) Send(msg *pb.Message) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return errors.New("Round robin peer client is closed")
+	}
+	for i := 0; i < len(c.endpoints); i++ {
+		endpoint := c.endpoints[c.next]
+		c.next = (c.next + 1) % len(c.endpoints)
+		session, ok := c.sessions[endpoint]
+		if !ok {
+			continue
+		}
+		err := session.Send(msg)
+		if err == nil {
+			return nil
+		}
+		peerLogger.Warningf("Error sending to %s, removing it from rotation: %s", endpoint, err)
+		session.Close()
+		delete(c.sessions, endpoint)
+		go c.reconnect(endpoint)
+	}
+	return fmt.Errorf("No active chat sessions for peer address %s", c.address)
+}
+
+// ActiveEndpoints returns the endpoints currently in rotation
+func (c *RoundRobinPeerClient) ActiveEndpoints() []string {
+	c.Lock()
+	defer c.Unlock()
+	active := make([]string, 0, len(c.sessions))
+	for endpoint := range c.sessions {
+		active = append(active, endpoint)
+	}
+	sort.Strings(active)
+	return active
+}
+
+// Close closes all sessions and stops reconnection attempts
+func (c *RoundRobinPeerClient) Close() {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.done)
+	for endpoint, session := range c.sessions {
+		session.Close()
+		delete(c.sessions, endpoint)
+	}
+}
+
+func (c *RoundRobinPeerClient) reconnect(endpoint string) {
+	ticker := time.NewTicker(c.reconnectInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+		session, err := c.factory(endpoint)
+		if err != nil {
+			peerLogger.Debugf("Error reconnecting to %s: %s", endpoint, err)
+			continue
+		}
+		c.Lock()
+		if c.closed {
+			c.Unlock()
+			session.Close()
+			return
+		}
+		c.sessions[endpoint] = session
+		c.Unlock()
+		peerLogger.Infof("Reconnected to %s, returning it to rotation", endpoint)
+		return
+	}
+}
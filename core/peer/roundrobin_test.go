@@ -0,0 +1,140 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+type staticResolver []string
+
+func (r staticResolver) Resolve(address string) ([]string, error) {
+	return r, nil
+}
+
+type mockChatSession struct {
+	sync.Mutex
+	sent int
+	fail bool
+}
+
+func (s *mockChatSession) Send(msg *pb.Message) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.fail {
+		return fmt.Errorf("session failed")
+	}
+	s.sent++
+	return nil
+}
+
+func (s *mockChatSession) Close() error {
+	return nil
+}
+
+func (s *mockChatSession) Codec() MessageCodec {
+	return protoCodec{}
+}
+
+type mockSessionFactory struct {
+	sync.Mutex
+	sessions map[string]*mockChatSession
+	down     map[string]bool
+}
+
+func newMockSessionFactory() *mockSessionFactory {
+	return &mockSessionFactory{sessions: make(map[string]*mockChatSession), down: make(map[string]bool)}
+}
+
+func (f *mockSessionFactory) open(endpoint string) (ChatSession, error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.down[endpoint] {
+		return nil, fmt.Errorf("endpoint %s is down", endpoint)
+	}
+	s := &mockChatSession{}
+	f.sessions[endpoint] = s
+	return s, nil
+}
+
+func TestRoundRobinPeerClientDistributes(t *testing.T) {
+	f := newMockSessionFactory()
+	c, err := newRoundRobinPeerClient("peers:30303", staticResolver{"a:30303", "b:30303", "c:30303"}, f.open, time.Millisecond)
+	if err != nil {
+		t.Fatalf("Error creating client: %s", err)
+	}
+	defer c.Close()
+	for i := 0; i < 9; i++ {
+		if err := c.Send(&pb.Message{}); err != nil {
+			t.Fatalf("Error sending: %s", err)
+		}
+	}
+	for endpoint, s := range f.sessions {
+		if s.sent != 3 {
+			t.Errorf("Expected 3 messages sent to %s, got %d", endpoint, s.sent)
+		}
+	}
+}
+
+func TestRoundRobinPeerClientFailover(t *testing.T) {
+	f := newMockSessionFactory()
+	c, err := newRoundRobinPeerClient("peers:30303", staticResolver{"a:30303", "b:30303"}, f.open, time.Millisecond)
+	if err != nil {
+		t.Fatalf("Error creating client: %s", err)
+	}
+	defer c.Close()
+
+	f.Lock()
+	f.sessions["a:30303"].fail = true
+	f.down["a:30303"] = true
+	f.Unlock()
+	if err := c.Send(&pb.Message{}); err != nil {
+		t.Fatalf("Expected send to fail over, got: %s", err)
+	}
+	if active := c.ActiveEndpoints(); !reflect.DeepEqual(active, []string{"b:30303"}) {
+		t.Fatalf("Expected only b:30303 to be active, got %v", active)
+	}
+
+	f.Lock()
+	f.down["a:30303"] = false
+	f.Unlock()
+	for i := 0; i < 100 && len(c.ActiveEndpoints()) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if active := c.ActiveEndpoints(); !reflect.DeepEqual(active, []string{"a:30303", "b:30303"}) {
+		t.Errorf("Expected a:30303 to be reconnected, active: %v", active)
+	}
+}
+
+func TestRoundRobinPeerClientNoSessions(t *testing.T) {
+	f := newMockSessionFactory()
+	f.down["a:30303"] = true
+	c, err := newRoundRobinPeerClient("peers:30303", staticResolver{"a:30303"}, f.open, time.Hour)
+	if err != nil {
+		t.Fatalf("Error creating client: %s", err)
+	}
+	defer c.Close()
+	if err := c.Send(&pb.Message{}); err == nil {
+		t.Error("Expected error sending with no active sessions")
+	}
+}
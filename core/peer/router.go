@@ -0,0 +1,237 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// MessageHandlerFunc handles a message received on a Chat stream. handler is
+// the MessageHandler of the stream, through which replies are sent.
+type MessageHandlerFunc func(handler MessageHandler, msg *pb.Message) error
+
+// builtinTypeOwner owns the message types the default router passes on to the stream MessageHandler
+const builtinTypeOwner = "peer"
+
+// TypeRegistration records who registered the function handling a message type
+type TypeRegistration struct {
+	Type         pb.Message_Type `json:"type"`
+	RegisteredBy string          `json:"registeredBy"`
+}
+
+// TypeRegistry tracks the owner of each message type handled by a MessageRouter
+type TypeRegistry struct {
+	sync.Mutex
+	owners map[pb.Message_Type]string
+}
+
+// NewTypeRegistry returns an empty registry
+func NewTypeRegistry() *TypeRegistry {
+	return &TypeRegistry{owners: make(map[pb.Message_Type]string)}
+}
+
+// Register records owner as the owner of msgType, failing if the type is already registered
+func (t *TypeRegistry) Register(msgType pb.Message_Type, owner string) error {
+	t.Lock()
+	defer t.Unlock()
+	if registeredBy, ok := t.owners[msgType]; ok {
+		return &TypeAlreadyRegisteredError{Type: msgType, RegisteredBy: registeredBy}
+	}
+	t.owners[msgType] = owner
+	return nil
+}
+
+// set records owner as the owner of msgType, replacing any previous owner
+func (t *TypeRegistry) set(msgType pb.Message_Type, owner string) {
+	t.Lock()
+	defer t.Unlock()
+	t.owners[msgType] = owner
+}
+
+// Dump returns the registrations ordered by message type
+func (t *TypeRegistry) Dump() []TypeRegistration {
+	t.Lock()
+	defer t.Unlock()
+	registrations := make([]TypeRegistration, 0, len(t.owners))
+	for msgType, owner := range t.owners {
+		registrations = append(registrations, TypeRegistration{Type: msgType, RegisteredBy: owner})
+	}
+	sort.Sort(typeRegistrations(registrations))
+	return registrations
+}
+
+type typeRegistrations []TypeRegistration
+
+func (r typeRegistrations) Len() int           { return len(r) }
+func (r typeRegistrations) Less(i, j int) bool { return r[i].Type < r[j].Type }
+func (r typeRegistrations) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// MessageRouter dispatches the messages received on Chat streams to the
+// function registered for their type
+type MessageRouter struct {
+	sync.RWMutex
+	handlers map[pb.Message_Type]MessageHandlerFunc
+	fallback MessageHandlerFunc
+	types    *TypeRegistry
+	slots    *dispatchSlots
+}
+
+// NewMessageRouter returns a router without any registered functions
+func NewMessageRouter() *MessageRouter {
+	return &MessageRouter{handlers: make(map[pb.Message_Type]MessageHandlerFunc), types: NewTypeRegistry()}
+}
+
+// consensusMessageTypes are handled by the consensus handler wrapping the
+// stream MessageHandler of validating peers rather than by its FSM
+var consensusMessageTypes = []pb.Message_Type{
+	pb.Message_CONSENSUS,
+	pb.Message_CHAIN_PROPOSE_BLOCK,
+	pb.Message_CHAIN_VOTE_BLOCK,
+	pb.Message_CHAIN_COMMIT_BLOCK,
+}
+
+// builtinMessageTypes returns the message types the stream MessageHandler
+// handles: the events of the Handler FSM and the consensus messages
+func builtinMessageTypes() []pb.Message_Type {
+	seen := make(map[pb.Message_Type]bool)
+	var types []pb.Message_Type
+	add := func(msgType pb.Message_Type) {
+		if !seen[msgType] {
+			seen[msgType] = true
+			types = append(types, msgType)
+		}
+	}
+	for _, event := range peerHandlerEvents() {
+		add(pb.Message_Type(pb.Message_Type_value[event.Name]))
+	}
+	for _, msgType := range consensusMessageTypes {
+		add(msgType)
+	}
+	return types
+}
+
+// newDefaultMessageRouter returns a router passing the builtinMessageTypes on
+// to the MessageHandler of the stream, up to peer.chat.maxConcurrentDispatch
+// at once, the other types being left for extensions to register.
+// CHAIN_QUERY_STAKING_INFO messages are answered with a
+// CHAIN_QUERY_UNSUPPORTED unless peer.consensus.type is pos.
+func newDefaultMessageRouter() *MessageRouter {
+	r := NewMessageRouter()
+	r.SetMaxConcurrentDispatch(viper.GetInt("peer.chat.maxConcurrentDispatch"))
+	for _, msgType := range builtinMessageTypes() {
+		f := handleWithMessageHandler
+		if msgType == pb.Message_CHAIN_QUERY_STAKING_INFO && !isProofOfStake() {
+			f = handleUnsupportedQuery
+		}
+		if err := r.RegisterWithOwner(msgType, builtinTypeOwner, f); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+func handleWithMessageHandler(handler MessageHandler, msg *pb.Message) error {
+	return handler.HandleMessage(msg)
+}
+
+// Handle registers f for messages of msgType, replacing any function
+// registered before. The registration has no owner, use RegisterWithOwner to
+// detect collisions instead.
+func (r *MessageRouter) Handle(msgType pb.Message_Type, f MessageHandlerFunc) {
+	r.Lock()
+	defer r.Unlock()
+	r.handlers[msgType] = f
+	r.types.set(msgType, "")
+}
+
+// RegisterWithOwner registers f for messages of msgType on behalf of owner,
+// typically the registering package. A *TypeAlreadyRegisteredError is
+// returned if a function is already registered for the type.
+func (r *MessageRouter) RegisterWithOwner(msgType pb.Message_Type, owner string, f MessageHandlerFunc) error {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.types.Register(msgType, owner); err != nil {
+		return err
+	}
+	r.handlers[msgType] = f
+	return nil
+}
+
+// TypeRegistry returns the registry of the owners of the handled message types
+func (r *MessageRouter) TypeRegistry() *TypeRegistry {
+	return r.types
+}
+
+// HandleFallback registers f for messages of types without a registered function
+func (r *MessageRouter) HandleFallback(f MessageHandlerFunc) {
+	r.Lock()
+	defer r.Unlock()
+	r.fallback = f
+}
+
+// SetMaxConcurrentDispatch limits the messages dispatched at once to max,
+// those of the streams of the peers of the highest connection priority
+// waiting the least for their turn. 0 sets no limit.
+func (r *MessageRouter) SetMaxConcurrentDispatch(max int) {
+	r.Lock()
+	defer r.Unlock()
+	r.slots = nil
+	if max > 0 {
+		r.slots = newDispatchSlots(max)
+	}
+}
+
+// Dispatch calls the function registered for the type of msg, or the
+// fallback. Without either an error is returned.
+func (r *MessageRouter) Dispatch(handler MessageHandler, msg *pb.Message) error {
+	r.RLock()
+	f, ok := r.handlers[msg.Type]
+	if !ok {
+		f = r.fallback
+	}
+	slots := r.slots
+	r.RUnlock()
+	if f == nil {
+		return fmt.Errorf("No handler registered for message type %s", msg.Type)
+	}
+	if slots != nil {
+		slots.acquire(handlerPriority(handler))
+		defer slots.release()
+	}
+	return f(handler, msg)
+}
+
+// MessageTypesHandler returns an http.Handler serving the registrations of the message router as JSON
+func (p *PeerImpl) MessageTypesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.Marshal(p.router.TypeRegistry().Dump())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+}
@@ -0,0 +1,123 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// routerTestHandler records the messages passed on to the stream MessageHandler
+type routerTestHandler struct {
+	MessageHandler
+	handled []pb.Message_Type
+}
+
+func (h *routerTestHandler) HandleMessage(msg *pb.Message) error {
+	h.handled = append(h.handled, msg.Type)
+	return nil
+}
+
+func TestDefaultMessageRouterPassesOnKnownTypes(t *testing.T) {
+	r := newDefaultMessageRouter()
+	h := &routerTestHandler{}
+	if err := r.Dispatch(h, &pb.Message{Type: pb.Message_DISC_HELLO}); err != nil {
+		t.Fatalf("Error dispatching DISC_HELLO: %s", err)
+	}
+	if len(h.handled) != 1 || h.handled[0] != pb.Message_DISC_HELLO {
+		t.Errorf("Expected DISC_HELLO to be passed on to the stream handler, got %v", h.handled)
+	}
+	if err := r.Dispatch(h, &pb.Message{Type: pb.Message_Type(1000)}); err == nil {
+		t.Error("Expected an error dispatching an unknown message type without a fallback")
+	}
+}
+
+func TestMessageRouterHandleAndFallback(t *testing.T) {
+	r := newDefaultMessageRouter()
+	h := &routerTestHandler{}
+	var routed, fallback []pb.Message_Type
+	r.Handle(pb.Message_DISC_GET_PEERS, func(handler MessageHandler, msg *pb.Message) error {
+		routed = append(routed, msg.Type)
+		return nil
+	})
+	r.HandleFallback(func(handler MessageHandler, msg *pb.Message) error {
+		fallback = append(fallback, msg.Type)
+		return nil
+	})
+	for _, msgType := range []pb.Message_Type{pb.Message_DISC_GET_PEERS, pb.Message_Type(1000), pb.Message_DISC_PEERS} {
+		if err := r.Dispatch(h, &pb.Message{Type: msgType}); err != nil {
+			t.Fatalf("Error dispatching %s: %s", msgType, err)
+		}
+	}
+	if len(routed) != 1 || len(fallback) != 1 || fallback[0] != pb.Message_Type(1000) {
+		t.Errorf("Expected one registered and one fallback dispatch, got %v and %v", routed, fallback)
+	}
+	if len(h.handled) != 1 || h.handled[0] != pb.Message_DISC_PEERS {
+		t.Errorf("Expected only DISC_PEERS passed on to the stream handler, got %v", h.handled)
+	}
+}
+
+func TestMessageRouterRegisterWithOwner(t *testing.T) {
+	r := newDefaultMessageRouter()
+	noop := func(handler MessageHandler, msg *pb.Message) error { return nil }
+	extension := pb.Message_Type(1000)
+	if err := r.RegisterWithOwner(extension, "ext", noop); err != nil {
+		t.Fatalf("Error registering an unknown message type: %s", err)
+	}
+	err := r.RegisterWithOwner(extension, "other", noop)
+	if registered, ok := err.(*TypeAlreadyRegisteredError); !ok || registered.RegisteredBy != "ext" {
+		t.Fatalf("Expected the type to be registered by ext, got %v", err)
+	}
+	err = r.RegisterWithOwner(pb.Message_DISC_HELLO, "ext", noop)
+	if registered, ok := err.(*TypeAlreadyRegisteredError); !ok || registered.RegisteredBy != builtinTypeOwner {
+		t.Fatalf("Expected DISC_HELLO to be registered by %s, got %v", builtinTypeOwner, err)
+	}
+
+	// Types without a built-in handler are left for extensions
+	if err := r.RegisterWithOwner(pb.Message_CHAIN_TX_RESPONSE, "ext", noop); err != nil {
+		t.Fatalf("Error registering a type without a built-in handler: %s", err)
+	}
+
+	dump := r.TypeRegistry().Dump()
+	if len(dump) != len(builtinMessageTypes())+2 {
+		t.Fatalf("Expected %d registrations, got %d", len(builtinMessageTypes())+2, len(dump))
+	}
+	if last := dump[len(dump)-1]; last.Type != extension || last.RegisteredBy != "ext" {
+		t.Errorf("Expected the extension type last, got %+v", last)
+	}
+}
+
+func TestBuiltinMessageTypes(t *testing.T) {
+	builtin := make(map[pb.Message_Type]bool)
+	for _, msgType := range builtinMessageTypes() {
+		if builtin[msgType] {
+			t.Errorf("Expected %s once in the built-in types", msgType)
+		}
+		builtin[msgType] = true
+	}
+	for _, msgType := range []pb.Message_Type{pb.Message_DISC_HELLO, pb.Message_CHAIN_TRANSACTIONS, pb.Message_CONSENSUS} {
+		if !builtin[msgType] {
+			t.Errorf("Expected %s to be a built-in type", msgType)
+		}
+	}
+	for _, msgType := range []pb.Message_Type{pb.Message_UNDEFINED, pb.Message_RESPONSE, pb.Message_CHAIN_TX_RESPONSE} {
+		if builtin[msgType] {
+			t.Errorf("Expected %s, which the stream handler does not handle, not to be a built-in type", msgType)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// TransactionBatchProcessor interface enables a Peer to answer CHAIN_TRANSACTIONS messages
+type TransactionBatchProcessor interface {
+	// ProcessTransactionBatch returns the violations of the invalid
+	// transactions of the batch, and which of the others were committed and
+	// which failed, a nil result reporting none of them individually
+	ProcessTransactionBatch(batch *pb.TransactionBlock, progress BatchProgressReporter) (*pb.TransactionsValidationError, *BatchResult, error)
+	// ProcessImmediate is ProcessTransactionBatch bypassing the peer.tx.maxTPS
+	// limiter and the queues of the relay targets, for fast path batches
+	ProcessImmediate(batch *pb.TransactionBlock) (*pb.TransactionsValidationError, *BatchResult, error)
+}
+
+// TransactionSchemaVersion is the version of the transaction format of the
+// CHAIN_TRANSACTIONS batches sent by this peer
+const TransactionSchemaVersion = 1
+
+// checkSchemaVersion returns the error to reply to a CHAIN_TRANSACTIONS batch
+// whose schema version is outside of peer.tx.minSchemaVersion to
+// peer.tx.maxSchemaVersion, nil if it is within
+func checkSchemaVersion(version uint32) *pb.TransactionsVersionError {
+	min := uint32(viper.GetInt("peer.tx.minSchemaVersion"))
+	max := uint32(viper.GetInt("peer.tx.maxSchemaVersion"))
+	if version < min || version > max {
+		return &pb.TransactionsVersionError{SupportedMin: min, SupportedMax: max}
+	}
+	return nil
+}
+
+// BatchProgressReporter is called every peer.tx.progressInterval transactions
+// processed out of the total of a CHAIN_TRANSACTIONS batch, currentTxID being
+// the last one
+type BatchProgressReporter func(processed, total int, currentTxID string)
+
+// jsonSchema is the subset of JSON Schema a SchemaValidator enforces: the
+// type, required, properties, items, enum, minLength, maxLength, pattern,
+// minimum and maximum keywords.
+type jsonSchema struct {
+	Type       string                 `json:"type"`
+	Required   []string               `json:"required"`
+	Properties map[string]*jsonSchema `json:"properties"`
+	Items      *jsonSchema            `json:"items"`
+	Enum       []interface{}          `json:"enum"`
+	MinLength  *int                   `json:"minLength"`
+	MaxLength  *int                   `json:"maxLength"`
+	Pattern    string                 `json:"pattern"`
+	Minimum    *float64               `json:"minimum"`
+	Maximum    *float64               `json:"maximum"`
+	pattern    *regexp.Regexp
+}
+
+func (s *jsonSchema) compile() error {
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("Invalid pattern %q: %s", s.Pattern, err)
+		}
+		s.pattern = pattern
+	}
+	for _, property := range s.Properties {
+		if err := property.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+	return nil
+}
+
+// SchemaValidator checks transactions against a JSON Schema. Transactions are
+// validated in their protobuf JSON encoding, where bytes fields are base64
+// strings, enums are names and 64 bit integers are strings, which the number
+// keywords accept.
+type SchemaValidator struct {
+	schema           *jsonSchema
+	RejectAllOnError bool // Reject the whole batch when one of its transactions is invalid
+}
+
+// NewSchemaValidator returns a validator for the JSON Schema document
+func NewSchemaValidator(document []byte) (*SchemaValidator, error) {
+	schema := &jsonSchema{}
+	if err := json.Unmarshal(document, schema); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling transaction schema: %s", err)
+	}
+	if err := schema.compile(); err != nil {
+		return nil, fmt.Errorf("Error compiling transaction schema: %s", err)
+	}
+	return &SchemaValidator{schema: schema}, nil
+}
+
+// newSchemaValidatorFromConfig loads the schema at peer.tx.schemaFile, or
+// returns nil if none is configured
+func newSchemaValidatorFromConfig() (*SchemaValidator, error) {
+	return newSchemaValidatorFromFile(viper.GetString("peer.tx.schemaFile"), viper.GetBool("peer.tx.rejectAllOnError"))
+}
+
+// newSchemaValidatorFromFile loads the schema at path, or returns nil if path is empty
+func newSchemaValidatorFromFile(path string, rejectAllOnError bool) (*SchemaValidator, error) {
+	if path == "" {
+		return nil, nil
+	}
+	document, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading transaction schema %s: %s", path, err)
+	}
+	validator, err := NewSchemaValidator(document)
+	if err != nil {
+		return nil, err
+	}
+	validator.RejectAllOnError = rejectAllOnError
+	return validator, nil
+}
+
+// Validate returns the violations of the schema by tx. A nil SchemaValidator accepts any transaction.
+func (v *SchemaValidator) Validate(tx *pb.Transaction) ([]*pb.ValidationViolation, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := (&jsonpb.Marshaler{}).MarshalToString(tx)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling transaction %s to JSON: %s", tx.Uuid, err)
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling transaction %s JSON: %s", tx.Uuid, err)
+	}
+	var violations []*pb.ValidationViolation
+	v.schema.validate("", value, func(field, reason string) {
+		violations = append(violations, &pb.ValidationViolation{TxID: tx.Uuid, Field: field, Reason: reason})
+	})
+	return violations, nil
+}
+
+// ValidateBatch splits the transactions into those to process and the
+// violations of the others. No transaction is to be processed when one is
+// invalid and RejectAllOnError is set.
+func (v *SchemaValidator) ValidateBatch(transactions []*pb.Transaction) (valid []*pb.Transaction, violations []*pb.ValidationViolation) {
+	for i, tx := range transactions {
+		txViolations, err := v.Validate(tx)
+		if err != nil {
+			txViolations = []*pb.ValidationViolation{{TxID: tx.Uuid, Reason: err.Error()}}
+		}
+		if len(txViolations) == 0 {
+			valid = append(valid, tx)
+			continue
+		}
+		for _, violation := range txViolations {
+			violation.TxIndex = uint32(i)
+		}
+		violations = append(violations, txViolations...)
+	}
+	if len(violations) > 0 && v.RejectAllOnError {
+		valid = nil
+	}
+	return valid, violations
+}
+
+func joinField(parent, field string) string {
+	if parent == "" {
+		return field
+	}
+	return parent + "." + field
+}
+
+func (s *jsonSchema) validate(field string, value interface{}, violation func(field, reason string)) {
+	if !s.validateType(value) {
+		violation(field, fmt.Sprintf("must be of type %s", s.Type))
+		return
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if reflect.DeepEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			violation(field, fmt.Sprintf("must be one of %v", s.Enum))
+		}
+	}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for _, required := range s.Required {
+			if _, ok := value[required]; !ok {
+				violation(joinField(field, required), "is required")
+			}
+		}
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := value[name]; ok {
+				s.Properties[name].validate(joinField(field, name), property, violation)
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range value {
+				s.Items.validate(fmt.Sprintf("%s[%d]", field, i), item, violation)
+			}
+		}
+	case string:
+		if s.Type == "number" || s.Type == "integer" {
+			number, _ := strconv.ParseFloat(value, 64)
+			s.validateNumber(field, number, violation)
+			return
+		}
+		if s.MinLength != nil && len(value) < *s.MinLength {
+			violation(field, fmt.Sprintf("must be at least %d characters long", *s.MinLength))
+		}
+		if s.MaxLength != nil && len(value) > *s.MaxLength {
+			violation(field, fmt.Sprintf("must be at most %d characters long", *s.MaxLength))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(value) {
+			violation(field, fmt.Sprintf("must match %s", s.Pattern))
+		}
+	case float64:
+		s.validateNumber(field, value, violation)
+	}
+}
+
+func (s *jsonSchema) validateNumber(field string, value float64, violation func(field, reason string)) {
+	if s.Minimum != nil && value < *s.Minimum {
+		violation(field, fmt.Sprintf("must be at least %v", *s.Minimum))
+	}
+	if s.Maximum != nil && value > *s.Maximum {
+		violation(field, fmt.Sprintf("must be at most %v", *s.Maximum))
+	}
+}
+
+func (s *jsonSchema) validateType(value interface{}) bool {
+	switch s.Type {
+	case "":
+		return true
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number", "integer":
+		var number float64
+		switch value := value.(type) {
+		case float64:
+			number = value
+		case string:
+			var err error
+			if number, err = strconv.ParseFloat(value, 64); err != nil {
+				return false
+			}
+		default:
+			return false
+		}
+		return s.Type == "number" || number == float64(int64(number))
+	}
+	return false
+}
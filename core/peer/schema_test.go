@@ -0,0 +1,97 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"google/protobuf"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+const testTransactionSchema = `{
+	"type": "object",
+	"required": ["uuid", "type", "timestamp"],
+	"properties": {
+		"uuid": {"type": "string", "pattern": "^[0-9a-f-]+$"},
+		"type": {"enum": ["CHAINCODE_DEPLOY", "CHAINCODE_INVOKE"]},
+		"timestamp": {
+			"type": "object",
+			"properties": {"seconds": {"type": "integer", "minimum": 1}}
+		}
+	}
+}`
+
+func TestSchemaValidator(t *testing.T) {
+	validator, err := NewSchemaValidator([]byte(testTransactionSchema))
+	if err != nil {
+		t.Fatalf("Error loading schema: %s", err)
+	}
+	valid := &pb.Transaction{Uuid: "0a-1b", Type: pb.Transaction_CHAINCODE_INVOKE, Timestamp: &google_protobuf.Timestamp{Seconds: 10}}
+	if violations, err := validator.Validate(valid); err != nil || len(violations) != 0 {
+		t.Fatalf("Expected a valid transaction, got %v, %v", violations, err)
+	}
+
+	invalid := []*pb.Transaction{
+		{Type: pb.Transaction_CHAINCODE_INVOKE, Timestamp: &google_protobuf.Timestamp{Seconds: 10}},
+		{Uuid: "not hex", Type: pb.Transaction_CHAINCODE_INVOKE, Timestamp: &google_protobuf.Timestamp{Seconds: 10}},
+		{Uuid: "0a", Type: pb.Transaction_CHAINCODE_QUERY, Timestamp: &google_protobuf.Timestamp{Seconds: 10}},
+		{Uuid: "0a", Type: pb.Transaction_CHAINCODE_INVOKE, Timestamp: &google_protobuf.Timestamp{Seconds: -5}},
+	}
+	fields := []string{"uuid", "uuid", "type", "timestamp.seconds"}
+	for i, tx := range invalid {
+		violations, err := validator.Validate(tx)
+		if err != nil {
+			t.Fatalf("Error validating transaction %d: %s", i, err)
+		}
+		if len(violations) != 1 || violations[0].Field != fields[i] {
+			t.Errorf("Expected a violation of %s by transaction %d, got %v", fields[i], i, violations)
+		}
+	}
+
+	accepted, violations := validator.ValidateBatch([]*pb.Transaction{valid, invalid[0], valid})
+	if len(accepted) != 2 || len(violations) != 1 || violations[0].TxIndex != 1 {
+		t.Fatalf("Expected the two valid transactions to be accepted, got %d accepted and violations %v", len(accepted), violations)
+	}
+	validator.RejectAllOnError = true
+	if accepted, _ := validator.ValidateBatch([]*pb.Transaction{valid, invalid[0]}); len(accepted) != 0 {
+		t.Fatalf("Expected the batch to be rejected, got %d accepted", len(accepted))
+	}
+	if accepted, _ := (*SchemaValidator)(nil).ValidateBatch(invalid); len(accepted) != len(invalid) {
+		t.Fatalf("Expected a nil validator to accept all transactions, got %d accepted", len(accepted))
+	}
+}
+
+func TestCheckSchemaVersion(t *testing.T) {
+	defer viper.Set("peer.tx.minSchemaVersion", viper.GetInt("peer.tx.minSchemaVersion"))
+	defer viper.Set("peer.tx.maxSchemaVersion", viper.GetInt("peer.tx.maxSchemaVersion"))
+	viper.Set("peer.tx.minSchemaVersion", 1)
+	viper.Set("peer.tx.maxSchemaVersion", 2)
+	for _, version := range []uint32{1, 2} {
+		if err := checkSchemaVersion(version); err != nil {
+			t.Errorf("Expected schema version %d to be accepted, got %v", version, err)
+		}
+	}
+	for _, version := range []uint32{0, 3} {
+		err := checkSchemaVersion(version)
+		if err == nil || err.SupportedMin != 1 || err.SupportedMax != 2 {
+			t.Errorf("Expected schema version %d to be refused with the supported versions, got %v", version, err)
+		}
+	}
+}
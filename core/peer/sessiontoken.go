@@ -0,0 +1,290 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// sessionTokenKeySize is the size of the key the session tokens of a peer are
+// signed with, generated when the peer starts
+const sessionTokenKeySize = 32
+
+// SessionTokenStore issues the session tokens letting a peer that reconnects
+// skip the authentication of the DISC_HELLO exchange, and holds the tokens
+// issued to this peer by the peers it dials. A token is the expiry and the
+// HMAC-SHA256 of the peer ID and expiry, keyed with a key of this peer: it
+// is only valid for the peer it was issued to, until it expires or is
+// revoked. A nil store issues no token and holds none.
+type SessionTokenStore struct {
+	sync.Mutex
+	key     []byte
+	expiry  time.Duration
+	issued  map[string]map[string]time.Time // Peer ID to the tokens issued to it, with their expiry
+	revoked map[string]time.Time            // Revoked token to its expiry, forgotten once expired
+	held    map[string]string               // Address of a peer to the token it issued to this peer
+}
+
+// NewSessionTokenStore returns a store issuing tokens valid for expiry, 0
+// issuing none
+func NewSessionTokenStore(expiry time.Duration) (*SessionTokenStore, error) {
+	key := make([]byte, sessionTokenKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("Error generating session token key: %s", err)
+	}
+	return &SessionTokenStore{
+		key:     key,
+		expiry:  expiry,
+		issued:  make(map[string]map[string]time.Time),
+		revoked: make(map[string]time.Time),
+		held:    make(map[string]string),
+	}, nil
+}
+
+// newSessionTokenStoreFromConfig returns a store issuing tokens valid for
+// peer.auth.sessionTokenExpiry
+func newSessionTokenStoreFromConfig() (*SessionTokenStore, error) {
+	return NewSessionTokenStore(viper.GetDuration("peer.auth.sessionTokenExpiry"))
+}
+
+func (s *SessionTokenStore) sign(peerID string, expiry int64) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(peerID))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strconv.FormatInt(expiry, 10)))
+	return mac.Sum(nil)
+}
+
+// Issue returns a new token for the peer of peerID, "" if the store issues none
+func (s *SessionTokenStore) Issue(peerID string) string {
+	if s == nil || s.expiry <= 0 || peerID == "" {
+		return ""
+	}
+	now := time.Now()
+	expiry := now.Add(s.expiry)
+	token := fmt.Sprintf("%d.%s", expiry.Unix(), hex.EncodeToString(s.sign(peerID, expiry.Unix())))
+	s.Lock()
+	defer s.Unlock()
+	tokens := s.issued[peerID]
+	if tokens == nil {
+		tokens = make(map[string]time.Time)
+		s.issued[peerID] = tokens
+	}
+	for t, tokenExpiry := range tokens {
+		if now.After(tokenExpiry) {
+			delete(tokens, t)
+		}
+	}
+	tokens[token] = expiry
+	return token
+}
+
+// Verify returns an error unless token was issued by this store to the peer
+// of peerID, has not expired and was not revoked
+func (s *SessionTokenStore) Verify(token, peerID string) error {
+	if s == nil {
+		return errors.New("No session token store")
+	}
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return errors.New("Malformed session token")
+	}
+	expiry, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return errors.New("Malformed session token expiry")
+	}
+	signature, err := hex.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, s.sign(peerID, expiry)) {
+		return fmt.Errorf("Session token not issued to %s", peerID)
+	}
+	if time.Now().Unix() > expiry {
+		return errors.New("Session token expired")
+	}
+	s.Lock()
+	defer s.Unlock()
+	if _, revoked := s.revoked[token]; revoked {
+		return errors.New("Session token revoked")
+	}
+	return nil
+}
+
+// Revoke makes token invalid before it expires
+func (s *SessionTokenStore) Revoke(token string) {
+	if s == nil {
+		return
+	}
+	expiry := time.Now().Add(s.expiry)
+	if parts := strings.SplitN(token, ".", 2); len(parts) == 2 {
+		if unix, err := strconv.ParseInt(parts[0], 10, 64); err == nil {
+			expiry = time.Unix(unix, 0)
+		}
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.revoke(token, expiry)
+}
+
+func (s *SessionTokenStore) revoke(token string, expiry time.Time) {
+	now := time.Now()
+	for t, tokenExpiry := range s.revoked {
+		if now.After(tokenExpiry) {
+			delete(s.revoked, t)
+		}
+	}
+	s.revoked[token] = expiry
+}
+
+// RevokePeer revokes the tokens issued to the peer of peerID
+func (s *SessionTokenStore) RevokePeer(peerID string) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	for token, expiry := range s.issued[peerID] {
+		s.revoke(token, expiry)
+	}
+	delete(s.issued, peerID)
+}
+
+// Hold keeps the token issued to this peer by the peer at address, presented
+// when dialing it again
+func (s *SessionTokenStore) Hold(address, token string) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.held[address] = token
+}
+
+// Held returns the token issued to this peer by the peer at address, "" if none
+func (s *SessionTokenStore) Held(address string) string {
+	if s == nil {
+		return ""
+	}
+	s.Lock()
+	defer s.Unlock()
+	return s.held[address]
+}
+
+// Forget drops the token issued to this peer by the peer at address
+func (s *SessionTokenStore) Forget(address string) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	delete(s.held, address)
+}
+
+// SessionTokenStoreAccessor interface enables a Peer to hand out its SessionTokenStore
+type SessionTokenStoreAccessor interface {
+	GetSessionTokenStore() *SessionTokenStore
+}
+
+// GetSessionTokenStore returns the store of the session tokens of the Chat streams
+func (p *PeerImpl) GetSessionTokenStore() *SessionTokenStore {
+	return p.sessions
+}
+
+type sessionTokenKey struct{}
+
+// withSessionToken returns a context presenting token in the DISC_HELLO of
+// the Chat stream initiated with it
+func withSessionToken(ctx context.Context, token string) context.Context {
+	if token == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, sessionTokenKey{}, token)
+}
+
+// resumingCoordinator is the MessageHandlerCoordinator of a Chat stream
+// initiated with a session token, presenting it in the DISC_HELLO sent
+type resumingCoordinator struct {
+	MessageHandlerCoordinator
+	token string
+}
+
+// NewOpenchainDiscoveryHelloWithChallenge implements Peer
+func (c *resumingCoordinator) NewOpenchainDiscoveryHelloWithChallenge(authChallenge []byte) (*pb.Message, error) {
+	return c.NewOpenchainDiscoveryHelloWithSession(authChallenge, c.token)
+}
+
+// sessionCoordinator returns the coordinator of the handler of a Chat stream
+// of ctx, presenting the session token of ctx, if any
+func sessionCoordinator(ctx context.Context, coord MessageHandlerCoordinator) MessageHandlerCoordinator {
+	if token, ok := ctx.Value(sessionTokenKey{}).(string); ok {
+		return &resumingCoordinator{MessageHandlerCoordinator: coord, token: token}
+	}
+	return coord
+}
+
+// resumeSession returns whether the DISC_HELLO received authenticates the
+// remote peer with a session token, the shared secret challenge and the JWT
+// authToken being skipped. The receiver of a Chat
+// verifies the token presented, the initiator accepts a DISC_HELLO without
+// challenge carrying a new token if it presented one.
+func (d *Handler) resumeSession(helloMessage *pb.HelloMessage) bool {
+	if helloMessage.SessionToken == "" || helloMessage.PeerEndpoint == nil || helloMessage.PeerEndpoint.ID == nil {
+		return false
+	}
+	sessions := d.Coordinator.GetSessionTokenStore()
+	if d.initiatedStream {
+		return d.helloChallenge != nil && len(helloMessage.AuthChallenge) == 0 && sessions.Held(d.ToPeerEndpoint.Address) != ""
+	}
+	if err := sessions.Verify(helloMessage.SessionToken, helloMessage.PeerEndpoint.ID.Name); err != nil {
+		peerLogger.Debugf("Not resuming the session of %s: %s", helloMessage.PeerEndpoint.ID.Name, err)
+		return false
+	}
+	peerLogger.Debugf("Resuming the session of %s", helloMessage.PeerEndpoint.ID.Name)
+	return true
+}
+
+// issueSessionToken returns a new session token for the remote peer, "" if
+// none is issued, as to peers opening the Chat for requests alone
+func (d *Handler) issueSessionToken() string {
+	if d.requestOnly || d.ToPeerEndpoint == nil || d.ToPeerEndpoint.ID == nil {
+		return ""
+	}
+	return d.Coordinator.GetSessionTokenStore().Issue(d.ToPeerEndpoint.ID.Name)
+}
+
+// revokeSession revokes the session tokens issued to the remote peer and
+// drops the one it issued, for it to authenticate in full when reconnecting
+func (d *Handler) revokeSession() {
+	if d.ToPeerEndpoint == nil || d.ToPeerEndpoint.ID == nil {
+		return
+	}
+	sessions := d.Coordinator.GetSessionTokenStore()
+	sessions.RevokePeer(d.ToPeerEndpoint.ID.Name)
+	sessions.Forget(d.ToPeerEndpoint.Address)
+}
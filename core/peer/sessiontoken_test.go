@@ -0,0 +1,119 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestSessionTokenVerify(t *testing.T) {
+	s, err := NewSessionTokenStore(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := s.Issue("vp1")
+	if token == "" {
+		t.Fatal("Expected a token to be issued")
+	}
+	if err := s.Verify(token, "vp1"); err != nil {
+		t.Fatalf("Expected the token to be valid for vp1: %s", err)
+	}
+	if err := s.Verify(token, "vp2"); err == nil {
+		t.Error("Expected the token to be refused for another peer")
+	}
+	other, _ := NewSessionTokenStore(time.Hour)
+	if err := other.Verify(token, "vp1"); err == nil {
+		t.Error("Expected the token to be refused by another peer")
+	}
+	parts := strings.SplitN(token, ".", 2)
+	if err := s.Verify("1."+parts[1], "vp1"); err == nil {
+		t.Error("Expected a token with a forged expiry to be refused")
+	}
+	for _, malformed := range []string{"", "nodot", "x.00", "1.zz"} {
+		if err := s.Verify(malformed, "vp1"); err == nil {
+			t.Errorf("Expected the malformed token %q to be refused", malformed)
+		}
+	}
+}
+
+func TestSessionTokenExpiry(t *testing.T) {
+	s, _ := NewSessionTokenStore(0)
+	if token := s.Issue("vp1"); token != "" {
+		t.Fatalf("Expected no token to be issued without an expiry, got %s", token)
+	}
+	past := time.Now().Add(-time.Minute).Unix()
+	expired := fmt.Sprintf("%d.%s", past, hex.EncodeToString(s.sign("vp1", past)))
+	if err := s.Verify(expired, "vp1"); err == nil {
+		t.Error("Expected the expired token to be refused")
+	}
+}
+
+func TestSessionTokenRevoke(t *testing.T) {
+	s, _ := NewSessionTokenStore(time.Hour)
+	first, other := s.Issue("vp1"), s.Issue("vp2")
+	// Tokens issued to a peer within the same second are the same
+	s.expiry = 2 * time.Hour
+	second := s.Issue("vp1")
+	s.Revoke(first)
+	if err := s.Verify(first, "vp1"); err == nil {
+		t.Error("Expected the revoked token to be refused")
+	}
+	if err := s.Verify(second, "vp1"); err != nil {
+		t.Errorf("Expected the other token to stay valid: %s", err)
+	}
+	s.RevokePeer("vp1")
+	if err := s.Verify(second, "vp1"); err == nil {
+		t.Error("Expected the tokens of the revoked peer to be refused")
+	}
+	if err := s.Verify(other, "vp2"); err != nil {
+		t.Errorf("Expected the tokens of other peers to stay valid: %s", err)
+	}
+}
+
+func TestSessionTokenHeld(t *testing.T) {
+	s, _ := NewSessionTokenStore(time.Hour)
+	s.Hold("10.0.0.1:7051", "token")
+	if held := s.Held("10.0.0.1:7051"); held != "token" {
+		t.Fatalf("Expected the held token, got %q", held)
+	}
+	s.Forget("10.0.0.1:7051")
+	if held := s.Held("10.0.0.1:7051"); held != "" {
+		t.Fatalf("Expected the token to be forgotten, got %q", held)
+	}
+	var none *SessionTokenStore
+	none.Hold("10.0.0.1:7051", "token")
+	if none.Held("10.0.0.1:7051") != "" || none.Issue("vp1") != "" || none.Verify("token", "vp1") == nil {
+		t.Error("Expected a nil store to issue and hold no token")
+	}
+}
+
+func TestSessionCoordinator(t *testing.T) {
+	p := &PeerImpl{}
+	if coord := sessionCoordinator(withSessionToken(context.Background(), ""), p); coord != p {
+		t.Fatalf("Expected the peer to coordinate a Chat without session token, got %v", coord)
+	}
+	coord, ok := sessionCoordinator(withSessionToken(context.Background(), "token"), p).(*resumingCoordinator)
+	if !ok || coord.token != "token" || coord.MessageHandlerCoordinator != p {
+		t.Fatalf("Expected a coordinator presenting the token, got %v", coord)
+	}
+}
@@ -0,0 +1,183 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// SLASample records whether a peer was reachable from a point in time on
+type SLASample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Up        bool      `json:"up"`
+}
+
+// slaSeries is a fixed size ring buffer of samples, oldest first from start
+type slaSeries struct {
+	samples []SLASample
+	start   int
+	size    int
+}
+
+func (s *slaSeries) add(sample SLASample) {
+	if s.size < len(s.samples) {
+		s.samples[(s.start+s.size)%len(s.samples)] = sample
+		s.size++
+		return
+	}
+	s.samples[s.start] = sample
+	s.start = (s.start + 1) % len(s.samples)
+}
+
+func (s *slaSeries) at(i int) SLASample {
+	return s.samples[(s.start+i)%len(s.samples)]
+}
+
+// SLATracker keeps a rolling series of up/down transitions per peer address,
+// from which the availability of the peer over a time window is computed.
+type SLATracker struct {
+	sync.Mutex
+	maxSamples int
+	series     map[string]*slaSeries
+}
+
+// NewSLATracker returns a tracker keeping at most maxSamples samples per peer
+func NewSLATracker(maxSamples int) *SLATracker {
+	return &SLATracker{maxSamples: maxSamples, series: make(map[string]*slaSeries)}
+}
+
+// newSLATrackerFromConfig builds a tracker from the peer.sla settings and loads
+// the samples persisted by a previous run
+func newSLATrackerFromConfig() *SLATracker {
+	tracker := NewSLATracker(viper.GetInt("peer.sla.maxSamples"))
+	if err := tracker.Load(getSLAFilePath()); err != nil {
+		peerLogger.Warningf("Error loading peer availability data: %s", err)
+	}
+	return tracker
+}
+
+func getSLAFilePath() string {
+	return filepath.Join(viper.GetString("peer.fileSystemPath"), viper.GetString("peer.sla.file"))
+}
+
+// Record notes that the peer at address became reachable or unreachable now
+func (t *SLATracker) Record(address string, up bool) {
+	t.record(address, SLASample{Timestamp: time.Now(), Up: up})
+}
+
+func (t *SLATracker) record(address string, sample SLASample) {
+	if t.maxSamples <= 0 {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	series, ok := t.series[address]
+	if !ok {
+		series = &slaSeries{samples: make([]SLASample, t.maxSamples)}
+		t.series[address] = series
+	}
+	series.add(sample)
+}
+
+// Uptime returns the fraction of the window up to now during which the peer
+// at address was reachable. Time before the first sample is not counted, and
+// 0 is returned for a peer without samples.
+func (t *SLATracker) Uptime(address string, window time.Duration) float64 {
+	return t.uptime(address, window, time.Now())
+}
+
+func (t *SLATracker) uptime(address string, window time.Duration, now time.Time) float64 {
+	t.Lock()
+	defer t.Unlock()
+	series, ok := t.series[address]
+	if !ok || series.size == 0 {
+		return 0
+	}
+	from := now.Add(-window)
+	var observed, up time.Duration
+	for i := 0; i < series.size; i++ {
+		sample := series.at(i)
+		start, end := sample.Timestamp, now
+		if i+1 < series.size {
+			end = series.at(i + 1).Timestamp
+		}
+		if start.Before(from) {
+			start = from
+		}
+		if !end.After(start) {
+			continue
+		}
+		observed += end.Sub(start)
+		if sample.Up {
+			up += end.Sub(start)
+		}
+	}
+	if observed == 0 {
+		return 0
+	}
+	return float64(up) / float64(observed)
+}
+
+// Save writes the samples of all peers to the file at path
+func (t *SLATracker) Save(path string) error {
+	t.Lock()
+	all := make(map[string][]SLASample, len(t.series))
+	for address, series := range t.series {
+		samples := make([]SLASample, series.size)
+		for i := range samples {
+			samples[i] = series.at(i)
+		}
+		all[address] = samples
+	}
+	t.Unlock()
+	data, err := json.Marshal(all)
+	if err != nil {
+		return fmt.Errorf("Error marshalling availability samples: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("Error creating directory for %s: %s", path, err)
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// Load adds the samples saved to the file at path, a missing file is not an error
+func (t *SLATracker) Load(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	all := make(map[string][]SLASample)
+	if err := json.Unmarshal(data, &all); err != nil {
+		return fmt.Errorf("Error unmarshalling availability samples from %s: %s", path, err)
+	}
+	for address, samples := range all {
+		for _, sample := range samples {
+			t.record(address, sample)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSLATrackerUptime(t *testing.T) {
+	now := time.Now()
+	tracker := NewSLATracker(10)
+	tracker.record("vp1", SLASample{Timestamp: now.Add(-4 * time.Hour), Up: true})
+	tracker.record("vp1", SLASample{Timestamp: now.Add(-3 * time.Hour), Up: false})
+	tracker.record("vp1", SLASample{Timestamp: now.Add(-2 * time.Hour), Up: true})
+
+	if uptime := tracker.uptime("vp1", 24*time.Hour, now); uptime != 0.75 {
+		t.Errorf("Expected uptime 0.75 since the first sample, got %f", uptime)
+	}
+	if uptime := tracker.uptime("vp1", 150*time.Minute, now); uptime != 0.8 {
+		t.Errorf("Expected uptime 0.8 over the window, got %f", uptime)
+	}
+	if uptime := tracker.uptime("unknown", time.Hour, now); uptime != 0 {
+		t.Errorf("Expected uptime 0 for a peer without samples, got %f", uptime)
+	}
+}
+
+func TestSLATrackerRingBuffer(t *testing.T) {
+	now := time.Now()
+	tracker := NewSLATracker(2)
+	tracker.record("vp1", SLASample{Timestamp: now.Add(-3 * time.Hour), Up: false})
+	tracker.record("vp1", SLASample{Timestamp: now.Add(-2 * time.Hour), Up: true})
+	tracker.record("vp1", SLASample{Timestamp: now.Add(-time.Hour), Up: true})
+
+	// The oldest, down, sample has been overwritten
+	if uptime := tracker.uptime("vp1", 24*time.Hour, now); uptime != 1 {
+		t.Errorf("Expected uptime 1 once the oldest sample is dropped, got %f", uptime)
+	}
+}
+
+func TestSLATrackerSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sla")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sla.json")
+
+	now := time.Now()
+	tracker := NewSLATracker(10)
+	tracker.record("vp1", SLASample{Timestamp: now.Add(-2 * time.Hour), Up: false})
+	tracker.record("vp1", SLASample{Timestamp: now.Add(-time.Hour), Up: true})
+	if err := tracker.Save(path); err != nil {
+		t.Fatalf("Error saving samples: %s", err)
+	}
+
+	loaded := NewSLATracker(10)
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Error loading samples: %s", err)
+	}
+	if uptime := loaded.uptime("vp1", 24*time.Hour, now); uptime != 0.5 {
+		t.Errorf("Expected uptime 0.5 after reload, got %f", uptime)
+	}
+	if err := NewSLATracker(10).Load(filepath.Join(dir, "missing.json")); err != nil {
+		t.Errorf("Expected a missing file not to be an error, got %s", err)
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// PeerSorter orders the peers returned in a DISC_PEERS response
+type PeerSorter interface {
+	// Sort returns the peers in the preferred order, without modifying the supplied slice
+	Sort(local pb.PeerID, peers []*pb.PeerEndpoint) []*pb.PeerEndpoint
+}
+
+// PeerSorterAccessor interface enables a Peer to hand out the PeerSorter applied to DISC_PEERS responses
+type PeerSorterAccessor interface {
+	// GetPeerSorter returns nil if no ordering is applied
+	GetPeerSorter() PeerSorter
+}
+
+type peerEndpointSorter struct {
+	peers []*pb.PeerEndpoint
+	less  func(a, b *pb.PeerEndpoint) bool
+}
+
+func (s *peerEndpointSorter) Len() int           { return len(s.peers) }
+func (s *peerEndpointSorter) Swap(i, j int)      { s.peers[i], s.peers[j] = s.peers[j], s.peers[i] }
+func (s *peerEndpointSorter) Less(i, j int) bool { return s.less(s.peers[i], s.peers[j]) }
+
+func sortPeerEndpoints(peers []*pb.PeerEndpoint, less func(a, b *pb.PeerEndpoint) bool) []*pb.PeerEndpoint {
+	sorted := make([]*pb.PeerEndpoint, len(peers))
+	copy(sorted, peers)
+	sort.Stable(&peerEndpointSorter{peers: sorted, less: less})
+	return sorted
+}
+
+// xorDistance returns the XOR of the two IDs, the shorter one padded with zeros
+func xorDistance(a, b []byte) []byte {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	distance := make([]byte, len(a))
+	copy(distance, a)
+	for i := range b {
+		distance[i] ^= b[i]
+	}
+	return distance
+}
+
+func compareDistance(a, b []byte) int {
+	// Distances of different length compare as if zero padded to the same length
+	for len(a) < len(b) {
+		a = append(a, 0)
+	}
+	for len(b) < len(a) {
+		b = append(b, 0)
+	}
+	return bytes.Compare(a, b)
+}
+
+// ByDistance orders peers by the XOR distance of their ID to the local peer ID, closest first
+type ByDistance struct{}
+
+// Sort implements PeerSorter
+func (ByDistance) Sort(local pb.PeerID, peers []*pb.PeerEndpoint) []*pb.PeerEndpoint {
+	localID := []byte(local.Name)
+	return sortPeerEndpoints(peers, func(a, b *pb.PeerEndpoint) bool {
+		return compareDistance(xorDistance(localID, []byte(a.ID.Name)), xorDistance(localID, []byte(b.ID.Name))) < 0
+	})
+}
+
+// ByLatency orders peers by their last measured round-trip time, fastest first.
+// Peers without a measurement are placed last.
+type ByLatency struct {
+	Registry *PeerRegistry
+}
+
+// Sort implements PeerSorter
+func (s ByLatency) Sort(local pb.PeerID, peers []*pb.PeerEndpoint) []*pb.PeerEndpoint {
+	return sortPeerEndpoints(peers, func(a, b *pb.PeerEndpoint) bool {
+		entryA, okA := s.Registry.Get(a.ID)
+		entryB, okB := s.Registry.Get(b.ID)
+		measuredA := okA && entryA.LastRTT > 0
+		measuredB := okB && entryB.LastRTT > 0
+		if measuredA != measuredB {
+			return measuredA
+		}
+		return measuredA && entryA.LastRTT < entryB.LastRTT
+	})
+}
+
+// ByBandwidth orders peers by their last measured bandwidth, highest first.
+// Peers without a measurement are placed last.
+type ByBandwidth struct {
+	Registry *PeerRegistry
+}
+
+// Sort implements PeerSorter
+func (s ByBandwidth) Sort(local pb.PeerID, peers []*pb.PeerEndpoint) []*pb.PeerEndpoint {
+	return sortPeerEndpoints(peers, func(a, b *pb.PeerEndpoint) bool {
+		entryA, _ := s.Registry.Get(a.ID)
+		entryB, _ := s.Registry.Get(b.ID)
+		return entryA.BandwidthBytesPerSec > entryB.BandwidthBytesPerSec
+	})
+}
+
+// ByAge orders peers by the time they were added to the registry, longest known first.
+// Peers not in the registry are placed last.
+type ByAge struct {
+	Registry *PeerRegistry
+}
+
+// Sort implements PeerSorter
+func (s ByAge) Sort(local pb.PeerID, peers []*pb.PeerEndpoint) []*pb.PeerEndpoint {
+	return sortPeerEndpoints(peers, func(a, b *pb.PeerEndpoint) bool {
+		entryA, okA := s.Registry.Get(a.ID)
+		entryB, okB := s.Registry.Get(b.ID)
+		if okA != okB {
+			return okA
+		}
+		return okA && entryA.AddedAt.Before(entryB.AddedAt)
+	})
+}
+
+// ByGeoDistance orders peers by the distance of their coordinates to those of
+// the reference peer passed to Sort, closest first. Unlike the other sorters
+// the reference is the peer requesting DISC_GET_PEERS, not the local peer.
+// Peers without coordinates are placed last, and the order is left unchanged
+// if the reference peer has none.
+type ByGeoDistance struct {
+	Registry *PeerRegistry
+}
+
+// Sort implements PeerSorter
+func (s ByGeoDistance) Sort(reference pb.PeerID, peers []*pb.PeerEndpoint) []*pb.PeerEndpoint {
+	origin, ok := s.Registry.Get(&reference)
+	if !ok || origin.Coordinates == nil {
+		return sortPeerEndpoints(peers, func(a, b *pb.PeerEndpoint) bool { return false })
+	}
+	return sortPeerEndpoints(peers, func(a, b *pb.PeerEndpoint) bool {
+		entryA, _ := s.Registry.Get(a.ID)
+		entryB, _ := s.Registry.Get(b.ID)
+		if (entryA.Coordinates != nil) != (entryB.Coordinates != nil) {
+			return entryA.Coordinates != nil
+		}
+		return entryA.Coordinates != nil &&
+			GeoDistance(*origin.Coordinates, *entryA.Coordinates) < GeoDistance(*origin.Coordinates, *entryB.Coordinates)
+	})
+}
+
+// ByLoad orders peers by the load score they advertised, least loaded first.
+// Peers which advertised no load are considered idle.
+type ByLoad struct {
+	Registry *PeerRegistry
+}
+
+// Sort implements PeerSorter
+func (s ByLoad) Sort(local pb.PeerID, peers []*pb.PeerEndpoint) []*pb.PeerEndpoint {
+	return sortPeerEndpoints(peers, func(a, b *pb.PeerEndpoint) bool {
+		entryA, _ := s.Registry.Get(a.ID)
+		entryB, _ := s.Registry.Get(b.ID)
+		return entryA.LoadScore < entryB.LoadScore
+	})
+}
+
+// newPeerSorterFromConfig returns the PeerSorter named by peer.discovery.peerOrder,
+// nil if no ordering is configured
+func newPeerSorterFromConfig(registry *PeerRegistry) (PeerSorter, error) {
+	switch order := viper.GetString("peer.discovery.peerOrder"); order {
+	case "":
+		return nil, nil
+	case "distance":
+		return ByDistance{}, nil
+	case "latency":
+		return ByLatency{Registry: registry}, nil
+	case "age":
+		return ByAge{Registry: registry}, nil
+	case "geo":
+		return ByGeoDistance{Registry: registry}, nil
+	case "load":
+		return ByLoad{Registry: registry}, nil
+	default:
+		return nil, fmt.Errorf("Unknown peer.discovery.peerOrder: %s", order)
+	}
+}
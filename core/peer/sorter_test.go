@@ -0,0 +1,183 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func newTestEndpoints(names ...string) []*pb.PeerEndpoint {
+	peers := make([]*pb.PeerEndpoint, len(names))
+	for i, name := range names {
+		peers[i] = &pb.PeerEndpoint{ID: &pb.PeerID{Name: name}, Address: name + ":30303"}
+	}
+	return peers
+}
+
+func endpointNames(peers []*pb.PeerEndpoint) []string {
+	names := make([]string, len(peers))
+	for i, peer := range peers {
+		names[i] = peer.ID.Name
+	}
+	return names
+}
+
+func TestByDistance(t *testing.T) {
+	peers := newTestEndpoints("\x0f", "\x01", "\x08", "\x00\x01")
+	sorted := ByDistance{}.Sort(pb.PeerID{Name: "\x00"}, peers)
+	expected := []string{"\x00\x01", "\x01", "\x08", "\x0f"}
+	if names := endpointNames(sorted); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %q, got %q", expected, names)
+	}
+	if names := endpointNames(peers); !reflect.DeepEqual(names, []string{"\x0f", "\x01", "\x08", "\x00\x01"}) {
+		t.Errorf("Expected the supplied peers not to be modified, got %q", names)
+	}
+}
+
+func TestByLatency(t *testing.T) {
+	registry := NewPeerRegistry()
+	peers := newTestEndpoints("slow", "unmeasured", "fast", "unknown")
+	for _, peer := range peers[:3] {
+		registry.Add(peer)
+	}
+	registry.UpdateRTT(peers[0].ID, 50*time.Millisecond)
+	registry.UpdateRTT(peers[2].ID, 5*time.Millisecond)
+
+	sorted := ByLatency{Registry: registry}.Sort(pb.PeerID{Name: "local"}, peers)
+	expected := []string{"fast", "slow", "unmeasured", "unknown"}
+	if names := endpointNames(sorted); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+}
+
+func TestByAge(t *testing.T) {
+	registry := NewPeerRegistry()
+	peers := newTestEndpoints("new", "unknown", "old")
+	registry.Add(peers[2])
+	time.Sleep(time.Millisecond)
+	registry.Add(peers[0])
+
+	sorted := ByAge{Registry: registry}.Sort(pb.PeerID{Name: "local"}, peers)
+	expected := []string{"old", "new", "unknown"}
+	if names := endpointNames(sorted); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+}
+
+func TestPeerRegistryKeepsAddedAt(t *testing.T) {
+	registry := NewPeerRegistry()
+	peer := newTestEndpoints("vp0")[0]
+	registry.Add(peer)
+	first, _ := registry.Get(peer.ID)
+	time.Sleep(time.Millisecond)
+	registry.Add(peer)
+	second, ok := registry.Get(peer.ID)
+	if !ok || !second.AddedAt.Equal(first.AddedAt) {
+		t.Error("Expected re-adding a peer to keep its original AddedAt")
+	}
+	registry.Remove(peer.ID)
+	if _, ok := registry.Get(peer.ID); ok {
+		t.Error("Expected peer to be removed from the registry")
+	}
+}
+
+func TestPeerRegistryQueryByAttribute(t *testing.T) {
+	registry := NewPeerRegistry()
+	peers := newTestEndpoints("vp0", "vp1", "vp2")
+	for _, peer := range peers {
+		registry.Add(peer)
+	}
+	registry.SetAttributes(peers[0].ID, map[string]string{"datacenter": "dc1", "rack": "r1"})
+	registry.SetAttributes(peers[1].ID, map[string]string{"datacenter": "dc2"})
+	registry.SetAttributes(peers[2].ID, map[string]string{"datacenter": "dc1"})
+
+	found := endpointNames(registry.QueryByAttribute("datacenter", "dc1"))
+	sort.Strings(found)
+	if !reflect.DeepEqual(found, []string{"vp0", "vp2"}) {
+		t.Errorf("Expected vp0 and vp2 in dc1, got %v", found)
+	}
+	if found := registry.QueryByAttribute("rack", "r2"); len(found) != 0 {
+		t.Errorf("Expected no peers in rack r2, got %v", endpointNames(found))
+	}
+}
+
+func TestGeoDistance(t *testing.T) {
+	zurich := pb.GeoCoordinates{Lat: 47.3769, Lon: 8.5417}
+	london := pb.GeoCoordinates{Lat: 51.5074, Lon: -0.1278}
+	if d := GeoDistance(zurich, london); d < 770 || d > 790 {
+		t.Errorf("Expected Zurich to London to be about 780km, got %fkm", d)
+	}
+	if d := GeoDistance(zurich, zurich); d != 0 {
+		t.Errorf("Expected a distance of 0 to the same location, got %f", d)
+	}
+}
+
+func TestByGeoDistance(t *testing.T) {
+	registry := NewPeerRegistry()
+	peers := newTestEndpoints("london", "nowhere", "milan", "sydney")
+	requester := newTestEndpoints("zurich")[0]
+	for _, peer := range append(peers, requester) {
+		registry.Add(peer)
+	}
+	registry.SetCoordinates(requester.ID, &pb.GeoCoordinates{Lat: 47.3769, Lon: 8.5417})
+	registry.SetCoordinates(peers[0].ID, &pb.GeoCoordinates{Lat: 51.5074, Lon: -0.1278})
+	registry.SetCoordinates(peers[2].ID, &pb.GeoCoordinates{Lat: 45.4642, Lon: 9.19})
+	registry.SetCoordinates(peers[3].ID, &pb.GeoCoordinates{Lat: -33.8688, Lon: 151.2093})
+
+	sorted := ByGeoDistance{Registry: registry}.Sort(*requester.ID, peers)
+	expected := []string{"milan", "london", "sydney", "nowhere"}
+	if names := endpointNames(sorted); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+
+	// A requester without coordinates leaves the order unchanged
+	sorted = ByGeoDistance{Registry: registry}.Sort(*peers[1].ID, peers)
+	if names, expected := endpointNames(sorted), endpointNames(peers); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+}
+
+func TestByLoadAndAvoidOverloaded(t *testing.T) {
+	defer viper.Set("peer.load.avoidThreshold", viper.GetFloat64("peer.load.avoidThreshold"))
+	viper.Set("peer.load.avoidThreshold", 0.8)
+	registry := NewPeerRegistry()
+	peers := newTestEndpoints("busy", "idle", "unknown", "saturated")
+	for i, score := range []float32{0.8, 0.2, 0, 1} {
+		if peers[i].ID.Name != "unknown" {
+			registry.Add(peers[i])
+			registry.SetLoadScore(peers[i].ID, score)
+		}
+	}
+
+	sorted := ByLoad{Registry: registry}.Sort(pb.PeerID{Name: "local"}, peers)
+	expected := []string{"unknown", "idle", "busy", "saturated"}
+	if names := endpointNames(sorted); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+	sorted = avoidOverloaded(registry, peers)
+	expected = []string{"idle", "unknown", "busy", "saturated"}
+	if names := endpointNames(sorted); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected the overloaded peers last, got %v", names)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/hyperledger/fabric/core/crypto/primitives"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// spvProofSigningBytes returns the bytes an SPV proof signature is computed over
+func spvProofSigningBytes(proof *pb.SPVProof) ([]byte, error) {
+	unsigned := *proof
+	unsigned.Signature = nil
+	return proto.Marshal(&unsigned)
+}
+
+// newSPVProof builds the proof of the last of blocks, the blocks from the
+// genesis block on, and signs it with sign
+func newSPVProof(blocks []*pb.Block, externalChainID string, sign func(msg []byte) ([]byte, error)) (*pb.SPVProof, error) {
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("No blocks to build an SPV proof over")
+	}
+	blockNumber := uint64(len(blocks) - 1)
+	header, err := newBlockHeader(blockNumber, blocks[blockNumber])
+	if err != nil {
+		return nil, err
+	}
+	levels, err := blockAuditTree(blocks)
+	if err != nil {
+		return nil, err
+	}
+	proof := &pb.SPVProof{
+		Header:          header,
+		MerklePath:      merkleProof(levels, blockNumber),
+		GenesisPath:     merkleProof(levels, 0),
+		Root:            levels[len(levels)-1][0],
+		ExternalChainID: externalChainID,
+	}
+	data, err := spvProofSigningBytes(proof)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling SPV proof of block %d: %s", blockNumber, err)
+	}
+	if proof.Signature, err = sign(data); err != nil {
+		return nil, fmt.Errorf("Error signing SPV proof of block %d: %s", blockNumber, err)
+	}
+	return proof, nil
+}
+
+// VerifySPVProof returns true if the proof was signed by the holder of the
+// private key matching peerPubKey and leads from the header of the proof and
+// from the genesis block of hash genesisHash to the same merkle root
+func VerifySPVProof(proof *pb.SPVProof, genesisHash []byte, peerPubKey *ecdsa.PublicKey) bool {
+	if proof == nil || proof.Header == nil || len(proof.MerklePath) != len(proof.GenesisPath) {
+		return false
+	}
+	data, err := spvProofSigningBytes(proof)
+	if err != nil {
+		return false
+	}
+	if ok, err := primitives.ECDSAVerify(peerPubKey, data, proof.Signature); err != nil || !ok {
+		return false
+	}
+	root := merkleRootFromProofWith(sha256Sum(proof.Header.Hash), proof.Header.BlockNumber, proof.MerklePath, sha256MerkleParent)
+	if !bytes.Equal(root, proof.Root) {
+		return false
+	}
+	return bytes.Equal(merkleRootFromProofWith(sha256Sum(genesisHash), 0, proof.GenesisPath, sha256MerkleParent), proof.Root)
+}
+
+// GetSPVProof returns the signed proof that block blockNumber descends from
+// the genesis block of the chain of this peer. Every block up to blockNumber
+// is read to build it.
+func (p *PeerImpl) GetSPVProof(blockNumber uint64, externalChainID string) (*pb.SPVProof, error) {
+	if p.secHelper == nil {
+		return nil, fmt.Errorf("SPV proofs require security to be enabled")
+	}
+	if height := p.GetBlockchainSize(); blockNumber >= height {
+		return nil, fmt.Errorf("Block %d is past the end of the chain of %d blocks", blockNumber, height)
+	}
+	blocks := make([]*pb.Block, blockNumber+1)
+	for i := range blocks {
+		block, err := p.GetBlockByNumber(uint64(i))
+		if err != nil {
+			return nil, fmt.Errorf("Error getting block %d: %s", i, err)
+		}
+		blocks[i] = block
+	}
+	return newSPVProof(blocks, externalChainID, p.secHelper.Sign)
+}
+
+// FetchSPVProofFromPeer asks the peer at address for the proof of block
+// blockNumber, to be anchored into the chain externalChainID
+func FetchSPVProofFromPeer(address string, blockNumber uint64, externalChainID string) (*pb.SPVProof, error) {
+	data, err := proto.Marshal(&pb.GetBlockProof{BlockNumber: blockNumber, ExternalChainID: externalChainID})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling GetBlockProof: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_GET_BLOCK_PROOF, Payload: data}
+	reply, err := requestOverChat(address, request, pb.Message_CHAIN_BLOCK_PROOF)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting proof of block %d from %s: %s", blockNumber, address, err)
+	}
+	blockProof := &pb.BlockProof{}
+	if err := proto.Unmarshal(reply.Payload, blockProof); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling BlockProof: %s", err)
+	}
+	if blockProof.Proof == nil || blockProof.BlockNumber != blockNumber {
+		return nil, fmt.Errorf("%s from %s is not the proof of block %d", pb.Message_CHAIN_BLOCK_PROOF, address, blockNumber)
+	}
+	return blockProof.Proof, nil
+}
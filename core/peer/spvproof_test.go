@@ -0,0 +1,79 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/core/crypto/primitives"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestVerifySPVProof(t *testing.T) {
+	primitives.SetSecurityLevel("SHA3", 256)
+	key, err := primitives.NewECDSAKey()
+	if err != nil {
+		t.Fatalf("Error generating key: %s", err)
+	}
+	sign := func(msg []byte) ([]byte, error) { return primitives.ECDSASign(key, msg) }
+	var blocks []*pb.Block
+	for i := 0; i < 6; i++ {
+		blocks = append(blocks, &pb.Block{PreviousBlockHash: []byte(fmt.Sprint(i))})
+	}
+	genesisHash, _ := blocks[0].GetHash()
+	for n := 1; n <= len(blocks); n++ {
+		proof, err := newSPVProof(blocks[:n], "anchor", sign)
+		if err != nil {
+			t.Fatalf("Error building SPV proof of block %d: %s", n-1, err)
+		}
+		if proof.Header.BlockNumber != uint64(n-1) {
+			t.Errorf("Expected the header of block %d, got block %d", n-1, proof.Header.BlockNumber)
+		}
+		if !VerifySPVProof(proof, genesisHash, &key.PublicKey) {
+			t.Errorf("Expected the SPV proof of block %d to verify", n-1)
+		}
+	}
+
+	proof, _ := newSPVProof(blocks, "anchor", sign)
+	otherGenesisHash, _ := (&pb.Block{PreviousBlockHash: []byte("other")}).GetHash()
+	if VerifySPVProof(proof, otherGenesisHash, &key.PublicKey) {
+		t.Error("Expected the proof not to verify against another genesis block")
+	}
+	other, _ := primitives.NewECDSAKey()
+	if VerifySPVProof(proof, genesisHash, &other.PublicKey) {
+		t.Error("Expected the proof not to verify with the key of another peer")
+	}
+	proof.ExternalChainID = "replayed"
+	if VerifySPVProof(proof, genesisHash, &key.PublicKey) {
+		t.Error("Expected a proof anchored into another chain not to verify")
+	}
+	if _, err := newSPVProof(nil, "anchor", sign); err == nil {
+		t.Error("Expected an error without blocks")
+	}
+}
+
+func TestFetchSPVProofWithoutSecurity(t *testing.T) {
+	if SecurityEnabled() {
+		t.Skip("Security is enabled")
+	}
+	if _, err := FetchSPVProofFromPeer(viper.GetString("peer.address"), 0, "anchor"); err == nil {
+		t.Error("Expected an error response when the peer cannot sign proofs")
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"math"
+	"time"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+const (
+	// stabilityUptimeScale is the uptime at which the uptime part of a StabilityScore reaches 1-1/e
+	stabilityUptimeScale = time.Hour
+	// stabilityWindow is the window over which the availability of a peer is measured for its StabilityScore
+	stabilityWindow = 24 * time.Hour
+)
+
+// StabilityScore rates how stable the peer of the registry entry is, between
+// 0 and 1, from the uptime it advertised in DISC_HELLO and its availability,
+// the fraction of time it was found reachable. Recently restarted peers and
+// peers without an advertised uptime score low.
+func StabilityScore(entry *PeerRegistryEntry, availability float64) float64 {
+	if entry.StartedAt.IsZero() {
+		return 0
+	}
+	uptime := time.Since(entry.StartedAt)
+	return (1 - math.Exp(-float64(uptime)/float64(stabilityUptimeScale))) * availability
+}
+
+// byStability orders the peers by a mix of their StabilityScore, with the
+// given weight, and of their bandwidth relative to the best one, with the
+// rest. The order is kept between peers scoring the same.
+func byStability(registry *PeerRegistry, sla *SLATracker, weight float64, peers []*pb.PeerEndpoint) []*pb.PeerEndpoint {
+	entries := make(map[pb.PeerID]PeerRegistryEntry, len(peers))
+	var maxBandwidth float64
+	for _, peer := range peers {
+		entry, _ := registry.Get(peer.ID)
+		entries[*peer.ID] = entry
+		maxBandwidth = math.Max(maxBandwidth, entry.BandwidthBytesPerSec)
+	}
+	scores := make(map[pb.PeerID]float64, len(peers))
+	for id, entry := range entries {
+		var bandwidth float64
+		if maxBandwidth > 0 {
+			bandwidth = entry.BandwidthBytesPerSec / maxBandwidth
+		}
+		var stability float64
+		if entry.Endpoint != nil {
+			stability = StabilityScore(&entry, sla.Uptime(entry.Endpoint.Address, stabilityWindow))
+		}
+		scores[id] = weight*stability + (1-weight)*bandwidth
+	}
+	return sortPeerEndpoints(peers, func(a, b *pb.PeerEndpoint) bool {
+		return scores[*a.ID] > scores[*b.ID]
+	})
+}
@@ -0,0 +1,95 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// StakingLedger holds the stakes of the validators of a proof-of-stake
+// network, kept by its consensus plugin
+type StakingLedger interface {
+	GetStakingInfo(validatorAddress string) (*pb.StakingInfo, error)
+}
+
+// isProofOfStake returns whether peer.consensus.type is pos, the peer then
+// answering the staking queries
+func isProofOfStake() bool {
+	return strings.EqualFold(viper.GetString("peer.consensus.type"), "pos")
+}
+
+// SetStakingLedger sets the StakingLedger answering CHAIN_QUERY_STAKING_INFO
+// messages. nil, the default, fails them.
+func (p *PeerImpl) SetStakingLedger(stakes StakingLedger) {
+	p.optionsMutex.Lock()
+	defer p.optionsMutex.Unlock()
+	p.stakes = stakes
+}
+
+// GetStakingInfo returns the stake of the validator at validatorAddress
+func (p *PeerImpl) GetStakingInfo(validatorAddress string) (*pb.StakingInfo, error) {
+	if validatorAddress == "" {
+		return nil, fmt.Errorf("No validator address given")
+	}
+	p.optionsMutex.RLock()
+	stakes := p.stakes
+	p.optionsMutex.RUnlock()
+	if stakes == nil {
+		return nil, fmt.Errorf("No staking ledger set on this peer")
+	}
+	return stakes.GetStakingInfo(validatorAddress)
+}
+
+// handleUnsupportedQuery answers msg with a CHAIN_QUERY_UNSUPPORTED, for the
+// queries of a consensus type the network does not run
+func handleUnsupportedQuery(handler MessageHandler, msg *pb.Message) error {
+	data, err := proto.Marshal(&pb.QueryUnsupported{Type: msg.Type, Reason: fmt.Sprintf("peer.consensus.type is %q", viper.GetString("peer.consensus.type"))})
+	if err != nil {
+		return fmt.Errorf("Error marshalling QueryUnsupported: %s", err)
+	}
+	return handler.SendMessage(&pb.Message{Type: pb.Message_CHAIN_QUERY_UNSUPPORTED, Payload: data, CorrelationID: msg.CorrelationID})
+}
+
+// FetchStakingInfo asks the peer at address for the stake of the validator at
+// validatorAddress. A *QueryUnsupportedError is returned if the peer is not
+// part of a proof-of-stake network.
+func FetchStakingInfo(address, validatorAddress string) (*pb.StakingInfo, error) {
+	data, err := proto.Marshal(&pb.QueryStakingInfo{ValidatorAddress: validatorAddress})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling QueryStakingInfo: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_QUERY_STAKING_INFO, Payload: data}
+	reply, err := requestOverChat(address, request, pb.Message_CHAIN_STAKING_INFO_RESPONSE)
+	if err != nil {
+		if unsupported, ok := err.(*QueryUnsupportedError); ok {
+			unsupported.Address = address
+			return nil, unsupported
+		}
+		return nil, fmt.Errorf("Error querying the stake of %s from %s: %s", validatorAddress, address, err)
+	}
+	info := &pb.StakingInfo{}
+	if err := proto.Unmarshal(reply.Payload, info); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling StakingInfo: %s", err)
+	}
+	return info, nil
+}
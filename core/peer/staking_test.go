@@ -0,0 +1,98 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+type testStakingLedger map[string]*pb.StakingInfo
+
+func (l testStakingLedger) GetStakingInfo(validatorAddress string) (*pb.StakingInfo, error) {
+	info, ok := l[validatorAddress]
+	if !ok {
+		return nil, fmt.Errorf("Unknown validator %s", validatorAddress)
+	}
+	return info, nil
+}
+
+func TestGetStakingInfo(t *testing.T) {
+	p := &PeerImpl{}
+	if _, err := p.GetStakingInfo("v1"); err == nil {
+		t.Fatal("Expected an error without a staking ledger")
+	}
+	p.SetStakingLedger(testStakingLedger{"v1": {ValidatorAddress: "v1", StakedAmount: 100, Commission: 0.05, IsActive: true,
+		SlashingEvents: []*pb.SlashingEvent{{BlockNumber: 7, Amount: 10, Reason: "double signing"}}}})
+	info, err := p.GetStakingInfo("v1")
+	if err != nil || info.StakedAmount != 100 || !info.IsActive || len(info.SlashingEvents) != 1 {
+		t.Fatalf("Expected the stake of v1, got %v, %v", info, err)
+	}
+	if _, err := p.GetStakingInfo("v2"); err == nil {
+		t.Error("Expected an error for an unknown validator")
+	}
+}
+
+func TestStakingInfoRoutedOnlyForProofOfStake(t *testing.T) {
+	defer viper.Set("peer.consensus.type", "")
+	request := &pb.Message{Type: pb.Message_CHAIN_QUERY_STAKING_INFO, CorrelationID: "3"}
+
+	viper.Set("peer.consensus.type", "pbft")
+	h := &recordingHandler{}
+	if err := newDefaultMessageRouter().Dispatch(h, request); err != nil {
+		t.Fatalf("Error dispatching %s: %s", request.Type, err)
+	}
+	if len(h.sent) != 1 || h.sent[0].Type != pb.Message_CHAIN_QUERY_UNSUPPORTED || h.sent[0].CorrelationID != "3" {
+		t.Fatalf("Expected a CHAIN_QUERY_UNSUPPORTED reply, got %v", h.sent)
+	}
+	unsupported := &pb.QueryUnsupported{}
+	if err := proto.Unmarshal(h.sent[0].Payload, unsupported); err != nil || unsupported.Type != request.Type {
+		t.Fatalf("Expected the unsupported query type, got %v, %v", unsupported, err)
+	}
+
+	viper.Set("peer.consensus.type", "PoS")
+	routed := &routerTestHandler{}
+	if err := newDefaultMessageRouter().Dispatch(routed, request); err != nil {
+		t.Fatalf("Error dispatching %s: %s", request.Type, err)
+	}
+	if len(routed.handled) != 1 || routed.handled[0] != request.Type {
+		t.Fatalf("Expected %s to reach the handler, got %v", request.Type, routed.handled)
+	}
+}
+
+func TestReceiveReplyQueryUnsupported(t *testing.T) {
+	stream := &handshakeStream{recv: make(chan *pb.Message, 1), sent: make(chan *pb.Message, 1)}
+	data, _ := proto.Marshal(&pb.QueryUnsupported{Type: pb.Message_CHAIN_QUERY_STAKING_INFO, Reason: "not pos"})
+	stream.recv <- &pb.Message{Type: pb.Message_CHAIN_QUERY_UNSUPPORTED, Payload: data}
+	_, err := requestOverStream(stream, &pb.Message{Type: pb.Message_CHAIN_QUERY_STAKING_INFO}, pb.Message_CHAIN_STAKING_INFO_RESPONSE)
+	if unsupported, ok := err.(*QueryUnsupportedError); !ok || unsupported.Reason != "not pos" {
+		t.Fatalf("Expected a *QueryUnsupportedError, got %v", err)
+	}
+}
+
+func TestFetchStakingInfoUnsupported(t *testing.T) {
+	address := viper.GetString("peer.address")
+	_, err := FetchStakingInfo(address, "v1")
+	if unsupported, ok := err.(*QueryUnsupportedError); !ok || unsupported.Address != address {
+		t.Fatalf("Expected the peer outside of a proof-of-stake network to answer CHAIN_QUERY_UNSUPPORTED, got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// stateChanges returns the changes of the delta sorted by chaincode ID and key
+func stateChanges(delta *statemgmt.StateDelta) []*pb.StateChange {
+	var changes []*pb.StateChange
+	for _, chaincodeID := range delta.GetUpdatedChaincodeIds(true) {
+		updates := delta.GetUpdates(chaincodeID)
+		keys := make([]string, 0, len(updates))
+		for key := range updates {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := updates[key]
+			changes = append(changes, &pb.StateChange{
+				ChaincodeID: chaincodeID,
+				Key:         key,
+				OldValue:    value.GetPreviousValue(),
+				NewValue:    value.GetValue(),
+				Deleted:     value.IsDelete(),
+			})
+		}
+	}
+	return changes
+}
+
+// stateDiffFragments splits the changes of block blockNumber into responses
+// of at most maxBytes of changes each, a change larger than maxBytes being
+// sent alone. A maxBytes of 0 sends a single response.
+func stateDiffFragments(blockNumber uint64, changes []*pb.StateChange, maxBytes int) []*pb.StateDiffResponse {
+	fragments := []*pb.StateDiffResponse{{BlockNumber: blockNumber}}
+	size := 0
+	for _, change := range changes {
+		fragment := fragments[len(fragments)-1]
+		changeSize := proto.Size(change)
+		if maxBytes > 0 && len(fragment.Changes) > 0 && size+changeSize > maxBytes {
+			fragment.More = true
+			fragment = &pb.StateDiffResponse{BlockNumber: blockNumber}
+			fragments = append(fragments, fragment)
+			size = 0
+		}
+		fragment.Changes = append(fragment.Changes, change)
+		size += changeSize
+	}
+	return fragments
+}
+
+// queryFragmentSize returns the most bytes of changes sent in a
+// CHAIN_STATE_DIFF_RESPONSE, and of value in a CHAIN_CONTRACT_STATE_RESPONSE,
+// peer.query.maxFragmentBytes
+func queryFragmentSize() int {
+	return viper.GetInt("peer.query.maxFragmentBytes")
+}
+
+// GetStateDiff returns the state changes made by block blockNumber, sorted by
+// chaincode ID and key
+func (p *PeerImpl) GetStateDiff(blockNumber uint64) ([]*pb.StateChange, error) {
+	delta, err := p.GetStateDelta(blockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting state delta of block %d: %s", blockNumber, err)
+	}
+	if delta == nil {
+		return nil, fmt.Errorf("State delta of block %d is no longer available", blockNumber)
+	}
+	return stateChanges(delta), nil
+}
+
+// FetchStateDiff asks the peer at address for the state changes made by block
+// blockNum, gathering the fragments of its CHAIN_STATE_DIFF_RESPONSE
+func FetchStateDiff(address string, blockNum uint64) (changes []*pb.StateChange, err error) {
+	err = withRequestStream(address, func(stream ChatStream) error {
+		changes, err = fetchStateDiffOverStream(stream, blockNum)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching state diff of block %d from %s: %s", blockNum, address, err)
+	}
+	return changes, nil
+}
+
+func fetchStateDiffOverStream(stream ChatStream, blockNum uint64) ([]*pb.StateChange, error) {
+	data, err := proto.Marshal(&pb.QueryStateDiff{BlockNumber: blockNum})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling QueryStateDiff: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_QUERY_STATE_DIFF, Payload: data}
+	reply, err := requestOverStream(stream, request, pb.Message_CHAIN_STATE_DIFF_RESPONSE)
+	var changes []*pb.StateChange
+	for err == nil {
+		fragment := &pb.StateDiffResponse{}
+		if err := proto.Unmarshal(reply.Payload, fragment); err != nil {
+			return nil, fmt.Errorf("Error unmarshalling StateDiffResponse: %s", err)
+		}
+		if fragment.BlockNumber != blockNum {
+			return nil, fmt.Errorf("%s is the diff of block %d instead of %d", pb.Message_CHAIN_STATE_DIFF_RESPONSE, fragment.BlockNumber, blockNum)
+		}
+		changes = append(changes, fragment.Changes...)
+		if !fragment.More {
+			return changes, nil
+		}
+		reply, err = receiveReply(stream, request.Type, pb.Message_CHAIN_STATE_DIFF_RESPONSE)
+	}
+	return nil, err
+}
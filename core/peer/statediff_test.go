@@ -0,0 +1,130 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestStateChanges(t *testing.T) {
+	delta := statemgmt.NewStateDelta()
+	delta.Set("mycc", "b", []byte("b2"), []byte("b1"))
+	delta.Set("mycc", "a", []byte("a1"), nil)
+	delta.Delete("acc", "x", []byte("x1"))
+
+	changes := stateChanges(delta)
+	if len(changes) != 3 {
+		t.Fatalf("Expected 3 changes, got %d", len(changes))
+	}
+	expected := []*pb.StateChange{
+		{ChaincodeID: "acc", Key: "x", OldValue: []byte("x1"), Deleted: true},
+		{ChaincodeID: "mycc", Key: "a", NewValue: []byte("a1")},
+		{ChaincodeID: "mycc", Key: "b", OldValue: []byte("b1"), NewValue: []byte("b2")},
+	}
+	for i, change := range changes {
+		if !proto.Equal(change, expected[i]) {
+			t.Errorf("Expected change %d to be %v, got %v", i, expected[i], change)
+		}
+	}
+}
+
+func TestStateDiffFragments(t *testing.T) {
+	var changes []*pb.StateChange
+	for i := 0; i < 10; i++ {
+		changes = append(changes, &pb.StateChange{ChaincodeID: "mycc", Key: fmt.Sprintf("key%d", i), NewValue: bytes.Repeat([]byte("v"), 100)})
+	}
+	if fragments := stateDiffFragments(5, changes, 0); len(fragments) != 1 || len(fragments[0].Changes) != 10 || fragments[0].More {
+		t.Fatalf("Expected a single fragment without a limit, got %d", len(fragments))
+	}
+	if fragments := stateDiffFragments(5, nil, 100); len(fragments) != 1 || fragments[0].More {
+		t.Fatalf("Expected an empty diff to be sent as a single fragment, got %d", len(fragments))
+	}
+
+	fragments := stateDiffFragments(5, changes, 3*proto.Size(changes[0]))
+	if len(fragments) != 4 {
+		t.Fatalf("Expected 4 fragments of at most 3 changes, got %d", len(fragments))
+	}
+	total := 0
+	for i, fragment := range fragments {
+		if fragment.BlockNumber != 5 {
+			t.Errorf("Expected fragment %d to be of block 5, got %d", i, fragment.BlockNumber)
+		}
+		if fragment.More != (i < len(fragments)-1) {
+			t.Errorf("Expected more to be set on every fragment but the last, fragment %d has %t", i, fragment.More)
+		}
+		total += len(fragment.Changes)
+	}
+	if total != 10 {
+		t.Errorf("Expected the fragments to carry the 10 changes, got %d", total)
+	}
+
+	if fragments := stateDiffFragments(5, changes[:2], 10); len(fragments) != 2 {
+		t.Errorf("Expected changes larger than the limit to be sent alone, got %d fragments", len(fragments))
+	}
+}
+
+func TestFetchStateDiffFragments(t *testing.T) {
+	var changes []*pb.StateChange
+	for i := 0; i < 7; i++ {
+		changes = append(changes, &pb.StateChange{ChaincodeID: "mycc", Key: fmt.Sprintf("key%d", i), NewValue: []byte("value")})
+	}
+	stream := &handshakeStream{recv: make(chan *pb.Message, 10), sent: make(chan *pb.Message)}
+	go func() {
+		defer close(stream.recv)
+		for msg := range stream.sent {
+			query := &pb.QueryStateDiff{}
+			if err := proto.Unmarshal(msg.Payload, query); err != nil {
+				t.Errorf("Error unmarshalling QueryStateDiff: %s", err)
+				return
+			}
+			for _, fragment := range stateDiffFragments(query.BlockNumber, changes, 2*proto.Size(changes[0])) {
+				data, _ := proto.Marshal(fragment)
+				stream.recv <- &pb.Message{Type: pb.Message_CHAIN_STATE_DIFF_RESPONSE, Payload: data}
+			}
+		}
+	}()
+
+	fetched, err := fetchStateDiffOverStream(stream, 3)
+	close(stream.sent)
+	if err != nil {
+		t.Fatalf("Error fetching state diff: %s", err)
+	}
+	if len(fetched) != len(changes) {
+		t.Fatalf("Expected %d changes, got %d", len(changes), len(fetched))
+	}
+	for i, change := range fetched {
+		if !proto.Equal(change, changes[i]) {
+			t.Errorf("Expected change %d to be %v, got %v", i, changes[i], change)
+		}
+	}
+}
+
+func TestFetchStateDiffFailure(t *testing.T) {
+	stream := &handshakeStream{recv: make(chan *pb.Message, 1), sent: make(chan *pb.Message, 1)}
+	data, _ := proto.Marshal(&pb.Response{Status: pb.Response_FAILURE, Msg: []byte("State delta of block 3 is no longer available")})
+	stream.recv <- &pb.Message{Type: pb.Message_RESPONSE, Payload: data}
+	if _, err := fetchStateDiffOverStream(stream, 3); err == nil {
+		t.Error("Expected the failed RESPONSE to be returned as an error")
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// StateRootReader interface enables a Peer to answer CHAIN_GET_STATE_ROOT messages
+type StateRootReader interface {
+	GetStateRoot(blockNumber uint64) ([]byte, error)
+}
+
+// FetchStateRootFromPeer asks the peer at address for the state hash of block blockNumber
+func FetchStateRootFromPeer(address string, blockNumber uint64) ([]byte, error) {
+	data, err := proto.Marshal(&pb.GetStateRoot{BlockNumber: blockNumber})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling GetStateRoot: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_GET_STATE_ROOT, Payload: data}
+	reply, err := requestOverChat(address, request, pb.Message_CHAIN_STATE_ROOT)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting state root of block %d from %s: %s", blockNumber, address, err)
+	}
+	stateRoot := &pb.StateRoot{}
+	if err := proto.Unmarshal(reply.Payload, stateRoot); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling StateRoot: %s", err)
+	}
+	return stateRoot.Root, nil
+}
+
+// CompareStateRoots fetches the state hash of block blockNumber from each peer
+// concurrently, to detect ledger forks. It returns the roots by address and
+// whether all of them agree. If some peers could not be queried the roots of
+// the others are returned along with an error, and the roots are not
+// considered to agree.
+func CompareStateRoots(peerAddresses []string, blockNumber uint64) (map[string][]byte, bool, error) {
+	return compareStateRoots(peerAddresses, blockNumber, FetchStateRootFromPeer)
+}
+
+func compareStateRoots(peerAddresses []string, blockNumber uint64, fetch func(address string, blockNumber uint64) ([]byte, error)) (map[string][]byte, bool, error) {
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	roots := make(map[string][]byte)
+	var failures []string
+	for _, address := range peerAddresses {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+			root, err := fetch(address, blockNumber)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				failures = append(failures, err.Error())
+				return
+			}
+			roots[address] = root
+		}(address)
+	}
+	wg.Wait()
+	if len(failures) > 0 {
+		return roots, false, fmt.Errorf("Error comparing state roots of block %d: %s", blockNumber, strings.Join(failures, "; "))
+	}
+	var first []byte
+	for _, root := range roots {
+		if first == nil {
+			first = root
+		} else if !bytes.Equal(first, root) {
+			return roots, false, nil
+		}
+	}
+	return roots, true, nil
+}
@@ -0,0 +1,48 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCompareStateRoots(t *testing.T) {
+	addresses := []string{"vp0:30303", "vp1:30303", "vp2:30303"}
+	fetchFrom := func(roots map[string]string) func(string, uint64) ([]byte, error) {
+		return func(address string, blockNumber uint64) ([]byte, error) {
+			root, ok := roots[address]
+			if !ok {
+				return nil, fmt.Errorf("%s is down", address)
+			}
+			return []byte(root), nil
+		}
+	}
+
+	roots, agree, err := compareStateRoots(addresses, 3, fetchFrom(map[string]string{"vp0:30303": "a", "vp1:30303": "a", "vp2:30303": "a"}))
+	if err != nil || !agree || len(roots) != 3 {
+		t.Errorf("Expected 3 agreeing roots, got %v, %t, %v", roots, agree, err)
+	}
+	roots, agree, err = compareStateRoots(addresses, 3, fetchFrom(map[string]string{"vp0:30303": "a", "vp1:30303": "b", "vp2:30303": "a"}))
+	if err != nil || agree || string(roots["vp1:30303"]) != "b" {
+		t.Errorf("Expected the fork of vp1 to be detected, got %v, %t, %v", roots, agree, err)
+	}
+	roots, agree, err = compareStateRoots(addresses, 3, fetchFrom(map[string]string{"vp0:30303": "a", "vp1:30303": "a"}))
+	if err == nil || agree || len(roots) != 2 {
+		t.Errorf("Expected an error for the unreachable peer and the 2 other roots, got %v, %t, %v", roots, agree, err)
+	}
+}
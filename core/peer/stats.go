@@ -0,0 +1,103 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Stats is the runtime information served on the /stats endpoint
+type Stats struct {
+	ActiveChatStreams int `json:"activeChatStreams"`
+	// OutboundConnections is the number of Chat connections dialed by this peer
+	OutboundConnections int `json:"outboundConnections"`
+	// OutboundAvailable is the number of Chat connections that may still be dialed, -1 if not capped
+	OutboundAvailable int `json:"outboundAvailable"`
+}
+
+// GetStats returns the current runtime information of the peer
+func (p *PeerImpl) GetStats() *Stats {
+	stats := &Stats{ActiveChatStreams: p.watermarks.ActiveChatStreams(), OutboundAvailable: -1}
+	if p.connBudget != nil {
+		stats.OutboundConnections = p.connBudget.InUse()
+		stats.OutboundAvailable = p.connBudget.Available()
+	}
+	return stats
+}
+
+// StatsHandler returns an http.Handler serving GetStats as JSON
+func (p *PeerImpl) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.Marshal(p.GetStats())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+}
+
+// Connection is a registered peer served on the /connections endpoint
+type Connection struct {
+	ID      string    `json:"id"`
+	Address string    `json:"address"`
+	Type    string    `json:"type"`
+	AddedAt time.Time `json:"addedAt"`
+	// TTLRemaining is how long the peer is kept without a message from it, empty if kept for good
+	TTLRemaining string `json:"ttlRemaining,omitempty"`
+}
+
+// GetConnections returns the registered peers, by ID
+func (p *PeerImpl) GetConnections() []*Connection {
+	return registryConnections(p.registry, time.Now())
+}
+
+func registryConnections(registry *PeerRegistry, now time.Time) []*Connection {
+	var connections []*Connection
+	for _, entry := range registry.Entries() {
+		connection := &Connection{ID: entry.Endpoint.ID.Name, Address: entry.Endpoint.Address, Type: entry.Endpoint.Type.String(), AddedAt: entry.AddedAt}
+		if remaining, ok := entry.TTLRemaining(now); ok {
+			connection.TTLRemaining = remaining.String()
+		}
+		connections = append(connections, connection)
+	}
+	sort.Sort(connectionsByID(connections))
+	return connections
+}
+
+type connectionsByID []*Connection
+
+func (c connectionsByID) Len() int           { return len(c) }
+func (c connectionsByID) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c connectionsByID) Less(i, j int) bool { return c[i].ID < c[j].ID }
+
+// ConnectionsHandler returns an http.Handler serving GetConnections as JSON
+func (p *PeerImpl) ConnectionsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.Marshal(p.GetConnections())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+}
@@ -0,0 +1,207 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// The STUN (RFC 5389) message types and attributes STUNProbe uses
+const (
+	stunBindingRequest   = 0x0001
+	stunBindingSuccess   = 0x0101
+	stunMagicCookie      = 0x2112A442
+	stunHeaderSize       = 20
+	stunMappedAddress    = 0x0001
+	stunXorMappedAddress = 0x0020
+	stunFamilyIPv4       = 0x01
+	stunFamilyIPv6       = 0x02
+	stunTimeout          = 3 * time.Second
+	stunMaxResponseSize  = 1500
+)
+
+// STUNProbe sends a binding request to the STUN server at stunServer over UDP
+// and returns the address it mapped the request from, as host:port
+func STUNProbe(stunServer string) (string, error) {
+	conn, err := net.DialTimeout("udp", stunServer, stunTimeout)
+	if err != nil {
+		return "", fmt.Errorf("Error dialing STUN server %s: %s", stunServer, err)
+	}
+	defer conn.Close()
+	request := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(request[0:], stunBindingRequest)
+	binary.BigEndian.PutUint32(request[4:], stunMagicCookie)
+	if _, err := rand.Read(request[8:stunHeaderSize]); err != nil {
+		return "", fmt.Errorf("Error generating STUN transaction ID: %s", err)
+	}
+	conn.SetDeadline(time.Now().Add(stunTimeout))
+	if _, err := conn.Write(request); err != nil {
+		return "", fmt.Errorf("Error sending STUN binding request to %s: %s", stunServer, err)
+	}
+	response := make([]byte, stunMaxResponseSize)
+	n, err := conn.Read(response)
+	if err != nil {
+		return "", fmt.Errorf("Error reading STUN binding response from %s: %s", stunServer, err)
+	}
+	address, err := parseSTUNResponse(response[:n], request[8:stunHeaderSize])
+	if err != nil {
+		return "", fmt.Errorf("Invalid STUN binding response from %s: %s", stunServer, err)
+	}
+	return address, nil
+}
+
+// parseSTUNResponse returns the mapped address of a binding success response
+// to the request of transactionID, XOR-MAPPED-ADDRESS being preferred to
+// MAPPED-ADDRESS
+func parseSTUNResponse(response, transactionID []byte) (string, error) {
+	if len(response) < stunHeaderSize {
+		return "", fmt.Errorf("Response of %d bytes", len(response))
+	}
+	if binary.BigEndian.Uint16(response[0:]) != stunBindingSuccess {
+		return "", fmt.Errorf("Message type %#04x is not a binding success", binary.BigEndian.Uint16(response[0:]))
+	}
+	if binary.BigEndian.Uint32(response[4:]) != stunMagicCookie || !bytes.Equal(response[8:stunHeaderSize], transactionID) {
+		return "", fmt.Errorf("Response to another request")
+	}
+	length := int(binary.BigEndian.Uint16(response[2:]))
+	if stunHeaderSize+length > len(response) {
+		return "", fmt.Errorf("Attributes of %d bytes past the end of the response", length)
+	}
+	var mapped string
+	attributes := response[stunHeaderSize : stunHeaderSize+length]
+	for len(attributes) >= 4 {
+		attrType := binary.BigEndian.Uint16(attributes[0:])
+		attrLength := int(binary.BigEndian.Uint16(attributes[2:]))
+		if 4+attrLength > len(attributes) {
+			return "", fmt.Errorf("Attribute %#04x past the end of the response", attrType)
+		}
+		value := attributes[4 : 4+attrLength]
+		switch attrType {
+		case stunXorMappedAddress:
+			return decodeSTUNAddress(value, response[4:stunHeaderSize])
+		case stunMappedAddress:
+			address, err := decodeSTUNAddress(value, nil)
+			if err != nil {
+				return "", err
+			}
+			mapped = address
+		}
+		// Attributes are padded to 4 bytes
+		next := 4 + (attrLength+3)/4*4
+		if next > len(attributes) {
+			break
+		}
+		attributes = attributes[next:]
+	}
+	if mapped == "" {
+		return "", fmt.Errorf("No mapped address")
+	}
+	return mapped, nil
+}
+
+// decodeSTUNAddress decodes a MAPPED-ADDRESS value, or a XOR-MAPPED-ADDRESS
+// one xored with the magic cookie and transaction ID of key
+func decodeSTUNAddress(value, key []byte) (string, error) {
+	if len(value) < 4 {
+		return "", fmt.Errorf("Address of %d bytes", len(value))
+	}
+	var size int
+	switch value[1] {
+	case stunFamilyIPv4:
+		size = net.IPv4len
+	case stunFamilyIPv6:
+		size = net.IPv6len
+	default:
+		return "", fmt.Errorf("Unknown address family %#02x", value[1])
+	}
+	if len(value) < 4+size {
+		return "", fmt.Errorf("Address of %d bytes", len(value))
+	}
+	port := binary.BigEndian.Uint16(value[2:])
+	ip := make(net.IP, size)
+	copy(ip, value[4:4+size])
+	if key != nil {
+		port ^= uint16(stunMagicCookie >> 16)
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+	}
+	return net.JoinHostPort(ip.String(), strconv.Itoa(int(port))), nil
+}
+
+// stunCache holds the external address of this peer for peer.stun.cacheExpiry
+type stunCache struct {
+	sync.Mutex
+	probe     func(stunServer string) (string, error)
+	address   string
+	expiresAt time.Time
+}
+
+var externalAddressCache = &stunCache{probe: STUNProbe}
+
+// externalAddress returns the IP the STUN server maps this peer to with the
+// port of listenAddress, probing the server once the cached address expired.
+// Failed probes are cached too, leaving the address empty.
+func (c *stunCache) externalAddress(stunServer, listenAddress string, expiry time.Duration, now time.Time) string {
+	c.Lock()
+	defer c.Unlock()
+	if now.Before(c.expiresAt) {
+		return c.address
+	}
+	c.address = ""
+	c.expiresAt = now.Add(expiry)
+	mapped, err := c.probe(stunServer)
+	if err != nil {
+		peerLogger.Warningf("Not advertising an external address: %s", err)
+		return ""
+	}
+	// The mapping is the one of the UDP probe, the Chat connections being
+	// accepted on the port this peer listens on
+	host, _, err := net.SplitHostPort(mapped)
+	if err != nil {
+		peerLogger.Warningf("Not advertising an external address: invalid mapped address %s: %s", mapped, err)
+		return ""
+	}
+	_, port, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		peerLogger.Warningf("Not advertising an external address: invalid peer address %s: %s", listenAddress, err)
+		return ""
+	}
+	c.address = net.JoinHostPort(host, port)
+	peerLogger.Infof("STUN server %s maps this peer to %s, advertising %s", stunServer, mapped, c.address)
+	return c.address
+}
+
+// getExternalAddress returns the address this peer is reachable at from
+// outside its NAT, as learned from the STUN server peer.stun.server, empty
+// if none is configured or it could not be reached
+func getExternalAddress() string {
+	stunServer := viper.GetString("peer.stun.server")
+	if stunServer == "" {
+		return ""
+	}
+	return externalAddressCache.externalAddress(stunServer, viper.GetString("peer.address"), viper.GetDuration("peer.stun.cacheExpiry"), time.Now())
+}
@@ -0,0 +1,117 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// serveSTUN answers one binding request on conn with the XOR-MAPPED-ADDRESS
+// of the address it was sent from
+func serveSTUN(t *testing.T, conn *net.UDPConn) {
+	request := make([]byte, stunMaxResponseSize)
+	n, from, err := conn.ReadFromUDP(request)
+	if err != nil || n < stunHeaderSize {
+		t.Errorf("Error reading binding request: %v", err)
+		return
+	}
+	ip := from.IP.To4()
+	response := make([]byte, stunHeaderSize+12)
+	binary.BigEndian.PutUint16(response[0:], stunBindingSuccess)
+	binary.BigEndian.PutUint16(response[2:], 12)
+	copy(response[4:stunHeaderSize], request[4:stunHeaderSize])
+	binary.BigEndian.PutUint16(response[20:], stunXorMappedAddress)
+	binary.BigEndian.PutUint16(response[22:], 8)
+	response[25] = stunFamilyIPv4
+	binary.BigEndian.PutUint16(response[26:], uint16(from.Port)^uint16(stunMagicCookie>>16))
+	for i := range ip {
+		response[28+i] = ip[i] ^ request[4+i]
+	}
+	if _, err := conn.WriteToUDP(response, from); err != nil {
+		t.Errorf("Error sending binding response: %s", err)
+	}
+}
+
+func TestSTUNProbe(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go serveSTUN(t, conn)
+	mapped, err := STUNProbe(conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Error probing the STUN server: %s", err)
+	}
+	host, _, err := net.SplitHostPort(mapped)
+	if err != nil || host != "127.0.0.1" {
+		t.Fatalf("Expected to be mapped to 127.0.0.1, got %s", mapped)
+	}
+}
+
+func TestParseSTUNResponseMappedAddress(t *testing.T) {
+	transactionID := []byte("0123456789ab")
+	response := make([]byte, stunHeaderSize+12)
+	binary.BigEndian.PutUint16(response[0:], stunBindingSuccess)
+	binary.BigEndian.PutUint16(response[2:], 12)
+	binary.BigEndian.PutUint32(response[4:], stunMagicCookie)
+	copy(response[8:], transactionID)
+	binary.BigEndian.PutUint16(response[20:], stunMappedAddress)
+	binary.BigEndian.PutUint16(response[22:], 8)
+	response[25] = stunFamilyIPv4
+	binary.BigEndian.PutUint16(response[26:], 7051)
+	copy(response[28:], net.IPv4(203, 0, 113, 7).To4())
+	mapped, err := parseSTUNResponse(response, transactionID)
+	if err != nil || mapped != "203.0.113.7:7051" {
+		t.Fatalf("Expected 203.0.113.7:7051, got %s, %v", mapped, err)
+	}
+	if _, err := parseSTUNResponse(response, []byte("another12345")); err == nil {
+		t.Fatal("Expected a response to another transaction to be rejected")
+	}
+	binary.BigEndian.PutUint16(response[0:], 0x0111)
+	if _, err := parseSTUNResponse(response, transactionID); err == nil {
+		t.Fatal("Expected a binding error response to be rejected")
+	}
+}
+
+func TestSTUNCacheExpiry(t *testing.T) {
+	probes := 0
+	cache := &stunCache{probe: func(string) (string, error) {
+		probes++
+		if probes == 2 {
+			return "", fmt.Errorf("unreachable")
+		}
+		return "203.0.113.7:61000", nil
+	}}
+	now := time.Now()
+	if address := cache.externalAddress("stun", "0.0.0.0:7051", time.Minute, now); address != "203.0.113.7:7051" {
+		t.Fatalf("Expected the mapped IP with the port of the peer address, got %s", address)
+	}
+	if address := cache.externalAddress("stun", "0.0.0.0:7051", time.Minute, now.Add(30*time.Second)); address != "203.0.113.7:7051" || probes != 1 {
+		t.Fatalf("Expected the cached address without probing again, got %s after %d probes", address, probes)
+	}
+	if address := cache.externalAddress("stun", "0.0.0.0:7051", time.Minute, now.Add(2*time.Minute)); address != "" || probes != 2 {
+		t.Fatalf("Expected a failed probe once the cache expired, got %s after %d probes", address, probes)
+	}
+	if address := cache.externalAddress("stun", "0.0.0.0:7051", time.Minute, now.Add(150*time.Second)); address != "" || probes != 2 {
+		t.Fatalf("Expected the failure to be cached, got %s after %d probes", address, probes)
+	}
+}
@@ -0,0 +1,300 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+var syncSessionBandwidthHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "peer",
+	Name:      "sync_session_bytes_per_second",
+	Help:      "Bandwidth used by the sync sessions served, SYNC_GET_BLOCKS, SYNC_STATE_GET_SNAPSHOT and SYNC_STATE_GET_DELTAS replies, by bandwidth policy.",
+	Buckets:   prometheus.ExponentialBuckets(1024, 4, 10),
+}, []string{"policy"})
+
+func init() {
+	prometheus.MustRegister(syncSessionBandwidthHistogram)
+}
+
+// syncBandwidthLimit returns the bytes per second a sync of the policy is
+// served with, 0 meaning no limit
+func syncBandwidthLimit(policy pb.SyncBandwidthPolicy) int {
+	switch policy {
+	case pb.SyncBandwidthPolicy_THROTTLED:
+		return viper.GetInt("peer.sync.throttledBandwidthBytesPerSec")
+	case pb.SyncBandwidthPolicy_UNLIMITED:
+		return 0
+	default:
+		return viper.GetInt("peer.sync.maxBandwidthBytesPerSec")
+	}
+}
+
+// requestedSyncBandwidthPolicy returns the policy this peer asks its syncs
+// to be served with, peer.sync.bandwidthPolicy
+func requestedSyncBandwidthPolicy() pb.SyncBandwidthPolicy {
+	name := strings.ToUpper(viper.GetString("peer.sync.bandwidthPolicy"))
+	if policy, ok := pb.SyncBandwidthPolicy_value[name]; ok {
+		return pb.SyncBandwidthPolicy(policy)
+	}
+	if name != "" {
+		peerLogger.Warningf("Unknown peer.sync.bandwidthPolicy %s, using %s", name, pb.SyncBandwidthPolicy_NORMAL)
+	}
+	return pb.SyncBandwidthPolicy_NORMAL
+}
+
+// throttledSender sends the messages of a sync session, pacing them to the
+// bandwidth of its policy, and records the bandwidth used once closed
+type throttledSender struct {
+	session      string
+	policy       pb.SyncBandwidthPolicy
+	send         func(*pb.Message) error
+	limiterMutex sync.Mutex
+	limiter      *rate.Limiter
+	limit        int
+	sent         int
+	start        time.Time
+	// gate holds the session while the syncs are paused
+	gate   *syncPauseGate
+	paused time.Duration
+	// queue shares the bandwidth between the sessions served, counting the
+	// bytes sent since its last rebalance in recentlySent
+	queue        *BandwidthFairQueue
+	recentlySent int64
+}
+
+// newThrottledSender returns the sender of the session sending through send
+// at the bandwidth of the policy
+func newThrottledSender(session string, send func(*pb.Message) error, policy pb.SyncBandwidthPolicy) *throttledSender {
+	s := &throttledSender{session: session, policy: policy, send: send, start: time.Now()}
+	s.setLimit(syncBandwidthLimit(policy))
+	return s
+}
+
+// setLimit paces the session to limit bytes per second, 0 meaning no limit
+func (s *throttledSender) setLimit(limit int) {
+	s.limiterMutex.Lock()
+	defer s.limiterMutex.Unlock()
+	if limit == s.limit {
+		return
+	}
+	s.limit, s.limiter = limit, nil
+	if limit > 0 {
+		// A second worth of bytes may be sent at once
+		s.limiter = rate.NewLimiter(rate.Limit(limit), limit)
+	}
+}
+
+func (s *throttledSender) currentLimiter() *rate.Limiter {
+	s.limiterMutex.Lock()
+	defer s.limiterMutex.Unlock()
+	return s.limiter
+}
+
+// shareWith has the session share the bandwidth of queue with the other
+// sessions served until it is closed. Sessions of the unlimited policy do not
+// share it.
+func (s *throttledSender) shareWith(queue *BandwidthFairQueue) {
+	if queue == nil || s.policy == pb.SyncBandwidthPolicy_UNLIMITED {
+		return
+	}
+	s.queue = queue
+	queue.join(s)
+}
+
+// pauseWith holds the session while gate has the syncs paused
+func (s *throttledSender) pauseWith(gate *syncPauseGate) {
+	s.gate = gate
+}
+
+// Send waits for the syncs to be resumed if paused and for the bandwidth of
+// the message to be available, then sends it
+func (s *throttledSender) Send(msg *pb.Message) error {
+	if s.gate != nil {
+		paused, err := s.gate.wait()
+		s.paused += paused
+		if err != nil {
+			return err
+		}
+	}
+	size := proto.Size(msg)
+	if limiter := s.currentLimiter(); limiter != nil {
+		for remaining := size; remaining > 0; remaining -= limiter.Burst() {
+			n := remaining
+			if n > limiter.Burst() {
+				n = limiter.Burst()
+			}
+			if err := limiter.WaitN(context.Background(), n); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.send(msg); err != nil {
+		return err
+	}
+	s.sent += size
+	atomic.AddInt64(&s.recentlySent, int64(size))
+	return nil
+}
+
+// Close records the bandwidth used by the session, the time it was paused
+// for left out
+func (s *throttledSender) Close() {
+	if s.queue != nil {
+		s.queue.leave(s)
+	}
+	elapsed := time.Since(s.start) - s.paused
+	if s.sent == 0 || elapsed <= 0 {
+		return
+	}
+	bytesPerSec := float64(s.sent) / elapsed.Seconds()
+	syncSessionBandwidthHistogram.WithLabelValues(s.policy.String()).Observe(bytesPerSec)
+	peerLogger.Debugf("Sync session %s sent %d bytes in %s, %.0f bytes/s with policy %s", s.session, s.sent, elapsed, bytesPerSec, s.policy)
+}
+
+// BandwidthFairQueueAccessor interface enables a Peer to hand out the queue
+// sharing the bandwidth of the syncs it serves
+type BandwidthFairQueueAccessor interface {
+	GetBandwidthFairQueue() *BandwidthFairQueue
+}
+
+// BandwidthFairQueue shares peer.sync.maxBandwidthBytesPerSec between the
+// sync sessions served at once. Each session gets an equal share, or the
+// bandwidth of its policy if lower, the bandwidth it leaves going to the
+// others. Shares are recomputed as sessions start and end, and every
+// peer.sync.rebalanceInterval while any is active.
+type BandwidthFairQueue struct {
+	sync.Mutex
+	sessions      map[*throttledSender]bool
+	running       bool
+	lastRebalance time.Time
+}
+
+// NewBandwidthFairQueue returns a queue without any sessions
+func NewBandwidthFairQueue() *BandwidthFairQueue {
+	return &BandwidthFairQueue{sessions: make(map[*throttledSender]bool)}
+}
+
+// syncRebalanceInterval returns peer.sync.rebalanceInterval, 1s if not set
+func syncRebalanceInterval() time.Duration {
+	if interval := viper.GetDuration("peer.sync.rebalanceInterval"); interval > 0 {
+		return interval
+	}
+	return time.Second
+}
+
+func (q *BandwidthFairQueue) join(s *throttledSender) {
+	q.Lock()
+	defer q.Unlock()
+	q.sessions[s] = true
+	q.rebalance()
+	if !q.running {
+		q.running = true
+		go q.rebalanceEvery(syncRebalanceInterval())
+	}
+}
+
+func (q *BandwidthFairQueue) leave(s *throttledSender) {
+	q.Lock()
+	defer q.Unlock()
+	delete(q.sessions, s)
+	q.rebalance()
+}
+
+// rebalanceEvery rebalances the shares every interval until no session is left
+func (q *BandwidthFairQueue) rebalanceEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		q.Lock()
+		if len(q.sessions) == 0 {
+			q.running = false
+			q.Unlock()
+			return
+		}
+		q.rebalance()
+		q.Unlock()
+	}
+}
+
+// ActiveSessions returns the number of sync sessions sharing the bandwidth
+func (q *BandwidthFairQueue) ActiveSessions() int {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.sessions)
+}
+
+// rebalance sets the share of every session, the lock being held. Sessions
+// are served the lowest bandwidth first, each getting the lower of its policy
+// bandwidth and an equal share of what is left.
+func (q *BandwidthFairQueue) rebalance() {
+	now := time.Now()
+	elapsed := now.Sub(q.lastRebalance)
+	q.lastRebalance = now
+	total := viper.GetInt("peer.sync.maxBandwidthBytesPerSec")
+	sessions := make([]*throttledSender, 0, len(q.sessions))
+	for s := range q.sessions {
+		sessions = append(sessions, s)
+	}
+	sort.Sort(byPolicyBandwidth(sessions))
+	remaining := total
+	for i, s := range sessions {
+		limit := syncBandwidthLimit(s.policy)
+		if total > 0 {
+			share := remaining / (len(sessions) - i)
+			if share < 1 {
+				share = 1
+			}
+			if limit == 0 || limit > share {
+				limit = share
+			}
+			remaining -= limit
+		}
+		bytesPerSec := float64(atomic.SwapInt64(&s.recentlySent, 0)) / elapsed.Seconds()
+		if limit != s.limit {
+			peerLogger.Debugf("Sync session %s sending %.0f bytes/s now gets %d bytes/s, %d sessions sharing %d bytes/s", s.session, bytesPerSec, limit, len(sessions), total)
+		}
+		s.setLimit(limit)
+	}
+}
+
+// byPolicyBandwidth sorts sessions by the bandwidth of their policy, lowest first then unlimited
+type byPolicyBandwidth []*throttledSender
+
+func (b byPolicyBandwidth) Len() int      { return len(b) }
+func (b byPolicyBandwidth) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byPolicyBandwidth) Less(i, j int) bool {
+	li, lj := syncBandwidthLimit(b[i].policy), syncBandwidthLimit(b[j].policy)
+	return li != 0 && (lj == 0 || li < lj)
+}
+
+// GetBandwidthFairQueue returns the queue sharing the bandwidth of the syncs served by this peer
+func (p *PeerImpl) GetBandwidthFairQueue() *BandwidthFairQueue {
+	return p.syncBandwidth
+}
@@ -0,0 +1,147 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestSyncBandwidthLimit(t *testing.T) {
+	defer viper.Set("peer.sync.maxBandwidthBytesPerSec", viper.GetInt("peer.sync.maxBandwidthBytesPerSec"))
+	defer viper.Set("peer.sync.throttledBandwidthBytesPerSec", viper.GetInt("peer.sync.throttledBandwidthBytesPerSec"))
+	viper.Set("peer.sync.maxBandwidthBytesPerSec", 1000)
+	viper.Set("peer.sync.throttledBandwidthBytesPerSec", 100)
+	for policy, expected := range map[pb.SyncBandwidthPolicy]int{
+		pb.SyncBandwidthPolicy_NORMAL:    1000,
+		pb.SyncBandwidthPolicy_THROTTLED: 100,
+		pb.SyncBandwidthPolicy_UNLIMITED: 0,
+	} {
+		if limit := syncBandwidthLimit(policy); limit != expected {
+			t.Errorf("Expected %s to be limited to %d bytes/s, got %d", policy, expected, limit)
+		}
+	}
+}
+
+func TestRequestedSyncBandwidthPolicy(t *testing.T) {
+	defer viper.Set("peer.sync.bandwidthPolicy", viper.GetString("peer.sync.bandwidthPolicy"))
+	for name, expected := range map[string]pb.SyncBandwidthPolicy{
+		"throttled": pb.SyncBandwidthPolicy_THROTTLED,
+		"UNLIMITED": pb.SyncBandwidthPolicy_UNLIMITED,
+		"":          pb.SyncBandwidthPolicy_NORMAL,
+		"fast":      pb.SyncBandwidthPolicy_NORMAL,
+	} {
+		viper.Set("peer.sync.bandwidthPolicy", name)
+		if policy := requestedSyncBandwidthPolicy(); policy != expected {
+			t.Errorf("Expected %q to be %s, got %s", name, expected, policy)
+		}
+	}
+}
+
+func TestThrottledSender(t *testing.T) {
+	defer viper.Set("peer.sync.maxBandwidthBytesPerSec", viper.GetInt("peer.sync.maxBandwidthBytesPerSec"))
+	viper.Set("peer.sync.maxBandwidthBytesPerSec", 20000)
+	var sent int
+	send := func(msg *pb.Message) error {
+		sent++
+		return nil
+	}
+	msg := &pb.Message{Type: pb.Message_SYNC_BLOCKS, Payload: make([]byte, 30000)}
+
+	// Over the 20000 bytes of a second, the last 10000 take half a second
+	sender := newThrottledSender("test", send, pb.SyncBandwidthPolicy_NORMAL)
+	start := time.Now()
+	if err := sender.Send(msg); err != nil {
+		t.Fatalf("Error sending: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("Expected the message to wait for its bandwidth, sent after %s", elapsed)
+	}
+	sender.Close()
+
+	sender = newThrottledSender("test", send, pb.SyncBandwidthPolicy_UNLIMITED)
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		sender.Send(msg)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Expected unlimited messages not to wait, sent after %s", elapsed)
+	}
+	if sent != 4 {
+		t.Errorf("Expected 4 messages sent, got %d", sent)
+	}
+}
+
+// sessionLimit returns the bandwidth of the session, which queue rebalances
+func sessionLimit(queue *BandwidthFairQueue, s *throttledSender) int {
+	queue.Lock()
+	defer queue.Unlock()
+	return s.limit
+}
+
+func TestBandwidthFairQueue(t *testing.T) {
+	defer viper.Set("peer.sync.maxBandwidthBytesPerSec", viper.GetInt("peer.sync.maxBandwidthBytesPerSec"))
+	defer viper.Set("peer.sync.throttledBandwidthBytesPerSec", viper.GetInt("peer.sync.throttledBandwidthBytesPerSec"))
+	defer viper.Set("peer.sync.rebalanceInterval", viper.GetString("peer.sync.rebalanceInterval"))
+	viper.Set("peer.sync.maxBandwidthBytesPerSec", 9000)
+	viper.Set("peer.sync.throttledBandwidthBytesPerSec", 1000)
+	viper.Set("peer.sync.rebalanceInterval", "10ms")
+	send := func(msg *pb.Message) error { return nil }
+	queue := NewBandwidthFairQueue()
+
+	first := newThrottledSender("first", send, pb.SyncBandwidthPolicy_NORMAL)
+	first.shareWith(queue)
+	if limit := sessionLimit(queue, first); limit != 9000 {
+		t.Fatalf("Expected a single session to get all the bandwidth, got %d", limit)
+	}
+	second := newThrottledSender("second", send, pb.SyncBandwidthPolicy_NORMAL)
+	second.shareWith(queue)
+	throttled := newThrottledSender("throttled", send, pb.SyncBandwidthPolicy_THROTTLED)
+	throttled.shareWith(queue)
+	unlimited := newThrottledSender("unlimited", send, pb.SyncBandwidthPolicy_UNLIMITED)
+	unlimited.shareWith(queue)
+	if queue.ActiveSessions() != 3 || unlimited.currentLimiter() != nil {
+		t.Fatalf("Expected unlimited sessions not to share the bandwidth, got %d sessions", queue.ActiveSessions())
+	}
+	// The throttled session leaves the bandwidth it does not use to the others
+	if a, b, c := sessionLimit(queue, throttled), sessionLimit(queue, first), sessionLimit(queue, second); a != 1000 || b != 4000 || c != 4000 {
+		t.Fatalf("Expected shares of 1000, 4000 and 4000 bytes/s, got %d, %d and %d", a, b, c)
+	}
+	throttled.Close()
+	if a, b := sessionLimit(queue, first), sessionLimit(queue, second); a != 4500 || b != 4500 {
+		t.Fatalf("Expected the bandwidth of the closed session to be shared, got %d and %d", a, b)
+	}
+
+	// The rate of every session is measured again on every rebalance
+	if err := second.Send(&pb.Message{Payload: make([]byte, 100)}); err != nil {
+		t.Fatalf("Error sending: %s", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if recentlySent := atomic.LoadInt64(&second.recentlySent); recentlySent != 0 {
+		t.Errorf("Expected the sessions to be rebalanced in the background, %d bytes sent since the last rebalance", recentlySent)
+	}
+	first.Close()
+	second.Close()
+	if queue.ActiveSessions() != 0 {
+		t.Errorf("Expected no session left, got %d", queue.ActiveSessions())
+	}
+}
@@ -0,0 +1,327 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+	"google/protobuf"
+
+	"github.com/hyperledger/fabric/core/util"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// syncPause is a CHAIN_SYNC_PAUSE being honoured, done being closed when the
+// syncs resume or, with aborted set, once the pause lasted too long
+type syncPause struct {
+	done    chan struct{}
+	abortAt time.Time
+	aborted bool
+	timer   *time.Timer
+}
+
+// syncPauseGate holds the syncs served on a Chat while the remote peer has
+// them paused. They keep their position while held, and are aborted if the
+// pause outlasts maxPause or the Chat stops.
+type syncPauseGate struct {
+	sync.Mutex
+	maxPause time.Duration
+	current  *syncPause
+	stopped  chan struct{}
+	closed   bool
+}
+
+// defaultMaxSyncPause is how long syncs are held without a configured peer.sync.maxPauseDuration
+const defaultMaxSyncPause = 10 * time.Minute
+
+// newSyncPauseGate returns a gate aborting the syncs paused for longer than
+// maxPause, defaultMaxSyncPause if not positive
+func newSyncPauseGate(maxPause time.Duration) *syncPauseGate {
+	if maxPause <= 0 {
+		maxPause = defaultMaxSyncPause
+	}
+	return &syncPauseGate{maxPause: maxPause, stopped: make(chan struct{})}
+}
+
+// newSyncPauseGateFromConfig returns a gate aborting the syncs paused for
+// longer than peer.sync.maxPauseDuration
+func newSyncPauseGateFromConfig() *syncPauseGate {
+	return newSyncPauseGate(viper.GetDuration("peer.sync.maxPauseDuration"))
+}
+
+// pause holds the syncs until resume, returning when they will be aborted.
+// Pausing syncs already paused keeps the initial deadline.
+func (g *syncPauseGate) pause(now time.Time) time.Time {
+	g.Lock()
+	defer g.Unlock()
+	if g.current != nil {
+		return g.current.abortAt
+	}
+	p := &syncPause{done: make(chan struct{}), abortAt: now.Add(g.maxPause)}
+	p.timer = time.AfterFunc(g.maxPause, func() { g.end(p, true) })
+	g.current = p
+	return p.abortAt
+}
+
+// resume lets the held syncs go on
+func (g *syncPauseGate) resume() {
+	g.Lock()
+	p := g.current
+	g.Unlock()
+	if p != nil {
+		p.timer.Stop()
+		g.end(p, false)
+	}
+}
+
+// end ends the pause p if it is the current one
+func (g *syncPauseGate) end(p *syncPause, aborted bool) {
+	g.Lock()
+	defer g.Unlock()
+	if g.current != p {
+		return
+	}
+	g.current = nil
+	p.aborted = aborted
+	close(p.done)
+}
+
+// stop aborts the syncs held by the gate, the Chat being over
+func (g *syncPauseGate) stop() {
+	g.Lock()
+	defer g.Unlock()
+	if !g.closed {
+		g.closed = true
+		close(g.stopped)
+	}
+}
+
+// wait returns at once if the syncs are not paused, otherwise once they are
+// resumed, returning how long it waited. An error is returned if the pause
+// was aborted or the gate stopped first.
+func (g *syncPauseGate) wait() (time.Duration, error) {
+	g.Lock()
+	p := g.current
+	g.Unlock()
+	if p == nil {
+		return 0, nil
+	}
+	start := time.Now()
+	select {
+	case <-p.done:
+		if p.aborted {
+			return time.Since(start), fmt.Errorf("Sync paused for longer than %s, aborting", g.maxPause)
+		}
+		return time.Since(start), nil
+	case <-g.stopped:
+		return time.Since(start), fmt.Errorf("Chat stopped while the sync was paused")
+	}
+}
+
+// newSyncPaused returns the CHAIN_SYNC_PAUSED payload of syncs paused until abortAt
+func newSyncPaused(abortAt time.Time) *pb.SyncPaused {
+	return &pb.SyncPaused{AbortAt: &google_protobuf.Timestamp{Seconds: abortAt.Unix(), Nanos: int32(abortAt.Nanosecond())}}
+}
+
+// syncPausedAbortAt returns when the paused syncs are aborted, zero if unknown
+func syncPausedAbortAt(paused *pb.SyncPaused) time.Time {
+	if paused.AbortAt == nil {
+		return time.Time{}
+	}
+	return time.Unix(paused.AbortAt.Seconds, int64(paused.AbortAt.Nanos))
+}
+
+// SyncSession lets a peer pause and resume the syncs served to it by the
+// remote peer of a Chat, as while on a metered connection at peak hours
+type SyncSession struct {
+	sync.Mutex
+	send    func(*pb.Message) error
+	paused  bool
+	abortAt time.Time
+}
+
+func newSyncSession(send func(*pb.Message) error) *SyncSession {
+	return &SyncSession{send: send}
+}
+
+// Pause asks the remote peer to stop sending the blocks, state snapshots and
+// state deltas of its syncs until Resume. Paused reports once it agreed.
+func (s *SyncSession) Pause() error {
+	if err := s.send(&pb.Message{Type: pb.Message_CHAIN_SYNC_PAUSE}); err != nil {
+		return fmt.Errorf("Error sending %s: %s", pb.Message_CHAIN_SYNC_PAUSE, err)
+	}
+	return nil
+}
+
+// Resume asks the remote peer to go on with the paused syncs
+func (s *SyncSession) Resume() error {
+	s.Lock()
+	s.paused = false
+	s.Unlock()
+	if err := s.send(&pb.Message{Type: pb.Message_CHAIN_SYNC_RESUME}); err != nil {
+		return fmt.Errorf("Error sending %s: %s", pb.Message_CHAIN_SYNC_RESUME, err)
+	}
+	return nil
+}
+
+// Paused returns true if the remote peer confirmed the pause, and when it
+// aborts the syncs if not resumed by then
+func (s *SyncSession) Paused() (bool, time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	return s.paused && time.Now().Before(s.abortAt), s.abortAt
+}
+
+// confirmed records the CHAIN_SYNC_PAUSED of the remote peer
+func (s *SyncSession) confirmed(abortAt time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	s.paused = true
+	s.abortAt = abortAt
+}
+
+// SyncContext is the client side of the syncs requested from the remote peer
+// of a Chat, or of the ledger syncs it is passed to. The syncs of a Chat are
+// paused through its Session, ledger syncs through Pause, Resume and Cancel.
+type SyncContext struct {
+	sync.Mutex
+	Peer    *pb.PeerID
+	Session *SyncSession
+	ctx     context.Context
+	cancel  context.CancelFunc
+	resumed chan struct{}
+}
+
+// NewSyncContext returns a SyncContext to pause, resume and cancel the ledger
+// syncs it is passed to, which are cancelled along with parent
+func NewSyncContext(parent context.Context) *SyncContext {
+	ctx, cancel := context.WithCancel(parent)
+	return &SyncContext{ctx: ctx, cancel: cancel}
+}
+
+// Cancel stops the ledger syncs, which fail once the block being written is stored
+func (c *SyncContext) Cancel() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
+// Pause holds the ledger syncs once the block being written is stored. The
+// write only returns after the remote peer answered the CHAIN_SYNC_PAUSE then
+// sent with a CHAIN_SYNC_PAUSED, and the sync goes on after Resume.
+func (c *SyncContext) Pause() {
+	c.Lock()
+	defer c.Unlock()
+	if c.resumed == nil {
+		c.resumed = make(chan struct{})
+	}
+}
+
+// Resume lets the paused ledger syncs go on, sending CHAIN_SYNC_RESUME
+func (c *SyncContext) Resume() {
+	c.Lock()
+	defer c.Unlock()
+	if c.resumed != nil {
+		close(c.resumed)
+		c.resumed = nil
+	}
+}
+
+// context returns the context of the ledger syncs, the background one for
+// the SyncContext of a Chat
+func (c *SyncContext) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// pausedUntil returns the channel closed on Resume if paused, nil otherwise
+func (c *SyncContext) pausedUntil() <-chan struct{} {
+	c.Lock()
+	defer c.Unlock()
+	return c.resumed
+}
+
+// holdSyncOverStream returns at once unless the ledger syncs of c are paused.
+// Otherwise it sends CHAIN_SYNC_PAUSE over the stream, waits for the
+// CHAIN_SYNC_PAUSED of the remote peer, then for Resume, and sends
+// CHAIN_SYNC_RESUME. An error is returned if c is cancelled first.
+func holdSyncOverStream(c *SyncContext, stream ChatStream) error {
+	ctx := c.context()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	resumed := c.pausedUntil()
+	if resumed == nil {
+		return nil
+	}
+	reply, err := requestOverStream(stream, &pb.Message{Type: pb.Message_CHAIN_SYNC_PAUSE}, pb.Message_CHAIN_SYNC_PAUSED)
+	if err != nil {
+		return err
+	}
+	paused := &pb.SyncPaused{}
+	if err := proto.Unmarshal(reply.Payload, paused); err != nil {
+		return fmt.Errorf("Error unmarshalling SyncPaused: %s", err)
+	}
+	peerLogger.Debugf("Ledger sync paused, the remote peer aborting it at %s", syncPausedAbortAt(paused))
+	select {
+	case <-resumed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	resume := &pb.Message{Type: pb.Message_CHAIN_SYNC_RESUME, Timestamp: util.CreateUtcTimestamp()}
+	if err := stream.Send(resume); err != nil {
+		return fmt.Errorf("Error sending %s: %s", resume.Type, err)
+	}
+	return nil
+}
+
+// SyncContextAccessor interface enables a MessageHandler to hand out the SyncContext of its Chat
+type SyncContextAccessor interface {
+	GetSyncContext() *SyncContext
+}
+
+// GetSyncContext returns the SyncContext of the Chat
+func (d *Handler) GetSyncContext() *SyncContext {
+	context := &SyncContext{Session: d.syncSession}
+	if d.ToPeerEndpoint != nil {
+		context.Peer = d.ToPeerEndpoint.ID
+	}
+	return context
+}
+
+// GetSyncContext returns the SyncContext of the Chat with the peer receiverHandle
+func (p *PeerImpl) GetSyncContext(receiverHandle *pb.PeerID) (*SyncContext, error) {
+	p.handlerMap.RLock()
+	defer p.handlerMap.RUnlock()
+	handler, ok := p.handlerMap.m[*receiverHandle]
+	if !ok {
+		return nil, fmt.Errorf("No Chat with peer %s", receiverHandle.Name)
+	}
+	accessor, ok := handler.(SyncContextAccessor)
+	if !ok {
+		return nil, fmt.Errorf("The handler of peer %s cannot pause syncs", receiverHandle.Name)
+	}
+	return accessor.GetSyncContext(), nil
+}
@@ -0,0 +1,181 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestSyncPauseGateNotPaused(t *testing.T) {
+	gate := newSyncPauseGate(time.Minute)
+	if waited, err := gate.wait(); err != nil || waited != 0 {
+		t.Fatalf("Expected an unpaused gate not to wait, waited %s with error %v", waited, err)
+	}
+}
+
+func TestSyncPauseGateResume(t *testing.T) {
+	gate := newSyncPauseGate(time.Minute)
+	now := time.Now()
+	abortAt := gate.pause(now)
+	if !abortAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("Expected the syncs to be aborted at %s, got %s", now.Add(time.Minute), abortAt)
+	}
+	if again := gate.pause(now.Add(time.Second)); !again.Equal(abortAt) {
+		t.Fatalf("Expected pausing again to keep the deadline %s, got %s", abortAt, again)
+	}
+	errs := make(chan error, 1)
+	go func() {
+		_, err := gate.wait()
+		errs <- err
+	}()
+	select {
+	case err := <-errs:
+		t.Fatalf("Expected the wait to be held while paused, returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	gate.resume()
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatalf("Expected the resumed wait to succeed: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the wait to return once resumed")
+	}
+}
+
+func TestSyncPauseGateAbort(t *testing.T) {
+	gate := newSyncPauseGate(50 * time.Millisecond)
+	gate.pause(time.Now())
+	if _, err := gate.wait(); err == nil {
+		t.Fatal("Expected a pause outlasting the maximum to abort the sync")
+	}
+	if waited, err := gate.wait(); err != nil || waited != 0 {
+		t.Fatalf("Expected the gate to be open after the abort, waited %s with error %v", waited, err)
+	}
+}
+
+func TestSyncPauseGateStop(t *testing.T) {
+	gate := newSyncPauseGate(time.Minute)
+	gate.pause(time.Now())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := gate.wait()
+		errs <- err
+	}()
+	gate.stop()
+	gate.stop()
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatal("Expected stopping the gate to abort the paused sync")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the wait to return once the gate stopped")
+	}
+}
+
+func TestSyncPauseGateDefault(t *testing.T) {
+	if gate := newSyncPauseGate(0); gate.maxPause != defaultMaxSyncPause {
+		t.Fatalf("Expected syncs to be held up to %s by default, got %s", defaultMaxSyncPause, gate.maxPause)
+	}
+}
+
+func TestSyncPaused(t *testing.T) {
+	abortAt := time.Unix(1500000000, 123456789)
+	data, err := proto.Marshal(newSyncPaused(abortAt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	paused := &pb.SyncPaused{}
+	if err := proto.Unmarshal(data, paused); err != nil {
+		t.Fatal(err)
+	}
+	if decoded := syncPausedAbortAt(paused); !decoded.Equal(abortAt) {
+		t.Fatalf("Expected the syncs to be aborted at %s, got %s", abortAt, decoded)
+	}
+	if decoded := syncPausedAbortAt(&pb.SyncPaused{}); !decoded.IsZero() {
+		t.Fatalf("Expected an unknown deadline to be zero, got %s", decoded)
+	}
+}
+
+func TestSyncSession(t *testing.T) {
+	var sent []pb.Message_Type
+	session := newSyncSession(func(msg *pb.Message) error {
+		sent = append(sent, msg.Type)
+		return nil
+	})
+	if err := session.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if paused, _ := session.Paused(); paused {
+		t.Fatal("Expected the session not to be paused before the remote peer confirmed")
+	}
+	abortAt := time.Now().Add(time.Minute)
+	session.confirmed(abortAt)
+	if paused, at := session.Paused(); !paused || !at.Equal(abortAt) {
+		t.Fatalf("Expected the session to be paused until %s, got %t until %s", abortAt, paused, at)
+	}
+	if err := session.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if paused, _ := session.Paused(); paused {
+		t.Fatal("Expected the session not to be paused once resumed")
+	}
+	if len(sent) != 2 || sent[0] != pb.Message_CHAIN_SYNC_PAUSE || sent[1] != pb.Message_CHAIN_SYNC_RESUME {
+		t.Fatalf("Expected a %s then a %s to be sent, got %v", pb.Message_CHAIN_SYNC_PAUSE, pb.Message_CHAIN_SYNC_RESUME, sent)
+	}
+}
+
+func TestSyncSessionPauseExpired(t *testing.T) {
+	session := newSyncSession(func(msg *pb.Message) error { return nil })
+	session.confirmed(time.Now().Add(-time.Second))
+	if paused, _ := session.Paused(); paused {
+		t.Fatal("Expected a pause past its deadline not to be reported")
+	}
+}
+
+func TestThrottledSenderPaused(t *testing.T) {
+	sent := make(chan *pb.Message, 1)
+	sender := newThrottledSender("test", func(msg *pb.Message) error {
+		sent <- msg
+		return nil
+	}, pb.SyncBandwidthPolicy_UNLIMITED)
+	gate := newSyncPauseGate(time.Minute)
+	sender.pauseWith(gate)
+	gate.pause(time.Now())
+	go sender.Send(&pb.Message{Type: pb.Message_SYNC_BLOCKS})
+	select {
+	case <-sent:
+		t.Fatal("Expected the paused sync not to send")
+	case <-time.After(50 * time.Millisecond):
+	}
+	gate.resume()
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the sync to send once resumed")
+	}
+	if sender.paused < 50*time.Millisecond {
+		t.Fatalf("Expected the time paused to be accounted, got %s", sender.paused)
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// syncRangeRootOf returns the SHA-256 merkle root over the block hashes, the
+// tree being that of the block audit proofs, nil for no hashes
+func syncRangeRootOf(hashes [][]byte) []byte {
+	if len(hashes) == 0 {
+		return nil
+	}
+	leaves := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		leaves[i] = sha256Sum(hash)
+	}
+	levels := merkleTreeWith(leaves, sha256MerkleParent)
+	return levels[len(levels)-1][0]
+}
+
+// ComputeSyncRangeRoot returns the root a peer answers a
+// CHAIN_SYNC_VERIFY_REQUEST for the blocks with, nil for no blocks. It covers
+// the blocks as they are, so partial blocks of a filtered sync do not match.
+func ComputeSyncRangeRoot(blocks []*pb.Block) ([]byte, error) {
+	hashes := make([][]byte, len(blocks))
+	for i, block := range blocks {
+		hash, err := block.GetHash()
+		if err != nil {
+			return nil, fmt.Errorf("Error hashing block %d of the range: %s", i, err)
+		}
+		hashes[i] = hash
+	}
+	return syncRangeRootOf(hashes), nil
+}
+
+// syncRangeRoot returns the reply to a CHAIN_SYNC_VERIFY_REQUEST for the
+// blocks from to to included, those past the end of the chain left out
+func syncRangeRoot(blockchain BlockChainAccessor, from, to uint64) (*pb.SyncVerifyResponse, error) {
+	var hashes [][]byte
+	height := blockchain.GetBlockchainSize()
+	for n := from; n <= to && n < height; n++ {
+		block, err := blockchain.GetBlockByNumber(n)
+		if err != nil {
+			return nil, fmt.Errorf("Error getting block %d: %s", n, err)
+		}
+		hash, err := block.GetHash()
+		if err != nil {
+			return nil, fmt.Errorf("Error hashing block %d: %s", n, err)
+		}
+		hashes = append(hashes, hash)
+	}
+	return &pb.SyncVerifyResponse{RootHash: syncRangeRootOf(hashes), BlockCount: uint64(len(hashes))}, nil
+}
+
+// VerifySyncedRange checks the blocks from to to included synced from the
+// peer at address against the root it answers a CHAIN_SYNC_VERIFY_REQUEST
+// with. A *SyncRangeCorruptError is returned if a block is missing or differs.
+func VerifySyncedRange(address string, from, to uint64, blocks []*pb.Block) error {
+	err := withRequestStream(address, func(stream ChatStream) error {
+		return verifySyncedRangeOverStream(stream, from, to, blocks)
+	})
+	if corrupt, ok := err.(*SyncRangeCorruptError); ok {
+		corrupt.Address = address
+		return corrupt
+	} else if err != nil {
+		return fmt.Errorf("Error verifying blocks %d to %d synced from %s: %s", from, to, address, err)
+	}
+	return nil
+}
+
+// FetchVerifiedBlockRange is FetchBlockRange checking the blocks received as
+// VerifySyncedRange does. A corrupt range is synced again, up to
+// peer.sync.verifyAttempts times in all, the *SyncRangeCorruptError of the
+// last attempt being returned.
+func FetchVerifiedBlockRange(address string, from, to uint64) (blocks []*pb.Block, err error) {
+	err = withRequestStream(address, func(stream ChatStream) error {
+		blocks, err = fetchVerifiedBlockRangeOverStream(stream, from, to, viper.GetInt("peer.sync.verifyAttempts"))
+		return err
+	})
+	if corrupt, ok := err.(*SyncRangeCorruptError); ok {
+		corrupt.Address = address
+		return nil, corrupt
+	} else if err != nil {
+		return nil, fmt.Errorf("Error fetching blocks %d to %d from %s: %s", from, to, address, err)
+	}
+	return blocks, nil
+}
+
+func fetchVerifiedBlockRangeOverStream(stream ChatStream, from, to uint64, attempts int) ([]*pb.Block, error) {
+	for attempt := 1; ; attempt++ {
+		blocks, err := fetchBlockRangeOverStream(stream, from, to)
+		if err != nil {
+			return nil, err
+		}
+		err = verifySyncedRangeOverStream(stream, from, to, blocks)
+		if err == nil {
+			return blocks, nil
+		} else if _, ok := err.(*SyncRangeCorruptError); !ok || attempt >= attempts {
+			return nil, err
+		}
+		peerLogger.Warningf("Blocks %d to %d synced corrupt, syncing them again (attempt %d of %d)", from, to, attempt+1, attempts)
+	}
+}
+
+func verifySyncedRangeOverStream(stream ChatStream, from, to uint64, blocks []*pb.Block) error {
+	data, err := proto.Marshal(&pb.SyncVerifyRequest{FromBlock: from, ToBlock: to})
+	if err != nil {
+		return fmt.Errorf("Error marshalling SyncVerifyRequest: %s", err)
+	}
+	reply, err := requestOverStream(stream, &pb.Message{Type: pb.Message_CHAIN_SYNC_VERIFY_REQUEST, Payload: data}, pb.Message_CHAIN_SYNC_VERIFY_RESPONSE)
+	if err != nil {
+		return err
+	}
+	response := &pb.SyncVerifyResponse{}
+	if err := proto.Unmarshal(reply.Payload, response); err != nil {
+		return fmt.Errorf("Error unmarshalling SyncVerifyResponse: %s", err)
+	}
+	root, err := ComputeSyncRangeRoot(blocks)
+	if err != nil {
+		return err
+	}
+	if response.BlockCount != uint64(len(blocks)) || !bytes.Equal(root, response.RootHash) {
+		peerLogger.Warningf("Synced %d blocks of root %x in range %d to %d, the peer has %d of root %x", len(blocks), root, from, to, response.BlockCount, response.RootHash)
+		return &SyncRangeCorruptError{FromBlock: from, ToBlock: to}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// serveSyncVerify answers the CHAIN_QUERY_RANGE and CHAIN_SYNC_VERIFY_REQUEST
+// sent on the stream from blockchain, corrupt altering the blocks of the
+// ranges it returns true for
+func serveSyncVerify(t *testing.T, stream *handshakeStream, blockchain *testBlockchain, corrupt func() bool) {
+	defer close(stream.recv)
+	send := func(reply *pb.Message) error {
+		stream.recv <- reply
+		return nil
+	}
+	for msg := range stream.sent {
+		switch msg.Type {
+		case pb.Message_CHAIN_QUERY_RANGE:
+			query := &pb.BlockRangeQuery{}
+			if err := proto.Unmarshal(msg.Payload, query); err != nil {
+				t.Errorf("Error unmarshalling BlockRangeQuery: %s", err)
+				return
+			}
+			if !corrupt() {
+				sendBlockRange(blockchain, send, query, 0)
+				continue
+			}
+			data, _ := proto.Marshal(&pb.SubscribedBlock{BlockNumber: query.FromBlock, Block: &pb.Block{StateHash: []byte("tampered")}})
+			stream.recv <- &pb.Message{Type: pb.Message_CHAIN_BLOCK, Payload: data}
+			sendBlockRangeDone(send, &pb.BlockRangeDone{})
+		case pb.Message_CHAIN_SYNC_VERIFY_REQUEST:
+			request := &pb.SyncVerifyRequest{}
+			if err := proto.Unmarshal(msg.Payload, request); err != nil {
+				t.Errorf("Error unmarshalling SyncVerifyRequest: %s", err)
+				return
+			}
+			response, err := syncRangeRoot(blockchain, request.FromBlock, request.ToBlock)
+			if err != nil {
+				t.Errorf("Error computing the range root: %s", err)
+				return
+			}
+			data, _ := proto.Marshal(response)
+			stream.recv <- &pb.Message{Type: pb.Message_CHAIN_SYNC_VERIFY_RESPONSE, Payload: data}
+		}
+	}
+}
+
+func TestComputeSyncRangeRoot(t *testing.T) {
+	bus := NewBlockEventBus()
+	blockchain := &testBlockchain{}
+	for i := 0; i < 5; i++ {
+		blockchain.append(bus, &pb.Block{StateHash: []byte(fmt.Sprint(i))})
+	}
+	root, err := ComputeSyncRangeRoot(blockchain.blocks[1:4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := syncRangeRoot(blockchain, 1, 3)
+	if err != nil || response.BlockCount != 3 || !bytes.Equal(response.RootHash, root) {
+		t.Fatalf("Expected the root of the 3 blocks %x, got %v, %v", root, response, err)
+	}
+	// Blocks past the end of the chain are left out
+	if response, _ := syncRangeRoot(blockchain, 4, 10); response.BlockCount != 1 {
+		t.Errorf("Expected the range to stop at the end of the chain, got %d blocks", response.BlockCount)
+	}
+	if root, err := ComputeSyncRangeRoot(nil); root != nil || err != nil {
+		t.Errorf("Expected no root for no blocks, got %x, %v", root, err)
+	}
+	proof, _ := newBlockAuditProof(blockchain.blocks[1:4], 0)
+	if !bytes.Equal(proof.CheckpointRoot, root) {
+		t.Error("Expected the range root to be that of the audit proofs over the blocks")
+	}
+}
+
+func TestFetchVerifiedBlockRangeResync(t *testing.T) {
+	bus := NewBlockEventBus()
+	blockchain := &testBlockchain{}
+	for i := 0; i < 4; i++ {
+		blockchain.append(bus, &pb.Block{StateHash: []byte(fmt.Sprint(i))})
+	}
+	stream := &handshakeStream{recv: make(chan *pb.Message, 10), sent: make(chan *pb.Message)}
+	ranges := 0
+	go serveSyncVerify(t, stream, blockchain, func() bool {
+		ranges++
+		return ranges == 1
+	})
+	blocks, err := fetchVerifiedBlockRangeOverStream(stream, 0, 3, 3)
+	close(stream.sent)
+	if err != nil || len(blocks) != 4 || ranges != 2 {
+		t.Fatalf("Expected the corrupt range to be synced again, got %d blocks after %d ranges, %v", len(blocks), ranges, err)
+	}
+}
+
+func TestFetchVerifiedBlockRangeCorrupt(t *testing.T) {
+	bus := NewBlockEventBus()
+	blockchain := &testBlockchain{}
+	blockchain.append(bus, &pb.Block{StateHash: []byte("0")})
+	stream := &handshakeStream{recv: make(chan *pb.Message, 10), sent: make(chan *pb.Message)}
+	ranges := 0
+	go serveSyncVerify(t, stream, blockchain, func() bool {
+		ranges++
+		return true
+	})
+	_, err := fetchVerifiedBlockRangeOverStream(stream, 0, 0, 2)
+	close(stream.sent)
+	if _, ok := err.(*SyncRangeCorruptError); !ok || ranges != 2 {
+		t.Fatalf("Expected a SyncRangeCorruptError after 2 ranges, got %v after %d", err, ranges)
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+const (
+	// ntpClockSourcePrefix starts the peer.tx.clockSource of an NTP server, e.g. ntp://pool.ntp.org
+	ntpClockSourcePrefix = "ntp://"
+
+	// ntpRefreshInterval is how often an NTPClock measures its offset again
+	ntpRefreshInterval = 10 * time.Minute
+
+	// ntpTimeout is how long an NTPClock waits for the reply of its server
+	ntpTimeout = 5 * time.Second
+
+	// ntpEpochOffset is the number of seconds from the NTP epoch, 1900, to the Unix epoch
+	ntpEpochOffset = 2208988800
+)
+
+// ClockSource returns the current time transaction timestamps are checked against
+type ClockSource func() time.Time
+
+// TimestampValidator checks that the timestamps of transactions are within
+// MaxSkew of the time of its clock. Skewed transactions are not processed if
+// Reject is set, otherwise they are only reported.
+type TimestampValidator struct {
+	MaxSkew time.Duration
+	Reject  bool
+	now     ClockSource
+}
+
+// NewTimestampValidator returns a validator of the timestamps against now, the system clock if nil
+func NewTimestampValidator(maxSkew time.Duration, reject bool, now ClockSource) *TimestampValidator {
+	if now == nil {
+		now = time.Now
+	}
+	return &TimestampValidator{MaxSkew: maxSkew, Reject: reject, now: now}
+}
+
+// newTimestampValidatorFromConfig returns a validator allowing peer.tx.maxClockSkew
+// against peer.tx.clockSource, or nil if no skew is configured
+func newTimestampValidatorFromConfig() (*TimestampValidator, error) {
+	return newTimestampValidatorFromSource(viper.GetDuration("peer.tx.maxClockSkew"), viper.GetString("peer.tx.clockSource"), viper.GetBool("peer.tx.rejectOnTimestampSkew"))
+}
+
+// newTimestampValidatorFromSource returns a validator allowing maxSkew against
+// the clock source, or nil if maxSkew is not positive
+func newTimestampValidatorFromSource(maxSkew time.Duration, source string, reject bool) (*TimestampValidator, error) {
+	if maxSkew <= 0 {
+		return nil, nil
+	}
+	now, err := newClockSource(source)
+	if err != nil {
+		return nil, err
+	}
+	return NewTimestampValidator(maxSkew, reject, now), nil
+}
+
+// newClockSource returns the system clock for an empty or system source, or
+// the clock synchronized with the NTP server of an ntp://host[:port] source
+func newClockSource(source string) (ClockSource, error) {
+	switch {
+	case source == "" || source == "system":
+		return time.Now, nil
+	case strings.HasPrefix(source, ntpClockSourcePrefix):
+		server := strings.TrimPrefix(source, ntpClockSourcePrefix)
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "123")
+		}
+		return NewNTPClock(server).Now, nil
+	}
+	return nil, fmt.Errorf("Invalid clock source %q, expected system or %shost[:port]", source, ntpClockSourcePrefix)
+}
+
+// Validate returns the violation of tx if its timestamp is missing or more
+// than MaxSkew away from the clock, nil otherwise. A nil TimestampValidator
+// accepts any transaction.
+func (v *TimestampValidator) Validate(tx *pb.Transaction) *pb.ValidationViolation {
+	if v == nil {
+		return nil
+	}
+	if tx.Timestamp == nil {
+		return &pb.ValidationViolation{TxID: tx.Uuid, Field: "timestamp", Reason: "missing timestamp"}
+	}
+	delta := time.Unix(tx.Timestamp.Seconds, int64(tx.Timestamp.Nanos)).Sub(v.now())
+	if delta <= v.MaxSkew && delta >= -v.MaxSkew {
+		return nil
+	}
+	peerLogger.Warningf("Timestamp of transaction %s is %s off the clock, more than the %s allowed", tx.Uuid, delta, v.MaxSkew)
+	return &pb.ValidationViolation{TxID: tx.Uuid, Field: "timestamp", Reason: fmt.Sprintf("timestamp %s off the clock, more than %s", delta, v.MaxSkew)}
+}
+
+// ValidateBatch returns the violations of the transactions with skewed
+// timestamps, TxIndex being their index among the transactions
+func (v *TimestampValidator) ValidateBatch(transactions []*pb.Transaction) []*pb.ValidationViolation {
+	var violations []*pb.ValidationViolation
+	for i, tx := range transactions {
+		if violation := v.Validate(tx); violation != nil {
+			violation.TxIndex = uint32(i)
+			violations = append(violations, violation)
+		}
+	}
+	return violations
+}
+
+// withoutViolating returns the transactions of valid other than those of
+// transactions the violations are about
+func withoutViolating(valid, transactions []*pb.Transaction, violations []*pb.ValidationViolation) []*pb.Transaction {
+	violating := make(map[*pb.Transaction]bool)
+	for _, violation := range violations {
+		violating[transactions[violation.TxIndex]] = true
+	}
+	var remaining []*pb.Transaction
+	for _, tx := range valid {
+		if !violating[tx] {
+			remaining = append(remaining, tx)
+		}
+	}
+	return remaining
+}
+
+// NTPClock is the system clock corrected by its offset to an NTP server,
+// measured on creation and every ntpRefreshInterval in the background
+type NTPClock struct {
+	sync.Mutex
+	server     string
+	offset     time.Duration
+	measuredAt time.Time
+	measuring  bool
+}
+
+// NewNTPClock returns a clock synchronized with the NTP server at address
+// host:port. The clock runs uncorrected until a measurement succeeds.
+func NewNTPClock(server string) *NTPClock {
+	c := &NTPClock{server: server}
+	c.measure()
+	return c
+}
+
+// Now returns the current time according to the NTP server
+func (c *NTPClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	if !c.measuring && time.Since(c.measuredAt) > ntpRefreshInterval {
+		c.measuring = true
+		go c.measure()
+	}
+	return time.Now().Add(c.offset)
+}
+
+func (c *NTPClock) measure() {
+	offset, err := queryNTPOffset(c.server)
+	c.Lock()
+	defer c.Unlock()
+	c.measuring = false
+	c.measuredAt = time.Now()
+	if err != nil {
+		peerLogger.Warningf("Error measuring the clock offset to %s: %s", c.server, err)
+		return
+	}
+	peerLogger.Debugf("Clock offset to %s is %s", c.server, offset)
+	c.offset = offset
+}
+
+// queryNTPOffset asks the NTP server for its time with an SNTP request,
+// returning how far ahead of the system clock it is
+func queryNTPOffset(server string) (time.Duration, error) {
+	conn, err := net.DialTimeout("udp", server, ntpTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ntpTimeout))
+	request := make([]byte, 48)
+	request[0] = 0x1B // No leap warning, version 3, client mode
+	sent := time.Now()
+	if _, err := conn.Write(request); err != nil {
+		return 0, err
+	}
+	reply := make([]byte, 48)
+	if _, err := conn.Read(reply); err != nil {
+		return 0, err
+	}
+	received := time.Now()
+	seconds := binary.BigEndian.Uint32(reply[40:44])
+	fraction := binary.BigEndian.Uint32(reply[44:48])
+	if seconds == 0 {
+		return 0, fmt.Errorf("No transmit timestamp in the reply")
+	}
+	serverTime := time.Unix(int64(seconds)-ntpEpochOffset, int64(fraction)*int64(time.Second)>>32)
+	// The server time is taken half way through the round trip
+	return serverTime.Sub(sent.Add(received.Sub(sent) / 2)), nil
+}
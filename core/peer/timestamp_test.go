@@ -0,0 +1,97 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"google/protobuf"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestTimestampValidatorSkew(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	validator := NewTimestampValidator(5*time.Minute, true, func() time.Time { return now })
+	transactions := []*pb.Transaction{
+		{Uuid: "ontime", Timestamp: &google_protobuf.Timestamp{Seconds: now.Unix() - 60}},
+		{Uuid: "future", Timestamp: &google_protobuf.Timestamp{Seconds: now.Unix() + 600}},
+		{Uuid: "missing"},
+		{Uuid: "past", Timestamp: &google_protobuf.Timestamp{Seconds: now.Unix() - 301}},
+	}
+	violations := validator.ValidateBatch(transactions)
+	if len(violations) != 3 {
+		t.Fatalf("Expected 3 violations, got %v", violations)
+	}
+	for i, expected := range []struct {
+		txID    string
+		txIndex uint32
+	}{{"future", 1}, {"missing", 2}, {"past", 3}} {
+		if violations[i].TxID != expected.txID || violations[i].TxIndex != expected.txIndex {
+			t.Errorf("Expected violation %d to be %s at %d, got %s at %d", i, expected.txID, expected.txIndex, violations[i].TxID, violations[i].TxIndex)
+		}
+	}
+	remaining := withoutViolating(transactions, transactions, violations)
+	if len(remaining) != 1 || remaining[0].Uuid != "ontime" {
+		t.Errorf("Expected only the transaction on time to remain, got %v", remaining)
+	}
+
+	var disabled *TimestampValidator
+	if violations := disabled.ValidateBatch(transactions); len(violations) != 0 {
+		t.Errorf("Expected a nil validator to accept any transaction, got %v", violations)
+	}
+}
+
+func TestNewClockSource(t *testing.T) {
+	for _, source := range []string{"", "system"} {
+		if _, err := newClockSource(source); err != nil {
+			t.Errorf("Expected clock source %q to be valid, got %s", source, err)
+		}
+	}
+	if _, err := newClockSource("sundial"); err == nil {
+		t.Error("Expected an error for an unknown clock source")
+	}
+}
+
+func TestQueryNTPOffset(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %s", err)
+	}
+	defer conn.Close()
+	go func() {
+		request := make([]byte, 48)
+		_, addr, err := conn.ReadFrom(request)
+		if err != nil {
+			return
+		}
+		reply := make([]byte, 48)
+		reply[0] = 0x1C
+		binary.BigEndian.PutUint32(reply[40:44], uint32(time.Now().Add(time.Hour).Unix()+ntpEpochOffset))
+		conn.WriteTo(reply, addr)
+	}()
+	offset, err := queryNTPOffset(conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Error querying the offset: %s", err)
+	}
+	if offset < time.Hour-2*time.Second || offset > time.Hour+time.Second {
+		t.Errorf("Expected an offset of about 1h, got %s", offset)
+	}
+}
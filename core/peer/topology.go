@@ -0,0 +1,68 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sort"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// TopologyReader interface enables a Peer to answer DISC_GET_TOPOLOGY messages
+type TopologyReader interface {
+	GetTopology() (*pb.Topology, error)
+}
+
+// buildTopology returns the topology seen from self: an edge to each entry of
+// the registry with its last RTT, and an edge from each entry to each of its
+// neighbors. Neighbors not in the registry are nodes without an address.
+func buildTopology(self *pb.PeerEndpoint, entries []PeerRegistryEntry) *pb.Topology {
+	sort.Sort(entriesByID(entries))
+	topology := &pb.Topology{Nodes: []*pb.PeerNode{{ID: self.ID, Address: self.Address}}}
+	known := map[string]bool{self.ID.Name: true}
+	for _, entry := range entries {
+		topology.Nodes = append(topology.Nodes, &pb.PeerNode{ID: entry.Endpoint.ID, Address: entry.Endpoint.Address})
+		known[entry.Endpoint.ID.Name] = true
+		topology.Edges = append(topology.Edges, &pb.PeerEdge{From: self.ID, To: entry.Endpoint.ID, LatencyMs: uint32(entry.LastRTT.Nanoseconds() / 1e6)})
+	}
+	for _, entry := range entries {
+		for _, neighbor := range entry.Neighbors {
+			if !known[neighbor.Name] {
+				topology.Nodes = append(topology.Nodes, &pb.PeerNode{ID: neighbor})
+				known[neighbor.Name] = true
+			}
+			topology.Edges = append(topology.Edges, &pb.PeerEdge{From: entry.Endpoint.ID, To: neighbor})
+		}
+	}
+	return topology
+}
+
+type entriesByID []PeerRegistryEntry
+
+func (e entriesByID) Len() int           { return len(e) }
+func (e entriesByID) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e entriesByID) Less(i, j int) bool { return e[i].Endpoint.ID.Name < e[j].Endpoint.ID.Name }
+
+// GetTopology returns the peers this peer knows of and the Chats between them
+func (p *PeerImpl) GetTopology() (*pb.Topology, error) {
+	self, err := p.GetPeerEndpoint()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting peer endpoint: %s", err)
+	}
+	return buildTopology(self, p.registry.Entries()), nil
+}
@@ -0,0 +1,55 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestBuildTopology(t *testing.T) {
+	self := &pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp0"}, Address: "10.0.0.1:30303"}
+	entries := []PeerRegistryEntry{
+		{
+			Endpoint:  &pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp2"}, Address: "10.0.0.3:30303"},
+			Neighbors: []*pb.PeerID{{Name: "vp0"}, {Name: "vp3"}},
+		},
+		{
+			Endpoint: &pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp1"}, Address: "10.0.0.2:30303"},
+			LastRTT:  12 * time.Millisecond,
+		},
+	}
+	topology := buildTopology(self, entries)
+
+	var nodes []string
+	for _, node := range topology.Nodes {
+		nodes = append(nodes, node.ID.Name+"@"+node.Address)
+	}
+	if expected := "[vp0@10.0.0.1:30303 vp1@10.0.0.2:30303 vp2@10.0.0.3:30303 vp3@]"; fmt.Sprint(nodes) != expected {
+		t.Fatalf("Expected nodes %s, got %s", expected, nodes)
+	}
+	var edges []string
+	for _, edge := range topology.Edges {
+		edges = append(edges, fmt.Sprintf("%s-%s:%d", edge.From.Name, edge.To.Name, edge.LatencyMs))
+	}
+	if expected := "[vp0-vp1:12 vp0-vp2:0 vp2-vp0:0 vp2-vp3:0]"; fmt.Sprint(edges) != expected {
+		t.Fatalf("Expected edges %s, got %s", expected, edges)
+	}
+}
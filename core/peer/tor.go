@@ -0,0 +1,147 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// torEnabled returns true if the peers advertising a Tor hidden service are
+// dialed through the SOCKS5 proxy at peer.tor.socksAddress, peer.tor.enabled
+func torEnabled() bool {
+	return viper.GetBool("peer.tor.enabled")
+}
+
+// getOnionAddress returns the address of the Tor hidden service of this peer
+// advertised in DISC_HELLO, peer.tor.onionAddress
+func getOnionAddress() string {
+	return viper.GetString("peer.tor.onionAddress")
+}
+
+// isOnionAddress returns true if address is the host:port of a Tor hidden service
+func isOnionAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	return err == nil && strings.HasSuffix(strings.ToLower(host), ".onion")
+}
+
+// TorPeerAddressResolver resolves the address of a peer which advertised a
+// Tor hidden service into its onion address while Tor is enabled, through
+// Fallback otherwise, the address itself if nil
+type TorPeerAddressResolver struct {
+	Registry *PeerRegistry
+	Fallback PeerAddressResolver
+}
+
+// Resolve implements PeerAddressResolver
+func (r TorPeerAddressResolver) Resolve(address string) ([]string, error) {
+	if torEnabled() {
+		if entry, ok := r.Registry.ByAddress(address); ok && entry.OnionAddress != "" {
+			return []string{entry.OnionAddress}, nil
+		}
+	}
+	if r.Fallback == nil {
+		return []string{address}, nil
+	}
+	return r.Fallback.Resolve(address)
+}
+
+// dialSOCKS5 connects to address through the SOCKS5 proxy at proxyAddress
+// within timeout, the proxy resolving the host as Tor requires for onion
+// addresses
+func dialSOCKS5(proxyAddress, address string, timeout time.Duration) (net.Conn, error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing address %s: %s", address, err)
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid port of address %s: %s", address, err)
+	}
+	if len(host) > 255 {
+		return nil, fmt.Errorf("Host of address %s is too long for SOCKS5", address)
+	}
+	conn, err := net.DialTimeout("tcp", proxyAddress, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("Error connecting to SOCKS5 proxy %s: %s", proxyAddress, err)
+	}
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	if err := socks5Connect(conn, host, uint16(port)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Error connecting to %s through SOCKS5 proxy %s: %s", address, proxyAddress, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// socks5Connect asks the SOCKS5 proxy conn is connected to, without
+// authentication, to connect to host:port
+func socks5Connect(conn net.Conn, host string, port uint16) error {
+	if _, err := conn.Write([]byte{5, 1, 0}); err != nil {
+		return err
+	}
+	method := make([]byte, 2)
+	if _, err := io.ReadFull(conn, method); err != nil {
+		return err
+	}
+	if method[0] != 5 || method[1] != 0 {
+		return fmt.Errorf("proxy requires an unsupported authentication method %d", method[1])
+	}
+	request := append([]byte{5, 1, 0, 3, byte(len(host))}, host...)
+	request = append(request, 0, 0)
+	binary.BigEndian.PutUint16(request[len(request)-2:], port)
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 5 {
+		return fmt.Errorf("unexpected SOCKS version %d", reply[0])
+	}
+	if reply[1] != 0 {
+		return fmt.Errorf("proxy refused the connection with reply %d", reply[1])
+	}
+	// Skip the address the proxy bound, then its port
+	var skip int
+	switch reply[3] {
+	case 1:
+		skip = net.IPv4len
+	case 4:
+		skip = net.IPv6len
+	case 3:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return err
+		}
+		skip = int(length[0])
+	default:
+		return fmt.Errorf("unexpected address type %d", reply[3])
+	}
+	_, err := io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
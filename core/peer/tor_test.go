@@ -0,0 +1,154 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestIsOnionAddress(t *testing.T) {
+	for address, expected := range map[string]bool{
+		"expyuzz4wqqyqhjn.onion:30303": true,
+		"EXPYUZZ4WQQYQHJN.ONION:30303": true,
+		"expyuzz4wqqyqhjn.onion":       false,
+		"10.0.0.1:30303":               false,
+		"onion.example.com:30303":      false,
+	} {
+		if onion := isOnionAddress(address); onion != expected {
+			t.Errorf("Expected %s to be an onion address: %t, got %t", address, expected, onion)
+		}
+	}
+}
+
+func TestTorPeerAddressResolver(t *testing.T) {
+	defer viper.Set("peer.tor.enabled", viper.GetBool("peer.tor.enabled"))
+	registry := NewPeerRegistry()
+	id := &pb.PeerID{Name: "vp1"}
+	registry.Add(&pb.PeerEndpoint{ID: id, Address: "10.0.0.1:30303"})
+	registry.SetOnionAddress(id, "expyuzz4wqqyqhjn.onion:30303")
+	resolver := TorPeerAddressResolver{Registry: registry}
+
+	viper.Set("peer.tor.enabled", false)
+	if addresses, err := resolver.Resolve("10.0.0.1:30303"); err != nil || len(addresses) != 1 || addresses[0] != "10.0.0.1:30303" {
+		t.Fatalf("Expected the IP address with Tor disabled, got %v, %v", addresses, err)
+	}
+	viper.Set("peer.tor.enabled", true)
+	if addresses, err := resolver.Resolve("10.0.0.1:30303"); err != nil || len(addresses) != 1 || addresses[0] != "expyuzz4wqqyqhjn.onion:30303" {
+		t.Fatalf("Expected the onion address with Tor enabled, got %v, %v", addresses, err)
+	}
+	if addresses, err := resolver.Resolve("10.0.0.2:30303"); err != nil || len(addresses) != 1 || addresses[0] != "10.0.0.2:30303" {
+		t.Fatalf("Expected the address of a peer without onion address, got %v, %v", addresses, err)
+	}
+}
+
+func TestGossipDialAddress(t *testing.T) {
+	defer viper.Set("peer.tor.enabled", viper.GetBool("peer.tor.enabled"))
+	stack := newMockGossipStack(3)
+	stack.registry.SetRegion(stack.peers[0].ID, "eu-west")
+	stack.registry.SetOnionAddress(stack.peers[0].ID, "vp0onion.onion:30303")
+	stack.registry.SetRegion(stack.peers[1].ID, "us-east")
+	stack.registry.SetOnionAddress(stack.peers[1].ID, "vp1onion.onion:30303")
+	g := NewGossipTransactionPropagator(stack, 2, 3, nil)
+	g.PreferRegion("eu-west")
+
+	viper.Set("peer.tor.enabled", false)
+	if address := g.dialAddress(stack.peers[1].Address); address != stack.peers[1].Address {
+		t.Fatalf("Expected the IP address with Tor disabled, got %s", address)
+	}
+	viper.Set("peer.tor.enabled", true)
+	for i, expected := range []string{stack.peers[0].Address, "vp1onion.onion:30303", stack.peers[2].Address} {
+		if address := g.dialAddress(stack.peers[i].Address); address != expected {
+			t.Errorf("Expected peer %d to be dialed at %s, got %s", i, expected, address)
+		}
+	}
+}
+
+func TestDialSOCKS5(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	requested := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		greeting := make([]byte, 3)
+		io.ReadFull(conn, greeting)
+		conn.Write([]byte{5, 0})
+		header := make([]byte, 5)
+		io.ReadFull(conn, header)
+		rest := make([]byte, int(header[4])+2)
+		io.ReadFull(conn, rest)
+		requested <- append(header, rest...)
+		conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 80})
+		conn.Write([]byte("hello"))
+	}()
+	conn, err := dialSOCKS5(listener.Addr().String(), "expyuzz4wqqyqhjn.onion:30303", time.Second)
+	if err != nil {
+		t.Fatalf("Error dialing through the proxy: %s", err)
+	}
+	defer conn.Close()
+	expected := append([]byte{5, 1, 0, 3, 22}, "expyuzz4wqqyqhjn.onion"...)
+	port := make([]byte, 2)
+	binary.BigEndian.PutUint16(port, 30303)
+	expected = append(expected, port...)
+	if request := <-requested; !bytes.Equal(request, expected) {
+		t.Fatalf("Expected the CONNECT request %v, got %v", expected, request)
+	}
+	data := make([]byte, 5)
+	if _, err := io.ReadFull(conn, data); err != nil || string(data) != "hello" {
+		t.Fatalf("Expected to read through the proxied connection, got %q, %v", data, err)
+	}
+}
+
+func TestDialSOCKS5Refused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.ReadFull(conn, make([]byte, 3))
+		conn.Write([]byte{5, 0})
+		header := make([]byte, 5)
+		io.ReadFull(conn, header)
+		io.ReadFull(conn, make([]byte, int(header[4])+2))
+		// Host unreachable
+		conn.Write([]byte{5, 4, 0, 1, 0, 0, 0, 0, 0, 0})
+	}()
+	if _, err := dialSOCKS5(listener.Addr().String(), "expyuzz4wqqyqhjn.onion:30303", time.Second); err == nil {
+		t.Fatal("Expected a connection refused by the proxy to fail")
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+var txLimiterWaitHistogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Namespace: "peer",
+	Name:      "tx_limiter_wait_seconds",
+	Help:      "Time transactions waited for the peer.tx.maxTPS limiter before being processed.",
+})
+
+var fastPathCounter = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "peer",
+	Name:      "tx_fastpath_total",
+	Help:      "Number of CHAIN_TRANSACTIONS batches processed on the fast path, bypassing the peer.tx.maxTPS limiter.",
+})
+
+func init() {
+	prometheus.MustRegister(txLimiterWaitHistogram)
+	prometheus.MustRegister(fastPathCounter)
+}
+
+// TPSLimiter is a token bucket capping the rate at which transactions submitted
+// to this peer are processed. A nil TPSLimiter does not limit.
+type TPSLimiter struct {
+	limiter *rate.Limiter
+}
+
+// NewTPSLimiter returns a limiter allowing maxTPS transactions per second with
+// bursts of burstSize, or nil if maxTPS is not positive. A burstSize below 1
+// defaults to maxTPS.
+func NewTPSLimiter(maxTPS float64, burstSize int) *TPSLimiter {
+	if maxTPS <= 0 {
+		return nil
+	}
+	if burstSize < 1 {
+		burstSize = int(maxTPS)
+	}
+	if burstSize < 1 {
+		burstSize = 1
+	}
+	return &TPSLimiter{limiter: rate.NewLimiter(rate.Limit(maxTPS), burstSize)}
+}
+
+func newTPSLimiterFromConfig() *TPSLimiter {
+	return NewTPSLimiter(viper.GetFloat64("peer.tx.maxTPS"), viper.GetInt("peer.tx.burstSize"))
+}
+
+// Wait blocks until a transaction may be processed, returning the context
+// error if ctx is done first
+func (l *TPSLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	start := time.Now()
+	err := l.limiter.Wait(ctx)
+	txLimiterWaitHistogram.Observe(time.Since(start).Seconds())
+	return err
+}
+
+// isFastPath returns true if the priority of the batch is above
+// peer.tx.fastPathPriority, a threshold of 0 disabling the fast path
+func isFastPath(batch *pb.TransactionBlock) bool {
+	threshold := viper.GetInt("peer.tx.fastPathPriority")
+	return threshold > 0 && int(batch.Priority) > threshold
+}
@@ -0,0 +1,77 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestTPSLimiterUnlimited(t *testing.T) {
+	if l := NewTPSLimiter(0, 10); l != nil {
+		t.Fatal("Expected no limiter for 0 transactions per second")
+	}
+	var l *TPSLimiter
+	if err := l.Wait(context.Background()); err != nil {
+		t.Errorf("Expected a nil limiter not to limit, got %s", err)
+	}
+}
+
+func TestTPSLimiterBurst(t *testing.T) {
+	l := NewTPSLimiter(1, 2)
+	for i := 0; i < 2; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatalf("Expected transaction %d to be within the burst, got %s", i, err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err == nil {
+		t.Error("Expected the transaction over the burst to wait past the context deadline")
+	}
+}
+
+func TestTPSLimiterCancelled(t *testing.T) {
+	l := NewTPSLimiter(0.001, 1)
+	l.Wait(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.Wait(ctx); err == nil {
+		t.Error("Expected an error waiting with a cancelled context")
+	}
+}
+
+func TestIsFastPath(t *testing.T) {
+	defer viper.Set("peer.tx.fastPathPriority", viper.GetInt("peer.tx.fastPathPriority"))
+
+	viper.Set("peer.tx.fastPathPriority", 0)
+	if isFastPath(&pb.TransactionBlock{Priority: 100}) {
+		t.Error("Expected a threshold of 0 to disable the fast path")
+	}
+	viper.Set("peer.tx.fastPathPriority", 5)
+	if isFastPath(&pb.TransactionBlock{Priority: 5}) {
+		t.Error("Expected a batch of the threshold priority to be queued")
+	}
+	if !isFastPath(&pb.TransactionBlock{Priority: 6}) {
+		t.Error("Expected a batch above the threshold priority to take the fast path")
+	}
+}
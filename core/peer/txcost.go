@@ -0,0 +1,97 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// CostEstimate is what a transaction would cost: the Gas it would use, the
+// Fee it would pay and the Confidence, from 0 to 1, the estimate has
+type CostEstimate struct {
+	Gas        uint64
+	Fee        uint64
+	Confidence float32
+}
+
+// TransactionValidator interface enables a Peer to answer CHAIN_ESTIMATE_TX_COST messages
+type TransactionValidator interface {
+	EstimateCost(tx *pb.Transaction) (*CostEstimate, error)
+}
+
+// gasSchedule is the gas charged for a transaction: baseGas plus gasPerByte
+// for every byte of the marshalled transaction
+type gasSchedule struct {
+	baseGas    uint64
+	gasPerByte uint64
+}
+
+// gasScheduleFromConfig returns the schedule of peer.tx.baseGas and peer.tx.gasPerByte
+func gasScheduleFromConfig() gasSchedule {
+	return gasSchedule{baseGas: uint64(viper.GetInt("peer.tx.baseGas")), gasPerByte: uint64(viper.GetInt("peer.tx.gasPerByte"))}
+}
+
+// gas returns the gas charged for tx under the schedule
+func (s gasSchedule) gas(tx *pb.Transaction) uint64 {
+	return s.baseGas + s.gasPerByte*uint64(proto.Size(tx))
+}
+
+// estimateCost returns the cost of tx under the schedule at gasPrice per unit
+// of gas, with confidence clamped between 0 and 1
+func estimateCost(tx *pb.Transaction, schedule gasSchedule, gasPrice uint64, confidence float64) (*CostEstimate, error) {
+	if tx == nil {
+		return nil, fmt.Errorf("No transaction given")
+	}
+	gas := schedule.gas(tx)
+	if confidence < 0 {
+		confidence = 0
+	} else if confidence > 1 {
+		confidence = 1
+	}
+	return &CostEstimate{Gas: gas, Fee: gas * gasPrice, Confidence: float32(confidence)}, nil
+}
+
+// EstimateCost returns the cost of the transaction under the gas schedule of
+// peer.tx.baseGas and peer.tx.gasPerByte, at the lowest gas price of the
+// peer. The chaincode execution not being metered, the confidence is
+// peer.tx.costConfidence, 1 for deterministic chaincode.
+func (p *PeerImpl) EstimateCost(tx *pb.Transaction) (*CostEstimate, error) {
+	return estimateCost(tx, gasScheduleFromConfig(), p.gasOracle.MinGasPrice(), viper.GetFloat64("peer.tx.costConfidence"))
+}
+
+// EstimateTransactionCost asks the peer at address what the transaction would cost
+func EstimateTransactionCost(address string, tx *pb.Transaction) (*CostEstimate, error) {
+	data, err := proto.Marshal(&pb.EstimateTxCost{Tx: tx})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling EstimateTxCost: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_ESTIMATE_TX_COST, Payload: data}
+	reply, err := requestOverChat(address, request, pb.Message_CHAIN_TX_COST_ESTIMATE)
+	if err != nil {
+		return nil, fmt.Errorf("Error estimating cost of transaction %s at %s: %s", tx.Uuid, address, err)
+	}
+	estimate := &pb.TxCostEstimate{}
+	if err := proto.Unmarshal(reply.Payload, estimate); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling TxCostEstimate: %s", err)
+	}
+	return &CostEstimate{Gas: estimate.GasEstimate, Fee: estimate.FeeEstimate, Confidence: estimate.Confidence}, nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestEstimateCost(t *testing.T) {
+	tx := &pb.Transaction{Uuid: "tx1", Payload: make([]byte, 100)}
+	estimate, err := estimateCost(tx, gasSchedule{baseGas: 1000, gasPerByte: 2}, 3, 0.75)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gas := uint64(1000 + 2*proto.Size(tx))
+	if estimate.Gas != gas || estimate.Fee != 3*gas || estimate.Confidence != 0.75 {
+		t.Fatalf("Expected %d gas for a fee of %d with confidence 0.75, got %+v", gas, 3*gas, estimate)
+	}
+	larger, err := estimateCost(&pb.Transaction{Uuid: "tx1", Payload: make([]byte, 200)}, gasSchedule{baseGas: 1000, gasPerByte: 2}, 3, 0.75)
+	if err != nil || larger.Gas <= estimate.Gas {
+		t.Fatalf("Expected a larger transaction to cost more gas, got %+v, %v", larger, err)
+	}
+	for configured, expected := range map[float64]float32{-1: 0, 2: 1} {
+		if estimate, _ := estimateCost(tx, gasSchedule{}, 0, configured); estimate.Confidence != expected {
+			t.Errorf("Expected a confidence of %f to be clamped to %f, got %f", configured, expected, estimate.Confidence)
+		}
+	}
+	if _, err := estimateCost(nil, gasSchedule{}, 0, 1); err == nil {
+		t.Fatal("Expected an error without a transaction")
+	}
+}
+
+func TestEstimateTransactionCost(t *testing.T) {
+	tx := &pb.Transaction{Uuid: "tx1", Payload: []byte("payload")}
+	estimate, err := EstimateTransactionCost(viper.GetString("peer.address"), tx)
+	if err != nil {
+		t.Fatalf("Error estimating transaction cost: %s", err)
+	}
+	if estimate.Gas < uint64(viper.GetInt("peer.tx.baseGas")) || estimate.Confidence <= 0 {
+		t.Fatalf("Expected at least the base gas with a positive confidence, got %+v", estimate)
+	}
+}
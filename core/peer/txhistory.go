@@ -0,0 +1,98 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// GetTransactionHistory returns up to maxResults committed transactions of
+// the account timestamped from fromTime to toTime included, in Unix
+// nanoseconds, oldest first, following the transaction cursorTxID if set, and
+// the number of them in all. The transactions are looked up in the index the
+// ledger keeps by account and timestamp.
+func (p *PeerImpl) GetTransactionHistory(accountID string, fromTime, toTime int64, maxResults uint32, cursorTxID string) ([]*pb.Transaction, uint32, error) {
+	if accountID == "" {
+		return nil, 0, fmt.Errorf("No account ID given")
+	}
+	if toTime != 0 && toTime < fromTime {
+		return nil, 0, fmt.Errorf("Time range ends at %d before it starts at %d", toTime, fromTime)
+	}
+	p.ledgerWrapper.RLock()
+	defer p.ledgerWrapper.RUnlock()
+	return p.ledgerWrapper.ledger.GetTransactionHistory(accountID, fromTime, toTime, cursorTxID, maxResults)
+}
+
+// newTransactionHistoryResponse returns the CHAIN_TX_HISTORY_RESPONSE payload
+// of the transactions found out of total
+func newTransactionHistoryResponse(transactions []*pb.Transaction, total uint32) *pb.TransactionHistoryResponse {
+	return &pb.TransactionHistoryResponse{Transactions: transactions, Total: total, Truncated: total > uint32(len(transactions))}
+}
+
+// FetchTransactionHistory asks the peer at address for up to max committed
+// transactions of the account timestamped from from to to included, oldest
+// first, issuing a CHAIN_QUERY_TX_HISTORY for every page of transactions the
+// peer limits its replies to. max 0 fetches all of them.
+func FetchTransactionHistory(address, accountID string, from, to time.Time, max int) (transactions []*pb.Transaction, err error) {
+	err = withRequestStream(address, func(stream ChatStream) error {
+		transactions, err = fetchTransactionHistoryOverStream(stream, accountID, from.UnixNano(), to.UnixNano(), max)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching transaction history of account %s from %s: %s", accountID, address, err)
+	}
+	return transactions, nil
+}
+
+func fetchTransactionHistoryOverStream(stream ChatStream, accountID string, fromTime, toTime int64, max int) ([]*pb.Transaction, error) {
+	var transactions []*pb.Transaction
+	request := &pb.QueryTransactionHistory{AccountID: accountID, FromTime: fromTime, ToTime: toTime}
+	for max <= 0 || len(transactions) < max {
+		if max > 0 {
+			request.MaxResults = uint32(max - len(transactions))
+		}
+		data, err := proto.Marshal(request)
+		if err != nil {
+			return nil, fmt.Errorf("Error marshalling QueryTransactionHistory: %s", err)
+		}
+		reply, err := requestOverStream(stream, &pb.Message{Type: pb.Message_CHAIN_QUERY_TX_HISTORY, Payload: data}, pb.Message_CHAIN_TX_HISTORY_RESPONSE)
+		if err != nil {
+			return nil, err
+		}
+		page := &pb.TransactionHistoryResponse{}
+		if err := proto.Unmarshal(reply.Payload, page); err != nil {
+			return nil, fmt.Errorf("Error unmarshalling TransactionHistoryResponse: %s", err)
+		}
+		transactions = append(transactions, page.Transactions...)
+		if !page.Truncated {
+			break
+		}
+		if len(page.Transactions) == 0 {
+			return nil, fmt.Errorf("%s truncated without any transaction", pb.Message_CHAIN_TX_HISTORY_RESPONSE)
+		}
+		request.CursorTxID = page.Transactions[len(page.Transactions)-1].Uuid
+	}
+	if max > 0 && len(transactions) > max {
+		transactions = transactions[:max]
+	}
+	return transactions, nil
+}
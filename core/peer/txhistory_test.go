@@ -0,0 +1,99 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// serveTransactionHistory answers the CHAIN_QUERY_TX_HISTORY sent on the
+// stream with pages of up to pageSize of the transactions
+func serveTransactionHistory(t *testing.T, stream *handshakeStream, transactions []*pb.Transaction, pageSize int) {
+	defer close(stream.recv)
+	for msg := range stream.sent {
+		request := &pb.QueryTransactionHistory{}
+		proto.Unmarshal(msg.Payload, request)
+		remaining := transactions
+		if request.CursorTxID != "" {
+			for i, tx := range transactions {
+				if tx.Uuid == request.CursorTxID {
+					remaining = transactions[i+1:]
+				}
+			}
+		}
+		page := remaining
+		if len(page) > pageSize {
+			page = page[:pageSize]
+		}
+		if request.MaxResults > 0 && len(page) > int(request.MaxResults) {
+			page = page[:request.MaxResults]
+		}
+		data, _ := proto.Marshal(newTransactionHistoryResponse(page, uint32(len(remaining))))
+		stream.recv <- &pb.Message{Type: pb.Message_CHAIN_TX_HISTORY_RESPONSE, Payload: data}
+	}
+}
+
+func fetchTransactionHistoryPages(t *testing.T, transactions []*pb.Transaction, pageSize, max int) []*pb.Transaction {
+	stream := &handshakeStream{recv: make(chan *pb.Message, 1), sent: make(chan *pb.Message)}
+	go serveTransactionHistory(t, stream, transactions, pageSize)
+	defer close(stream.sent)
+	fetched, err := fetchTransactionHistoryOverStream(stream, "alice", 0, 0, max)
+	if err != nil {
+		t.Fatalf("Error fetching transaction history: %s", err)
+	}
+	return fetched
+}
+
+func TestFetchTransactionHistoryPages(t *testing.T) {
+	var transactions []*pb.Transaction
+	for i := 0; i < 5; i++ {
+		transactions = append(transactions, &pb.Transaction{Uuid: fmt.Sprintf("tx%d", i)})
+	}
+	if fetched := fetchTransactionHistoryPages(t, transactions, 2, 0); len(fetched) != 5 || fetched[4].Uuid != "tx4" {
+		t.Fatalf("Expected every transaction over three pages, got %v", fetched)
+	}
+	if fetched := fetchTransactionHistoryPages(t, transactions, 2, 3); len(fetched) != 3 || fetched[2].Uuid != "tx2" {
+		t.Fatalf("Expected the first three transactions, got %v", fetched)
+	}
+}
+
+func TestTransactionHistoryResponseTruncated(t *testing.T) {
+	transactions := []*pb.Transaction{{Uuid: "tx0"}}
+	if response := newTransactionHistoryResponse(transactions, 3); !response.Truncated || response.Total != 3 {
+		t.Errorf("Expected a truncated response of 3 transactions, got %v", response)
+	}
+	if response := newTransactionHistoryResponse(transactions, 1); response.Truncated {
+		t.Errorf("Expected a complete response, got %v", response)
+	}
+}
+
+func TestFetchTransactionHistoryUnknownAccount(t *testing.T) {
+	transactions, err := FetchTransactionHistory(viper.GetString("peer.address"), "unknown", time.Unix(0, 0), time.Now(), 10)
+	if err != nil {
+		t.Fatalf("Error fetching transaction history: %s", err)
+	}
+	if len(transactions) != 0 {
+		t.Fatalf("Expected no transactions of an unknown account, got %d", len(transactions))
+	}
+}
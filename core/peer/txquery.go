@@ -0,0 +1,74 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// FetchTransaction asks the peer at address for the committed transaction
+// txID. A *TransactionNotFoundError is returned if the peer has none.
+func FetchTransaction(address, txID string) (tx *pb.Transaction, err error) {
+	err = withRequestStream(address, func(stream ChatStream) error {
+		tx, err = fetchTransactionOverStream(stream, txID)
+		return err
+	})
+	if _, ok := err.(*TransactionNotFoundError); ok {
+		return nil, &TransactionNotFoundError{TxID: txID, Address: address}
+	} else if err != nil {
+		return nil, fmt.Errorf("Error fetching transaction %s from %s: %s", txID, address, err)
+	}
+	return tx, nil
+}
+
+func fetchTransactionOverStream(stream ChatStream, txID string) (*pb.Transaction, error) {
+	data, err := proto.Marshal(&pb.QueryTransaction{TxID: txID})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling QueryTransaction: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_QUERY_TX, Payload: data, Timestamp: util.CreateUtcTimestamp()}
+	if err := stream.Send(request); err != nil {
+		return nil, fmt.Errorf("Error sending %s: %s", request.Type, err)
+	}
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return nil, fmt.Errorf("Error waiting for %s: %s", pb.Message_CHAIN_TX_RESPONSE, err)
+		}
+		switch msg.Type {
+		case pb.Message_CHAIN_TX_RESPONSE:
+			response := &pb.TransactionResponse{}
+			if err := proto.Unmarshal(msg.Payload, response); err != nil {
+				return nil, fmt.Errorf("Error unmarshalling TransactionResponse: %s", err)
+			}
+			return response.Tx, nil
+		case pb.Message_CHAIN_TX_NOT_FOUND:
+			return nil, &TransactionNotFoundError{TxID: txID}
+		case pb.Message_RESPONSE:
+			response := &pb.Response{}
+			if err := proto.Unmarshal(msg.Payload, response); err == nil && response.Status == pb.Response_FAILURE {
+				return nil, fmt.Errorf("Error response to %s: %s", request.Type, response.Msg)
+			}
+		}
+		peerLogger.Debugf("Ignoring %s while waiting for %s", msg.Type, pb.Message_CHAIN_TX_RESPONSE)
+	}
+}
@@ -0,0 +1,50 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestFetchTransactionOverStream(t *testing.T) {
+	stream := &handshakeStream{recv: make(chan *pb.Message, 2), sent: make(chan *pb.Message, 1)}
+	data, _ := proto.Marshal(&pb.TransactionResponse{Tx: &pb.Transaction{Uuid: "tx1"}, BlockNumber: 3, TxIndex: 1})
+	stream.recv <- &pb.Message{Type: pb.Message_DISC_PING}
+	stream.recv <- &pb.Message{Type: pb.Message_CHAIN_TX_RESPONSE, Payload: data}
+	tx, err := fetchTransactionOverStream(stream, "tx1")
+	if err != nil || tx.Uuid != "tx1" {
+		t.Fatalf("Expected transaction tx1, got %v, %v", tx, err)
+	}
+	request := &pb.QueryTransaction{}
+	if msg := <-stream.sent; msg.Type != pb.Message_CHAIN_QUERY_TX || proto.Unmarshal(msg.Payload, request) != nil || request.TxID != "tx1" {
+		t.Errorf("Expected a CHAIN_QUERY_TX for tx1, got %s", msg.Type)
+	}
+}
+
+func TestFetchTransactionNotFound(t *testing.T) {
+	stream := &handshakeStream{recv: make(chan *pb.Message, 1), sent: make(chan *pb.Message, 1)}
+	stream.recv <- &pb.Message{Type: pb.Message_CHAIN_TX_NOT_FOUND}
+	if _, err := fetchTransactionOverStream(stream, "tx1"); err == nil {
+		t.Fatal("Expected an error for a transaction not found")
+	} else if _, ok := err.(*TransactionNotFoundError); !ok {
+		t.Errorf("Expected a TransactionNotFoundError, got %s", err)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// maxTrackedTransactions bounds the number of submitted transactions whose state is remembered
+const maxTrackedTransactions = 10000
+
+// TransactionStateStore reports the state of transactions
+type TransactionStateStore interface {
+	GetTransactionState(txID string) pb.TxState
+}
+
+// TransactionStateAccessor interface enables a Peer to hand out the TransactionStateStore
+// answering CHAIN_TRANSACTIONS_QUERY_STATUS messages
+type TransactionStateAccessor interface {
+	GetTransactionStateStore() TransactionStateStore
+}
+
+// transactionStateTracker is the default TransactionStateStore. Transactions
+// found on the blockchain are COMMITTED, otherwise the outcome of their
+// submission through this peer is reported.
+type transactionStateTracker struct {
+	sync.Mutex
+	committed func(txID string) bool
+	states    map[string]pb.TxState
+	order     []string
+}
+
+func newTransactionStateTracker(committed func(txID string) bool) *transactionStateTracker {
+	return &transactionStateTracker{committed: committed, states: make(map[string]pb.TxState)}
+}
+
+// submitted records the outcome of submitting the transaction, PENDING if it was accepted
+func (t *transactionStateTracker) submitted(txID string, accepted bool) {
+	t.Lock()
+	defer t.Unlock()
+	if _, ok := t.states[txID]; !ok {
+		if len(t.order) >= maxTrackedTransactions {
+			delete(t.states, t.order[0])
+			t.order = t.order[1:]
+		}
+		t.order = append(t.order, txID)
+	}
+	if accepted {
+		t.states[txID] = pb.TxState_PENDING
+	} else {
+		t.states[txID] = pb.TxState_FAILED
+	}
+}
+
+func (t *transactionStateTracker) GetTransactionState(txID string) pb.TxState {
+	if t.committed(txID) {
+		return pb.TxState_COMMITTED
+	}
+	t.Lock()
+	defer t.Unlock()
+	if state, ok := t.states[txID]; ok {
+		return state
+	}
+	return pb.TxState_UNKNOWN
+}
+
+// getTransactionStatuses returns the state of each of the transactions in the store
+func getTransactionStatuses(store TransactionStateStore, txIDs []string) *pb.TransactionsStatusResponse {
+	statuses := make(map[string]pb.TxState, len(txIDs))
+	for _, txID := range txIDs {
+		statuses[txID] = store.GetTransactionState(txID)
+	}
+	return &pb.TransactionsStatusResponse{Statuses: statuses}
+}
+
+// QueryTransactionStatus asks the peer at address for the state of the transactions
+func QueryTransactionStatus(address string, txIDs []string) (map[string]pb.TxState, error) {
+	data, err := proto.Marshal(&pb.TransactionsQueryStatus{TxIDs: txIDs})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling TransactionsQueryStatus: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_TRANSACTIONS_QUERY_STATUS, Payload: data}
+	reply, err := requestOverChat(address, request, pb.Message_CHAIN_TRANSACTIONS_STATUS_RESPONSE)
+	if err != nil {
+		return nil, fmt.Errorf("Error querying transaction status from %s: %s", address, err)
+	}
+	response := &pb.TransactionsStatusResponse{}
+	if err := proto.Unmarshal(reply.Payload, response); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling TransactionsStatusResponse: %s", err)
+	}
+	return response.Statuses, nil
+}
@@ -0,0 +1,70 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestTransactionStateTracker(t *testing.T) {
+	committed := map[string]bool{"tx3": true}
+	tracker := newTransactionStateTracker(func(txID string) bool { return committed[txID] })
+	tracker.submitted("tx1", true)
+	tracker.submitted("tx2", false)
+	tracker.submitted("tx3", true)
+
+	expected := map[string]pb.TxState{
+		"tx1": pb.TxState_PENDING,
+		"tx2": pb.TxState_FAILED,
+		"tx3": pb.TxState_COMMITTED,
+		"tx4": pb.TxState_UNKNOWN,
+	}
+	statuses := getTransactionStatuses(tracker, []string{"tx1", "tx2", "tx3", "tx4"}).Statuses
+	for txID, state := range expected {
+		if statuses[txID] != state {
+			t.Errorf("Expected %s to be %s, got %s", txID, state, statuses[txID])
+		}
+	}
+}
+
+func TestTransactionStateTrackerBounded(t *testing.T) {
+	tracker := newTransactionStateTracker(func(string) bool { return false })
+	for i := 0; i <= maxTrackedTransactions; i++ {
+		tracker.submitted(fmt.Sprintf("tx%d", i), true)
+	}
+	if state := tracker.GetTransactionState("tx0"); state != pb.TxState_UNKNOWN {
+		t.Errorf("Expected the oldest transaction to be forgotten, got %s", state)
+	}
+	if state := tracker.GetTransactionState(fmt.Sprintf("tx%d", maxTrackedTransactions)); state != pb.TxState_PENDING {
+		t.Errorf("Expected the newest transaction to be tracked, got %s", state)
+	}
+}
+
+func TestQueryTransactionStatus(t *testing.T) {
+	statuses, err := QueryTransactionStatus(viper.GetString("peer.address"), []string{"not-a-transaction"})
+	if err != nil {
+		t.Fatalf("Error querying transaction status: %s", err)
+	}
+	if state, ok := statuses["not-a-transaction"]; !ok || state != pb.TxState_UNKNOWN {
+		t.Errorf("Expected unknown transaction to be UNKNOWN, got %v", statuses)
+	}
+}
@@ -0,0 +1,204 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// uncleLedger is the part of the ledger an uncle block is validated against
+type uncleLedger interface {
+	BlockChainAccessor
+	GetBlockByHash(hash []byte) (*pb.Block, uint64, error)
+}
+
+// validateUncle returns the number the uncle would have if it were on the
+// chain, or an error unless it is a known orphan which block includedIn, the
+// committed blocks or the next one, may include: its parent is on the chain,
+// it is not, and it is at most maxDepth blocks older than block includedIn.
+func validateUncle(blockchain uncleLedger, uncle *pb.Block, includedIn, maxDepth uint64) (uint64, error) {
+	if uncle == nil {
+		return 0, fmt.Errorf("No uncle block")
+	}
+	_, parentNumber, err := blockchain.GetBlockByHash(uncle.PreviousBlockHash)
+	if ledgerErr, ok := err.(*ledger.Error); ok && ledgerErr.Type() == ledger.ErrorTypeBlockNotFound {
+		return 0, fmt.Errorf("Unknown uncle parent %x", uncle.PreviousBlockHash)
+	} else if err != nil {
+		return 0, fmt.Errorf("Error getting uncle parent %x: %s", uncle.PreviousBlockHash, err)
+	}
+	number := parentNumber + 1
+	if number >= blockchain.GetBlockchainSize() {
+		return 0, fmt.Errorf("Uncle %d is not orphaned, no block %d was committed", number, number)
+	}
+	hash, err := uncle.GetHash()
+	if err != nil {
+		return 0, fmt.Errorf("Error hashing uncle: %s", err)
+	}
+	sibling, err := blockchain.GetBlockByNumber(number)
+	if err != nil {
+		return 0, fmt.Errorf("Error getting block %d: %s", number, err)
+	}
+	siblingHash, err := sibling.GetHash()
+	if err != nil {
+		return 0, fmt.Errorf("Error hashing block %d: %s", number, err)
+	}
+	if bytes.Equal(hash, siblingHash) {
+		return 0, fmt.Errorf("Uncle %x is block %d of the chain", hash, number)
+	}
+	if includedIn > blockchain.GetBlockchainSize() {
+		return 0, fmt.Errorf("Block %d including the uncle is beyond the chain", includedIn)
+	}
+	if includedIn <= number || includedIn-number > maxDepth {
+		return 0, fmt.Errorf("Uncle %d not within %d blocks before block %d", number, maxDepth, includedIn)
+	}
+	return number, nil
+}
+
+// includedUncle is an uncle block accepted for inclusion in a block
+type includedUncle struct {
+	block      *pb.Block
+	includedIn uint64
+}
+
+// uncleSet holds the uncle blocks accepted for each including block, up to
+// maxPerBlock of them, each uncle being included only once
+type uncleSet struct {
+	sync.Mutex
+	maxPerBlock int
+	byHash      map[string]*includedUncle
+	byBlock     map[uint64][]*pb.Block
+}
+
+func newUncleSet(maxPerBlock int) *uncleSet {
+	return &uncleSet{maxPerBlock: maxPerBlock, byHash: make(map[string]*includedUncle), byBlock: make(map[uint64][]*pb.Block)}
+}
+
+// add accepts the uncle hashing to hash for block includedIn, forgetting the
+// uncles of blocks before oldest, which can no longer change
+func (s *uncleSet) add(hash []byte, uncle *pb.Block, includedIn, oldest uint64) error {
+	s.Lock()
+	defer s.Unlock()
+	for blockNumber, uncles := range s.byBlock {
+		if blockNumber < oldest {
+			for _, block := range uncles {
+				blockHash, _ := block.GetHash()
+				delete(s.byHash, string(blockHash))
+			}
+			delete(s.byBlock, blockNumber)
+		}
+	}
+	if included, ok := s.byHash[string(hash)]; ok {
+		return fmt.Errorf("Uncle %x already included in block %d", hash, included.includedIn)
+	}
+	if len(s.byBlock[includedIn]) >= s.maxPerBlock {
+		return fmt.Errorf("Block %d already includes %d uncles", includedIn, s.maxPerBlock)
+	}
+	s.byHash[string(hash)] = &includedUncle{block: uncle, includedIn: includedIn}
+	s.byBlock[includedIn] = append(s.byBlock[includedIn], uncle)
+	return nil
+}
+
+// get returns the uncles accepted for block includedIn
+func (s *uncleSet) get(includedIn uint64) []*pb.Block {
+	s.Lock()
+	defer s.Unlock()
+	return append([]*pb.Block(nil), s.byBlock[includedIn]...)
+}
+
+// uncleMaxDepth returns peer.uncle.maxDepth, the number of blocks an uncle
+// may be older than the block including it
+func uncleMaxDepth() uint64 {
+	return uint64(viper.GetInt("peer.uncle.maxDepth"))
+}
+
+// AddUncle accepts the validated uncle for inclusion in block includedIn, for
+// the reward of its proposer. It returns an error if the uncle is already
+// included in a block or block includedIn already includes
+// peer.uncle.maxPerBlock uncles.
+func (p *PeerImpl) AddUncle(uncle *pb.Block, includedIn uint64) error {
+	hash, err := uncle.GetHash()
+	if err != nil {
+		return fmt.Errorf("Error hashing uncle: %s", err)
+	}
+	var oldest uint64
+	if height, maxDepth := p.GetBlockchainSize(), uncleMaxDepth(); height > maxDepth {
+		oldest = height - maxDepth
+	}
+	return p.uncles.add(hash, uncle, includedIn, oldest)
+}
+
+// GetUncles returns the uncles accepted for inclusion in block includedIn
+func (p *PeerImpl) GetUncles(includedIn uint64) []*pb.Block {
+	return p.uncles.get(includedIn)
+}
+
+// ReportUncle reports to the peer at address the orphaned uncle block as
+// included in block includedIn. An *UncleRejectedError is returned if the
+// peer rejects it.
+func ReportUncle(address string, uncle *pb.Block, includedIn uint64) error {
+	err := withRequestStream(address, func(stream ChatStream) error {
+		return reportUncleOverStream(stream, uncle, includedIn)
+	})
+	if rejected, ok := err.(*UncleRejectedError); ok {
+		return &UncleRejectedError{Reason: rejected.Reason, Address: address}
+	} else if err != nil {
+		return fmt.Errorf("Error reporting uncle to %s: %s", address, err)
+	}
+	return nil
+}
+
+func reportUncleOverStream(stream ChatStream, uncle *pb.Block, includedIn uint64) error {
+	data, err := proto.Marshal(&pb.ReportUncle{Uncle: uncle, IncludedInBlock: includedIn})
+	if err != nil {
+		return fmt.Errorf("Error marshalling ReportUncle: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_REPORT_UNCLE, Payload: data, Timestamp: util.CreateUtcTimestamp()}
+	if err := stream.Send(request); err != nil {
+		return fmt.Errorf("Error sending %s: %s", request.Type, err)
+	}
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return fmt.Errorf("Error waiting for %s: %s", pb.Message_CHAIN_UNCLE_ACCEPTED, err)
+		}
+		switch msg.Type {
+		case pb.Message_CHAIN_UNCLE_ACCEPTED:
+			return nil
+		case pb.Message_CHAIN_UNCLE_REJECTED:
+			response := &pb.UncleRejected{}
+			if err := proto.Unmarshal(msg.Payload, response); err != nil {
+				return fmt.Errorf("Error unmarshalling UncleRejected: %s", err)
+			}
+			return &UncleRejectedError{Reason: response.Reason}
+		case pb.Message_RESPONSE:
+			response := &pb.Response{}
+			if err := proto.Unmarshal(msg.Payload, response); err == nil && response.Status == pb.Response_FAILURE {
+				return fmt.Errorf("Error response to %s: %s", request.Type, response.Msg)
+			}
+		}
+		peerLogger.Debugf("Ignoring %s while waiting for %s", msg.Type, pb.Message_CHAIN_UNCLE_ACCEPTED)
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// testUncleLedger is a testBlockchain also looking blocks up by hash
+type testUncleLedger struct {
+	testBlockchain
+}
+
+func (l *testUncleLedger) GetBlockByHash(hash []byte) (*pb.Block, uint64, error) {
+	l.Lock()
+	defer l.Unlock()
+	for i, block := range l.blocks {
+		if blockHash, _ := block.GetHash(); bytes.Equal(blockHash, hash) {
+			return block, uint64(i), nil
+		}
+	}
+	return nil, 0, fmt.Errorf("No block %x", hash)
+}
+
+// newTestUncleLedger returns a chain of length blocks
+func newTestUncleLedger(t *testing.T, length int) *testUncleLedger {
+	l := &testUncleLedger{}
+	var previous []byte
+	for i := 0; i < length; i++ {
+		block := &pb.Block{PreviousBlockHash: previous, StateHash: []byte(fmt.Sprintf("state%d", i))}
+		l.blocks = append(l.blocks, block)
+		previous, _ = block.GetHash()
+	}
+	return l
+}
+
+// newTestUncle returns an orphan sibling of block number of the chain
+func newTestUncle(l *testUncleLedger, number int) *pb.Block {
+	return &pb.Block{PreviousBlockHash: l.blocks[number].PreviousBlockHash, StateHash: []byte(fmt.Sprintf("uncle%d", number))}
+}
+
+func TestValidateUncle(t *testing.T) {
+	l := newTestUncleLedger(t, 10)
+	if number, err := validateUncle(l, newTestUncle(l, 5), 8, 3); err != nil || number != 5 {
+		t.Fatalf("Expected a valid uncle of block 5, got %d, %v", number, err)
+	}
+	if _, err := validateUncle(l, newTestUncle(l, 8), 10, 3); err != nil {
+		t.Fatalf("Expected the next block to include the uncle: %s", err)
+	}
+	for _, invalid := range []struct {
+		name       string
+		uncle      *pb.Block
+		includedIn uint64
+	}{
+		{"too old", newTestUncle(l, 5), 9},
+		{"included before", newTestUncle(l, 5), 5},
+		{"beyond the chain", newTestUncle(l, 8), 11},
+		{"on the chain", l.blocks[5], 7},
+		{"unknown parent", &pb.Block{PreviousBlockHash: []byte("unknown")}, 7},
+		{"not orphaned", &pb.Block{PreviousBlockHash: mustHash(t, l.blocks[9])}, 10},
+	} {
+		if _, err := validateUncle(l, invalid.uncle, invalid.includedIn, 3); err == nil {
+			t.Errorf("Expected the uncle %s to be rejected", invalid.name)
+		}
+	}
+}
+
+func mustHash(t *testing.T, block *pb.Block) []byte {
+	hash, err := block.GetHash()
+	if err != nil {
+		t.Fatalf("Error hashing block: %s", err)
+	}
+	return hash
+}
+
+func TestUncleSetAdd(t *testing.T) {
+	l := newTestUncleLedger(t, 10)
+	set := newUncleSet(2)
+	uncles := []*pb.Block{newTestUncle(l, 4), newTestUncle(l, 5), newTestUncle(l, 6)}
+	if err := set.add(mustHash(t, uncles[0]), uncles[0], 7, 0); err != nil {
+		t.Fatalf("Error adding uncle: %s", err)
+	}
+	if err := set.add(mustHash(t, uncles[0]), uncles[0], 8, 0); err == nil {
+		t.Fatal("Expected an uncle included twice to be rejected")
+	}
+	if err := set.add(mustHash(t, uncles[1]), uncles[1], 7, 0); err != nil {
+		t.Fatalf("Error adding uncle: %s", err)
+	}
+	if err := set.add(mustHash(t, uncles[2]), uncles[2], 7, 0); err == nil {
+		t.Fatal("Expected a third uncle of block 7 to be rejected")
+	}
+	if included := set.get(7); len(included) != 2 {
+		t.Fatalf("Expected 2 uncles included in block 7, got %d", len(included))
+	}
+	// The uncles of block 7 are forgotten once older than the oldest block
+	if err := set.add(mustHash(t, uncles[0]), uncles[0], 9, 8); err != nil {
+		t.Fatalf("Expected a forgotten uncle to be accepted again: %s", err)
+	}
+	if included := set.get(7); len(included) != 0 {
+		t.Fatalf("Expected the uncles of block 7 to be forgotten, got %d", len(included))
+	}
+}
+
+func TestReportUncleUnknownParent(t *testing.T) {
+	address := viper.GetString("peer.address")
+	err := ReportUncle(address, &pb.Block{PreviousBlockHash: []byte("unknown")}, 1)
+	if rejected, ok := err.(*UncleRejectedError); !ok || rejected.Address != address {
+		t.Fatalf("Expected the uncle to be rejected by %s, got %v", address, err)
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// TransactionVerifier interface enables a Peer to answer CHAIN_VALIDATE_BLOCK messages
+type TransactionVerifier interface {
+	VerifyBatch(transactions []*pb.Transaction) []*pb.ValidationViolation
+}
+
+// validateBlockTimeout returns how long the transactions of a proposed block are verified, peer.consensus.validateTimeout
+func validateBlockTimeout() time.Duration {
+	return viper.GetDuration("peer.consensus.validateTimeout")
+}
+
+// validateBlock verifies the transactions of the block with verifier. A
+// verification taking longer than timeout reports the block invalid, a timeout
+// of 0 waits for it to complete.
+func validateBlock(verifier TransactionVerifier, block *pb.Block, timeout time.Duration) *pb.ValidationResult {
+	done := make(chan []*pb.ValidationViolation, 1)
+	go func() {
+		done <- verifier.VerifyBatch(block.Transactions)
+	}()
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case violations := <-done:
+		return newValidationResult(violations)
+	case <-expired:
+		return &pb.ValidationResult{Reason: fmt.Sprintf("Validation timed out after %s", timeout)}
+	}
+}
+
+// defaultMaxConcurrentValidations is the CHAIN_VALIDATE_BLOCK verified at
+// once if peer.consensus.maxConcurrentValidations is not set
+const defaultMaxConcurrentValidations = 4
+
+var blockValidations struct {
+	sync.Once
+	slots chan struct{}
+}
+
+// blockValidationSlots returns the semaphore bounding the CHAIN_VALIDATE_BLOCK
+// of all streams verified at once to peer.consensus.maxConcurrentValidations
+func blockValidationSlots() chan struct{} {
+	blockValidations.Do(func() {
+		max := viper.GetInt("peer.consensus.maxConcurrentValidations")
+		if max <= 0 {
+			max = defaultMaxConcurrentValidations
+		}
+		blockValidations.slots = make(chan struct{}, max)
+	})
+	return blockValidations.slots
+}
+
+// slotVerifier is a TransactionVerifier giving back a slot it was handed
+// once its verification completes, even after validateBlock timed it out
+type slotVerifier struct {
+	TransactionVerifier
+	slots chan struct{}
+}
+
+func (v slotVerifier) VerifyBatch(transactions []*pb.Transaction) []*pb.ValidationViolation {
+	defer func() { <-v.slots }()
+	return v.TransactionVerifier.VerifyBatch(transactions)
+}
+
+// newValidationResult collects the transactions of the violations, each once
+func newValidationResult(violations []*pb.ValidationViolation) *pb.ValidationResult {
+	if len(violations) == 0 {
+		return &pb.ValidationResult{Valid: true}
+	}
+	result := &pb.ValidationResult{}
+	seen := make(map[string]bool)
+	var reasons []string
+	for _, violation := range violations {
+		if !seen[violation.TxID] {
+			seen[violation.TxID] = true
+			result.InvalidTxIDs = append(result.InvalidTxIDs, violation.TxID)
+		}
+		reasons = append(reasons, fmt.Sprintf("%s: %s", violation.TxID, violation.Reason))
+	}
+	result.Reason = strings.Join(reasons, "; ")
+	return result
+}
+
+// VerifyBatch returns the violations of the transactions failing the
+// peer.tx.schemaFile schema or, with security enabled, the signature checks of
+// a validator
+func (p *PeerImpl) VerifyBatch(transactions []*pb.Transaction) []*pb.ValidationViolation {
+	p.optionsMutex.RLock()
+	validator := p.txValidator
+	p.optionsMutex.RUnlock()
+	_, violations := validator.ValidateBatch(transactions)
+	if secHelper := p.secHelper; p.isValidator && secHelper != nil {
+		for i, tx := range transactions {
+			if _, err := secHelper.TransactionPreValidation(tx); err != nil {
+				violations = append(violations, &pb.ValidationViolation{TxIndex: uint32(i), TxID: tx.Uuid, Reason: err.Error()})
+			}
+		}
+	}
+	return violations
+}
+
+// ValidateBlockAtPeer asks the peer at address to verify the transactions of a proposed block
+func ValidateBlockAtPeer(address string, block *pb.Block) (*pb.ValidationResult, error) {
+	data, err := proto.Marshal(&pb.ValidateBlock{Block: block})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling ValidateBlock: %s", err)
+	}
+	request := &pb.Message{Type: pb.Message_CHAIN_VALIDATE_BLOCK, Payload: data}
+	reply, err := requestOverChat(address, request, pb.Message_CHAIN_VALIDATE_BLOCK_RESULT)
+	if err != nil {
+		return nil, fmt.Errorf("Error validating block at %s: %s", address, err)
+	}
+	result := &pb.ValidationResult{}
+	if err := proto.Unmarshal(reply.Payload, result); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling ValidationResult: %s", err)
+	}
+	return result, nil
+}
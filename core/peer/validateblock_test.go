@@ -0,0 +1,95 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+type verifierFunc func(transactions []*pb.Transaction) []*pb.ValidationViolation
+
+func (f verifierFunc) VerifyBatch(transactions []*pb.Transaction) []*pb.ValidationViolation {
+	return f(transactions)
+}
+
+func TestValidateBlockCollectsInvalidTransactions(t *testing.T) {
+	block := &pb.Block{Transactions: []*pb.Transaction{{Uuid: "tx1"}, {Uuid: "tx2"}, {Uuid: "tx3"}}}
+	verifier := verifierFunc(func(transactions []*pb.Transaction) []*pb.ValidationViolation {
+		return []*pb.ValidationViolation{
+			{TxIndex: 0, TxID: "tx1", Field: "type", Reason: "unexpected"},
+			{TxIndex: 0, TxID: "tx1", Field: "payload", Reason: "missing"},
+			{TxIndex: 2, TxID: "tx3", Reason: "bad signature"},
+		}
+	})
+	result := validateBlock(verifier, block, time.Second)
+	if result.Valid {
+		t.Fatal("Expected the block to be invalid")
+	}
+	if !reflect.DeepEqual(result.InvalidTxIDs, []string{"tx1", "tx3"}) {
+		t.Errorf("Expected tx1 and tx3 to be invalid, got %v", result.InvalidTxIDs)
+	}
+	if result.Reason == "" {
+		t.Error("Expected a reason")
+	}
+
+	valid := validateBlock(verifierFunc(func([]*pb.Transaction) []*pb.ValidationViolation { return nil }), block, 0)
+	if !valid.Valid || len(valid.InvalidTxIDs) > 0 {
+		t.Errorf("Expected the block to be valid, got %v", valid)
+	}
+}
+
+func TestValidateBlockTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	slow := verifierFunc(func([]*pb.Transaction) []*pb.ValidationViolation {
+		<-release
+		return nil
+	})
+	result := validateBlock(slow, &pb.Block{}, 10*time.Millisecond)
+	if result.Valid {
+		t.Error("Expected a timed out validation to report the block invalid")
+	}
+}
+
+func TestSlotVerifierReleasesOnCompletion(t *testing.T) {
+	slots := make(chan struct{}, 1)
+	release := make(chan struct{})
+	slow := verifierFunc(func([]*pb.Transaction) []*pb.ValidationViolation {
+		<-release
+		return nil
+	})
+	slots <- struct{}{}
+	if result := validateBlock(slotVerifier{slow, slots}, &pb.Block{}, 10*time.Millisecond); result.Valid {
+		t.Fatal("Expected the validation to time out")
+	}
+	// The verification still runs, its slot is kept until it completes
+	select {
+	case slots <- struct{}{}:
+		t.Fatal("Expected the slot of the timed out verification to still be held")
+	default:
+	}
+	close(release)
+	select {
+	case slots <- struct{}{}:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the slot to be given back once the verification completed")
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/events/producer"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+var activeChatStreamsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "peer",
+	Name:      "active_chat_streams",
+	Help:      "Number of Chat streams currently open to or from this peer.",
+})
+
+func init() {
+	prometheus.MustRegister(activeChatStreamsGauge)
+}
+
+// WatermarkMonitor tracks the number of active Chat streams and emits a
+// WatermarkEvent when the count reaches the high watermark, and once it then
+// drops below the low watermark.
+type WatermarkMonitor struct {
+	sync.Mutex
+	active    int
+	high      int
+	low       int
+	aboveHigh bool
+	emit      func(level pb.WatermarkEvent_Level, active, watermark int)
+}
+
+// NewWatermarkMonitor returns a monitor for the given watermarks. A high
+// watermark of 0 disables the alerting, streams are still counted.
+func NewWatermarkMonitor(high, low int) *WatermarkMonitor {
+	return &WatermarkMonitor{high: high, low: low, emit: emitWatermarkEvent}
+}
+
+func newWatermarkMonitorFromConfig() *WatermarkMonitor {
+	return NewWatermarkMonitor(viper.GetInt("peer.chat.highWatermark"), viper.GetInt("peer.chat.lowWatermark"))
+}
+
+func emitWatermarkEvent(level pb.WatermarkEvent_Level, active, watermark int) {
+	if level == pb.WatermarkEvent_HIGH {
+		peerLogger.Warningf("Active chat streams (%d) reached the high watermark of %d", active, watermark)
+	} else {
+		peerLogger.Infof("Active chat streams (%d) dropped below the low watermark of %d", active, watermark)
+	}
+	if err := producer.Send(producer.CreateWatermarkEvent(level, uint32(active), uint32(watermark))); err != nil {
+		peerLogger.Errorf("Error sending watermark event: %s", err)
+	}
+}
+
+// SetWatermarks replaces the watermarks, taking effect from the next opened or closed stream
+func (w *WatermarkMonitor) SetWatermarks(high, low int) {
+	w.Lock()
+	defer w.Unlock()
+	w.high = high
+	w.low = low
+}
+
+// StreamOpened records a new active Chat stream
+func (w *WatermarkMonitor) StreamOpened() {
+	w.Lock()
+	defer w.Unlock()
+	w.active++
+	activeChatStreamsGauge.Inc()
+	if w.high > 0 && !w.aboveHigh && w.active >= w.high {
+		w.aboveHigh = true
+		w.emit(pb.WatermarkEvent_HIGH, w.active, w.high)
+	}
+}
+
+// StreamClosed records the end of an active Chat stream
+func (w *WatermarkMonitor) StreamClosed() {
+	w.Lock()
+	defer w.Unlock()
+	w.active--
+	activeChatStreamsGauge.Dec()
+	if w.aboveHigh && w.active < w.low {
+		w.aboveHigh = false
+		w.emit(pb.WatermarkEvent_LOW, w.active, w.low)
+	}
+}
+
+// ActiveChatStreams returns the number of active Chat streams
+func (w *WatermarkMonitor) ActiveChatStreams() int {
+	w.Lock()
+	defer w.Unlock()
+	return w.active
+}
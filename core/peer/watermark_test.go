@@ -0,0 +1,85 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func newTestWatermarkMonitor(high, low int) (*WatermarkMonitor, *[]pb.WatermarkEvent_Level) {
+	var levels []pb.WatermarkEvent_Level
+	w := NewWatermarkMonitor(high, low)
+	w.emit = func(level pb.WatermarkEvent_Level, active, watermark int) {
+		levels = append(levels, level)
+	}
+	return w, &levels
+}
+
+func TestWatermarkMonitorHysteresis(t *testing.T) {
+	w, levels := newTestWatermarkMonitor(3, 2)
+	for i := 0; i < 4; i++ {
+		w.StreamOpened()
+	}
+	if !reflect.DeepEqual(*levels, []pb.WatermarkEvent_Level{pb.WatermarkEvent_HIGH}) {
+		t.Fatalf("Expected a single HIGH event, got %v", *levels)
+	}
+	// Dropping to the low watermark is not below it
+	w.StreamClosed()
+	w.StreamClosed()
+	if len(*levels) != 1 {
+		t.Fatalf("Expected no LOW event at the low watermark, got %v", *levels)
+	}
+	w.StreamClosed()
+	if !reflect.DeepEqual(*levels, []pb.WatermarkEvent_Level{pb.WatermarkEvent_HIGH, pb.WatermarkEvent_LOW}) {
+		t.Fatalf("Expected a LOW event below the low watermark, got %v", *levels)
+	}
+	if w.ActiveChatStreams() != 1 {
+		t.Errorf("Expected 1 active chat stream, got %d", w.ActiveChatStreams())
+	}
+}
+
+func TestWatermarkMonitorDisabled(t *testing.T) {
+	w, levels := newTestWatermarkMonitor(0, 0)
+	for i := 0; i < 10; i++ {
+		w.StreamOpened()
+	}
+	if len(*levels) != 0 {
+		t.Errorf("Expected no events with alerting disabled, got %v", *levels)
+	}
+}
+
+func TestStatsHandler(t *testing.T) {
+	w, _ := newTestWatermarkMonitor(0, 0)
+	w.StreamOpened()
+	w.StreamOpened()
+	p := &PeerImpl{watermarks: w}
+
+	rec := httptest.NewRecorder()
+	p.StatsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/stats", nil))
+	stats := &Stats{}
+	if err := json.Unmarshal(rec.Body.Bytes(), stats); err != nil {
+		t.Fatalf("Error unmarshalling stats: %s", err)
+	}
+	if stats.ActiveChatStreams != 2 {
+		t.Errorf("Expected 2 active chat streams, got %d", stats.ActiveChatStreams)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// ZKProofVerifier verifies the zero-knowledge proof of a privacy-preserving
+// transaction, returning an error if its zkProof does not hold
+type ZKProofVerifier interface {
+	Verify(tx *pb.Transaction) error
+}
+
+// ZKProofVerifierAccessor interface enables a Peer to hand out its ZKProofVerifier
+type ZKProofVerifierAccessor interface {
+	GetZKProofVerifier() ZKProofVerifier
+}
+
+// NoopZKProofVerifier is a ZKProofVerifier accepting every proof, for tests
+type NoopZKProofVerifier struct{}
+
+// Verify implements ZKProofVerifier
+func (NoopZKProofVerifier) Verify(tx *pb.Transaction) error {
+	return nil
+}
+
+// Groth16Verifier is the placeholder of a ZKProofVerifier of Groth16 proofs
+// against the VerifyingKey of the circuit. No proving library is vendored, so
+// Verify panics: a real verifier parses zkProof as the proof points, derives
+// the public inputs from the transaction and checks the pairing equation
+// against VerifyingKey, then replaces the panic below.
+type Groth16Verifier struct {
+	VerifyingKey []byte
+}
+
+// Verify implements ZKProofVerifier
+func (Groth16Verifier) Verify(tx *pb.Transaction) error {
+	panic("Groth16Verifier is not implemented, set a ZKProofVerifier backed by a proving library with SetZKProofVerifier")
+}
+
+// SetZKProofVerifier sets the ZKProofVerifier of the zkProof of the
+// transactions of CHAIN_TRANSACTIONS batches, used with peer.tx.zkProofEnabled.
+// nil, the default, fails every proof.
+func (p *PeerImpl) SetZKProofVerifier(verifier ZKProofVerifier) {
+	p.optionsMutex.Lock()
+	defer p.optionsMutex.Unlock()
+	p.zkVerifier = verifier
+}
+
+// GetZKProofVerifier returns the verifier of the zero-knowledge proofs of transactions
+func (p *PeerImpl) GetZKProofVerifier() ZKProofVerifier {
+	p.optionsMutex.RLock()
+	defer p.optionsMutex.RUnlock()
+	return p.zkVerifier
+}
+
+// verifyZKProofs returns the CHAIN_TRANSACTIONS_VALIDATION_ERROR rejecting a
+// batch with transactions whose zkProof fails verification, nil if all of them
+// hold. Transactions without a zkProof are not verified.
+func verifyZKProofs(batch *pb.TransactionBlock, verifier ZKProofVerifier) *pb.TransactionsValidationError {
+	var validationError *pb.TransactionsValidationError
+	for i, tx := range batch.Transactions {
+		if len(tx.ZkProof) == 0 {
+			continue
+		}
+		reason := "No zero-knowledge proof verifier set on this peer"
+		if verifier != nil {
+			err := verifier.Verify(tx)
+			if err == nil {
+				continue
+			}
+			reason = err.Error()
+		}
+		if validationError == nil {
+			validationError = &pb.TransactionsValidationError{Rejected: true}
+		}
+		validationError.Violations = append(validationError.Violations, &pb.ValidationViolation{
+			TxIndex: uint32(i),
+			TxID:    tx.Uuid,
+			Field:   "zkProof",
+			Reason:  reason,
+		})
+	}
+	return validationError
+}
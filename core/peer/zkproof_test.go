@@ -0,0 +1,74 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package peer
+
+import (
+	"errors"
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+type rejectingZKProofVerifier struct{}
+
+func (rejectingZKProofVerifier) Verify(tx *pb.Transaction) error {
+	if string(tx.ZkProof) != "valid" {
+		return errors.New("Proof does not hold")
+	}
+	return nil
+}
+
+func TestVerifyZKProofs(t *testing.T) {
+	batch := &pb.TransactionBlock{Transactions: []*pb.Transaction{
+		{Uuid: "plain"},
+		{Uuid: "valid", ZkProof: []byte("valid")},
+		{Uuid: "forged", ZkProof: []byte("forged")},
+	}}
+	if validationError := verifyZKProofs(batch, NoopZKProofVerifier{}); validationError != nil {
+		t.Fatalf("Expected the noop verifier to accept every proof, got %v", validationError)
+	}
+	validationError := verifyZKProofs(batch, rejectingZKProofVerifier{})
+	if validationError == nil || !validationError.Rejected || len(validationError.Violations) != 1 {
+		t.Fatalf("Expected the batch to be rejected over the forged proof, got %v", validationError)
+	}
+	if violation := validationError.Violations[0]; violation.TxIndex != 2 || violation.TxID != "forged" || violation.Field != "zkProof" {
+		t.Fatalf("Expected the forged transaction to be reported, got %v", violation)
+	}
+	if validationError := verifyZKProofs(batch, nil); validationError == nil || len(validationError.Violations) != 2 {
+		t.Fatalf("Expected every proof to fail without a verifier, got %v", validationError)
+	}
+}
+
+func TestGroth16VerifierNotImplemented(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected the Groth16 placeholder to panic")
+		}
+	}()
+	Groth16Verifier{}.Verify(&pb.Transaction{ZkProof: []byte("proof")})
+}
+
+func TestSetZKProofVerifier(t *testing.T) {
+	p := &PeerImpl{}
+	if p.GetZKProofVerifier() != nil {
+		t.Fatal("Expected no verifier by default")
+	}
+	p.SetZKProofVerifier(NoopZKProofVerifier{})
+	if _, ok := p.GetZKProofVerifier().(NoopZKProofVerifier); !ok {
+		t.Fatalf("Expected the verifier set, got %v", p.GetZKProofVerifier())
+	}
+}
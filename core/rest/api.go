@@ -20,6 +20,7 @@ import (
 	"errors"
 	"fmt"
 	"google/protobuf"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -32,6 +33,9 @@ import (
 var (
 	// ErrNotFound is returned if a requested resource does not exist
 	ErrNotFound = errors.New("openchain: resource not found")
+
+	// ErrNotSupported is returned if the peer does not provide the requested data
+	ErrNotSupported = errors.New("openchain: not supported by the peer")
 )
 
 // PeerInfo defines API to peer info data
@@ -40,6 +44,21 @@ type PeerInfo interface {
 	GetPeerEndpoint() (*pb.PeerEndpoint, error)
 }
 
+// PeerUptimeInfo defines API to the availability recorded for the connected peers
+type PeerUptimeInfo interface {
+	GetPeerUptime(address string, window time.Duration) float64
+}
+
+// TransactionReceiptInfo defines API to the receipts issued for committed transactions
+type TransactionReceiptInfo interface {
+	GetTransactionReceipt(txID string) (*pb.TransactionReceipt, error)
+}
+
+// TopologyInfo defines API to the network topology known to the peer
+type TopologyInfo interface {
+	GetTopology() (*pb.Topology, error)
+}
+
 // ServerOpenchain defines the Openchain server object, which holds the
 // Ledger data structure and the pointer to the peerServer.
 type ServerOpenchain struct {
@@ -167,6 +186,35 @@ func (s *ServerOpenchain) GetPeers(ctx context.Context, e *google_protobuf.Empty
 	return s.peerInfo.GetPeers()
 }
 
+// GetPeerUptime returns the fraction of the window during which the peer at
+// address was reachable from the target peer.
+func (s *ServerOpenchain) GetPeerUptime(address string, window time.Duration) (float64, error) {
+	uptimeInfo, ok := s.peerInfo.(PeerUptimeInfo)
+	if !ok {
+		return 0, ErrNotSupported
+	}
+	return uptimeInfo.GetPeerUptime(address, window), nil
+}
+
+// GetTransactionReceipt returns the receipt of the target peer proving the
+// transaction was committed.
+func (s *ServerOpenchain) GetTransactionReceipt(txID string) (*pb.TransactionReceipt, error) {
+	receiptInfo, ok := s.peerInfo.(TransactionReceiptInfo)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return receiptInfo.GetTransactionReceipt(txID)
+}
+
+// GetTopology returns the peers the target peer knows of and the Chats between them.
+func (s *ServerOpenchain) GetTopology() (*pb.Topology, error) {
+	topologyInfo, ok := s.peerInfo.(TopologyInfo)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return topologyInfo.GetTopology()
+}
+
 // GetPeerEndpoint returns PeerEndpoint info of target peer.
 func (s *ServerOpenchain) GetPeerEndpoint(ctx context.Context, e *google_protobuf.Empty) (*pb.PeersMessage, error) {
 	peers := []*pb.PeerEndpoint{}
@@ -22,6 +22,7 @@ import (
 	"google/protobuf"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/hyperledger/fabric/core/ledger"
 	"github.com/hyperledger/fabric/core/util"
@@ -70,6 +71,23 @@ func (p *peerInfo) GetPeerEndpoint() (*protos.PeerEndpoint, error) {
 	return pe, nil
 }
 
+func (p *peerInfo) GetPeerUptime(address string, window time.Duration) float64 {
+	if address == "localhost:30303" {
+		return 0.5
+	}
+	return 0
+}
+
+// lateTxCommittedAt is when the receipt of late-tx becomes available
+var lateTxCommittedAt time.Time
+
+func (p *peerInfo) GetTransactionReceipt(txID string) (*protos.TransactionReceipt, error) {
+	if txID == "committed-tx" || (txID == "late-tx" && time.Now().After(lateTxCommittedAt)) {
+		return &protos.TransactionReceipt{TxID: txID, BlockNumber: 1}, nil
+	}
+	return nil, fmt.Errorf("Transaction %s not found", txID)
+}
+
 func TestServerOpenchain_API_GetBlockchainInfo(t *testing.T) {
 	// Construct a ledger with 0 blocks.
 	ledger := ledger.InitTestLedger(t)
@@ -0,0 +1,90 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// receiptPushTimeout is how long a pushed receipt waits for its transaction to be committed
+	receiptPushTimeout = 30 * time.Second
+
+	// receiptPollInterval is how often a pushed receipt checks whether its transaction was committed
+	receiptPollInterval = 500 * time.Millisecond
+)
+
+// pendingReceipts holds the transactions whose receipt was pushed to a client
+// but not yet delivered
+type pendingReceipts struct {
+	sync.Mutex
+	m map[string]time.Time
+}
+
+var receiptsPending = &pendingReceipts{m: make(map[string]time.Time)}
+
+// add records that the receipt of txID is awaited until deadline
+func (p *pendingReceipts) add(txID string, deadline time.Time) {
+	p.Lock()
+	defer p.Unlock()
+	p.m[txID] = deadline
+}
+
+// deadline returns until when the receipt of txID is awaited, false if it is not
+func (p *pendingReceipts) deadline(txID string) (time.Time, bool) {
+	p.Lock()
+	defer p.Unlock()
+	deadline, ok := p.m[txID]
+	return deadline, ok
+}
+
+func (p *pendingReceipts) remove(txID string) {
+	p.Lock()
+	defer p.Unlock()
+	delete(p.m, txID)
+}
+
+type pusherKey struct{}
+
+// withPusher makes the http.Pusher of HTTP/2 connections available to the
+// handlers through the request context
+func withPusher(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if pusher, ok := w.(http.Pusher); ok {
+			r = r.WithContext(context.WithValue(r.Context(), pusherKey{}, pusher))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// pushReceipt pushes the /receipt resource of txID to the client if its
+// connection supports server push. The pushed response is sent once the
+// transaction is committed, clients without push poll /receipt instead.
+func pushReceipt(r *http.Request, txID string) {
+	pusher, ok := r.Context().Value(pusherKey{}).(http.Pusher)
+	if !ok {
+		return
+	}
+	receiptsPending.add(txID, time.Now().Add(receiptPushTimeout))
+	if err := pusher.Push("/receipt/"+txID, nil); err != nil {
+		restLogger.Debugf("Unable to push receipt of transaction %s: %s", txID, err)
+		receiptsPending.remove(txID)
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -42,6 +43,7 @@ import (
 	"github.com/hyperledger/fabric/core/comm"
 	"github.com/hyperledger/fabric/core/crypto"
 	"github.com/hyperledger/fabric/core/crypto/primitives"
+	"github.com/hyperledger/fabric/core/peer"
 	pb "github.com/hyperledger/fabric/protos"
 )
 
@@ -1003,6 +1005,7 @@ func (s *ServerOpenchainREST) Invoke(rw web.ResponseWriter, req *web.Request) {
 	// Clients will need the txuuid in order to track it after invocation
 	txuuid := resp.Msg
 
+	pushReceipt(req.Request, string(txuuid))
 	rw.WriteHeader(http.StatusOK)
 	// Make a clarification in the invoke response message, that the transaction has been successfully submitted but not completed
 	fmt.Fprintf(rw, "{\"OK\": \"Successfully submitted invoke transaction.\",\"message\": \"%s\"}", string(txuuid))
@@ -1709,6 +1712,286 @@ func (s *ServerOpenchainREST) GetPeers(rw web.ResponseWriter, req *web.Request)
 	}
 }
 
+// peerSLA is the availability of a peer over a time window
+type peerSLA struct {
+	Address string  `json:"address"`
+	Window  string  `json:"window"`
+	Uptime  float64 `json:"uptime"`
+}
+
+// GetPeerSLA returns the fraction of time, within the window given by the
+// window query parameter (24h by default), during which the peer given by the
+// address query parameter was reachable from the target peer.
+func (s *ServerOpenchainREST) GetPeerSLA(rw web.ResponseWriter, req *web.Request) {
+	encoder := json.NewEncoder(rw)
+
+	address := req.URL.Query().Get("address")
+	if address == "" {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(restResult{Error: "Must specify the peer address."})
+		return
+	}
+	window := 24 * time.Hour
+	if param := req.URL.Query().Get("window"); param != "" {
+		var err error
+		window, err = time.ParseDuration(param)
+		if err != nil || window <= 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			encoder.Encode(restResult{Error: fmt.Sprintf("Window must be a positive duration, got %s.", param)})
+			return
+		}
+	}
+
+	uptime, err := s.server.GetPeerUptime(address, window)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		encoder.Encode(restResult{Error: err.Error()})
+		restLogger.Errorf("Error retrieving availability of peer %s: %s", address, err)
+		return
+	}
+
+	// Success
+	rw.WriteHeader(http.StatusOK)
+	encoder.Encode(peerSLA{Address: address, Window: window.String(), Uptime: uptime})
+}
+
+// GetTransactionReceipt returns the receipt of the target peer proving the
+// transaction was committed. While the receipt was pushed to the client and
+// not delivered yet, the response waits for the transaction to be committed.
+func (s *ServerOpenchainREST) GetTransactionReceipt(rw web.ResponseWriter, req *web.Request) {
+	encoder := json.NewEncoder(rw)
+	txID := req.PathParams["txid"]
+
+	deadline, pushed := receiptsPending.deadline(txID)
+	if pushed {
+		defer receiptsPending.remove(txID)
+	}
+	for {
+		receipt, err := s.server.GetTransactionReceipt(txID)
+		if err == nil {
+			// Success
+			rw.WriteHeader(http.StatusOK)
+			encoder.Encode(receipt)
+			return
+		}
+		if err == ErrNotSupported {
+			rw.WriteHeader(http.StatusInternalServerError)
+			encoder.Encode(restResult{Error: err.Error()})
+			return
+		}
+		if !pushed || time.Now().After(deadline) {
+			rw.WriteHeader(http.StatusNotFound)
+			encoder.Encode(restResult{Error: fmt.Sprintf("No receipt for transaction %s: %s", txID, err)})
+			return
+		}
+		time.Sleep(receiptPollInterval)
+	}
+}
+
+// FetchTransaction returns the committed transaction fetched from the peer given
+// by the peer query parameter.
+func (s *ServerOpenchainREST) FetchTransaction(rw web.ResponseWriter, req *web.Request) {
+	encoder := json.NewEncoder(rw)
+	txID := req.PathParams["txid"]
+
+	address := req.URL.Query().Get("peer")
+	if address == "" {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(restResult{Error: "Must specify the peer address."})
+		return
+	}
+
+	tx, err := peer.FetchTransaction(address, txID)
+	if err != nil {
+		if _, ok := err.(*peer.TransactionNotFoundError); ok {
+			rw.WriteHeader(http.StatusNotFound)
+			encoder.Encode(restResult{Error: fmt.Sprintf("Transaction %s is not found at %s.", txID, address)})
+			return
+		}
+		rw.WriteHeader(http.StatusInternalServerError)
+		encoder.Encode(restResult{Error: err.Error()})
+		restLogger.Errorf("Error fetching transaction %s from %s: %s", txID, address, err)
+		return
+	}
+
+	// Success
+	rw.WriteHeader(http.StatusOK)
+	encoder.Encode(tx)
+}
+
+// defaultRecentTransactionsLimit is the number of transactions returned by
+// /account/{id}/transactions without a limit parameter
+const defaultRecentTransactionsLimit = 50
+
+// FetchRecentTransactions asks the peer given by the peer query parameter for
+// the last committed transactions of an account, most recent first, up to the
+// limit query parameter.
+func (s *ServerOpenchainREST) FetchRecentTransactions(rw web.ResponseWriter, req *web.Request) {
+	encoder := json.NewEncoder(rw)
+	accountID := req.PathParams["id"]
+
+	address := req.URL.Query().Get("peer")
+	if address == "" {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(restResult{Error: "Must specify the peer address."})
+		return
+	}
+	limit := uint64(defaultRecentTransactionsLimit)
+	if value := req.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.ParseUint(value, 10, 32); err != nil || limit == 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			encoder.Encode(restResult{Error: fmt.Sprintf("Invalid limit %s, must be a positive integer.", value)})
+			return
+		}
+	}
+
+	transactions, err := peer.FetchRecentTransactions(address, accountID, uint32(limit))
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		encoder.Encode(restResult{Error: err.Error()})
+		restLogger.Errorf("Error fetching recent transactions of account %s from %s: %s", accountID, address, err)
+		return
+	}
+
+	// Success
+	rw.WriteHeader(http.StatusOK)
+	if transactions == nil {
+		transactions = []*pb.Transaction{}
+	}
+	encoder.Encode(transactions)
+}
+
+// defaultMempoolLimit is the number of transactions returned by /mempool
+// without a limit parameter
+const defaultMempoolLimit = 100
+
+// FetchMempool asks the peer given by the peer query parameter for its pending
+// transactions paying at least the minGas query parameter, up to the limit
+// query parameter.
+func (s *ServerOpenchainREST) FetchMempool(rw web.ResponseWriter, req *web.Request) {
+	encoder := json.NewEncoder(rw)
+
+	address := req.URL.Query().Get("peer")
+	if address == "" {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(restResult{Error: "Must specify the peer address."})
+		return
+	}
+	limit := uint64(defaultMempoolLimit)
+	if value := req.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.ParseUint(value, 10, 32); err != nil || limit == 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			encoder.Encode(restResult{Error: fmt.Sprintf("Invalid limit %s, must be a positive integer.", value)})
+			return
+		}
+	}
+	var minGas uint64
+	if value := req.URL.Query().Get("minGas"); value != "" {
+		var err error
+		if minGas, err = strconv.ParseUint(value, 10, 64); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			encoder.Encode(restResult{Error: fmt.Sprintf("Invalid minGas %s, must be a non-negative integer.", value)})
+			return
+		}
+	}
+
+	transactions, err := peer.FetchMempool(address, uint32(limit), minGas)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		encoder.Encode(restResult{Error: err.Error()})
+		restLogger.Errorf("Error fetching the mempool of %s: %s", address, err)
+		return
+	}
+
+	// Success
+	rw.WriteHeader(http.StatusOK)
+	if transactions == nil {
+		transactions = []*pb.Transaction{}
+	}
+	encoder.Encode(transactions)
+}
+
+// FetchStakingInfo asks the peer given by the peer query parameter for the
+// stake of the validator at the addr path parameter. Peers outside of a
+// proof-of-stake network are reported with 501 Not Implemented.
+func (s *ServerOpenchainREST) FetchStakingInfo(rw web.ResponseWriter, req *web.Request) {
+	encoder := json.NewEncoder(rw)
+	validatorAddress := req.PathParams["addr"]
+
+	address := req.URL.Query().Get("peer")
+	if address == "" {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(restResult{Error: "Must specify the peer address."})
+		return
+	}
+
+	info, err := peer.FetchStakingInfo(address, validatorAddress)
+	if err != nil {
+		if _, ok := err.(*peer.QueryUnsupportedError); ok {
+			rw.WriteHeader(http.StatusNotImplemented)
+		} else {
+			rw.WriteHeader(http.StatusInternalServerError)
+		}
+		encoder.Encode(restResult{Error: err.Error()})
+		restLogger.Errorf("Error fetching the stake of validator %s from %s: %s", validatorAddress, address, err)
+		return
+	}
+
+	// Success
+	rw.WriteHeader(http.StatusOK)
+	encoder.Encode(info)
+}
+
+// topologyNode is a node of a topology in the D3.js force layout format
+type topologyNode struct {
+	ID      string `json:"id"`
+	Address string `json:"address,omitempty"`
+}
+
+// topologyLink is a link of a topology in the D3.js force layout format
+type topologyLink struct {
+	Source    string `json:"source"`
+	Target    string `json:"target"`
+	LatencyMs uint32 `json:"latencyMs"`
+}
+
+// topologyGraph is a topology in the D3.js force layout format
+type topologyGraph struct {
+	Nodes []topologyNode `json:"nodes"`
+	Links []topologyLink `json:"links"`
+}
+
+func newTopologyGraph(topology *pb.Topology) *topologyGraph {
+	graph := &topologyGraph{Nodes: []topologyNode{}, Links: []topologyLink{}}
+	for _, node := range topology.Nodes {
+		graph.Nodes = append(graph.Nodes, topologyNode{ID: node.ID.Name, Address: node.Address})
+	}
+	for _, edge := range topology.Edges {
+		graph.Links = append(graph.Links, topologyLink{Source: edge.From.Name, Target: edge.To.Name, LatencyMs: edge.LatencyMs})
+	}
+	return graph
+}
+
+// GetTopology returns the peers the target peer knows of and the Chats between
+// them, as nodes and links a D3.js force layout can draw.
+func (s *ServerOpenchainREST) GetTopology(rw web.ResponseWriter, req *web.Request) {
+	encoder := json.NewEncoder(rw)
+
+	topology, err := s.server.GetTopology()
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		encoder.Encode(restResult{Error: err.Error()})
+		restLogger.Errorf("Error getting topology: %s", err)
+		return
+	}
+
+	// Success
+	rw.WriteHeader(http.StatusOK)
+	encoder.Encode(newTopologyGraph(topology))
+}
+
 // NotFound returns a custom landing page when a given hyperledger end point
 // had not been defined.
 func (s *ServerOpenchainREST) NotFound(rw web.ResponseWriter, r *web.Request) {
@@ -1742,8 +2025,16 @@ func buildOpenchainRESTRouter() *web.Router {
 	router.Post("/chaincode", (*ServerOpenchainREST).ProcessChaincode)
 
 	router.Get("/transactions/:uuid", (*ServerOpenchainREST).GetTransactionByUUID)
+	router.Get("/receipt/:txid", (*ServerOpenchainREST).GetTransactionReceipt)
+	router.Get("/transaction/:txid", (*ServerOpenchainREST).FetchTransaction)
+	router.Get("/account/:id/transactions", (*ServerOpenchainREST).FetchRecentTransactions)
+	router.Get("/mempool", (*ServerOpenchainREST).FetchMempool)
+	router.Get("/validator/:addr/staking", (*ServerOpenchainREST).FetchStakingInfo)
 
 	router.Get("/network/peers", (*ServerOpenchainREST).GetPeers)
+	router.Get("/topology", (*ServerOpenchainREST).GetTopology)
+
+	router.Get("/sla", (*ServerOpenchainREST).GetPeerSLA)
 
 	// Add not found page
 	router.NotFound((*ServerOpenchainREST).NotFound)
@@ -1761,7 +2052,7 @@ func StartOpenchainRESTServer(server *ServerOpenchain, devops *core.Devops) {
 	serverOpenchain = server
 	serverDevops = devops
 
-	router := buildOpenchainRESTRouter()
+	router := withPusher(buildOpenchainRESTRouter())
 
 	// Start server
 	if comm.TLSEnabled() {
@@ -464,6 +464,32 @@ func TestServerOpenchainREST_API_GetPeers(t *testing.T) {
 	}
 }
 
+func TestServerOpenchainREST_API_GetPeerSLA(t *testing.T) {
+	initGlobalServerOpenchain(t)
+
+	// Start the HTTP REST test server
+	httpServer := httptest.NewServer(buildOpenchainRESTRouter())
+	defer httpServer.Close()
+
+	body := performHTTPGet(t, httpServer.URL+"/sla?address=localhost:30303&window=1h")
+	var sla peerSLA
+	if err := json.Unmarshal(body, &sla); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if sla.Address != "localhost:30303" || sla.Window != "1h0m0s" || sla.Uptime != 0.5 {
+		t.Errorf("Unexpected SLA response: %+v", sla)
+	}
+
+	res := parseRESTResult(t, performHTTPGet(t, httpServer.URL+"/sla"))
+	if res.Error == "" {
+		t.Errorf("Expected an error when the peer address is missing")
+	}
+	res = parseRESTResult(t, performHTTPGet(t, httpServer.URL+"/sla?address=localhost:30303&window=soon"))
+	if res.Error == "" {
+		t.Errorf("Expected an error for an invalid window")
+	}
+}
+
 func TestServerOpenchainREST_API_Chaincode_InvalidRequests(t *testing.T) {
 	// Construct a ledger with 3 blocks.
 	ledger := ledger.InitTestLedger(t)
@@ -775,3 +801,85 @@ func TestServerOpenchainREST_API_NotFound(t *testing.T) {
 		t.Errorf("Expected an error when accessing non-existing endpoint, but got %#v", res.Error)
 	}
 }
+
+func TestServerOpenchainREST_API_GetTransactionReceipt(t *testing.T) {
+	initGlobalServerOpenchain(t)
+
+	// Start the HTTP REST test server
+	httpServer := httptest.NewServer(buildOpenchainRESTRouter())
+	defer httpServer.Close()
+
+	var receipt protos.TransactionReceipt
+	if err := json.Unmarshal(performHTTPGet(t, httpServer.URL+"/receipt/committed-tx"), &receipt); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if receipt.TxID != "committed-tx" || receipt.BlockNumber != 1 {
+		t.Errorf("Unexpected receipt: %+v", receipt)
+	}
+
+	lateTxCommittedAt = time.Now().Add(time.Hour)
+	res := parseRESTResult(t, performHTTPGet(t, httpServer.URL+"/receipt/late-tx"))
+	if res.Error == "" {
+		t.Errorf("Expected an error for the receipt of a transaction not committed yet")
+	}
+}
+
+func TestServerOpenchainREST_API_GetPushedTransactionReceipt(t *testing.T) {
+	initGlobalServerOpenchain(t)
+	defer func(interval time.Duration) { receiptPollInterval = interval }(receiptPollInterval)
+	receiptPollInterval = 10 * time.Millisecond
+
+	httpServer := httptest.NewServer(buildOpenchainRESTRouter())
+	defer httpServer.Close()
+
+	// A pushed receipt is sent once the transaction is committed
+	lateTxCommittedAt = time.Now().Add(50 * time.Millisecond)
+	receiptsPending.add("late-tx", time.Now().Add(time.Second))
+	var receipt protos.TransactionReceipt
+	if err := json.Unmarshal(performHTTPGet(t, httpServer.URL+"/receipt/late-tx"), &receipt); err != nil || receipt.TxID != "late-tx" {
+		t.Fatalf("Expected the receipt of late-tx once committed, got %+v, %v", receipt, err)
+	}
+	if _, ok := receiptsPending.deadline("late-tx"); ok {
+		t.Error("Expected the delivered receipt to no longer be pending")
+	}
+
+	// Until its deadline
+	lateTxCommittedAt = time.Now().Add(time.Hour)
+	receiptsPending.add("late-tx", time.Now().Add(50*time.Millisecond))
+	if res := parseRESTResult(t, performHTTPGet(t, httpServer.URL+"/receipt/late-tx")); res.Error == "" {
+		t.Error("Expected an error once the pushed receipt deadline passed")
+	}
+}
+
+// pushRecorder is a ResponseRecorder of a connection supporting server push
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	pushed []string
+}
+
+func (r *pushRecorder) Push(target string, opts *http.PushOptions) error {
+	r.pushed = append(r.pushed, target)
+	return nil
+}
+
+func TestPushReceipt(t *testing.T) {
+	handler := withPusher(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushReceipt(r, "pushed-tx")
+	}))
+	defer receiptsPending.remove("pushed-tx")
+
+	// Without server push support nothing is pushed
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/devops/invoke", nil))
+	if _, ok := receiptsPending.deadline("pushed-tx"); ok {
+		t.Error("Expected no pending receipt without server push support")
+	}
+
+	recorder := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/devops/invoke", nil))
+	if len(recorder.pushed) != 1 || recorder.pushed[0] != "/receipt/pushed-tx" {
+		t.Errorf("Expected /receipt/pushed-tx to be pushed, got %v", recorder.pushed)
+	}
+	if _, ok := receiptsPending.deadline("pushed-tx"); !ok {
+		t.Error("Expected the pushed receipt to be pending")
+	}
+}
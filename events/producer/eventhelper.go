@@ -34,3 +34,13 @@ func CreateChaincodeEvent(te *ehpb.ChaincodeEvent) *ehpb.Event {
 func CreateRejectionEvent(tx *ehpb.Transaction, errorMsg string) *ehpb.Event {
 	return &ehpb.Event{Event: &ehpb.Event_Rejection{Rejection: &ehpb.Rejection{Tx: tx, ErrorMsg: errorMsg}}}
 }
+
+//CreateWatermarkEvent creates an Event reporting that the given chat stream watermark was crossed
+func CreateWatermarkEvent(level ehpb.WatermarkEvent_Level, activeChatStreams, watermark uint32) *ehpb.Event {
+	return &ehpb.Event{Event: &ehpb.Event_Watermark{Watermark: &ehpb.WatermarkEvent{Level: level, ActiveChatStreams: activeChatStreams, Watermark: watermark}}}
+}
+
+//CreateBlockCorruptionEvent creates an Event reporting that a stored block does not hash to the hash its successor links to
+func CreateBlockCorruptionEvent(blockNumber uint64, expectedHash, actualHash []byte) *ehpb.Event {
+	return &ehpb.Event{Event: &ehpb.Event_Corruption{Corruption: &ehpb.BlockCorruptionEvent{BlockNumber: blockNumber, ExpectedHash: expectedHash, ActualHash: actualHash}}}
+}
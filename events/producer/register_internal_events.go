@@ -42,6 +42,10 @@ func getMessageType(e *pb.Event) pb.EventType {
 		return pb.EventType_CHAINCODE
 	case *pb.Event_Rejection:
 		return pb.EventType_REJECTION
+	case *pb.Event_Watermark:
+		return pb.EventType_WATERMARK
+	case *pb.Event_Corruption:
+		return pb.EventType_CORRUPTION
 	default:
 		return -1
 	}
@@ -52,5 +56,7 @@ func addInternalEventTypes() {
 	AddEventType(pb.EventType_BLOCK)
 	AddEventType(pb.EventType_CHAINCODE)
 	AddEventType(pb.EventType_REJECTION)
+	AddEventType(pb.EventType_WATERMARK)
+	AddEventType(pb.EventType_CORRUPTION)
 	AddEventType(pb.EventType_REGISTER)
 }
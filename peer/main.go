@@ -38,11 +38,12 @@ import (
 
 	"github.com/howeyc/gopass"
 	"github.com/op/go-logging"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/metadata"
 
 	"net/http"
 	_ "net/http/pprof"
@@ -67,6 +68,7 @@ const fabric = "hyperledger"
 const nodeFuncName = "node"
 const networkFuncName = "network"
 const chainFuncName = "chaincode"
+const adminFuncName = "admin"
 const cmdRoot = "core"
 const undefinedParamValue = ""
 
@@ -144,6 +146,29 @@ var nodeStopCmd = &cobra.Command{
 	},
 }
 
+var adminCmd = &cobra.Command{
+	Use:   adminFuncName,
+	Short: fmt.Sprintf("%s specific commands.", adminFuncName),
+	Long:  fmt.Sprintf("%s specific commands.", adminFuncName),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		core.LoggingInit(adminFuncName)
+	},
+}
+
+var (
+	adminLogLevel   string
+	adminLogLoggers []string
+)
+
+var adminSetLogLevelCmd = &cobra.Command{
+	Use:   "set-log-level",
+	Short: "Sets the log level of the running node.",
+	Long:  `Sets the log level of the named loggers of the running node, or its default log level if none are named.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setLogLevel()
+	},
+}
+
 var networkCmd = &cobra.Command{
 	Use:   networkFuncName,
 	Short: fmt.Sprintf("%s specific commands.", networkFuncName),
@@ -304,6 +329,11 @@ func main() {
 
 	mainCmd.AddCommand(versionCmd)
 	mainCmd.AddCommand(nodeCmd)
+
+	adminSetLogLevelCmd.Flags().StringVar(&adminLogLevel, "level", undefinedParamValue, "The log level to set, e.g. DEBUG")
+	adminSetLogLevelCmd.Flags().StringSliceVar(&adminLogLoggers, "logger", nil, "The name of a logger to set the level of, may be repeated")
+	adminCmd.AddCommand(adminSetLogLevelCmd)
+	mainCmd.AddCommand(adminCmd)
 	// Set the flags on the login command.
 	networkLoginCmd.PersistentFlags().StringVarP(&loginPW, "password", "p", undefinedParamValue, "The password for user. You will be requested to enter the password if this flag is not specified.")
 
@@ -361,7 +391,7 @@ func createEventHubServer() (net.Listener, *grpc.Server, error) {
 		//TODO - do we need different SSL material for events ?
 		var opts []grpc.ServerOption
 		if comm.TLSEnabled() {
-			creds, err := credentials.NewServerTLSFromFile(viper.GetString("peer.tls.cert.file"), viper.GetString("peer.tls.key.file"))
+			creds, err := comm.NewServerTLSFromFile(viper.GetString("peer.tls.cert.file"), viper.GetString("peer.tls.key.file"))
 			if err != nil {
 				return nil, nil, fmt.Errorf("Failed to generate credentials %v", err)
 			}
@@ -470,16 +500,21 @@ func serve(args []string) error {
 		logger.Infof("Privacy enabled status: false")
 	}
 
-	var opts []grpc.ServerOption
+	maxRecvMsgSize, maxSendMsgSize, err := comm.MessageSizeLimits()
+	if err != nil {
+		return err
+	}
+	logger.Infof("gRPC message size limits: %d MiB received, %d MiB sent", maxRecvMsgSize>>20, maxSendMsgSize>>20)
+	opts := []grpc.ServerOption{comm.MaxMsgSize(maxRecvMsgSize, maxSendMsgSize)}
 	if comm.TLSEnabled() {
-		creds, err := credentials.NewServerTLSFromFile(viper.GetString("peer.tls.cert.file"), viper.GetString("peer.tls.key.file"))
+		creds, err := comm.NewServerTLSFromFile(viper.GetString("peer.tls.cert.file"), viper.GetString("peer.tls.key.file"))
 		if err != nil {
 			grpclog.Fatalf("Failed to generate credentials %v", err)
 		}
-		opts = []grpc.ServerOption{grpc.Creds(creds)}
+		opts = append(opts, grpc.Creds(creds))
 	}
 
-	grpcServer := grpc.NewServer(opts...)
+	serverBuilder := comm.NewServerBuilder(opts...)
 
 	secHelper, err := getSecHelper()
 	if err != nil {
@@ -490,7 +525,7 @@ func serve(args []string) error {
 		return secHelper
 	}
 
-	registerChaincodeSupport(chaincode.DefaultChain, grpcServer, secHelper)
+	registerChaincodeSupport(chaincode.DefaultChain, serverBuilder, secHelper)
 
 	var peerServer *peer.PeerImpl
 
@@ -514,15 +549,21 @@ func serve(args []string) error {
 		return err
 	}
 
+	// Reload the configuration on SIGHUP
+	peer.NewSignalHandler(peerServer, peer.ConfigChangeHookFunc(func(config *peer.ReloadableConfig) { core.LoggingInitSpec(config.LoggingSpec) })).Start()
+
 	// Register the Peer server
-	pb.RegisterPeerServer(grpcServer, peerServer)
+	serverBuilder.RegisterService(pb.PeerServiceDesc, peerServer)
+
+	// Register the Health server
+	serverBuilder.RegisterService(pb.HealthServiceDesc, peer.NewHealthCheckServer(peerServer))
 
 	// Register the Admin server
-	pb.RegisterAdminServer(grpcServer, core.NewAdminServer())
+	serverBuilder.RegisterService(pb.AdminServiceDesc, core.NewAdminServer())
 
 	// Register Devops server
 	serverDevops := core.NewDevopsServer(peerServer)
-	pb.RegisterDevopsServer(grpcServer, serverDevops)
+	serverBuilder.RegisterService(pb.DevopsServiceDesc, serverDevops)
 
 	// Register the ServerOpenchain server
 	serverOpenchain, err := rest.NewOpenchainServerWithPeerInfo(peerServer)
@@ -531,7 +572,8 @@ func serve(args []string) error {
 		return err
 	}
 
-	pb.RegisterOpenchainServer(grpcServer, serverOpenchain)
+	serverBuilder.RegisterService(pb.OpenchainServiceDesc, serverOpenchain)
+	grpcServer := serverBuilder.Build()
 
 	// Create and register the REST service if configured
 	if viper.GetBool("rest.enabled") {
@@ -551,6 +593,15 @@ func serve(args []string) error {
 		sig := <-sigs
 		fmt.Println()
 		fmt.Println(sig)
+		// Let the Chat streams end before exiting, for rolling upgrades
+		ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("peer.drain.timeout"))
+		if drainErr := peerServer.Drain(ctx); drainErr != nil {
+			logger.Warningf("Error draining peer: %s", drainErr)
+		}
+		cancel()
+		if closeErr := peer.DefaultPeerConnectionPool().Close(); closeErr != nil {
+			logger.Warningf("Error closing peer connections: %s", closeErr)
+		}
 		serve <- nil
 	}()
 
@@ -583,8 +634,33 @@ func serve(args []string) error {
 		}()
 	}
 
+	if viper.GetBool("peer.metrics.enabled") {
+		go func() {
+			metricsListenAddress := viper.GetString("peer.metrics.listenAddress")
+			logger.Infof("Starting metrics server with listenAddress = %s", metricsListenAddress)
+			mux := http.NewServeMux()
+			mux.Handle("/stats", peerServer.StatsHandler())
+			mux.Handle("/healthz", peerServer.HealthzHandler())
+			mux.Handle("/latency", peerServer.LatencyHandler())
+			mux.Handle("/connections", peerServer.ConnectionsHandler())
+			mux.Handle("/dial-timeouts", peer.GetAdaptiveDialer().DialTimeoutsHandler())
+			mux.Handle("/messagetypes", peerServer.MessageTypesHandler())
+			mux.Handle("/debug/record", peerServer.RecordHandler())
+			mux.Handle("/contract/", peerServer.ContractStateHandler())
+			mux.Handle("/mempool/mingas", peerServer.MinGasHandler())
+			mux.Handle("/metrics", promhttp.Handler())
+			if metricsErr := http.ListenAndServe(metricsListenAddress, mux); metricsErr != nil {
+				logger.Errorf("Error starting metrics server: %s", metricsErr)
+			}
+		}()
+	}
+
 	// Block until grpc server exits
-	return <-serve
+	err = <-serve
+	if slaErr := peerServer.SaveSLA(); slaErr != nil {
+		logger.Errorf("Error saving peer availability data: %s", slaErr)
+	}
+	return err
 }
 
 func status() (err error) {
@@ -642,6 +718,26 @@ func stop() (err error) {
 	return err
 }
 
+func setLogLevel() error {
+	if _, err := logging.LogLevel(adminLogLevel); err != nil {
+		return fmt.Errorf("Invalid log level %q, must be one of CRITICAL, ERROR, WARNING, NOTICE, INFO or DEBUG", adminLogLevel)
+	}
+	clientConn, err := peer.NewPeerClientConnection()
+	if err != nil {
+		return fmt.Errorf("Error trying to connect to local peer: %s", err)
+	}
+	defer clientConn.Close()
+	serverClient := pb.NewAdminClient(clientConn)
+
+	ctx := metadata.NewContext(context.Background(), metadata.Pairs(core.AdminSecretMetadataKey, viper.GetString("peer.admin.secret")))
+	response, err := serverClient.SetLogLevel(ctx, &pb.LogLevelRequest{Level: adminLogLevel, Loggers: adminLogLoggers})
+	if err != nil {
+		return fmt.Errorf("Error setting log level of local peer: %s", err)
+	}
+	fmt.Println(response)
+	return nil
+}
+
 // login confirms the enrollmentID and secret password of the client with the
 // CA and stores the enrollment certificate and key in the Devops server.
 func networkLogin(args []string) (err error) {
@@ -739,7 +835,7 @@ func getCliFilePath() string {
 	return localStore
 }
 
-func registerChaincodeSupport(chainname chaincode.ChainName, grpcServer *grpc.Server, secHelper crypto.Peer) {
+func registerChaincodeSupport(chainname chaincode.ChainName, serverBuilder *comm.ServerBuilder, secHelper crypto.Peer) {
 	//get user mode
 	userRunsCC := false
 	if viper.GetString("chaincode.mode") == chaincode.DevModeUserRunsChaincode {
@@ -759,7 +855,7 @@ func registerChaincodeSupport(chainname chaincode.ChainName, grpcServer *grpc.Se
 	//Now that chaincode is initialized, register all system chaincodes.
 	system_chaincode.RegisterSysCCs()
 
-	pb.RegisterChaincodeSupportServer(grpcServer, ccSrv)
+	serverBuilder.RegisterService(pb.ChaincodeSupportServiceDesc, ccSrv)
 }
 
 func checkChaincodeCmdParams(cmd *cobra.Command) (err error) {
@@ -41,28 +41,143 @@ It has these top-level messages:
 	Interest
 	Register
 	Rejection
+	WatermarkEvent
+	BlockCorruptionEvent
 	Event
 	Transaction
 	TransactionBlock
+	ForwardingRecord
+	IndividualSignature
+	AggregateSignature
 	TransactionResult
 	Block
 	BlockchainInfo
 	NonHashData
+	HealthCheckRequest
+	HealthCheckResponse
 	PeerAddress
 	PeerID
 	PeerEndpoint
 	PeersMessage
+	GetPeers
+	QuorumGetPeers
+	GetPeersDiverse
+	PeerNode
+	PeerEdge
+	Topology
+	GetPeersDiff
+	PeersDiff
+	GetPeersRetryAfter
+	RegistryFull
+	Ping
+	PeersAddresses
+	BandwidthTest
+	BandwidthResult
+	PeerMetadata
+	GeoCoordinates
 	HelloMessage
+	HelloAuth
+	CapabilityMismatch
 	Message
+	GossipTransaction
+	TransactionsQueryStatus
+	TransactionsStatusResponse
 	Response
 	BlockState
 	SyncBlockRange
+	SyncCheckpoint
+	BlockHashesRequest
+	BlockHashList
+	SyncVerifyRequest
+	SyncVerifyResponse
+	BlockNumbers
 	SyncBlocks
+	BlockBatch
+	MessageFragment
 	SyncStateSnapshotRequest
 	SyncStateSnapshot
 	SyncStateDeltasRequest
 	SyncStateDeltas
+	QueryTransaction
+	TransactionResponse
+	RecentTransactionsCursor
+	QueryRecentTransactions
+	RecentTransactionsResponse
+	QueryTransactionHistory
+	TransactionHistoryResponse
+	QueryStateDiff
+	StateChange
+	StateDiffResponse
+	QueryContractState
+	ContractStateResponse
+	QueryEpoch
+	ValidatorInfo
+	EpochResponse
+	SyncPaused
+	TxOutPoint
+	QueryDoubleSpend
+	DoubleSpendResponse
+	ValidatePoW
+	PoWResult
+	EstimateTxCost
+	TxCostEstimate
+	GetCanonicalTip
+	CanonicalTip
+	QueryForkChoice
+	ChainTip
+	ForkChoice
+	ReportUncle
+	UncleAccepted
+	UncleRejected
+	QueryMempool
+	MempoolResponse
+	RollbackRequest
+	RollbackResponse
+	GetTransactionReceipt
+	TransactionReceipt
+	GetBlockHeader
+	BlockHeader
+	ValidatorVote
+	GetBlockBody
+	BlockBody
+	GetBlockProof
+	SPVProof
+	BlockProof
+	ValidationViolation
+	TransactionsValidationError
+	TransactionsVersionError
+	TransactionsError
+	TxFailure
+	TransactionsPartialAck
+	QueryStakingInfo
+	SlashingEvent
+	StakingInfo
+	QueryUnsupported
+	QueryAccount
+	AccountState
+	ValidateBlock
+	ValidationResult
+	TransactionsProgress
+	BlockSubscription
+	BlockSealed
+	SubscribedBlock
+	BlockRangeQuery
+	ChainSyncRequest
+	GetBlockByHash
+	BlockRangeDone
+	BlockAuditProof
+	GetStateRoot
+	StateRoot
+	TransactionProofRequest
+	MerkleProof
+	EncryptedTransaction
+	BlockProposal
+	BlockVote
+	BlockCommit
+	BlockVotes
 	ServerStatus
+	LogLevelRequest
+	LogLevelResponse
 */
 package protos
 
@@ -21,10 +21,12 @@ var _ = math.Inf
 type EventType int32
 
 const (
-	EventType_REGISTER  EventType = 0
-	EventType_BLOCK     EventType = 1
-	EventType_CHAINCODE EventType = 2
-	EventType_REJECTION EventType = 3
+	EventType_REGISTER   EventType = 0
+	EventType_BLOCK      EventType = 1
+	EventType_CHAINCODE  EventType = 2
+	EventType_REJECTION  EventType = 3
+	EventType_WATERMARK  EventType = 4
+	EventType_CORRUPTION EventType = 5
 )
 
 var EventType_name = map[int32]string{
@@ -32,18 +34,42 @@ var EventType_name = map[int32]string{
 	1: "BLOCK",
 	2: "CHAINCODE",
 	3: "REJECTION",
+	4: "WATERMARK",
+	5: "CORRUPTION",
 }
 var EventType_value = map[string]int32{
-	"REGISTER":  0,
-	"BLOCK":     1,
-	"CHAINCODE": 2,
-	"REJECTION": 3,
+	"REGISTER":   0,
+	"BLOCK":      1,
+	"CHAINCODE":  2,
+	"REJECTION":  3,
+	"WATERMARK":  4,
+	"CORRUPTION": 5,
 }
 
 func (x EventType) String() string {
 	return proto.EnumName(EventType_name, int32(x))
 }
 
+type WatermarkEvent_Level int32
+
+const (
+	WatermarkEvent_LOW  WatermarkEvent_Level = 0
+	WatermarkEvent_HIGH WatermarkEvent_Level = 1
+)
+
+var WatermarkEvent_Level_name = map[int32]string{
+	0: "LOW",
+	1: "HIGH",
+}
+var WatermarkEvent_Level_value = map[string]int32{
+	"LOW":  0,
+	"HIGH": 1,
+}
+
+func (x WatermarkEvent_Level) String() string {
+	return proto.EnumName(WatermarkEvent_Level_name, int32(x))
+}
+
 // ChaincodeReg is used for registering chaincode Interests
 // when EventType is CHAINCODE
 type ChaincodeReg struct {
@@ -170,6 +196,32 @@ func (m *Rejection) GetTx() *Transaction {
 	return nil
 }
 
+// WatermarkEvent is sent by the peer when its number of active chat streams
+// crosses the configured high or low watermark
+// string type - "watermark"
+type WatermarkEvent struct {
+	Level             WatermarkEvent_Level `protobuf:"varint,1,opt,name=level,enum=protos.WatermarkEvent_Level" json:"level,omitempty"`
+	ActiveChatStreams uint32               `protobuf:"varint,2,opt,name=activeChatStreams" json:"activeChatStreams,omitempty"`
+	Watermark         uint32               `protobuf:"varint,3,opt,name=watermark" json:"watermark,omitempty"`
+}
+
+func (m *WatermarkEvent) Reset()         { *m = WatermarkEvent{} }
+func (m *WatermarkEvent) String() string { return proto.CompactTextString(m) }
+func (*WatermarkEvent) ProtoMessage()    {}
+
+// BlockCorruptionEvent is sent by the peer when the stored block blockNumber
+// does not hash to the previousBlockHash of the block following it
+// string type - "corruption"
+type BlockCorruptionEvent struct {
+	BlockNumber  uint64 `protobuf:"varint,1,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	ExpectedHash []byte `protobuf:"bytes,2,opt,name=expectedHash,proto3" json:"expectedHash,omitempty"`
+	ActualHash   []byte `protobuf:"bytes,3,opt,name=actualHash,proto3" json:"actualHash,omitempty"`
+}
+
+func (m *BlockCorruptionEvent) Reset()         { *m = BlockCorruptionEvent{} }
+func (m *BlockCorruptionEvent) String() string { return proto.CompactTextString(m) }
+func (*BlockCorruptionEvent) ProtoMessage()    {}
+
 // ---------- producer events ---------
 // Event is used by
 //  - consumers (adapters) to send Register
@@ -180,6 +232,8 @@ type Event struct {
 	//	*Event_Block
 	//	*Event_ChaincodeEvent
 	//	*Event_Rejection
+	//	*Event_Watermark
+	//	*Event_Corruption
 	Event isEvent_Event `protobuf_oneof:"Event"`
 }
 
@@ -203,11 +257,19 @@ type Event_ChaincodeEvent struct {
 type Event_Rejection struct {
 	Rejection *Rejection `protobuf:"bytes,4,opt,name=rejection,oneof"`
 }
+type Event_Watermark struct {
+	Watermark *WatermarkEvent `protobuf:"bytes,5,opt,name=watermark,oneof"`
+}
+type Event_Corruption struct {
+	Corruption *BlockCorruptionEvent `protobuf:"bytes,6,opt,name=corruption,oneof"`
+}
 
 func (*Event_Register) isEvent_Event()       {}
 func (*Event_Block) isEvent_Event()          {}
 func (*Event_ChaincodeEvent) isEvent_Event() {}
 func (*Event_Rejection) isEvent_Event()      {}
+func (*Event_Watermark) isEvent_Event()      {}
+func (*Event_Corruption) isEvent_Event()     {}
 
 func (m *Event) GetEvent() isEvent_Event {
 	if m != nil {
@@ -244,6 +306,20 @@ func (m *Event) GetRejection() *Rejection {
 	return nil
 }
 
+func (m *Event) GetWatermark() *WatermarkEvent {
+	if x, ok := m.GetEvent().(*Event_Watermark); ok {
+		return x.Watermark
+	}
+	return nil
+}
+
+func (m *Event) GetCorruption() *BlockCorruptionEvent {
+	if x, ok := m.GetEvent().(*Event_Corruption); ok {
+		return x.Corruption
+	}
+	return nil
+}
+
 // XXX_OneofFuncs is for the internal use of the proto package.
 func (*Event) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), []interface{}) {
 	return _Event_OneofMarshaler, _Event_OneofUnmarshaler, []interface{}{
@@ -251,6 +327,8 @@ func (*Event) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error,
 		(*Event_Block)(nil),
 		(*Event_ChaincodeEvent)(nil),
 		(*Event_Rejection)(nil),
+		(*Event_Watermark)(nil),
+		(*Event_Corruption)(nil),
 	}
 }
 
@@ -278,6 +356,16 @@ func _Event_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
 		if err := b.EncodeMessage(x.Rejection); err != nil {
 			return err
 		}
+	case *Event_Watermark:
+		b.EncodeVarint(5<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Watermark); err != nil {
+			return err
+		}
+	case *Event_Corruption:
+		b.EncodeVarint(6<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Corruption); err != nil {
+			return err
+		}
 	case nil:
 	default:
 		return fmt.Errorf("Event.Event has unexpected type %T", x)
@@ -320,6 +408,22 @@ func _Event_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer)
 		err := b.DecodeMessage(msg)
 		m.Event = &Event_Rejection{msg}
 		return true, err
+	case 5: // Event.watermark
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(WatermarkEvent)
+		err := b.DecodeMessage(msg)
+		m.Event = &Event_Watermark{msg}
+		return true, err
+	case 6: // Event.corruption
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(BlockCorruptionEvent)
+		err := b.DecodeMessage(msg)
+		m.Event = &Event_Corruption{msg}
+		return true, err
 	default:
 		return false, nil
 	}
@@ -327,6 +431,7 @@ func _Event_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer)
 
 func init() {
 	proto.RegisterEnum("protos.EventType", EventType_name, EventType_value)
+	proto.RegisterEnum("protos.WatermarkEvent_Level", WatermarkEvent_Level_name, WatermarkEvent_Level_value)
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -19,6 +19,60 @@ var _ = proto.Marshal
 var _ = fmt.Errorf
 var _ = math.Inf
 
+// TxState is the state of a transaction as known by the queried peer.
+type TxState int32
+
+const (
+	TxState_UNKNOWN   TxState = 0
+	TxState_PENDING   TxState = 1
+	TxState_COMMITTED TxState = 2
+	TxState_FAILED    TxState = 3
+)
+
+var TxState_name = map[int32]string{
+	0: "UNKNOWN",
+	1: "PENDING",
+	2: "COMMITTED",
+	3: "FAILED",
+}
+var TxState_value = map[string]int32{
+	"UNKNOWN":   0,
+	"PENDING":   1,
+	"COMMITTED": 2,
+	"FAILED":    3,
+}
+
+func (x TxState) String() string {
+	return proto.EnumName(TxState_name, int32(x))
+}
+
+// SyncBandwidthPolicy is the bandwidth a sync is served with. NORMAL is
+// capped by the serving peer at its peer.sync.maxBandwidthBytesPerSec,
+// THROTTLED at its peer.sync.throttledBandwidthBytesPerSec for background
+// syncs, and UNLIMITED is not capped.
+type SyncBandwidthPolicy int32
+
+const (
+	SyncBandwidthPolicy_NORMAL    SyncBandwidthPolicy = 0
+	SyncBandwidthPolicy_THROTTLED SyncBandwidthPolicy = 1
+	SyncBandwidthPolicy_UNLIMITED SyncBandwidthPolicy = 2
+)
+
+var SyncBandwidthPolicy_name = map[int32]string{
+	0: "NORMAL",
+	1: "THROTTLED",
+	2: "UNLIMITED",
+}
+var SyncBandwidthPolicy_value = map[string]int32{
+	"NORMAL":    0,
+	"THROTTLED": 1,
+	"UNLIMITED": 2,
+}
+
+func (x SyncBandwidthPolicy) String() string {
+	return proto.EnumName(SyncBandwidthPolicy_name, int32(x))
+}
+
 type Transaction_Type int32
 
 const (
@@ -52,6 +106,32 @@ func (x Transaction_Type) String() string {
 	return proto.EnumName(Transaction_Type_name, int32(x))
 }
 
+type HealthCheckResponse_Status int32
+
+const (
+	HealthCheckResponse_UNKNOWN   HealthCheckResponse_Status = 0
+	HealthCheckResponse_HEALTHY   HealthCheckResponse_Status = 1
+	HealthCheckResponse_DEGRADED  HealthCheckResponse_Status = 2
+	HealthCheckResponse_UNHEALTHY HealthCheckResponse_Status = 3
+)
+
+var HealthCheckResponse_Status_name = map[int32]string{
+	0: "UNKNOWN",
+	1: "HEALTHY",
+	2: "DEGRADED",
+	3: "UNHEALTHY",
+}
+var HealthCheckResponse_Status_value = map[string]int32{
+	"UNKNOWN":   0,
+	"HEALTHY":   1,
+	"DEGRADED":  2,
+	"UNHEALTHY": 3,
+}
+
+func (x HealthCheckResponse_Status) String() string {
+	return proto.EnumName(HealthCheckResponse_Status_name, int32(x))
+}
+
 type PeerEndpoint_Type int32
 
 const (
@@ -78,59 +158,367 @@ func (x PeerEndpoint_Type) String() string {
 type Message_Type int32
 
 const (
-	Message_UNDEFINED               Message_Type = 0
-	Message_DISC_HELLO              Message_Type = 1
-	Message_DISC_DISCONNECT         Message_Type = 2
-	Message_DISC_GET_PEERS          Message_Type = 3
-	Message_DISC_PEERS              Message_Type = 4
-	Message_DISC_NEWMSG             Message_Type = 5
-	Message_CHAIN_TRANSACTION       Message_Type = 6
-	Message_SYNC_GET_BLOCKS         Message_Type = 11
-	Message_SYNC_BLOCKS             Message_Type = 12
-	Message_SYNC_BLOCK_ADDED        Message_Type = 13
-	Message_SYNC_STATE_GET_SNAPSHOT Message_Type = 14
-	Message_SYNC_STATE_SNAPSHOT     Message_Type = 15
-	Message_SYNC_STATE_GET_DELTAS   Message_Type = 16
-	Message_SYNC_STATE_DELTAS       Message_Type = 17
-	Message_RESPONSE                Message_Type = 20
-	Message_CONSENSUS               Message_Type = 21
+	Message_UNDEFINED                           Message_Type = 0
+	Message_DISC_HELLO                          Message_Type = 1
+	Message_DISC_DISCONNECT                     Message_Type = 2
+	Message_DISC_GET_PEERS                      Message_Type = 3
+	Message_DISC_PEERS                          Message_Type = 4
+	Message_DISC_NEWMSG                         Message_Type = 5
+	Message_DISC_GET_PEERS_RETRY_AFTER          Message_Type = 8
+	Message_DISC_BANDWIDTH_TEST                 Message_Type = 18
+	Message_DISC_BANDWIDTH_RESULT               Message_Type = 19
+	Message_DISC_PEER_METADATA                  Message_Type = 27
+	Message_DISC_VERSION_MISMATCH               Message_Type = 28
+	Message_DISC_REGISTRY_FULL                  Message_Type = 32
+	Message_DISC_PING                           Message_Type = 42
+	Message_DISC_PONG                           Message_Type = 43
+	Message_DISC_GET_TOPOLOGY                   Message_Type = 58
+	Message_DISC_TOPOLOGY_RESPONSE              Message_Type = 59
+	Message_DISC_UNAUTHORIZED                   Message_Type = 63
+	Message_DISC_GET_PEERS_DIFF                 Message_Type = 64
+	Message_DISC_PEERS_DIFF                     Message_Type = 65
+	Message_CHAIN_TRANSACTION                   Message_Type = 6
+	Message_CHAIN_TRANSACTION_GOSSIP            Message_Type = 7
+	Message_CHAIN_TRANSACTIONS_QUERY_STATUS     Message_Type = 9
+	Message_CHAIN_TRANSACTIONS_STATUS_RESPONSE  Message_Type = 10
+	Message_CHAIN_TRANSACTIONS_GET_RECEIPT      Message_Type = 22
+	Message_CHAIN_TRANSACTIONS_RECEIPT          Message_Type = 23
+	Message_CHAIN_GET_BLOCK_HEADER              Message_Type = 29
+	Message_CHAIN_BLOCK_HEADER                  Message_Type = 30
+	Message_CHAIN_GET_BLOCK_BODY                Message_Type = 61
+	Message_CHAIN_BLOCK_BODY                    Message_Type = 62
+	Message_CHAIN_GET_BLOCK_PROOF               Message_Type = 66
+	Message_CHAIN_BLOCK_PROOF                   Message_Type = 67
+	Message_CHAIN_TRANSACTIONS_ENCRYPTED        Message_Type = 31
+	Message_CHAIN_TRANSACTIONS_PROOF_REQUEST    Message_Type = 33
+	Message_CHAIN_TRANSACTIONS_PROOF_RESPONSE   Message_Type = 34
+	Message_CHAIN_GET_STATE_ROOT                Message_Type = 35
+	Message_CHAIN_STATE_ROOT                    Message_Type = 36
+	Message_CHAIN_SUBSCRIBE_BLOCKS              Message_Type = 37
+	Message_CHAIN_UNSUBSCRIBE_BLOCKS            Message_Type = 38
+	Message_CHAIN_BLOCK                         Message_Type = 39
+	Message_CHAIN_NEW_BLOCK_SEALED              Message_Type = 70
+	Message_CHAIN_TRANSACTIONS                  Message_Type = 40
+	Message_CHAIN_TRANSACTIONS_VALIDATION_ERROR Message_Type = 41
+	Message_CHAIN_TRANSACTIONS_PROGRESS         Message_Type = 44
+	Message_CHAIN_QUERY_RANGE                   Message_Type = 45
+	Message_CHAIN_QUERY_RANGE_DONE              Message_Type = 46
+	Message_CHAIN_TRANSACTIONS_VERSION_ERROR    Message_Type = 47
+	Message_CHAIN_TRANSACTIONS_ERROR            Message_Type = 60
+	Message_CHAIN_VALIDATE_BLOCK                Message_Type = 50
+	Message_CHAIN_VALIDATE_BLOCK_RESULT         Message_Type = 51
+	Message_CHAIN_QUERY_TX                      Message_Type = 52
+	Message_CHAIN_TX_RESPONSE                   Message_Type = 53
+	Message_CHAIN_TX_NOT_FOUND                  Message_Type = 54
+	Message_CHAIN_QUERY_RECENT_TX               Message_Type = 68
+	Message_CHAIN_RECENT_TX_RESPONSE            Message_Type = 69
+	Message_CHAIN_QUERY_STATE_DIFF              Message_Type = 71
+	Message_CHAIN_STATE_DIFF_RESPONSE           Message_Type = 72
+	Message_CHAIN_SYNC_PAUSE                    Message_Type = 73
+	Message_CHAIN_SYNC_PAUSED                   Message_Type = 74
+	Message_CHAIN_SYNC_RESUME                   Message_Type = 75
+	Message_CHAIN_QUERY_DOUBLE_SPEND            Message_Type = 76
+	Message_CHAIN_DOUBLE_SPEND_RESPONSE         Message_Type = 77
+	Message_CHAIN_VALIDATE_POW                  Message_Type = 78
+	Message_CHAIN_VALIDATE_POW_RESULT           Message_Type = 79
+	Message_CHAIN_ESTIMATE_TX_COST              Message_Type = 80
+	Message_CHAIN_TX_COST_ESTIMATE              Message_Type = 81
+	Message_DISC_QUORUM_GET_PEERS               Message_Type = 82
+	Message_CHAIN_GET_CANONICAL_TIP             Message_Type = 83
+	Message_CHAIN_CANONICAL_TIP                 Message_Type = 84
+	Message_CHAIN_QUERY_MEMPOOL                 Message_Type = 85
+	Message_CHAIN_MEMPOOL_RESPONSE              Message_Type = 86
+	Message_CHAIN_ROLLBACK_REQUEST              Message_Type = 87
+	Message_CHAIN_ROLLBACK_RESPONSE             Message_Type = 88
+	Message_CHAIN_SYNC_REQUEST                  Message_Type = 89
+	Message_DISC_GET_PEERS_DIVERSE              Message_Type = 90
+	Message_DISC_HELLO_AUTH                     Message_Type = 91
+	Message_CHAIN_GET_BLOCK_BY_HASH             Message_Type = 92
+	Message_CHAIN_BLOCK_NOT_FOUND               Message_Type = 93
+	Message_CHAIN_SYNC_VERIFY_REQUEST           Message_Type = 94
+	Message_CHAIN_SYNC_VERIFY_RESPONSE          Message_Type = 95
+	Message_CHAIN_QUERY_CONTRACT_STATE          Message_Type = 96
+	Message_CHAIN_CONTRACT_STATE_RESPONSE       Message_Type = 97
+	Message_CHAIN_QUERY_EPOCH                   Message_Type = 98
+	Message_CHAIN_EPOCH_RESPONSE                Message_Type = 99
+	Message_CHAIN_BLOCK_BATCH                   Message_Type = 100
+	Message_CHAIN_MESSAGE_FRAGMENT              Message_Type = 101
+	Message_CHAIN_QUERY_FORK_CHOICE             Message_Type = 102
+	Message_CHAIN_FORK_CHOICE                   Message_Type = 103
+	Message_CHAIN_QUERY_TX_HISTORY              Message_Type = 104
+	Message_CHAIN_TX_HISTORY_RESPONSE           Message_Type = 105
+	Message_CHAIN_REPORT_UNCLE                  Message_Type = 106
+	Message_CHAIN_UNCLE_ACCEPTED                Message_Type = 107
+	Message_CHAIN_UNCLE_REJECTED                Message_Type = 108
+	Message_CHAIN_TRANSACTIONS_PARTIAL_ACK      Message_Type = 109
+	Message_CHAIN_QUERY_STAKING_INFO            Message_Type = 110
+	Message_CHAIN_STAKING_INFO_RESPONSE         Message_Type = 111
+	Message_CHAIN_QUERY_UNSUPPORTED             Message_Type = 112
+	Message_DISC_ACK                            Message_Type = 113
+	Message_CHAIN_QUERY_ACCOUNT                 Message_Type = 114
+	Message_CHAIN_ACCOUNT_RESPONSE              Message_Type = 115
+	Message_CHAIN_ACCOUNT_NOT_FOUND             Message_Type = 116
+	// OPAQUE carries any other message, type included, sealed by the
+	// TypeObfuscatingStream of the Chat.
+	Message_OPAQUE                    Message_Type = 117
+	Message_CHAIN_PROPOSE_BLOCK       Message_Type = 24
+	Message_CHAIN_VOTE_BLOCK          Message_Type = 25
+	Message_CHAIN_COMMIT_BLOCK        Message_Type = 26
+	Message_SYNC_GET_BLOCKS           Message_Type = 11
+	Message_SYNC_BLOCKS               Message_Type = 12
+	Message_SYNC_BLOCK_ADDED          Message_Type = 13
+	Message_SYNC_STATE_GET_SNAPSHOT   Message_Type = 14
+	Message_SYNC_STATE_SNAPSHOT       Message_Type = 15
+	Message_SYNC_STATE_GET_DELTAS     Message_Type = 16
+	Message_SYNC_STATE_DELTAS         Message_Type = 17
+	Message_SYNC_CHECKPOINT           Message_Type = 48
+	Message_SYNC_CHECKPOINT_MISMATCH  Message_Type = 49
+	Message_SYNC_GET_BLOCK_HASHES     Message_Type = 55
+	Message_SYNC_BLOCK_HASHES         Message_Type = 56
+	Message_SYNC_GET_BLOCKS_BY_NUMBER Message_Type = 57
+	Message_RESPONSE                  Message_Type = 20
+	Message_CONSENSUS                 Message_Type = 21
 )
 
 var Message_Type_name = map[int32]string{
-	0:  "UNDEFINED",
-	1:  "DISC_HELLO",
-	2:  "DISC_DISCONNECT",
-	3:  "DISC_GET_PEERS",
-	4:  "DISC_PEERS",
-	5:  "DISC_NEWMSG",
-	6:  "CHAIN_TRANSACTION",
-	11: "SYNC_GET_BLOCKS",
-	12: "SYNC_BLOCKS",
-	13: "SYNC_BLOCK_ADDED",
-	14: "SYNC_STATE_GET_SNAPSHOT",
-	15: "SYNC_STATE_SNAPSHOT",
-	16: "SYNC_STATE_GET_DELTAS",
-	17: "SYNC_STATE_DELTAS",
-	20: "RESPONSE",
-	21: "CONSENSUS",
+	0:   "UNDEFINED",
+	1:   "DISC_HELLO",
+	2:   "DISC_DISCONNECT",
+	3:   "DISC_GET_PEERS",
+	4:   "DISC_PEERS",
+	5:   "DISC_NEWMSG",
+	8:   "DISC_GET_PEERS_RETRY_AFTER",
+	18:  "DISC_BANDWIDTH_TEST",
+	19:  "DISC_BANDWIDTH_RESULT",
+	27:  "DISC_PEER_METADATA",
+	28:  "DISC_VERSION_MISMATCH",
+	32:  "DISC_REGISTRY_FULL",
+	42:  "DISC_PING",
+	43:  "DISC_PONG",
+	58:  "DISC_GET_TOPOLOGY",
+	59:  "DISC_TOPOLOGY_RESPONSE",
+	63:  "DISC_UNAUTHORIZED",
+	64:  "DISC_GET_PEERS_DIFF",
+	65:  "DISC_PEERS_DIFF",
+	6:   "CHAIN_TRANSACTION",
+	7:   "CHAIN_TRANSACTION_GOSSIP",
+	9:   "CHAIN_TRANSACTIONS_QUERY_STATUS",
+	10:  "CHAIN_TRANSACTIONS_STATUS_RESPONSE",
+	22:  "CHAIN_TRANSACTIONS_GET_RECEIPT",
+	23:  "CHAIN_TRANSACTIONS_RECEIPT",
+	29:  "CHAIN_GET_BLOCK_HEADER",
+	30:  "CHAIN_BLOCK_HEADER",
+	61:  "CHAIN_GET_BLOCK_BODY",
+	62:  "CHAIN_BLOCK_BODY",
+	66:  "CHAIN_GET_BLOCK_PROOF",
+	67:  "CHAIN_BLOCK_PROOF",
+	31:  "CHAIN_TRANSACTIONS_ENCRYPTED",
+	33:  "CHAIN_TRANSACTIONS_PROOF_REQUEST",
+	34:  "CHAIN_TRANSACTIONS_PROOF_RESPONSE",
+	35:  "CHAIN_GET_STATE_ROOT",
+	36:  "CHAIN_STATE_ROOT",
+	37:  "CHAIN_SUBSCRIBE_BLOCKS",
+	38:  "CHAIN_UNSUBSCRIBE_BLOCKS",
+	39:  "CHAIN_BLOCK",
+	70:  "CHAIN_NEW_BLOCK_SEALED",
+	40:  "CHAIN_TRANSACTIONS",
+	41:  "CHAIN_TRANSACTIONS_VALIDATION_ERROR",
+	44:  "CHAIN_TRANSACTIONS_PROGRESS",
+	45:  "CHAIN_QUERY_RANGE",
+	46:  "CHAIN_QUERY_RANGE_DONE",
+	47:  "CHAIN_TRANSACTIONS_VERSION_ERROR",
+	60:  "CHAIN_TRANSACTIONS_ERROR",
+	50:  "CHAIN_VALIDATE_BLOCK",
+	51:  "CHAIN_VALIDATE_BLOCK_RESULT",
+	52:  "CHAIN_QUERY_TX",
+	53:  "CHAIN_TX_RESPONSE",
+	54:  "CHAIN_TX_NOT_FOUND",
+	68:  "CHAIN_QUERY_RECENT_TX",
+	69:  "CHAIN_RECENT_TX_RESPONSE",
+	71:  "CHAIN_QUERY_STATE_DIFF",
+	72:  "CHAIN_STATE_DIFF_RESPONSE",
+	73:  "CHAIN_SYNC_PAUSE",
+	74:  "CHAIN_SYNC_PAUSED",
+	75:  "CHAIN_SYNC_RESUME",
+	76:  "CHAIN_QUERY_DOUBLE_SPEND",
+	77:  "CHAIN_DOUBLE_SPEND_RESPONSE",
+	78:  "CHAIN_VALIDATE_POW",
+	79:  "CHAIN_VALIDATE_POW_RESULT",
+	80:  "CHAIN_ESTIMATE_TX_COST",
+	81:  "CHAIN_TX_COST_ESTIMATE",
+	82:  "DISC_QUORUM_GET_PEERS",
+	83:  "CHAIN_GET_CANONICAL_TIP",
+	84:  "CHAIN_CANONICAL_TIP",
+	85:  "CHAIN_QUERY_MEMPOOL",
+	86:  "CHAIN_MEMPOOL_RESPONSE",
+	87:  "CHAIN_ROLLBACK_REQUEST",
+	88:  "CHAIN_ROLLBACK_RESPONSE",
+	89:  "CHAIN_SYNC_REQUEST",
+	90:  "DISC_GET_PEERS_DIVERSE",
+	91:  "DISC_HELLO_AUTH",
+	92:  "CHAIN_GET_BLOCK_BY_HASH",
+	93:  "CHAIN_BLOCK_NOT_FOUND",
+	94:  "CHAIN_SYNC_VERIFY_REQUEST",
+	95:  "CHAIN_SYNC_VERIFY_RESPONSE",
+	96:  "CHAIN_QUERY_CONTRACT_STATE",
+	97:  "CHAIN_CONTRACT_STATE_RESPONSE",
+	98:  "CHAIN_QUERY_EPOCH",
+	99:  "CHAIN_EPOCH_RESPONSE",
+	100: "CHAIN_BLOCK_BATCH",
+	101: "CHAIN_MESSAGE_FRAGMENT",
+	102: "CHAIN_QUERY_FORK_CHOICE",
+	103: "CHAIN_FORK_CHOICE",
+	104: "CHAIN_QUERY_TX_HISTORY",
+	105: "CHAIN_TX_HISTORY_RESPONSE",
+	106: "CHAIN_REPORT_UNCLE",
+	107: "CHAIN_UNCLE_ACCEPTED",
+	108: "CHAIN_UNCLE_REJECTED",
+	109: "CHAIN_TRANSACTIONS_PARTIAL_ACK",
+	110: "CHAIN_QUERY_STAKING_INFO",
+	111: "CHAIN_STAKING_INFO_RESPONSE",
+	112: "CHAIN_QUERY_UNSUPPORTED",
+	113: "DISC_ACK",
+	114: "CHAIN_QUERY_ACCOUNT",
+	115: "CHAIN_ACCOUNT_RESPONSE",
+	116: "CHAIN_ACCOUNT_NOT_FOUND",
+	117: "OPAQUE",
+	24:  "CHAIN_PROPOSE_BLOCK",
+	25:  "CHAIN_VOTE_BLOCK",
+	26:  "CHAIN_COMMIT_BLOCK",
+	11:  "SYNC_GET_BLOCKS",
+	12:  "SYNC_BLOCKS",
+	13:  "SYNC_BLOCK_ADDED",
+	14:  "SYNC_STATE_GET_SNAPSHOT",
+	15:  "SYNC_STATE_SNAPSHOT",
+	16:  "SYNC_STATE_GET_DELTAS",
+	17:  "SYNC_STATE_DELTAS",
+	48:  "SYNC_CHECKPOINT",
+	49:  "SYNC_CHECKPOINT_MISMATCH",
+	55:  "SYNC_GET_BLOCK_HASHES",
+	56:  "SYNC_BLOCK_HASHES",
+	57:  "SYNC_GET_BLOCKS_BY_NUMBER",
+	20:  "RESPONSE",
+	21:  "CONSENSUS",
 }
 var Message_Type_value = map[string]int32{
-	"UNDEFINED":               0,
-	"DISC_HELLO":              1,
-	"DISC_DISCONNECT":         2,
-	"DISC_GET_PEERS":          3,
-	"DISC_PEERS":              4,
-	"DISC_NEWMSG":             5,
-	"CHAIN_TRANSACTION":       6,
-	"SYNC_GET_BLOCKS":         11,
-	"SYNC_BLOCKS":             12,
-	"SYNC_BLOCK_ADDED":        13,
-	"SYNC_STATE_GET_SNAPSHOT": 14,
-	"SYNC_STATE_SNAPSHOT":     15,
-	"SYNC_STATE_GET_DELTAS":   16,
-	"SYNC_STATE_DELTAS":       17,
-	"RESPONSE":                20,
-	"CONSENSUS":               21,
+	"UNDEFINED":                           0,
+	"DISC_HELLO":                          1,
+	"DISC_DISCONNECT":                     2,
+	"DISC_GET_PEERS":                      3,
+	"DISC_PEERS":                          4,
+	"DISC_NEWMSG":                         5,
+	"DISC_GET_PEERS_RETRY_AFTER":          8,
+	"DISC_BANDWIDTH_TEST":                 18,
+	"DISC_BANDWIDTH_RESULT":               19,
+	"DISC_PEER_METADATA":                  27,
+	"DISC_VERSION_MISMATCH":               28,
+	"DISC_REGISTRY_FULL":                  32,
+	"DISC_PING":                           42,
+	"DISC_PONG":                           43,
+	"DISC_GET_TOPOLOGY":                   58,
+	"DISC_TOPOLOGY_RESPONSE":              59,
+	"DISC_UNAUTHORIZED":                   63,
+	"DISC_GET_PEERS_DIFF":                 64,
+	"DISC_PEERS_DIFF":                     65,
+	"CHAIN_TRANSACTION":                   6,
+	"CHAIN_TRANSACTION_GOSSIP":            7,
+	"CHAIN_TRANSACTIONS_QUERY_STATUS":     9,
+	"CHAIN_TRANSACTIONS_STATUS_RESPONSE":  10,
+	"CHAIN_TRANSACTIONS_GET_RECEIPT":      22,
+	"CHAIN_TRANSACTIONS_RECEIPT":          23,
+	"CHAIN_GET_BLOCK_HEADER":              29,
+	"CHAIN_BLOCK_HEADER":                  30,
+	"CHAIN_GET_BLOCK_BODY":                61,
+	"CHAIN_BLOCK_BODY":                    62,
+	"CHAIN_GET_BLOCK_PROOF":               66,
+	"CHAIN_BLOCK_PROOF":                   67,
+	"CHAIN_TRANSACTIONS_ENCRYPTED":        31,
+	"CHAIN_TRANSACTIONS_PROOF_REQUEST":    33,
+	"CHAIN_TRANSACTIONS_PROOF_RESPONSE":   34,
+	"CHAIN_GET_STATE_ROOT":                35,
+	"CHAIN_STATE_ROOT":                    36,
+	"CHAIN_SUBSCRIBE_BLOCKS":              37,
+	"CHAIN_UNSUBSCRIBE_BLOCKS":            38,
+	"CHAIN_BLOCK":                         39,
+	"CHAIN_NEW_BLOCK_SEALED":              70,
+	"CHAIN_TRANSACTIONS":                  40,
+	"CHAIN_TRANSACTIONS_VALIDATION_ERROR": 41,
+	"CHAIN_TRANSACTIONS_PROGRESS":         44,
+	"CHAIN_QUERY_RANGE":                   45,
+	"CHAIN_QUERY_RANGE_DONE":              46,
+	"CHAIN_TRANSACTIONS_VERSION_ERROR":    47,
+	"CHAIN_TRANSACTIONS_ERROR":            60,
+	"CHAIN_VALIDATE_BLOCK":                50,
+	"CHAIN_VALIDATE_BLOCK_RESULT":         51,
+	"CHAIN_QUERY_TX":                      52,
+	"CHAIN_TX_RESPONSE":                   53,
+	"CHAIN_TX_NOT_FOUND":                  54,
+	"CHAIN_QUERY_RECENT_TX":               68,
+	"CHAIN_RECENT_TX_RESPONSE":            69,
+	"CHAIN_QUERY_STATE_DIFF":              71,
+	"CHAIN_STATE_DIFF_RESPONSE":           72,
+	"CHAIN_SYNC_PAUSE":                    73,
+	"CHAIN_SYNC_PAUSED":                   74,
+	"CHAIN_SYNC_RESUME":                   75,
+	"CHAIN_QUERY_DOUBLE_SPEND":            76,
+	"CHAIN_DOUBLE_SPEND_RESPONSE":         77,
+	"CHAIN_VALIDATE_POW":                  78,
+	"CHAIN_VALIDATE_POW_RESULT":           79,
+	"CHAIN_ESTIMATE_TX_COST":              80,
+	"CHAIN_TX_COST_ESTIMATE":              81,
+	"DISC_QUORUM_GET_PEERS":               82,
+	"CHAIN_GET_CANONICAL_TIP":             83,
+	"CHAIN_CANONICAL_TIP":                 84,
+	"CHAIN_QUERY_MEMPOOL":                 85,
+	"CHAIN_MEMPOOL_RESPONSE":              86,
+	"CHAIN_ROLLBACK_REQUEST":              87,
+	"CHAIN_ROLLBACK_RESPONSE":             88,
+	"CHAIN_SYNC_REQUEST":                  89,
+	"DISC_GET_PEERS_DIVERSE":              90,
+	"DISC_HELLO_AUTH":                     91,
+	"CHAIN_GET_BLOCK_BY_HASH":             92,
+	"CHAIN_BLOCK_NOT_FOUND":               93,
+	"CHAIN_SYNC_VERIFY_REQUEST":           94,
+	"CHAIN_SYNC_VERIFY_RESPONSE":          95,
+	"CHAIN_QUERY_CONTRACT_STATE":          96,
+	"CHAIN_CONTRACT_STATE_RESPONSE":       97,
+	"CHAIN_QUERY_EPOCH":                   98,
+	"CHAIN_EPOCH_RESPONSE":                99,
+	"CHAIN_BLOCK_BATCH":                   100,
+	"CHAIN_MESSAGE_FRAGMENT":              101,
+	"CHAIN_QUERY_FORK_CHOICE":             102,
+	"CHAIN_FORK_CHOICE":                   103,
+	"CHAIN_QUERY_TX_HISTORY":              104,
+	"CHAIN_TX_HISTORY_RESPONSE":           105,
+	"CHAIN_REPORT_UNCLE":                  106,
+	"CHAIN_UNCLE_ACCEPTED":                107,
+	"CHAIN_UNCLE_REJECTED":                108,
+	"CHAIN_TRANSACTIONS_PARTIAL_ACK":      109,
+	"CHAIN_QUERY_STAKING_INFO":            110,
+	"CHAIN_STAKING_INFO_RESPONSE":         111,
+	"CHAIN_QUERY_UNSUPPORTED":             112,
+	"DISC_ACK":                            113,
+	"CHAIN_QUERY_ACCOUNT":                 114,
+	"CHAIN_ACCOUNT_RESPONSE":              115,
+	"CHAIN_ACCOUNT_NOT_FOUND":             116,
+	"OPAQUE":                              117,
+	"CHAIN_PROPOSE_BLOCK":                 24,
+	"CHAIN_VOTE_BLOCK":                    25,
+	"CHAIN_COMMIT_BLOCK":                  26,
+	"SYNC_GET_BLOCKS":                     11,
+	"SYNC_BLOCKS":                         12,
+	"SYNC_BLOCK_ADDED":                    13,
+	"SYNC_STATE_GET_SNAPSHOT":             14,
+	"SYNC_STATE_SNAPSHOT":                 15,
+	"SYNC_STATE_GET_DELTAS":               16,
+	"SYNC_STATE_DELTAS":                   17,
+	"SYNC_CHECKPOINT":                     48,
+	"SYNC_CHECKPOINT_MISMATCH":            49,
+	"SYNC_GET_BLOCK_HASHES":               55,
+	"SYNC_BLOCK_HASHES":                   56,
+	"SYNC_GET_BLOCKS_BY_NUMBER":           57,
+	"RESPONSE":                            20,
+	"CONSENSUS":                           21,
 }
 
 func (x Message_Type) String() string {
@@ -179,6 +567,17 @@ type Transaction struct {
 	ToValidators                   []byte                     `protobuf:"bytes,10,opt,name=toValidators,proto3" json:"toValidators,omitempty"`
 	Cert                           []byte                     `protobuf:"bytes,11,opt,name=cert,proto3" json:"cert,omitempty"`
 	Signature                      []byte                     `protobuf:"bytes,12,opt,name=signature,proto3" json:"signature,omitempty"`
+	// The number of IndividualSignature of distinct signers the transaction
+	// needs in the Message.CHAIN_TRANSACTIONS batch carrying it, 0 for none
+	RequiredSignatures uint32 `protobuf:"varint,13,opt,name=requiredSignatures" json:"requiredSignatures,omitempty"`
+	// The state keys of its chaincode the transaction reads and writes, for
+	// peers to detect the conflicts of concurrent transactions. Empty when
+	// not declared
+	ReadSet  []string `protobuf:"bytes,14,rep,name=readSet" json:"readSet,omitempty"`
+	WriteSet []string `protobuf:"bytes,15,rep,name=writeSet" json:"writeSet,omitempty"`
+	// The zero-knowledge proof of a privacy-preserving transaction, standing
+	// for the plaintext amounts it does not carry. Empty for none
+	ZkProof []byte `protobuf:"bytes,16,opt,name=zkProof,proto3" json:"zkProof,omitempty"`
 }
 
 func (m *Transaction) Reset()         { *m = Transaction{} }
@@ -192,9 +591,32 @@ func (m *Transaction) GetTimestamp() *google_protobuf.Timestamp {
 	return nil
 }
 
-// TransactionBlock carries a batch of transactions.
+// TransactionBlock carries a batch of transactions. hops lists the IDs of the
+// relay peers a Message.CHAIN_TRANSACTIONS batch was forwarded by, in order.
+// schemaVersion is the version of the transaction format of the batch, 0 for
+// senders predating it. gasLimit is the gas the transactions of the batch may
+// use in total, each paying gasPrice per unit of gas. A batch of a priority
+// above the peer.tx.fastPathPriority of the receiver is processed at once.
+// signatures are the multi-signatures of its transactions requiring some,
+// replaced by aggregateSignatures by the peer verifying them. executionEnv is
+// the virtual machine the transactions target, e.g. evm or wasm, empty for the
+// native chaincode execution of the peer. A batch resent with the
+// idempotencyKey of a batch the receiver already processed is answered as the
+// first was, without being processed again. channelID names the channel of
+// the receiver the batch is processed by, empty for none.
 type TransactionBlock struct {
-	Transactions []*Transaction `protobuf:"bytes,1,rep,name=transactions" json:"transactions,omitempty"`
+	Transactions        []*Transaction         `protobuf:"bytes,1,rep,name=transactions" json:"transactions,omitempty"`
+	Hops                []string               `protobuf:"bytes,2,rep,name=hops" json:"hops,omitempty"`
+	SchemaVersion       uint32                 `protobuf:"varint,3,opt,name=schemaVersion" json:"schemaVersion,omitempty"`
+	GasLimit            uint64                 `protobuf:"varint,4,opt,name=gasLimit" json:"gasLimit,omitempty"`
+	GasPrice            uint64                 `protobuf:"varint,5,opt,name=gasPrice" json:"gasPrice,omitempty"`
+	Priority            uint32                 `protobuf:"varint,6,opt,name=priority" json:"priority,omitempty"`
+	Signatures          []*IndividualSignature `protobuf:"bytes,7,rep,name=signatures" json:"signatures,omitempty"`
+	AggregateSignatures []*AggregateSignature  `protobuf:"bytes,8,rep,name=aggregateSignatures" json:"aggregateSignatures,omitempty"`
+	ForwardingChain     []*ForwardingRecord    `protobuf:"bytes,9,rep,name=forwardingChain" json:"forwardingChain,omitempty"`
+	ExecutionEnv        string                 `protobuf:"bytes,10,opt,name=executionEnv" json:"executionEnv,omitempty"`
+	IdempotencyKey      []byte                 `protobuf:"bytes,11,opt,name=idempotencyKey,proto3" json:"idempotencyKey,omitempty"`
+	ChannelID           string                 `protobuf:"bytes,12,opt,name=channelID" json:"channelID,omitempty"`
 }
 
 func (m *TransactionBlock) Reset()         { *m = TransactionBlock{} }
@@ -208,6 +630,77 @@ func (m *TransactionBlock) GetTransactions() []*Transaction {
 	return nil
 }
 
+func (m *TransactionBlock) GetSignatures() []*IndividualSignature {
+	if m != nil {
+		return m.Signatures
+	}
+	return nil
+}
+
+func (m *TransactionBlock) GetAggregateSignatures() []*AggregateSignature {
+	if m != nil {
+		return m.AggregateSignatures
+	}
+	return nil
+}
+
+func (m *TransactionBlock) GetForwardingChain() []*ForwardingRecord {
+	if m != nil {
+		return m.ForwardingChain
+	}
+	return nil
+}
+
+// ForwardingRecord is appended to the forwardingChain of a TransactionBlock
+// by every relay forwarding it, in the order of its hops. batchHash is the
+// hash of the transactions and gas of the batch as the relay forwarded it.
+// The relay signs the record, without its signature, following the records
+// before it.
+type ForwardingRecord struct {
+	PeerID    string                     `protobuf:"bytes,1,opt,name=peerID" json:"peerID,omitempty"`
+	BatchHash []byte                     `protobuf:"bytes,2,opt,name=batchHash,proto3" json:"batchHash,omitempty"`
+	Signature []byte                     `protobuf:"bytes,3,opt,name=signature,proto3" json:"signature,omitempty"`
+	Timestamp *google_protobuf.Timestamp `protobuf:"bytes,4,opt,name=timestamp" json:"timestamp,omitempty"`
+}
+
+func (m *ForwardingRecord) Reset()         { *m = ForwardingRecord{} }
+func (m *ForwardingRecord) String() string { return proto.CompactTextString(m) }
+func (*ForwardingRecord) ProtoMessage()    {}
+
+func (m *ForwardingRecord) GetTimestamp() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.Timestamp
+	}
+	return nil
+}
+
+// IndividualSignature is the signature by signerID of transaction txID of a
+// TransactionBlock, over the transaction without its own signature.
+type IndividualSignature struct {
+	TxID      string `protobuf:"bytes,1,opt,name=txID" json:"txID,omitempty"`
+	SignerID  string `protobuf:"bytes,2,opt,name=signerID" json:"signerID,omitempty"`
+	Signature []byte `protobuf:"bytes,3,opt,name=signature,proto3" json:"signature,omitempty"`
+}
+
+func (m *IndividualSignature) Reset()         { *m = IndividualSignature{} }
+func (m *IndividualSignature) String() string { return proto.CompactTextString(m) }
+func (*IndividualSignature) ProtoMessage()    {}
+
+// AggregateSignature replaces the IndividualSignature of transaction txID
+// once the receiving peer verified that enough signers signed it. The ecdsa
+// scheme cannot combine signatures, signatures then holding the verified
+// ECDSA signature of each of signerIDs in order.
+type AggregateSignature struct {
+	TxID       string   `protobuf:"bytes,1,opt,name=txID" json:"txID,omitempty"`
+	Scheme     string   `protobuf:"bytes,2,opt,name=scheme" json:"scheme,omitempty"`
+	SignerIDs  []string `protobuf:"bytes,3,rep,name=signerIDs" json:"signerIDs,omitempty"`
+	Signatures [][]byte `protobuf:"bytes,4,rep,name=signatures,proto3" json:"signatures,omitempty"`
+}
+
+func (m *AggregateSignature) Reset()         { *m = AggregateSignature{} }
+func (m *AggregateSignature) String() string { return proto.CompactTextString(m) }
+func (*AggregateSignature) ProtoMessage()    {}
+
 // TransactionResult contains the return value of a transaction. It does
 // not track potential state changes that were a result of the transaction.
 // uuid - The unique identifier of this transaction.
@@ -246,6 +739,10 @@ func (m *TransactionResult) GetChaincodeEvent() *ChaincodeEvent {
 // nonHashData - Data stored with the block, but not included in the blocks
 // hash. This allows this data to be different per peer or discarded without
 // impacting the blockchain.
+// partial - Set on the copies of a block sent for a Message.CHAIN_SYNC_REQUEST
+// with a txTypeFilter, holding only some of its transactions. Their stateHash
+// is cleared as the transactions left do not lead to it, and they do not hash
+// to the hash of the block.
 type Block struct {
 	Version           uint32                     `protobuf:"varint,1,opt,name=version" json:"version,omitempty"`
 	Timestamp         *google_protobuf.Timestamp `protobuf:"bytes,2,opt,name=timestamp" json:"timestamp,omitempty"`
@@ -254,6 +751,7 @@ type Block struct {
 	PreviousBlockHash []byte                     `protobuf:"bytes,5,opt,name=previousBlockHash,proto3" json:"previousBlockHash,omitempty"`
 	ConsensusMetadata []byte                     `protobuf:"bytes,6,opt,name=consensusMetadata,proto3" json:"consensusMetadata,omitempty"`
 	NonHashData       *NonHashData               `protobuf:"bytes,7,opt,name=nonHashData" json:"nonHashData,omitempty"`
+	Partial           bool                       `protobuf:"varint,8,opt,name=partial" json:"partial,omitempty"`
 }
 
 func (m *Block) Reset()         { *m = Block{} }
@@ -312,6 +810,24 @@ func (m *NonHashData) GetLocalLedgerCommitTimestamp() *google_protobuf.Timestamp
 	return nil
 }
 
+type HealthCheckRequest struct {
+}
+
+func (m *HealthCheckRequest) Reset()         { *m = HealthCheckRequest{} }
+func (m *HealthCheckRequest) String() string { return proto.CompactTextString(m) }
+func (*HealthCheckRequest) ProtoMessage()    {}
+
+// HealthCheckResponse is the health of a peer. A DEGRADED peer serves but is
+// overloaded, reason telling why a peer is not HEALTHY.
+type HealthCheckResponse struct {
+	Status HealthCheckResponse_Status `protobuf:"varint,1,opt,name=status,enum=protos.HealthCheckResponse_Status" json:"status,omitempty"`
+	Reason string                     `protobuf:"bytes,2,opt,name=reason" json:"reason,omitempty"`
+}
+
+func (m *HealthCheckResponse) Reset()         { *m = HealthCheckResponse{} }
+func (m *HealthCheckResponse) String() string { return proto.CompactTextString(m) }
+func (*HealthCheckResponse) ProtoMessage()    {}
+
 type PeerAddress struct {
 	Host string `protobuf:"bytes,1,opt,name=host" json:"host,omitempty"`
 	Port int32  `protobuf:"varint,2,opt,name=port" json:"port,omitempty"`
@@ -334,6 +850,9 @@ type PeerEndpoint struct {
 	Address string            `protobuf:"bytes,2,opt,name=address" json:"address,omitempty"`
 	Type    PeerEndpoint_Type `protobuf:"varint,3,opt,name=type,enum=protos.PeerEndpoint_Type" json:"type,omitempty"`
 	PkiID   []byte            `protobuf:"bytes,4,opt,name=pkiID,proto3" json:"pkiID,omitempty"`
+	// ttlMs is how long the listing peer keeps the endpoint without news of
+	// it, 0 for good. Only set in the DISC_PEERS reply to DISC_QUORUM_GET_PEERS.
+	TtlMs uint64 `protobuf:"varint,5,opt,name=ttlMs" json:"ttlMs,omitempty"`
 }
 
 func (m *PeerEndpoint) Reset()         { *m = PeerEndpoint{} }
@@ -347,8 +866,11 @@ func (m *PeerEndpoint) GetID() *PeerID {
 	return nil
 }
 
+// PeersMessage is the payload of Message.DISC_PEERS. nonce echoes the nonce of
+// the Message.DISC_GET_PEERS answered.
 type PeersMessage struct {
 	Peers []*PeerEndpoint `protobuf:"bytes,1,rep,name=peers" json:"peers,omitempty"`
+	Nonce []byte          `protobuf:"bytes,2,opt,name=nonce,proto3" json:"nonce,omitempty"`
 }
 
 func (m *PeersMessage) Reset()         { *m = PeersMessage{} }
@@ -362,6 +884,188 @@ func (m *PeersMessage) GetPeers() []*PeerEndpoint {
 	return nil
 }
 
+// GetPeers is the optional payload of Message.DISC_GET_PEERS. When includeSelf
+// is set the queried peer lists its own endpoint first in the DISC_PEERS reply.
+// nonce is echoed in the reply, for the requester to tell it from a replayed
+// one.
+type GetPeers struct {
+	IncludeSelf bool   `protobuf:"varint,1,opt,name=includeSelf" json:"includeSelf,omitempty"`
+	Nonce       []byte `protobuf:"bytes,2,opt,name=nonce,proto3" json:"nonce,omitempty"`
+}
+
+func (m *GetPeers) Reset()         { *m = GetPeers{} }
+func (m *GetPeers) String() string { return proto.CompactTextString(m) }
+func (*GetPeers) ProtoMessage()    {}
+
+// QuorumGetPeers is the payload of Message.DISC_QUORUM_GET_PEERS. The queried
+// peer merges its own list with those of up to quorumSize of its peers into
+// the DISC_PEERS reply, 0 answering with its own list only.
+type QuorumGetPeers struct {
+	QuorumSize uint32 `protobuf:"varint,1,opt,name=quorumSize" json:"quorumSize,omitempty"`
+}
+
+func (m *QuorumGetPeers) Reset()         { *m = QuorumGetPeers{} }
+func (m *QuorumGetPeers) String() string { return proto.CompactTextString(m) }
+func (*QuorumGetPeers) ProtoMessage()    {}
+
+// GetPeersDiverse is the payload of Message.DISC_GET_PEERS_DIVERSE. The
+// queried peer replies with a DISC_PEERS of at most maxResults of its peers,
+// at most maxPerSubnet of them in each /24 subnet, /48 for IPv6, 0 meaning no
+// limit.
+type GetPeersDiverse struct {
+	MaxResults   uint32 `protobuf:"varint,1,opt,name=maxResults" json:"maxResults,omitempty"`
+	MaxPerSubnet uint32 `protobuf:"varint,2,opt,name=maxPerSubnet" json:"maxPerSubnet,omitempty"`
+}
+
+func (m *GetPeersDiverse) Reset()         { *m = GetPeersDiverse{} }
+func (m *GetPeersDiverse) String() string { return proto.CompactTextString(m) }
+func (*GetPeersDiverse) ProtoMessage()    {}
+
+// PeerNode is a peer of a Topology, its address empty if the peer is only
+// known as a neighbor of another.
+type PeerNode struct {
+	ID      *PeerID `protobuf:"bytes,1,opt,name=ID" json:"ID,omitempty"`
+	Address string  `protobuf:"bytes,2,opt,name=address" json:"address,omitempty"`
+}
+
+func (m *PeerNode) Reset()         { *m = PeerNode{} }
+func (m *PeerNode) String() string { return proto.CompactTextString(m) }
+func (*PeerNode) ProtoMessage()    {}
+
+func (m *PeerNode) GetID() *PeerID {
+	if m != nil {
+		return m.ID
+	}
+	return nil
+}
+
+// PeerEdge is a Chat between peers of a Topology. latencyMs is the last
+// round-trip time measured over it, 0 if unknown.
+type PeerEdge struct {
+	From      *PeerID `protobuf:"bytes,1,opt,name=from" json:"from,omitempty"`
+	To        *PeerID `protobuf:"bytes,2,opt,name=to" json:"to,omitempty"`
+	LatencyMs uint32  `protobuf:"varint,3,opt,name=latencyMs" json:"latencyMs,omitempty"`
+}
+
+func (m *PeerEdge) Reset()         { *m = PeerEdge{} }
+func (m *PeerEdge) String() string { return proto.CompactTextString(m) }
+func (*PeerEdge) ProtoMessage()    {}
+
+func (m *PeerEdge) GetFrom() *PeerID {
+	if m != nil {
+		return m.From
+	}
+	return nil
+}
+
+func (m *PeerEdge) GetTo() *PeerID {
+	if m != nil {
+		return m.To
+	}
+	return nil
+}
+
+// Topology is the payload of Message.DISC_TOPOLOGY_RESPONSE, the reply to a
+// Message.DISC_GET_TOPOLOGY with the peers the sender knows of and the Chats
+// between them: its own, and those of the peers it has a Chat with as they
+// listed them in their DISC_PEERS.
+type Topology struct {
+	Nodes []*PeerNode `protobuf:"bytes,1,rep,name=nodes" json:"nodes,omitempty"`
+	Edges []*PeerEdge `protobuf:"bytes,2,rep,name=edges" json:"edges,omitempty"`
+}
+
+func (m *Topology) Reset()         { *m = Topology{} }
+func (m *Topology) String() string { return proto.CompactTextString(m) }
+func (*Topology) ProtoMessage()    {}
+
+func (m *Topology) GetNodes() []*PeerNode {
+	if m != nil {
+		return m.Nodes
+	}
+	return nil
+}
+
+func (m *Topology) GetEdges() []*PeerEdge {
+	if m != nil {
+		return m.Edges
+	}
+	return nil
+}
+
+// GetPeersDiff is the payload of Message.DISC_GET_PEERS_DIFF, asking a peer for
+// the changes to its registry since view sinceViewID, the viewID of the last
+// PeersDiff received from it or 0 for the full list.
+type GetPeersDiff struct {
+	SinceViewID uint64 `protobuf:"varint,1,opt,name=sinceViewID" json:"sinceViewID,omitempty"`
+}
+
+func (m *GetPeersDiff) Reset()         { *m = GetPeersDiff{} }
+func (m *GetPeersDiff) String() string { return proto.CompactTextString(m) }
+func (*GetPeersDiff) ProtoMessage()    {}
+
+// PeersDiff is the payload of Message.DISC_PEERS_DIFF, the reply to a
+// Message.DISC_GET_PEERS_DIFF. added are the endpoints registered or updated
+// and removed the peers unregistered since the requested view, up to view
+// viewID. When the requested view is too old to be diffed against, full is
+// set and added lists all the registered endpoints.
+type PeersDiff struct {
+	ViewID  uint64          `protobuf:"varint,1,opt,name=viewID" json:"viewID,omitempty"`
+	Added   []*PeerEndpoint `protobuf:"bytes,2,rep,name=added" json:"added,omitempty"`
+	Removed []*PeerID       `protobuf:"bytes,3,rep,name=removed" json:"removed,omitempty"`
+	Full    bool            `protobuf:"varint,4,opt,name=full" json:"full,omitempty"`
+}
+
+func (m *PeersDiff) Reset()         { *m = PeersDiff{} }
+func (m *PeersDiff) String() string { return proto.CompactTextString(m) }
+func (*PeersDiff) ProtoMessage()    {}
+
+func (m *PeersDiff) GetAdded() []*PeerEndpoint {
+	if m != nil {
+		return m.Added
+	}
+	return nil
+}
+
+func (m *PeersDiff) GetRemoved() []*PeerID {
+	if m != nil {
+		return m.Removed
+	}
+	return nil
+}
+
+// GetPeersRetryAfter is the payload of Message.DISC_GET_PEERS_RETRY_AFTER, sent
+// instead of the peer list when DISC_GET_PEERS requests are being rate limited.
+type GetPeersRetryAfter struct {
+	RetryAfterMs uint32 `protobuf:"varint,1,opt,name=retryAfterMs" json:"retryAfterMs,omitempty"`
+}
+
+func (m *GetPeersRetryAfter) Reset()         { *m = GetPeersRetryAfter{} }
+func (m *GetPeersRetryAfter) String() string { return proto.CompactTextString(m) }
+func (*GetPeersRetryAfter) ProtoMessage()    {}
+
+// RegistryFull is the payload of Message.DISC_REGISTRY_FULL, sent in reply to
+// the DISC_HELLO of an unknown peer when the registry of the sender holds the
+// maximum number of peers. The Chat is then closed.
+type RegistryFull struct {
+	RetryAfterSeconds uint32 `protobuf:"varint,1,opt,name=retryAfterSeconds" json:"retryAfterSeconds,omitempty"`
+}
+
+func (m *RegistryFull) Reset()         { *m = RegistryFull{} }
+func (m *RegistryFull) String() string { return proto.CompactTextString(m) }
+func (*RegistryFull) ProtoMessage()    {}
+
+// Ping is the payload of Message.DISC_PING, echoed back unchanged in the
+// Message.DISC_PONG reply. sentAt is the time the ping was sent in nanoseconds
+// since the epoch on the clock of the sender, which measures the round trip
+// on receiving the pong.
+type Ping struct {
+	SentAt int64 `protobuf:"varint,1,opt,name=sentAt" json:"sentAt,omitempty"`
+}
+
+func (m *Ping) Reset()         { *m = Ping{} }
+func (m *Ping) String() string { return proto.CompactTextString(m) }
+func (*Ping) ProtoMessage()    {}
+
 type PeersAddresses struct {
 	Addresses []string `protobuf:"bytes,1,rep,name=addresses" json:"addresses,omitempty"`
 }
@@ -370,9 +1074,113 @@ func (m *PeersAddresses) Reset()         { *m = PeersAddresses{} }
 func (m *PeersAddresses) String() string { return proto.CompactTextString(m) }
 func (*PeersAddresses) ProtoMessage()    {}
 
+// BandwidthTest is the payload of Message.DISC_BANDWIDTH_TEST, asking the
+// receiver to reply with a DISC_BANDWIDTH_RESULT of payloadSize bytes.
+type BandwidthTest struct {
+	PayloadSize uint32 `protobuf:"varint,1,opt,name=payloadSize" json:"payloadSize,omitempty"`
+}
+
+func (m *BandwidthTest) Reset()         { *m = BandwidthTest{} }
+func (m *BandwidthTest) String() string { return proto.CompactTextString(m) }
+func (*BandwidthTest) ProtoMessage()    {}
+
+// BandwidthResult is the payload of Message.DISC_BANDWIDTH_RESULT.
+// sendTimestamp - The time at which the sender sent the result.
+type BandwidthResult struct {
+	Payload       []byte                     `protobuf:"bytes,1,opt,name=payload,proto3" json:"payload,omitempty"`
+	SendTimestamp *google_protobuf.Timestamp `protobuf:"bytes,2,opt,name=sendTimestamp" json:"sendTimestamp,omitempty"`
+}
+
+func (m *BandwidthResult) Reset()         { *m = BandwidthResult{} }
+func (m *BandwidthResult) String() string { return proto.CompactTextString(m) }
+func (*BandwidthResult) ProtoMessage()    {}
+
+func (m *BandwidthResult) GetSendTimestamp() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.SendTimestamp
+	}
+	return nil
+}
+
+// PeerMetadata is the payload of Message.DISC_PEER_METADATA, optionally sent
+// after the DISC_HELLO exchange to describe the sender, e.g. its datacenter,
+// rack or version. It is sent again whenever the role of the sender changes,
+// the role replacing the one of its DISC_HELLO.
+type PeerMetadata struct {
+	Attributes map[string]string `protobuf:"bytes,1,rep,name=attributes" json:"attributes,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Role       string            `protobuf:"bytes,2,opt,name=role" json:"role,omitempty"`
+}
+
+func (m *PeerMetadata) Reset()         { *m = PeerMetadata{} }
+func (m *PeerMetadata) String() string { return proto.CompactTextString(m) }
+func (*PeerMetadata) ProtoMessage()    {}
+
+func (m *PeerMetadata) GetAttributes() map[string]string {
+	if m != nil {
+		return m.Attributes
+	}
+	return nil
+}
+
+// GeoCoordinates is the location of a peer, in degrees.
+type GeoCoordinates struct {
+	Lat float64 `protobuf:"fixed64,1,opt,name=lat" json:"lat,omitempty"`
+	Lon float64 `protobuf:"fixed64,2,opt,name=lon" json:"lon,omitempty"`
+}
+
+func (m *GeoCoordinates) Reset()         { *m = GeoCoordinates{} }
+func (m *GeoCoordinates) String() string { return proto.CompactTextString(m) }
+func (*GeoCoordinates) ProtoMessage()    {}
+
+// HelloMessage is the payload of Message.DISC_HELLO.
+// supportedCapabilities - The optional protocol features the sender supports.
+// requiredCapabilities - The features the sender will not chat without.
+// geoCoordinates - The location of the sender, if configured.
+// encryptionKey - The DER encoded public key confidential transactions for the
+// sender are encrypted with, if it accepts them.
+// loadScore - The load of the sender, from 0 (idle) to 1 (saturated).
+// externalAddress - The address the sender is reachable at from outside its
+// NAT, as mapped by a STUN server, registered instead of peerEndpoint.address.
+// authChallenge - 16 random bytes the receiver answers with a
+// Message.DISC_HELLO_AUTH when the peers authenticate with a shared secret.
+// executionEnvs - The TransactionBlock.executionEnv the sender processes
+// Message.CHAIN_TRANSACTIONS batches for.
+// protocolVersion - The protocol version of the sender, looked up with that of
+// the receiver for the features they both use. Empty for version 1 peers.
+// priority - The connection priority of the sender, lower values first: its
+// messages are processed first and it is kept over peers of higher values
+// when the registry of the receiver is full.
+// preferredCodecs - The message codecs the sender can decode, most preferred
+// first.
+// sessionToken - From the initiator of the Chat, the token issued by the
+// receiver in a previous Chat, authenticating it instead of the authChallenge
+// and authToken. From the receiver, a new token for the next Chat, issued in
+// the DISC_HELLO_AUTH instead when the initiator is yet to answer the
+// authChallenge.
+// requestOnly - The sender opened the Chat for requests of its own, it is
+// authenticated as any peer but not registered, whatever its peerEndpoint.
 type HelloMessage struct {
-	PeerEndpoint   *PeerEndpoint   `protobuf:"bytes,1,opt,name=peerEndpoint" json:"peerEndpoint,omitempty"`
-	BlockchainInfo *BlockchainInfo `protobuf:"bytes,2,opt,name=blockchainInfo" json:"blockchainInfo,omitempty"`
+	PeerEndpoint          *PeerEndpoint   `protobuf:"bytes,1,opt,name=peerEndpoint" json:"peerEndpoint,omitempty"`
+	BlockchainInfo        *BlockchainInfo `protobuf:"bytes,2,opt,name=blockchainInfo" json:"blockchainInfo,omitempty"`
+	SupportedCapabilities []string        `protobuf:"bytes,3,rep,name=supportedCapabilities" json:"supportedCapabilities,omitempty"`
+	RequiredCapabilities  []string        `protobuf:"bytes,4,rep,name=requiredCapabilities" json:"requiredCapabilities,omitempty"`
+	GeoCoordinates        *GeoCoordinates `protobuf:"bytes,5,opt,name=geoCoordinates" json:"geoCoordinates,omitempty"`
+	EncryptionKey         []byte          `protobuf:"bytes,6,opt,name=encryptionKey,proto3" json:"encryptionKey,omitempty"`
+	LoadScore             float32         `protobuf:"fixed32,7,opt,name=loadScore" json:"loadScore,omitempty"`
+	Region                string          `protobuf:"bytes,8,opt,name=region" json:"region,omitempty"`
+	UptimeSeconds         uint64          `protobuf:"varint,9,opt,name=uptimeSeconds" json:"uptimeSeconds,omitempty"`
+	MaxMessageBytes       uint32          `protobuf:"varint,10,opt,name=maxMessageBytes" json:"maxMessageBytes,omitempty"`
+	AuthToken             string          `protobuf:"bytes,11,opt,name=authToken" json:"authToken,omitempty"`
+	OnionAddress          string          `protobuf:"bytes,12,opt,name=onionAddress" json:"onionAddress,omitempty"`
+	Role                  string          `protobuf:"bytes,13,opt,name=role" json:"role,omitempty"`
+	ExternalAddress       string          `protobuf:"bytes,14,opt,name=externalAddress" json:"externalAddress,omitempty"`
+	AuthChallenge         []byte          `protobuf:"bytes,15,opt,name=authChallenge,proto3" json:"authChallenge,omitempty"`
+	ExecutionEnvs         []string        `protobuf:"bytes,16,rep,name=executionEnvs" json:"executionEnvs,omitempty"`
+	ProtocolVersion       string          `protobuf:"bytes,17,opt,name=protocolVersion" json:"protocolVersion,omitempty"`
+	Priority              uint32          `protobuf:"varint,18,opt,name=priority" json:"priority,omitempty"`
+	PreferredCodecs       []string        `protobuf:"bytes,19,rep,name=preferredCodecs" json:"preferredCodecs,omitempty"`
+	SessionToken          string          `protobuf:"bytes,20,opt,name=sessionToken" json:"sessionToken,omitempty"`
+	RequestOnly           bool            `protobuf:"varint,21,opt,name=requestOnly" json:"requestOnly,omitempty"`
 }
 
 func (m *HelloMessage) Reset()         { *m = HelloMessage{} }
@@ -393,11 +1201,63 @@ func (m *HelloMessage) GetBlockchainInfo() *BlockchainInfo {
 	return nil
 }
 
+func (m *HelloMessage) GetGeoCoordinates() *GeoCoordinates {
+	if m != nil {
+		return m.GeoCoordinates
+	}
+	return nil
+}
+
+// HelloAuth is the payload of Message.DISC_HELLO_AUTH, the answer to the
+// authChallenge of a DISC_HELLO: its HMAC-SHA256 keyed with the shared secret
+// of the peers. The receiver of the Chat answering last issues the
+// sessionToken the initiator may present in the DISC_HELLO of its next Chat.
+type HelloAuth struct {
+	Hmac         []byte `protobuf:"bytes,1,opt,name=hmac,proto3" json:"hmac,omitempty"`
+	SessionToken string `protobuf:"bytes,2,opt,name=sessionToken" json:"sessionToken,omitempty"`
+}
+
+func (m *HelloAuth) Reset()         { *m = HelloAuth{} }
+func (m *HelloAuth) String() string { return proto.CompactTextString(m) }
+func (*HelloAuth) ProtoMessage()    {}
+
+// CapabilityMismatch is the payload of Message.DISC_VERSION_MISMATCH, sent
+// instead of completing the DISC_HELLO exchange when a required capability is
+// not supported by both peers.
+type CapabilityMismatch struct {
+	MissingCapabilities []string `protobuf:"bytes,1,rep,name=missingCapabilities" json:"missingCapabilities,omitempty"`
+}
+
+func (m *CapabilityMismatch) Reset()         { *m = CapabilityMismatch{} }
+func (m *CapabilityMismatch) String() string { return proto.CompactTextString(m) }
+func (*CapabilityMismatch) ProtoMessage()    {}
+
 type Message struct {
 	Type      Message_Type               `protobuf:"varint,1,opt,name=type,enum=protos.Message_Type" json:"type,omitempty"`
 	Timestamp *google_protobuf.Timestamp `protobuf:"bytes,2,opt,name=timestamp" json:"timestamp,omitempty"`
 	Payload   []byte                     `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
 	Signature []byte                     `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
+	// correlationID is set on a request to match it with its reply, which
+	// carries the same correlationID.
+	CorrelationID string `protobuf:"bytes,5,opt,name=correlationID" json:"correlationID,omitempty"`
+	// compression is the algorithm the payload is compressed with, as
+	// negotiated by the CompressionNegotiator of the Chat, empty if the
+	// payload is not compressed.
+	Compression string `protobuf:"bytes,6,opt,name=compression" json:"compression,omitempty"`
+	// codec is the encoding of the message carried as the payload, as
+	// negotiated by the CodecNegotiator of the Chat, empty if the message is
+	// sent as it is.
+	Codec string `protobuf:"bytes,7,opt,name=codec" json:"codec,omitempty"`
+	// sequence numbers the messages sent on a resumable Chat session from 1,
+	// 0 for the messages outside of one. ackSequence is the sequence number
+	// of the last message received on the session, acknowledging it and
+	// those before. The DISC_HELLO of a peer resuming the session of the
+	// session token it presents or verified has resumed set, its
+	// ackSequence telling which messages the other peer must send again.
+	// Message.DISC_ACK only carries an ackSequence.
+	Sequence    uint64 `protobuf:"varint,8,opt,name=sequence" json:"sequence,omitempty"`
+	AckSequence uint64 `protobuf:"varint,9,opt,name=ackSequence" json:"ackSequence,omitempty"`
+	Resumed     bool   `protobuf:"varint,10,opt,name=resumed" json:"resumed,omitempty"`
 }
 
 func (m *Message) Reset()         { *m = Message{} }
@@ -411,6 +1271,52 @@ func (m *Message) GetTimestamp() *google_protobuf.Timestamp {
 	return nil
 }
 
+// GossipTransaction is the payload of Message.CHAIN_TRANSACTION_GOSSIP, used
+// to propagate a transaction from peer to peer. ttl is decremented at each
+// hop and propagation stops once it reaches 0.
+type GossipTransaction struct {
+	Transaction *Transaction `protobuf:"bytes,1,opt,name=transaction" json:"transaction,omitempty"`
+	Ttl         uint32       `protobuf:"varint,2,opt,name=ttl" json:"ttl,omitempty"`
+}
+
+func (m *GossipTransaction) Reset()         { *m = GossipTransaction{} }
+func (m *GossipTransaction) String() string { return proto.CompactTextString(m) }
+func (*GossipTransaction) ProtoMessage()    {}
+
+func (m *GossipTransaction) GetTransaction() *Transaction {
+	if m != nil {
+		return m.Transaction
+	}
+	return nil
+}
+
+// TransactionsQueryStatus is the payload of Message.CHAIN_TRANSACTIONS_QUERY_STATUS.
+type TransactionsQueryStatus struct {
+	TxIDs []string `protobuf:"bytes,1,rep,name=txIDs" json:"txIDs,omitempty"`
+}
+
+func (m *TransactionsQueryStatus) Reset()         { *m = TransactionsQueryStatus{} }
+func (m *TransactionsQueryStatus) String() string { return proto.CompactTextString(m) }
+func (*TransactionsQueryStatus) ProtoMessage()    {}
+
+// TransactionsStatusResponse is the payload of
+// Message.CHAIN_TRANSACTIONS_STATUS_RESPONSE, with the state of every queried
+// transaction keyed by its ID.
+type TransactionsStatusResponse struct {
+	Statuses map[string]TxState `protobuf:"bytes,1,rep,name=statuses" json:"statuses,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value,enum=protos.TxState"`
+}
+
+func (m *TransactionsStatusResponse) Reset()         { *m = TransactionsStatusResponse{} }
+func (m *TransactionsStatusResponse) String() string { return proto.CompactTextString(m) }
+func (*TransactionsStatusResponse) ProtoMessage()    {}
+
+func (m *TransactionsStatusResponse) GetStatuses() map[string]TxState {
+	if m != nil {
+		return m.Statuses
+	}
+	return nil
+}
+
 type Response struct {
 	Status Response_StatusCode `protobuf:"varint,1,opt,name=status,enum=protos.Response_StatusCode" json:"status,omitempty"`
 	Msg    []byte              `protobuf:"bytes,2,opt,name=msg,proto3" json:"msg,omitempty"`
@@ -446,16 +1352,96 @@ func (m *BlockState) GetBlock() *Block {
 // in which blocks are returned is defined by the start and end values. For
 // example, if start=3 and end=5, the order of blocks will be 3, 4, 5.
 // If start=5 and end=3, the order will be 5, 4, 3.
+// bandwidthPolicy is the bandwidth the sender of the request asks the blocks
+// or state deltas to be sent with.
 type SyncBlockRange struct {
-	CorrelationId uint64 `protobuf:"varint,1,opt,name=correlationId" json:"correlationId,omitempty"`
-	Start         uint64 `protobuf:"varint,2,opt,name=start" json:"start,omitempty"`
-	End           uint64 `protobuf:"varint,3,opt,name=end" json:"end,omitempty"`
+	CorrelationId   uint64              `protobuf:"varint,1,opt,name=correlationId" json:"correlationId,omitempty"`
+	Start           uint64              `protobuf:"varint,2,opt,name=start" json:"start,omitempty"`
+	End             uint64              `protobuf:"varint,3,opt,name=end" json:"end,omitempty"`
+	BandwidthPolicy SyncBandwidthPolicy `protobuf:"varint,4,opt,name=bandwidthPolicy,enum=protos.SyncBandwidthPolicy" json:"bandwidthPolicy,omitempty"`
 }
 
 func (m *SyncBlockRange) Reset()         { *m = SyncBlockRange{} }
 func (m *SyncBlockRange) String() string { return proto.CompactTextString(m) }
 func (*SyncBlockRange) ProtoMessage()    {}
 
+// SyncCheckpoint is the payload of Message.SYNC_CHECKPOINT, asking for the
+// blocks after the checkpoint block blockNumber up to end, as SYNC_BLOCKS with
+// the correlationId. The receiver only sends them if its block blockNumber
+// hashes to checkpointHash, otherwise it echoes the payload in a
+// Message.SYNC_CHECKPOINT_MISMATCH.
+type SyncCheckpoint struct {
+	CorrelationId  uint64 `protobuf:"varint,1,opt,name=correlationId" json:"correlationId,omitempty"`
+	BlockNumber    uint64 `protobuf:"varint,2,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	CheckpointHash []byte `protobuf:"bytes,3,opt,name=checkpointHash,proto3" json:"checkpointHash,omitempty"`
+	End            uint64 `protobuf:"varint,4,opt,name=end" json:"end,omitempty"`
+}
+
+func (m *SyncCheckpoint) Reset()         { *m = SyncCheckpoint{} }
+func (m *SyncCheckpoint) String() string { return proto.CompactTextString(m) }
+func (*SyncCheckpoint) ProtoMessage()    {}
+
+// BlockHashesRequest is the payload of Message.SYNC_GET_BLOCK_HASHES, asking a
+// peer for the hashes of its blocks fromBlock to toBlock included.
+type BlockHashesRequest struct {
+	FromBlock uint64 `protobuf:"varint,1,opt,name=fromBlock" json:"fromBlock,omitempty"`
+	ToBlock   uint64 `protobuf:"varint,2,opt,name=toBlock" json:"toBlock,omitempty"`
+}
+
+func (m *BlockHashesRequest) Reset()         { *m = BlockHashesRequest{} }
+func (m *BlockHashesRequest) String() string { return proto.CompactTextString(m) }
+func (*BlockHashesRequest) ProtoMessage()    {}
+
+// BlockHashList is the payload of Message.SYNC_BLOCK_HASHES, the reply to a
+// Message.SYNC_GET_BLOCK_HASHES with the hash of every block from fromBlock
+// on. Blocks past the end of the chain of the sender are left out.
+type BlockHashList struct {
+	FromBlock uint64   `protobuf:"varint,1,opt,name=fromBlock" json:"fromBlock,omitempty"`
+	Hashes    [][]byte `protobuf:"bytes,2,rep,name=hashes,proto3" json:"hashes,omitempty"`
+}
+
+func (m *BlockHashList) Reset()         { *m = BlockHashList{} }
+func (m *BlockHashList) String() string { return proto.CompactTextString(m) }
+func (*BlockHashList) ProtoMessage()    {}
+
+// SyncVerifyRequest is the payload of Message.CHAIN_SYNC_VERIFY_REQUEST, asking
+// a peer for the root of its blocks fromBlock to toBlock included, for a peer
+// which synced them to check it received them all and intact.
+type SyncVerifyRequest struct {
+	FromBlock uint64 `protobuf:"varint,1,opt,name=fromBlock" json:"fromBlock,omitempty"`
+	ToBlock   uint64 `protobuf:"varint,2,opt,name=toBlock" json:"toBlock,omitempty"`
+}
+
+func (m *SyncVerifyRequest) Reset()         { *m = SyncVerifyRequest{} }
+func (m *SyncVerifyRequest) String() string { return proto.CompactTextString(m) }
+func (*SyncVerifyRequest) ProtoMessage()    {}
+
+// SyncVerifyResponse is the payload of Message.CHAIN_SYNC_VERIFY_RESPONSE, the
+// reply to a Message.CHAIN_SYNC_VERIFY_REQUEST. rootHash is the SHA-256 merkle
+// root over the hashes of the blockCount blocks of the range the sender has,
+// those past the end of its chain left out, empty if it has none.
+type SyncVerifyResponse struct {
+	RootHash   []byte `protobuf:"bytes,1,opt,name=rootHash,proto3" json:"rootHash,omitempty"`
+	BlockCount uint64 `protobuf:"varint,2,opt,name=blockCount" json:"blockCount,omitempty"`
+}
+
+func (m *SyncVerifyResponse) Reset()         { *m = SyncVerifyResponse{} }
+func (m *SyncVerifyResponse) String() string { return proto.CompactTextString(m) }
+func (*SyncVerifyResponse) ProtoMessage()    {}
+
+// BlockNumbers is the payload of Message.SYNC_GET_BLOCKS_BY_NUMBER, asking a
+// peer for the blocks blockNumbers in ascending order. As for a
+// Message.CHAIN_QUERY_RANGE the receiver sends a CHAIN_BLOCK for each block up
+// to its limit, then a CHAIN_QUERY_RANGE_DONE whose nextBlock is the first
+// number not sent.
+type BlockNumbers struct {
+	BlockNumbers []uint64 `protobuf:"varint,1,rep,name=blockNumbers" json:"blockNumbers,omitempty"`
+}
+
+func (m *BlockNumbers) Reset()         { *m = BlockNumbers{} }
+func (m *BlockNumbers) String() string { return proto.CompactTextString(m) }
+func (*BlockNumbers) ProtoMessage()    {}
+
 // SyncBlocks is the payload of Message.SYNC_BLOCKS, where the range
 // indicates the blocks responded to the request SYNC_GET_BLOCKS
 type SyncBlocks struct {
@@ -481,9 +1467,50 @@ func (m *SyncBlocks) GetBlocks() []*Block {
 	return nil
 }
 
+// BlockBatch is the payload of Message.CHAIN_BLOCK_BATCH, blocks answering a
+// Message.SYNC_GET_BLOCKS sent together in the order of the request. range is
+// the first and last blocks of the batch and the correlationId of the request.
+type BlockBatch struct {
+	Range  *SyncBlockRange `protobuf:"bytes,1,opt,name=range" json:"range,omitempty"`
+	Blocks []*Block        `protobuf:"bytes,2,rep,name=blocks" json:"blocks,omitempty"`
+}
+
+func (m *BlockBatch) Reset()         { *m = BlockBatch{} }
+func (m *BlockBatch) String() string { return proto.CompactTextString(m) }
+func (*BlockBatch) ProtoMessage()    {}
+
+func (m *BlockBatch) GetRange() *SyncBlockRange {
+	if m != nil {
+		return m.Range
+	}
+	return nil
+}
+
+func (m *BlockBatch) GetBlocks() []*Block {
+	if m != nil {
+		return m.Blocks
+	}
+	return nil
+}
+
+// MessageFragment is the payload of Message.CHAIN_MESSAGE_FRAGMENT, a piece of
+// a marshalled Message too large to be sent at once. The fragments of a
+// message share its fragmentId and are sent in order, more being set on all
+// but the last one.
+type MessageFragment struct {
+	FragmentId uint64 `protobuf:"varint,1,opt,name=fragmentId" json:"fragmentId,omitempty"`
+	Data       []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	More       bool   `protobuf:"varint,3,opt,name=more" json:"more,omitempty"`
+}
+
+func (m *MessageFragment) Reset()         { *m = MessageFragment{} }
+func (m *MessageFragment) String() string { return proto.CompactTextString(m) }
+func (*MessageFragment) ProtoMessage()    {}
+
 // SyncSnapshotRequest Payload for the penchainMessage.SYNC_GET_SNAPSHOT message.
 type SyncStateSnapshotRequest struct {
-	CorrelationId uint64 `protobuf:"varint,1,opt,name=correlationId" json:"correlationId,omitempty"`
+	CorrelationId   uint64              `protobuf:"varint,1,opt,name=correlationId" json:"correlationId,omitempty"`
+	BandwidthPolicy SyncBandwidthPolicy `protobuf:"varint,2,opt,name=bandwidthPolicy,enum=protos.SyncBandwidthPolicy" json:"bandwidthPolicy,omitempty"`
 }
 
 func (m *SyncStateSnapshotRequest) Reset()         { *m = SyncStateSnapshotRequest{} }
@@ -549,45 +1576,1255 @@ func (m *SyncStateDeltas) GetRange() *SyncBlockRange {
 	return nil
 }
 
-func init() {
-	proto.RegisterEnum("protos.Transaction_Type", Transaction_Type_name, Transaction_Type_value)
-	proto.RegisterEnum("protos.PeerEndpoint_Type", PeerEndpoint_Type_name, PeerEndpoint_Type_value)
-	proto.RegisterEnum("protos.Message_Type", Message_Type_name, Message_Type_value)
-	proto.RegisterEnum("protos.Response_StatusCode", Response_StatusCode_name, Response_StatusCode_value)
+// QueryTransaction is the payload of Message.CHAIN_QUERY_TX, asking a peer for
+// a committed transaction, and of the Message.CHAIN_TX_NOT_FOUND reply when
+// the peer has no transaction txID.
+type QueryTransaction struct {
+	TxID string `protobuf:"bytes,1,opt,name=txID" json:"txID,omitempty"`
 }
 
-// Reference imports to suppress errors if they are not otherwise used.
-var _ context.Context
-var _ grpc.ClientConn
+func (m *QueryTransaction) Reset()         { *m = QueryTransaction{} }
+func (m *QueryTransaction) String() string { return proto.CompactTextString(m) }
+func (*QueryTransaction) ProtoMessage()    {}
 
-// Client API for Peer service
+// TransactionResponse is the payload of Message.CHAIN_TX_RESPONSE, the
+// transaction found in reply to a Message.CHAIN_QUERY_TX and its position on
+// the chain.
+type TransactionResponse struct {
+	Tx          *Transaction `protobuf:"bytes,1,opt,name=tx" json:"tx,omitempty"`
+	BlockNumber uint64       `protobuf:"varint,2,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	TxIndex     uint32       `protobuf:"varint,3,opt,name=txIndex" json:"txIndex,omitempty"`
+}
 
-type PeerClient interface {
-	// Accepts a stream of Message during chat session, while receiving
-	// other Message (e.g. from other peers).
-	Chat(ctx context.Context, opts ...grpc.CallOption) (Peer_ChatClient, error)
-	// Process a transaction from a remote source.
-	ProcessTransaction(ctx context.Context, in *Transaction, opts ...grpc.CallOption) (*Response, error)
+func (m *TransactionResponse) Reset()         { *m = TransactionResponse{} }
+func (m *TransactionResponse) String() string { return proto.CompactTextString(m) }
+func (*TransactionResponse) ProtoMessage()    {}
+
+func (m *TransactionResponse) GetTx() *Transaction {
+	if m != nil {
+		return m.Tx
+	}
+	return nil
 }
 
-type peerClient struct {
-	cc *grpc.ClientConn
+// RecentTransactionsCursor is a position on the chain, the transactions
+// before transaction txIndex of block blockNumber being the ones left to
+// return to a Message.CHAIN_QUERY_RECENT_TX.
+type RecentTransactionsCursor struct {
+	BlockNumber uint64 `protobuf:"varint,1,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	TxIndex     uint32 `protobuf:"varint,2,opt,name=txIndex" json:"txIndex,omitempty"`
 }
 
-func NewPeerClient(cc *grpc.ClientConn) PeerClient {
-	return &peerClient{cc}
+func (m *RecentTransactionsCursor) Reset()         { *m = RecentTransactionsCursor{} }
+func (m *RecentTransactionsCursor) String() string { return proto.CompactTextString(m) }
+func (*RecentTransactionsCursor) ProtoMessage()    {}
+
+// QueryRecentTransactions is the payload of Message.CHAIN_QUERY_RECENT_TX,
+// asking a peer for the last maxCount committed transactions of an account,
+// most recent first, before the cursor or from the end of the chain if none.
+// The account of a transaction is the hex SHA-256 of its cert.
+type QueryRecentTransactions struct {
+	AccountID string                    `protobuf:"bytes,1,opt,name=accountID" json:"accountID,omitempty"`
+	MaxCount  uint32                    `protobuf:"varint,2,opt,name=maxCount" json:"maxCount,omitempty"`
+	Before    *RecentTransactionsCursor `protobuf:"bytes,3,opt,name=before" json:"before,omitempty"`
 }
 
-func (c *peerClient) Chat(ctx context.Context, opts ...grpc.CallOption) (Peer_ChatClient, error) {
-	stream, err := grpc.NewClientStream(ctx, &_Peer_serviceDesc.Streams[0], c.cc, "/protos.Peer/Chat", opts...)
-	if err != nil {
-		return nil, err
+func (m *QueryRecentTransactions) Reset()         { *m = QueryRecentTransactions{} }
+func (m *QueryRecentTransactions) String() string { return proto.CompactTextString(m) }
+func (*QueryRecentTransactions) ProtoMessage()    {}
+
+func (m *QueryRecentTransactions) GetBefore() *RecentTransactionsCursor {
+	if m != nil {
+		return m.Before
 	}
-	x := &peerChatClient{stream}
-	return x, nil
+	return nil
 }
 
-type Peer_ChatClient interface {
+// RecentTransactionsResponse is the payload of Message.CHAIN_RECENT_TX_RESPONSE,
+// a page of the transactions asked by a Message.CHAIN_QUERY_RECENT_TX. next is
+// the cursor to query the next page with, unset once the chain is exhausted.
+type RecentTransactionsResponse struct {
+	Transactions []*Transaction            `protobuf:"bytes,1,rep,name=transactions" json:"transactions,omitempty"`
+	Next         *RecentTransactionsCursor `protobuf:"bytes,2,opt,name=next" json:"next,omitempty"`
+}
+
+func (m *RecentTransactionsResponse) Reset()         { *m = RecentTransactionsResponse{} }
+func (m *RecentTransactionsResponse) String() string { return proto.CompactTextString(m) }
+func (*RecentTransactionsResponse) ProtoMessage()    {}
+
+func (m *RecentTransactionsResponse) GetTransactions() []*Transaction {
+	if m != nil {
+		return m.Transactions
+	}
+	return nil
+}
+
+func (m *RecentTransactionsResponse) GetNext() *RecentTransactionsCursor {
+	if m != nil {
+		return m.Next
+	}
+	return nil
+}
+
+// QueryTransactionHistory is the payload of Message.CHAIN_QUERY_TX_HISTORY,
+// asking a peer for up to maxResults committed transactions of an account
+// timestamped from fromTime to toTime included, in Unix nanoseconds, oldest
+// first. A toTime of 0 sets no upper bound. cursorTxID, the last transaction
+// of the previous page, asks for the transactions following it.
+type QueryTransactionHistory struct {
+	AccountID  string `protobuf:"bytes,1,opt,name=accountID" json:"accountID,omitempty"`
+	FromTime   int64  `protobuf:"varint,2,opt,name=fromTime" json:"fromTime,omitempty"`
+	ToTime     int64  `protobuf:"varint,3,opt,name=toTime" json:"toTime,omitempty"`
+	MaxResults uint32 `protobuf:"varint,4,opt,name=maxResults" json:"maxResults,omitempty"`
+	CursorTxID string `protobuf:"bytes,5,opt,name=cursorTxID" json:"cursorTxID,omitempty"`
+}
+
+func (m *QueryTransactionHistory) Reset()         { *m = QueryTransactionHistory{} }
+func (m *QueryTransactionHistory) String() string { return proto.CompactTextString(m) }
+func (*QueryTransactionHistory) ProtoMessage()    {}
+
+// TransactionHistoryResponse is the payload of
+// Message.CHAIN_TX_HISTORY_RESPONSE, the transactions asked by a
+// Message.CHAIN_QUERY_TX_HISTORY. total is the number of transactions in the
+// range following the cursor, truncated set when more than those returned.
+type TransactionHistoryResponse struct {
+	Transactions []*Transaction `protobuf:"bytes,1,rep,name=transactions" json:"transactions,omitempty"`
+	Total        uint32         `protobuf:"varint,2,opt,name=total" json:"total,omitempty"`
+	Truncated    bool           `protobuf:"varint,3,opt,name=truncated" json:"truncated,omitempty"`
+}
+
+func (m *TransactionHistoryResponse) Reset()         { *m = TransactionHistoryResponse{} }
+func (m *TransactionHistoryResponse) String() string { return proto.CompactTextString(m) }
+func (*TransactionHistoryResponse) ProtoMessage()    {}
+
+func (m *TransactionHistoryResponse) GetTransactions() []*Transaction {
+	if m != nil {
+		return m.Transactions
+	}
+	return nil
+}
+
+// QueryStateDiff is the payload of Message.CHAIN_QUERY_STATE_DIFF, asking a
+// peer for the state changes made by block blockNumber.
+type QueryStateDiff struct {
+	BlockNumber uint64 `protobuf:"varint,1,opt,name=blockNumber" json:"blockNumber,omitempty"`
+}
+
+func (m *QueryStateDiff) Reset()         { *m = QueryStateDiff{} }
+func (m *QueryStateDiff) String() string { return proto.CompactTextString(m) }
+func (*QueryStateDiff) ProtoMessage()    {}
+
+// StateChange is the change of the value of key of chaincodeID made by a
+// block, from oldValue to newValue, or the removal of the key if deleted.
+type StateChange struct {
+	ChaincodeID string `protobuf:"bytes,1,opt,name=chaincodeID" json:"chaincodeID,omitempty"`
+	Key         string `protobuf:"bytes,2,opt,name=key" json:"key,omitempty"`
+	OldValue    []byte `protobuf:"bytes,3,opt,name=oldValue,proto3" json:"oldValue,omitempty"`
+	NewValue    []byte `protobuf:"bytes,4,opt,name=newValue,proto3" json:"newValue,omitempty"`
+	Deleted     bool   `protobuf:"varint,5,opt,name=deleted" json:"deleted,omitempty"`
+}
+
+func (m *StateChange) Reset()         { *m = StateChange{} }
+func (m *StateChange) String() string { return proto.CompactTextString(m) }
+func (*StateChange) ProtoMessage()    {}
+
+// StateDiffResponse is the payload of Message.CHAIN_STATE_DIFF_RESPONSE, a
+// fragment of the changes asked by a Message.CHAIN_QUERY_STATE_DIFF, sorted
+// by chaincodeID and key. more is set on every fragment but the last.
+type StateDiffResponse struct {
+	BlockNumber uint64         `protobuf:"varint,1,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	Changes     []*StateChange `protobuf:"bytes,2,rep,name=changes" json:"changes,omitempty"`
+	More        bool           `protobuf:"varint,3,opt,name=more" json:"more,omitempty"`
+}
+
+func (m *StateDiffResponse) Reset()         { *m = StateDiffResponse{} }
+func (m *StateDiffResponse) String() string { return proto.CompactTextString(m) }
+func (*StateDiffResponse) ProtoMessage()    {}
+
+func (m *StateDiffResponse) GetChanges() []*StateChange {
+	if m != nil {
+		return m.Changes
+	}
+	return nil
+}
+
+// QueryContractState is the payload of Message.CHAIN_QUERY_CONTRACT_STATE,
+// asking a peer for the value of key in the state of the smart contract, i.e.
+// chaincode, contractAddress as of block atBlock, 0 meaning the latest block.
+type QueryContractState struct {
+	ContractAddress string `protobuf:"bytes,1,opt,name=contractAddress" json:"contractAddress,omitempty"`
+	Key             string `protobuf:"bytes,2,opt,name=key" json:"key,omitempty"`
+	AtBlock         uint64 `protobuf:"varint,3,opt,name=atBlock" json:"atBlock,omitempty"`
+}
+
+func (m *QueryContractState) Reset()         { *m = QueryContractState{} }
+func (m *QueryContractState) String() string { return proto.CompactTextString(m) }
+func (*QueryContractState) ProtoMessage()    {}
+
+// ContractStateResponse is the payload of Message.CHAIN_CONTRACT_STATE_RESPONSE,
+// a fragment of the value asked by a Message.CHAIN_QUERY_CONTRACT_STATE as of
+// block atBlock. exists is false if the key had no value then. more is set on
+// every fragment but the last.
+type ContractStateResponse struct {
+	Value   []byte `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	Exists  bool   `protobuf:"varint,2,opt,name=exists" json:"exists,omitempty"`
+	AtBlock uint64 `protobuf:"varint,3,opt,name=atBlock" json:"atBlock,omitempty"`
+	More    bool   `protobuf:"varint,4,opt,name=more" json:"more,omitempty"`
+}
+
+func (m *ContractStateResponse) Reset()         { *m = ContractStateResponse{} }
+func (m *ContractStateResponse) String() string { return proto.CompactTextString(m) }
+func (*ContractStateResponse) ProtoMessage()    {}
+
+// QueryEpoch is the payload of Message.CHAIN_QUERY_EPOCH, asking for the
+// validator set of epoch epochNumber.
+type QueryEpoch struct {
+	EpochNumber uint64 `protobuf:"varint,1,opt,name=epochNumber" json:"epochNumber,omitempty"`
+}
+
+func (m *QueryEpoch) Reset()         { *m = QueryEpoch{} }
+func (m *QueryEpoch) String() string { return proto.CompactTextString(m) }
+func (*QueryEpoch) ProtoMessage()    {}
+
+// ValidatorInfo is a validator of an epoch. publicKey is the pkiID of its
+// endpoint.
+type ValidatorInfo struct {
+	PeerID      *PeerID `protobuf:"bytes,1,opt,name=peerID" json:"peerID,omitempty"`
+	VotingPower uint64  `protobuf:"varint,2,opt,name=votingPower" json:"votingPower,omitempty"`
+	PublicKey   []byte  `protobuf:"bytes,3,opt,name=publicKey,proto3" json:"publicKey,omitempty"`
+}
+
+func (m *ValidatorInfo) Reset()         { *m = ValidatorInfo{} }
+func (m *ValidatorInfo) String() string { return proto.CompactTextString(m) }
+func (*ValidatorInfo) ProtoMessage()    {}
+
+func (m *ValidatorInfo) GetPeerID() *PeerID {
+	if m != nil {
+		return m.PeerID
+	}
+	return nil
+}
+
+// EpochResponse is the payload of Message.CHAIN_EPOCH_RESPONSE, the reply to a
+// Message.CHAIN_QUERY_EPOCH: the blocks startBlock to endBlock of the epoch
+// and its validators.
+type EpochResponse struct {
+	EpochNumber uint64           `protobuf:"varint,1,opt,name=epochNumber" json:"epochNumber,omitempty"`
+	StartBlock  uint64           `protobuf:"varint,2,opt,name=startBlock" json:"startBlock,omitempty"`
+	EndBlock    uint64           `protobuf:"varint,3,opt,name=endBlock" json:"endBlock,omitempty"`
+	Validators  []*ValidatorInfo `protobuf:"bytes,4,rep,name=validators" json:"validators,omitempty"`
+}
+
+func (m *EpochResponse) Reset()         { *m = EpochResponse{} }
+func (m *EpochResponse) String() string { return proto.CompactTextString(m) }
+func (*EpochResponse) ProtoMessage()    {}
+
+func (m *EpochResponse) GetValidators() []*ValidatorInfo {
+	if m != nil {
+		return m.Validators
+	}
+	return nil
+}
+
+// SyncPaused is the payload of Message.CHAIN_SYNC_PAUSED, the reply to a
+// Message.CHAIN_SYNC_PAUSE. The syncs served on the Chat are held until a
+// Message.CHAIN_SYNC_RESUME, or aborted at abortAt.
+type SyncPaused struct {
+	AbortAt *google_protobuf.Timestamp `protobuf:"bytes,1,opt,name=abortAt" json:"abortAt,omitempty"`
+}
+
+func (m *SyncPaused) Reset()         { *m = SyncPaused{} }
+func (m *SyncPaused) String() string { return proto.CompactTextString(m) }
+func (*SyncPaused) ProtoMessage()    {}
+
+func (m *SyncPaused) GetAbortAt() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.AbortAt
+	}
+	return nil
+}
+
+// TxOutPoint is the output index of the transaction txID.
+type TxOutPoint struct {
+	TxID  string `protobuf:"bytes,1,opt,name=txID" json:"txID,omitempty"`
+	Index uint32 `protobuf:"varint,2,opt,name=index" json:"index,omitempty"`
+}
+
+func (m *TxOutPoint) Reset()         { *m = TxOutPoint{} }
+func (m *TxOutPoint) String() string { return proto.CompactTextString(m) }
+func (*TxOutPoint) ProtoMessage()    {}
+
+// QueryDoubleSpend is the payload of Message.CHAIN_QUERY_DOUBLE_SPEND, asking
+// a peer whether the output txInput was already spent.
+type QueryDoubleSpend struct {
+	TxInput *TxOutPoint `protobuf:"bytes,1,opt,name=txInput" json:"txInput,omitempty"`
+}
+
+func (m *QueryDoubleSpend) Reset()         { *m = QueryDoubleSpend{} }
+func (m *QueryDoubleSpend) String() string { return proto.CompactTextString(m) }
+func (*QueryDoubleSpend) ProtoMessage()    {}
+
+func (m *QueryDoubleSpend) GetTxInput() *TxOutPoint {
+	if m != nil {
+		return m.TxInput
+	}
+	return nil
+}
+
+// DoubleSpendResponse is the payload of Message.CHAIN_DOUBLE_SPEND_RESPONSE,
+// the reply to a Message.CHAIN_QUERY_DOUBLE_SPEND. If found, the output was
+// spent by the transaction spendingTxID of block blockNumber.
+type DoubleSpendResponse struct {
+	Found        bool   `protobuf:"varint,1,opt,name=found" json:"found,omitempty"`
+	SpendingTxID string `protobuf:"bytes,2,opt,name=spendingTxID" json:"spendingTxID,omitempty"`
+	BlockNumber  uint64 `protobuf:"varint,3,opt,name=blockNumber" json:"blockNumber,omitempty"`
+}
+
+func (m *DoubleSpendResponse) Reset()         { *m = DoubleSpendResponse{} }
+func (m *DoubleSpendResponse) String() string { return proto.CompactTextString(m) }
+func (*DoubleSpendResponse) ProtoMessage()    {}
+
+// ValidatePoW is the payload of Message.CHAIN_VALIDATE_POW, asking a peer to
+// verify the proof of work of a proposed block header.
+type ValidatePoW struct {
+	Header *BlockHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+}
+
+func (m *ValidatePoW) Reset()         { *m = ValidatePoW{} }
+func (m *ValidatePoW) String() string { return proto.CompactTextString(m) }
+func (*ValidatePoW) ProtoMessage()    {}
+
+func (m *ValidatePoW) GetHeader() *BlockHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+// PoWResult is the payload of Message.CHAIN_VALIDATE_POW_RESULT, the reply to
+// a Message.CHAIN_VALIDATE_POW. The header hashes to hash, of difficulty
+// leading zero bits, and is valid if that meets its bits.
+type PoWResult struct {
+	Valid      bool   `protobuf:"varint,1,opt,name=valid" json:"valid,omitempty"`
+	Difficulty uint32 `protobuf:"varint,2,opt,name=difficulty" json:"difficulty,omitempty"`
+	Hash       []byte `protobuf:"bytes,3,opt,name=hash,proto3" json:"hash,omitempty"`
+}
+
+func (m *PoWResult) Reset()         { *m = PoWResult{} }
+func (m *PoWResult) String() string { return proto.CompactTextString(m) }
+func (*PoWResult) ProtoMessage()    {}
+
+// EstimateTxCost is the payload of Message.CHAIN_ESTIMATE_TX_COST, asking a
+// peer what a transaction would cost before it is submitted.
+type EstimateTxCost struct {
+	Tx *Transaction `protobuf:"bytes,1,opt,name=tx" json:"tx,omitempty"`
+}
+
+func (m *EstimateTxCost) Reset()         { *m = EstimateTxCost{} }
+func (m *EstimateTxCost) String() string { return proto.CompactTextString(m) }
+func (*EstimateTxCost) ProtoMessage()    {}
+
+func (m *EstimateTxCost) GetTx() *Transaction {
+	if m != nil {
+		return m.Tx
+	}
+	return nil
+}
+
+// TxCostEstimate is the payload of Message.CHAIN_TX_COST_ESTIMATE, the reply
+// to a Message.CHAIN_ESTIMATE_TX_COST: the gas the transaction would use and
+// the fee it would pay at the lowest gas price of the peer. confidence, from
+// 0 to 1, is how deterministic the estimate is.
+type TxCostEstimate struct {
+	GasEstimate uint64  `protobuf:"varint,1,opt,name=gasEstimate" json:"gasEstimate,omitempty"`
+	FeeEstimate uint64  `protobuf:"varint,2,opt,name=feeEstimate" json:"feeEstimate,omitempty"`
+	Confidence  float32 `protobuf:"fixed32,3,opt,name=confidence" json:"confidence,omitempty"`
+}
+
+func (m *TxCostEstimate) Reset()         { *m = TxCostEstimate{} }
+func (m *TxCostEstimate) String() string { return proto.CompactTextString(m) }
+func (*TxCostEstimate) ProtoMessage()    {}
+
+// GetCanonicalTip is the payload of Message.CHAIN_GET_CANONICAL_TIP, asking a
+// peer which chain tip it considers canonical.
+type GetCanonicalTip struct {
+}
+
+func (m *GetCanonicalTip) Reset()         { *m = GetCanonicalTip{} }
+func (m *GetCanonicalTip) String() string { return proto.CompactTextString(m) }
+func (*GetCanonicalTip) ProtoMessage()    {}
+
+// CanonicalTip is the payload of Message.CHAIN_CANONICAL_TIP, the reply to a
+// Message.CHAIN_GET_CANONICAL_TIP: the last block of the canonical chain of
+// the peer and the total difficulty of the chain up to it.
+type CanonicalTip struct {
+	BlockNumber     uint64 `protobuf:"varint,1,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	BlockHash       []byte `protobuf:"bytes,2,opt,name=blockHash,proto3" json:"blockHash,omitempty"`
+	TotalDifficulty uint64 `protobuf:"varint,3,opt,name=totalDifficulty" json:"totalDifficulty,omitempty"`
+}
+
+func (m *CanonicalTip) Reset()         { *m = CanonicalTip{} }
+func (m *CanonicalTip) String() string { return proto.CompactTextString(m) }
+func (*CanonicalTip) ProtoMessage()    {}
+
+// QueryForkChoice is the payload of Message.CHAIN_QUERY_FORK_CHOICE, asking a
+// peer which of the chain tips it knows of it considers canonical.
+type QueryForkChoice struct {
+}
+
+func (m *QueryForkChoice) Reset()         { *m = QueryForkChoice{} }
+func (m *QueryForkChoice) String() string { return proto.CompactTextString(m) }
+func (*QueryForkChoice) ProtoMessage()    {}
+
+// ChainTip is the last block of a chain: its hash, the height of the chain
+// up to it and the total work of the chain.
+type ChainTip struct {
+	Hash      []byte `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+	Height    uint64 `protobuf:"varint,2,opt,name=height" json:"height,omitempty"`
+	TotalWork uint64 `protobuf:"varint,3,opt,name=totalWork" json:"totalWork,omitempty"`
+}
+
+func (m *ChainTip) Reset()         { *m = ChainTip{} }
+func (m *ChainTip) String() string { return proto.CompactTextString(m) }
+func (*ChainTip) ProtoMessage()    {}
+
+// ForkChoice is the payload of Message.CHAIN_FORK_CHOICE, the reply to a
+// Message.CHAIN_QUERY_FORK_CHOICE: the chain tips the peer knows of, the one
+// it considers canonical first.
+type ForkChoice struct {
+	Tips []*ChainTip `protobuf:"bytes,1,rep,name=tips" json:"tips,omitempty"`
+}
+
+func (m *ForkChoice) Reset()         { *m = ForkChoice{} }
+func (m *ForkChoice) String() string { return proto.CompactTextString(m) }
+func (*ForkChoice) ProtoMessage()    {}
+
+func (m *ForkChoice) GetTips() []*ChainTip {
+	if m != nil {
+		return m.Tips
+	}
+	return nil
+}
+
+// ReportUncle is the payload of Message.CHAIN_REPORT_UNCLE, reporting uncle,
+// a block orphaned by a fork, as included in block includedInBlock for the
+// reward of its proposer. The peer answers with a Message.CHAIN_UNCLE_ACCEPTED
+// or a Message.CHAIN_UNCLE_REJECTED.
+type ReportUncle struct {
+	Uncle           *Block `protobuf:"bytes,1,opt,name=uncle" json:"uncle,omitempty"`
+	IncludedInBlock uint64 `protobuf:"varint,2,opt,name=includedInBlock" json:"includedInBlock,omitempty"`
+}
+
+func (m *ReportUncle) Reset()         { *m = ReportUncle{} }
+func (m *ReportUncle) String() string { return proto.CompactTextString(m) }
+func (*ReportUncle) ProtoMessage()    {}
+
+func (m *ReportUncle) GetUncle() *Block {
+	if m != nil {
+		return m.Uncle
+	}
+	return nil
+}
+
+// UncleAccepted is the payload of Message.CHAIN_UNCLE_ACCEPTED.
+type UncleAccepted struct {
+}
+
+func (m *UncleAccepted) Reset()         { *m = UncleAccepted{} }
+func (m *UncleAccepted) String() string { return proto.CompactTextString(m) }
+func (*UncleAccepted) ProtoMessage()    {}
+
+// UncleRejected is the payload of Message.CHAIN_UNCLE_REJECTED, giving the
+// reason the uncle of a Message.CHAIN_REPORT_UNCLE was not accepted.
+type UncleRejected struct {
+	Reason string `protobuf:"bytes,1,opt,name=reason" json:"reason,omitempty"`
+}
+
+func (m *UncleRejected) Reset()         { *m = UncleRejected{} }
+func (m *UncleRejected) String() string { return proto.CompactTextString(m) }
+func (*UncleRejected) ProtoMessage()    {}
+
+// QueryMempool is the payload of Message.CHAIN_QUERY_MEMPOOL, asking a peer
+// for up to maxResults of the transactions not yet sealed in a block paying
+// at least minGasPrice, 0 meaning all of them.
+type QueryMempool struct {
+	MaxResults  uint32 `protobuf:"varint,1,opt,name=maxResults" json:"maxResults,omitempty"`
+	MinGasPrice uint64 `protobuf:"varint,2,opt,name=minGasPrice" json:"minGasPrice,omitempty"`
+}
+
+func (m *QueryMempool) Reset()         { *m = QueryMempool{} }
+func (m *QueryMempool) String() string { return proto.CompactTextString(m) }
+func (*QueryMempool) ProtoMessage()    {}
+
+// MempoolResponse is the payload of Message.CHAIN_MEMPOOL_RESPONSE, the reply
+// to a Message.CHAIN_QUERY_MEMPOOL: the pending transactions, highest gas
+// price first, and the number of pending transactions left out of the reply.
+type MempoolResponse struct {
+	Pending []*Transaction `protobuf:"bytes,1,rep,name=pending" json:"pending,omitempty"`
+	Dropped uint32         `protobuf:"varint,2,opt,name=dropped" json:"dropped,omitempty"`
+}
+
+func (m *MempoolResponse) Reset()         { *m = MempoolResponse{} }
+func (m *MempoolResponse) String() string { return proto.CompactTextString(m) }
+func (*MempoolResponse) ProtoMessage()    {}
+
+func (m *MempoolResponse) GetPending() []*Transaction {
+	if m != nil {
+		return m.Pending
+	}
+	return nil
+}
+
+// RollbackRequest is the payload of Message.CHAIN_ROLLBACK_REQUEST, asking a
+// peer to revert committed transactions found erroneous for an off-chain
+// reason. adminSignature is the HMAC-SHA256 of the request without it, keyed
+// with the admin secret of the peer. The request is accepted once for its
+// random nonce, until expiresAt, in seconds since the epoch.
+type RollbackRequest struct {
+	TxIDs          []string `protobuf:"bytes,1,rep,name=txIDs" json:"txIDs,omitempty"`
+	Reason         string   `protobuf:"bytes,2,opt,name=reason" json:"reason,omitempty"`
+	AdminSignature []byte   `protobuf:"bytes,3,opt,name=adminSignature,proto3" json:"adminSignature,omitempty"`
+	Nonce          []byte   `protobuf:"bytes,4,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	ExpiresAt      int64    `protobuf:"varint,5,opt,name=expiresAt" json:"expiresAt,omitempty"`
+}
+
+func (m *RollbackRequest) Reset()         { *m = RollbackRequest{} }
+func (m *RollbackRequest) String() string { return proto.CompactTextString(m) }
+func (*RollbackRequest) ProtoMessage()    {}
+
+// RollbackResponse is the payload of Message.CHAIN_ROLLBACK_RESPONSE, the
+// reply to a Message.CHAIN_ROLLBACK_REQUEST: the transactions reverted and
+// those which could not be.
+type RollbackResponse struct {
+	RolledBack []string `protobuf:"bytes,1,rep,name=rolledBack" json:"rolledBack,omitempty"`
+	Failed     []string `protobuf:"bytes,2,rep,name=failed" json:"failed,omitempty"`
+}
+
+func (m *RollbackResponse) Reset()         { *m = RollbackResponse{} }
+func (m *RollbackResponse) String() string { return proto.CompactTextString(m) }
+func (*RollbackResponse) ProtoMessage()    {}
+
+// GetTransactionReceipt is the payload of Message.CHAIN_TRANSACTIONS_GET_RECEIPT,
+// asking a peer for the receipt of a committed transaction.
+type GetTransactionReceipt struct {
+	TxID string `protobuf:"bytes,1,opt,name=txID" json:"txID,omitempty"`
+}
+
+func (m *GetTransactionReceipt) Reset()         { *m = GetTransactionReceipt{} }
+func (m *GetTransactionReceipt) String() string { return proto.CompactTextString(m) }
+func (*GetTransactionReceipt) ProtoMessage()    {}
+
+// TransactionReceipt is the payload of Message.CHAIN_TRANSACTIONS_RECEIPT.
+// merkleProof holds the sibling hashes from the transaction up to merkleRoot,
+// the root of the merkle tree over the transactions of the block, and
+// signature is the issuing peer's signature over the receipt without it.
+type TransactionReceipt struct {
+	TxID        string   `protobuf:"bytes,1,opt,name=txID" json:"txID,omitempty"`
+	BlockNumber uint64   `protobuf:"varint,2,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	TxIndex     uint64   `protobuf:"varint,3,opt,name=txIndex" json:"txIndex,omitempty"`
+	MerkleProof [][]byte `protobuf:"bytes,4,rep,name=merkleProof,proto3" json:"merkleProof,omitempty"`
+	MerkleRoot  []byte   `protobuf:"bytes,5,opt,name=merkleRoot,proto3" json:"merkleRoot,omitempty"`
+	Signature   []byte   `protobuf:"bytes,6,opt,name=signature,proto3" json:"signature,omitempty"`
+}
+
+func (m *TransactionReceipt) Reset()         { *m = TransactionReceipt{} }
+func (m *TransactionReceipt) String() string { return proto.CompactTextString(m) }
+func (*TransactionReceipt) ProtoMessage()    {}
+
+// GetBlockHeader is the payload of Message.CHAIN_GET_BLOCK_HEADER, asking a
+// peer for the header of a block.
+type GetBlockHeader struct {
+	BlockNumber uint64 `protobuf:"varint,1,opt,name=blockNumber" json:"blockNumber,omitempty"`
+}
+
+func (m *GetBlockHeader) Reset()         { *m = GetBlockHeader{} }
+func (m *GetBlockHeader) String() string { return proto.CompactTextString(m) }
+func (*GetBlockHeader) ProtoMessage()    {}
+
+// BlockHeader is the payload of Message.CHAIN_BLOCK_HEADER, the parts of a
+// block lightweight clients need to follow the chain. merkleRoot is the root
+// of the merkle tree over the transactions of the block, as in
+// TransactionReceipt. On proof of work chains, bits is the number of leading
+// zero bits the header must hash to, nonce making it do so. On chains of the
+// BFT consensus, validatorVotes are the votes of the quorum which committed
+// the block, signing voteRound and votedHash, the hash of the block proposal.
+type BlockHeader struct {
+	BlockNumber    uint64                     `protobuf:"varint,1,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	Hash           []byte                     `protobuf:"bytes,2,opt,name=hash,proto3" json:"hash,omitempty"`
+	PreviousHash   []byte                     `protobuf:"bytes,3,opt,name=previousHash,proto3" json:"previousHash,omitempty"`
+	StateHash      []byte                     `protobuf:"bytes,4,opt,name=stateHash,proto3" json:"stateHash,omitempty"`
+	MerkleRoot     []byte                     `protobuf:"bytes,5,opt,name=merkleRoot,proto3" json:"merkleRoot,omitempty"`
+	Timestamp      *google_protobuf.Timestamp `protobuf:"bytes,6,opt,name=timestamp" json:"timestamp,omitempty"`
+	TxCount        uint32                     `protobuf:"varint,7,opt,name=txCount" json:"txCount,omitempty"`
+	Bits           uint32                     `protobuf:"varint,8,opt,name=bits" json:"bits,omitempty"`
+	Nonce          uint64                     `protobuf:"varint,9,opt,name=nonce" json:"nonce,omitempty"`
+	ValidatorVotes []*ValidatorVote           `protobuf:"bytes,10,rep,name=validatorVotes" json:"validatorVotes,omitempty"`
+	VoteRound      uint64                     `protobuf:"varint,11,opt,name=voteRound" json:"voteRound,omitempty"`
+	VotedHash      []byte                     `protobuf:"bytes,12,opt,name=votedHash,proto3" json:"votedHash,omitempty"`
+}
+
+func (m *BlockHeader) Reset()         { *m = BlockHeader{} }
+func (m *BlockHeader) String() string { return proto.CompactTextString(m) }
+func (*BlockHeader) ProtoMessage()    {}
+
+func (m *BlockHeader) GetTimestamp() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.Timestamp
+	}
+	return nil
+}
+
+func (m *BlockHeader) GetValidatorVotes() []*ValidatorVote {
+	if m != nil {
+		return m.ValidatorVotes
+	}
+	return nil
+}
+
+// ValidatorVote is the signature of a validator over the round and the hash
+// of a block proposal, as in BlockVote.
+type ValidatorVote struct {
+	ValidatorID *PeerID `protobuf:"bytes,1,opt,name=validatorID" json:"validatorID,omitempty"`
+	Signature   []byte  `protobuf:"bytes,2,opt,name=signature,proto3" json:"signature,omitempty"`
+}
+
+func (m *ValidatorVote) Reset()         { *m = ValidatorVote{} }
+func (m *ValidatorVote) String() string { return proto.CompactTextString(m) }
+func (*ValidatorVote) ProtoMessage()    {}
+
+func (m *ValidatorVote) GetValidatorID() *PeerID {
+	if m != nil {
+		return m.ValidatorID
+	}
+	return nil
+}
+
+// GetBlockBody is the payload of Message.CHAIN_GET_BLOCK_BODY, asking a peer
+// for the body of a block.
+type GetBlockBody struct {
+	BlockNumber uint64 `protobuf:"varint,1,opt,name=blockNumber" json:"blockNumber,omitempty"`
+}
+
+func (m *GetBlockBody) Reset()         { *m = GetBlockBody{} }
+func (m *GetBlockBody) String() string { return proto.CompactTextString(m) }
+func (*GetBlockBody) ProtoMessage()    {}
+
+// BlockBody is the payload of Message.CHAIN_BLOCK_BODY, the parts of a block
+// not in its BlockHeader. A block is reassembled from both and checked
+// against the hash of the header.
+type BlockBody struct {
+	BlockNumber       uint64         `protobuf:"varint,1,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	Transactions      []*Transaction `protobuf:"bytes,2,rep,name=transactions" json:"transactions,omitempty"`
+	Version           uint32         `protobuf:"varint,3,opt,name=version" json:"version,omitempty"`
+	ConsensusMetadata []byte         `protobuf:"bytes,4,opt,name=consensusMetadata,proto3" json:"consensusMetadata,omitempty"`
+}
+
+func (m *BlockBody) Reset()         { *m = BlockBody{} }
+func (m *BlockBody) String() string { return proto.CompactTextString(m) }
+func (*BlockBody) ProtoMessage()    {}
+
+func (m *BlockBody) GetTransactions() []*Transaction {
+	if m != nil {
+		return m.Transactions
+	}
+	return nil
+}
+
+// GetBlockProof is the payload of Message.CHAIN_GET_BLOCK_PROOF, asking a
+// peer for the proof that a block belongs to its chain, to be anchored into
+// the chain externalChainID.
+type GetBlockProof struct {
+	BlockNumber     uint64 `protobuf:"varint,1,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	ExternalChainID string `protobuf:"bytes,2,opt,name=externalChainID" json:"externalChainID,omitempty"`
+}
+
+func (m *GetBlockProof) Reset()         { *m = GetBlockProof{} }
+func (m *GetBlockProof) String() string { return proto.CompactTextString(m) }
+func (*GetBlockProof) ProtoMessage()    {}
+
+// SPVProof proves to a light client that the block of header descends from
+// a genesis block. merklePath and genesisPath lead from the SHA-256 of the
+// hashes of the block and of the genesis block to root, the root of the
+// merkle tree over the hashes of the blocks from the genesis block to this
+// one. The signature of the peer covers the proof with an empty signature.
+type SPVProof struct {
+	Header          *BlockHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	MerklePath      [][]byte     `protobuf:"bytes,2,rep,name=merklePath,proto3" json:"merklePath,omitempty"`
+	GenesisPath     [][]byte     `protobuf:"bytes,3,rep,name=genesisPath,proto3" json:"genesisPath,omitempty"`
+	Root            []byte       `protobuf:"bytes,4,opt,name=root,proto3" json:"root,omitempty"`
+	ExternalChainID string       `protobuf:"bytes,5,opt,name=externalChainID" json:"externalChainID,omitempty"`
+	Signature       []byte       `protobuf:"bytes,6,opt,name=signature,proto3" json:"signature,omitempty"`
+}
+
+func (m *SPVProof) Reset()         { *m = SPVProof{} }
+func (m *SPVProof) String() string { return proto.CompactTextString(m) }
+func (*SPVProof) ProtoMessage()    {}
+
+func (m *SPVProof) GetHeader() *BlockHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+// BlockProof is the payload of Message.CHAIN_BLOCK_PROOF, the reply to a
+// CHAIN_GET_BLOCK_PROOF.
+type BlockProof struct {
+	BlockNumber uint64    `protobuf:"varint,1,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	Proof       *SPVProof `protobuf:"bytes,2,opt,name=proof" json:"proof,omitempty"`
+}
+
+func (m *BlockProof) Reset()         { *m = BlockProof{} }
+func (m *BlockProof) String() string { return proto.CompactTextString(m) }
+func (*BlockProof) ProtoMessage()    {}
+
+func (m *BlockProof) GetProof() *SPVProof {
+	if m != nil {
+		return m.Proof
+	}
+	return nil
+}
+
+// ValidationViolation is a field of the transaction at txIndex of a
+// CHAIN_TRANSACTIONS batch failing the transaction schema of the receiver.
+type ValidationViolation struct {
+	TxIndex uint32 `protobuf:"varint,1,opt,name=txIndex" json:"txIndex,omitempty"`
+	TxID    string `protobuf:"bytes,2,opt,name=txID" json:"txID,omitempty"`
+	Field   string `protobuf:"bytes,3,opt,name=field" json:"field,omitempty"`
+	Reason  string `protobuf:"bytes,4,opt,name=reason" json:"reason,omitempty"`
+}
+
+func (m *ValidationViolation) Reset()         { *m = ValidationViolation{} }
+func (m *ValidationViolation) String() string { return proto.CompactTextString(m) }
+func (*ValidationViolation) ProtoMessage()    {}
+
+// TransactionsValidationError is the payload of
+// Message.CHAIN_TRANSACTIONS_VALIDATION_ERROR, the reply to a
+// Message.CHAIN_TRANSACTIONS batch (a TransactionBlock) with invalid
+// transactions. rejected is set when the valid transactions of the batch
+// were not processed either.
+type TransactionsValidationError struct {
+	Violations []*ValidationViolation `protobuf:"bytes,1,rep,name=violations" json:"violations,omitempty"`
+	Rejected   bool                   `protobuf:"varint,2,opt,name=rejected" json:"rejected,omitempty"`
+}
+
+func (m *TransactionsValidationError) Reset()         { *m = TransactionsValidationError{} }
+func (m *TransactionsValidationError) String() string { return proto.CompactTextString(m) }
+func (*TransactionsValidationError) ProtoMessage()    {}
+
+func (m *TransactionsValidationError) GetViolations() []*ValidationViolation {
+	if m != nil {
+		return m.Violations
+	}
+	return nil
+}
+
+// TransactionsVersionError is the payload of
+// Message.CHAIN_TRANSACTIONS_VERSION_ERROR, the reply to a
+// Message.CHAIN_TRANSACTIONS batch whose schemaVersion is outside of the
+// versions the receiver supports, supportedMin to supportedMax included. The
+// batch is dropped.
+type TransactionsVersionError struct {
+	SupportedMin uint32 `protobuf:"varint,1,opt,name=supportedMin" json:"supportedMin,omitempty"`
+	SupportedMax uint32 `protobuf:"varint,2,opt,name=supportedMax" json:"supportedMax,omitempty"`
+}
+
+func (m *TransactionsVersionError) Reset()         { *m = TransactionsVersionError{} }
+func (m *TransactionsVersionError) String() string { return proto.CompactTextString(m) }
+func (*TransactionsVersionError) ProtoMessage()    {}
+
+// TransactionsError is the payload of Message.CHAIN_TRANSACTIONS_ERROR, the
+// reply to a Message.CHAIN_TRANSACTIONS batch whose transactions txIDs were
+// dropped for reason.
+type TransactionsError struct {
+	Reason string   `protobuf:"bytes,1,opt,name=reason" json:"reason,omitempty"`
+	TxIDs  []string `protobuf:"bytes,2,rep,name=txIDs" json:"txIDs,omitempty"`
+}
+
+func (m *TransactionsError) Reset()         { *m = TransactionsError{} }
+func (m *TransactionsError) String() string { return proto.CompactTextString(m) }
+func (*TransactionsError) ProtoMessage()    {}
+
+// TxFailure is a transaction of a Message.CHAIN_TRANSACTIONS batch which was
+// not committed, and the reason why.
+type TxFailure struct {
+	TxID   string `protobuf:"bytes,1,opt,name=txID" json:"txID,omitempty"`
+	Reason string `protobuf:"bytes,2,opt,name=reason" json:"reason,omitempty"`
+}
+
+func (m *TxFailure) Reset()         { *m = TxFailure{} }
+func (m *TxFailure) String() string { return proto.CompactTextString(m) }
+func (*TxFailure) ProtoMessage()    {}
+
+// TransactionsPartialAck is the payload of
+// Message.CHAIN_TRANSACTIONS_PARTIAL_ACK, the reply to a
+// Message.CHAIN_TRANSACTIONS batch of which only some transactions were
+// committed: those committed, and those failed with the reason why.
+type TransactionsPartialAck struct {
+	Committed []string     `protobuf:"bytes,1,rep,name=committed" json:"committed,omitempty"`
+	Failed    []*TxFailure `protobuf:"bytes,2,rep,name=failed" json:"failed,omitempty"`
+}
+
+func (m *TransactionsPartialAck) Reset()         { *m = TransactionsPartialAck{} }
+func (m *TransactionsPartialAck) String() string { return proto.CompactTextString(m) }
+func (*TransactionsPartialAck) ProtoMessage()    {}
+
+func (m *TransactionsPartialAck) GetFailed() []*TxFailure {
+	if m != nil {
+		return m.Failed
+	}
+	return nil
+}
+
+// QueryStakingInfo is the payload of Message.CHAIN_QUERY_STAKING_INFO, asking
+// a peer of a proof-of-stake network for the stake of a validator.
+type QueryStakingInfo struct {
+	ValidatorAddress string `protobuf:"bytes,1,opt,name=validatorAddress" json:"validatorAddress,omitempty"`
+}
+
+func (m *QueryStakingInfo) Reset()         { *m = QueryStakingInfo{} }
+func (m *QueryStakingInfo) String() string { return proto.CompactTextString(m) }
+func (*QueryStakingInfo) ProtoMessage()    {}
+
+// SlashingEvent is a penalty of amount taken from the stake of a validator at
+// blockNumber for reason.
+type SlashingEvent struct {
+	BlockNumber uint64 `protobuf:"varint,1,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	Amount      uint64 `protobuf:"varint,2,opt,name=amount" json:"amount,omitempty"`
+	Reason      string `protobuf:"bytes,3,opt,name=reason" json:"reason,omitempty"`
+}
+
+func (m *SlashingEvent) Reset()         { *m = SlashingEvent{} }
+func (m *SlashingEvent) String() string { return proto.CompactTextString(m) }
+func (*SlashingEvent) ProtoMessage()    {}
+
+// StakingInfo is the payload of Message.CHAIN_STAKING_INFO_RESPONSE, the reply
+// to a Message.CHAIN_QUERY_STAKING_INFO: the amount staked by the validator
+// and delegated to it, the fraction of the rewards of the delegators it
+// keeps, its slashings and whether it is in the active validator set.
+type StakingInfo struct {
+	ValidatorAddress string           `protobuf:"bytes,1,opt,name=validatorAddress" json:"validatorAddress,omitempty"`
+	StakedAmount     uint64           `protobuf:"varint,2,opt,name=stakedAmount" json:"stakedAmount,omitempty"`
+	DelegatedAmount  uint64           `protobuf:"varint,3,opt,name=delegatedAmount" json:"delegatedAmount,omitempty"`
+	Commission       float64          `protobuf:"fixed64,4,opt,name=commission" json:"commission,omitempty"`
+	SlashingEvents   []*SlashingEvent `protobuf:"bytes,5,rep,name=slashingEvents" json:"slashingEvents,omitempty"`
+	IsActive         bool             `protobuf:"varint,6,opt,name=isActive" json:"isActive,omitempty"`
+}
+
+func (m *StakingInfo) Reset()         { *m = StakingInfo{} }
+func (m *StakingInfo) String() string { return proto.CompactTextString(m) }
+func (*StakingInfo) ProtoMessage()    {}
+
+func (m *StakingInfo) GetSlashingEvents() []*SlashingEvent {
+	if m != nil {
+		return m.SlashingEvents
+	}
+	return nil
+}
+
+// QueryUnsupported is the payload of Message.CHAIN_QUERY_UNSUPPORTED, the
+// reply to a query of a type the peer does not answer, such as a
+// Message.CHAIN_QUERY_STAKING_INFO outside of a proof-of-stake network.
+type QueryUnsupported struct {
+	Type   Message_Type `protobuf:"varint,1,opt,name=type,enum=protos.Message_Type" json:"type,omitempty"`
+	Reason string       `protobuf:"bytes,2,opt,name=reason" json:"reason,omitempty"`
+}
+
+func (m *QueryUnsupported) Reset()         { *m = QueryUnsupported{} }
+func (m *QueryUnsupported) String() string { return proto.CompactTextString(m) }
+func (*QueryUnsupported) ProtoMessage()    {}
+
+// QueryAccount is the payload of Message.CHAIN_QUERY_ACCOUNT, asking a peer for
+// the state of an account, answered by a Message.CHAIN_ACCOUNT_RESPONSE or a
+// Message.CHAIN_ACCOUNT_NOT_FOUND carrying the QueryAccount back if the peer
+// knows of no such account.
+type QueryAccount struct {
+	AccountID string `protobuf:"bytes,1,opt,name=accountID" json:"accountID,omitempty"`
+}
+
+func (m *QueryAccount) Reset()         { *m = QueryAccount{} }
+func (m *QueryAccount) String() string { return proto.CompactTextString(m) }
+func (*QueryAccount) ProtoMessage()    {}
+
+// AccountState is the payload of Message.CHAIN_ACCOUNT_RESPONSE, the reply to
+// a Message.CHAIN_QUERY_ACCOUNT: the balance of the account, the number of its
+// committed transactions and the hash of the last one of them.
+type AccountState struct {
+	AccountID  string `protobuf:"bytes,1,opt,name=accountID" json:"accountID,omitempty"`
+	Balance    uint64 `protobuf:"varint,2,opt,name=balance" json:"balance,omitempty"`
+	Nonce      uint64 `protobuf:"varint,3,opt,name=nonce" json:"nonce,omitempty"`
+	LastTxHash []byte `protobuf:"bytes,4,opt,name=lastTxHash,proto3" json:"lastTxHash,omitempty"`
+}
+
+func (m *AccountState) Reset()         { *m = AccountState{} }
+func (m *AccountState) String() string { return proto.CompactTextString(m) }
+func (*AccountState) ProtoMessage()    {}
+
+// ValidateBlock is the payload of Message.CHAIN_VALIDATE_BLOCK, asking a
+// validator to check the transactions of a proposed block before it is voted
+// on.
+type ValidateBlock struct {
+	Block *Block `protobuf:"bytes,1,opt,name=block" json:"block,omitempty"`
+}
+
+func (m *ValidateBlock) Reset()         { *m = ValidateBlock{} }
+func (m *ValidateBlock) String() string { return proto.CompactTextString(m) }
+func (*ValidateBlock) ProtoMessage()    {}
+
+func (m *ValidateBlock) GetBlock() *Block {
+	if m != nil {
+		return m.Block
+	}
+	return nil
+}
+
+// ValidationResult is the payload of Message.CHAIN_VALIDATE_BLOCK_RESULT, the
+// reply to a Message.CHAIN_VALIDATE_BLOCK. invalidTxIDs lists the transactions
+// of the block failing verification, and reason why they or the block did.
+type ValidationResult struct {
+	Valid        bool     `protobuf:"varint,1,opt,name=valid" json:"valid,omitempty"`
+	InvalidTxIDs []string `protobuf:"bytes,2,rep,name=invalidTxIDs" json:"invalidTxIDs,omitempty"`
+	Reason       string   `protobuf:"bytes,3,opt,name=reason" json:"reason,omitempty"`
+}
+
+func (m *ValidationResult) Reset()         { *m = ValidationResult{} }
+func (m *ValidationResult) String() string { return proto.CompactTextString(m) }
+func (*ValidationResult) ProtoMessage()    {}
+
+// TransactionsProgress is the payload of Message.CHAIN_TRANSACTIONS_PROGRESS,
+// sent every peer.tx.progressInterval transactions while a
+// Message.CHAIN_TRANSACTIONS batch is processed. currentTxID is the last
+// processed transaction, out of the total valid transactions of the batch.
+type TransactionsProgress struct {
+	Processed   uint32 `protobuf:"varint,1,opt,name=processed" json:"processed,omitempty"`
+	Total       uint32 `protobuf:"varint,2,opt,name=total" json:"total,omitempty"`
+	CurrentTxID string `protobuf:"bytes,3,opt,name=currentTxID" json:"currentTxID,omitempty"`
+}
+
+func (m *TransactionsProgress) Reset()         { *m = TransactionsProgress{} }
+func (m *TransactionsProgress) String() string { return proto.CompactTextString(m) }
+func (*TransactionsProgress) ProtoMessage()    {}
+
+// BlockSubscription is the payload of Message.CHAIN_SUBSCRIBE_BLOCKS and
+// Message.CHAIN_UNSUBSCRIBE_BLOCKS. On subscribing, the receiver sends a
+// CHAIN_BLOCK for every block from fromBlock on, as they are committed, until
+// the subscription with the subscriber chosen subscriptionID is cancelled or
+// the Chat ends. fromBlock is ignored on unsubscribing.
+type BlockSubscription struct {
+	SubscriptionID string `protobuf:"bytes,1,opt,name=subscriptionID" json:"subscriptionID,omitempty"`
+	FromBlock      uint64 `protobuf:"varint,2,opt,name=fromBlock" json:"fromBlock,omitempty"`
+}
+
+func (m *BlockSubscription) Reset()         { *m = BlockSubscription{} }
+func (m *BlockSubscription) String() string { return proto.CompactTextString(m) }
+func (*BlockSubscription) ProtoMessage()    {}
+
+// BlockSealed is the payload of Message.CHAIN_NEW_BLOCK_SEALED, pushed by a
+// peer to the peers it is connected to when it seals block blockNumber. It
+// only carries what is needed to track the head of the chain, the block being
+// fetched with a Message.CHAIN_GET_BLOCK_BODY when needed.
+type BlockSealed struct {
+	BlockNumber       uint64                     `protobuf:"varint,1,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	BlockHash         []byte                     `protobuf:"bytes,2,opt,name=blockHash,proto3" json:"blockHash,omitempty"`
+	SealerID          *PeerID                    `protobuf:"bytes,3,opt,name=sealerID" json:"sealerID,omitempty"`
+	Timestamp         *google_protobuf.Timestamp `protobuf:"bytes,4,opt,name=timestamp" json:"timestamp,omitempty"`
+	TotalTransactions uint32                     `protobuf:"varint,5,opt,name=totalTransactions" json:"totalTransactions,omitempty"`
+}
+
+func (m *BlockSealed) Reset()         { *m = BlockSealed{} }
+func (m *BlockSealed) String() string { return proto.CompactTextString(m) }
+func (*BlockSealed) ProtoMessage()    {}
+
+func (m *BlockSealed) GetSealerID() *PeerID {
+	if m != nil {
+		return m.SealerID
+	}
+	return nil
+}
+
+func (m *BlockSealed) GetTimestamp() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.Timestamp
+	}
+	return nil
+}
+
+// SubscribedBlock is the payload of Message.CHAIN_BLOCK, block blockNumber
+// sent for the subscription subscriptionID. auditProof is set once the
+// checkpoint window of the block is complete.
+type SubscribedBlock struct {
+	SubscriptionID string           `protobuf:"bytes,1,opt,name=subscriptionID" json:"subscriptionID,omitempty"`
+	BlockNumber    uint64           `protobuf:"varint,2,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	Block          *Block           `protobuf:"bytes,3,opt,name=block" json:"block,omitempty"`
+	AuditProof     *BlockAuditProof `protobuf:"bytes,4,opt,name=auditProof" json:"auditProof,omitempty"`
+}
+
+func (m *SubscribedBlock) Reset()         { *m = SubscribedBlock{} }
+func (m *SubscribedBlock) String() string { return proto.CompactTextString(m) }
+func (*SubscribedBlock) ProtoMessage()    {}
+
+func (m *SubscribedBlock) GetBlock() *Block {
+	if m != nil {
+		return m.Block
+	}
+	return nil
+}
+
+func (m *SubscribedBlock) GetAuditProof() *BlockAuditProof {
+	if m != nil {
+		return m.AuditProof
+	}
+	return nil
+}
+
+// BlockRangeQuery is the payload of Message.CHAIN_QUERY_RANGE, asking a peer
+// for the blocks fromBlock to toBlock included. The receiver sends a
+// CHAIN_BLOCK, without subscriptionID, for at most maxResults of them, its own
+// limit applying when maxResults is 0 or above it, then a
+// CHAIN_QUERY_RANGE_DONE.
+type BlockRangeQuery struct {
+	FromBlock  uint64 `protobuf:"varint,1,opt,name=fromBlock" json:"fromBlock,omitempty"`
+	ToBlock    uint64 `protobuf:"varint,2,opt,name=toBlock" json:"toBlock,omitempty"`
+	MaxResults uint32 `protobuf:"varint,3,opt,name=maxResults" json:"maxResults,omitempty"`
+}
+
+func (m *BlockRangeQuery) Reset()         { *m = BlockRangeQuery{} }
+func (m *BlockRangeQuery) String() string { return proto.CompactTextString(m) }
+func (*BlockRangeQuery) ProtoMessage()    {}
+
+// ChainSyncRequest is the payload of Message.CHAIN_SYNC_REQUEST, asking a peer
+// for the blocks fromBlock to toBlock included with only the transactions
+// whose Transaction.Type name is in txTypeFilter, e.g. CHAINCODE_DEPLOY, all
+// of them if it is empty. The receiver answers as for a CHAIN_QUERY_RANGE,
+// the blocks it filtered transactions out of being partial.
+type ChainSyncRequest struct {
+	FromBlock    uint64   `protobuf:"varint,1,opt,name=fromBlock" json:"fromBlock,omitempty"`
+	ToBlock      uint64   `protobuf:"varint,2,opt,name=toBlock" json:"toBlock,omitempty"`
+	TxTypeFilter []string `protobuf:"bytes,3,rep,name=txTypeFilter" json:"txTypeFilter,omitempty"`
+}
+
+func (m *ChainSyncRequest) Reset()         { *m = ChainSyncRequest{} }
+func (m *ChainSyncRequest) String() string { return proto.CompactTextString(m) }
+func (*ChainSyncRequest) ProtoMessage()    {}
+
+// GetBlockByHash is the payload of Message.CHAIN_GET_BLOCK_BY_HASH, asking a
+// peer for the block hashing to hash, and of the Message.CHAIN_BLOCK_NOT_FOUND
+// reply when the peer has none. The block found is sent in a CHAIN_BLOCK,
+// without subscriptionID, with its blockNumber.
+type GetBlockByHash struct {
+	Hash []byte `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+}
+
+func (m *GetBlockByHash) Reset()         { *m = GetBlockByHash{} }
+func (m *GetBlockByHash) String() string { return proto.CompactTextString(m) }
+func (*GetBlockByHash) ProtoMessage()    {}
+
+// BlockRangeDone is the payload of Message.CHAIN_QUERY_RANGE_DONE, sent after
+// the blocks of a CHAIN_QUERY_RANGE. hasMore is set when the range was cut
+// short by the result limit, the remaining blocks starting at nextBlock.
+type BlockRangeDone struct {
+	HasMore   bool   `protobuf:"varint,1,opt,name=hasMore" json:"hasMore,omitempty"`
+	NextBlock uint64 `protobuf:"varint,2,opt,name=nextBlock" json:"nextBlock,omitempty"`
+}
+
+func (m *BlockRangeDone) Reset()         { *m = BlockRangeDone{} }
+func (m *BlockRangeDone) String() string { return proto.CompactTextString(m) }
+func (*BlockRangeDone) ProtoMessage()    {}
+
+// BlockAuditProof proves that the block with hash blockHash is the block at
+// index of the checkpoint with root checkpointRoot. A checkpoint is the
+// SHA-256 merkle tree over the hashes of a window of consecutive blocks,
+// proof holding the sibling hashes from the leaf of the block to the root.
+type BlockAuditProof struct {
+	BlockHash      []byte   `protobuf:"bytes,1,opt,name=blockHash,proto3" json:"blockHash,omitempty"`
+	CheckpointRoot []byte   `protobuf:"bytes,2,opt,name=checkpointRoot,proto3" json:"checkpointRoot,omitempty"`
+	Proof          [][]byte `protobuf:"bytes,3,rep,name=proof,proto3" json:"proof,omitempty"`
+	Index          uint32   `protobuf:"varint,4,opt,name=index" json:"index,omitempty"`
+}
+
+func (m *BlockAuditProof) Reset()         { *m = BlockAuditProof{} }
+func (m *BlockAuditProof) String() string { return proto.CompactTextString(m) }
+func (*BlockAuditProof) ProtoMessage()    {}
+
+// GetStateRoot is the payload of Message.CHAIN_GET_STATE_ROOT, asking a peer
+// for the state hash of a block.
+type GetStateRoot struct {
+	BlockNumber uint64 `protobuf:"varint,1,opt,name=blockNumber" json:"blockNumber,omitempty"`
+}
+
+func (m *GetStateRoot) Reset()         { *m = GetStateRoot{} }
+func (m *GetStateRoot) String() string { return proto.CompactTextString(m) }
+func (*GetStateRoot) ProtoMessage()    {}
+
+// StateRoot is the payload of Message.CHAIN_STATE_ROOT, the state hash of
+// block blockNumber on the ledger of the sender.
+type StateRoot struct {
+	BlockNumber uint64 `protobuf:"varint,1,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	Root        []byte `protobuf:"bytes,2,opt,name=root,proto3" json:"root,omitempty"`
+}
+
+func (m *StateRoot) Reset()         { *m = StateRoot{} }
+func (m *StateRoot) String() string { return proto.CompactTextString(m) }
+func (*StateRoot) ProtoMessage()    {}
+
+// TransactionProofRequest is the payload of
+// Message.CHAIN_TRANSACTIONS_PROOF_REQUEST, asking a peer for the proof that a
+// transaction is included in a block.
+type TransactionProofRequest struct {
+	TxID        string `protobuf:"bytes,1,opt,name=txID" json:"txID,omitempty"`
+	BlockNumber uint64 `protobuf:"varint,2,opt,name=blockNumber" json:"blockNumber,omitempty"`
+}
+
+func (m *TransactionProofRequest) Reset()         { *m = TransactionProofRequest{} }
+func (m *TransactionProofRequest) String() string { return proto.CompactTextString(m) }
+func (*TransactionProofRequest) ProtoMessage()    {}
+
+// MerkleProof is the payload of Message.CHAIN_TRANSACTIONS_PROOF_RESPONSE.
+// merkleProof holds the sibling hashes on the path from the transaction at
+// leafIndex to root, the merkleRoot of the block header.
+type MerkleProof struct {
+	MerkleProof [][]byte `protobuf:"bytes,1,rep,name=merkleProof,proto3" json:"merkleProof,omitempty"`
+	LeafIndex   uint32   `protobuf:"varint,2,opt,name=leafIndex" json:"leafIndex,omitempty"`
+	Root        []byte   `protobuf:"bytes,3,opt,name=root,proto3" json:"root,omitempty"`
+}
+
+func (m *MerkleProof) Reset()         { *m = MerkleProof{} }
+func (m *MerkleProof) String() string { return proto.CompactTextString(m) }
+func (*MerkleProof) ProtoMessage()    {}
+
+// EncryptedTransaction is the payload of Message.CHAIN_TRANSACTIONS_ENCRYPTED,
+// a transaction only the holder of the private key matching recipientPubKey,
+// DER encoded, can read. encryptedPayload is the marshalled Transaction
+// encrypted with ECIES.
+type EncryptedTransaction struct {
+	RecipientPubKey  []byte `protobuf:"bytes,1,opt,name=recipientPubKey,proto3" json:"recipientPubKey,omitempty"`
+	EncryptedPayload []byte `protobuf:"bytes,2,opt,name=encryptedPayload,proto3" json:"encryptedPayload,omitempty"`
+}
+
+func (m *EncryptedTransaction) Reset()         { *m = EncryptedTransaction{} }
+func (m *EncryptedTransaction) String() string { return proto.CompactTextString(m) }
+func (*EncryptedTransaction) ProtoMessage()    {}
+
+// BlockProposal is the payload of Message.CHAIN_PROPOSE_BLOCK, sent by the
+// leader of a round to propose the block to be committed in that round.
+type BlockProposal struct {
+	Round uint64 `protobuf:"varint,1,opt,name=round" json:"round,omitempty"`
+	Block *Block `protobuf:"bytes,2,opt,name=block" json:"block,omitempty"`
+}
+
+func (m *BlockProposal) Reset()         { *m = BlockProposal{} }
+func (m *BlockProposal) String() string { return proto.CompactTextString(m) }
+func (*BlockProposal) ProtoMessage()    {}
+
+func (m *BlockProposal) GetBlock() *Block {
+	if m != nil {
+		return m.Block
+	}
+	return nil
+}
+
+// BlockVote is the payload of Message.CHAIN_VOTE_BLOCK. voterSig is the
+// signature of voter over the round and the hash of the proposed block.
+type BlockVote struct {
+	Round     uint64  `protobuf:"varint,1,opt,name=round" json:"round,omitempty"`
+	BlockHash []byte  `protobuf:"bytes,2,opt,name=blockHash,proto3" json:"blockHash,omitempty"`
+	VoterSig  []byte  `protobuf:"bytes,3,opt,name=voterSig,proto3" json:"voterSig,omitempty"`
+	Voter     *PeerID `protobuf:"bytes,4,opt,name=voter" json:"voter,omitempty"`
+}
+
+func (m *BlockVote) Reset()         { *m = BlockVote{} }
+func (m *BlockVote) String() string { return proto.CompactTextString(m) }
+func (*BlockVote) ProtoMessage()    {}
+
+func (m *BlockVote) GetVoter() *PeerID {
+	if m != nil {
+		return m.Voter
+	}
+	return nil
+}
+
+// BlockCommit is the payload of Message.CHAIN_COMMIT_BLOCK, sent by the
+// leader once a quorum voted for the block. aggregateSig holds the votes of
+// that quorum.
+type BlockCommit struct {
+	Round        uint64       `protobuf:"varint,1,opt,name=round" json:"round,omitempty"`
+	BlockHash    []byte       `protobuf:"bytes,2,opt,name=blockHash,proto3" json:"blockHash,omitempty"`
+	AggregateSig []*BlockVote `protobuf:"bytes,3,rep,name=aggregateSig" json:"aggregateSig,omitempty"`
+}
+
+func (m *BlockCommit) Reset()         { *m = BlockCommit{} }
+func (m *BlockCommit) String() string { return proto.CompactTextString(m) }
+func (*BlockCommit) ProtoMessage()    {}
+
+func (m *BlockCommit) GetAggregateSig() []*BlockVote {
+	if m != nil {
+		return m.AggregateSig
+	}
+	return nil
+}
+
+// BlockVotes is the consensusMetadata of the blocks committed by the BFT
+// consensus, the votes of the quorum which committed the proposal of hash
+// blockHash in round.
+type BlockVotes struct {
+	Round     uint64           `protobuf:"varint,1,opt,name=round" json:"round,omitempty"`
+	BlockHash []byte           `protobuf:"bytes,2,opt,name=blockHash,proto3" json:"blockHash,omitempty"`
+	Votes     []*ValidatorVote `protobuf:"bytes,3,rep,name=votes" json:"votes,omitempty"`
+}
+
+func (m *BlockVotes) Reset()         { *m = BlockVotes{} }
+func (m *BlockVotes) String() string { return proto.CompactTextString(m) }
+func (*BlockVotes) ProtoMessage()    {}
+
+func (m *BlockVotes) GetVotes() []*ValidatorVote {
+	if m != nil {
+		return m.Votes
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterEnum("protos.TxState", TxState_name, TxState_value)
+	proto.RegisterEnum("protos.SyncBandwidthPolicy", SyncBandwidthPolicy_name, SyncBandwidthPolicy_value)
+	proto.RegisterEnum("protos.Transaction_Type", Transaction_Type_name, Transaction_Type_value)
+	proto.RegisterEnum("protos.HealthCheckResponse_Status", HealthCheckResponse_Status_name, HealthCheckResponse_Status_value)
+	proto.RegisterEnum("protos.PeerEndpoint_Type", PeerEndpoint_Type_name, PeerEndpoint_Type_value)
+	proto.RegisterEnum("protos.Message_Type", Message_Type_name, Message_Type_value)
+	proto.RegisterEnum("protos.Response_StatusCode", Response_StatusCode_name, Response_StatusCode_value)
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// Client API for Peer service
+
+type PeerClient interface {
+	// Accepts a stream of Message during chat session, while receiving
+	// other Message (e.g. from other peers).
+	Chat(ctx context.Context, opts ...grpc.CallOption) (Peer_ChatClient, error)
+	// Process a transaction from a remote source.
+	ProcessTransaction(ctx context.Context, in *Transaction, opts ...grpc.CallOption) (*Response, error)
+}
+
+type peerClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewPeerClient(cc *grpc.ClientConn) PeerClient {
+	return &peerClient{cc}
+}
+
+func (c *peerClient) Chat(ctx context.Context, opts ...grpc.CallOption) (Peer_ChatClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Peer_serviceDesc.Streams[0], c.cc, "/protos.Peer/Chat", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &peerChatClient{stream}
+	return x, nil
+}
+
+type Peer_ChatClient interface {
 	Send(*Message) error
 	Recv() (*Message, error)
 	grpc.ClientStream
@@ -688,3 +2925,60 @@ var _Peer_serviceDesc = grpc.ServiceDesc{
 		},
 	},
 }
+
+// Client API for Health service
+
+type HealthClient interface {
+	Check(ctx context.Context, in *HealthCheckRequest, opts ...grpc.CallOption) (*HealthCheckResponse, error)
+}
+
+type healthClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewHealthClient(cc *grpc.ClientConn) HealthClient {
+	return &healthClient{cc}
+}
+
+func (c *healthClient) Check(ctx context.Context, in *HealthCheckRequest, opts ...grpc.CallOption) (*HealthCheckResponse, error) {
+	out := new(HealthCheckResponse)
+	err := grpc.Invoke(ctx, "/protos.Health/Check", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Health service
+
+type HealthServer interface {
+	Check(context.Context, *HealthCheckRequest) (*HealthCheckResponse, error)
+}
+
+func RegisterHealthServer(s *grpc.Server, srv HealthServer) {
+	s.RegisterService(&_Health_serviceDesc, srv)
+}
+
+func _Health_Check_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(HealthCheckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(HealthServer).Check(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+var _Health_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "protos.Health",
+	HandlerType: (*HealthServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Check",
+			Handler:    _Health_Check_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}